@@ -115,7 +115,8 @@ func (dc *DirectConnection) handleAuthResult() error {
 	if err != nil {
 		return err
 	}
-	// handle auth switch, only support 'sha256_password', and 'caching_sha2_password'
+	// handle auth switch, support 'mysql_native_password', 'caching_sha2_password', 'sha256_password',
+	// 'client_ed25519' and 'mysql_clear_password'(only over tls or unix socket)
 	if switchToPlugin != "" {
 		//fmt.Printf("now switching auth plugin to '%s'\n", switchToPlugin)
 		if data == nil {
@@ -125,6 +126,9 @@ func (dc *DirectConnection) handleAuthResult() error {
 		}
 		dc.authPluginName = switchToPlugin
 		auth, err := dc.CalcPassword(data)
+		if err != nil {
+			return err
+		}
 		if err = dc.WriteAuthSwitchPacket(auth, false); err != nil {
 			return err
 		}
@@ -0,0 +1,136 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// mariadbVersionPrefix MariaDB 10及以上版本握手包中的版本带有该前缀, 以兼容只认识5.x的客户端
+const mariadbVersionPrefix = "5.5.5-"
+
+// BackendInfo version, capabilities and default charset of backend, probed from initial handshake
+type BackendInfo struct {
+	Version    string `json:"version"`    // 握手包中的完整版本, 如8.0.32-log
+	MariaDB    bool   `json:"mariadb"`    // 是否为MariaDB
+	Major      int    `json:"major"`      // 主版本号, MariaDB为去掉5.5.5-前缀后的版本
+	Minor      int    `json:"minor"`      // 次版本号
+	Patch      int    `json:"patch"`      // 修订版本号
+	Capability uint32 `json:"capability"` // 服务端声明的capability flags
+	Charset    string `json:"charset"`    // 服务端默认字符集
+	Collation  string `json:"collation"`  // 服务端默认字符序
+}
+
+// newBackendInfo create BackendInfo from server version, capability and collation in initial handshake
+func newBackendInfo(version string, capability uint32, collationID mysql.CollationID) *BackendInfo {
+	info := &BackendInfo{
+		Version:    version,
+		Capability: capability,
+		Collation:  mysql.Collations[collationID],
+	}
+	info.Charset = mysql.CollationNameToCharset[info.Collation]
+
+	v := strings.TrimPrefix(version, mariadbVersionPrefix)
+	info.MariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+	// 版本号之后可能带有-log, -MariaDB-log等后缀
+	if end := strings.IndexFunc(v, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); end != -1 {
+		v = v[:end]
+	}
+	numbers := []*int{&info.Major, &info.Minor, &info.Patch}
+	for i, part := range strings.SplitN(v, ".", len(numbers)) {
+		*numbers[i], _ = strconv.Atoi(part)
+	}
+	return info
+}
+
+// AtLeast check if version of backend is not lower than major.minor.patch
+func (b *BackendInfo) AtLeast(major, minor, patch int) bool {
+	if b.Major != major {
+		return b.Major > major
+	}
+	if b.Minor != minor {
+		return b.Minor > minor
+	}
+	return b.Patch >= patch
+}
+
+// SupportsCTE check if backend supports WITH clause, MySQL 8.0 or MariaDB 10.2 and above
+func (b *BackendInfo) SupportsCTE() bool {
+	if b == nil {
+		return false
+	}
+	if b.MariaDB {
+		return b.AtLeast(10, 2, 0)
+	}
+	return b.AtLeast(8, 0, 0)
+}
+
+// SupportsGroupReplicationRole check if performance_schema.replication_group_members has MEMBER_ROLE column, MySQL 8.0 and above
+func (b *BackendInfo) SupportsGroupReplicationRole() bool {
+	return b != nil && !b.MariaDB && b.AtLeast(8, 0, 0)
+}
+
+// PoolBackendInfo probed info of one connection pool of slice
+type PoolBackendInfo struct {
+	Addr string       `json:"addr"`
+	Role string       `json:"role"` // master, slave, statistic_slave
+	Info *BackendInfo `json:"info"` // 尚未建立过连接时为nil
+}
+
+// BackendInfos return probed info of master and slaves
+func (s *Slice) BackendInfos() []PoolBackendInfo {
+	s.RLock()
+	defer s.RUnlock()
+	infos := []PoolBackendInfo{{Addr: s.Master.Addr(), Role: "master", Info: s.Master.BackendInfo()}}
+	for _, cp := range s.Slave {
+		infos = append(infos, PoolBackendInfo{Addr: cp.Addr(), Role: "slave", Info: cp.BackendInfo()})
+	}
+	for _, cp := range s.StatisticSlave {
+		infos = append(infos, PoolBackendInfo{Addr: cp.Addr(), Role: "statistic_slave", Info: cp.BackendInfo()})
+	}
+	return infos
+}
+
+// SupportsCTE check if all backends of slice support WITH clause, false if any backend is not probed yet
+func (s *Slice) SupportsCTE() bool {
+	for _, info := range s.BackendInfos() {
+		if !info.Info.SupportsCTE() {
+			return false
+		}
+	}
+	return true
+}
+
+// probeBackend 创建连接池后建立一个连接, 探测后端版本和能力, 失败时由之后新建的连接探测
+func probeBackend(cp ConnectionPool) {
+	ctx, cancel := context.WithTimeout(context.Background(), getConnTimeout)
+	defer cancel()
+	pc, err := cp.Get(ctx)
+	if err != nil {
+		logging.DefaultLogger.Warnf("probe backend %s failed, err: %v", cp.Addr(), err)
+		return
+	}
+	pc.Recycle()
+}
+
+// BackendInfo return info of backend probed when connecting
+func (dc *DirectConnection) BackendInfo() *BackendInfo {
+	return newBackendInfo(dc.serverVersion, dc.capability, dc.serverCollation)
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestNewBackendInfo(t *testing.T) {
+	tests := []struct {
+		version             string
+		mariadb             bool
+		major, minor, patch int
+		cte                 bool
+	}{
+		{"8.0.32-log", false, 8, 0, 32, true},
+		{"5.7.44", false, 5, 7, 44, false},
+		{"5.5.5-10.6.12-MariaDB-log", true, 10, 6, 12, true},
+		{"5.5.5-10.1.48-MariaDB", true, 10, 1, 48, false},
+		{"", false, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		info := newBackendInfo(test.version, 0, mysql.CollationID(33))
+		if info.MariaDB != test.mariadb || info.Major != test.major || info.Minor != test.minor || info.Patch != test.patch {
+			t.Errorf("version not match, version: %s, info: %+v", test.version, info)
+		}
+		if info.SupportsCTE() != test.cte {
+			t.Errorf("cte support not match, version: %s, expect: %v", test.version, test.cte)
+		}
+		if info.Charset != mysql.CharsetUTF8 || info.Collation != "utf8_general_ci" {
+			t.Errorf("charset not match, charset: %s, collation: %s", info.Charset, info.Collation)
+		}
+	}
+
+	var info *BackendInfo
+	if info.SupportsCTE() || info.SupportsGroupReplicationRole() {
+		t.Error("backend not probed should not support any feature")
+	}
+}
+
+func TestConnectionPoolBackendInfo(t *testing.T) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	e, err := ParseEndpoints(s.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := NewConnectionPool(e, "root", "root", "", 1, 1, time.Minute, mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions()})
+	cp.Open()
+	defer cp.Close()
+	if cp.BackendInfo() != nil {
+		t.Fatal("backend info should be nil before connecting")
+	}
+
+	pc, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.Recycle()
+	info := cp.BackendInfo()
+	if info == nil || info.Version != mysql.ServerVersion || !info.SupportsCTE() || info.Capability&mysql.ClientProtocol41 == 0 {
+		t.Errorf("unexpected backend info: %+v", info)
+	}
+}
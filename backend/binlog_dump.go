@@ -0,0 +1,128 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// BinlogDumpOptions options to register as replica and dump binlog
+type BinlogDumpOptions struct {
+	ServerID uint32 // 副本的server_id, 不能为0, 也不能与复制拓扑中其他实例相同
+	Host     string // 注册时上报的地址, 显示在主库SHOW SLAVE HOSTS中, 为空时不注册
+	Port     uint16
+
+	File     string         // 开始的binlog文件, 使用GTIDSet时可以为空
+	Position uint32         // 开始的位置, 通常为4
+	GTIDSet  *mysql.GTIDSet // 不为nil时使用COM_BINLOG_DUMP_GTID, 从第一个不在该集合中的事务开始
+
+	HeartbeatPeriod time.Duration // 主库没有新事件时发送心跳事件的间隔, 0使用主库默认值
+	NonBlock        bool          // 读完已有的binlog后ReadBinlogEvent返回io.EOF
+}
+
+// RegisterSlave send COM_REGISTER_SLAVE to register the connection as a replica
+func (dc *DirectConnection) RegisterSlave(serverID uint32, host string, port uint16) error {
+	data, err := mysql.BuildRegisterSlavePacket(serverID, host, dc.user, "", port)
+	if err != nil {
+		return err
+	}
+	dc.conn.SetSequence(0)
+	if err := dc.writePacket(data); err != nil {
+		return err
+	}
+	return dc.readOK()
+}
+
+// StartBinlogDump register as a replica if host is set and start streaming binlog events,
+// 之后只能调用ReadBinlogEvent读取事件, 连接不能再执行其他命令, 使用后需要关闭, 不能放回连接池
+func (dc *DirectConnection) StartBinlogDump(opts *BinlogDumpOptions) error {
+	if opts.ServerID == 0 {
+		return errors.New("server id of binlog dump must not be 0")
+	}
+	if err := dc.prepareBinlogDump(opts); err != nil {
+		return err
+	}
+	if opts.Host != "" {
+		if err := dc.RegisterSlave(opts.ServerID, opts.Host, opts.Port); err != nil {
+			return fmt.Errorf("register slave error: %v", err)
+		}
+	}
+
+	var flags uint16
+	if opts.NonBlock {
+		flags |= mysql.BinlogDumpNonBlock
+	}
+	var data []byte
+	if opts.GTIDSet != nil {
+		data = mysql.BuildBinlogDumpGTIDPacket(opts.ServerID, opts.File, uint64(opts.Position), flags, opts.GTIDSet)
+	} else {
+		data = mysql.BuildBinlogDumpPacket(opts.ServerID, opts.File, opts.Position, flags)
+	}
+	dc.conn.SetSequence(0)
+	return dc.writePacket(data)
+}
+
+// prepareBinlogDump 设置binlog校验方式和心跳间隔, 主库开启CRC32校验时事件末尾带有校验码
+func (dc *DirectConnection) prepareBinlogDump(opts *BinlogDumpOptions) error {
+	dc.binlogChecksum = false
+	r, err := dc.exec("SELECT @@global.binlog_checksum")
+	if err != nil {
+		// 5.6之前的版本不支持binlog校验
+		var sqlErr *mysql.SQLError
+		if !errors.As(err, &sqlErr) || sqlErr.Code != mysql.ErrUnknownSystemVariable {
+			return err
+		}
+	} else if r.Resultset != nil && len(r.Values) > 0 {
+		checksum, _ := r.GetString(0, 0)
+		if strings.EqualFold(checksum, "CRC32") {
+			if _, err := dc.exec("SET @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+				return err
+			}
+			dc.binlogChecksum = true
+		}
+	}
+
+	if opts.HeartbeatPeriod > 0 {
+		// 单位: 纳秒
+		if _, err := dc.exec(fmt.Sprintf("SET @master_heartbeat_period = %d", opts.HeartbeatPeriod.Nanoseconds())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBinlogEvent read next binlog event after StartBinlogDump, return io.EOF when NonBlock is set and all events are read
+func (dc *DirectConnection) ReadBinlogEvent() (*mysql.BinlogEvent, error) {
+	data, err := dc.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch data[0] {
+	case mysql.OKHeader:
+		return mysql.ParseBinlogEvent(data[1:], dc.binlogChecksum)
+	case mysql.ErrHeader:
+		return nil, dc.handleErrorPacket(data)
+	case mysql.EOFHeader:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("invalid binlog event packet header: %d", data[0])
+	}
+}
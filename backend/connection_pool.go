@@ -18,8 +18,10 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/XiaoMi/Gaea/logging"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/util"
 )
@@ -40,10 +42,10 @@ type connectionPoolImpl struct {
 	mu          sync.RWMutex
 	connections *util.ResourcePool
 
-	addr     string
-	user     string
-	password string
-	db       string
+	endpoints *Endpoints
+	user      string
+	password  string
+	db        string
 
 	charset     string
 	collationID mysql.CollationID
@@ -51,11 +53,15 @@ type connectionPoolImpl struct {
 	capacity    int // capacity of pool
 	maxCapacity int // max capacity of pool
 	idleTimeout time.Duration
+
+	opts DialOptions // 建立连接时使用的tls、压缩、超时等设置
+
+	info atomic.Value // *BackendInfo, 第一个连接握手时探测的后端信息
 }
 
 // NewConnectionPool create connection pool
-func NewConnectionPool(addr, user, password, db string, capacity, maxCapacity int, idleTimeout time.Duration, charset string, collationID mysql.CollationID) ConnectionPool {
-	cp := &connectionPoolImpl{addr: addr, user: user, password: password, db: db, capacity: capacity, maxCapacity: maxCapacity, idleTimeout: idleTimeout, charset: charset, collationID: collationID}
+func NewConnectionPool(endpoints *Endpoints, user, password, db string, capacity, maxCapacity int, idleTimeout time.Duration, charset string, collationID mysql.CollationID, opts DialOptions) ConnectionPool {
+	cp := &connectionPoolImpl{endpoints: endpoints, user: user, password: password, db: db, capacity: capacity, maxCapacity: maxCapacity, idleTimeout: idleTimeout, charset: charset, collationID: collationID, opts: opts}
 	return cp
 }
 
@@ -83,16 +89,27 @@ func (cp *connectionPoolImpl) Open() {
 
 // connect is used by the resource pool to create new resource.It's factory method
 func (cp *connectionPoolImpl) connect() (util.Resource, error) {
-	c, err := NewDirectConnection(cp.addr, cp.user, cp.password, cp.db, cp.charset, cp.collationID)
+	c, err := newDirectConnection(cp.endpoints, cp.user, cp.password, cp.db, cp.charset, cp.collationID, cp.opts)
 	if err != nil {
 		return nil, err
 	}
+	if cp.BackendInfo() == nil {
+		info := c.BackendInfo()
+		cp.info.Store(info)
+		logging.DefaultLogger.Infof("backend %s probed, version: %s, charset: %s", cp.Addr(), info.Version, info.Charset)
+	}
 	return &pooledConnectImpl{directConnection: c, pool: cp}, nil
 }
 
+// BackendInfo return info of backend probed by the first connection, nil if no connection has been established
+func (cp *connectionPoolImpl) BackendInfo() *BackendInfo {
+	info, _ := cp.info.Load().(*BackendInfo)
+	return info
+}
+
 // Addr return addr of connection pool
 func (cp *connectionPoolImpl) Addr() string {
-	return cp.addr
+	return cp.endpoints.String()
 }
 
 // Close close connection pool
@@ -126,7 +143,22 @@ func (cp *connectionPoolImpl) Get(ctx context.Context) (PooledConnect, error) {
 	if err != nil {
 		return nil, err
 	}
-	return r.(*pooledConnectImpl), nil
+	pc := r.(*pooledConnectImpl)
+	// 空闲连接的ip已从域名解析结果中移除, 重新建立连接
+	if cp.isRemoved(pc) {
+		if err := pc.Reconnect(); err != nil {
+			pc.Close()
+			p.Put(nil)
+			return nil, err
+		}
+	}
+	return pc, nil
+}
+
+// isRemoved check if connection should be drained because its ip is removed from dns
+func (cp *connectionPoolImpl) isRemoved(pc *pooledConnectImpl) bool {
+	dc := pc.directConnection
+	return dc != nil && cp.endpoints.isRemoved(dc.addr, dc.remoteAddr)
 }
 
 // Put recycle a connection into the pool
@@ -138,6 +170,9 @@ func (cp *connectionPoolImpl) Put(pc PooledConnect) {
 
 	if pc == nil {
 		p.Put(nil)
+	} else if cp.isRemoved(pc.(*pooledConnectImpl)) {
+		pc.Close()
+		p.Put(nil)
 	} else if err := cp.tryReuse(pc.(*pooledConnectImpl)); err != nil {
 		pc.Close()
 		p.Put(nil)
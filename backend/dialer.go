@@ -0,0 +1,78 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// 拨号方式, 对应slice配置中dialer的scheme
+const (
+	DialerSOCKS5 = "socks5"
+	DialerSSH    = "ssh"
+)
+
+// 连接代理或跳板机并建立隧道的超时时间
+const defaultDialTimeout = 5 * time.Second
+
+// Dialer dial connections to backend, used to reach backends only accessible through a proxy or a bastion host
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// DialerFactory create Dialer from url configured in slice
+type DialerFactory func(u *url.URL) (Dialer, error)
+
+var dialerFactories = map[string]DialerFactory{
+	DialerSOCKS5: newSOCKS5Dialer,
+	DialerSSH:    newSSHDialer,
+}
+
+// RegisterDialer register dialer plugin of url scheme, should be called in init before slices are created
+func RegisterDialer(scheme string, factory DialerFactory) {
+	dialerFactories[scheme] = factory
+}
+
+// NewDialer create dialer from url, the scheme of url selects the dialer plugin
+func NewDialer(rawURL string) (Dialer, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dialer: %v", err)
+	}
+	factory, ok := dialerFactories[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unknown dialer: %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host of dialer: %s", u.Scheme)
+	}
+	return factory(u)
+}
+
+// dialerTimeout return timeout in query param timeout(seconds) of url, or default timeout
+func dialerTimeout(u *url.URL) (time.Duration, error) {
+	v := u.Query().Get("timeout")
+	if v == "" {
+		return defaultDialTimeout, nil
+	}
+	d, err := time.ParseDuration(v + "s")
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout of dialer: %s", v)
+	}
+	return d, nil
+}
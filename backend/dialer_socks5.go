@@ -0,0 +1,189 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SOCKS5协议常量, 参考RFC 1928, RFC 1929
+const (
+	socks5Version          = 0x05
+	socks5AuthNone         = 0x00
+	socks5AuthPassword     = 0x02
+	socks5AuthNoAcceptable = 0xff
+	socks5PasswordVersion  = 0x01
+	socks5CmdConnect       = 0x01
+	socks5AddrIPv4         = 0x01
+	socks5AddrDomain       = 0x03
+	socks5AddrIPv6         = 0x04
+)
+
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Dialer connect to backend through SOCKS5 proxy, url: socks5://[user:password@]host:port[?timeout=seconds]
+type socks5Dialer struct {
+	proxyAddr string
+	user      string
+	password  string
+	timeout   time.Duration
+}
+
+func newSOCKS5Dialer(u *url.URL) (Dialer, error) {
+	timeout, err := dialerTimeout(u)
+	if err != nil {
+		return nil, err
+	}
+	d := &socks5Dialer{proxyAddr: u.Host, timeout: timeout}
+	if u.User != nil {
+		d.user = u.User.Username()
+		d.password, _ = u.User.Password()
+		if len(d.user) > 255 || len(d.password) > 255 {
+			return nil, errors.New("user or password of socks5 dialer is too long")
+		}
+	}
+	return d, nil
+}
+
+// Dial implement Dialer
+func (d *socks5Dialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := net.DialTimeout(network, d.proxyAddr, d.timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(d.timeout))
+	if err := d.handshake(conn, addr); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("socks5 proxy %s connect to %s error: %v", d.proxyAddr, addr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (d *socks5Dialer) handshake(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port: %s", portStr)
+	}
+
+	// 协商认证方式
+	methods := []byte{socks5AuthNone}
+	if d.user != "" {
+		methods = append(methods, socks5AuthPassword)
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("unexpected socks version: %d", buf[0])
+	}
+	switch buf[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if d.user == "" {
+			return errors.New("password authentication required")
+		}
+		req := []byte{socks5PasswordVersion, byte(len(d.user))}
+		req = append(req, d.user...)
+		req = append(req, byte(len(d.password)))
+		req = append(req, d.password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		if buf[1] != 0x00 {
+			return errors.New("authentication failed")
+		}
+	case socks5AuthNoAcceptable:
+		return errors.New("no acceptable authentication method")
+	default:
+		return fmt.Errorf("unsupported authentication method: %d", buf[1])
+	}
+
+	// CONNECT请求, 域名由代理解析
+	req := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host too long: %s", host)
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socks5AddrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socks5AddrIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		if msg, ok := socks5ReplyMessages[reply[1]]; ok {
+			return errors.New(msg)
+		}
+		return fmt.Errorf("unknown reply: %d", reply[1])
+	}
+	// 跳过代理绑定的地址和端口
+	var skip int
+	switch reply[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len + 2
+	case socks5AddrIPv6:
+		skip = net.IPv6len + 2
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return err
+		}
+		skip = int(buf[0]) + 2
+	default:
+		return fmt.Errorf("unknown address type: %d", reply[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sshCommand ssh客户端命令, 测试时替换
+var sshCommand = "ssh"
+
+// ssh进程stderr最多保留的字节数, 用于隧道异常关闭时返回错误信息
+const sshStderrLimit = 4096
+
+// sshDialer connect to backend through ssh tunnel of bastion host, which is opened by `ssh -W`,
+// url: ssh://[user@]host[:port][?identity_file=path&known_hosts_file=path&timeout=seconds]
+type sshDialer struct {
+	args []string
+}
+
+func newSSHDialer(u *url.URL) (Dialer, error) {
+	timeout, err := dialerTimeout(u)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ConnectTimeout=" + strconv.Itoa(int(timeout/time.Second)),
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	query := u.Query()
+	if f := query.Get("identity_file"); f != "" {
+		args = append(args, "-i", f, "-o", "IdentitiesOnly=yes")
+	}
+	if f := query.Get("known_hosts_file"); f != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+f, "-o", "StrictHostKeyChecking=yes")
+	}
+	target := u.Hostname()
+	if u.User != nil && u.User.Username() != "" {
+		target = u.User.Username() + "@" + target
+	}
+	// 参数与目标地址之间加上--, 避免host被当作选项解析
+	args = append(args, "--", target)
+	return &sshDialer{args: args}, nil
+}
+
+// Dial implement Dialer, each connection owns one ssh process, use ControlMaster in ssh config to share ssh connections
+func (d *sshDialer) Dial(network, addr string) (net.Conn, error) {
+	if network != "tcp" {
+		return nil, fmt.Errorf("ssh dialer does not support network: %s", network)
+	}
+	args := make([]string, 0, len(d.args)+2)
+	args = append(args, "-W", addr)
+	args = append(args, d.args...)
+	cmd := exec.Command(sshCommand, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &limitedBuffer{limit: sshStderrLimit}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start ssh tunnel to %s error: %v", addr, err)
+	}
+
+	// 使用net.Pipe转接ssh进程的标准输入输出, 以支持读写超时
+	local, remote := net.Pipe()
+	go func() {
+		io.Copy(stdin, remote)
+		stdin.Close()
+	}()
+	go func() {
+		io.Copy(remote, stdout)
+		// Wait返回时stderr已经复制完成, 之后再关闭, Read读到EOF时才能取到ssh的错误信息
+		cmd.Wait()
+		remote.Close()
+	}()
+	return &sshConn{Conn: local, cmd: cmd, stderr: stderr}, nil
+}
+
+// sshConn connection through ssh tunnel, kill ssh process when closed
+type sshConn struct {
+	net.Conn
+	cmd       *exec.Cmd
+	stderr    *limitedBuffer
+	closeOnce sync.Once
+}
+
+// Read implement net.Conn, return error message of ssh if tunnel closed unexpectedly
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err == io.EOF {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			err = fmt.Errorf("ssh tunnel closed: %s", msg)
+		}
+	}
+	return n, err
+}
+
+// Close implement net.Conn
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.cmd.Process.Kill()
+	})
+	return err
+}
+
+// limitedBuffer concurrent safe buffer which only keeps first limit bytes
+type limitedBuffer struct {
+	sync.Mutex
+	buf   bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	if remain := b.limit - b.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			b.buf.Write(p[:remain])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
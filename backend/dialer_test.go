@@ -0,0 +1,246 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// 设置该环境变量时, 测试程序作为ssh命令运行, 将标准输入输出转发到-W指定的地址
+const sshHelperEnv = "GAEA_TEST_SSH_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(sshHelperEnv) == "1" {
+		runSSHHelper()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runSSHHelper() {
+	var addr string
+	for i, arg := range os.Args {
+		if arg == "-W" && i+1 < len(os.Args) {
+			addr = os.Args[i+1]
+		}
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		os.Stderr.WriteString("channel 0: open failed: connect failed: " + err.Error())
+		os.Exit(255)
+	}
+	go io.Copy(conn, os.Stdin)
+	io.Copy(os.Stdout, conn)
+	os.Exit(0)
+}
+
+// startSOCKS5Server 启动一个只支持CONNECT的SOCKS5代理, user不为空时要求用户名密码认证
+func startSOCKS5Server(t *testing.T, user, password string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, user, password)
+		}
+	}()
+	return l
+}
+
+func serveSOCKS5(conn net.Conn, user, password string) {
+	defer conn.Close()
+	buf := make([]byte, 256)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	if user == "" {
+		conn.Write([]byte{socks5Version, socks5AuthNone})
+	} else {
+		conn.Write([]byte{socks5Version, socks5AuthPassword})
+		io.ReadFull(conn, buf[:2])
+		u := make([]byte, buf[1])
+		io.ReadFull(conn, u)
+		io.ReadFull(conn, buf[:1])
+		p := make([]byte, buf[0])
+		io.ReadFull(conn, p)
+		if string(u) != user || string(p) != password {
+			conn.Write([]byte{socks5PasswordVersion, 0x01})
+			return
+		}
+		conn.Write([]byte{socks5PasswordVersion, 0x00})
+	}
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case socks5AddrIPv4:
+		io.ReadFull(conn, buf[:net.IPv4len])
+		host = net.IP(buf[:net.IPv4len]).String()
+	case socks5AddrDomain:
+		io.ReadFull(conn, buf[:1])
+		n := int(buf[0])
+		io.ReadFull(conn, buf[:n])
+		host = string(buf[:n])
+	default:
+		conn.Write([]byte{socks5Version, 0x08, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	backendConn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{socks5Version, 0x05, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer backendConn.Close()
+	conn.Write([]byte{socks5Version, 0x00, 0x00, socks5AddrIPv4, 127, 0, 0, 1, 0, 0})
+	go io.Copy(backendConn, conn)
+	io.Copy(conn, backendConn)
+}
+
+func testDialerConnection(t *testing.T, rawURL string) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Expect("select 1").WillReturnRows([]string{"1"}, [][]interface{}{{1}})
+
+	dialer, err := NewDialer(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints, err := ParseEndpoints(s.Addr(), EndpointPolicyFailover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := newDirectConnection(endpoints, "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions(), Dialer: dialer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	r, err := dc.Execute("select 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Values) != 1 {
+		t.Errorf("unexpected result: %v", r.Values)
+	}
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	l := startSOCKS5Server(t, "", "")
+	defer l.Close()
+	testDialerConnection(t, "socks5://"+l.Addr().String())
+}
+
+func TestSOCKS5DialerAuth(t *testing.T) {
+	l := startSOCKS5Server(t, "gaea", "p@ss")
+	defer l.Close()
+	testDialerConnection(t, "socks5://gaea:p%40ss@"+l.Addr().String())
+
+	dialer, err := NewDialer("socks5://gaea:wrong@" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dialer.Dial("tcp", "127.0.0.1:3306"); err == nil {
+		t.Error("expect authentication error")
+	}
+}
+
+func TestSSHDialer(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := sshCommand
+	sshCommand = exe
+	os.Setenv(sshHelperEnv, "1")
+	defer func() {
+		sshCommand = origin
+		os.Unsetenv(sshHelperEnv)
+	}()
+
+	testDialerConnection(t, "ssh://gaea@bastion:2222?identity_file=/tmp/id_rsa")
+
+	// 隧道建立失败时返回ssh的错误信息
+	dialer, err := NewDialer("ssh://bastion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.Dial("tcp", "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("expect ssh error, got: %v", err)
+	}
+}
+
+func TestNewSSHDialerArgs(t *testing.T) {
+	d, err := NewDialer("ssh://gaea@bastion:2222?identity_file=/tmp/id_rsa&known_hosts_file=/tmp/known_hosts&timeout=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ConnectTimeout=3",
+		"-p", "2222",
+		"-i", "/tmp/id_rsa", "-o", "IdentitiesOnly=yes",
+		"-o", "UserKnownHostsFile=/tmp/known_hosts", "-o", "StrictHostKeyChecking=yes",
+		"--", "gaea@bastion",
+	}
+	if args := d.(*sshDialer).args; !reflect.DeepEqual(args, expect) {
+		t.Errorf("args not equal, expect: %q, actual: %q", expect, args)
+	}
+}
+
+func TestNewDialerError(t *testing.T) {
+	tests := []string{
+		"http://127.0.0.1:8080",
+		"socks5://",
+		"socks5://127.0.0.1:1080?timeout=abc",
+		"ssh://bastion?timeout=-1",
+		"://bastion",
+	}
+	for _, test := range tests {
+		if _, err := NewDialer(test); err == nil {
+			t.Errorf("expect error of dialer: %s", test)
+		}
+	}
+}
@@ -16,14 +16,17 @@ package backend
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/XiaoMi/Gaea/logging"
 	"net"
 	"strings"
+	"time"
 
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/sync2"
 )
 
@@ -33,12 +36,19 @@ var log = logging.GetLogger("direct-connection")
 type DirectConnection struct {
 	conn *mysql.Conn
 
-	addr     string
-	user     string
-	password string
-	db       string
+	endpoints  *Endpoints
+	addr       string // 当前连接的地址
+	dialAddr   string // 实际拨号的地址, 域名地址解析过时为ip地址
+	remoteAddr string // 实际连接的地址, 域名地址为解析出的ip地址
+	user       string
+	password   string
+	db         string
 
-	capability uint32
+	capability   uint32
+	connectionID uint32 // 握手包中后端分配的连接id, 用于KILL QUERY
+
+	serverVersion   string            // 握手包中的服务端版本
+	serverCollation mysql.CollationID // 握手包中的服务端默认字符序
 
 	sessionVariables *mysql.SessionVariables
 
@@ -55,12 +65,56 @@ type DirectConnection struct {
 	closed sync2.AtomicBool
 
 	authPluginName string
+
+	tlsConfig  *tls.Config
+	tcpOptions util.TCPOptions
+
+	initSQLs []string // 连接建立后依次执行的语句, 会话变量恢复为默认值时重新执行
+	dialer   Dialer   // 为nil时直接连接后端
+	// compression 后端支持时使用的压缩协议, 后端不支持zstd时使用zlib
+	compression mysql.CompressionAlgorithm
+
+	deprecateEOF bool // 握手时协商了CLIENT_DEPRECATE_EOF, 列定义之后没有EOF包, 结果集以0xfe开头的OK包结束
+
+	binlogChecksum bool // binlog事件末尾带有CRC32校验码, StartBinlogDump时设置
+
+	timeouts Timeouts      // 建立连接和执行语句的默认超时时间
+	call     *callDeadline // 正在执行的语句的超时控制, 没有超时限制时为nil
+}
+
+// DialOptions groups settings used when connecting to backend besides address and account
+type DialOptions struct {
+	TLSConfig   *tls.Config // nil means not use tls
+	TCPOptions  util.TCPOptions
+	InitSQLs    []string                   // 连接建立后依次执行的语句
+	Dialer      Dialer                     // nil means dial backend directly
+	Compression mysql.CompressionAlgorithm // 后端支持时使用的压缩协议
+	Timeouts    Timeouts                   // 建立连接和执行语句的默认超时时间
 }
 
 // NewDirectConnection return direct and authorised connection to mysql with real net connection
+// addr can be comma separated addresses, which are tried in order until one is connected
 func NewDirectConnection(addr string, user string, password string, db string, charset string, collationID mysql.CollationID) (*DirectConnection, error) {
+	return NewDirectConnectionWithTLS(addr, user, password, db, charset, collationID, nil)
+}
+
+// NewDirectConnectionWithTLS return direct and authorised connection to mysql, using tls if tlsConfig is not nil
+func NewDirectConnectionWithTLS(addr string, user string, password string, db string, charset string, collationID mysql.CollationID, tlsConfig *tls.Config) (*DirectConnection, error) {
+	endpoints, err := ParseEndpoints(addr, EndpointPolicyFailover)
+	if err != nil {
+		return nil, err
+	}
+	opts := DialOptions{
+		TLSConfig:  tlsConfig,
+		TCPOptions: util.DefaultTCPOptions(),
+		Timeouts:   Timeouts{Connect: DefaultConnectTimeout},
+	}
+	return newDirectConnection(endpoints, user, password, db, charset, collationID, opts)
+}
+
+func newDirectConnection(endpoints *Endpoints, user string, password string, db string, charset string, collationID mysql.CollationID, opts DialOptions) (*DirectConnection, error) {
 	dc := &DirectConnection{
-		addr:             addr,
+		endpoints:        endpoints,
 		user:             user,
 		password:         password,
 		db:               db,
@@ -70,64 +124,140 @@ func NewDirectConnection(addr string, user string, password string, db string, c
 		defaultCollation: collationID,
 		closed:           sync2.NewAtomicBool(false),
 		sessionVariables: mysql.NewSessionVariables(),
+		tlsConfig:        opts.TLSConfig,
+		tcpOptions:       opts.TCPOptions,
+		initSQLs:         opts.InitSQLs,
+		dialer:           opts.Dialer,
+		compression:      opts.Compression,
+		timeouts:         opts.Timeouts,
 	}
 	err := dc.connect()
 	return dc, err
 }
 
 // connect means real connection to backend mysql after authorization
+// 依次尝试各个地址, 直到连接成功
 func (dc *DirectConnection) connect() error {
 	if dc.conn != nil {
 		dc.conn.Close()
 	}
 
+	var err error
+	for _, addr := range dc.endpoints.candidates() {
+		dc.addr = addr
+		dialAddrs := dc.endpoints.dialAddrs(addr)
+		for _, dialAddr := range dialAddrs {
+			if err = dc.connectAddr(dialAddr); err == nil {
+				return nil
+			}
+			if len(dc.endpoints.addrs) > 1 || len(dialAddrs) > 1 {
+				log.Warnf("connect to backend failed, try next endpoint, addr: %s, dial addr: %s, err: %v", addr, dialAddr, err)
+			}
+		}
+	}
+	return err
+}
+
+// connectAddr connect to dialAddr, which is dc.addr or ip address resolved from dc.addr
+func (dc *DirectConnection) connectAddr(dialAddr string) error {
 	typ := "tcp"
-	if strings.Contains(dc.addr, "/") {
+	if strings.Contains(dialAddr, "/") {
 		typ = "unix"
 	}
 
-	netConn, err := net.Dial(typ, dc.addr)
+	var netConn net.Conn
+	var err error
+	if dc.dialer == nil {
+		netConn, err = net.DialTimeout(typ, dialAddr, dc.timeouts.Connect)
+	} else if typ == "unix" {
+		return fmt.Errorf("dialer is not supported by unix socket: %s", dialAddr)
+	} else {
+		netConn, err = dc.dialer.Dial(typ, dialAddr)
+	}
 	if err != nil {
-		return err
+		return dc.connectError(err)
 	}
+	dc.dialAddr = dialAddr
+	dc.remoteAddr = netConn.RemoteAddr().String()
 
-	tcpConn := netConn.(*net.TCPConn)
 	// SetNoDelay controls whether the operating system should delay packet transmission
 	// in hopes of sending fewer packets (Nagle's algorithm).
 	// The default is true (no delay),
 	// meaning that data is sent as soon as possible after a Write.
-	tcpConn.SetNoDelay(true)
-	tcpConn.SetKeepAlive(true)
-	dc.conn = mysql.NewConn(tcpConn)
+	// unix socket连接会忽略tcp参数
+	if err := dc.tcpOptions.Apply(netConn); err != nil {
+		netConn.Close()
+		return err
+	}
+	dc.conn = mysql.NewConn(netConn)
+
+	// 握手、认证和初始化语句都计入连接超时
+	if dc.timeouts.Connect > 0 {
+		netConn.SetDeadline(time.Now().Add(dc.timeouts.Connect))
+	}
+	if err := dc.handshake(netConn); err != nil {
+		dc.conn.Close()
+		return dc.connectError(err)
+	}
+	// tls连接与原连接共享截止时间
+	netConn.SetDeadline(time.Time{})
+	return nil
+}
 
+// handshake authorise and initialize connection after net connection is established
+func (dc *DirectConnection) handshake(netConn net.Conn) error {
 	// step1: read handshake requirements
 	if err := dc.readInitialHandshake(); err != nil {
-		dc.conn.Close()
 		return err
 	}
 
-	// step2: write handshake response
-	if err := dc.writeHandshakeResponse41(); err != nil {
-		dc.conn.Close()
+	// step2: switch to tls if needed
+	if dc.tlsConfig != nil {
+		if err := dc.switchToTLS(netConn); err != nil {
+			return err
+		}
+	}
 
+	// step3: write handshake response
+	if err := dc.writeHandshakeResponse41(); err != nil {
 		return err
 	}
 
-	err = dc.handleAuthResult()
-	if err != nil {
-		dc.conn.Close()
+	if err := dc.handleAuthResult(); err != nil {
 		return err
 	}
 
+	if capability := dc.clientCapability(); capability&mysql.ClientZstdCompressionAlgorithm != 0 {
+		if err := dc.conn.EnableCompression(mysql.CompressionZstd, mysql.DefaultZstdCompressionLevel); err != nil {
+			return err
+		}
+	} else if capability&mysql.ClientCompress != 0 {
+		if err := dc.conn.EnableCompression(mysql.CompressionZlib, 0); err != nil {
+			return err
+		}
+	}
+
 	// we must always use autocommit
 	if !dc.IsAutoCommit() {
 		if _, err := dc.exec("set autocommit = 1"); err != nil {
-			dc.conn.Close()
-
 			return err
 		}
 	}
 
+	if err := dc.execInitSQLs(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// execInitSQLs execute init statements of namespace in order
+func (dc *DirectConnection) execInitSQLs() error {
+	for _, sql := range dc.initSQLs {
+		if _, err := dc.exec(sql); err != nil {
+			return fmt.Errorf("execute init sql error, addr: %s, sql: %s, err: %w", dc.addr, sql, err)
+		}
+	}
 	return nil
 }
 
@@ -145,6 +275,51 @@ func (dc *DirectConnection) Close() {
 	return
 }
 
+// Abort interrupts the executing statement by closing the network connection, it can be called from other goroutine.
+// The connection is marked closed, and discarded by the pool when recycled.
+func (dc *DirectConnection) Abort() {
+	dc.closed.Set(true)
+	if conn := dc.conn; conn != nil {
+		conn.Close()
+	}
+}
+
+// KillQuery interrupts the executing statement by sending KILL QUERY through a one-off connection, the connection
+// is still usable after the statement is interrupted. It can be called from other goroutine.
+// 连接id只在单个后端实例内唯一, 所以新连接直接连到本连接的实际地址, 而不是从连接池获取可能连到其他地址的连接
+func (dc *DirectConnection) KillQuery() error {
+	if dc.IsClosed() {
+		return nil
+	}
+	// 通过dialer连接时RemoteAddr是代理的地址
+	addr := dc.remoteAddr
+	if dc.dialer != nil || strings.Contains(dc.dialAddr, "/") {
+		addr = dc.dialAddr
+	}
+	endpoints, err := ParseEndpoints(addr, EndpointPolicyFailover)
+	if err != nil {
+		return err
+	}
+	opts := DialOptions{
+		TLSConfig:  dc.tlsConfig,
+		TCPOptions: dc.tcpOptions,
+		Dialer:     dc.dialer,
+		Timeouts:   Timeouts{Connect: killQueryTimeout, FirstByte: killQueryTimeout, Total: killQueryTimeout},
+	}
+	killer, err := newDirectConnection(endpoints, dc.user, dc.password, "", dc.defaultCharset, dc.defaultCollation, opts)
+	if err != nil {
+		return err
+	}
+	defer killer.Close()
+	_, err = killer.Execute(fmt.Sprintf("KILL QUERY %d", dc.connectionID))
+	return err
+}
+
+// GetConnectionID return connection id assigned by backend in initial handshake
+func (dc *DirectConnection) GetConnectionID() uint32 {
+	return dc.connectionID
+}
+
 // IsClosed check if connection closed
 func (dc *DirectConnection) IsClosed() bool {
 	return dc.closed.Get()
@@ -204,10 +379,15 @@ func (dc *DirectConnection) readInitialHandshake() error {
 		return fmt.Errorf("invalid protocol version %d, must >= 10", data[0])
 	}
 
-	//skip mysql version and connection id
 	//mysql version end with 0x00
-	//connection id length is 4
-	pos := 1 + bytes.IndexByte(data[1:], 0x00) + 1 + 4
+	//connection id, length is 4
+	versionEnd := 1 + bytes.IndexByte(data[1:], 0x00)
+	if versionEnd == 0 {
+		return errors.New("invalid initial handshake, server version not terminated")
+	}
+	dc.serverVersion = string(data[1:versionEnd])
+	dc.connectionID = binary.LittleEndian.Uint32(data[versionEnd+1 : versionEnd+5])
+	pos := versionEnd + 1 + 4
 
 	dc.salt = append(dc.salt, data[pos:pos+8]...)
 
@@ -220,8 +400,7 @@ func (dc *DirectConnection) readInitialHandshake() error {
 	pos += 2
 
 	if len(data) > pos {
-		//skip server charset
-		//c.charset = data[pos]
+		dc.serverCollation = mysql.CollationID(data[pos])
 		pos++
 
 		dc.status = binary.LittleEndian.Uint16(data[pos : pos+2])
@@ -264,6 +443,18 @@ func (dc *DirectConnection) CalcPassword(authData []byte) ([]byte, error) {
 		return mysql.CalcPassword(authData[:20], []byte(dc.password)), nil
 	case mysql.AUTH_CACHING_SHA2_PASSWORD:
 		return mysql.CalcCachingSha2Password(authData, dc.password), nil
+	case mysql.AUTH_CLIENT_ED25519:
+		// mariadb ed25519 uses 32 bytes nonce
+		if len(authData) < 32 {
+			return nil, fmt.Errorf("invalid ed25519 scramble length: %d", len(authData))
+		}
+		return mysql.CalcEd25519Password(authData[:32], []byte(dc.password)), nil
+	case mysql.AUTH_CLEAR_PASSWORD:
+		// never send cleartext password over insecure connection
+		if dc.tlsConfig == nil && !strings.Contains(dc.addr, "/") {
+			return nil, fmt.Errorf("auth plugin '%s' requires tls or unix socket", dc.authPluginName)
+		}
+		return append([]byte(dc.password), 0), nil
 	//case mysql.AUTH_SHA256_PASSWORD:
 	//	if len(c.password) == 0 {
 	//		return nil, true, nil
@@ -283,13 +474,65 @@ func (dc *DirectConnection) CalcPassword(authData []byte) ([]byte, error) {
 	}
 }
 
+// clientCapability adjust client capability flags based on server support
+func (dc *DirectConnection) clientCapability() uint32 {
+	capability := mysql.ClientProtocol41 | mysql.ClientSecureConnection |
+		mysql.ClientLongPassword | mysql.ClientTransactions | mysql.ClientPluginAuth | mysql.ClientLongFlag |
+		mysql.ClientDeprecateEOF
+	switch dc.compression {
+	case mysql.CompressionZstd:
+		if dc.capability&mysql.ClientZstdCompressionAlgorithm != 0 {
+			capability |= mysql.ClientZstdCompressionAlgorithm
+		} else {
+			capability |= mysql.ClientCompress
+		}
+	case mysql.CompressionZlib:
+		capability |= mysql.ClientCompress
+	}
+	capability &= dc.capability
+	if dc.tlsConfig != nil {
+		capability |= mysql.ClientSSL
+	}
+	return capability
+}
+
+// switchToTLS send SSLRequest packet and upgrade connection to tls
+// see: http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::SSLRequest
+func (dc *DirectConnection) switchToTLS(netConn net.Conn) error {
+	if dc.capability&mysql.ClientSSL == 0 {
+		return fmt.Errorf("backend %s does not support tls", dc.addr)
+	}
+
+	// capability, max packet size, charset and 23 bytes filler
+	data := make([]byte, 4+4+1+23)
+	binary.LittleEndian.PutUint32(data, dc.clientCapability())
+	data[8] = byte(mysql.DefaultCollationID)
+	if err := dc.conn.WritePacket(data); err != nil {
+		return err
+	}
+
+	cfg := dc.tlsConfig.Clone()
+	if cfg.ServerName == "" {
+		if host, _, err := net.SplitHostPort(dc.addr); err == nil {
+			cfg.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(netConn, cfg)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+
+	sequence := dc.conn.GetSequence()
+	dc.conn = mysql.NewConn(tlsConn)
+	dc.conn.SetSequence(sequence)
+	return nil
+}
+
 // See: http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::HandshakeResponse
 // writeHandshakeResponse41 writes the handshake response.
 func (dc *DirectConnection) writeHandshakeResponse41() error {
-	// Adjust client capability flags based on server support
-	capability := mysql.ClientProtocol41 | mysql.ClientSecureConnection |
-		mysql.ClientLongPassword | mysql.ClientTransactions | mysql.ClientPluginAuth | mysql.ClientLongFlag
-	capability &= dc.capability
+	capability := dc.clientCapability()
+	dc.deprecateEOF = capability&mysql.ClientDeprecateEOF != 0
 
 	//capability := CLIENT_PROTOCOL_41 | CLIENT_SECURE_CONNECTION |
 	//		CLIENT_LONG_PASSWORD | CLIENT_TRANSACTIONS | CLIENT_PLUGIN_AUTH | c.capability&CLIENT_LONG_FLAG
@@ -328,6 +571,10 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 		capability |= mysql.ClientConnectWithDB
 		length += len(dc.db) + 1
 	}
+	// zstd_compression_level [1 byte]
+	if capability&mysql.ClientZstdCompressionAlgorithm != 0 {
+		length++
+	}
 
 	data := make([]byte, length)
 
@@ -347,24 +594,7 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 	// use default collation id 33 here, is utf-8
 	data[8] = byte(mysql.DefaultCollationID)
 
-	// SSL Connection Request Packet
-	// http://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::SSLRequest
-	//if c.tlsConfig != nil {
-	//	// Send TLS / SSL request packet
-	//	if err := c.WritePacket(data[:(4+4+1+23)+4]); err != nil {
-	//		return err
-	//	}
-	//
-	//	// Switch to TLS
-	//	tlsConn := tls.Client(c.Conn.Conn, c.tlsConfig)
-	//	if err := tlsConn.Handshake(); err != nil {
-	//		return err
-	//	}
-	//
-	//	currentSequence := c.Sequence
-	//	c.Conn = packet.NewConn(tlsConn)
-	//	c.Sequence = currentSequence
-	//}
+	// SSL Connection Request Packet has been sent in switchToTLS
 
 	// Filler [23 bytes] (all 0x00)
 	pos := 9
@@ -397,6 +627,11 @@ func (dc *DirectConnection) writeHandshakeResponse41() error {
 	// Assume native client during response
 	pos += copy(data[pos:], dc.authPluginName)
 	data[pos] = 0x00
+	pos++
+
+	if capability&mysql.ClientZstdCompressionAlgorithm != 0 {
+		data[pos] = mysql.DefaultZstdCompressionLevel
+	}
 
 	if err := dc.writePacket(data); err != nil {
 		return err
@@ -518,7 +753,17 @@ func (dc *DirectConnection) GetAddr() string {
 
 // Execute send ComQuery or ComStmtPrepare/ComStmtExecute/ComStmtClose to backend mysql
 func (dc *DirectConnection) Execute(sql string) (*mysql.Result, error) {
-	return dc.exec(sql)
+	return dc.ExecuteWithTimeouts(sql, dc.timeouts)
+}
+
+// ExecuteWithTimeouts execute sql with first byte and total timeouts of this call,
+// 超时时连接被关闭, 返回TimeoutError
+func (dc *DirectConnection) ExecuteWithTimeouts(sql string, timeouts Timeouts) (*mysql.Result, error) {
+	call := dc.startCall(timeouts)
+	dc.call = call
+	r, err := dc.exec(sql)
+	dc.call = nil
+	return r, call.finish(err)
 }
 
 // Begin send ComQuery with 'begin' to backend mysql to start transaction
@@ -627,7 +872,15 @@ func (dc *DirectConnection) WriteSetStatement() error {
 		appendSetVariable(&setVariableSQL, v.Name(), v.Get())
 	}
 
-	for _, v := range dc.sessionVariables.GetUnusedAndClear() {
+	unused := dc.sessionVariables.GetUnusedAndClear()
+	if len(unused) != 0 && len(dc.initSQLs) != 0 {
+		// 恢复为默认值的变量可能由初始化语句设置, 需要先恢复默认值并重新执行初始化语句, 再设置会话的变量
+		if err := dc.resetVariablesToInit(unused); err != nil {
+			return err
+		}
+		unused = nil
+	}
+	for _, v := range unused {
 		appendSetVariableToDefault(&setVariableSQL, v.Name())
 	}
 
@@ -641,6 +894,18 @@ func (dc *DirectConnection) WriteSetStatement() error {
 	return nil
 }
 
+// resetVariablesToInit set unused variables to default, then execute init statements again
+func (dc *DirectConnection) resetVariablesToInit(unused map[string]*mysql.Variable) error {
+	var buf bytes.Buffer
+	for _, v := range unused {
+		appendSetVariableToDefault(&buf, v.Name())
+	}
+	if _, err := dc.exec(buf.String()); err != nil {
+		return err
+	}
+	return dc.execInitSQLs()
+}
+
 // FieldList send ComFieldList to backend mysql
 func (dc *DirectConnection) FieldList(table string, wildcard string) ([]*mysql.Field, error) {
 	if err := dc.writeComFieldList(table, wildcard); err != nil {
@@ -716,6 +981,10 @@ func (dc *DirectConnection) readResultColumns(result *mysql.Result) (err error)
 	var i = 0
 	var data []byte
 
+	if dc.deprecateEOF && len(result.Fields) == 0 {
+		return
+	}
+
 	for {
 		data, err = dc.readPacket()
 		if err != nil {
@@ -723,7 +992,7 @@ func (dc *DirectConnection) readResultColumns(result *mysql.Result) (err error)
 		}
 
 		// EOF Packet
-		if dc.isEOFPacket(data) {
+		if !dc.deprecateEOF && dc.isEOFPacket(data) {
 			if dc.capability&mysql.ClientProtocol41 > 0 {
 				//result.Warnings = binary.LittleEndian.Uint16(data[1:])
 				//todo add strict_mode, warning will be treat as error
@@ -742,6 +1011,10 @@ func (dc *DirectConnection) readResultColumns(result *mysql.Result) (err error)
 			return dc.handleErrorPacket(data)
 		}
 
+		if i == len(result.Fields) {
+			return mysql.ErrMalformPacket
+		}
+
 		result.Fields[i], err = mysql.FieldData(data).Parse()
 		if err != nil {
 			return
@@ -750,6 +1023,11 @@ func (dc *DirectConnection) readResultColumns(result *mysql.Result) (err error)
 		result.FieldNames[string(result.Fields[i].Name)] = i
 
 		i++
+
+		// 协商了CLIENT_DEPRECATE_EOF时列定义之后没有EOF包
+		if dc.deprecateEOF && i == len(result.Fields) {
+			return
+		}
 	}
 }
 
@@ -765,7 +1043,13 @@ func (dc *DirectConnection) readResultRows(result *mysql.Result, isBinary bool)
 
 		// EOF Packet
 		if dc.isEOFPacket(data) {
-			if dc.capability&mysql.ClientProtocol41 > 0 {
+			if dc.deprecateEOF {
+				r, err := dc.handleOKPacket(data)
+				if err != nil {
+					return err
+				}
+				result.Status = r.Status
+			} else if dc.capability&mysql.ClientProtocol41 > 0 {
 				//result.Warnings = binary.LittleEndian.Uint16(data[1:])
 				//todo add strict_mode, warning will be treat as error
 				result.Status = binary.LittleEndian.Uint16(data[3:])
@@ -795,7 +1079,12 @@ func (dc *DirectConnection) readResultRows(result *mysql.Result, isBinary bool)
 	return nil
 }
 
+// isEOFPacket check if data is the end of resultset or field list, which is an OK packet with EOF header if CLIENT_DEPRECATE_EOF is negotiated.
+// 行数据也可能以0xfe开头(长度不小于2^24的字符串), 此时包长度为最大包长度
 func (dc *DirectConnection) isEOFPacket(data []byte) bool {
+	if dc.deprecateEOF {
+		return data[0] == mysql.EOFHeader && len(data) < mysql.MaxPacketSize
+	}
 	return data[0] == mysql.EOFHeader && len(data) <= 5
 }
 
@@ -850,6 +1139,7 @@ func (dc *DirectConnection) readResult(binary bool) (*mysql.Result, error) {
 	if err != nil {
 		return nil, err
 	}
+	dc.call.received()
 	if data[0] == mysql.OKHeader {
 		return dc.handleOKPacket(data)
 	} else if data[0] == mysql.ErrHeader {
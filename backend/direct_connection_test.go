@@ -15,7 +15,13 @@ package backend
 
 import (
 	"bytes"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+	"github.com/XiaoMi/Gaea/util"
 )
 
 func TestAppendSetVariable(t *testing.T) {
@@ -37,3 +43,150 @@ func TestAppendSetVariable2(t *testing.T) {
 	appendSetVariableToDefault(&buf, "sql_mode")
 	t.Log(buf.String())
 }
+
+func TestDirectConnectionInitSQLs(t *testing.T) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	endpoints, err := ParseEndpoints(s.Addr(), EndpointPolicyFailover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initSQLs := []string{"SET time_zone = '+00:00'", "SET SESSION group_concat_max_len = 102400"}
+	dc, err := newDirectConnection(endpoints, "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions(), InitSQLs: initSQLs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	if queries := s.Queries(); !reflect.DeepEqual(queries, initSQLs) {
+		t.Fatalf("init sqls not executed, queries: %v", queries)
+	}
+
+	// 会话修改的变量恢复默认值时, 重新执行初始化语句, 再设置其他会话的变量
+	frontend := mysql.NewSessionVariables()
+	if err := frontend.Set(mysql.TimeZone, "+08:00"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SetSessionVariables(frontend); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.WriteSetStatement(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dc.SetSessionVariables(mysql.NewSessionVariables()); err != nil {
+		t.Fatal(err)
+	}
+	if err := dc.WriteSetStatement(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"SET time_zone = '+00:00'",
+		"SET SESSION group_concat_max_len = 102400",
+		"SET NAMES 'utf8' COLLATE 'utf8_general_ci',time_zone = '+08:00'",
+		"SET time_zone = DEFAULT",
+		"SET time_zone = '+00:00'",
+		"SET SESSION group_concat_max_len = 102400",
+		"SET NAMES 'utf8' COLLATE 'utf8_general_ci'",
+	}
+	if queries := s.Queries(); !reflect.DeepEqual(queries, expect) {
+		t.Errorf("queries not equal, expect: %q, actual: %q", expect, queries)
+	}
+}
+
+func TestDirectConnectionCompress(t *testing.T) {
+	for _, algorithm := range []mysql.CompressionAlgorithm{mysql.CompressionZlib, mysql.CompressionZstd} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			testDirectConnectionCompress(t, algorithm)
+		})
+	}
+}
+
+func testDirectConnectionCompress(t *testing.T, algorithm mysql.CompressionAlgorithm) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var rows [][]interface{}
+	for i := 0; i < 1000; i++ {
+		rows = append(rows, []interface{}{i, strings.Repeat("a", 100)})
+	}
+	s.Expect(`^select id, name from t`).WillReturnRows([]string{"id", "name"}, rows)
+
+	endpoints, err := ParseEndpoints(s.Addr(), EndpointPolicyFailover)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := newDirectConnection(endpoints, "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions(), Compression: algorithm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	if !dc.conn.IsCompressed() {
+		t.Fatalf("compression should be enabled")
+	}
+
+	r, err := dc.Execute("select id, name from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowNumber() != len(rows) {
+		t.Fatalf("row number not equal, expect: %d, actual: %d", len(rows), r.RowNumber())
+	}
+	if id, _ := r.GetInt(999, 0); id != 999 {
+		t.Errorf("value not equal, expect: 999, actual: %d", id)
+	}
+	if err := dc.Ping(); err != nil {
+		t.Errorf("ping after compressed resultset failed: %v", err)
+	}
+}
+
+func TestDirectConnectionDeprecateEOF(t *testing.T) {
+	for _, deprecateEOF := range []bool{false, true} {
+		s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		s.SetDeprecateEOF(deprecateEOF)
+		s.Expect(`^select id, name from t where id < 3`).WillReturnRows([]string{"id", "name"}, [][]interface{}{{1, "a"}, {2, "b"}})
+
+		endpoints, err := ParseEndpoints(s.Addr(), EndpointPolicyFailover)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dc, err := newDirectConnection(endpoints, "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dc.Close()
+		if dc.deprecateEOF != deprecateEOF {
+			t.Fatalf("deprecate eof not negotiated, expect: %v, actual: %v", deprecateEOF, dc.deprecateEOF)
+		}
+
+		r, err := dc.Execute("select id, name from t where id < 3")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.RowNumber() != 2 || len(r.Fields) != 2 {
+			t.Fatalf("resultset not equal, deprecate eof: %v, rows: %d, fields: %d", deprecateEOF, r.RowNumber(), len(r.Fields))
+		}
+		if name, _ := r.GetString(1, 1); name != "b" {
+			t.Errorf("value not equal, expect: b, actual: %s", name)
+		}
+		if r.Status&mysql.ServerStatusAutocommit == 0 || !dc.IsAutoCommit() {
+			t.Errorf("status of end packet not parsed, deprecate eof: %v, status: %d", deprecateEOF, r.Status)
+		}
+
+		if _, err := dc.FieldList("t", ""); err != nil {
+			t.Errorf("field list failed, deprecate eof: %v, err: %v", deprecateEOF, err)
+		}
+		if err := dc.Ping(); err != nil {
+			t.Errorf("ping after resultset failed, deprecate eof: %v, err: %v", deprecateEOF, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+)
+
+// 单次重新解析所有域名的超时时间上限
+const maxDNSResolveTimeout = 5 * time.Second
+
+// StartDNSRefresh re-resolve hostnames of backend addresses periodically, do nothing if dns_refresh_interval is not set.
+// New connections are made to the latest resolved ip addresses, and connections to removed ip addresses are closed
+// when recycled or taken from pool if dns_drain_removed is set
+func (s *Slice) StartDNSRefresh() {
+	if s.Cfg.DNSRefreshInterval <= 0 {
+		return
+	}
+	interval := time.Duration(s.Cfg.DNSRefreshInterval) * time.Second
+	timeout := interval
+	if timeout > maxDNSResolveTimeout {
+		timeout = maxDNSResolveTimeout
+	}
+
+	s.refreshDNS(timeout)
+	s.dnsStop = make(chan struct{})
+	go s.dnsLoop(interval, timeout, s.dnsStop)
+}
+
+func (s *Slice) dnsLoop(interval, timeout time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.refreshDNS(timeout)
+		}
+	}
+}
+
+// refreshDNS 重新解析当前所有连接池的地址, 包括拓扑发现新建的连接池
+func (s *Slice) refreshDNS(timeout time.Duration) {
+	s.RLock()
+	pools := make([]ConnectionPool, 0, len(s.Slave)+len(s.StatisticSlave)+1)
+	pools = append(pools, s.Master)
+	pools = append(pools, s.Slave...)
+	pools = append(pools, s.StatisticSlave...)
+	s.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, p := range pools {
+		cp, ok := p.(*connectionPoolImpl)
+		if !ok {
+			continue
+		}
+		changed, err := cp.endpoints.resolve(ctx)
+		if err != nil {
+			logging.DefaultLogger.Warnf("slice %s resolve backend %s failed, err: %v", s.Cfg.Name, cp.Addr(), err)
+		}
+		if changed {
+			logging.DefaultLogger.Infof("slice %s backend %s resolved to %v", s.Cfg.Name, cp.Addr(), cp.endpoints.resolvedAddrs())
+		}
+	}
+}
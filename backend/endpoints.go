@@ -0,0 +1,192 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+const (
+	endpointSplit = ","
+
+	// EndpointPolicyFailover 按配置顺序连接, 前面的地址不可用时依次尝试后面的地址
+	EndpointPolicyFailover = "failover"
+	// EndpointPolicyRoundRobin 新建连接时轮询各地址, 不可用时尝试下一个
+	EndpointPolicyRoundRobin = "round_robin"
+	// EndpointPolicyRandom 新建连接时随机选择地址, 不可用时尝试下一个
+	EndpointPolicyRandom = "random"
+)
+
+// Endpoints 同一个后端的多个地址及选择策略, 用于不依赖VIP连接高可用的MySQL
+// 地址格式: host1:port1,host2:port2
+type Endpoints struct {
+	addr   string
+	addrs  []string
+	policy string
+	next   sync2.AtomicInt64
+
+	resolveLock  sync.RWMutex
+	resolved     map[string][]string // 域名地址最近一次解析出的ip地址, 未解析时直接连接配置的地址
+	nextIP       sync2.AtomicInt64
+	drainRemoved bool // 是否关闭连接到已不在解析结果中的ip地址的连接
+}
+
+// lookupIPAddr 解析域名, 测试时替换
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// ParseEndpoints parse comma separated addresses, policy is failover if empty
+func ParseEndpoints(addr, policy string) (*Endpoints, error) {
+	if policy == "" {
+		policy = EndpointPolicyFailover
+	}
+	if !IsValidEndpointPolicy(policy) {
+		return nil, fmt.Errorf("invalid endpoint policy: %s", policy)
+	}
+
+	var addrs []string
+	for _, a := range strings.Split(addr, endpointSplit) {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			return nil, fmt.Errorf("invalid endpoints: %s", addr)
+		}
+		addrs = append(addrs, a)
+	}
+	return &Endpoints{addr: addr, addrs: addrs, policy: policy}, nil
+}
+
+// IsValidEndpointPolicy check if policy is supported
+func IsValidEndpointPolicy(policy string) bool {
+	switch policy {
+	case EndpointPolicyFailover, EndpointPolicyRoundRobin, EndpointPolicyRandom:
+		return true
+	default:
+		return false
+	}
+}
+
+// String return addresses in config
+func (e *Endpoints) String() string {
+	return e.addr
+}
+
+// candidates 返回本次新建连接依次尝试的地址
+func (e *Endpoints) candidates() []string {
+	if len(e.addrs) == 1 || e.policy == EndpointPolicyFailover {
+		return e.addrs
+	}
+
+	var start int
+	if e.policy == EndpointPolicyRoundRobin {
+		start = int((e.next.Add(1) - 1) % int64(len(e.addrs)))
+	} else {
+		start = rand.Intn(len(e.addrs))
+	}
+	ret := make([]string, 0, len(e.addrs))
+	ret = append(ret, e.addrs[start:]...)
+	return append(ret, e.addrs[:start]...)
+}
+
+// dialAddrs 返回连接配置地址addr时依次尝试的地址, 域名地址解析过时为轮询顺序的ip地址
+func (e *Endpoints) dialAddrs(addr string) []string {
+	e.resolveLock.RLock()
+	ips := e.resolved[addr]
+	e.resolveLock.RUnlock()
+	if len(ips) == 0 {
+		return []string{addr}
+	}
+	if len(ips) == 1 {
+		return ips
+	}
+	start := int((e.nextIP.Add(1) - 1) % int64(len(ips)))
+	ret := make([]string, 0, len(ips))
+	ret = append(ret, ips[start:]...)
+	return append(ret, ips[:start]...)
+}
+
+// resolve 重新解析域名地址, 返回解析结果是否变化, 解析失败的地址保留上次的结果
+func (e *Endpoints) resolve(ctx context.Context) (bool, error) {
+	var changed bool
+	var lastErr error
+	for _, addr := range e.addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			continue // unix socket或ip地址
+		}
+		ipAddrs, err := lookupIPAddr(ctx, host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(ipAddrs) == 0 {
+			lastErr = fmt.Errorf("no ip address of host: %s", host)
+			continue
+		}
+		ips := make([]string, 0, len(ipAddrs))
+		for _, ip := range ipAddrs {
+			ips = append(ips, net.JoinHostPort(ip.IP.String(), port))
+		}
+		sort.Strings(ips)
+
+		e.resolveLock.Lock()
+		if !reflect.DeepEqual(e.resolved[addr], ips) {
+			if e.resolved == nil {
+				e.resolved = make(map[string][]string, len(e.addrs))
+			}
+			e.resolved[addr] = ips
+			changed = true
+		}
+		e.resolveLock.Unlock()
+	}
+	return changed, lastErr
+}
+
+// isRemoved 检查连接到remoteAddr的连接是否需要关闭, 只有开启drainRemoved且ip已不在addr的解析结果中时返回true
+func (e *Endpoints) isRemoved(addr, remoteAddr string) bool {
+	if !e.drainRemoved {
+		return false
+	}
+	e.resolveLock.RLock()
+	defer e.resolveLock.RUnlock()
+	ips, ok := e.resolved[addr]
+	if !ok {
+		return false
+	}
+	for _, ip := range ips {
+		if ip == remoteAddr {
+			return false
+		}
+	}
+	return true
+}
+
+// resolvedAddrs 返回各域名地址最近一次解析出的ip地址
+func (e *Endpoints) resolvedAddrs() map[string][]string {
+	e.resolveLock.RLock()
+	defer e.resolveLock.RUnlock()
+	ret := make(map[string][]string, len(e.resolved))
+	for addr, ips := range e.resolved {
+		ret[addr] = ips
+	}
+	return ret
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	if _, err := ParseEndpoints("127.0.0.1:3306,", ""); err == nil {
+		t.Errorf("expect error for empty endpoint")
+	}
+	if _, err := ParseEndpoints("127.0.0.1:3306", "unknown"); err == nil {
+		t.Errorf("expect error for invalid policy")
+	}
+
+	e, err := ParseEndpoints("127.0.0.1:3306, 127.0.0.2:3306,127.0.0.3:3306", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"127.0.0.1:3306", "127.0.0.2:3306", "127.0.0.3:3306"}
+	for i := 0; i < 3; i++ {
+		if c := e.candidates(); !reflect.DeepEqual(c, expect) {
+			t.Errorf("failover candidates not equal, expect: %v, actual: %v", expect, c)
+		}
+	}
+}
+
+func TestEndpointsRoundRobin(t *testing.T) {
+	e, err := ParseEndpoints("a:1,b:1,c:1", EndpointPolicyRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := [][]string{
+		{"a:1", "b:1", "c:1"},
+		{"b:1", "c:1", "a:1"},
+		{"c:1", "a:1", "b:1"},
+		{"a:1", "b:1", "c:1"},
+	}
+	for _, expect := range expects {
+		if c := e.candidates(); !reflect.DeepEqual(c, expect) {
+			t.Errorf("round robin candidates not equal, expect: %v, actual: %v", expect, c)
+		}
+	}
+}
+
+// mockLookupIPAddr 将域名解析替换为hosts中的结果, 返回恢复函数
+func mockLookupIPAddr(hosts map[string][]string) func() {
+	origin := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := hosts[host]
+		if !ok {
+			return nil, fmt.Errorf("no such host: %s", host)
+		}
+		var ret []net.IPAddr
+		for _, ip := range ips {
+			ret = append(ret, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return ret, nil
+	}
+	return func() { lookupIPAddr = origin }
+}
+
+func TestEndpointsResolve(t *testing.T) {
+	hosts := map[string][]string{"db": {"10.0.0.2", "10.0.0.1"}}
+	defer mockLookupIPAddr(hosts)()
+
+	e, err := ParseEndpoints("db:3306,10.0.0.9:3306,unknown:3306", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.drainRemoved = true
+	if d := e.dialAddrs("db:3306"); !reflect.DeepEqual(d, []string{"db:3306"}) {
+		t.Errorf("dial addrs before resolve not equal, actual: %v", d)
+	}
+
+	changed, err := e.resolve(context.Background())
+	if !changed || err == nil {
+		t.Errorf("expect changed and error of unknown host, changed: %v, err: %v", changed, err)
+	}
+	expects := [][]string{
+		{"10.0.0.1:3306", "10.0.0.2:3306"},
+		{"10.0.0.2:3306", "10.0.0.1:3306"},
+	}
+	for _, expect := range expects {
+		if d := e.dialAddrs("db:3306"); !reflect.DeepEqual(d, expect) {
+			t.Errorf("dial addrs not equal, expect: %v, actual: %v", expect, d)
+		}
+	}
+	if d := e.dialAddrs("10.0.0.9:3306"); !reflect.DeepEqual(d, []string{"10.0.0.9:3306"}) {
+		t.Errorf("ip address should not be resolved, actual: %v", d)
+	}
+	if changed, _ := e.resolve(context.Background()); changed {
+		t.Errorf("expect not changed")
+	}
+
+	hosts["db"] = []string{"10.0.0.3", "10.0.0.2"}
+	if changed, _ := e.resolve(context.Background()); !changed {
+		t.Errorf("expect changed")
+	}
+	if !e.isRemoved("db:3306", "10.0.0.1:3306") {
+		t.Errorf("10.0.0.1 should be removed")
+	}
+	if e.isRemoved("db:3306", "10.0.0.2:3306") || e.isRemoved("10.0.0.9:3306", "10.0.0.9:3306") {
+		t.Errorf("address should not be removed")
+	}
+	e.drainRemoved = false
+	if e.isRemoved("db:3306", "10.0.0.1:3306") {
+		t.Errorf("should not drain if drainRemoved is not set")
+	}
+}
+
+func TestConnectionPoolDrainRemoved(t *testing.T) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	_, port, _ := net.SplitHostPort(s.Addr())
+
+	hosts := map[string][]string{"db": {"127.0.0.1"}}
+	defer mockLookupIPAddr(hosts)()
+
+	addr := net.JoinHostPort("db", port)
+	e, err := ParseEndpoints(addr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.drainRemoved = true
+	if _, err := e.resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cp := NewConnectionPool(e, "root", "root", "", 2, 2, time.Minute, mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions()})
+	cp.Open()
+	defer cp.Close()
+
+	pc, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.GetAddr() != addr {
+		t.Errorf("addr of connection should be configured addr, actual: %s", pc.GetAddr())
+	}
+	pc.Recycle()
+	if pc.IsClosed() {
+		t.Fatal("connection should be reused")
+	}
+
+	// ip从解析结果中移除后, 归还的连接被关闭
+	pc, err = cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts["db"] = []string{"127.0.0.2"}
+	if _, err := e.resolve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	pc.Recycle()
+	if !pc.IsClosed() {
+		t.Error("connection to removed ip should be closed")
+	}
+}
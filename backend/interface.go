@@ -11,9 +11,12 @@ type PooledConnect interface {
 	Recycle()
 	Reconnect() error
 	Close()
+	Abort()
+	KillQuery() error
 	IsClosed() bool
 	UseDB(db string) error
 	Execute(sql string) (*mysql.Result, error)
+	ExecuteWithTimeouts(sql string, timeouts Timeouts) (*mysql.Result, error)
 	SetAutoCommit(v uint8) error
 	Begin() error
 	Commit() error
@@ -44,4 +47,5 @@ type ConnectionPool interface {
 	WaitTime() time.Duration
 	IdleTimeout() time.Duration
 	IdleClosed() int64
+	BackendInfo() *BackendInfo
 }
@@ -59,6 +59,22 @@ func (_m *ConnectionPool) Available() int64 {
 	return r0
 }
 
+// BackendInfo provides a mock function with given fields:
+func (_m *ConnectionPool) BackendInfo() *backend.BackendInfo {
+	ret := _m.Called()
+
+	var r0 *backend.BackendInfo
+	if rf, ok := ret.Get(0).(func() *backend.BackendInfo); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*backend.BackendInfo)
+		}
+	}
+
+	return r0
+}
+
 // Capacity provides a mock function with given fields:
 func (_m *ConnectionPool) Capacity() int64 {
 	ret := _m.Called()
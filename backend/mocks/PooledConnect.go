@@ -3,6 +3,7 @@
 package mocks
 
 import (
+	backend "github.com/XiaoMi/Gaea/backend"
 	mysql "github.com/XiaoMi/Gaea/mysql"
 	mock "github.com/stretchr/testify/mock"
 )
@@ -12,6 +13,11 @@ type PooledConnect struct {
 	mock.Mock
 }
 
+// Abort provides a mock function with given fields:
+func (_m *PooledConnect) Abort() {
+	_m.Called()
+}
+
 // Begin provides a mock function with given fields:
 func (_m *PooledConnect) Begin() error {
 	ret := _m.Called()
@@ -68,6 +74,29 @@ func (_m *PooledConnect) Execute(sql string) (*mysql.Result, error) {
 	return r0, r1
 }
 
+// ExecuteWithTimeouts provides a mock function with given fields: sql, timeouts
+func (_m *PooledConnect) ExecuteWithTimeouts(sql string, timeouts backend.Timeouts) (*mysql.Result, error) {
+	ret := _m.Called(sql, timeouts)
+
+	var r0 *mysql.Result
+	if rf, ok := ret.Get(0).(func(string, backend.Timeouts) *mysql.Result); ok {
+		r0 = rf(sql, timeouts)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mysql.Result)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, backend.Timeouts) error); ok {
+		r1 = rf(sql, timeouts)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FieldList provides a mock function with given fields: table, wildcard
 func (_m *PooledConnect) FieldList(table string, wildcard string) ([]*mysql.Field, error) {
 	ret := _m.Called(table, wildcard)
@@ -119,6 +148,20 @@ func (_m *PooledConnect) IsClosed() bool {
 	return r0
 }
 
+// KillQuery provides a mock function with given fields:
+func (_m *PooledConnect) KillQuery() error {
+	ret := _m.Called()
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Reconnect provides a mock function with given fields:
 func (_m *PooledConnect) Reconnect() error {
 	ret := _m.Called()
@@ -37,7 +37,7 @@ func (pc *pooledConnectImpl) Recycle() {
 // If we get "MySQL server has gone away (errno 2006)", then call Reconnect
 func (pc *pooledConnectImpl) Reconnect() error {
 	pc.directConnection.Close()
-	newConn, err := NewDirectConnection(pc.pool.addr, pc.pool.user, pc.pool.password, pc.pool.db, pc.pool.charset, pc.pool.collationID)
+	newConn, err := newDirectConnection(pc.pool.endpoints, pc.pool.user, pc.pool.password, pc.pool.db, pc.pool.charset, pc.pool.collationID, pc.pool.opts)
 	if err != nil {
 		return err
 	}
@@ -50,6 +50,19 @@ func (pc *pooledConnectImpl) Close() {
 	pc.directConnection.Close()
 }
 
+// Abort interrupts the executing statement, see DirectConnection.Abort
+func (pc *pooledConnectImpl) Abort() {
+	pc.directConnection.Abort()
+}
+
+// KillQuery interrupts the executing statement, see DirectConnection.KillQuery
+func (pc *pooledConnectImpl) KillQuery() error {
+	if pc.directConnection == nil {
+		return nil
+	}
+	return pc.directConnection.KillQuery()
+}
+
 // IsClosed check if pooled connection closed
 func (pc *pooledConnectImpl) IsClosed() bool {
 	if pc.directConnection == nil {
@@ -68,6 +81,11 @@ func (pc *pooledConnectImpl) Execute(sql string) (*mysql.Result, error) {
 	return pc.directConnection.Execute(sql)
 }
 
+// ExecuteWithTimeouts wrapper of direct connection, execute sql with timeouts of this call
+func (pc *pooledConnectImpl) ExecuteWithTimeouts(sql string, timeouts Timeouts) (*mysql.Result, error) {
+	return pc.directConnection.ExecuteWithTimeouts(sql, timeouts)
+}
+
 // SetAutoCommit wrapper of direct connection, set autocommit
 func (pc *pooledConnectImpl) SetAutoCommit(v uint8) error {
 	return pc.directConnection.SetAutoCommit(v)
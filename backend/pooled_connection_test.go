@@ -0,0 +1,100 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// waitQuery 等待mock server收到query
+func waitQuery(s *mockserver.Server, query string) error {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, q := range s.Queries() {
+			if q == query {
+				return nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("query not received by mock server: %s", query)
+}
+
+func TestPooledConnectKillQuery(t *testing.T) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Expect("select sleep").WillReturnRows([]string{"sleep(10)"}, [][]interface{}{{0}}).WillDelay(10 * time.Second)
+	s.Expect("select 1").WillReturnRows([]string{"1"}, [][]interface{}{{1}})
+
+	e, err := ParseEndpoints(s.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 连接池只有一个连接, KILL QUERY不能从连接池获取连接
+	cp := NewConnectionPool(e, "root", "root", "", 1, 1, time.Minute, mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions()})
+	cp.Open()
+	defer cp.Close()
+
+	pc, err := cp.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	killErr := make(chan error, 1)
+	go func() {
+		if err := waitQuery(s, "select sleep(10)"); err != nil {
+			killErr <- err
+			return
+		}
+		// 等待语句开始执行后再终止
+		time.Sleep(50 * time.Millisecond)
+		killErr <- pc.KillQuery()
+	}()
+
+	startTime := time.Now()
+	_, err = pc.Execute("select sleep(10)")
+	if e, ok := err.(*mysql.SQLError); !ok || e.SQLCode() != mysql.ErrQueryInterrupted {
+		t.Fatalf("expect query interrupted, got: %v", err)
+	}
+	if time.Since(startTime) > 5*time.Second {
+		t.Errorf("query should be killed before finished")
+	}
+	if err := <-killErr; err != nil {
+		t.Fatalf("kill query failed: %v", err)
+	}
+
+	kill := fmt.Sprintf("KILL QUERY %d", pc.(*pooledConnectImpl).directConnection.GetConnectionID())
+	if err := waitQuery(s, kill); err != nil {
+		t.Fatal(err)
+	}
+
+	// 语句被终止后连接仍然可用
+	if pc.IsClosed() {
+		t.Fatal("connection should not be closed by kill query")
+	}
+	if _, err := pc.Execute("select 1"); err != nil {
+		t.Errorf("connection should be usable after kill query, err: %v", err)
+	}
+	pc.Recycle()
+}
@@ -30,10 +30,15 @@ package backend
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/XiaoMi/Gaea/logging"
+	"io/ioutil"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/models"
@@ -67,6 +72,16 @@ type Slice struct {
 
 	charset     string
 	collationID mysql.CollationID
+
+	initSQLs []string // 新建后端连接后依次执行的语句
+
+	tlsConfig *tls.Config
+	dialer    Dialer // nil means dial backend directly
+
+	topologyStop    chan struct{} // 关闭后停止拓扑刷新
+	topologyTrigger chan struct{} // 立即刷新拓扑
+
+	dnsStop chan struct{} // 关闭后停止重新解析域名
 }
 
 // GetSliceName return name of slice
@@ -101,8 +116,15 @@ func (s *Slice) GetConn(fromSlave bool, userType int) (pc PooledConnect, err err
 
 // GetMasterConn return a connection in master pool
 func (s *Slice) GetMasterConn() (PooledConnect, error) {
+	s.RLock()
+	master := s.Master
+	s.RUnlock()
 	ctx := context.TODO()
-	return s.Master.Get(ctx)
+	pc, err := master.Get(ctx)
+	if err != nil {
+		s.triggerTopologyRefresh()
+	}
+	return pc, err
 }
 
 // GetSlaveConn return a connection in slave pool
@@ -131,6 +153,15 @@ func (s *Slice) GetStatisticSlaveConn() (PooledConnect, error) {
 
 // Close close the pool in slice
 func (s *Slice) Close() error {
+	if s.topologyStop != nil {
+		close(s.topologyStop)
+		s.topologyStop = nil
+	}
+	if s.dnsStop != nil {
+		close(s.dnsStop)
+		s.dnsStop = nil
+	}
+
 	s.Lock()
 	defer s.Unlock()
 	// close master
@@ -149,22 +180,58 @@ func (s *Slice) Close() error {
 	return nil
 }
 
+// compression 后端连接请求的压缩协议, 未开启compress时不压缩, 未指定compression_algorithm时使用zlib
+func (s *Slice) compression() mysql.CompressionAlgorithm {
+	if !s.Cfg.Compress {
+		return mysql.CompressionNone
+	}
+	if s.Cfg.CompressionAlgorithm == "" {
+		return mysql.CompressionZlib
+	}
+	algorithm, _ := mysql.ParseCompressionAlgorithm(s.Cfg.CompressionAlgorithm)
+	return algorithm
+}
+
 // ParseMaster create master connection pool
 func (s *Slice) ParseMaster(masterStr string) error {
 	if len(masterStr) == 0 {
 		return errors.ErrNoMasterDB
 	}
-	idleTimeout, err := util.Int2TimeDuration(s.Cfg.IdleTimeout)
+	cp, err := s.newConnectionPool(masterStr)
 	if err != nil {
 		return err
 	}
-	s.Master = NewConnectionPool(masterStr, s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID)
-	s.Master.Open()
+	s.Master = cp
 	return nil
 }
 
+// newConnectionPool create and open connection pool, addr can be comma separated endpoints
+func (s *Slice) newConnectionPool(addr string) (ConnectionPool, error) {
+	endpoints, err := ParseEndpoints(addr, s.Cfg.EndpointPolicy)
+	if err != nil {
+		return nil, err
+	}
+	endpoints.drainRemoved = s.Cfg.DNSDrainRemoved
+	idleTimeout, err := util.Int2TimeDuration(s.Cfg.IdleTimeout)
+	if err != nil {
+		return nil, err
+	}
+	opts := DialOptions{
+		TLSConfig:   s.tlsConfig,
+		TCPOptions:  s.TCPOptions(),
+		InitSQLs:    s.initSQLs,
+		Dialer:      s.dialer,
+		Compression: s.compression(),
+		Timeouts:    s.Timeouts(),
+	}
+	cp := NewConnectionPool(endpoints, s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID, opts)
+	cp.Open()
+	go probeBackend(cp)
+	return cp, nil
+}
+
 // ParseSlave create connection pool of slaves
-// (127.0.0.1:3306@2,192.168.0.12:3306@3)
+// (127.0.0.1:3306@2,192.168.0.12:3306@3), 一个从库有多个地址时使用逗号分隔, 如192.168.0.13:3306,192.168.0.14:3306@2
 func (s *Slice) ParseSlave(slaves []string) error {
 	if len(slaves) == 0 {
 		return nil
@@ -189,12 +256,10 @@ func (s *Slice) ParseSlave(slaves []string) error {
 			weight = 1
 		}
 		s.SlaveWeights = append(s.SlaveWeights, weight)
-		idleTimeout, err := util.Int2TimeDuration(s.Cfg.IdleTimeout)
+		cp, err := s.newConnectionPool(addrAndWeight[0])
 		if err != nil {
 			return err
 		}
-		cp := NewConnectionPool(addrAndWeight[0], s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID)
-		cp.Open()
 		s.Slave = append(s.Slave, cp)
 	}
 	s.initBalancer()
@@ -227,20 +292,91 @@ func (s *Slice) ParseStatisticSlave(statisticSlaves []string) error {
 			weight = 1
 		}
 		s.StatisticSlaveWeights = append(s.StatisticSlaveWeights, weight)
-		idleTimeout, err := util.Int2TimeDuration(s.Cfg.IdleTimeout)
+		cp, err := s.newConnectionPool(addrAndWeight[0])
 		if err != nil {
 			return err
 		}
-		cp := NewConnectionPool(addrAndWeight[0], s.Cfg.UserName, s.Cfg.Password, "", s.Cfg.Capacity, s.Cfg.MaxCapacity, idleTimeout, s.charset, s.collationID)
-		cp.Open()
 		s.StatisticSlave = append(s.StatisticSlave, cp)
 	}
 	s.initStatisticSlaveBalancer()
 	return nil
 }
 
+// ParseTLSConfig create tls config used by connections to backend
+func (s *Slice) ParseTLSConfig() error {
+	if !s.Cfg.TLSEnabled {
+		s.tlsConfig = nil
+		return nil
+	}
+	cfg := &tls.Config{
+		ServerName:         s.Cfg.TLSServerName,
+		InsecureSkipVerify: s.Cfg.TLSSkipVerify,
+	}
+	if s.Cfg.TLSCA != "" {
+		pem, err := ioutil.ReadFile(s.Cfg.TLSCA)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate in tls ca: %s", s.Cfg.TLSCA)
+		}
+		cfg.RootCAs = pool
+	}
+	s.tlsConfig = cfg
+	return nil
+}
+
+// ParseDialer create dialer of connections to backend, dial backend directly if not configured
+func (s *Slice) ParseDialer() error {
+	if s.Cfg.Dialer == "" {
+		s.dialer = nil
+		return nil
+	}
+	d, err := NewDialer(s.Cfg.Dialer)
+	if err != nil {
+		return err
+	}
+	s.dialer = d
+	return nil
+}
+
+// TCPOptions return tcp options of connections to backend
+func (s *Slice) TCPOptions() util.TCPOptions {
+	opts := util.DefaultTCPOptions()
+	if s.Cfg.TCPKeepAlivePeriod < 0 {
+		opts.KeepAlivePeriod = -1
+	} else {
+		opts.KeepAlivePeriod = time.Duration(s.Cfg.TCPKeepAlivePeriod) * time.Second
+	}
+	if s.Cfg.TCPNoDelay != nil {
+		opts.NoDelay = *s.Cfg.TCPNoDelay
+	}
+	opts.ReadBufferSize = s.Cfg.TCPReadBufferSize
+	opts.WriteBufferSize = s.Cfg.TCPWriteBufferSize
+	return opts
+}
+
+// Timeouts return timeouts of backend calls of slice
+func (s *Slice) Timeouts() Timeouts {
+	timeouts := Timeouts{
+		Connect:   time.Duration(s.Cfg.ConnectTimeout) * time.Millisecond,
+		FirstByte: time.Duration(s.Cfg.FirstByteTimeout) * time.Millisecond,
+		Total:     time.Duration(s.Cfg.TotalTimeout) * time.Millisecond,
+	}
+	if timeouts.Connect == 0 {
+		timeouts.Connect = DefaultConnectTimeout
+	}
+	return timeouts
+}
+
 // SetCharsetInfo set charset
 func (s *Slice) SetCharsetInfo(charset string, collationID mysql.CollationID) {
 	s.charset = charset
 	s.collationID = collationID
 }
+
+// SetInitSQLs set statements executed on every new backend connection, should be called before pools created
+func (s *Slice) SetInitSQLs(sqls []string) {
+	s.initSQLs = sqls
+}
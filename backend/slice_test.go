@@ -0,0 +1,42 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestSliceTCPOptions(t *testing.T) {
+	s := &Slice{Cfg: models.Slice{}}
+	if opts := s.TCPOptions(); opts != util.DefaultTCPOptions() {
+		t.Errorf("default tcp options not match: %+v", opts)
+	}
+
+	noDelay := false
+	s.Cfg = models.Slice{TCPKeepAlivePeriod: 30, TCPNoDelay: &noDelay, TCPReadBufferSize: 4096, TCPWriteBufferSize: 8192}
+	expect := util.TCPOptions{KeepAlivePeriod: 30 * time.Second, NoDelay: false, ReadBufferSize: 4096, WriteBufferSize: 8192}
+	if opts := s.TCPOptions(); opts != expect {
+		t.Errorf("tcp options not match, expect: %+v, actual: %+v", expect, opts)
+	}
+
+	s.Cfg = models.Slice{TCPKeepAlivePeriod: -1}
+	if opts := s.TCPOptions(); opts.KeepAlivePeriod >= 0 {
+		t.Errorf("keepalive should be disabled: %+v", opts)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// DefaultConnectTimeout 建立后端连接(包括握手和认证)的默认超时时间
+const DefaultConnectTimeout = 5 * time.Second
+
+// killQueryTimeout 终止语句时建立新连接和执行KILL QUERY的超时时间
+const killQueryTimeout = 2 * time.Second
+
+// Timeouts timeouts of backend calls, zero means no limit
+type Timeouts struct {
+	Connect   time.Duration // 建立连接的超时时间, 包括握手、认证和初始化语句
+	FirstByte time.Duration // 发送语句后收到第一个响应包的超时时间, 即后端的执行时间
+	Total     time.Duration // 发送语句到读完结果的总超时时间, 包括结果集传输
+}
+
+// TimeoutPhase phase of backend call where timeout occurs
+type TimeoutPhase string
+
+// timeout phases
+const (
+	TimeoutPhaseConnect   TimeoutPhase = "connect"
+	TimeoutPhaseFirstByte TimeoutPhase = "first_byte"
+	TimeoutPhaseTotal     TimeoutPhase = "total"
+)
+
+// TimeoutError is returned when backend call exceeds one of Timeouts,
+// the connection is closed since the protocol state is unknown
+type TimeoutError struct {
+	Phase TimeoutPhase
+	Addr  string
+	Limit time.Duration // 超出的超时时间
+	Err   error         // 连接超时为网络错误, 执行超时为ER_QUERY_INTERRUPTED, 返回给客户端
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("backend %s timeout after %v, addr: %s, err: %v", e.Phase, e.Limit, e.Addr, e.Err)
+}
+
+// Unwrap return the underlying error
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout always return true, same as timeout of net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// GetTimeoutError return TimeoutError in err chain, used to categorize backend failures
+func GetTimeoutError(err error) (*TimeoutError, bool) {
+	var e *TimeoutError
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
+func isNetTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func newExecuteTimeoutError(phase TimeoutPhase, addr string, timeout time.Duration) *TimeoutError {
+	return &TimeoutError{
+		Phase: phase,
+		Addr:  addr,
+		Limit: timeout,
+		Err: mysql.NewError(mysql.ErrQueryInterrupted,
+			fmt.Sprintf("Query execution was interrupted, backend %s timeout %v exceeded", phase, timeout)),
+	}
+}
+
+// connectError convert net timeout while connecting to TimeoutError
+func (dc *DirectConnection) connectError(err error) error {
+	if dc.timeouts.Connect <= 0 || !isNetTimeout(err) {
+		return err
+	}
+	return &TimeoutError{Phase: TimeoutPhaseConnect, Addr: dc.addr, Limit: dc.timeouts.Connect, Err: err}
+}
+
+// callDeadline 单次调用的超时控制, 发送语句前设置读写截止时间, 收到第一个响应包后将读截止时间放宽到总截止时间
+type callDeadline struct {
+	dc        *DirectConnection
+	timeouts  Timeouts
+	start     time.Time
+	total     time.Time // 总截止时间, 为零表示不限制
+	firstByte bool      // 是否已收到第一个响应包
+}
+
+// startCall set deadlines before sending statement, return nil if no timeout is configured
+func (dc *DirectConnection) startCall(timeouts Timeouts) *callDeadline {
+	if timeouts.FirstByte <= 0 && timeouts.Total <= 0 {
+		return nil
+	}
+	if dc.conn == nil {
+		return nil
+	}
+	d := &callDeadline{dc: dc, timeouts: timeouts, start: time.Now()}
+	if timeouts.Total > 0 {
+		d.total = d.start.Add(timeouts.Total)
+	}
+	netConn := dc.conn.NetConn()
+	netConn.SetWriteDeadline(d.total)
+	readDeadline := d.total
+	if timeouts.FirstByte > 0 {
+		if fb := d.start.Add(timeouts.FirstByte); readDeadline.IsZero() || fb.Before(readDeadline) {
+			readDeadline = fb
+		}
+	}
+	netConn.SetReadDeadline(readDeadline)
+	return d
+}
+
+// received 收到第一个响应包后调用
+func (d *callDeadline) received() {
+	if d == nil || d.firstByte {
+		return
+	}
+	d.firstByte = true
+	if d.timeouts.FirstByte > 0 {
+		d.dc.conn.NetConn().SetReadDeadline(d.total)
+	}
+}
+
+// finish 清除截止时间, 超时错误转换为TimeoutError并关闭连接
+func (d *callDeadline) finish(err error) error {
+	if d == nil {
+		return err
+	}
+	if err == nil || !isNetTimeout(err) {
+		if conn := d.dc.conn; conn != nil {
+			conn.NetConn().SetDeadline(time.Time{})
+		}
+		return err
+	}
+
+	// 已收到第一个响应包或已到总截止时间时为总超时, 否则为等待第一个响应包超时
+	phase, timeout := TimeoutPhaseFirstByte, d.timeouts.FirstByte
+	if !d.total.IsZero() && (d.firstByte || !time.Now().Before(d.total)) {
+		phase, timeout = TimeoutPhaseTotal, d.timeouts.Total
+	}
+	// 协议状态未知, 连接不能再使用, 回收时由连接池丢弃
+	d.dc.Abort()
+	return newExecuteTimeoutError(phase, d.dc.addr, timeout)
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+// newPipeConnection return connection whose backend reads one query and replies with packets
+func newPipeConnection(t *testing.T, replies ...[]byte) *DirectConnection {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	go func() {
+		c := mysql.NewConn(server)
+		if _, err := c.ReadPacket(); err != nil {
+			return
+		}
+		for _, data := range replies {
+			if err := c.WritePacket(data); err != nil {
+				return
+			}
+		}
+	}()
+	return &DirectConnection{
+		conn:             mysql.NewConn(client),
+		addr:             "127.0.0.1:3306",
+		closed:           sync2.NewAtomicBool(false),
+		sessionVariables: mysql.NewSessionVariables(),
+	}
+}
+
+func TestExecuteWithTimeouts(t *testing.T) {
+	okPacket := []byte{mysql.OKHeader, 1, 0, 0, 0}
+	tests := []struct {
+		name     string
+		replies  [][]byte
+		timeouts Timeouts
+		phase    TimeoutPhase
+	}{
+		{name: "no timeout", replies: [][]byte{okPacket}, timeouts: Timeouts{FirstByte: time.Second, Total: time.Second}},
+		{name: "first byte", timeouts: Timeouts{FirstByte: 50 * time.Millisecond, Total: time.Second}, phase: TimeoutPhaseFirstByte},
+		{name: "total without first byte", timeouts: Timeouts{Total: 50 * time.Millisecond}, phase: TimeoutPhaseTotal},
+		// 收到列数后等待列定义超时
+		{name: "total", replies: [][]byte{{1}}, timeouts: Timeouts{FirstByte: time.Second, Total: 100 * time.Millisecond}, phase: TimeoutPhaseTotal},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dc := newPipeConnection(t, test.replies...)
+			r, err := dc.ExecuteWithTimeouts("select 1", test.timeouts)
+			if test.phase == "" {
+				if err != nil || r.AffectedRows != 1 {
+					t.Fatalf("execute failed, result: %v, err: %v", r, err)
+				}
+				if dc.IsClosed() {
+					t.Error("connection should not be closed")
+				}
+				return
+			}
+
+			te, ok := GetTimeoutError(err)
+			if !ok {
+				t.Fatalf("expect timeout error, actual: %v", err)
+			}
+			if te.Phase != test.phase {
+				t.Errorf("timeout phase not match, expect: %s, actual: %s", test.phase, te.Phase)
+			}
+			var sqlErr *mysql.SQLError
+			if !errors.As(err, &sqlErr) || sqlErr.SQLCode() != mysql.ErrQueryInterrupted {
+				t.Errorf("expect ER_QUERY_INTERRUPTED, actual: %v", err)
+			}
+			if !dc.IsClosed() {
+				t.Error("connection should be closed after timeout")
+			}
+		})
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// 后端接受连接但不发送握手包
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+
+	endpoints, _ := ParseEndpoints(l.Addr().String(), EndpointPolicyFailover)
+	start := time.Now()
+	_, err = newDirectConnection(endpoints, "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), DialOptions{TCPOptions: util.DefaultTCPOptions(), Timeouts: Timeouts{Connect: 100 * time.Millisecond}})
+	te, ok := GetTimeoutError(err)
+	if !ok || te.Phase != TimeoutPhaseConnect {
+		t.Fatalf("expect connect timeout, actual: %v", err)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("connect timeout not effective, cost: %v", cost)
+	}
+}
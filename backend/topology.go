@@ -0,0 +1,275 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+)
+
+const (
+	// TopologyGroupReplication discover primary and secondaries from MySQL Group Replication members
+	TopologyGroupReplication = "group_replication"
+
+	defaultTopologyRefreshInterval = time.Second
+	// 获取主库连接失败触发的刷新之间的最小间隔
+	minTopologyTriggerInterval = 200 * time.Millisecond
+
+	groupReplicationMembersSQL = "SELECT MEMBER_HOST, MEMBER_PORT, MEMBER_ROLE FROM performance_schema.replication_group_members WHERE MEMBER_STATE = 'ONLINE'"
+)
+
+// topologyMember is an online member of backend cluster
+type topologyMember struct {
+	addr    string
+	primary bool
+}
+
+// topologyDiscoverer query members of backend cluster through a connection of any member
+type topologyDiscoverer func(s *Slice, pc PooledConnect) ([]topologyMember, error)
+
+var topologyDiscoverers = map[string]topologyDiscoverer{
+	TopologyGroupReplication: discoverGroupReplication,
+	TopologyAurora:           discoverAurora,
+}
+
+// discoverGroupReplication 需要MySQL 8.0及以上版本(MEMBER_ROLE列), 不支持多主模式
+func discoverGroupReplication(s *Slice, pc PooledConnect) ([]topologyMember, error) {
+	r, err := pc.Execute(groupReplicationMembersSQL)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil {
+		return nil, errors.New("empty group replication members")
+	}
+	members := make([]topologyMember, 0, len(r.Values))
+	for i := range r.Values {
+		host, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		port, err := r.GetInt(i, 1)
+		if err != nil {
+			return nil, err
+		}
+		role, err := r.GetString(i, 2)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, topologyMember{
+			addr:    net.JoinHostPort(host, fmt.Sprintf("%d", port)),
+			primary: strings.EqualFold(role, "PRIMARY"),
+		})
+	}
+	return members, nil
+}
+
+// StartTopologyDiscovery refresh master and slaves from backend topology periodically, do nothing if topology is not set
+func (s *Slice) StartTopologyDiscovery() error {
+	if s.Cfg.Topology == "" {
+		return nil
+	}
+	discover, ok := topologyDiscoverers[s.Cfg.Topology]
+	if !ok {
+		return fmt.Errorf("unknown topology: %s", s.Cfg.Topology)
+	}
+
+	interval := defaultTopologyRefreshInterval
+	if s.Cfg.TopologyRefreshInterval > 0 {
+		interval = time.Duration(s.Cfg.TopologyRefreshInterval) * time.Second
+	}
+
+	// 首次发现失败时先使用配置中的地址, 由后台刷新修正
+	if err := s.refreshTopology(discover, interval); err != nil {
+		logging.DefaultLogger.Warnf("slice %s discover %s topology failed, err: %v", s.Cfg.Name, s.Cfg.Topology, err)
+	}
+
+	s.topologyStop = make(chan struct{})
+	s.topologyTrigger = make(chan struct{}, 1)
+	go s.topologyLoop(discover, interval, s.topologyStop, s.topologyTrigger)
+	return nil
+}
+
+// triggerTopologyRefresh 主库连接失败时可能发生了切换, 不等待刷新间隔立即刷新拓扑
+func (s *Slice) triggerTopologyRefresh() {
+	if s.topologyTrigger == nil {
+		return
+	}
+	select {
+	case s.topologyTrigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Slice) topologyLoop(discover topologyDiscoverer, interval time.Duration, stop, trigger chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-trigger:
+			if time.Since(last) < minTopologyTriggerInterval {
+				continue
+			}
+		}
+		last = time.Now()
+		if err := s.refreshTopology(discover, interval); err != nil {
+			logging.DefaultLogger.Warnf("slice %s refresh %s topology failed, err: %v", s.Cfg.Name, s.Cfg.Topology, err)
+		}
+	}
+}
+
+// refreshTopology query members through current master or slaves, and switch connection pools if topology changed
+func (s *Slice) refreshTopology(discover topologyDiscoverer, timeout time.Duration) error {
+	s.RLock()
+	pools := make([]ConnectionPool, 0, len(s.Slave)+1)
+	pools = append(pools, s.Master)
+	pools = append(pools, s.Slave...)
+	s.RUnlock()
+
+	var lastErr error
+	for _, cp := range pools {
+		members, err := s.queryTopology(cp, discover, timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return s.applyTopology(members)
+	}
+	return lastErr
+}
+
+func (s *Slice) queryTopology(cp ConnectionPool, discover topologyDiscoverer, timeout time.Duration) ([]topologyMember, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	pc, err := cp.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Recycle()
+	if info := cp.BackendInfo(); s.Cfg.Topology == TopologyGroupReplication && info != nil && !info.SupportsGroupReplicationRole() {
+		return nil, fmt.Errorf("group replication topology requires MySQL 8.0 or above, backend %s version: %s", cp.Addr(), info.Version)
+	}
+	return discover(s, pc)
+}
+
+// applyTopology 主库变化时切换master连接池, 从库按发现结果重建, 地址未变化的连接池复用
+func (s *Slice) applyTopology(members []topologyMember) error {
+	var primary string
+	secondaries := make([]string, 0, len(members))
+	for _, m := range members {
+		if !m.primary {
+			secondaries = append(secondaries, m.addr)
+			continue
+		}
+		if primary != "" {
+			return fmt.Errorf("multiple primary members: %s, %s", primary, m.addr)
+		}
+		primary = m.addr
+	}
+	if primary == "" {
+		return errors.New("no online primary member")
+	}
+	sort.Strings(secondaries)
+
+	s.RLock()
+	if s.Master.Addr() == primary && sameTopologyAddrs(s.Slave, secondaries) {
+		s.RUnlock()
+		return nil
+	}
+	old := make(map[string]ConnectionPool, len(s.Slave)+1)
+	old[s.Master.Addr()] = s.Master
+	for _, cp := range s.Slave {
+		old[cp.Addr()] = cp
+	}
+	s.RUnlock()
+
+	var created []ConnectionPool
+	getPool := func(addr string) (ConnectionPool, error) {
+		if cp, ok := old[addr]; ok {
+			delete(old, addr)
+			return cp, nil
+		}
+		cp, err := s.newConnectionPool(addr)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, cp)
+		return cp, nil
+	}
+	closePools := func(pools []ConnectionPool) {
+		for _, cp := range pools {
+			go cp.Close()
+		}
+	}
+
+	master, err := getPool(primary)
+	if err != nil {
+		return err
+	}
+	slaves := make([]ConnectionPool, 0, len(secondaries))
+	weights := make([]int, 0, len(secondaries))
+	for _, addr := range secondaries {
+		cp, err := getPool(addr)
+		if err != nil {
+			closePools(created)
+			return err
+		}
+		slaves = append(slaves, cp)
+		weights = append(weights, 1)
+	}
+
+	s.Lock()
+	s.Master = master
+	s.Slave = slaves
+	s.SlaveWeights = weights
+	if len(weights) == 0 {
+		s.RoundRobinQ = nil
+		s.LastSlaveIndex = 0
+	} else {
+		s.initBalancer()
+	}
+	s.Unlock()
+
+	// 被移除的连接池等待使用中的连接归还后关闭
+	removed := make([]ConnectionPool, 0, len(old))
+	for _, cp := range old {
+		removed = append(removed, cp)
+	}
+	closePools(removed)
+	logging.DefaultLogger.Infof("slice %s topology changed, master: %s, slaves: %v", s.Cfg.Name, primary, secondaries)
+	return nil
+}
+
+func sameTopologyAddrs(pools []ConnectionPool, addrs []string) bool {
+	if len(pools) != len(addrs) {
+		return false
+	}
+	for i, cp := range pools {
+		if cp.Addr() != addrs[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// TopologyAurora discover writer and readers from Aurora MySQL topology table
+	TopologyAurora = "aurora"
+
+	auroraWriterSessionID = "MASTER_SESSION_ID"
+	auroraDefaultPort     = "3306"
+
+	// 5分钟内未更新的reader可能已被删除或正在重启
+	auroraTopologySQL = "SELECT SERVER_ID, SESSION_ID FROM information_schema.replica_host_status " +
+		"WHERE TIME_TO_SEC(TIMEDIFF(NOW(), LAST_UPDATE_TIMESTAMP)) <= 300 OR SESSION_ID = 'MASTER_SESSION_ID'"
+)
+
+func discoverAurora(s *Slice, pc PooledConnect) ([]topologyMember, error) {
+	pattern, err := auroraHostPattern(s.Cfg.TopologyHostPattern, s.Cfg.Master)
+	if err != nil {
+		return nil, err
+	}
+	r, err := pc.Execute(auroraTopologySQL)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil {
+		return nil, fmt.Errorf("empty aurora topology")
+	}
+	members := make([]topologyMember, 0, len(r.Values))
+	for i := range r.Values {
+		serverID, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		sessionID, err := r.GetString(i, 1)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, topologyMember{
+			addr:    strings.Replace(pattern, "?", serverID, 1),
+			primary: sessionID == auroraWriterSessionID,
+		})
+	}
+	return members, nil
+}
+
+// auroraHostPattern return instance address pattern, ? is replaced by instance id (SERVER_ID).
+// 未配置时按Aurora的DNS约定从集群地址推导, 如 mycluster.cluster-xyz.us-east-1.rds.amazonaws.com:3306
+// 推导为 ?.xyz.us-east-1.rds.amazonaws.com:3306
+func auroraHostPattern(pattern, master string) (string, error) {
+	if pattern != "" {
+		if _, _, err := net.SplitHostPort(pattern); err != nil {
+			return net.JoinHostPort(pattern, auroraDefaultPort), nil
+		}
+		return pattern, nil
+	}
+
+	seed := strings.TrimSpace(strings.Split(master, ",")[0])
+	host, port, err := net.SplitHostPort(seed)
+	if err != nil {
+		return "", err
+	}
+	labels := strings.SplitN(host, ".", 3)
+	if len(labels) != 3 || !strings.HasSuffix(host, ".rds.amazonaws.com") {
+		return "", fmt.Errorf("can not derive topology host pattern from %s, please set topology_host_pattern", seed)
+	}
+	suffix := labels[1]
+	for _, prefix := range []string{"cluster-custom-", "cluster-ro-", "cluster-"} {
+		if strings.HasPrefix(suffix, prefix) {
+			suffix = strings.TrimPrefix(suffix, prefix)
+			break
+		}
+	}
+	return net.JoinHostPort("?."+suffix+"."+labels[2], port), nil
+}
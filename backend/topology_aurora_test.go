@@ -0,0 +1,75 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestAuroraHostPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		master  string
+		expect  string
+		err     bool
+	}{
+		{"?.xyz.us-east-1.rds.amazonaws.com:3307", "", "?.xyz.us-east-1.rds.amazonaws.com:3307", false},
+		{"?.xyz.us-east-1.rds.amazonaws.com", "", "?.xyz.us-east-1.rds.amazonaws.com:3306", false},
+		{"", "mycluster.cluster-xyz.us-east-1.rds.amazonaws.com:3306", "?.xyz.us-east-1.rds.amazonaws.com:3306", false},
+		{"", "mycluster.cluster-ro-xyz.us-east-1.rds.amazonaws.com:3306,10.0.0.1:3306", "?.xyz.us-east-1.rds.amazonaws.com:3306", false},
+		{"", "10.0.0.1:3306", "", true},
+	}
+	for _, test := range tests {
+		actual, err := auroraHostPattern(test.pattern, test.master)
+		if test.err {
+			if err == nil {
+				t.Errorf("expect error, pattern: %s, master: %s", test.pattern, test.master)
+			}
+			continue
+		}
+		if err != nil || actual != test.expect {
+			t.Errorf("host pattern not match, expect: %s, actual: %s, err: %v", test.expect, actual, err)
+		}
+	}
+}
+
+func TestSliceAuroraTopology(t *testing.T) {
+	s1, _, port1 := newTopologyTestServer(t)
+	defer s1.Close()
+	s2, _, port2 := newTopologyTestServer(t)
+	defer s2.Close()
+
+	// 使用端口作为实例ID, 地址模板为127.0.0.1:?
+	names := []string{"SERVER_ID", "SESSION_ID"}
+	rows := [][]interface{}{{port2, auroraWriterSessionID}, {port1, "4ae4c8c2-2b48-4b5c-a6a1-1b1f2e5b8c6d"}}
+	s1.Expect(`replica_host_status`).WillReturnRows(names, rows)
+
+	s := &Slice{Cfg: models.Slice{Name: "slice-0", UserName: "root", Password: "root", Capacity: 1, MaxCapacity: 2, Topology: TopologyAurora, TopologyHostPattern: "127.0.0.1:?"}}
+	s.SetCharsetInfo(mysql.CharsetUTF8, mysql.CollationID(33))
+	if err := s.ParseMaster(s1.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.refreshTopology(topologyDiscoverers[s.Cfg.Topology], defaultTopologyRefreshInterval); err != nil {
+		t.Fatal(err)
+	}
+	if s.Master.Addr() != s2.Addr() || len(s.Slave) != 1 || s.Slave[0].Addr() != s1.Addr() {
+		t.Fatalf("topology not match, master: %s, slaves: %d", s.Master.Addr(), len(s.Slave))
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/mysql/mockserver"
+)
+
+func newTopologyTestServer(t *testing.T) (*mockserver.Server, string, int64) {
+	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.ParseInt(port, 10, 64)
+	return s, host, p
+}
+
+func TestSliceGroupReplicationTopology(t *testing.T) {
+	s1, host1, port1 := newTopologyTestServer(t)
+	defer s1.Close()
+	s2, host2, port2 := newTopologyTestServer(t)
+	defer s2.Close()
+
+	names := []string{"MEMBER_HOST", "MEMBER_PORT", "MEMBER_ROLE"}
+	before := [][]interface{}{{host1, port1, "PRIMARY"}, {host2, port2, "SECONDARY"}}
+	after := [][]interface{}{{host1, port1, "SECONDARY"}, {host2, port2, "PRIMARY"}}
+	s1.Expect(`replication_group_members`).WillReturnRows(names, before).Times(1)
+	s1.Expect(`replication_group_members`).WillReturnRows(names, after)
+	s2.Expect(`replication_group_members`).WillReturnRows(names, after)
+
+	s := &Slice{Cfg: models.Slice{Name: "slice-0", UserName: "root", Password: "root", Capacity: 1, MaxCapacity: 2, Topology: TopologyGroupReplication}}
+	s.SetCharsetInfo(mysql.CharsetUTF8, mysql.CollationID(33))
+	if err := s.ParseMaster(s1.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	discover := topologyDiscoverers[s.Cfg.Topology]
+	if err := s.refreshTopology(discover, defaultTopologyRefreshInterval); err != nil {
+		t.Fatal(err)
+	}
+	if s.Master.Addr() != s1.Addr() || len(s.Slave) != 1 || s.Slave[0].Addr() != s2.Addr() {
+		t.Fatalf("topology not match, master: %s, slaves: %d", s.Master.Addr(), len(s.Slave))
+	}
+	pc, err := s.GetSlaveConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.GetAddr() != s2.Addr() {
+		t.Errorf("slave conn addr not equal, expect: %s, actual: %s", s2.Addr(), pc.GetAddr())
+	}
+	pc.Recycle()
+
+	// 主库切换后写请求路由到新主库, 原主库的连接池复用为从库
+	oldMaster := s.Master
+	if err := s.refreshTopology(discover, defaultTopologyRefreshInterval); err != nil {
+		t.Fatal(err)
+	}
+	if s.Master.Addr() != s2.Addr() || len(s.Slave) != 1 || s.Slave[0] != oldMaster {
+		t.Fatalf("topology not switched, master: %s, slaves: %d", s.Master.Addr(), len(s.Slave))
+	}
+	pc, err = s.GetMasterConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.GetAddr() != s2.Addr() {
+		t.Errorf("master conn addr not equal, expect: %s, actual: %s", s2.Addr(), pc.GetAddr())
+	}
+	pc.Recycle()
+}
+
+func TestSliceApplyTopologyError(t *testing.T) {
+	s := &Slice{}
+	if err := s.applyTopology([]topologyMember{{addr: "127.0.0.1:3306"}}); err == nil {
+		t.Error("expect error when no primary member")
+	}
+	members := []topologyMember{{addr: "127.0.0.1:3306", primary: true}, {addr: "127.0.0.1:3307", primary: true}}
+	if err := s.applyTopology(members); err == nil {
+		t.Error("expect error when multiple primary members")
+	}
+}
@@ -15,10 +15,12 @@
 package cc
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/XiaoMi/Gaea/cc/proxy"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-contrib/gzip"
@@ -26,14 +28,18 @@ import (
 
 	"github.com/XiaoMi/Gaea/cc/service"
 	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util/adminauth"
+	"github.com/XiaoMi/Gaea/util/requests"
 )
 
 // Server admin server
 type Server struct {
 	cfg *models.CCConfig
 
-	engine   *gin.Engine
-	listener net.Listener
+	auth         *adminauth.Authenticator
+	engine       *gin.Engine
+	listener     net.Listener
+	certReloader *adminauth.CertReloader // 开启https时热加载证书, 否则为nil
 
 	exitC chan struct{}
 }
@@ -49,29 +55,64 @@ func NewServer(addr string, cfg *models.CCConfig) (*Server, error) {
 	srv := &Server{cfg: cfg, exitC: make(chan struct{})}
 	srv.engine = gin.New()
 
+	auth, err := adminauth.NewAuthenticator(cfg.AdminUserName, cfg.AdminPassword, cfg.AdminTokens, cfg.AdminCertRoles)
+	if err != nil {
+		return nil, err
+	}
+	srv.auth = auth
+	srv.certReloader, err = adminauth.NewCertReloader(cfg.AdminTLSCert, cfg.AdminTLSKey, cfg.AdminTLSCA, func(err error) {
+		if err != nil {
+			proxy.ControllerLogger.Warnf("reload admin tls cert failed, keep using the previous cert, %v", err)
+			return
+		}
+		proxy.ControllerLogger.Infof("admin tls cert reloaded")
+	})
+	if err != nil {
+		return nil, err
+	}
+	// proxy管理接口开启https时, 使用https访问proxy
+	proxyTLSConfig, err := adminauth.NewClientTLSConfig(cfg.ProxyTLSCA, cfg.ProxyTLSCert, cfg.ProxyTLSKey)
+	if err != nil {
+		return nil, err
+	}
+	if proxyTLSConfig != nil {
+		requests.SetTLSConfig(proxyTLSConfig)
+	}
+
 	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
 	}
+	if srv.certReloader != nil {
+		l = tls.NewListener(l, srv.certReloader.TLSConfig())
+		srv.certReloader.Watch(adminauth.DefaultCertCheckInterval)
+	}
 	srv.listener = l
 	srv.registerURL()
 	return srv, nil
 }
 
 func (s *Server) registerURL() {
-	api := s.engine.Group("/api/cc", gin.BasicAuth(gin.Accounts{s.cfg.AdminUserName: s.cfg.AdminPassword}))
+	viewer := adminauth.RequireRole(models.AdminRoleViewer)
+	admin := adminauth.RequireRole(models.AdminRoleAdmin)
+
+	api := s.engine.Group("/api/cc", s.auth.Authenticate())
 	api.Use(gin.Recovery())
 	api.Use(gzip.Gzip(gzip.DefaultCompression))
 	api.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 	})
-	api.GET("/namespace/list", s.listNamespace)
-	api.GET("/namespace", s.queryNamespace)
-	api.GET("/namespace/detail/:name", s.detailNamespace)
-	api.PUT("/namespace/modify", s.modifyNamespace)
-	api.PUT("/namespace/delete/:name", s.delNamespace)
-	api.GET("/namespace/sqlfingerprint/:name", s.sqlFingerprint)
-	api.GET("/proxy/source/fingerprint", s.proxyConfigFingerprint)
+	api.GET("/namespace/list", viewer, s.listNamespace)
+	api.GET("/namespace", admin, s.queryNamespace)
+	api.GET("/namespace/detail/:name", admin, s.detailNamespace)
+	api.PUT("/namespace/modify", admin, s.modifyNamespace)
+	api.PUT("/namespace/delete/:name", admin, s.delNamespace)
+	api.GET("/namespace/sqlfingerprint/:name", viewer, s.sqlFingerprint)
+	api.GET("/proxy/source/fingerprint", viewer, s.proxyConfigFingerprint)
+	api.GET("/namespace/history/:name", viewer, s.listNamespaceHistory)
+	api.GET("/namespace/history/:name/:version", viewer, s.queryNamespaceVersion)
+	api.GET("/namespace/diff/:name", viewer, s.diffNamespace)
+	api.PUT("/namespace/rollback/:name/:version", admin, s.rollbackNamespace)
 }
 
 // ListNamespaceResp list names of all namespace response
@@ -176,7 +217,7 @@ func (s *Server) modifyNamespace(c *gin.Context) {
 		return
 	}
 	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
-	err = service.ModifyNamespace(&namespace, s.cfg, cluster)
+	err = service.ModifyNamespace(&namespace, s.cfg, cluster, c.GetString(gin.AuthUserKey))
 	if err != nil {
 		proxy.ControllerLogger.Warnf("modifyNamespace failed, err: %v", err)
 		h.RetMessage = err.Error()
@@ -213,6 +254,122 @@ func (s *Server) delNamespace(c *gin.Context) {
 	return
 }
 
+// NamespaceHistoryResp list config versions of namespace response
+type NamespaceHistoryResp struct {
+	RetHeader *RetHeader                 `json:"ret_header"`
+	Data      []*models.NamespaceVersion `json:"data"`
+}
+
+func (s *Server) listNamespaceHistory(c *gin.Context) {
+	var err error
+	r := &NamespaceHistoryResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		r.RetHeader.RetMessage = "input name is empty"
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	r.Data, err = service.ListNamespaceHistory(name, s.cfg, cluster)
+	if err != nil {
+		proxy.ControllerLogger.Warnf("list history of namespace %s failed, %v", name, err)
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+	return
+}
+
+// NamespaceVersionResp query config version of namespace response
+type NamespaceVersionResp struct {
+	RetHeader *RetHeader               `json:"ret_header"`
+	Data      *models.NamespaceVersion `json:"data"`
+}
+
+func (s *Server) queryNamespaceVersion(c *gin.Context) {
+	r := &NamespaceVersionResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+	name := strings.TrimSpace(c.Param("name"))
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if name == "" || err != nil {
+		r.RetHeader.RetMessage = "input name or version is invalid"
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	r.Data, err = service.QueryNamespaceVersion(name, version, s.cfg, cluster)
+	if err != nil {
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+	return
+}
+
+// NamespaceDiffResp diff between config versions of namespace response
+type NamespaceDiffResp struct {
+	RetHeader *RetHeader           `json:"ret_header"`
+	Data      []*models.ConfigDiff `json:"data"`
+}
+
+// diffNamespace 比较from和to两个版本的配置, 不指定to时与当前配置比较
+func (s *Server) diffNamespace(c *gin.Context) {
+	r := &NamespaceDiffResp{RetHeader: &RetHeader{RetCode: -1, RetMessage: ""}}
+	name := strings.TrimSpace(c.Param("name"))
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if name == "" || err != nil {
+		r.RetHeader.RetMessage = "input name or from version is invalid"
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil {
+		r.RetHeader.RetMessage = "input to version is invalid"
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	r.Data, err = service.DiffNamespaceVersion(name, from, to, s.cfg, cluster)
+	if err != nil {
+		r.RetHeader.RetMessage = err.Error()
+		c.JSON(http.StatusOK, r)
+		return
+	}
+	r.RetHeader.RetCode = 0
+	r.RetHeader.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, r)
+	return
+}
+
+func (s *Server) rollbackNamespace(c *gin.Context) {
+	h := &RetHeader{RetCode: -1, RetMessage: ""}
+	name := strings.TrimSpace(c.Param("name"))
+	version, err := strconv.ParseInt(c.Param("version"), 10, 64)
+	if name == "" || err != nil {
+		h.RetMessage = "input name or version is invalid"
+		c.JSON(http.StatusOK, h)
+		return
+	}
+	cluster := c.DefaultQuery("cluster", s.cfg.DefaultCluster)
+	err = service.RollbackNamespace(name, version, s.cfg, cluster, c.GetString(gin.AuthUserKey))
+	if err != nil {
+		proxy.ControllerLogger.Warnf("rollback namespace %s to version %d failed, err: %v", name, version, err)
+		h.RetMessage = err.Error()
+		c.JSON(http.StatusOK, h)
+		return
+	}
+
+	h.RetCode = 0
+	h.RetMessage = "SUCC"
+	c.JSON(http.StatusOK, h)
+	return
+}
+
 type sqlFingerprintResp struct {
 	RetHeader *RetHeader        `json:"ret_header"`
 	ErrSQLs   map[string]string `json:"err_sqls"`
@@ -285,7 +442,18 @@ func (s *Server) Run() {
 
 }
 
+// ReloadTLS reload cert of admin api, do nothing if https is not enabled
+func (s *Server) ReloadTLS() error {
+	if s.certReloader == nil {
+		return nil
+	}
+	return s.certReloader.Reload()
+}
+
 func (s *Server) Close() {
+	if s.certReloader != nil {
+		s.certReloader.Close()
+	}
 	s.exitC <- struct{}{}
 	return
 }
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"github.com/XiaoMi/Gaea/provider"
 	"sync"
+	"time"
 
 	"github.com/XiaoMi/Gaea/cc/proxy"
 	"github.com/XiaoMi/Gaea/models"
@@ -59,9 +60,14 @@ func QueryNamespace(names []string, cfg *models.CCConfig, cluster string) (data
 	return data, nil
 }
 
-// ModifyNamespace create or modify namespace
-func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster string) (err error) {
-	if err = namespace.Verify(); err != nil {
+// ModifyNamespace create or modify namespace, author is recorded in config history
+func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster, author string) (err error) {
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := provider.NewStore(client)
+	defer storeConn.Close()
+
+	// slice模板和include在校验时展开, 保存时保留原始配置
+	if err = storeConn.VerifyNamespace(namespace); err != nil {
 		return fmt.Errorf("verify namespace error: %v", err)
 	}
 
@@ -71,15 +77,45 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 	}
 
 	// sink namespace
-	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
-	storeConn := provider.NewStore(client)
-	defer storeConn.Close()
-
-	if err := storeConn.UpdateNamespace(namespace); err != nil {
+	if err = applyNamespace(storeConn, namespace.Name, namespace.Encode(), author, ""); err != nil {
 		proxy.ControllerLogger.Warnf("update namespace failed, %s", string(namespace.Encode()))
 		return err
 	}
 
+	return reloadNamespace(storeConn, namespace.Name, cfg)
+}
+
+// applyNamespace 写入配置中心并记录配置版本, 写入前配置被其他人修改时返回ErrNamespaceConflict
+func applyNamespace(storeConn *provider.Store, name string, data []byte, author, comment string) error {
+	prev, err := storeConn.ReadNamespace(name)
+	if err != nil {
+		return err
+	}
+	diff, err := models.DiffConfig(prev, data)
+	if err != nil {
+		return err
+	}
+	if err = storeConn.CompareAndSwapNamespace(name, prev, data); err != nil {
+		return err
+	}
+
+	v := &models.NamespaceVersion{
+		Name:      name,
+		Author:    author,
+		Timestamp: time.Now().Unix(),
+		Comment:   comment,
+		Diff:      diff,
+		Config:    data,
+	}
+	// 配置已经生效, 记录历史失败不影响本次修改
+	if err = storeConn.AddNamespaceVersion(v); err != nil {
+		proxy.ControllerLogger.Warnf("add history of namespace %s failed, %v", name, err)
+	}
+	return nil
+}
+
+// reloadNamespace 通知所有proxy重新加载namespace
+func reloadNamespace(storeConn *provider.Store, name string, cfg *models.CCConfig) error {
 	// proxies ready to reload source
 	proxies, err := storeConn.ListProxyMonitorMetrics()
 	if err != nil {
@@ -89,7 +125,7 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 
 	// prepare phase
 	for _, v := range proxies {
-		err := proxy.PrepareConfig(v.IP+":"+v.AdminPort, namespace.Name, cfg)
+		err := proxy.PrepareConfig(v.IP+":"+v.AdminPort, name, cfg)
 		if err != nil {
 			return err
 		}
@@ -97,7 +133,7 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 
 	// commit phase
 	for _, v := range proxies {
-		err := proxy.CommitConfig(v.IP+":"+v.AdminPort, namespace.Name, cfg)
+		err := proxy.CommitConfig(v.IP+":"+v.AdminPort, name, cfg)
 		if err != nil {
 			return err
 		}
@@ -106,6 +142,104 @@ func ModifyNamespace(namespace *models.Namespace, cfg *models.CCConfig, cluster
 	return nil
 }
 
+// ListNamespaceHistory return config versions of namespace without config content
+func ListNamespaceHistory(name string, cfg *models.CCConfig, cluster string) ([]*models.NamespaceVersion, error) {
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	mConn := provider.NewStore(client)
+	defer mConn.Close()
+
+	versions, err := mConn.ListNamespaceVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		v.Config = nil
+	}
+	return versions, nil
+}
+
+// QueryNamespaceVersion return config version of namespace
+func QueryNamespaceVersion(name string, version int64, cfg *models.CCConfig, cluster string) (*models.NamespaceVersion, error) {
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	mConn := provider.NewStore(client)
+	defer mConn.Close()
+
+	v, err := mConn.LoadNamespaceVersion(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("version %d of namespace %s not found", version, name)
+	}
+	return v, nil
+}
+
+// DiffNamespaceVersion return diff between two config versions of namespace, to <= 0 means current config
+func DiffNamespaceVersion(name string, from, to int64, cfg *models.CCConfig, cluster string) ([]*models.ConfigDiff, error) {
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	mConn := provider.NewStore(client)
+	defer mConn.Close()
+
+	fromVersion, err := mConn.LoadNamespaceVersion(name, from)
+	if err != nil {
+		return nil, err
+	}
+	if fromVersion == nil {
+		return nil, fmt.Errorf("version %d of namespace %s not found", from, name)
+	}
+
+	var toConfig []byte
+	if to <= 0 {
+		if toConfig, err = mConn.ReadNamespace(name); err != nil {
+			return nil, err
+		}
+	} else {
+		toVersion, err := mConn.LoadNamespaceVersion(name, to)
+		if err != nil {
+			return nil, err
+		}
+		if toVersion == nil {
+			return nil, fmt.Errorf("version %d of namespace %s not found", to, name)
+		}
+		toConfig = toVersion.Config
+	}
+	return models.DiffConfig(fromVersion.Config, toConfig)
+}
+
+// RollbackNamespace apply config of the specified version as a new version
+func RollbackNamespace(name string, version int64, cfg *models.CCConfig, cluster, author string) error {
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
+	storeConn := provider.NewStore(client)
+	defer storeConn.Close()
+
+	v, err := storeConn.LoadNamespaceVersion(name, version)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return fmt.Errorf("version %d of namespace %s not found", version, name)
+	}
+
+	// 历史版本中保存的是加密后的配置, 解密后按当前的模板和include校验
+	namespace := &models.Namespace{}
+	if err = models.JSONDecode(namespace, v.Config); err != nil {
+		return fmt.Errorf("decode namespace error: %v", err)
+	}
+	if err = namespace.Decrypt(cfg.EncryptKey); err != nil {
+		return fmt.Errorf("decrypt namespace error: %v", err)
+	}
+	if err = storeConn.VerifyNamespace(namespace); err != nil {
+		return fmt.Errorf("verify namespace error: %v", err)
+	}
+
+	if err = applyNamespace(storeConn, name, v.Config, author, fmt.Sprintf("rollback to version %d", version)); err != nil {
+		proxy.ControllerLogger.Warnf("rollback namespace %s to version %d failed, %v", name, version, err)
+		return err
+	}
+
+	return reloadNamespace(storeConn, name, cfg)
+}
+
 // DelNamespace delete namespace
 func DelNamespace(name string, cfg *models.CCConfig, cluster string) error {
 	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, getCoordinatorRoot(cluster))
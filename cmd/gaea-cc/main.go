@@ -55,7 +55,7 @@ func main() {
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGPIPE)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGPIPE, syscall.SIGHUP)
 	wg := new(sync.WaitGroup)
 	wg.Add(1)
 	go func() {
@@ -67,6 +67,11 @@ func main() {
 				s.Close()
 				return
 			}
+			if sig == syscall.SIGHUP {
+				proxy.ControllerLogger.Infof("got hangup signal, reload admin tls cert")
+				_ = s.ReloadTLS()
+				continue
+			}
 			proxy.ControllerLogger.Infof("ignore signal %d", sig)
 		}
 	}()
@@ -0,0 +1,79 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/replay"
+)
+
+// replayConn execute statements through a direct connection to gaea proxy
+type replayConn struct {
+	dc *backend.DirectConnection
+}
+
+func (c *replayConn) UseDB(db string) error {
+	return c.dc.UseDB(db)
+}
+
+func (c *replayConn) Execute(sql string) error {
+	_, err := c.dc.Execute(sql)
+	return err
+}
+
+func (c *replayConn) Close() {
+	c.dc.Close()
+}
+
+func main() {
+	var file = flag.String("file", "", "captured file to replay")
+	var addr = flag.String("addr", "127.0.0.1:13306", "address of staging gaea proxy")
+	var user = flag.String("user", "", "user of staging namespace")
+	var password = flag.String("password", "", "password of staging namespace user")
+	var speed = flag.Float64("speed", 1, "replay speed, 1 means original speed, 0 means as fast as possible")
+	flag.Parse()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Printf("open capture file error: %v\n", err)
+		os.Exit(1)
+	}
+	records, err := replay.ReadRecords(f)
+	f.Close()
+	if err != nil {
+		fmt.Printf("read capture file error: %v\n", err)
+		os.Exit(1)
+	}
+
+	dialer := func(rec *replay.Record) (replay.Conn, error) {
+		dc, err := backend.NewDirectConnection(*addr, *user, *password, rec.DB, mysql.DefaultCharset, mysql.DefaultCollationID)
+		if err != nil {
+			return nil, err
+		}
+		return &replayConn{dc: dc}, nil
+	}
+
+	stats, err := replay.NewReplayer(dialer, *speed).Replay(records)
+	if err != nil {
+		fmt.Printf("replay error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("replay finished, total: %d, failed: %d, duration: %v\n", stats.Total, stats.Failed, stats.Duration)
+}
@@ -77,6 +77,7 @@ func main() {
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
 		syscall.SIGPIPE,
+		syscall.SIGHUP,
 		//syscall.SIGUSR1,
 	)
 
@@ -88,10 +89,13 @@ func main() {
 			sig := <-sc
 			if sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGQUIT {
 				logging.DefaultLogger.Infof("Got signal %d, quit", sig)
-				_ = svr.Close()
+				_ = svr.Shutdown()
 				break
 			} else if sig == syscall.SIGPIPE {
 				logging.DefaultLogger.Infof("Ignore broken pipe signal")
+			} else if sig == syscall.SIGHUP {
+				logging.DefaultLogger.Infof("Got hangup signal, reload admin tls cert")
+				_ = svr.ReloadTLS()
 			}
 			//} else if sig == syscall.SIGUSR1 {
 			//	log.Infof("Got update source signal")
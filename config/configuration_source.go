@@ -12,6 +12,7 @@ type SourceProvider interface {
 	Create(path string, data []byte) error
 	Update(path string, data []byte) error
 	UpdateWithTTL(path string, data []byte, ttl time.Duration) error
+	CompareAndSwap(path string, prevData, data []byte) error
 	Delete(path string) error
 	Read(path string) ([]byte, error)
 	List(path string) ([]string, error)
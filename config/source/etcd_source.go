@@ -32,6 +32,9 @@ import (
 // ErrClosedEtcdClient means etcd client closed
 var ErrClosedEtcdClient = errors.New("use of closed etcd client")
 
+// ErrCompareFailed means current value of path doesn't match the expected one
+var ErrCompareFailed = errors.New("compare failed")
+
 const (
 	defaultEtcdPrefix = "/gaea"
 )
@@ -119,6 +122,15 @@ func isErrNodeExists(err error) bool {
 	return false
 }
 
+func isErrTestFailed(err error) bool {
+	if err != nil {
+		if e, ok := err.(client.Error); ok {
+			return e.Code == client.ErrorCodeTestFailed
+		}
+	}
+	return false
+}
+
 // Mkdir create directory
 func (c *etcdSource) Mkdir(dir string) error {
 	c.Lock()
@@ -202,6 +214,31 @@ func (c *etcdSource) UpdateWithTTL(path string, data []byte, ttl time.Duration)
 	return nil
 }
 
+// CompareAndSwap update path with data only if current value equals prevData, nil prevData means path must not exist
+func (c *etcdSource) CompareAndSwap(path string, prevData, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return ErrClosedEtcdClient
+	}
+	cntx, canceller := c.contextWithTimeout()
+	defer canceller()
+	opts := &client.SetOptions{PrevExist: client.PrevNoExist}
+	if prevData != nil {
+		opts = &client.SetOptions{PrevExist: client.PrevExist, PrevValue: string(prevData)}
+	}
+	logging.DefaultLogger.Debugf("etcd compare and swap node %s", path)
+	_, err := c.kapi.Set(cntx, path, string(data), opts)
+	if err != nil {
+		logging.DefaultLogger.Debugf("etcd compare and swap node %s failed: %s", path, err)
+		if isErrNodeExists(err) || isErrTestFailed(err) || isErrNoNode(err) {
+			return ErrCompareFailed
+		}
+		return err
+	}
+	return nil
+}
+
 // Delete delete path
 func (c *etcdSource) Delete(path string) error {
 	c.Lock()
@@ -80,6 +80,11 @@ func (c *fileSource) UpdateWithTTL(path string, data []byte, ttl time.Duration)
 	return nil
 }
 
+// CompareAndSwap do nothing
+func (c *fileSource) CompareAndSwap(path string, prevData, data []byte) error {
+	return nil
+}
+
 // Delete delete path
 func (c *fileSource) Delete(path string) error {
 	return nil
@@ -37,6 +37,11 @@ var (
 	// ErrSlaveDown slave is down
 	ErrSlaveDown = errors.New("slave is down")
 
+	// ErrSliceReadDisabled slice is disabled for read
+	ErrSliceReadDisabled = errors.New("slice is disabled for read")
+	// ErrSliceWriteDisabled slice is disabled for write
+	ErrSliceWriteDisabled = errors.New("slice is disabled for write")
+
 	// ErrInvalidArgument invalid arguments
 	ErrInvalidArgument = errors.New("argument is invalid")
 	// ErrInvalidCharset invalid charset
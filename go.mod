@@ -3,12 +3,14 @@ module github.com/XiaoMi/Gaea
 go 1.15
 
 require (
+	filippo.io/edwards25519 v1.0.0-beta.3
 	github.com/coreos/etcd v3.3.13+incompatible
 	github.com/emirpasic/gods v1.12.0
 	github.com/gin-contrib/gzip v0.0.1
 	github.com/gin-gonic/gin v1.5.0
 	github.com/go-ini/ini v1.42.0
 	github.com/golang/mock v1.3.1
+	github.com/klauspost/compress v1.11.13
 	github.com/pingcap/check v0.0.0-20200212061837-5e12011dc712
 	github.com/pingcap/errors v0.11.5-0.20190809092503-95897b64e011
 	github.com/pingcap/parser v0.0.0-20200623164729-3a18f1e5dceb
@@ -20,5 +22,4 @@ require (
 	go.uber.org/multierr v1.5.0
 	go.uber.org/zap v1.16.0
 	gopkg.in/ini.v1 v1.42.0
-
 )
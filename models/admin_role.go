@@ -0,0 +1,95 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// roles of admin api and admin sql commands, 权限依次递增, 高级别角色拥有低级别角色的全部权限
+const (
+	AdminRoleViewer   = "viewer"   // 查询状态和配置
+	AdminRoleOperator = "operator" // 运维操作, 如切换只读、开关slice、KILL、FLUSH
+	AdminRoleAdmin    = "admin"    // 修改配置, 故障注入, 抓包, pprof
+)
+
+var adminRoleLevels = map[string]int{
+	AdminRoleViewer:   1,
+	AdminRoleOperator: 2,
+	AdminRoleAdmin:    3,
+}
+
+// IsValidAdminRole check if role is one of viewer, operator and admin
+func IsValidAdminRole(role string) bool {
+	_, ok := adminRoleLevels[role]
+	return ok
+}
+
+// AdminRoleAllowed return true if role has privileges of required role
+func AdminRoleAllowed(role, required string) bool {
+	level, ok := adminRoleLevels[role]
+	return ok && level >= adminRoleLevels[required]
+}
+
+// AdminToken identity of admin api authenticated by bearer token
+type AdminToken struct {
+	Name  string
+	Role  string
+	Token string
+}
+
+// ParseAdminTokens parse tokens in format of name:role:token, separated by comma
+func ParseAdminTokens(s string) ([]*AdminToken, error) {
+	var tokens []*AdminToken
+	for _, item := range splitAdminItems(s) {
+		kv := strings.SplitN(item, ":", 3)
+		if len(kv) != 3 || kv[0] == "" || kv[2] == "" {
+			return nil, fmt.Errorf("invalid admin token: %s, should be name:role:token", kv[0])
+		}
+		if !IsValidAdminRole(kv[1]) {
+			return nil, fmt.Errorf("invalid role of admin token %s: %s", kv[0], kv[1])
+		}
+		tokens = append(tokens, &AdminToken{Name: kv[0], Role: kv[1], Token: kv[2]})
+	}
+	return tokens, nil
+}
+
+// ParseAdminCertRoles parse roles of client certificate in format of common_name:role, separated by comma
+func ParseAdminCertRoles(s string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, item := range splitAdminItems(s) {
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid admin cert role: %s, should be common_name:role", item)
+		}
+		cn, role := item[:idx], item[idx+1:]
+		if !IsValidAdminRole(role) {
+			return nil, fmt.Errorf("invalid role of admin cert %s: %s", cn, role)
+		}
+		roles[cn] = role
+	}
+	return roles, nil
+}
+
+func splitAdminItems(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "testing"
+
+func TestAdminRoleAllowed(t *testing.T) {
+	tests := []struct {
+		role, required string
+		allowed        bool
+	}{
+		{AdminRoleViewer, AdminRoleViewer, true},
+		{AdminRoleViewer, AdminRoleOperator, false},
+		{AdminRoleOperator, AdminRoleViewer, true},
+		{AdminRoleOperator, AdminRoleAdmin, false},
+		{AdminRoleAdmin, AdminRoleOperator, true},
+		{"", AdminRoleViewer, false},
+		{"root", AdminRoleViewer, false},
+	}
+	for _, test := range tests {
+		if AdminRoleAllowed(test.role, test.required) != test.allowed {
+			t.Errorf("role %q required %q, expect allowed: %v", test.role, test.required, test.allowed)
+		}
+	}
+}
+
+func TestParseAdminTokens(t *testing.T) {
+	tokens, err := ParseAdminTokens(" ops:operator:abc:def , monitor:viewer:xyz,")
+	if err != nil {
+		t.Fatalf("parse admin tokens error: %v", err)
+	}
+	if len(tokens) != 2 || *tokens[0] != (AdminToken{Name: "ops", Role: AdminRoleOperator, Token: "abc:def"}) ||
+		*tokens[1] != (AdminToken{Name: "monitor", Role: AdminRoleViewer, Token: "xyz"}) {
+		t.Errorf("parse admin tokens error, tokens: %s", JSONEncode(tokens))
+	}
+
+	for _, s := range []string{"ops:operator", "ops:root:abc", ":admin:abc", "ops:admin:"} {
+		if _, err := ParseAdminTokens(s); err == nil {
+			t.Errorf("invalid admin tokens %q should return error", s)
+		}
+	}
+}
+
+func TestParseAdminCertRoles(t *testing.T) {
+	roles, err := ParseAdminCertRoles("cc.example.com:admin, ops:operator")
+	if err != nil {
+		t.Fatalf("parse admin cert roles error: %v", err)
+	}
+	if len(roles) != 2 || roles["cc.example.com"] != AdminRoleAdmin || roles["ops"] != AdminRoleOperator {
+		t.Errorf("parse admin cert roles error, roles: %v", roles)
+	}
+
+	for _, s := range []string{"ops", ":admin", "ops:root"} {
+		if _, err := ParseAdminCertRoles(s); err == nil {
+			t.Errorf("invalid admin cert roles %q should return error", s)
+		}
+	}
+}
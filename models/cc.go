@@ -27,6 +27,18 @@ type CCConfig struct {
 	AdminPassword string `ini:"admin_password"`
 	ProxyUserName string `ini:"proxy_username"`
 	ProxyPassword string `ini:"proxy_password"`
+
+	// 管理接口RBAC, admin_username通过basic auth认证, 始终为admin角色
+	AdminTokens    string `ini:"admin_tokens"`     // name:role:token, 多个用逗号分隔, 通过Authorization: Bearer <token>认证
+	AdminTLSCert   string `ini:"admin_tls_cert"`   // 管理接口https证书, 为空时使用http
+	AdminTLSKey    string `ini:"admin_tls_key"`    // 管理接口https私钥
+	AdminTLSCA     string `ini:"admin_tls_ca"`     // 校验客户端证书的CA, 配置后支持mTLS认证
+	AdminCertRoles string `ini:"admin_cert_roles"` // common_name:role, 多个用逗号分隔, 客户端证书CN对应的角色
+
+	// 访问proxy管理接口使用https, proxy开启https时需要配置
+	ProxyTLSCA   string `ini:"proxy_tls_ca"`   // 校验proxy证书的CA
+	ProxyTLSCert string `ini:"proxy_tls_cert"` // 客户端证书, proxy要求mTLS时配置
+	ProxyTLSKey  string `ini:"proxy_tls_key"`  // 客户端私钥
 	// etcd 相关配置
 	CoordinatorAddr string `ini:"coordinator_addr"`
 	CoordinatorRoot string `ini:"coordinator_root"`
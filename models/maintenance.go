@@ -0,0 +1,50 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceTimeLayout time layout of maintenance window, in local time zone
+const MaintenanceTimeLayout = "2006-01-02 15:04:05"
+
+// MaintenanceWindow means a period during which the namespace is read only
+type MaintenanceWindow struct {
+	Start string `json:"start"` // 开始时间, 格式: 2006-01-02 15:04:05
+	End   string `json:"end"`   // 结束时间, 格式同上
+}
+
+// Parse parse start and end time of maintenance window
+func (w *MaintenanceWindow) Parse() (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(MaintenanceTimeLayout, w.Start, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance window start: %s", w.Start)
+	}
+	end, err := time.ParseInLocation(MaintenanceTimeLayout, w.End, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid maintenance window end: %s", w.End)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("maintenance window end must be after start, start: %s, end: %s", w.Start, w.End)
+	}
+	return start, end, nil
+}
+
+func (w *MaintenanceWindow) verify() error {
+	_, _, err := w.Parse()
+	return err
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMaterializedViewRefreshInterval default refresh interval of materialized view, in seconds
+const DefaultMaterializedViewRefreshInterval = 60
+
+// MaterializedView means a logical view whose result is materialized into a table of default slice
+type MaterializedView struct {
+	DB              string `json:"db"`               // 逻辑库名
+	Name            string `json:"name"`             // 视图名, 查询该名称时直接读取物化表
+	SQL             string `json:"sql"`              // 视图定义, 基于逻辑表的SELECT语句, 可跨分片
+	Table           string `json:"table"`            // 物化表, 位于default slice对应的物理库, 为空时与视图名相同
+	RefreshInterval int    `json:"refresh_interval"` // 刷新间隔, 单位秒, 为0时使用默认值, 小于0表示只能手动刷新
+}
+
+// GetTable return name of the materialized table
+func (v *MaterializedView) GetTable() string {
+	if v.Table != "" {
+		return v.Table
+	}
+	return v.Name
+}
+
+func (v *MaterializedView) verify() error {
+	if v.DB == "" || v.Name == "" {
+		return fmt.Errorf("must specify db and name of materialized view")
+	}
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(v.SQL)), "select") {
+		return fmt.Errorf("sql of materialized view %s.%s must be a select statement", v.DB, v.Name)
+	}
+	return nil
+}
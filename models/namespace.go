@@ -26,13 +26,19 @@ import (
 	"github.com/XiaoMi/Gaea/util/crypto"
 )
 
+// constants of unparseable_policy
+const (
+	UnparseableReject      = "reject"
+	UnparseablePassThrough = "pass_through"
+)
+
 // Namespace means namespace model stored in etcd
 type Namespace struct {
 	OpenGeneralLog   bool              `json:"open_general_log"`
 	IsEncrypt        bool              `json:"is_encrypt"` // true: 加密存储 false: 非加密存储，目前加密Slice、User中的用户名、密码
 	Name             string            `json:"name"`
 	Online           bool              `json:"online"`
-	ReadOnly         bool              `json:"read_only"`
+	ReadOnly         bool              `json:"read_only"` // true: 拒绝写操作, 用于迁移、切换等维护场景
 	AllowedDBS       map[string]bool   `json:"allowed_dbs"`
 	DefaultPhyDBS    map[string]string `json:"default_phy_dbs"`
 	SlowSQLTime      string            `json:"slow_sql_time"`
@@ -45,6 +51,61 @@ type Namespace struct {
 	GlobalSequences  []*GlobalSequence `json:"global_sequences"`
 	DefaultCharset   string            `json:"default_charset"`
 	DefaultCollation string            `json:"default_collation"`
+
+	MaintenanceWindows   []*MaintenanceWindow `json:"maintenance_windows"`     // 维护窗口, 窗口期间namespace只读
+	ReadOnlyExceptTables []string             `json:"read_only_except_tables"` // 只读期间仍允许写入的表, 格式: db.table
+
+	SampleSessionRate int `json:"sample_session_rate"` // 会话采样, 每N个会话采样1个, 采样会话的所有语句记录详细日志, 0表示关闭
+	SampleSQLRate     int `json:"sample_sql_rate"`     // 语句采样, 每N条语句采样1条, 0表示关闭
+
+	ResourceStatsSampleRate int `json:"resource_stats_sample_rate"` // 资源消耗统计, 每N条语句统计1条的proxy CPU时间和内存分配, 0表示关闭
+
+	LogRawSQL bool `json:"log_raw_sql"` // 日志中输出原始SQL, 默认字面量替换为?, 仅用于排查问题
+
+	ErrorDetail bool `json:"error_detail"` // 返回给客户端的错误信息附加namespace、slice、SQL指纹、是否可重试等结构化信息
+
+	MaterializedViews []*MaterializedView `json:"materialized_views"` // 物化视图, 跨分片查询结果定期物化到default slice
+	Views             []*View             `json:"views"`              // 逻辑视图, 查询时展开为视图定义的SELECT语句
+	ResultTransforms  []*ResultTransform  `json:"result_transforms"`  // 结果集转换规则, 用于表结构迁移期间兼容旧的列
+	VersionColumns    []*VersionColumn    `json:"version_columns"`    // 乐观锁版本列
+
+	MaxSQLLength  int `json:"max_sql_length"`   // 语句的最大长度, 单位字节, 在解析之前检查, 0表示不限制
+	MaxInListSize int `json:"max_in_list_size"` // IN列表的最大值个数, 在解析之前检查, 0表示不限制
+	ParseTimeout  int `json:"parse_timeout"`    // 解析语句的时间预算, 单位毫秒, 0表示不限制
+	MaxASTDepth   int `json:"max_ast_depth"`    // 语法树的最大深度, 解析之前先按括号嵌套层数检查, 0表示不限制
+	MaxASTNodes   int `json:"max_ast_nodes"`    // 语法树的最大节点数, 0表示不限制
+
+	MergeMemoryLimit int64  `json:"merge_memory_limit"` // 跨分片合并结果的内存限制, 单位字节, 0表示不限制
+	MergeSpillDir    string `json:"merge_spill_dir"`    // 超过内存限制时溢写临时文件的目录, 为空时超过限制返回错误
+
+	HedgeReadPercentile int `json:"hedge_read_percentile"` // 从库读跨分片查询的对冲分位数(1-99), 分片耗时超过该分位数时向其他从库再发一次, 0表示关闭
+	HedgeReadMinDelay   int `json:"hedge_read_min_delay"`  // 对冲等待的最小时间, 单位毫秒
+
+	WriteBufferSize int `json:"write_buffer_size"` // 前端连接合并写的缓冲区大小, 单位字节, 0使用proxy配置, -1不合并
+	FlushDelay      int `json:"flush_delay"`       // 缓冲数据超过该时间未写出时写出, 单位毫秒, 0使用proxy配置, -1只在缓冲区满或结果写完时写出
+
+	CheckShardTablesOnLoad bool `json:"check_shard_tables_on_load"` // 加载时检查分片规则对应的物理表是否存在, 结果输出到日志
+
+	DefaultShardRule *DefaultShardRule `json:"default_shard_rule"` // 默认分片模板, 表名匹配且没有单独配置规则的表使用该模板分片
+
+	BaseShardRules []*BaseShardRule `json:"base_shard_rules"` // 可被继承的基础分片规则, 规则通过extends引用, 加载时展开
+
+	CandidateShardRules    []*Shard `json:"candidate_shard_rules"`     // 迁移或灰度期间的新分片规则, 只用于与shard_rules对比路由结果, 不影响语句执行
+	RoutingAuditSampleRate int      `json:"routing_audit_sample_rate"` // 配置candidate_shard_rules后, 每N条语句对比1条新旧规则的路由结果, 0或1表示每条都对比
+
+	RestoreFlags *RestoreFlags `json:"restore_flags"` // 改写SQL的生成格式, 为空时使用默认格式
+
+	UnparseablePolicy string `json:"unparseable_policy"` // 无法解析的语句的处理方式, 为空或reject时返回错误, pass_through时原样发往默认或hint指定的slice, 仅用于没有分片规则的namespace
+
+	StrictMode bool `json:"strict_mode"` // 拒绝没有WHERE的UPDATE/DELETE, TRUNCATE分片表和DROP语句, 会话设置gaea_allow_dangerous_sql = on或admin_role为admin的用户可以执行
+
+	InitSQLs []string `json:"init_sqls"` // 每个新建的后端连接依次执行的SET语句, 相当于init_connect
+
+	// slice模板及按环境覆盖, 加载时展开到slices中
+	ConfigVars     map[string]string                `json:"config_vars"`     // 模板变量, 在slice的字符串字段中以${name}引用
+	SliceTemplates []*SliceTemplate                 `json:"slice_templates"` // slice模板, 按count生成多个slice
+	Environments   map[string]*NamespaceEnvironment `json:"environments"`    // 按proxy的environ覆盖变量和slice配置
+	Includes       []string                         `json:"includes"`        // 引用的公共配置, 位于配置根目录的include下
 }
 
 // Encode encode json
@@ -70,6 +131,10 @@ func (n *Namespace) Verify() error {
 		return err
 	}
 
+	if err := n.verifySampleRate(); err != nil {
+		return err
+	}
+
 	if err := n.verifyDBs(); err != nil {
 		return err
 	}
@@ -94,6 +159,62 @@ func (n *Namespace) Verify() error {
 		return err
 	}
 
+	if err := n.verifyCandidateShardRules(); err != nil {
+		return err
+	}
+
+	if err := n.verifyDefaultShardRule(); err != nil {
+		return err
+	}
+
+	if err := n.verifyMaintenance(); err != nil {
+		return err
+	}
+
+	if err := n.verifyMaterializedViews(); err != nil {
+		return err
+	}
+
+	if err := n.verifyViews(); err != nil {
+		return err
+	}
+
+	if err := n.verifyResultTransforms(); err != nil {
+		return err
+	}
+
+	if err := n.verifyVersionColumns(); err != nil {
+		return err
+	}
+
+	if err := n.verifySQLLimits(); err != nil {
+		return err
+	}
+
+	if err := n.verifyMergeSpill(); err != nil {
+		return err
+	}
+
+	if err := n.verifyHedgeRead(); err != nil {
+		return err
+	}
+
+	if err := n.verifyWriteBuffering(); err != nil {
+		return err
+	}
+
+	if err := n.verifyRestoreFlags(); err != nil {
+		return err
+	}
+
+	if err := n.verifyUnparseablePolicy(); err != nil {
+		return err
+	}
+
+	if err := n.verifyInitSQLs(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -160,6 +281,13 @@ func (n *Namespace) verifySlowSQLTime() error {
 	return nil
 }
 
+func (n *Namespace) verifySampleRate() error {
+	if n.SampleSessionRate < 0 || n.SampleSQLRate < 0 || n.ResourceStatsSampleRate < 0 || n.RoutingAuditSampleRate < 0 {
+		return errors.New("invalid sample rate")
+	}
+	return nil
+}
+
 func (n *Namespace) isSlowSQLTimeExists() bool {
 	return n.SlowSQLTime != ""
 }
@@ -265,6 +393,19 @@ func (n *Namespace) verifyDefaultSlice() error {
 	return nil
 }
 
+// verifyCandidateShardRules 新分片规则与shard_rules使用相同的校验
+func (n *Namespace) verifyCandidateShardRules() error {
+	if len(n.CandidateShardRules) == 0 {
+		return nil
+	}
+	candidate := *n
+	candidate.ShardRules = n.CandidateShardRules
+	if err := candidate.verifyShardRules(); err != nil {
+		return fmt.Errorf("verify candidate shard rules error: %v", err)
+	}
+	return nil
+}
+
 func (n *Namespace) verifyShardRules() error {
 	var sliceNames []string
 	var linkedRuleShards []*Shard
@@ -281,12 +422,27 @@ func (n *Namespace) verifyShardRules() error {
 					s.Table, slice, strings.Join(s.Slices, ","))
 			}
 		}
+		if s.PreviousVersion != nil {
+			for _, slice := range s.PreviousVersion.Slices {
+				if !includeSlice(sliceNames, slice) {
+					return fmt.Errorf("shard table[%s] previous version slice[%s] not in the namespace.slices list", s.Table, slice)
+				}
+			}
+		}
+		for _, slice := range s.ArchiveSlices {
+			if !includeSlice(sliceNames, slice) {
+				return fmt.Errorf("shard table[%s] archive slice[%s] not in the namespace.slices list", s.Table, slice)
+			}
+		}
 
 		switch s.Type {
 		case ShardDefault:
 			return errors.New("[default-rule] duplicate, must only one")
 		// get index of linked table source and handle it later
 		case ShardLinked:
+			if IsTablePattern(s.Table) {
+				return fmt.Errorf("table %s: table pattern could not be used with linked rule", s.Table)
+			}
 			linkedRuleShards = append(linkedRuleShards, s)
 		default:
 			if err := s.verify(); err != nil {
@@ -324,6 +480,180 @@ func (n *Namespace) verifyShardRules() error {
 	return nil
 }
 
+func (n *Namespace) verifyDefaultShardRule() error {
+	if n.DefaultShardRule == nil {
+		return nil
+	}
+	if err := n.DefaultShardRule.verify(); err != nil {
+		return err
+	}
+	var sliceNames []string
+	for _, slice := range n.Slices {
+		sliceNames = append(sliceNames, slice.Name)
+	}
+	for _, slice := range n.DefaultShardRule.Rule.Slices {
+		if !includeSlice(sliceNames, slice) {
+			return fmt.Errorf("default shard rule slice[%s] not in the namespace.slices list", slice)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyMaintenance() error {
+	for _, w := range n.MaintenanceWindows {
+		if err := w.verify(); err != nil {
+			return fmt.Errorf("verify maintenance window error, namespace: %s, err: %v", n.Name, err)
+		}
+	}
+	for _, t := range n.ReadOnlyExceptTables {
+		if len(strings.Split(strings.TrimSpace(t), ".")) != 2 {
+			return fmt.Errorf("invalid read only except table: %s, must be db.table", t)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyMaterializedViews() error {
+	views := make(map[string]bool, len(n.MaterializedViews))
+	for _, v := range n.MaterializedViews {
+		if err := v.verify(); err != nil {
+			return fmt.Errorf("verify materialized view error, namespace: %s, err: %v", n.Name, err)
+		}
+		if _, ok := n.AllowedDBS[v.DB]; !ok {
+			return fmt.Errorf("db of materialized view %s.%s is not allowed", v.DB, v.Name)
+		}
+		key := v.DB + "." + v.Name
+		if views[key] {
+			return fmt.Errorf("duplicate materialized view: %s", key)
+		}
+		views[key] = true
+	}
+	return nil
+}
+
+func (n *Namespace) verifyViews() error {
+	views := make(map[string]bool, len(n.Views))
+	for _, v := range n.Views {
+		if err := v.verify(); err != nil {
+			return fmt.Errorf("verify view error, namespace: %s, err: %v", n.Name, err)
+		}
+		if _, ok := n.AllowedDBS[v.DB]; !ok {
+			return fmt.Errorf("db of view %s.%s is not allowed", v.DB, v.Name)
+		}
+		key := v.DB + "." + v.Name
+		if views[key] {
+			return fmt.Errorf("duplicate view: %s", key)
+		}
+		views[key] = true
+	}
+	for _, v := range n.MaterializedViews {
+		if views[v.DB+"."+v.Name] {
+			return fmt.Errorf("view %s.%s conflicts with materialized view", v.DB, v.Name)
+		}
+	}
+	for _, s := range n.ShardRules {
+		if views[s.DB+"."+s.Table] {
+			return fmt.Errorf("view %s.%s conflicts with shard table", s.DB, s.Table)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyResultTransforms() error {
+	for _, t := range n.ResultTransforms {
+		if err := t.verify(); err != nil {
+			return fmt.Errorf("verify result transform error, namespace: %s, err: %v", n.Name, err)
+		}
+	}
+	return nil
+}
+
+func (n *Namespace) verifyVersionColumns() error {
+	tables := make(map[string]bool, len(n.VersionColumns))
+	for _, v := range n.VersionColumns {
+		if err := v.verify(); err != nil {
+			return fmt.Errorf("verify version column error, namespace: %s, err: %v", n.Name, err)
+		}
+		key := v.DB + "." + strings.ToLower(v.Table)
+		if tables[key] {
+			return fmt.Errorf("duplicate version column of table: %s", key)
+		}
+		tables[key] = true
+	}
+	return nil
+}
+
+func (n *Namespace) verifySQLLimits() error {
+	if n.MaxSQLLength < 0 {
+		return errors.New("invalid max sql length")
+	}
+	if n.MaxInListSize < 0 {
+		return errors.New("invalid max in list size")
+	}
+	if n.ParseTimeout < 0 {
+		return errors.New("invalid parse timeout")
+	}
+	if n.MaxASTDepth < 0 {
+		return errors.New("invalid max ast depth")
+	}
+	if n.MaxASTNodes < 0 {
+		return errors.New("invalid max ast nodes")
+	}
+	return nil
+}
+
+func (n *Namespace) verifyMergeSpill() error {
+	if n.MergeMemoryLimit < 0 {
+		return errors.New("invalid merge memory limit")
+	}
+	if n.MergeSpillDir != "" && n.MergeMemoryLimit == 0 {
+		return errors.New("merge spill dir requires merge memory limit")
+	}
+	return nil
+}
+
+func (n *Namespace) verifyHedgeRead() error {
+	if n.HedgeReadPercentile < 0 || n.HedgeReadPercentile >= 100 {
+		return errors.New("invalid hedge read percentile")
+	}
+	if n.HedgeReadMinDelay < 0 {
+		return errors.New("invalid hedge read min delay")
+	}
+	return nil
+}
+
+func (n *Namespace) verifyWriteBuffering() error {
+	if n.WriteBufferSize < -1 || n.FlushDelay < -1 {
+		return errors.New("invalid write buffering")
+	}
+	return nil
+}
+
+func (n *Namespace) verifyRestoreFlags() error {
+	if n.RestoreFlags == nil {
+		return nil
+	}
+	if err := n.RestoreFlags.verify(); err != nil {
+		return fmt.Errorf("verify restore flags error: %v", err)
+	}
+	return nil
+}
+
+func (n *Namespace) verifyUnparseablePolicy() error {
+	switch n.UnparseablePolicy {
+	case "", UnparseableReject:
+		return nil
+	case UnparseablePassThrough:
+		// 有分片规则时无法确定语句应该发往哪个分片
+		if len(n.ShardRules) != 0 {
+			return errors.New("unparseable statements can only pass through in namespace without shard rules")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid unparseable policy: %s", n.UnparseablePolicy)
+	}
+}
+
 // Decrypt decrypt user/password in namespace
 func (n *Namespace) Decrypt(key string) (err error) {
 	if !n.IsEncrypt {
@@ -340,13 +670,13 @@ func (n *Namespace) Decrypt(key string) (err error) {
 			return
 		}
 	}
-	// Slices
-	for i := range n.Slices {
-		n.Slices[i].UserName, err = decrypt(key, n.Slices[i].UserName)
+	// Slices and slice templates
+	for _, slice := range n.credentialSlices() {
+		slice.UserName, err = decrypt(key, slice.UserName)
 		if err != nil {
 			return
 		}
-		n.Slices[i].Password, err = decrypt(key, n.Slices[i].Password)
+		slice.Password, err = decrypt(key, slice.Password)
 		if err != nil {
 			return
 		}
@@ -369,13 +699,13 @@ func (n *Namespace) Encrypt(key string) (err error) {
 			return
 		}
 	}
-	// Slices
-	for i := range n.Slices {
-		n.Slices[i].UserName, err = encrypt(key, n.Slices[i].UserName)
+	// Slices and slice templates
+	for _, slice := range n.credentialSlices() {
+		slice.UserName, err = encrypt(key, slice.UserName)
 		if err != nil {
 			return
 		}
-		n.Slices[i].Password, err = encrypt(key, n.Slices[i].Password)
+		slice.Password, err = encrypt(key, slice.Password)
 		if err != nil {
 			return
 		}
@@ -384,6 +714,16 @@ func (n *Namespace) Encrypt(key string) (err error) {
 	return nil
 }
 
+// credentialSlices return slices and slice templates whose user/password are encrypted
+func (n *Namespace) credentialSlices() []*Slice {
+	slices := make([]*Slice, 0, len(n.Slices)+len(n.SliceTemplates))
+	slices = append(slices, n.Slices...)
+	for _, t := range n.SliceTemplates {
+		slices = append(slices, &t.Slice)
+	}
+	return slices
+}
+
 func decrypt(key, data string) (string, error) {
 	t, _ := base64.StdEncoding.DecodeString(data)
 	origin, err := crypto.DecryptECB(key, t)
@@ -401,3 +741,20 @@ func encrypt(key, data string) (string, error) {
 	base64Str := base64.StdEncoding.EncodeToString(tmp)
 	return base64Str, nil
 }
+
+// verifyInitSQLs 初始化语句只允许SET语句, 且不能修改autocommit, 后端连接必须保持autocommit
+func (n *Namespace) verifyInitSQLs() error {
+	for _, sql := range n.InitSQLs {
+		lower := strings.ToLower(strings.TrimSpace(sql))
+		if fields := strings.Fields(lower); len(fields) < 2 || fields[0] != "set" {
+			return fmt.Errorf("invalid init sql: %s, only SET statement is allowed", sql)
+		}
+		if strings.HasSuffix(lower, ";") {
+			return fmt.Errorf("invalid init sql: %s, should not end with semicolon", sql)
+		}
+		if strings.Contains(lower, "autocommit") {
+			return fmt.Errorf("invalid init sql: %s, autocommit could not be set", sql)
+		}
+	}
+	return nil
+}
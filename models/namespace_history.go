@@ -0,0 +1,131 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ErrNamespaceConflict means namespace config was modified by others
+var ErrNamespaceConflict = errors.New("namespace config was modified by others, please retry")
+
+// types of ConfigDiff
+const (
+	ConfigDiffAdd    = "add"
+	ConfigDiffRemove = "remove"
+	ConfigDiffModify = "modify"
+)
+
+// NamespaceVersion 每次生效的namespace配置版本, 持久化到配置中心用于查看变更历史和回滚
+type NamespaceVersion struct {
+	Name      string          `json:"name"`
+	Version   int64           `json:"version"`
+	Author    string          `json:"author"`
+	Timestamp int64           `json:"timestamp"`         // 生效时间, unix秒
+	Comment   string          `json:"comment,omitempty"` // 如: rollback to version 3
+	Diff      []*ConfigDiff   `json:"diff"`              // 相对上一个版本的变更
+	Config    json.RawMessage `json:"config,omitempty"`  // 保存到配置中心的完整配置, 用户名密码已加密
+}
+
+// Encode means encode for easy use
+func (p *NamespaceVersion) Encode() []byte {
+	return JSONEncode(p)
+}
+
+// ConfigDiff 配置中变更的一项
+type ConfigDiff struct {
+	Path string      `json:"path"` // json路径, 如: slices[0].capacity
+	Type string      `json:"type"` // add, remove, modify
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffConfig return structured diff of two json configs, nil or empty prev means config is created
+func DiffConfig(prev, next []byte) ([]*ConfigDiff, error) {
+	var p, n interface{}
+	if len(prev) == 0 {
+		p = map[string]interface{}{}
+	} else if err := json.Unmarshal(prev, &p); err != nil {
+		return nil, fmt.Errorf("decode previous config error: %v", err)
+	}
+	if len(next) == 0 {
+		n = map[string]interface{}{}
+	} else if err := json.Unmarshal(next, &n); err != nil {
+		return nil, fmt.Errorf("decode next config error: %v", err)
+	}
+
+	var diffs []*ConfigDiff
+	diffValue("", p, n, &diffs)
+	return diffs, nil
+}
+
+// diffValue 对象按key, 数组按下标逐层比较, 只有一侧存在的节点整体作为add或remove
+func diffValue(path string, prev, next interface{}, diffs *[]*ConfigDiff) {
+	switch p := prev.(type) {
+	case map[string]interface{}:
+		if n, ok := next.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(p)+len(n))
+			for k := range p {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := p[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				childPath := k
+				if path != "" {
+					childPath = path + "." + k
+				}
+				pv, pok := p[k]
+				nv, nok := n[k]
+				switch {
+				case !pok:
+					*diffs = append(*diffs, &ConfigDiff{Path: childPath, Type: ConfigDiffAdd, New: nv})
+				case !nok:
+					*diffs = append(*diffs, &ConfigDiff{Path: childPath, Type: ConfigDiffRemove, Old: pv})
+				default:
+					diffValue(childPath, pv, nv, diffs)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if n, ok := next.([]interface{}); ok {
+			for i := 0; i < len(p) || i < len(n); i++ {
+				childPath := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(p):
+					*diffs = append(*diffs, &ConfigDiff{Path: childPath, Type: ConfigDiffAdd, New: n[i]})
+				case i >= len(n):
+					*diffs = append(*diffs, &ConfigDiff{Path: childPath, Type: ConfigDiffRemove, Old: p[i]})
+				default:
+					diffValue(childPath, p[i], n[i], diffs)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(prev, next) {
+		*diffs = append(*diffs, &ConfigDiff{Path: path, Type: ConfigDiffModify, Old: prev, New: next})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffConfig(t *testing.T) {
+	prev := []byte(`{"name":"ns","online":true,"slices":[{"name":"slice-0","capacity":12}],"allowed_dbs":{"db1":true}}`)
+	next := []byte(`{"name":"ns","online":false,"slices":[{"name":"slice-0","capacity":24},{"name":"slice-1"}],"allowed_dbs":{"db2":true},"default_slice":"slice-0"}`)
+
+	diffs, err := DiffConfig(prev, next)
+	if err != nil {
+		t.Fatalf("diff config error: %v", err)
+	}
+	expect := []*ConfigDiff{
+		{Path: "allowed_dbs.db1", Type: ConfigDiffRemove, Old: true},
+		{Path: "allowed_dbs.db2", Type: ConfigDiffAdd, New: true},
+		{Path: "default_slice", Type: ConfigDiffAdd, New: "slice-0"},
+		{Path: "online", Type: ConfigDiffModify, Old: true, New: false},
+		{Path: "slices[0].capacity", Type: ConfigDiffModify, Old: float64(12), New: float64(24)},
+		{Path: "slices[1]", Type: ConfigDiffAdd, New: map[string]interface{}{"name": "slice-1"}},
+	}
+	if !reflect.DeepEqual(diffs, expect) {
+		t.Errorf("diff not equal, expect: %s, actual: %s", JSONEncode(expect), JSONEncode(diffs))
+	}
+
+	if diffs, err = DiffConfig(next, next); err != nil || len(diffs) != 0 {
+		t.Errorf("same config should have no diff, diffs: %s, err: %v", JSONEncode(diffs), err)
+	}
+
+	diffs, err = DiffConfig(nil, []byte(`{"name":"ns"}`))
+	if err != nil || len(diffs) != 1 || diffs[0].Type != ConfigDiffAdd || diffs[0].Path != "name" {
+		t.Errorf("created config diff error, diffs: %s, err: %v", JSONEncode(diffs), err)
+	}
+
+	if _, err = DiffConfig([]byte("{"), next); err == nil {
+		t.Errorf("invalid config should return error")
+	}
+}
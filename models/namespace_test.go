@@ -16,6 +16,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -678,6 +679,128 @@ func TestVerifyShardRules_Error_ShardGlobal(t *testing.T) {
 	}
 }
 
+func TestVerifyMaintenance_Success(t *testing.T) {
+	n := defaultNamespace()
+	n.MaintenanceWindows = []*MaintenanceWindow{{Start: "2020-01-01 01:00:00", End: "2020-01-01 03:00:00"}}
+	n.ReadOnlyExceptTables = []string{"db1.tbl1", " db1.tbl2 "}
+	if err := n.verifyMaintenance(); err != nil {
+		t.Errorf("test verifyMaintenance failed, %v", err)
+	}
+}
+
+func TestVerifyMaintenance_Error(t *testing.T) {
+	windows := []*MaintenanceWindow{
+		{Start: "2020-01-01 03:00:00", End: "2020-01-01 01:00:00"},
+		{Start: "2020-01-01", End: "2020-01-01 01:00:00"},
+		{Start: "2020-01-01 01:00:00", End: ""},
+	}
+	for _, w := range windows {
+		nf := defaultNamespace()
+		nf.MaintenanceWindows = []*MaintenanceWindow{w}
+		if err := nf.verifyMaintenance(); err == nil {
+			t.Errorf("test verifyMaintenance should fail but pass, window: %s", JSONEncode(w))
+		}
+	}
+
+	nf := defaultNamespace()
+	nf.ReadOnlyExceptTables = []string{"tbl1"}
+	if err := nf.verifyMaintenance(); err == nil {
+		t.Errorf("test verifyMaintenance should fail but pass, tables: %v", nf.ReadOnlyExceptTables)
+	}
+}
+
+func TestVerifyMaterializedViews(t *testing.T) {
+	n := defaultNamespace()
+	n.AllowedDBS["db1"] = true
+	n.MaterializedViews = []*MaterializedView{{DB: "db1", Name: "v1", SQL: "select count(*) from tbl1"}}
+	if err := n.verifyMaterializedViews(); err != nil {
+		t.Errorf("test verifyMaterializedViews failed, %v", err)
+	}
+
+	views := [][]*MaterializedView{
+		{{DB: "db1", SQL: "select 1"}},
+		{{DB: "db2", Name: "v1", SQL: "select 1"}},
+		{{DB: "db1", Name: "v1", SQL: "delete from tbl1"}},
+		{{DB: "db1", Name: "v1", SQL: "select 1"}, {DB: "db1", Name: "v1", SQL: "select 2"}},
+	}
+	for _, v := range views {
+		n.MaterializedViews = v
+		if err := n.verifyMaterializedViews(); err == nil {
+			t.Errorf("test verifyMaterializedViews should fail but pass, views: %s", JSONEncode(v))
+		}
+	}
+}
+
+func TestVerifyViews(t *testing.T) {
+	n := defaultNamespace()
+	n.AllowedDBS["db1"] = true
+	n.Views = []*View{{DB: "db1", Name: "v1", SQL: "select id, name from tbl1 where status = 1"}}
+	if err := n.verifyViews(); err != nil {
+		t.Errorf("test verifyViews failed, %v", err)
+	}
+
+	views := [][]*View{
+		{{DB: "db1", SQL: "select 1"}},
+		{{DB: "db2", Name: "v1", SQL: "select 1"}},
+		{{DB: "db1", Name: "v1", SQL: "update tbl1 set a = 1"}},
+		{{DB: "db1", Name: "v1", SQL: "select 1"}, {DB: "db1", Name: "v1", SQL: "select 2"}},
+	}
+	for _, v := range views {
+		n.Views = v
+		if err := n.verifyViews(); err == nil {
+			t.Errorf("test verifyViews should fail but pass, views: %s", JSONEncode(v))
+		}
+	}
+
+	n.Views = []*View{{DB: "db1", Name: "v1", SQL: "select 1"}}
+	n.MaterializedViews = []*MaterializedView{{DB: "db1", Name: "v1", SQL: "select 1"}}
+	if err := n.verifyViews(); err == nil {
+		t.Errorf("test verifyViews should fail when conflicts with materialized view")
+	}
+}
+
+func TestVerifyResultTransforms(t *testing.T) {
+	n := defaultNamespace()
+	n.ResultTransforms = []*ResultTransform{{
+		DB:      "db1",
+		Table:   "tbl1",
+		Compute: []*ComputedColumn{{Name: "c", Expr: "{a}-{ b }"}},
+		Drop:    []string{"d"},
+		Rename:  map[string]string{"e": "f"},
+	}}
+	if err := n.verifyResultTransforms(); err != nil {
+		t.Errorf("test verifyResultTransforms failed, %v", err)
+	}
+
+	transforms := []*ResultTransform{
+		{Table: "tbl1", Drop: []string{"d"}},
+		{DB: "db1", Table: "tbl1"},
+		{DB: "db1", Table: "tbl1", Compute: []*ComputedColumn{{Expr: "{a}"}}},
+		{DB: "db1", Table: "tbl1", Compute: []*ComputedColumn{{Name: "c", Expr: "{a"}}},
+		{DB: "db1", Table: "tbl1", Compute: []*ComputedColumn{{Name: "c", Expr: "a}"}}},
+		{DB: "db1", Table: "tbl1", Compute: []*ComputedColumn{{Name: "c", Expr: "{}"}}},
+		{DB: "db1", Table: "tbl1", Rename: map[string]string{"e": ""}},
+	}
+	for _, tr := range transforms {
+		n.ResultTransforms = []*ResultTransform{tr}
+		if err := n.verifyResultTransforms(); err == nil {
+			t.Errorf("test verifyResultTransforms should fail but pass, transform: %s", JSONEncode(tr))
+		}
+	}
+}
+
+func TestParseComputedExpr(t *testing.T) {
+	parts, columns, err := ParseComputedExpr("id:{id}, name:{ name }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectParts := []string{"id:", "", ", name:", ""}
+	expectColumns := []string{"", "id", "", "name"}
+	if !reflect.DeepEqual(parts, expectParts) || !reflect.DeepEqual(columns, expectColumns) {
+		t.Errorf("parse computed expr not match, parts: %q, columns: %q", parts, columns)
+	}
+}
+
 func TestNamespace_Verify(t *testing.T) {
 	nsStr := `
 {
@@ -980,3 +1103,125 @@ func TestNamespace_Verify(t *testing.T) {
 		t.Errorf("namespace verify failed, err: %v", err)
 	}
 }
+
+func TestVerifyShardPreviousVersion(t *testing.T) {
+	cutover := int64(100)
+	previous := func() *Shard {
+		return &Shard{Type: ShardMod, Locations: []int{2}, Slices: []string{"slice-0"}}
+	}
+	tests := []struct {
+		shard  *Shard
+		hasErr bool
+	}{
+		{&Shard{Table: "t", PreviousVersion: previous(), EffectiveFrom: "2020-01-01 00:00:00", TransitionEnd: "2020-02-01 00:00:00"}, false},
+		{&Shard{Table: "t", PreviousVersion: previous(), CutoverKey: &cutover}, false},
+		{&Shard{Table: "t", PreviousVersion: previous()}, true},
+		{&Shard{Table: "t", PreviousVersion: previous(), EffectiveFrom: "2020-01-01 00:00:00", CutoverKey: &cutover}, true},
+		{&Shard{Table: "t", PreviousVersion: previous(), EffectiveFrom: "2020-01-01"}, true},
+		{&Shard{Table: "t", PreviousVersion: previous(), EffectiveFrom: "2020-01-01 00:00:00", TransitionEnd: "2019-01-01 00:00:00"}, true},
+		{&Shard{Table: "t", PreviousVersion: &Shard{Table: "t2", Type: ShardMod, Locations: []int{2}, Slices: []string{"slice-0"}}, CutoverKey: &cutover}, true},
+		{&Shard{Table: "t", EffectiveFrom: "2020-01-01 00:00:00"}, true},
+	}
+	for i, test := range tests {
+		test.shard.Type = ShardMod
+		test.shard.Locations = []int{4}
+		test.shard.Slices = []string{"slice-0"}
+		err := test.shard.verify()
+		if (err != nil) != test.hasErr {
+			t.Errorf("verify previous version not match, index: %d, expect error: %v, err: %v", i, test.hasErr, err)
+		}
+	}
+}
+
+func TestVerifyShardArchive(t *testing.T) {
+	tests := []struct {
+		shard  *Shard
+		hasErr bool
+	}{
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2"}, ArchiveCutoff: "2015"}, false},
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2", "slice-3"}, ArchiveWrite: ArchiveWriteRedirect}, false},
+		{&Shard{Type: ShardMonth, DateRange: []string{"201401-201412", "201501-201512"}, ArchiveSlices: []string{"slice-2"}, ArchiveCutoff: "201503"}, false},
+		{&Shard{Type: ShardYear, ArchiveCutoff: "2015"}, true},
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2", "slice-3", "slice-4"}}, true},
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2"}, ArchiveCutoff: "201503"}, true},
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2"}, ArchiveCutoff: "2014-2015"}, true},
+		{&Shard{Type: ShardYear, ArchiveSlices: []string{"slice-2"}, ArchiveWrite: "allow"}, true},
+		{&Shard{Type: ShardHash, Locations: []int{2, 2}, ArchiveSlices: []string{"slice-2"}}, true},
+	}
+	for i, test := range tests {
+		test.shard.Table = "t"
+		test.shard.Slices = []string{"slice-0", "slice-1"}
+		if test.shard.DateRange == nil && test.shard.Type != ShardHash {
+			test.shard.DateRange = []string{"2014-2015", "2016-2017"}
+		}
+		err := test.shard.verify()
+		if (err != nil) != test.hasErr {
+			t.Errorf("verify archive not match, index: %d, expect error: %v, err: %v", i, test.hasErr, err)
+		}
+	}
+}
+
+func TestVerifyRestoreFlags(t *testing.T) {
+	tests := []struct {
+		flags  *RestoreFlags
+		hasErr bool
+	}{
+		{nil, false},
+		{&RestoreFlags{}, false},
+		{&RestoreFlags{KeywordCase: RestoreKeywordLower, StringQuote: RestoreStringDoubleQuote, NameQuote: RestoreNameDoubleQuote}, false},
+		{&RestoreFlags{KeywordCase: "camel"}, true},
+		{&RestoreFlags{StringQuote: "back"}, true},
+		{&RestoreFlags{NameQuote: "none"}, true},
+	}
+	for i, test := range tests {
+		n := &Namespace{RestoreFlags: test.flags}
+		err := n.verifyRestoreFlags()
+		if (err != nil) != test.hasErr {
+			t.Errorf("verify restore flags not match, index: %d, expect error: %v, err: %v", i, test.hasErr, err)
+		}
+	}
+}
+
+func TestVerifyUnparseablePolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		shards []*Shard
+		hasErr bool
+	}{
+		{"", []*Shard{{}}, false},
+		{UnparseableReject, []*Shard{{}}, false},
+		{UnparseablePassThrough, nil, false},
+		{UnparseablePassThrough, []*Shard{{}}, true},
+		{"default_slice", nil, true},
+	}
+	for i, test := range tests {
+		n := &Namespace{UnparseablePolicy: test.policy, ShardRules: test.shards}
+		err := n.verifyUnparseablePolicy()
+		if (err != nil) != test.hasErr {
+			t.Errorf("verify unparseable policy not match, index: %d, expect error: %v, err: %v", i, test.hasErr, err)
+		}
+	}
+}
+
+func TestVerifyInitSQLs(t *testing.T) {
+	tests := []struct {
+		sqls   []string
+		hasErr bool
+	}{
+		{nil, false},
+		{[]string{"SET time_zone = '+00:00'", "set session group_concat_max_len = 102400"}, false},
+		{[]string{"SET sql_mode = 'STRICT_TRANS_TABLES'"}, false},
+		{[]string{"SELECT 1"}, true},
+		{[]string{"SET"}, true},
+		{[]string{"SET time_zone = '+00:00';"}, true},
+		{[]string{"SET autocommit = 0"}, true},
+		{[]string{"SET @@session.AUTOCOMMIT = 0"}, true},
+	}
+	for i, test := range tests {
+		n := &Namespace{InitSQLs: test.sqls}
+		err := n.verifyInitSQLs()
+		if (err != nil) != test.hasErr {
+			t.Errorf("verify init sqls not match, index: %d, expect error: %v, err: %v", i, test.hasErr, err)
+		}
+	}
+}
@@ -52,6 +52,77 @@ type Proxy struct {
 	SlowSQLTime    int64  `yaml:"slow-sql_time"`
 	SessionTimeout int    `yaml:"session-timeout"`
 
+	// 管理接口RBAC, admin-user通过basic auth认证, 始终为admin角色
+	AdminTokens    string `ini:"admin_tokens" yaml:"admin-tokens"`         // name:role:token, 多个用逗号分隔, 通过Authorization: Bearer <token>认证
+	AdminTLSCert   string `ini:"admin_tls_cert" yaml:"admin-tls-cert"`     // 管理接口https证书, 为空时使用http
+	AdminTLSKey    string `ini:"admin_tls_key" yaml:"admin-tls-key"`       // 管理接口https私钥
+	AdminTLSCA     string `ini:"admin_tls_ca" yaml:"admin-tls-ca"`         // 校验客户端证书的CA, 配置后支持mTLS认证
+	AdminCertRoles string `ini:"admin_cert_roles" yaml:"admin-cert-roles"` // common_name:role, 多个用逗号分隔, 客户端证书CN对应的角色
+
+	// 前端连接读写超时, 单位: 秒, 0表示不限制
+	ConnReadTimeout          int `ini:"conn_read_timeout" yaml:"conn-read-timeout"`                     // 收到包头后读取单个包的超时时间
+	ConnWriteTimeout         int `ini:"conn_write_timeout" yaml:"conn-write-timeout"`                   // 写入单个包的超时时间
+	IdleInTransactionTimeout int `ini:"idle_in_transaction_timeout" yaml:"idle-in-transaction-timeout"` // 事务中空闲超时时间, 超时后回滚事务并关闭会话
+	ClientCheckInterval      int `ini:"client_check_interval" yaml:"client-check-interval"`             // 单位: 毫秒, 执行命令期间检测客户端断开的间隔, 0使用默认值1000, -1关闭
+	ShutdownDrainTimeout     int `ini:"shutdown_drain_timeout" yaml:"shutdown-drain-timeout"`           // 单位: 秒, 退出时等待进行中的事务结束的时间, 0不等待
+
+	// 跨分片提交超过该时间未完成视为挂起, 单位: 毫秒, 0使用默认值5000, -1关闭检测
+	CommitHangThreshold int `ini:"commit_hang_threshold" yaml:"commit-hang-threshold"`
+
+	// 事务持续超过该时间视为长事务, 输出日志, 单位: 毫秒, 0使用默认值10000, -1关闭
+	LongTransactionTime int `ini:"long_transaction_time" yaml:"long-transaction-time"`
+
+	// 前端连接写合并, 可被namespace配置覆盖, 可通过管理接口在运行时修改
+	WriteBufferSize int `ini:"write_buffer_size" yaml:"write-buffer-size"` // 单位: 字节, 结果集合并写的缓冲区大小, 0使用默认值16384, -1不合并
+	FlushDelay      int `ini:"flush_delay" yaml:"flush-delay"`             // 单位: 毫秒, 缓冲数据超过该时间未写出时写出, 0只在缓冲区满或结果写完时写出
+
+	// mariadb客户端兼容模式
+	MariaDBCompat bool `ini:"mariadb_compat" yaml:"mariadb-compat"`
+
+	// SELECT ... INTO OUTFILE写入的本地目录, 为空时禁止
+	OutfileDir string `ini:"outfile_dir" yaml:"outfile-dir"`
+
+	// 诊断包目录, SET gaea_diagnostic_bundle生成的诊断包写入该目录, 为空时禁止
+	DiagnosticDir string `ini:"diagnostic_dir" yaml:"diagnostic-dir"`
+
+	// 客户端连接支持的压缩协议, zlib、zstd, 多个用逗号分隔, 为空时不支持压缩
+	ProtocolCompressionAlgorithms string `ini:"protocol_compression_algorithms" yaml:"protocol-compression-algorithms"`
+
+	// 流量录制目录, 管理接口/capture/start的path参数为该目录下的相对路径, 为空时禁止录制
+	CaptureDir string `ini:"capture_dir" yaml:"capture-dir"`
+
+	// 连接池校验语句(SELECT 1)由gaea直接返回, 不生成执行计划也不访问后端
+	HealthCheckFastPath bool `ini:"health_check_fast_path" yaml:"health-check-fast-path"`
+
+	// 状态快照文件, 退出时保存SQL指纹等重建成本高的状态, 启动时恢复, 为空时不保存
+	StateSnapshotPath string `ini:"state_snapshot_path" yaml:"state-snapshot-path"`
+
+	// 客户端连接TCP参数
+	TCPKeepAlivePeriod int    `ini:"tcp_keepalive_period" yaml:"tcp-keepalive-period"`   // 单位: 秒, 0使用系统默认值, -1关闭keepalive
+	TCPNoDelay         string `ini:"tcp_nodelay" yaml:"tcp-nodelay"`                     // 为空时默认true
+	TCPReadBufferSize  int    `ini:"tcp_read_buffer_size" yaml:"tcp-read-buffer-size"`   // 单位: 字节, 0使用系统默认值
+	TCPWriteBufferSize int    `ini:"tcp_write_buffer_size" yaml:"tcp-write-buffer-size"` // 单位: 字节, 0使用系统默认值
+
+	// 前端连接处理goroutine限制
+	MaxConnWorkers   int `ini:"max_conn_workers" yaml:"max-conn-workers"`     // 同时处理的连接数上限, 0表示不限制
+	ConnQueueSize    int `ini:"conn_queue_size" yaml:"conn-queue-size"`       // 超出上限后允许排队的连接数, 0表示直接拒绝
+	ConnQueueTimeout int `ini:"conn_queue_timeout" yaml:"conn-queue-timeout"` // 单位: 毫秒, 排队等待超时时间, 0使用默认值1000
+
+	// 认证通过的前端连接数上限, 0表示不限制
+	MaxConnections        int `ini:"max_connections" yaml:"max-connections"`                   // 连接总数上限, 超出时返回ER_CON_COUNT_ERROR
+	MaxConnectionsPerUser int `ini:"max_connections_per_user" yaml:"max-connections-per-user"` // 每个用户的连接数上限, 超出时返回ER_TOO_MANY_USER_CONNECTIONS
+
+	// 前端用户来源, 默认使用namespace配置中的users
+	UserProvider        string `ini:"user_provider" yaml:"user-provider"`                 // static, http或ldap, 为空时为static
+	UserProviderURL     string `ini:"user_provider_url" yaml:"user-provider-url"`         // http: 查询用户的回调地址; ldap: ldap://host:389或ldaps://host:636
+	UserProviderTimeout int    `ini:"user_provider_timeout" yaml:"user-provider-timeout"` // 单位: 毫秒, 调用外部身份系统的超时时间, 0使用默认值3000
+	LDAPBindDN          string `ini:"ldap_bind_dn" yaml:"ldap-bind-dn"`                   // 绑定DN模板, %s替换为用户名, 如uid=%s,ou=people,dc=example,dc=com
+	LDAPNamespace       string `ini:"ldap_namespace" yaml:"ldap-namespace"`               // LDAP认证通过的用户所属的namespace
+
+	// PROXY protocol配置
+	ProxyProtocolNetworks      string `ini:"proxy_protocol_networks" yaml:"proxy-protocol-networks"`             // 发送PROXY protocol头的负载均衡地址, IP或CIDR, 多个用逗号分隔, *表示所有地址, 为空时关闭
+	ProxyProtocolHeaderTimeout int    `ini:"proxy_protocol_header_timeout" yaml:"proxy-protocol-header-timeout"` // 单位: 秒, 读取PROXY protocol头的超时时间, 0使用默认值5
+
 	// 监控配置
 	StatsEnabled  string `yaml:"stats-enabled"`  // set true to enable stats
 	StatsInterval int    `yaml:"stats-interval"` // set stats interval of connect pool
@@ -0,0 +1,59 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "fmt"
+
+// restore flags option values
+const (
+	RestoreKeywordUpper = "upper"
+	RestoreKeywordLower = "lower"
+
+	RestoreStringSingleQuote = "single"
+	RestoreStringDoubleQuote = "double"
+
+	RestoreNameBackQuote   = "backquote"
+	RestoreNameDoubleQuote = "double"
+)
+
+// RestoreFlags means how proxy regenerates SQL sent to backends
+// 未配置的字段使用默认值, 默认生成的SQL为: 关键字大写, 字符串单引号并转义反斜杠, 名称使用反引号
+type RestoreFlags struct {
+	KeywordCase                 string `json:"keyword_case"`                   // 关键字大小写, upper或lower
+	StringQuote                 string `json:"string_quote"`                   // 字符串引号, single或double
+	NoEscapeBackslash           bool   `json:"no_escape_backslash"`            // true: 不转义字符串中的反斜杠, 用于开启NO_BACKSLASH_ESCAPES的后端
+	NameQuote                   string `json:"name_quote"`                     // 库表列名引号, backquote或double, double仅用于开启ANSI_QUOTES的后端
+	SpacesAroundBinaryOperation bool   `json:"spaces_around_binary_operation"` // 二元运算符两侧添加空格
+	PreserveLiterals            bool   `json:"preserve_literals"`              // true: 字符串、十六进制和二进制常量按原始SQL中的写法生成, 不重新转义
+}
+
+func (r *RestoreFlags) verify() error {
+	switch r.KeywordCase {
+	case "", RestoreKeywordUpper, RestoreKeywordLower:
+	default:
+		return fmt.Errorf("invalid keyword_case: %s", r.KeywordCase)
+	}
+	switch r.StringQuote {
+	case "", RestoreStringSingleQuote, RestoreStringDoubleQuote:
+	default:
+		return fmt.Errorf("invalid string_quote: %s", r.StringQuote)
+	}
+	switch r.NameQuote {
+	case "", RestoreNameBackQuote, RestoreNameDoubleQuote:
+	default:
+		return fmt.Errorf("invalid name_quote: %s", r.NameQuote)
+	}
+	return nil
+}
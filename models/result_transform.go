@@ -0,0 +1,94 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResultTransform means rule to transform result set of select statements on specific table, useful during schema migration
+type ResultTransform struct {
+	DB      string            `json:"db"`      // 逻辑库名
+	Table   string            `json:"table"`   // 逻辑表名, 查询包含该表时生效
+	Users   []string          `json:"users"`   // 生效的用户, 为空表示所有用户
+	Compute []*ComputedColumn `json:"compute"` // 追加计算列, 先于删除和重命名执行
+	Drop    []string          `json:"drop"`    // 删除的列
+	Rename  map[string]string `json:"rename"`  // 列重命名, key: 原列名, value: 新列名
+}
+
+// ComputedColumn means column computed from other columns of the same row
+type ComputedColumn struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"` // 模板, 通过{column}引用结果集中的列, 引用的列为NULL时结果为NULL
+}
+
+// ParseComputedExpr split expr of computed column into literals and column references, columns[i] is empty if parts[i] is literal
+func ParseComputedExpr(expr string) (parts []string, columns []string, err error) {
+	for len(expr) > 0 {
+		start := strings.IndexByte(expr, '{')
+		if start < 0 {
+			if strings.IndexByte(expr, '}') >= 0 {
+				return nil, nil, fmt.Errorf("unmatched } in expr")
+			}
+			parts = append(parts, expr)
+			columns = append(columns, "")
+			break
+		}
+		if strings.IndexByte(expr[:start], '}') >= 0 {
+			return nil, nil, fmt.Errorf("unmatched } in expr")
+		}
+		end := strings.IndexByte(expr[start:], '}')
+		if end < 0 {
+			return nil, nil, fmt.Errorf("unmatched { in expr")
+		}
+		end += start
+		column := strings.TrimSpace(expr[start+1 : end])
+		if column == "" || strings.IndexByte(column, '{') >= 0 {
+			return nil, nil, fmt.Errorf("invalid column reference in expr")
+		}
+		if start > 0 {
+			parts = append(parts, expr[:start])
+			columns = append(columns, "")
+		}
+		parts = append(parts, "")
+		columns = append(columns, column)
+		expr = expr[end+1:]
+	}
+	return parts, columns, nil
+}
+
+func (t *ResultTransform) verify() error {
+	if t.DB == "" || t.Table == "" {
+		return fmt.Errorf("must specify db and table of result transform")
+	}
+	if len(t.Compute) == 0 && len(t.Drop) == 0 && len(t.Rename) == 0 {
+		return fmt.Errorf("result transform of %s.%s is empty", t.DB, t.Table)
+	}
+	for _, c := range t.Compute {
+		if c.Name == "" {
+			return fmt.Errorf("must specify name of computed column, table: %s.%s", t.DB, t.Table)
+		}
+		if _, _, err := ParseComputedExpr(c.Expr); err != nil {
+			return fmt.Errorf("invalid expr of computed column %s: %v", c.Name, err)
+		}
+	}
+	for from, to := range t.Rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("invalid rename of result transform, table: %s.%s", t.DB, t.Table)
+		}
+	}
+	return nil
+}
@@ -14,6 +14,11 @@
 
 package models
 
+import "errors"
+
+// ErrSequenceSegmentConflict means sequence segment record was updated by others
+var ErrSequenceSegmentConflict = errors.New("sequence segment record conflict")
+
 // GlobalSequence means source of global sequences with different types
 type GlobalSequence struct {
 	DB        string `json:"db"`
@@ -27,3 +32,18 @@ type GlobalSequence struct {
 func (p *GlobalSequence) Encode() []byte {
 	return JSONEncode(p)
 }
+
+// SequenceSegment 序列号号段分配记录, 持久化到配置中心, 防止proxy重启或脑裂后重复发号
+type SequenceSegment struct {
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Max        int64  `json:"max"`         // 已分配号段的最大值, 之后发出的序列号必须大于该值
+	Epoch      int64  `json:"epoch"`       // 每次更新递增, 作为fencing token
+	Owner      string `json:"owner"`       // 最后一次分配号段的proxy
+	UpdateTime int64  `json:"update_time"` // unix时间戳, 单位: 秒
+}
+
+// Encode means encode for easy use
+func (p *SequenceSegment) Encode() []byte {
+	return JSONEncode(p)
+}
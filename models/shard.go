@@ -17,8 +17,11 @@ package models
 import (
 	"fmt"
 	"github.com/XiaoMi/Gaea/core/errors"
+	"path"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // constants of shard type
@@ -63,6 +66,7 @@ type Shard struct {
 	Slices        []string `json:"slices"`
 	DateRange     []string `json:"date_range"`
 	TableRowLimit int      `json:"table_row_limit"`
+	Extends       string   `json:"extends"` // 继承的基础规则名称, 加载时展开, 未配置的字段使用基础规则中的值
 
 	// only used in mycat logic database (schema)
 	Databases []string `json:"databases"`
@@ -83,15 +87,180 @@ type Shard struct {
 	PadLength string `json:"pad_length"`
 	ModBegin  string `json:"mod_begin"`
 	ModEnd    string `json:"mod_end"`
+
+	// 规则版本, 用于不迁移存量数据更换分片算法, 两个版本的同一个分表必须位于相同的slice和物理库
+	PreviousVersion *Shard `json:"previous_version"` // 上一版本的规则, db、table、key与当前规则相同
+	EffectiveFrom   string `json:"effective_from"`   // 当前规则生效时间, 格式: 2006-01-02 15:04:05, 之后写入按当前规则路由, 查询同时路由到两个版本
+	TransitionEnd   string `json:"transition_end"`   // 过渡期结束时间, 之后只按当前规则路由, 为空时一直同时查询两个版本
+	CutoverKey      *int64 `json:"cutover_key"`      // 按分片键切换, 分片键大于等于该值的按当前规则路由, 小于该值的按上一版本路由, 与effective_from二选一
+
+	// 归档, 仅用于按日期分表的规则, 早于archive_cutoff的分表位于归档slice
+	ArchiveSlices []string `json:"archive_slices"` // 归档slice, 数量为1或与slices相同, 相同时slices[i]上的分表归档到archive_slices[i]
+	ArchiveCutoff string   `json:"archive_cutoff"` // 与分表粒度相同的日期, 如date_month规则为201901, 为空时不归档, 可通过管理接口在运行时修改
+	ArchiveWrite  string   `json:"archive_write"`  // 对归档分表的写入: reject(默认)拒绝, redirect写入归档slice
+}
+
+// DefaultShardRule 默认分片模板, 所有逻辑库中表名匹配tables且没有单独配置规则的表按rule分片
+type DefaultShardRule struct {
+	Tables []string `json:"tables"` // 表名模式, 支持通配符*和?, 如t_log_*
+	Rule   *Shard   `json:"rule"`   // 分片规则, 忽略db和table
+}
+
+func (d *DefaultShardRule) verify() error {
+	if len(d.Tables) == 0 {
+		return fmt.Errorf("default shard rule: tables is empty")
+	}
+	if d.Rule == nil {
+		return fmt.Errorf("default shard rule: rule is empty")
+	}
+	for _, t := range d.Tables {
+		if err := verifyTablePattern(t); err != nil {
+			return fmt.Errorf("default shard rule: %v", err)
+		}
+	}
+	if d.Rule.Type == ShardDefault || d.Rule.Type == ShardLinked {
+		return fmt.Errorf("default shard rule: %s rule could not be used as template", d.Rule.Type)
+	}
+	rule := *d.Rule
+	rule.Table = d.Tables[0]
+	return rule.verify()
+}
+
+// IsTablePattern check if table name of shard rule contains wildcard * or ?, matched tables use the same rule
+func IsTablePattern(table string) bool {
+	return strings.ContainsAny(table, "*?")
+}
+
+func verifyTablePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("table pattern is empty")
+	}
+	if _, err := path.Match(strings.ToLower(pattern), ""); err != nil {
+		return fmt.Errorf("invalid table pattern %s: %v", pattern, err)
+	}
+	return nil
 }
 
+// RuleVersionTimeFormat format of effective_from and transition_end
+const RuleVersionTimeFormat = "2006-01-02 15:04:05"
+
+// constants of archive_write
+const (
+	ArchiveWriteReject   = "reject"
+	ArchiveWriteRedirect = "redirect"
+)
+
 func (s *Shard) verify() error {
+	if IsTablePattern(s.Table) {
+		if err := verifyTablePattern(s.Table); err != nil {
+			return err
+		}
+		if s.PreviousVersion != nil || len(s.ArchiveSlices) != 0 {
+			return fmt.Errorf("table %s: table pattern could not be used with versioned or archived rule", s.Table)
+		}
+	}
 	if err := s.verifyRuleSliceInfos(); err != nil {
 		return err
 	}
+	if err := s.verifyPreviousVersion(); err != nil {
+		return err
+	}
+	if err := s.verifyArchive(); err != nil {
+		return err
+	}
 	return nil
 }
 
+func (s *Shard) verifyArchive() error {
+	if len(s.ArchiveSlices) == 0 {
+		if s.ArchiveCutoff != "" || s.ArchiveWrite != "" {
+			return fmt.Errorf("table %s: archive_cutoff and archive_write require archive_slices", s.Table)
+		}
+		return nil
+	}
+	if s.Type != ShardYear && s.Type != ShardMonth && s.Type != ShardDay {
+		return fmt.Errorf("table %s: only date rule can be archived", s.Table)
+	}
+	if s.PreviousVersion != nil {
+		return fmt.Errorf("table %s: versioned rule can not be archived", s.Table)
+	}
+	if len(s.ArchiveSlices) != 1 && len(s.ArchiveSlices) != len(s.Slices) {
+		return fmt.Errorf("table %s: count of archive_slices must be 1 or the same as slices", s.Table)
+	}
+	if s.ArchiveWrite != "" && s.ArchiveWrite != ArchiveWriteReject && s.ArchiveWrite != ArchiveWriteRedirect {
+		return fmt.Errorf("table %s: invalid archive_write: %s", s.Table, s.ArchiveWrite)
+	}
+	if s.ArchiveCutoff != "" {
+		if _, err := ParseArchiveCutoff(s.Type, s.ArchiveCutoff); err != nil {
+			return fmt.Errorf("table %s: invalid archive_cutoff %s: %v", s.Table, s.ArchiveCutoff, err)
+		}
+	}
+	return nil
+}
+
+// ParseArchiveCutoff parse archive cutoff to table index of date rule
+func ParseArchiveCutoff(ruleType, cutoff string) (int, error) {
+	if strings.Contains(cutoff, "-") {
+		return 0, errors.ErrDateRangeIllegal
+	}
+	var indexes []int
+	var err error
+	switch ruleType {
+	case ShardYear:
+		indexes, err = ParseYearRange(cutoff)
+	case ShardMonth:
+		indexes, err = ParseMonthRange(cutoff)
+	case ShardDay:
+		indexes, err = ParseDayRange(cutoff)
+	default:
+		return 0, errors.ErrUnknownRuleType
+	}
+	if err != nil {
+		return 0, err
+	}
+	return indexes[0], nil
+}
+
+func (s *Shard) verifyPreviousVersion() error {
+	p := s.PreviousVersion
+	if p == nil {
+		if s.EffectiveFrom != "" || s.TransitionEnd != "" || s.CutoverKey != nil {
+			return fmt.Errorf("table %s: effective_from, transition_end and cutover_key require previous_version", s.Table)
+		}
+		return nil
+	}
+	if s.Type == ShardGlobal || p.Type == ShardGlobal || p.Type == ShardLinked || p.Type == ShardDefault {
+		return fmt.Errorf("table %s: global, linked and default rule can not be versioned", s.Table)
+	}
+	if p.PreviousVersion != nil {
+		return fmt.Errorf("table %s: only one previous version is supported", s.Table)
+	}
+	if (p.DB != "" && p.DB != s.DB) || (p.Table != "" && p.Table != s.Table) || (p.Key != "" && p.Key != s.Key) {
+		return fmt.Errorf("table %s: db, table and key of previous version must be the same", s.Table)
+	}
+	if (s.EffectiveFrom == "") == (s.CutoverKey == nil) {
+		return fmt.Errorf("table %s: one of effective_from and cutover_key must be set", s.Table)
+	}
+	if s.EffectiveFrom != "" {
+		effectiveFrom, err := time.ParseInLocation(RuleVersionTimeFormat, s.EffectiveFrom, time.Local)
+		if err != nil {
+			return fmt.Errorf("table %s: invalid effective_from: %v", s.Table, err)
+		}
+		if s.TransitionEnd != "" {
+			transitionEnd, err := time.ParseInLocation(RuleVersionTimeFormat, s.TransitionEnd, time.Local)
+			if err != nil {
+				return fmt.Errorf("table %s: invalid transition_end: %v", s.Table, err)
+			}
+			if !transitionEnd.After(effectiveFrom) {
+				return fmt.Errorf("table %s: transition_end must be after effective_from", s.Table)
+			}
+		}
+	} else if s.TransitionEnd != "" {
+		return fmt.Errorf("table %s: transition_end requires effective_from", s.Table)
+	}
+	return p.verifyRuleSliceInfos()
+}
+
 func (s *Shard) verifyRuleSliceInfos() error {
 	f, ok := ruleVerifyFuncMapping[s.Type]
 	if !ok {
@@ -0,0 +1,182 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BaseShardRule 可被继承的分片规则, 规则通过extends引用, 继承其中的字段并覆盖自身配置的字段.
+// 基础规则也可以通过extends继承其他基础规则, 不包含db和table
+type BaseShardRule struct {
+	Name string `json:"name"`
+	Shard
+}
+
+// ResolveShardRules replace shard rules with extends by resolved copies of base rules,
+// non-zero fields of rule override fields of base rule, extends is kept to show where rule inherits from.
+// base_shard_rules is cleared after resolved
+func (n *Namespace) ResolveShardRules() error {
+	if len(n.BaseShardRules) == 0 && !n.hasExtendedShardRule() {
+		return nil
+	}
+
+	bases := make(map[string]*BaseShardRule, len(n.BaseShardRules))
+	for _, b := range n.BaseShardRules {
+		if b.Name == "" {
+			return fmt.Errorf("name of base shard rule is empty")
+		}
+		if _, ok := bases[b.Name]; ok {
+			return fmt.Errorf("base shard rule %s duplicate", b.Name)
+		}
+		if b.DB != "" || b.Table != "" {
+			return fmt.Errorf("base shard rule %s: db and table should be empty", b.Name)
+		}
+		if b.Type == ShardDefault || b.Type == ShardLinked {
+			return fmt.Errorf("base shard rule %s: %s rule could not be extended", b.Name, b.Type)
+		}
+		bases[b.Name] = b
+	}
+	r := &shardRuleResolver{bases: bases, resolved: make(map[string]*Shard, len(bases))}
+	// 未被引用的基础规则同样检查
+	for _, b := range n.BaseShardRules {
+		if _, err := r.resolveBase(b.Name, nil); err != nil {
+			return err
+		}
+	}
+
+	shardRules, err := r.resolveRules(n.ShardRules)
+	if err != nil {
+		return err
+	}
+	candidateShardRules, err := r.resolveRules(n.CandidateShardRules)
+	if err != nil {
+		return fmt.Errorf("candidate shard rules: %v", err)
+	}
+	if n.DefaultShardRule != nil && n.DefaultShardRule.Rule != nil {
+		rule, err := r.resolve(n.DefaultShardRule.Rule)
+		if err != nil {
+			return fmt.Errorf("default shard rule: %v", err)
+		}
+		defaultShardRule := *n.DefaultShardRule
+		defaultShardRule.Rule = rule
+		n.DefaultShardRule = &defaultShardRule
+	}
+
+	n.ShardRules = shardRules
+	n.CandidateShardRules = candidateShardRules
+	n.BaseShardRules = nil
+	return nil
+}
+
+func (n *Namespace) hasExtendedShardRule() bool {
+	for _, s := range n.ShardRules {
+		if s.Extends != "" {
+			return true
+		}
+	}
+	for _, s := range n.CandidateShardRules {
+		if s.Extends != "" {
+			return true
+		}
+	}
+	return n.DefaultShardRule != nil && n.DefaultShardRule.Rule != nil && n.DefaultShardRule.Rule.Extends != ""
+}
+
+type shardRuleResolver struct {
+	bases    map[string]*BaseShardRule
+	resolved map[string]*Shard // 已展开的基础规则
+}
+
+func (r *shardRuleResolver) resolveRules(rules []*Shard) ([]*Shard, error) {
+	if rules == nil {
+		return nil, nil
+	}
+	resolved := make([]*Shard, 0, len(rules))
+	for _, s := range rules {
+		rs, err := r.resolve(s)
+		if err != nil {
+			return nil, fmt.Errorf("shard table[%s.%s]: %v", s.DB, s.Table, err)
+		}
+		resolved = append(resolved, rs)
+	}
+	return resolved, nil
+}
+
+// resolve return rule itself if it extends nothing, previous version is resolved as well
+func (r *shardRuleResolver) resolve(s *Shard) (*Shard, error) {
+	rs := s
+	if s.Extends != "" {
+		base, err := r.resolveBase(s.Extends, nil)
+		if err != nil {
+			return nil, err
+		}
+		rs = mergeShard(base, s)
+	}
+	if rs.PreviousVersion != nil && rs.PreviousVersion.Extends != "" {
+		previous, err := r.resolve(rs.PreviousVersion)
+		if err != nil {
+			return nil, fmt.Errorf("previous version: %v", err)
+		}
+		if rs == s {
+			copied := *s
+			rs = &copied
+		}
+		rs.PreviousVersion = previous
+	}
+	return rs, nil
+}
+
+// resolveBase visiting records base rules in the extends chain to detect cycle
+func (r *shardRuleResolver) resolveBase(name string, visiting []string) (*Shard, error) {
+	if rs, ok := r.resolved[name]; ok {
+		return rs, nil
+	}
+	b, ok := r.bases[name]
+	if !ok {
+		return nil, fmt.Errorf("base shard rule %s not found", name)
+	}
+	for _, v := range visiting {
+		if v == name {
+			return nil, fmt.Errorf("circular extends of base shard rule: %s", strings.Join(append(visiting, name), " -> "))
+		}
+	}
+
+	rs := &b.Shard
+	if b.Extends != "" {
+		base, err := r.resolveBase(b.Extends, append(visiting, name))
+		if err != nil {
+			return nil, err
+		}
+		rs = mergeShard(base, &b.Shard)
+	}
+	r.resolved[name] = rs
+	return rs, nil
+}
+
+// mergeShard return copy of base with non-zero fields of s, so fields could not be overridden with zero value
+func mergeShard(base, s *Shard) *Shard {
+	rs := *base
+	dst := reflect.ValueOf(&rs).Elem()
+	src := reflect.ValueOf(s).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if f := src.Field(i); !f.IsZero() {
+			dst.Field(i).Set(f)
+		}
+	}
+	return &rs
+}
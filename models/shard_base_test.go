@@ -0,0 +1,86 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testBaseShardRuleNamespace = `{
+	"name": "ns",
+	"slices": [{"name": "slice-0"}, {"name": "slice-1"}],
+	"default_slice": "slice-0",
+	"base_shard_rules": [
+		{"name": "by_user", "type": "mod", "key": "user_id", "locations": [2, 2], "slices": ["slice-0", "slice-1"]},
+		{"name": "by_user_large", "extends": "by_user", "locations": [4, 4]}
+	],
+	"shard_rules": [
+		{"db": "db_ks", "table": "t_order", "extends": "by_user"},
+		{"db": "db_ks", "table": "t_payment", "extends": "by_user_large", "key": "payer_id"},
+		{"db": "db_ks", "table": "t_log", "type": "hash", "key": "id", "locations": [1, 1], "slices": ["slice-0", "slice-1"]}
+	]
+}`
+
+func TestResolveShardRules(t *testing.T) {
+	n := &Namespace{}
+	if err := JSONDecode(n, []byte(testBaseShardRuleNamespace)); err != nil {
+		t.Fatal(err)
+	}
+	log := n.ShardRules[2]
+	if err := n.ResolveShardRules(); err != nil {
+		t.Fatalf("resolve shard rules error: %v", err)
+	}
+
+	expect := []*Shard{
+		{DB: "db_ks", Table: "t_order", Type: "mod", Key: "user_id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}, Extends: "by_user"},
+		{DB: "db_ks", Table: "t_payment", Type: "mod", Key: "payer_id", Locations: []int{4, 4}, Slices: []string{"slice-0", "slice-1"}, Extends: "by_user_large"},
+		log,
+	}
+	if !reflect.DeepEqual(n.ShardRules, expect) {
+		t.Errorf("resolved shard rules, expect: %s, actual: %s", JSONEncode(expect), JSONEncode(n.ShardRules))
+	}
+	if n.ShardRules[2] != log {
+		t.Errorf("rule without extends should not be copied")
+	}
+	if n.BaseShardRules != nil {
+		t.Errorf("base shard rules should be cleared after resolved")
+	}
+	if err := n.verifyShardRules(); err != nil {
+		t.Errorf("verify resolved shard rules error: %v", err)
+	}
+}
+
+func TestResolveShardRulesError(t *testing.T) {
+	tests := []struct {
+		name  string
+		bases []*BaseShardRule
+		rule  *Shard
+	}{
+		{"base not found", nil, &Shard{DB: "db", Table: "t", Extends: "by_user"}},
+		{"duplicate base", []*BaseShardRule{{Name: "a"}, {Name: "a"}}, &Shard{DB: "db", Table: "t", Extends: "a"}},
+		{"empty name", []*BaseShardRule{{}}, &Shard{DB: "db", Table: "t"}},
+		{"base with table", []*BaseShardRule{{Name: "a", Shard: Shard{Table: "t"}}}, &Shard{DB: "db", Table: "t", Extends: "a"}},
+		{"linked base", []*BaseShardRule{{Name: "a", Shard: Shard{Type: ShardLinked}}}, &Shard{DB: "db", Table: "t", Extends: "a"}},
+		{"circular extends", []*BaseShardRule{{Name: "a", Shard: Shard{Extends: "b"}}, {Name: "b", Shard: Shard{Extends: "a"}}}, &Shard{DB: "db", Table: "t"}},
+		{"previous version", []*BaseShardRule{{Name: "a"}}, &Shard{DB: "db", Table: "t", Extends: "a", PreviousVersion: &Shard{Extends: "b"}}},
+	}
+	for _, test := range tests {
+		n := &Namespace{BaseShardRules: test.bases, ShardRules: []*Shard{test.rule}}
+		if err := n.ResolveShardRules(); err == nil {
+			t.Errorf("%s: expect resolve error", test.name)
+		}
+	}
+}
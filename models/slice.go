@@ -14,7 +14,11 @@
 
 package models
 
-import "errors"
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
 
 // Slice means source model of slice
 type Slice struct {
@@ -24,10 +28,45 @@ type Slice struct {
 	Master          string   `json:"master"`
 	Slaves          []string `json:"slaves"`
 	StatisticSlaves []string `json:"statistic_slaves"`
+	EndpointPolicy  string   `json:"endpoint_policy"` // master或slave配置多个逗号分隔的地址时的选择策略: failover(默认), round_robin, random
+
+	// 拓扑发现, 为空时使用配置中的master/slaves; group_replication: 从MGR成员表中发现主库和从库; aurora: 从Aurora拓扑表中发现writer和reader
+	Topology                string `json:"topology"`
+	TopologyRefreshInterval int    `json:"topology_refresh_interval"` // 拓扑刷新间隔, 单位: 秒, 默认1
+	TopologyHostPattern     string `json:"topology_host_pattern"`     // aurora实例地址模板, ?替换为实例ID, 如?.xxx.us-east-1.rds.amazonaws.com:3306, 为空时从master集群地址推导
 
 	Capacity    int `json:"capacity"`     // connection pool capacity
 	MaxCapacity int `json:"max_capacity"` // max connection pool capacity
 	IdleTimeout int `json:"idle_timeout"` // close backend direct connection after idle_timeout,unit: seconds
+
+	// 后端TLS配置, 使用mysql_clear_password认证的后端(如PAM/LDAP)必须开启
+	TLSEnabled    bool   `json:"tls_enabled"`
+	TLSCA         string `json:"tls_ca"`          // CA证书文件路径, 为空时使用系统CA
+	TLSServerName string `json:"tls_server_name"` // 校验证书使用的域名, 为空时使用连接地址中的host
+	TLSSkipVerify bool   `json:"tls_skip_verify"` // 不校验后端证书
+
+	// 后端连接TCP参数
+	TCPKeepAlivePeriod int   `json:"tcp_keepalive_period"`  // 单位: 秒, 0使用系统默认值, -1关闭keepalive
+	TCPNoDelay         *bool `json:"tcp_nodelay"`           // 为空时默认true
+	TCPReadBufferSize  int   `json:"tcp_read_buffer_size"`  // 单位: 字节, 0使用系统默认值
+	TCPWriteBufferSize int   `json:"tcp_write_buffer_size"` // 单位: 字节, 0使用系统默认值
+
+	// 后端域名地址的重新解析, 用于Kubernetes service、DNS切换等ip会变化的场景
+	DNSRefreshInterval int  `json:"dns_refresh_interval"` // 重新解析间隔, 单位: 秒, 0不重新解析
+	DNSDrainRemoved    bool `json:"dns_drain_removed"`    // 关闭连接到已从解析结果中移除的ip的连接
+
+	// 后端连接的拨号方式, 为空时直接连接; socks5://[user:password@]host:port通过SOCKS5代理; ssh://[user@]host[:port]?identity_file=path通过跳板机的ssh隧道
+	Dialer string `json:"dialer"`
+
+	// 后端连接使用压缩协议, 用于跨机房等带宽受限的场景, 会增加proxy和后端的CPU消耗
+	Compress bool `json:"compress"`
+	// 压缩算法, zlib或zstd, 为空时为zlib, 后端不支持zstd(MySQL 8.0.18以下)时使用zlib
+	CompressionAlgorithm string `json:"compression_algorithm"`
+
+	// 后端调用超时, 单位: 毫秒, 超时的连接会被关闭
+	ConnectTimeout   int `json:"connect_timeout"`    // 建立连接(包括握手、认证和初始化语句)的超时时间, 0使用默认值5000
+	FirstByteTimeout int `json:"first_byte_timeout"` // 发送语句后等待第一个响应包的超时时间, 0不限制
+	TotalTimeout     int `json:"total_timeout"`      // 发送语句到读完结果的超时时间, 0不限制
 }
 
 func (s *Slice) verify() error {
@@ -57,5 +96,71 @@ func (s *Slice) verify() error {
 		return errors.New("max connection pool capactiy should be > 0")
 	}
 
+	if !s.TLSEnabled && (s.TLSCA != "" || s.TLSServerName != "" || s.TLSSkipVerify) {
+		return errors.New("tls options require tls_enabled")
+	}
+
+	if s.TCPKeepAlivePeriod < -1 || s.TCPReadBufferSize < 0 || s.TCPWriteBufferSize < 0 {
+		return errors.New("invalid tcp options")
+	}
+
+	switch s.EndpointPolicy {
+	case "", "failover", "round_robin", "random":
+	default:
+		return errors.New("invalid endpoint policy")
+	}
+
+	switch s.Topology {
+	case "", "group_replication", "aurora":
+	default:
+		return errors.New("invalid topology")
+	}
+
+	if s.TopologyRefreshInterval < 0 {
+		return errors.New("invalid topology refresh interval")
+	}
+
+	if s.TopologyHostPattern != "" && !strings.Contains(s.TopologyHostPattern, "?") {
+		return errors.New("topology host pattern must contain ?")
+	}
+
+	if s.DNSRefreshInterval < 0 {
+		return errors.New("invalid dns refresh interval")
+	}
+
+	if s.DNSDrainRemoved && s.DNSRefreshInterval == 0 {
+		return errors.New("dns_drain_removed requires dns_refresh_interval")
+	}
+
+	if s.Dialer != "" && s.DNSRefreshInterval > 0 {
+		return errors.New("dns_refresh_interval is not supported by dialer")
+	}
+
+	if s.Dialer != "" {
+		u, err := url.Parse(s.Dialer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("invalid dialer")
+		}
+		for _, addr := range append(append([]string{s.Master}, s.Slaves...), s.StatisticSlaves...) {
+			if strings.Contains(addr, "/") {
+				return errors.New("dialer is not supported by unix socket")
+			}
+		}
+	}
+
+	switch s.CompressionAlgorithm {
+	case "":
+	case "zlib", "zstd":
+		if !s.Compress {
+			return errors.New("compression_algorithm requires compress")
+		}
+	default:
+		return errors.New("invalid compression algorithm")
+	}
+
+	if s.ConnectTimeout < 0 || s.FirstByteTimeout < 0 || s.TotalTimeout < 0 {
+		return errors.New("invalid timeouts")
+	}
+
 	return nil
 }
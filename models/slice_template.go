@@ -0,0 +1,213 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	sliceTemplateIndexVar = "index"
+	sliceTemplatePortVar  = "port"
+)
+
+// ${name} or ${name:04d}, format is used for integer variables
+var configVarRegexp = regexp.MustCompile(`\$\{(\w+)(?::(\w+))?\}`)
+
+// SliceTemplate generate Count slices with index from Start, ${index} ${port} and config vars in string fields are replaced at load time
+type SliceTemplate struct {
+	Slice
+	Count      int `json:"count"`
+	Start      int `json:"start"`
+	BasePort   int `json:"base_port"`   // ${port} = base_port + (index - start) * port_offset
+	PortOffset int `json:"port_offset"` // 为0时所有slice使用相同端口
+}
+
+// NamespaceEnvironment overrides config vars and slices of namespace for one environment
+type NamespaceEnvironment struct {
+	ConfigVars map[string]string          `json:"config_vars"`
+	Slices     map[string]json.RawMessage `json:"slices"` // key为slice名称, 值中出现的字段覆盖展开后的slice配置
+}
+
+// NamespaceInclude is content of include file, merged into namespace at load time
+type NamespaceInclude struct {
+	ConfigVars     map[string]string `json:"config_vars"`
+	Slices         []*Slice          `json:"slices"`
+	SliceTemplates []*SliceTemplate  `json:"slice_templates"`
+}
+
+// ResolveSlices merge include files, expand slice templates and apply overrides of env,
+// template fields are cleared after resolved so namespace contains only plain slices
+func (n *Namespace) ResolveSlices(env string, readInclude func(name string) ([]byte, error)) error {
+	if len(n.Includes) == 0 && len(n.SliceTemplates) == 0 && len(n.Environments) == 0 && len(n.ConfigVars) == 0 {
+		return nil
+	}
+
+	vars := make(map[string]string)
+	templates := n.SliceTemplates
+	slices := n.Slices
+	for _, name := range n.Includes {
+		data, err := readInclude(name)
+		if err != nil {
+			return fmt.Errorf("read include %s failed: %v", name, err)
+		}
+		include := &NamespaceInclude{}
+		if err := json.Unmarshal(data, include); err != nil {
+			return fmt.Errorf("decode include %s failed: %v", name, err)
+		}
+		for k, v := range include.ConfigVars {
+			vars[k] = v
+		}
+		slices = append(slices, include.Slices...)
+		templates = append(templates, include.SliceTemplates...)
+	}
+	// namespace中的变量优先于include, 环境中的变量优先于namespace
+	for k, v := range n.ConfigVars {
+		vars[k] = v
+	}
+	environment := n.Environments[env]
+	if environment != nil {
+		for k, v := range environment.ConfigVars {
+			vars[k] = v
+		}
+	}
+
+	resolved := make([]*Slice, 0, len(slices))
+	for _, s := range slices {
+		rs, err := resolveSliceVars(s, vars)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, rs)
+	}
+	for _, t := range templates {
+		expanded, err := t.expand(vars)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, expanded...)
+	}
+
+	if environment != nil {
+		byName := make(map[string]*Slice, len(resolved))
+		for _, s := range resolved {
+			byName[s.Name] = s
+		}
+		for name, override := range environment.Slices {
+			s, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("override slice %s of environment %s not found", name, env)
+			}
+			if err := json.Unmarshal(override, s); err != nil {
+				return fmt.Errorf("override slice %s of environment %s failed: %v", name, env, err)
+			}
+		}
+	}
+
+	n.Slices = resolved
+	n.ConfigVars = nil
+	n.SliceTemplates = nil
+	n.Environments = nil
+	n.Includes = nil
+	return nil
+}
+
+func (t *SliceTemplate) expand(vars map[string]string) ([]*Slice, error) {
+	if t.Count <= 0 {
+		return nil, fmt.Errorf("count of slice template %s should be > 0", t.Name)
+	}
+	if !strings.Contains(t.Name, "${"+sliceTemplateIndexVar) {
+		return nil, fmt.Errorf("name of slice template %s should contain ${%s}", t.Name, sliceTemplateIndexVar)
+	}
+	slices := make([]*Slice, 0, t.Count)
+	for i := 0; i < t.Count; i++ {
+		index := t.Start + i
+		sliceVars := make(map[string]string, len(vars)+2)
+		for k, v := range vars {
+			sliceVars[k] = v
+		}
+		sliceVars[sliceTemplateIndexVar] = strconv.Itoa(index)
+		sliceVars[sliceTemplatePortVar] = strconv.Itoa(t.BasePort + i*t.PortOffset)
+		s, err := resolveSliceVars(&t.Slice, sliceVars)
+		if err != nil {
+			return nil, err
+		}
+		slices = append(slices, s)
+	}
+	return slices, nil
+}
+
+// resolveSliceVars return a copy of slice with config vars replaced
+func resolveSliceVars(s *Slice, vars map[string]string) (*Slice, error) {
+	rs := *s
+	var err error
+	replace := func(v string) string {
+		if err != nil {
+			return v
+		}
+		var r string
+		r, err = replaceConfigVars(v, vars)
+		return r
+	}
+	replaceAll := func(vs []string) []string {
+		if vs == nil {
+			return nil
+		}
+		r := make([]string, 0, len(vs))
+		for _, v := range vs {
+			r = append(r, replace(v))
+		}
+		return r
+	}
+
+	rs.Name = replace(s.Name)
+	rs.UserName = replace(s.UserName)
+	rs.Password = replace(s.Password)
+	rs.Master = replace(s.Master)
+	rs.Slaves = replaceAll(s.Slaves)
+	rs.StatisticSlaves = replaceAll(s.StatisticSlaves)
+	rs.TLSServerName = replace(s.TLSServerName)
+	rs.TopologyHostPattern = replace(s.TopologyHostPattern)
+	if err != nil {
+		return nil, fmt.Errorf("resolve slice %s failed: %v", s.Name, err)
+	}
+	return &rs, nil
+}
+
+func replaceConfigVars(s string, vars map[string]string) (string, error) {
+	var err error
+	r := configVarRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sub := configVarRegexp.FindStringSubmatch(m)
+		v, ok := vars[sub[1]]
+		if !ok {
+			err = fmt.Errorf("unknown config var: %s", sub[1])
+			return m
+		}
+		if sub[2] == "" {
+			return v
+		}
+		n, e := strconv.ParseInt(v, 10, 64)
+		if e != nil {
+			err = fmt.Errorf("config var %s with format should be integer: %s", sub[1], v)
+			return m
+		}
+		return fmt.Sprintf("%"+sub[2], n)
+	})
+	return r, err
+}
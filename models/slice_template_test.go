@@ -0,0 +1,147 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+const testSliceTemplateNamespace = `{
+	"config_vars": {"env": "test", "user": "root"},
+	"includes": ["common.json"],
+	"slice_templates": [{
+		"name": "slice-${index}",
+		"user_name": "${user}",
+		"password": "${password}",
+		"master": "mysql-${index:02d}.${env}.example.com:${port}",
+		"slaves": ["mysql-${index:02d}-ro.${env}.example.com:${port}@2"],
+		"capacity": 16,
+		"max_capacity": 32,
+		"count": 3,
+		"start": 1,
+		"base_port": 3306,
+		"port_offset": 10
+	}],
+	"environments": {
+		"prod": {
+			"config_vars": {"env": "prod", "user": "gaea"},
+			"slices": {"slice-2": {"capacity": 64, "slaves": []}}
+		}
+	}
+}`
+
+const testSliceTemplateInclude = `{
+	"config_vars": {"password": "secret", "env": "include"},
+	"slices": [{"name": "slice-0", "user_name": "${user}", "password": "${password}", "master": "mysql-0.${env}.example.com:3306", "capacity": 8, "max_capacity": 8}]
+}`
+
+func resolveTestSliceTemplate(t *testing.T, env string) *Namespace {
+	n := &Namespace{}
+	if err := JSONDecode(n, []byte(testSliceTemplateNamespace)); err != nil {
+		t.Fatal(err)
+	}
+	readInclude := func(name string) ([]byte, error) {
+		if name != "common.json" {
+			return nil, fmt.Errorf("include %s not found", name)
+		}
+		return []byte(testSliceTemplateInclude), nil
+	}
+	if err := n.ResolveSlices(env, readInclude); err != nil {
+		t.Fatal(err)
+	}
+	if n.SliceTemplates != nil || n.Environments != nil || n.Includes != nil || n.ConfigVars != nil {
+		t.Error("template fields should be cleared after resolved")
+	}
+	return n
+}
+
+func TestResolveSliceTemplates(t *testing.T) {
+	n := resolveTestSliceTemplate(t, "")
+	if len(n.Slices) != 4 {
+		t.Fatalf("slice count not match, expect: 4, actual: %d", len(n.Slices))
+	}
+
+	// namespace中的变量优先于include
+	s := n.Slices[0]
+	if s.Name != "slice-0" || s.UserName != "root" || s.Password != "secret" || s.Master != "mysql-0.test.example.com:3306" {
+		t.Errorf("included slice not match: %+v", s)
+	}
+	for i, s := range n.Slices[1:] {
+		index := i + 1
+		master := fmt.Sprintf("mysql-%02d.test.example.com:%d", index, 3306+i*10)
+		slave := fmt.Sprintf("mysql-%02d-ro.test.example.com:%d@2", index, 3306+i*10)
+		if s.Name != fmt.Sprintf("slice-%d", index) || s.Master != master || len(s.Slaves) != 1 || s.Slaves[0] != slave {
+			t.Errorf("expanded slice not match, index: %d, slice: %+v", index, s)
+		}
+		if s.UserName != "root" || s.Password != "secret" || s.Capacity != 16 || s.MaxCapacity != 32 {
+			t.Errorf("expanded slice fields not match, index: %d, slice: %+v", index, s)
+		}
+	}
+}
+
+func TestResolveSliceTemplatesEnvironment(t *testing.T) {
+	n := resolveTestSliceTemplate(t, "prod")
+	if n.Slices[1].Master != "mysql-01.prod.example.com:3306" || n.Slices[1].UserName != "gaea" {
+		t.Errorf("environment vars not applied: %+v", n.Slices[1])
+	}
+	s := n.Slices[2]
+	if s.Capacity != 64 || len(s.Slaves) != 0 || s.MaxCapacity != 32 {
+		t.Errorf("environment override not applied: %+v", s)
+	}
+	if n.Slices[3].Capacity != 16 {
+		t.Errorf("other slices should not be overridden: %+v", n.Slices[3])
+	}
+}
+
+func TestResolveSliceTemplatesError(t *testing.T) {
+	tests := []string{
+		`{"slice_templates": [{"name": "slice-${index}", "master": "${unknown}:3306", "count": 1}]}`,
+		`{"slice_templates": [{"name": "slice", "master": "127.0.0.1:3306", "count": 2}]}`,
+		`{"slice_templates": [{"name": "slice-${index}", "master": "127.0.0.1:3306", "count": 0}]}`,
+		`{"config_vars": {"env": "test"}, "slices": [{"name": "slice-${env:02d}"}]}`,
+		`{"environments": {"prod": {"slices": {"slice-9": {"capacity": 1}}}}, "slices": [{"name": "slice-0"}]}`,
+		`{"includes": ["missing.json"]}`,
+	}
+	readInclude := func(name string) ([]byte, error) {
+		return nil, fmt.Errorf("include %s not found", name)
+	}
+	for _, test := range tests {
+		n := &Namespace{}
+		if err := JSONDecode(n, []byte(test)); err != nil {
+			t.Fatal(err)
+		}
+		if err := n.ResolveSlices("prod", readInclude); err == nil {
+			t.Errorf("expect error: %s", test)
+		}
+	}
+}
+
+func TestEncryptSliceTemplates(t *testing.T) {
+	key := "1234abcd5678efg*"
+	n := &Namespace{SliceTemplates: []*SliceTemplate{{Slice: Slice{UserName: "root", Password: "${password}"}}}}
+	if err := n.Encrypt(key); err != nil {
+		t.Fatal(err)
+	}
+	if n.SliceTemplates[0].Password == "${password}" {
+		t.Error("password of slice template should be encrypted")
+	}
+	if err := n.Decrypt(key); err != nil {
+		t.Fatal(err)
+	}
+	if n.SliceTemplates[0].UserName != "root" || n.SliceTemplates[0].Password != "${password}" {
+		t.Errorf("decrypt slice template failed: %+v", n.SliceTemplates[0].Slice)
+	}
+}
@@ -47,6 +47,7 @@ type User struct {
 	RWFlag        int    `json:"rw_flag"`        //1: 只读 2:读写
 	RWSplit       int    `json:"rw_split"`       //0: 不采用读写分离 1:读写分离
 	OtherProperty int    `json:"other_property"` // 1:统计用户
+	AdminRole     string `json:"admin_role"`     // 执行KILL, FLUSH等管理语句的角色: viewer, operator, admin, 为空表示无管理权限
 }
 
 func (p *User) verify() error {
@@ -77,5 +78,9 @@ func (p *User) verify() error {
 		return fmt.Errorf("invalid other property, user: %s, %d", p.UserName, p.OtherProperty)
 	}
 
+	if p.AdminRole != "" && !IsValidAdminRole(p.AdminRole) {
+		return fmt.Errorf("invalid admin role, user: %s, %s", p.UserName, p.AdminRole)
+	}
+
 	return nil
 }
@@ -0,0 +1,32 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import "fmt"
+
+// VersionColumn means version column of table used for optimistic lock
+// UPDATE语句中将版本列设置为常量时, 改写为版本列加1, 并在WHERE中追加版本列等于该常量的条件, 没有匹配的行时返回冲突错误
+type VersionColumn struct {
+	DB     string `json:"db"`     // 逻辑库名
+	Table  string `json:"table"`  // 逻辑表名
+	Column string `json:"column"` // 版本列名, 整数类型
+}
+
+func (v *VersionColumn) verify() error {
+	if v.DB == "" || v.Table == "" || v.Column == "" {
+		return fmt.Errorf("must specify db, table and column of version column")
+	}
+	return nil
+}
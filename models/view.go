@@ -0,0 +1,38 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// View means a logical view, references of the view are expanded to its SELECT statement before planning
+type View struct {
+	DB   string `json:"db"`   // 逻辑库名
+	Name string `json:"name"` // 视图名
+	SQL  string `json:"sql"`  // 视图定义, 基于逻辑表的SELECT语句, 可引用分片表和其他视图
+}
+
+func (v *View) verify() error {
+	if v.DB == "" || v.Name == "" {
+		return fmt.Errorf("must specify db and name of view")
+	}
+	sql := strings.ToLower(strings.TrimSpace(v.SQL))
+	if !strings.HasPrefix(sql, "select") && !strings.HasPrefix(sql, "with") {
+		return fmt.Errorf("sql of view %s.%s must be a select statement", v.DB, v.Name)
+	}
+	return nil
+}
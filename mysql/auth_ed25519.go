@@ -0,0 +1,71 @@
+// Copyright 2016 The kingshard Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mysql
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+
+	"filippo.io/edwards25519"
+)
+
+// mariadb client_ed25519 认证插件并不是直接使用密码作为ed25519的seed,
+// 而是对任意长度的密码做SHA512后得到私钥标量, 标准库无法直接支持, 这里用edwards25519按RFC 8032签名.
+// see: https://mariadb.com/kb/en/authentication-plugin-ed25519/
+
+// ed25519ExpandPassword return the secret scalar and the prefix used for signing
+func ed25519ExpandPassword(password []byte) (*edwards25519.Scalar, []byte) {
+	az := sha512.Sum512(password)
+	return new(edwards25519.Scalar).SetBytesWithClamping(az[:32]), az[32:]
+}
+
+// CalcEd25519PublicKey calc the public key of password, same as ed25519_password in mariadb
+func CalcEd25519PublicKey(password []byte) []byte {
+	a, _ := ed25519ExpandPassword(password)
+	return new(edwards25519.Point).ScalarBaseMult(a).Bytes()
+}
+
+// CalcEd25519Password sign scramble with password, used by client_ed25519 auth plugin
+func CalcEd25519Password(scramble, password []byte) []byte {
+	a, prefix := ed25519ExpandPassword(password)
+	pub := new(edwards25519.Point).ScalarBaseMult(a).Bytes()
+
+	h := sha512.New()
+	h.Write(prefix)
+	h.Write(scramble)
+	r := new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+	rEncoded := new(edwards25519.Point).ScalarBaseMult(r).Bytes()
+
+	h.Reset()
+	h.Write(rEncoded)
+	h.Write(pub)
+	h.Write(scramble)
+	k := new(edwards25519.Scalar).SetUniformBytes(h.Sum(nil))
+
+	// S = (r + k * a) mod L
+	s := new(edwards25519.Scalar).MultiplyAdd(k, a, r)
+
+	signature := make([]byte, 0, ed25519.SignatureSize)
+	signature = append(signature, rEncoded...)
+	return append(signature, s.Bytes()...)
+}
+
+// VerifyEd25519Password check signature sent by client_ed25519 auth plugin
+func VerifyEd25519Password(scramble, password, signature []byte) bool {
+	if len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(CalcEd25519PublicKey(password), scramble, signature)
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 The kingshard Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestCalcEd25519Password(t *testing.T) {
+	scramble := []byte("0123456789abcdef0123456789abcdef")
+
+	// 32字节的密码与标准库使用seed生成的密钥一致
+	seed := []byte("abcdefghijklmnopqrstuvwxyz012345")
+	key := ed25519.NewKeyFromSeed(seed)
+	if pub := CalcEd25519PublicKey(seed); !bytes.Equal(pub, key.Public().(ed25519.PublicKey)) {
+		t.Fatalf("public key not match, got %x, want %x", pub, key.Public())
+	}
+	if sig := CalcEd25519Password(scramble, seed); !bytes.Equal(sig, ed25519.Sign(key, scramble)) {
+		t.Fatalf("signature not match, got %x", sig)
+	}
+
+	for _, password := range []string{"", "root", "a very long password which is longer than 32 bytes"} {
+		sig := CalcEd25519Password(scramble, []byte(password))
+		if !VerifyEd25519Password(scramble, []byte(password), sig) {
+			t.Errorf("verify password %q failed", password)
+		}
+		if VerifyEd25519Password(scramble, []byte(password+"x"), sig) {
+			t.Errorf("verify wrong password of %q succeed", password)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// 复制协议, 副本通过COM_REGISTER_SLAVE注册后, 发送COM_BINLOG_DUMP或COM_BINLOG_DUMP_GTID, 主库持续返回binlog事件,
+// 每个事件为一个以0x00开头的包
+// see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_replication.html
+const (
+	// BinlogEventHeaderSize size of binlog event header
+	BinlogEventHeaderSize = 19
+	// BinlogChecksumSize size of CRC32 checksum at the end of event
+	BinlogChecksumSize = 4
+
+	// BinlogDumpNonBlock 读完已有的binlog后返回EOF包, 而不是等待新的事件
+	BinlogDumpNonBlock uint16 = 0x01
+	// BinlogThroughGTID COM_BINLOG_DUMP_GTID携带gtid set
+	BinlogThroughGTID uint16 = 0x04
+)
+
+// BinlogEventType type of binlog event
+type BinlogEventType byte
+
+// binlog event types
+const (
+	UnknownEvent           BinlogEventType = 0
+	QueryEvent             BinlogEventType = 2
+	StopEvent              BinlogEventType = 3
+	RotateEvent            BinlogEventType = 4
+	FormatDescriptionEvent BinlogEventType = 15
+	XIDEvent               BinlogEventType = 16
+	TableMapEvent          BinlogEventType = 19
+	HeartbeatEvent         BinlogEventType = 27
+	WriteRowsEventV2       BinlogEventType = 30
+	UpdateRowsEventV2      BinlogEventType = 31
+	DeleteRowsEventV2      BinlogEventType = 32
+	GTIDEvent              BinlogEventType = 33
+	AnonymousGTIDEvent     BinlogEventType = 34
+	PreviousGTIDsEvent     BinlogEventType = 35
+)
+
+var binlogEventTypeNames = map[BinlogEventType]string{
+	UnknownEvent:           "UnknownEvent",
+	QueryEvent:             "QueryEvent",
+	StopEvent:              "StopEvent",
+	RotateEvent:            "RotateEvent",
+	FormatDescriptionEvent: "FormatDescriptionEvent",
+	XIDEvent:               "XIDEvent",
+	TableMapEvent:          "TableMapEvent",
+	HeartbeatEvent:         "HeartbeatEvent",
+	WriteRowsEventV2:       "WriteRowsEventV2",
+	UpdateRowsEventV2:      "UpdateRowsEventV2",
+	DeleteRowsEventV2:      "DeleteRowsEventV2",
+	GTIDEvent:              "GTIDEvent",
+	AnonymousGTIDEvent:     "AnonymousGTIDEvent",
+	PreviousGTIDsEvent:     "PreviousGTIDsEvent",
+}
+
+func (t BinlogEventType) String() string {
+	if name, ok := binlogEventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("BinlogEvent(%d)", byte(t))
+}
+
+// BinlogEventHeader common header of binlog event
+type BinlogEventHeader struct {
+	Timestamp uint32
+	EventType BinlogEventType
+	ServerID  uint32
+	EventSize uint32
+	LogPos    uint32 // 下一个事件在binlog文件中的位置
+	Flags     uint16
+}
+
+// BinlogEvent is one binlog event, the body doesn't include the header and checksum
+type BinlogEvent struct {
+	Header BinlogEventHeader
+	Body   []byte
+}
+
+// ParseBinlogEvent parse binlog event without the leading 0x00 of packet,
+// checksum表示事件末尾带有CRC32校验码, 校验失败时返回错误
+func ParseBinlogEvent(data []byte, checksum bool) (*BinlogEvent, error) {
+	if len(data) < BinlogEventHeaderSize {
+		return nil, fmt.Errorf("invalid binlog event length: %d", len(data))
+	}
+	e := &BinlogEvent{}
+	pos := 0
+	e.Header.Timestamp, pos, _ = ReadUint32(data, pos)
+	e.Header.EventType = BinlogEventType(data[pos])
+	pos++
+	e.Header.ServerID, pos, _ = ReadUint32(data, pos)
+	e.Header.EventSize, pos, _ = ReadUint32(data, pos)
+	e.Header.LogPos, pos, _ = ReadUint32(data, pos)
+	e.Header.Flags, pos, _ = ReadUint16(data, pos)
+	if int(e.Header.EventSize) != len(data) {
+		return nil, fmt.Errorf("binlog event size %d not match packet length %d", e.Header.EventSize, len(data))
+	}
+
+	end := len(data)
+	if checksum {
+		if end-pos < BinlogChecksumSize {
+			return nil, fmt.Errorf("binlog event too short for checksum: %d", len(data))
+		}
+		end -= BinlogChecksumSize
+		expect, _, _ := ReadUint32(data, end)
+		if actual := crc32.ChecksumIEEE(data[:end]); actual != expect {
+			return nil, fmt.Errorf("binlog event checksum mismatch, expect: %x, actual: %x", expect, actual)
+		}
+	}
+	e.Body = data[pos:end]
+	return e, nil
+}
+
+// Rotate return next binlog file and position of ROTATE_EVENT
+func (e *BinlogEvent) Rotate() (string, uint64, error) {
+	if e.Header.EventType != RotateEvent {
+		return "", 0, fmt.Errorf("%s is not RotateEvent", e.Header.EventType)
+	}
+	pos, _, ok := ReadUint64(e.Body, 0)
+	if !ok {
+		return "", 0, fmt.Errorf("invalid rotate event length: %d", len(e.Body))
+	}
+	return string(e.Body[8:]), pos, nil
+}
+
+// GTID return gtid of GTID_EVENT
+func (e *BinlogEvent) GTID() (GTID, error) {
+	var gtid GTID
+	if e.Header.EventType != GTIDEvent {
+		return gtid, fmt.Errorf("%s is not GTIDEvent", e.Header.EventType)
+	}
+	// commit flag(1字节) + uuid(16字节) + gno(8字节)
+	if len(e.Body) < 25 {
+		return gtid, fmt.Errorf("invalid gtid event length: %d", len(e.Body))
+	}
+	copy(gtid.SID[:], e.Body[1:17])
+	gno, _, _ := ReadUint64(e.Body, 17)
+	gtid.GNO = int64(gno)
+	return gtid, nil
+}
+
+// BuildRegisterSlavePacket build COM_REGISTER_SLAVE packet, host等信息显示在主库SHOW SLAVE HOSTS中
+func BuildRegisterSlavePacket(serverID uint32, host, user, password string, port uint16) ([]byte, error) {
+	if len(host) > 255 || len(user) > 255 || len(password) > 255 {
+		return nil, fmt.Errorf("host, user and password of COM_REGISTER_SLAVE must be less than 256 bytes")
+	}
+	data := []byte{ComRegisterSlave}
+	data = AppendUint32(data, serverID)
+	for _, s := range []string{host, user, password} {
+		data = append(data, byte(len(s)))
+		data = append(data, s...)
+	}
+	data = AppendUint16(data, port)
+	data = AppendUint32(data, 0) // replication rank, ignored
+	data = AppendUint32(data, 0) // master id, 0 by default
+	return data, nil
+}
+
+// BuildBinlogDumpPacket build COM_BINLOG_DUMP packet, start from position of binlog file
+func BuildBinlogDumpPacket(serverID uint32, file string, position uint32, flags uint16) []byte {
+	data := []byte{ComBinlogDump}
+	data = AppendUint32(data, position)
+	data = AppendUint16(data, flags)
+	data = AppendUint32(data, serverID)
+	return append(data, file...)
+}
+
+// BuildBinlogDumpGTIDPacket build COM_BINLOG_DUMP_GTID packet, start from the first transaction not in gtidSet
+func BuildBinlogDumpGTIDPacket(serverID uint32, file string, position uint64, flags uint16, gtidSet *GTIDSet) []byte {
+	data := []byte{ComBinlogDumpGtid}
+	data = AppendUint16(data, flags|BinlogThroughGTID)
+	data = AppendUint32(data, serverID)
+	data = AppendUint32(data, uint32(len(file)))
+	data = append(data, file...)
+	data = AppendUint64(data, position)
+	encoded := gtidSet.Encode()
+	data = AppendUint32(data, uint32(len(encoded)))
+	return append(data, encoded...)
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+)
+
+const testServerUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func TestParseGTIDSet(t *testing.T) {
+	tests := []struct {
+		set    string
+		expect string
+		hasErr bool
+	}{
+		{set: "", expect: ""},
+		{set: testServerUUID + ":1-5", expect: testServerUUID + ":1-5"},
+		{set: testServerUUID + ":7:1-5:6", expect: testServerUUID + ":1-7"},
+		{set: testServerUUID + ":1-3:5-9,\n" + "4e11fa47-71ca-11e1-9e33-c80aa9429562:2", expect: testServerUUID + ":1-3:5-9,4e11fa47-71ca-11e1-9e33-c80aa9429562:2"},
+		{set: "3E11FA4771CA11E19E33C80AA9429562:1", expect: testServerUUID + ":1"},
+		{set: testServerUUID, hasErr: true},
+		{set: testServerUUID + ":5-1", hasErr: true},
+		{set: testServerUUID + ":0", hasErr: true},
+		{set: "3e11fa47:1", hasErr: true},
+	}
+	for _, test := range tests {
+		set, err := ParseGTIDSet(test.set)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("expect error of %q, actual: %s", test.set, set)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse %q error: %v", test.set, err)
+			continue
+		}
+		if set.String() != test.expect {
+			t.Errorf("gtid set not match, expect: %s, actual: %s", test.expect, set)
+		}
+	}
+}
+
+func TestGTIDSetAddAndEncode(t *testing.T) {
+	set, err := ParseGTIDSet(testServerUUID + ":1-3:5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, _ := ParseSID(testServerUUID)
+	if set.Contains(GTID{SID: sid, GNO: 4}) {
+		t.Errorf("gtid 4 should not be in set")
+	}
+	set.Add(GTID{SID: sid, GNO: 4})
+	if !set.Contains(GTID{SID: sid, GNO: 4}) || set.String() != testServerUUID+":1-5" {
+		t.Errorf("add gtid failed: %s", set)
+	}
+
+	// 1个uuid, 1个区间[1, 6)
+	expect := AppendUint64(nil, 1)
+	expect = append(expect, sid[:]...)
+	expect = AppendUint64(expect, 1)
+	expect = AppendUint64(expect, 1)
+	expect = AppendUint64(expect, 6)
+	if !bytes.Equal(set.Encode(), expect) {
+		t.Errorf("encoded gtid set not match, expect: %v, actual: %v", expect, set.Encode())
+	}
+}
+
+func buildTestBinlogEvent(eventType BinlogEventType, body []byte, checksum bool) []byte {
+	size := BinlogEventHeaderSize + len(body)
+	if checksum {
+		size += BinlogChecksumSize
+	}
+	data := AppendUint32(nil, 1600000000)
+	data = append(data, byte(eventType))
+	data = AppendUint32(data, 1)
+	data = AppendUint32(data, uint32(size))
+	data = AppendUint32(data, 1234)
+	data = AppendUint16(data, 0)
+	data = append(data, body...)
+	if checksum {
+		data = AppendUint32(data, crc32.ChecksumIEEE(data))
+	}
+	return data
+}
+
+func TestParseBinlogEvent(t *testing.T) {
+	body := AppendUint64(nil, 4)
+	body = append(body, "mysql-bin.000002"...)
+	for _, checksum := range []bool{false, true} {
+		data := buildTestBinlogEvent(RotateEvent, body, checksum)
+		e, err := ParseBinlogEvent(data, checksum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Header.EventType != RotateEvent || e.Header.LogPos != 1234 || e.Header.ServerID != 1 {
+			t.Errorf("event header not match: %+v", e.Header)
+		}
+		file, pos, err := e.Rotate()
+		if err != nil || file != "mysql-bin.000002" || pos != 4 {
+			t.Errorf("rotate event not match, file: %s, pos: %d, err: %v", file, pos, err)
+		}
+		if _, err := e.GTID(); err == nil {
+			t.Errorf("rotate event should not have gtid")
+		}
+	}
+
+	data := buildTestBinlogEvent(RotateEvent, body, true)
+	data[BinlogEventHeaderSize] ^= 0xff
+	if _, err := ParseBinlogEvent(data, true); err == nil {
+		t.Errorf("expect checksum error")
+	}
+	if _, err := ParseBinlogEvent(data[:10], false); err == nil {
+		t.Errorf("expect length error")
+	}
+}
+
+func TestParseGTIDEvent(t *testing.T) {
+	sid, _ := ParseSID(testServerUUID)
+	body := []byte{1}
+	body = append(body, sid[:]...)
+	body = AppendUint64(body, 42)
+	body = append(body, 2, 0, 0, 0, 0, 0, 0, 0, 0) // logical timestamps
+	e, err := ParseBinlogEvent(buildTestBinlogEvent(GTIDEvent, body, true), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gtid, err := e.GTID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gtid.String() != testServerUUID+":42" {
+		t.Errorf("gtid not match: %s", gtid)
+	}
+}
+
+func TestBuildReplicationPackets(t *testing.T) {
+	data, err := BuildRegisterSlavePacket(100, "h", "u", "", 3306)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []byte{ComRegisterSlave, 100, 0, 0, 0, 1, 'h', 1, 'u', 0, 0xea, 0x0c, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(data, expect) {
+		t.Errorf("register slave packet not match: %v", data)
+	}
+
+	data = BuildBinlogDumpPacket(100, "mysql-bin.000001", 4, BinlogDumpNonBlock)
+	expect = append([]byte{ComBinlogDump, 4, 0, 0, 0, 1, 0, 100, 0, 0, 0}, "mysql-bin.000001"...)
+	if !bytes.Equal(data, expect) {
+		t.Errorf("binlog dump packet not match: %v", data)
+	}
+
+	set, _ := ParseGTIDSet(testServerUUID + ":1-5")
+	data = BuildBinlogDumpGTIDPacket(100, "", 4, 0, set)
+	expect = []byte{ComBinlogDumpGtid, byte(BinlogThroughGTID), 0, 100, 0, 0, 0, 0, 0, 0, 0}
+	expect = AppendUint64(expect, 4)
+	expect = AppendUint32(expect, uint32(len(set.Encode())))
+	expect = append(expect, set.Encode()...)
+	if !bytes.Equal(data, expect) {
+		t.Errorf("binlog dump gtid packet not match: %v", data)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 压缩协议在普通包之外再封装一层压缩包, 压缩包头为:
+// 压缩后负载长度(3字节) + 压缩包序号(1字节) + 压缩前负载长度(3字节), 压缩前长度为0表示负载未压缩.
+// 普通包的字节流按顺序写入压缩包, 一个普通包可以跨多个压缩包, 一个压缩包也可以包含多个普通包.
+// see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_compression.html
+const (
+	compressedHeaderSize = 7
+
+	// minCompressLength 负载小于该长度时不压缩, 与MySQL一致
+	minCompressLength = 50
+
+	// compressFlushSize 待写出的数据达到该长度时写出压缩包, 避免大结果集全部缓存在内存中
+	compressFlushSize = 64 * 1024
+
+	// DefaultZstdCompressionLevel 客户端没有指定时zstd的压缩级别, 与MySQL一致
+	DefaultZstdCompressionLevel = 3
+)
+
+// CompressionAlgorithm is the algorithm of compressed protocol
+type CompressionAlgorithm int
+
+const (
+	// CompressionNone compressed protocol is not used
+	CompressionNone CompressionAlgorithm = iota
+	// CompressionZlib CLIENT_COMPRESS
+	CompressionZlib
+	// CompressionZstd CLIENT_ZSTD_COMPRESSION_ALGORITHM
+	CompressionZstd
+)
+
+func (a CompressionAlgorithm) String() string {
+	switch a {
+	case CompressionNone:
+		return "uncompressed"
+	case CompressionZlib:
+		return "zlib"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(a))
+	}
+}
+
+// ParseCompressionAlgorithm parse zlib, zstd or uncompressed, case insensitive
+func ParseCompressionAlgorithm(name string) (CompressionAlgorithm, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "uncompressed":
+		return CompressionNone, nil
+	case "zlib":
+		return CompressionZlib, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression algorithm: %s", name)
+	}
+}
+
+// zstd的Decoder可以并发使用, 所有连接共用. Encoder同一时间只能压缩一个包,
+// 按压缩级别放在sync.Pool中, 压缩时取出用完放回, 避免所有连接排队压缩
+var (
+	zstdLock         sync.Mutex
+	zstdEncoderPools = make(map[int]*sync.Pool)
+	zstdDecoder      *zstd.Decoder
+)
+
+func zstdEncoderPool(level int) *sync.Pool {
+	zstdLock.Lock()
+	defer zstdLock.Unlock()
+	p, ok := zstdEncoderPools[level]
+	if !ok {
+		p = &sync.Pool{}
+		zstdEncoderPools[level] = p
+	}
+	return p
+}
+
+// getZstdEncoder 获取压缩级别为level的Encoder, 用完后通过putZstdEncoder放回
+func getZstdEncoder(level int) (*zstd.Encoder, error) {
+	if e, ok := zstdEncoderPool(level).Get().(*zstd.Encoder); ok {
+		return e, nil
+	}
+	return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+}
+
+func putZstdEncoder(level int, e *zstd.Encoder) {
+	zstdEncoderPool(level).Put(e)
+}
+
+func getZstdDecoder() (*zstd.Decoder, error) {
+	zstdLock.Lock()
+	defer zstdLock.Unlock()
+	if zstdDecoder != nil {
+		return zstdDecoder, nil
+	}
+	// 压缩包解压后最长为MaxPacketSize, 限制内存避免被构造的数据耗尽内存
+	d, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxPacketSize))
+	if err != nil {
+		return nil, err
+	}
+	zstdDecoder = d
+	return d, nil
+}
+
+// compressedIO 压缩包读写, 读取时解压出普通包的字节流, 写入时缓存普通包的字节流, flush时压缩写出
+type compressedIO struct {
+	r io.Reader
+	w io.Writer
+
+	// sequence 压缩包序号, 与普通包序号一样在每个命令开始时重置为0
+	sequence uint8
+
+	readBuf  []byte // 已解压未读取的数据
+	writeBuf []byte // 待压缩写出的数据
+
+	algorithm CompressionAlgorithm
+
+	// zlib
+	zr          io.ReadCloser
+	zw          *zlib.Writer
+	compressBuf bytes.Buffer
+
+	// zstd
+	zstdLevel   int // 压缩时从对应级别的池中获取Encoder
+	zstdDecoder *zstd.Decoder
+	zstdBuf     []byte
+}
+
+// newCompressedIO level is the zstd compression level, 0 means DefaultZstdCompressionLevel, ignored by zlib
+func newCompressedIO(algorithm CompressionAlgorithm, level int, r io.Reader, w io.Writer) (*compressedIO, error) {
+	c := &compressedIO{r: r, w: w, algorithm: algorithm}
+	switch algorithm {
+	case CompressionZlib:
+	case CompressionZstd:
+		if level == 0 {
+			level = DefaultZstdCompressionLevel
+		}
+		e, err := getZstdEncoder(level)
+		if err != nil {
+			return nil, err
+		}
+		putZstdEncoder(level, e)
+		c.zstdLevel = level
+		if c.zstdDecoder, err = getZstdDecoder(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+	return c, nil
+}
+
+// Read 读取解压后的普通包字节流, 连接关闭时返回io.EOF
+func (c *compressedIO) Read(p []byte) (int, error) {
+	for len(c.readBuf) == 0 {
+		if err := c.readCompressedPacket(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *compressedIO) readCompressedPacket() error {
+	var header [compressedHeaderSize]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return fmt.Errorf("io.ReadFull(compressed header) failed: %w", err)
+	}
+	compressedLength := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	sequence := header[3]
+	uncompressedLength := int(uint32(header[4]) | uint32(header[5])<<8 | uint32(header[6])<<16)
+	if sequence != c.sequence {
+		return fmt.Errorf("invalid compressed sequence, expected %v got %v", c.sequence, sequence)
+	}
+	c.sequence++
+
+	payload := make([]byte, compressedLength)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return fmt.Errorf("io.ReadFull(compressed packet body of length %v) failed: %w", compressedLength, err)
+	}
+	if uncompressedLength == 0 {
+		c.readBuf = payload
+		return nil
+	}
+
+	if c.algorithm == CompressionZstd {
+		data, err := c.zstdDecoder.DecodeAll(payload, make([]byte, 0, uncompressedLength))
+		if err != nil {
+			return fmt.Errorf("decompress packet failed: %v", err)
+		}
+		if len(data) != uncompressedLength {
+			return fmt.Errorf("decompress packet of length %v failed: got %v bytes", uncompressedLength, len(data))
+		}
+		c.readBuf = data
+		return nil
+	}
+
+	if err := c.resetZlibReader(payload); err != nil {
+		return fmt.Errorf("decompress packet failed: %v", err)
+	}
+	data := make([]byte, uncompressedLength)
+	if _, err := io.ReadFull(c.zr, data); err != nil {
+		return fmt.Errorf("decompress packet of length %v failed: %v", uncompressedLength, err)
+	}
+	c.readBuf = data
+	return nil
+}
+
+func (c *compressedIO) resetZlibReader(payload []byte) error {
+	if c.zr == nil {
+		zr, err := zlib.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		c.zr = zr
+		return nil
+	}
+	return c.zr.(zlib.Resetter).Reset(bytes.NewReader(payload), nil)
+}
+
+// Write 缓存普通包的字节流, 达到compressFlushSize时写出
+func (c *compressedIO) Write(p []byte) (int, error) {
+	c.writeBuf = append(c.writeBuf, p...)
+	if len(c.writeBuf) >= compressFlushSize {
+		if err := c.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush 将缓存的数据按最大包长度切分, 压缩后写出
+func (c *compressedIO) flush() error {
+	data := c.writeBuf
+	for len(data) > 0 {
+		n := len(data)
+		if n > MaxPacketSize {
+			n = MaxPacketSize
+		}
+		if err := c.writeCompressedPacket(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	if cap(c.writeBuf) > compressFlushSize*2 {
+		c.writeBuf = nil
+	} else {
+		c.writeBuf = c.writeBuf[:0]
+	}
+	return nil
+}
+
+func (c *compressedIO) writeCompressedPacket(data []byte) error {
+	payload, uncompressedLength := data, 0
+	if len(data) >= minCompressLength {
+		compressed, err := c.compress(data)
+		if err != nil {
+			return err
+		}
+		// 压缩后没有变小时发送原始数据
+		if len(compressed) < len(data) {
+			payload, uncompressedLength = compressed, len(data)
+		}
+	}
+
+	packet := make([]byte, compressedHeaderSize+len(payload))
+	packet[0] = byte(len(payload))
+	packet[1] = byte(len(payload) >> 8)
+	packet[2] = byte(len(payload) >> 16)
+	packet[3] = c.sequence
+	packet[4] = byte(uncompressedLength)
+	packet[5] = byte(uncompressedLength >> 8)
+	packet[6] = byte(uncompressedLength >> 16)
+	copy(packet[compressedHeaderSize:], payload)
+	if _, err := c.w.Write(packet); err != nil {
+		return fmt.Errorf("Write(compressed packet) failed: %w", err)
+	}
+	c.sequence++
+	return nil
+}
+
+func (c *compressedIO) compress(data []byte) ([]byte, error) {
+	if c.algorithm == CompressionZstd {
+		e, err := getZstdEncoder(c.zstdLevel)
+		if err != nil {
+			return nil, err
+		}
+		c.zstdBuf = e.EncodeAll(data, c.zstdBuf[:0])
+		putZstdEncoder(c.zstdLevel, e)
+		return c.zstdBuf, nil
+	}
+
+	c.compressBuf.Reset()
+	if c.zw == nil {
+		c.zw = zlib.NewWriter(&c.compressBuf)
+	} else {
+		c.zw.Reset(&c.compressBuf)
+	}
+	if _, err := c.zw.Write(data); err != nil {
+		return nil, fmt.Errorf("compress packet failed: %v", err)
+	}
+	if err := c.zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress packet failed: %v", err)
+	}
+	return c.compressBuf.Bytes(), nil
+}
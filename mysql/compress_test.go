@@ -0,0 +1,205 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// countConn 统计写出的字节数
+type countConn struct {
+	net.Conn
+	written int
+}
+
+func (c *countConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written += n
+	return n, err
+}
+
+func newCompressedConnPair(t *testing.T, algorithm CompressionAlgorithm) (*Conn, *Conn, *countConn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	counter := &countConn{Conn: server}
+	serverConn, clientConn := NewConn(counter), NewConn(client)
+	if err := serverConn.EnableCompression(algorithm, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientConn.EnableCompression(algorithm, 0); err != nil {
+		t.Fatal(err)
+	}
+	return serverConn, clientConn, counter
+}
+
+func TestCompressedPacket(t *testing.T) {
+	for _, algorithm := range []CompressionAlgorithm{CompressionZlib, CompressionZstd} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			testCompressedPacket(t, algorithm)
+		})
+	}
+}
+
+func TestCompressedPacketConcurrent(t *testing.T) {
+	// 多个连接同时使用相同级别的zstd压缩
+	for i := 0; i < 4; i++ {
+		t.Run(fmt.Sprintf("conn-%d", i), func(t *testing.T) {
+			t.Parallel()
+			testCompressedPacket(t, CompressionZstd)
+		})
+	}
+}
+
+func testCompressedPacket(t *testing.T, algorithm CompressionAlgorithm) {
+	packets := [][]byte{
+		[]byte("short"),
+		bytes.Repeat([]byte("select * from t where id = 1;"), 100),
+		bytes.Repeat([]byte{'a'}, compressFlushSize*3+7),
+		{},
+	}
+	server, client, counter := newCompressedConnPair(t, algorithm)
+
+	errCh := make(chan error, 1)
+	go func() {
+		server.StartWriterBuffering()
+		for _, p := range packets {
+			if err := server.WritePacket(p); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- server.Flush()
+	}()
+
+	total := 0
+	for i, expect := range packets {
+		data, err := client.ReadPacket()
+		if err != nil {
+			t.Fatalf("read packet %d failed: %v", i, err)
+		}
+		if !bytes.Equal(data, expect) {
+			t.Errorf("packet %d not match, length: %d, expect: %d", i, len(data), len(expect))
+		}
+		total += len(expect) + 4
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+	if counter.written >= total/10 {
+		t.Errorf("payload should be compressed, written: %d, uncompressed: %d", counter.written, total)
+	}
+	// 写出后普通包序号与压缩包序号同步
+	if server.GetSequence() != server.compressed.sequence {
+		t.Errorf("sequence not synced, sequence: %d, compressed sequence: %d", server.GetSequence(), server.compressed.sequence)
+	}
+}
+
+func TestCompressedCommandSequence(t *testing.T) {
+	server, client, _ := newCompressedConnPair(t, CompressionZstd)
+	for i := 0; i < 3; i++ {
+		// 每个命令开始时重置序号
+		client.SetSequence(0)
+		server.SetSequence(0)
+		done := make(chan error, 1)
+		go func() {
+			done <- client.WritePacket([]byte{ComQuery, 's', 'e', 'l', 'e', 'c', 't', ' ', '1'})
+		}()
+		data, err := server.ReadEphemeralPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data[1:]) != "select 1" {
+			t.Errorf("command not match: %s", data[1:])
+		}
+		server.RecycleReadPacket()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			done <- server.WriteOKPacket(0, 0, 0, 0)
+		}()
+		data, err = client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != OKHeader {
+			t.Errorf("expect ok packet, got: %v", data)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCompressedInvalidSequence(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := NewConn(server)
+	if err := c.EnableCompression(CompressionZlib, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 压缩包序号为1, 期望0
+	go client.Write([]byte{5, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, ComPing})
+	if _, err := c.ReadPacket(); err == nil || err == io.EOF {
+		t.Errorf("expect invalid compressed sequence error, got: %v", err)
+	}
+}
+
+func TestEnableCompressionUnsupported(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	c := NewConn(server)
+	if err := c.EnableCompression(CompressionNone, 0); err == nil {
+		t.Errorf("uncompressed should not be enabled")
+	}
+	if err := c.EnableCompression(CompressionAlgorithm(10), 0); err == nil {
+		t.Errorf("unknown algorithm should not be supported")
+	}
+	if c.IsCompressed() {
+		t.Errorf("compression should not be enabled")
+	}
+}
+
+func TestParseCompressionAlgorithm(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect CompressionAlgorithm
+		hasErr bool
+	}{
+		{"zlib", CompressionZlib, false},
+		{" ZSTD ", CompressionZstd, false},
+		{"uncompressed", CompressionNone, false},
+		{"lz4", CompressionNone, true},
+		{"", CompressionNone, true},
+	}
+	for _, test := range tests {
+		actual, err := ParseCompressionAlgorithm(test.name)
+		if (err != nil) != test.hasErr || actual != test.expect {
+			t.Errorf("parse compression algorithm not match, name: %s, expect: %s, actual: %s, err: %v", test.name, test.expect, actual, err)
+		}
+	}
+}
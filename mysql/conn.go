@@ -38,6 +38,7 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/XiaoMi/Gaea/util/bucketpool"
 	"github.com/XiaoMi/Gaea/util/sync2"
@@ -102,6 +103,22 @@ type Conn struct {
 	// currentEphemeralBuffer for tracking allocated temporary buffer for writes and reads respectively.
 	// It can be allocated from bufPool or heap and should be recycled in the same manner.
 	currentEphemeralBuffer *[]byte
+
+	// readTimeout/writeTimeout limit the time spent on a single packet.
+	// readTimeout starts after the packet header arrives, so it doesn't
+	// apply to an idle connection waiting for the next command.
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+
+	// compressed is not nil after compressed protocol is enabled
+	compressed *compressedIO
+
+	// writeBufferSize/flushDelay control write coalescing of buffered writes.
+	// writeBufferSize 0 means connBufferSize, negative means writing every packet directly.
+	// flushDelay 0 means buffered data is written only when the buffer is full or Flush is called.
+	writeBufferSize int
+	flushDelay      time.Duration
+	bufferedAt      time.Time // 缓冲区中未写出数据的开始时间
 }
 
 // bufPool is used to allocate and free buffers in an efficient way.
@@ -124,11 +141,62 @@ func (c *Conn) LocalAddr() net.Addr {
 	return c.conn.LocalAddr()
 }
 
+// SetReadTimeout sets the timeout for reading the body of a packet, 0 means no timeout.
+func (c *Conn) SetReadTimeout(timeout time.Duration) {
+	c.readTimeout = timeout
+}
+
+// SetWriteTimeout sets the timeout for writing a packet, 0 means no timeout.
+func (c *Conn) SetWriteTimeout(timeout time.Duration) {
+	c.writeTimeout = timeout
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *Conn) startReadTimeout() {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+}
+
+func (c *Conn) stopReadTimeout() {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+func (c *Conn) startWriteTimeout() {
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
+// SetWriteBuffering sets buffer size and flush delay of buffered writes, it takes effect from next StartWriterBuffering.
+func (c *Conn) SetWriteBuffering(bufferSize int, flushDelay time.Duration) {
+	c.writeBufferSize = bufferSize
+	c.flushDelay = flushDelay
+}
+
 // StartWriterBuffering starts using buffered writes. This should
 // be terminated by a call to flush.
 func (c *Conn) StartWriterBuffering() {
-	c.bufferedWriter = writersPool.Get().(*bufio.Writer)
-	c.bufferedWriter.Reset(c.conn)
+	if c.writeBufferSize < 0 {
+		return
+	}
+	var w io.Writer = c.conn
+	if c.compressed != nil {
+		w = c.compressed
+	}
+	if c.writeBufferSize == 0 || c.writeBufferSize == connBufferSize {
+		c.bufferedWriter = writersPool.Get().(*bufio.Writer)
+		c.bufferedWriter.Reset(w)
+	} else {
+		c.bufferedWriter = bufio.NewWriterSize(w, c.writeBufferSize)
+	}
+	c.bufferedAt = time.Time{}
 }
 
 // Flush flushes the written data to the socket.
@@ -140,11 +208,51 @@ func (c *Conn) Flush() error {
 
 	defer func() {
 		c.bufferedWriter.Reset(nil)
-		writersPool.Put(c.bufferedWriter)
+		if c.bufferedWriter.Size() == connBufferSize {
+			writersPool.Put(c.bufferedWriter)
+		}
 		c.bufferedWriter = nil
 	}()
 
-	return c.bufferedWriter.Flush()
+	c.startWriteTimeout()
+	if err := c.bufferedWriter.Flush(); err != nil {
+		return err
+	}
+	return c.flushCompressed()
+}
+
+// EnableCompression enables compressed protocol after CLIENT_COMPRESS or CLIENT_ZSTD_COMPRESSION_ALGORITHM is negotiated,
+// it should be called after the OK packet of handshake is written or read.
+// level is the zstd compression level sent in handshake response, 0 means default, ignored by zlib.
+func (c *Conn) EnableCompression(algorithm CompressionAlgorithm, level int) error {
+	var r io.Reader = c.conn
+	if c.bufferedReader != nil {
+		r = c.bufferedReader
+	}
+	compressed, err := newCompressedIO(algorithm, level, r, c.conn)
+	if err != nil {
+		return err
+	}
+	compressed.sequence = c.sequence
+	c.compressed = compressed
+	return nil
+}
+
+// IsCompressed returns true if compressed protocol is enabled
+func (c *Conn) IsCompressed() bool {
+	return c.compressed != nil
+}
+
+// flushCompressed 写出压缩包, 与MySQL一致, 写出后普通包序号与压缩包序号同步
+func (c *Conn) flushCompressed() error {
+	if c.compressed == nil {
+		return nil
+	}
+	if err := c.compressed.flush(); err != nil {
+		return err
+	}
+	c.sequence = c.compressed.sequence
+	return nil
 }
 
 // getWriter returns the current writer. It may be either
@@ -153,12 +261,18 @@ func (c *Conn) getWriter() io.Writer {
 	if c.bufferedWriter != nil {
 		return c.bufferedWriter
 	}
+	if c.compressed != nil {
+		return c.compressed
+	}
 	return c.conn
 }
 
 // getReader returns reader for connection. It can be *bufio.Reader or net.Conn
 // depending on which buffer size was passed to newServerConn.
 func (c *Conn) getReader() io.Reader {
+	if c.compressed != nil {
+		return c.compressed
+	}
 	if c.bufferedReader != nil {
 		return c.bufferedReader
 	}
@@ -183,11 +297,12 @@ func (c *Conn) readHeaderFrom(r io.Reader) (int, error) {
 		if strings.HasSuffix(err.Error(), "read: connection reset by peer") {
 			return 0, io.EOF
 		}
-		return 0, fmt.Errorf("io.ReadFull(header size) failed: %v", err)
+		return 0, fmt.Errorf("io.ReadFull(header size) failed: %w", err)
 	}
 
 	sequence := uint8(header[3])
-	if sequence != c.sequence {
+	// 压缩协议中MySQL不校验普通包的序号, 只校验压缩包的序号
+	if c.compressed == nil && sequence != c.sequence {
 		return 0, fmt.Errorf("invalid sequence, expected %v got %v", c.sequence, sequence)
 	}
 
@@ -214,6 +329,8 @@ func (c *Conn) ReadEphemeralPacket() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.startReadTimeout()
+	defer c.stopReadTimeout()
 
 	c.currentEphemeralPolicy = ephemeralRead
 	if length == 0 {
@@ -226,7 +343,7 @@ func (c *Conn) ReadEphemeralPacket() ([]byte, error) {
 	if length < MaxPacketSize {
 		c.currentEphemeralBuffer = bufPool.Get(length)
 		if _, err := io.ReadFull(r, *c.currentEphemeralBuffer); err != nil {
-			return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %v", length, err)
+			return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %w", length, err)
 		}
 		return *c.currentEphemeralBuffer, nil
 	}
@@ -236,7 +353,7 @@ func (c *Conn) ReadEphemeralPacket() ([]byte, error) {
 	// optimize this code path easily.
 	data := make([]byte, length)
 	if _, err := io.ReadFull(r, data); err != nil {
-		return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %v", length, err)
+		return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %w", length, err)
 	}
 	for {
 		next, err := c.readOnePacket()
@@ -284,7 +401,7 @@ func (c *Conn) ReadEphemeralPacketDirect() ([]byte, error) {
 	if length < MaxPacketSize {
 		c.currentEphemeralBuffer = bufPool.Get(length)
 		if _, err := io.ReadFull(r, *c.currentEphemeralBuffer); err != nil {
-			return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %v", length, err)
+			return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %w", length, err)
 		}
 		return *c.currentEphemeralBuffer, nil
 	}
@@ -314,6 +431,8 @@ func (c *Conn) readOnePacket() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	c.startReadTimeout()
+	defer c.stopReadTimeout()
 	if length == 0 {
 		// This can be caused by the packet after a packet of
 		// exactly size MaxPacketSize.
@@ -322,7 +441,7 @@ func (c *Conn) readOnePacket() ([]byte, error) {
 
 	data := make([]byte, length)
 	if _, err := io.ReadFull(r, data); err != nil {
-		return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %v", length, err)
+		return nil, fmt.Errorf("io.ReadFull(packet body of length %v) failed: %w", length, err)
 	}
 	return data, nil
 }
@@ -382,10 +501,45 @@ func (c *Conn) ReadPacket() ([]byte, error) {
 //
 // This method returns a generic error, not a SQLError.
 func (c *Conn) WritePacket(data []byte) error {
+	if err := c.writePacket(data); err != nil {
+		return err
+	}
+	// 没有开启缓冲写时立即写出压缩包
+	if c.bufferedWriter == nil {
+		return c.flushCompressed()
+	}
+	return c.flushDelayed()
+}
+
+// flushDelayed 缓冲的数据超过flushDelay未写出时写出, 不结束缓冲写.
+// 压缩协议下只写入压缩缓冲区, 压缩包仍在Flush时写出, 以保证包序号正确
+func (c *Conn) flushDelayed() error {
+	if c.flushDelay <= 0 {
+		return nil
+	}
+	if c.bufferedWriter.Buffered() == 0 {
+		c.bufferedAt = time.Time{}
+		return nil
+	}
+	now := time.Now()
+	if c.bufferedAt.IsZero() {
+		c.bufferedAt = now
+		return nil
+	}
+	if now.Sub(c.bufferedAt) < c.flushDelay {
+		return nil
+	}
+	c.bufferedAt = time.Time{}
+	c.startWriteTimeout()
+	return c.bufferedWriter.Flush()
+}
+
+func (c *Conn) writePacket(data []byte) error {
 	index := 0
 	length := len(data)
 
 	w := c.getWriter()
+	c.startWriteTimeout()
 
 	for {
 		// Packet length is capped to MaxPacketSize.
@@ -401,14 +555,14 @@ func (c *Conn) WritePacket(data []byte) error {
 		header[2] = byte(packetLength >> 16)
 		header[3] = c.sequence
 		if n, err := w.Write(header[:]); err != nil {
-			return fmt.Errorf("Write(header) failed: %v", err)
+			return fmt.Errorf("Write(header) failed: %w", err)
 		} else if n != 4 {
 			return fmt.Errorf("Write(header) returned a short write: %v < 4", n)
 		}
 
 		// Write the body.
 		if n, err := w.Write(data[index : index+packetLength]); err != nil {
-			return fmt.Errorf("Write(packet) failed: %v", err)
+			return fmt.Errorf("Write(packet) failed: %w", err)
 		} else if n != packetLength {
 			return fmt.Errorf("Write(packet) returned a short write: %v < %v", n, packetLength)
 		}
@@ -426,7 +580,7 @@ func (c *Conn) WritePacket(data []byte) error {
 				header[2] = 0
 				header[3] = c.sequence
 				if n, err := w.Write(header[:]); err != nil {
-					return fmt.Errorf("Write(empty header) failed: %v", err)
+					return fmt.Errorf("Write(empty header) failed: %w", err)
 				} else if n != 4 {
 					return fmt.Errorf("Write(empty header) returned a short write: %v < 4", n)
 				}
@@ -487,7 +641,7 @@ func (c *Conn) recycleWritePacket() {
 // Returns SQLError(CRServerGone) if it can't.
 func (c *Conn) writeComQuit() error {
 	// This is a new command, need to reset the sequence.
-	c.sequence = 0
+	c.SetSequence(0)
 
 	data := c.StartEphemeralPacket(1)
 	data[0] = ComQuit
@@ -502,6 +656,11 @@ func (c *Conn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+// NetConn returns the underlying network connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
 // GetConnectionID returns the MySQL connection ID for this connection.
 func (c *Conn) GetConnectionID() uint32 {
 	return c.ConnectionID
@@ -515,6 +674,9 @@ func (c *Conn) SetConnectionID(connectionID uint32) {
 // SetSequence set sequence of conn
 func (c *Conn) SetSequence(sequence uint8) {
 	c.sequence = sequence
+	if c.compressed != nil {
+		c.compressed.sequence = sequence
+	}
 }
 
 // GetSequence return sequence of conn
@@ -568,7 +730,7 @@ func (c *Conn) WriteOKPacket(affectedRows, lastInsertID uint64, flags uint16, wa
 
 // WriteOKPacketWithEOFHeader writes an OK packet with an EOF header.
 // This is used at the end of a result set if
-// CapabilityClientDeprecateEOF is set.
+// ClientDeprecateEOF is set.
 // Server -> Client.
 // This method returns a generic error, not a SQLError.
 func (c *Conn) WriteOKPacketWithEOFHeader(affectedRows, lastInsertID uint64, flags uint16, warnings uint16) error {
@@ -613,9 +775,11 @@ func (c *Conn) WriteErrorPacket(errorCode uint16, sqlState string, format string
 
 // WriteErrorPacketFromError writes an error packet, from a regular error.
 // See writeErrorPacket for other info.
+// 包装过的SQLError(如不支持的功能)仍然返回其错误码和SQLSTATE
 func (c *Conn) WriteErrorPacketFromError(err error) error {
-	if se, ok := err.(*SQLError); ok {
-		return c.WriteErrorPacket(se.SQLCode(), se.SQLState(), "%v", se.Message)
+	var se *SQLError
+	if errors.As(err, &se) {
+		return c.WriteErrorPacket(se.SQLCode(), se.SQLState(), "%v", se.FullMessage())
 	}
 
 	return c.WriteErrorPacket(ErrUnknown, DefaultMySQLState, "unknown error: %v", err)
@@ -0,0 +1,121 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnReadTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := NewConn(server)
+	c.SetReadTimeout(50 * time.Millisecond)
+
+	// 包头到达前不受读超时限制
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		// 只写包头, 包体不到达
+		client.Write([]byte{4, 0, 0, 0})
+	}()
+
+	start := time.Now()
+	if _, err := c.ReadEphemeralPacket(); err == nil {
+		t.Fatalf("expect read timeout error")
+	}
+	if cost := time.Since(start); cost < 150*time.Millisecond {
+		t.Errorf("read timeout should start after header, cost: %v", cost)
+	}
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := NewConn(server)
+	c.SetWriteTimeout(50 * time.Millisecond)
+	if err := c.WritePacket([]byte{1, 2, 3}); err == nil {
+		t.Fatalf("expect write timeout error")
+	}
+}
+
+// recordConn 记录每次写入底层连接的数据
+type recordConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestConnWriteBuffering(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		bufferSize  int
+		flushDelay  time.Duration
+		sleep       time.Duration
+		beforeFlush int // Flush之前写入底层连接的次数
+		afterFlush  int
+	}{
+		{name: "default", beforeFlush: 0, afterFlush: 1},
+		{name: "small buffer", bufferSize: 8, beforeFlush: 2, afterFlush: 3},
+		{name: "no coalescing", bufferSize: -1, beforeFlush: 6, afterFlush: 6},
+		{name: "flush delay", flushDelay: 10 * time.Millisecond, sleep: 20 * time.Millisecond, beforeFlush: 1, afterFlush: 1},
+		{name: "flush delay not reached", flushDelay: time.Minute, sleep: 20 * time.Millisecond, beforeFlush: 0, afterFlush: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc := &recordConn{Conn: server}
+			c := NewConn(rc)
+			c.SetWriteBuffering(test.bufferSize, test.flushDelay)
+			c.StartWriterBuffering()
+			for i := 0; i < 3; i++ {
+				if err := c.WritePacket([]byte{1, 2, 3}); err != nil {
+					t.Fatal(err)
+				}
+				if i == 1 {
+					time.Sleep(test.sleep)
+				}
+			}
+			if len(rc.writes) != test.beforeFlush {
+				t.Errorf("writes before flush not match, expect: %d, actual: %d", test.beforeFlush, len(rc.writes))
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if len(rc.writes) != test.afterFlush {
+				t.Errorf("writes after flush not match, expect: %d, actual: %d", test.afterFlush, len(rc.writes))
+			}
+			var total int
+			for _, w := range rc.writes {
+				total += len(w)
+			}
+			if total != 21 {
+				t.Errorf("written bytes not match, expect: 21, actual: %d", total)
+			}
+		})
+	}
+}
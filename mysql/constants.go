@@ -29,6 +29,9 @@ const (
 	TimeFormat string = "2006-01-02 15:04:05"
 	// ServerVersion server version
 	ServerVersion string = "8.0.12"
+	// MariaDBServerVersion server version in mariadb compatibility mode,
+	// mariadb connectors detect mariadb by the "5.5.5-" prefix and "-MariaDB" suffix
+	MariaDBServerVersion string = "5.5.5-10.3.0-MariaDB"
 	// ProtocolVersion is the current version of the protocol.
 	// Always 10.
 	ProtocolVersion = 10
@@ -40,11 +43,15 @@ const (
 	AUTH_NATIVE_PASSWORD       = "mysql_native_password"
 	AUTH_CACHING_SHA2_PASSWORD = "caching_sha2_password"
 	AUTH_SHA256_PASSWORD       = "sha256_password"
+	AUTH_CLIENT_ED25519        = "client_ed25519"
+	AUTH_CLEAR_PASSWORD        = "mysql_clear_password"
 )
 
 const (
 	// CursorTypeReadOnly readonly cursor
 	CursorTypeReadOnly = 0x01
+	// ParameterCountAvailable COM_STMT_EXECUTE中单独发送参数个数, 协商CLIENT_QUERY_ATTRIBUTES后客户端发送query attributes时设置
+	ParameterCountAvailable = 0x08
 )
 
 // Header information.
@@ -142,8 +149,17 @@ const (
 	ClientPluginAuth
 	ClientConnectAtts
 	ClientPluginAuthLenencClientData
+	ClientCanHandleExpiredPasswords
+	ClientSessionTrack
+	ClientDeprecateEOF
 )
 
+// ClientZstdCompressionAlgorithm CLIENT_ZSTD_COMPRESSION_ALGORITHM, 握手响应的最后一个字节为zstd压缩级别
+const ClientZstdCompressionAlgorithm uint32 = 1 << 26
+
+// ClientQueryAttributes CLIENT_QUERY_ATTRIBUTES, MySQL 8.0.23+的客户端可以在COM_QUERY和COM_STMT_EXECUTE中发送query attributes
+const ClientQueryAttributes uint32 = 1 << 27
+
 // PrivilegeType  privilege
 type PrivilegeType uint32
 
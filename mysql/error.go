@@ -32,8 +32,11 @@
 package mysql
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -51,6 +54,78 @@ type SQLError struct {
 	Code    uint16
 	Message string
 	State   string
+
+	Detail *ErrorDetail // 返回给客户端时序列化到错误信息的后缀, nil时不输出
+}
+
+// ErrorDetail is the machine-readable detail of SQLError, so that client middleware can react programmatically
+type ErrorDetail struct {
+	Namespace   string `json:"namespace,omitempty"`
+	Slice       string `json:"slice,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"` // md5 of sql fingerprint, same as key of sql fingerprint stats
+	Retryable   bool   `json:"retryable"`
+}
+
+const (
+	// errorDetailPrefix prefix of detail suffix in error message, e.g. ... [gaea_detail={"namespace":"ns","retryable":false}]
+	errorDetailPrefix = " [gaea_detail="
+	// maxErrorMessageLen 客户端库的错误信息缓冲区长度(MYSQL_ERRMSG_SIZE), 超过时截断Message, 保证后缀完整
+	maxErrorMessageLen = 512
+)
+
+// retryableErrorCodes 重试可能成功的错误码
+var retryableErrorCodes = map[uint16]bool{
+	ErrConCount:               true,
+	ErrTooManyUserConnections: true,
+	ErrLockWaitTimeout:        true,
+	ErrLockDeadlock:           true,
+}
+
+// IsRetryableCode check if the statement may succeed on retry after error with the code
+func IsRetryableCode(code uint16) bool {
+	return retryableErrorCodes[code]
+}
+
+// WithDetail return a copy of SQLError with detail
+func (se *SQLError) WithDetail(detail *ErrorDetail) *SQLError {
+	e := *se
+	e.Detail = detail
+	return &e
+}
+
+// FullMessage return message with detail serialized in suffix, which is sent to client
+func (se *SQLError) FullMessage() string {
+	if se.Detail == nil {
+		return se.Message
+	}
+	data, err := json.Marshal(se.Detail)
+	if err != nil {
+		return se.Message
+	}
+	suffix := errorDetailPrefix + string(data) + "]"
+	message := se.Message
+	if len(message)+len(suffix) > maxErrorMessageLen && len(suffix) < maxErrorMessageLen {
+		n := maxErrorMessageLen - len(suffix)
+		for n > 0 && !utf8.RuneStart(message[n]) {
+			n--
+		}
+		message = message[:n]
+	}
+	return message + suffix
+}
+
+// ParseErrorDetail split error message received by client into original message and detail,
+// detail is nil if message has no detail suffix
+func ParseErrorDetail(message string) (string, *ErrorDetail) {
+	idx := strings.LastIndex(message, errorDetailPrefix)
+	if idx < 0 || !strings.HasSuffix(message, "]") {
+		return message, nil
+	}
+	detail := &ErrorDetail{}
+	if err := json.Unmarshal([]byte(message[idx+len(errorDetailPrefix):len(message)-1]), detail); err != nil {
+		return message, nil
+	}
+	return message[:idx], detail
 }
 
 func (se *SQLError) Error() string {
@@ -250,6 +250,7 @@ var MySQLState = map[uint16]string{
 	ErrUnsupportedOnGeneratedColumn:        "HY000",
 	ErrGeneratedColumnNonPrior:             "HY000",
 	ErrDependentByGeneratedColumn:          "HY000",
+	ErrAccountHasBeenLocked:                "HY000",
 	ErrInvalidJSONText:                     "22032",
 	ErrInvalidJSONPath:                     "42000",
 	ErrInvalidJSONData:                     "22032",
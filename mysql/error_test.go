@@ -14,6 +14,11 @@
 package mysql
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
 	"github.com/pingcap/check"
 )
 
@@ -35,3 +40,43 @@ func (s *testSQLErrorSuite) TestSQLError(c *check.C) {
 	e = NewDefaultError(0, "customized error")
 	c.Assert(len(e.Error()), check.Greater, 0)
 }
+
+func (s *testSQLErrorSuite) TestUnsupportedError(c *check.C) {
+	e := UnsupportedSetGlobal.Err()
+	c.Assert(e.Code, check.Equals, uint16(ErrNotSupportedYet))
+	c.Assert(e.State, check.Equals, "42000")
+	c.Assert(e.Message, check.Equals, "gaea does not support SET GLOBAL variable, set it on backend mysql directly, or use SET SESSION")
+
+	e = UnsupportedAggregateFunc.Err("group_concat")
+	c.Assert(e.Message, check.Equals, "gaea does not support aggregate function group_concat across shards, add the shard key to WHERE to route to a single shard")
+
+	var se *SQLError
+	wrapped := fmt.Errorf("get plan error, err: %w", UnsupportedMultiTableUpdate.Err())
+	c.Assert(errors.As(wrapped, &se), check.IsTrue)
+	c.Assert(se.Code, check.Equals, uint16(ErrNotSupportedYet))
+}
+
+func (s *testSQLErrorSuite) TestErrorDetail(c *check.C) {
+	e := NewDefaultError(ErrLockDeadlock)
+	c.Assert(e.FullMessage(), check.Equals, e.Message)
+
+	detail := &ErrorDetail{Namespace: "ns", Slice: "slice-0", Fingerprint: "abc", Retryable: IsRetryableCode(e.Code)}
+	withDetail := e.WithDetail(detail)
+	c.Assert(e.Detail, check.IsNil)
+	message, parsed := ParseErrorDetail(withDetail.FullMessage())
+	c.Assert(message, check.Equals, e.Message)
+	c.Assert(*parsed, check.DeepEquals, *detail)
+	c.Assert(parsed.Retryable, check.IsTrue)
+
+	message, parsed = ParseErrorDetail("Duplicate entry '1' for key 'PRIMARY'")
+	c.Assert(message, check.Equals, "Duplicate entry '1' for key 'PRIMARY'")
+	c.Assert(parsed, check.IsNil)
+
+	// 超长的错误信息截断Message, 保留完整的后缀
+	long := NewError(ErrUnknown, strings.Repeat("错", 300)).WithDetail(detail)
+	full := long.FullMessage()
+	c.Assert(len(full) <= maxErrorMessageLen, check.IsTrue)
+	c.Assert(utf8.ValidString(full), check.IsTrue)
+	_, parsed = ParseErrorDetail(full)
+	c.Assert(*parsed, check.DeepEquals, *detail)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"fmt"
+)
+
+// Unsupported is an entry in the catalog of features not supported by gaea,
+// Feature describes what is unsupported, Advice tells which hint or config could help.
+type Unsupported struct {
+	Code    uint16
+	Feature string
+	Advice  string
+}
+
+// 不支持的功能目录, 统一使用ER_NOT_SUPPORTED_YET, 驱动可以根据错误码区分不支持的语法和执行错误
+var (
+	// UnsupportedSetGlobal SET GLOBAL
+	UnsupportedSetGlobal = &Unsupported{ErrNotSupportedYet, "SET GLOBAL variable", "set it on backend mysql directly, or use SET SESSION"}
+	// UnsupportedSetTransaction SET TRANSACTION
+	UnsupportedSetTransaction = &Unsupported{ErrNotSupportedYet, "SET TRANSACTION", "configure transaction_isolation on backend mysql instead"}
+	// UnsupportedCommand statement which cannot be parsed without plan
+	UnsupportedCommand = &Unsupported{ErrNotSupportedYet, "this statement", "see docs/compatibility.md for supported statements"}
+	// UnsupportedShardStmt statement type on sharding table
+	UnsupportedShardStmt = &Unsupported{ErrNotSupportedYet, "this statement type on sharding table", "execute it on unsharded table, or on each physical table"}
+	// UnsupportedMultiTableUpdate UPDATE with multiple tables
+	UnsupportedMultiTableUpdate = &Unsupported{ErrNotSupportedYet, "UPDATE of multiple tables on sharding table", "update each table in separate statements"}
+	// UnsupportedMultiTableDelete DELETE with multiple tables
+	UnsupportedMultiTableDelete = &Unsupported{ErrNotSupportedYet, "DELETE of multiple tables on sharding table", "delete from each table in separate statements"}
+	// UnsupportedPartitionSelection PARTITION clause of table name
+	UnsupportedPartitionSelection = &Unsupported{ErrNotSupportedYet, "PARTITION clause on sharding table", "remove the PARTITION clause, rows are routed by the shard key"}
+	// UnsupportedQualifiedUsingColumn JOIN ... USING with qualified column
+	UnsupportedQualifiedUsingColumn = &Unsupported{ErrNotSupportedYet, "JOIN USING column qualified with %s", "use unqualified column names in USING, or use ON condition"}
+	// UnsupportedSubqueryInShardKey IN (SELECT ...) on sharding table
+	UnsupportedSubqueryInShardKey = &Unsupported{ErrNotSupportedYet, "IN subquery on sharding table", "query the values first and use IN with constant list"}
+	// UnsupportedAggregateFunc aggregate function merged across shards
+	UnsupportedAggregateFunc = &Unsupported{ErrNotSupportedYet, "aggregate function %s across shards", "add the shard key to WHERE to route to a single shard"}
+)
+
+// Err create SQLError of the unsupported feature, args are used to format Feature
+func (u *Unsupported) Err(args ...interface{}) *SQLError {
+	feature := u.Feature
+	if len(args) != 0 {
+		feature = fmt.Sprintf(u.Feature, args...)
+	}
+	return NewError(u.Code, fmt.Sprintf("gaea does not support %s, %s", feature, u.Advice))
+}
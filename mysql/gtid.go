@@ -0,0 +1,188 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SID is server uuid of gtid
+type SID [16]byte
+
+// ParseSID parse uuid like 3e11fa47-71ca-11e1-9e33-c80aa9429562
+func ParseSID(s string) (SID, error) {
+	var sid SID
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != len(sid) {
+		return sid, fmt.Errorf("invalid server uuid: %s", s)
+	}
+	copy(sid[:], b)
+	return sid, nil
+}
+
+// String return uuid format of sid
+func (s SID) String() string {
+	h := hex.EncodeToString(s[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// GTID is one global transaction id, uuid:gno
+type GTID struct {
+	SID SID
+	GNO int64
+}
+
+// String return text format of gtid
+func (g GTID) String() string {
+	return g.SID.String() + ":" + strconv.FormatInt(g.GNO, 10)
+}
+
+// GTIDInterval closed interval of gno
+type GTIDInterval struct {
+	Start int64
+	End   int64
+}
+
+// GTIDSet is set of gtids, such as gtid_executed
+type GTIDSet struct {
+	sets map[SID][]GTIDInterval // 每个uuid的区间按Start排序且不重叠、不相邻
+}
+
+// NewGTIDSet create empty gtid set
+func NewGTIDSet() *GTIDSet {
+	return &GTIDSet{sets: make(map[SID][]GTIDInterval)}
+}
+
+// ParseGTIDSet parse text format of gtid set, such as uuid1:1-5:7,uuid2:1-3
+func ParseGTIDSet(s string) (*GTIDSet, error) {
+	set := NewGTIDSet()
+	s = strings.Replace(strings.TrimSpace(s), "\n", "", -1)
+	if s == "" {
+		return set, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid gtid set: %s", item)
+		}
+		sid, err := ParseSID(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts[1:] {
+			interval, err := parseGTIDInterval(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gtid set %s: %v", item, err)
+			}
+			set.addInterval(sid, interval)
+		}
+	}
+	return set, nil
+}
+
+func parseGTIDInterval(s string) (GTIDInterval, error) {
+	var interval GTIDInterval
+	var err error
+	bounds := strings.SplitN(s, "-", 2)
+	if interval.Start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return interval, err
+	}
+	interval.End = interval.Start
+	if len(bounds) == 2 {
+		if interval.End, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+			return interval, err
+		}
+	}
+	if interval.Start <= 0 || interval.End < interval.Start {
+		return interval, fmt.Errorf("invalid interval %s", s)
+	}
+	return interval, nil
+}
+
+// Add add one gtid to set
+func (s *GTIDSet) Add(gtid GTID) {
+	s.addInterval(gtid.SID, GTIDInterval{Start: gtid.GNO, End: gtid.GNO})
+}
+
+func (s *GTIDSet) addInterval(sid SID, interval GTIDInterval) {
+	intervals := append(s.sets[sid], interval)
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start < intervals[j].Start })
+	merged := intervals[:1]
+	for _, v := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if v.Start <= last.End+1 {
+			if v.End > last.End {
+				last.End = v.End
+			}
+			continue
+		}
+		merged = append(merged, v)
+	}
+	s.sets[sid] = merged
+}
+
+// Contains check if gtid is in set
+func (s *GTIDSet) Contains(gtid GTID) bool {
+	for _, v := range s.sets[gtid.SID] {
+		if gtid.GNO >= v.Start && gtid.GNO <= v.End {
+			return true
+		}
+	}
+	return false
+}
+
+// String return text format of gtid set, uuids are sorted
+func (s *GTIDSet) String() string {
+	items := make([]string, 0, len(s.sets))
+	for sid, intervals := range s.sets {
+		var b strings.Builder
+		b.WriteString(sid.String())
+		for _, v := range intervals {
+			b.WriteString(":" + strconv.FormatInt(v.Start, 10))
+			if v.End != v.Start {
+				b.WriteString("-" + strconv.FormatInt(v.End, 10))
+			}
+		}
+		items = append(items, b.String())
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// Encode return binary format of gtid set used in COM_BINLOG_DUMP_GTID:
+// uuid个数(8字节) + 每个uuid: uuid(16字节) + 区间个数(8字节) + 每个区间: 开始(8字节) + 结束(8字节, 不包含)
+func (s *GTIDSet) Encode() []byte {
+	sids := make([]SID, 0, len(s.sets))
+	for sid := range s.sets {
+		sids = append(sids, sid)
+	}
+	sort.Slice(sids, func(i, j int) bool { return sids[i].String() < sids[j].String() })
+
+	data := AppendUint64(nil, uint64(len(sids)))
+	for _, sid := range sids {
+		data = append(data, sid[:]...)
+		intervals := s.sets[sid]
+		data = AppendUint64(data, uint64(len(intervals)))
+		for _, v := range intervals {
+			data = AppendUint64(data, uint64(v.Start))
+			data = AppendUint64(data, uint64(v.End+1))
+		}
+	}
+	return data
+}
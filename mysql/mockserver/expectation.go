@@ -0,0 +1,115 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockserver
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// Expectation means a scripted response of queries matching the pattern
+type Expectation struct {
+	pattern *regexp.Regexp
+
+	result *mysql.Result
+	err    *mysql.SQLError
+
+	delay               time.Duration // 返回结果前等待的时间
+	packetDelay         time.Duration // 每个packet之间等待的时间, 模拟慢读
+	disconnect          bool          // 不返回结果直接断开连接
+	disconnectAfterRows int           // 写入多少行后断开连接, 小于0表示不断开
+
+	times   int // 期望匹配的次数, 0表示不限次数但至少一次
+	matched int
+}
+
+func newExpectation(pattern string) *Expectation {
+	return &Expectation{
+		pattern:             regexp.MustCompile(pattern),
+		result:              &mysql.Result{},
+		disconnectAfterRows: -1,
+	}
+}
+
+// WillReturnRows return a resultset built from column names and rows
+func (e *Expectation) WillReturnRows(names []string, values [][]interface{}) *Expectation {
+	rs, err := mysql.BuildResultset(nil, names, values)
+	if err != nil {
+		panic(err)
+	}
+	if len(values) == 0 {
+		// BuildResultset only builds fields from the first row
+		for _, name := range names {
+			rs.Fields = append(rs.Fields, &mysql.Field{Name: []byte(name), Type: mysql.TypeVarString, Charset: 33})
+		}
+	}
+	e.result = &mysql.Result{Resultset: rs}
+	return e
+}
+
+// WillReturnOK return an OK packet
+func (e *Expectation) WillReturnOK(affectedRows, insertID uint64) *Expectation {
+	e.result = &mysql.Result{AffectedRows: affectedRows, InsertID: insertID}
+	return e
+}
+
+// WillReturnError return an error packet
+func (e *Expectation) WillReturnError(code uint16, message string) *Expectation {
+	e.err = mysql.NewError(code, message)
+	return e
+}
+
+// WillDelay wait d before writing the response, the wait can be interrupted by KILL QUERY
+func (e *Expectation) WillDelay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// WillWriteSlowly wait d between each packet of the response, to simulate slow reads of client
+func (e *Expectation) WillWriteSlowly(d time.Duration) *Expectation {
+	e.packetDelay = d
+	return e
+}
+
+// WillDisconnect close the connection without any response
+func (e *Expectation) WillDisconnect() *Expectation {
+	e.disconnect = true
+	return e
+}
+
+// WillDisconnectAfterRows close the connection after n rows of resultset are written
+func (e *Expectation) WillDisconnectAfterRows(n int) *Expectation {
+	e.disconnectAfterRows = n
+	return e
+}
+
+// Times set the exact count of queries matching the expectation
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times > 0 && e.matched >= e.times
+}
+
+func (e *Expectation) met() bool {
+	if e.times == 0 {
+		return e.matched > 0
+	}
+	return e.matched == e.times
+}
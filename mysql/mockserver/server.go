@@ -0,0 +1,534 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mockserver provides a mock MySQL server with scriptable responses,
+// used for testing the proxy and applications without real MySQL instances.
+//
+//	s, err := mockserver.NewServer("127.0.0.1:0", "root", "root")
+//	...
+//	defer s.Close()
+//	s.Expect(`^select id from t`).WillReturnRows([]string{"id"}, [][]interface{}{{1}, {2}})
+//	s.Expect(`^update t`).WillReturnError(mysql.ErrLockWaitTimeout, "Lock wait timeout exceeded").Times(1)
+//	s.Expect(`^select sleep`).WillDisconnectAfterRows(1)
+//	... connect s.Addr() and run queries ...
+//	if err := s.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+package mockserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+const serverCapability = mysql.ClientLongPassword | mysql.ClientLongFlag | mysql.ClientConnectWithDB |
+	mysql.ClientProtocol41 | mysql.ClientTransactions | mysql.ClientSecureConnection | mysql.ClientPluginAuth |
+	mysql.ClientCompress | mysql.ClientZstdCompressionAlgorithm
+
+// Server is a mock MySQL server
+type Server struct {
+	listener net.Listener
+	user     string
+	password string // 为空时不校验密码
+
+	authPlugin   string      // 握手后切换到的认证插件, 为空时使用mysql_native_password
+	tlsConfig    *tls.Config // 不为空时要求客户端使用TLS
+	deprecateEOF bool        // 握手时声明CLIENT_DEPRECATE_EOF
+
+	lock         sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+	queries      []string
+	conns        map[*mysql.Conn]struct{}
+	running      map[uint32]chan struct{} // 正在等待返回结果的连接, KILL QUERY时关闭对应的channel
+
+	connID uint32
+	wg     sync.WaitGroup
+}
+
+// NewServer create and start mock server listening on addr, use 127.0.0.1:0 for a random port
+func NewServer(addr, user, password string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		user:     user,
+		password: password,
+		conns:    make(map[*mysql.Conn]struct{}),
+		running:  make(map[uint32]chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Addr return listen address of server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// SetAuthPlugin let server switch to plugin after handshake response,
+// support mysql_native_password, client_ed25519 and mysql_clear_password. Should be called before connecting.
+func (s *Server) SetAuthPlugin(plugin string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.authPlugin = plugin
+}
+
+// SetTLSConfig require clients to connect with tls. Should be called before connecting.
+func (s *Server) SetTLSConfig(cfg *tls.Config) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tlsConfig = cfg
+}
+
+// SetDeprecateEOF let server advertise CLIENT_DEPRECATE_EOF like MySQL 5.7.5 and above,
+// resultsets are ended with OK packets if client negotiates it. Should be called before connecting.
+func (s *Server) SetDeprecateEOF(enable bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.deprecateEOF = enable
+}
+
+// Expect register an expectation of queries matching the regexp pattern,
+// expectations are matched in registration order.
+func (s *Server) Expect(pattern string) *Expectation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e := newExpectation(pattern)
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// ExpectationsWereMet check all expectations were matched and no unexpected query received
+func (s *Server) ExpectationsWereMet() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, e := range s.expectations {
+		if !e.met() {
+			return fmt.Errorf("expectation not met, pattern: %s, times: %d, matched: %d", e.pattern, e.times, e.matched)
+		}
+	}
+	if len(s.unexpected) != 0 {
+		return fmt.Errorf("unexpected queries: %v", s.unexpected)
+	}
+	return nil
+}
+
+// Queries return all received queries
+func (s *Server) Queries() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// KillConnections close all client connections, to simulate network faults
+func (s *Server) KillConnections() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Close stop server and close all client connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.KillConnections()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := mysql.NewConn(conn)
+		c.SetConnectionID(atomic.AddUint32(&s.connID, 1))
+		s.lock.Lock()
+		s.conns[c] = struct{}{}
+		s.lock.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(c, conn)
+	}
+}
+
+func (s *Server) serve(c *mysql.Conn, conn net.Conn) {
+	defer func() {
+		s.lock.Lock()
+		delete(s.conns, c)
+		s.lock.Unlock()
+		c.Close()
+		s.wg.Done()
+	}()
+
+	c, deprecateEOF, err := s.handshake(c, conn)
+	if err != nil {
+		return
+	}
+
+	for {
+		c.SetSequence(0)
+		data, err := c.ReadPacket()
+		if err != nil {
+			return
+		}
+		if err := s.dispatch(c, deprecateEOF, data[0], data[1:]); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(c *mysql.Conn, deprecateEOF bool, cmd byte, data []byte) error {
+	switch cmd {
+	case mysql.ComQuit:
+		return fmt.Errorf("client quit")
+	case mysql.ComPing, mysql.ComInitDB:
+		return c.WriteOKPacket(0, 0, mysql.ServerStatusAutocommit, 0)
+	case mysql.ComFieldList:
+		return c.WritePacket(endPacket(deprecateEOF))
+	case mysql.ComQuery:
+		return s.handleQuery(c, deprecateEOF, string(data))
+	default:
+		return c.WriteErrorPacket(mysql.ErrUnknown, "HY000", "command %d not supported by mock server", cmd)
+	}
+}
+
+func (s *Server) handleQuery(c *mysql.Conn, deprecateEOF bool, query string) error {
+	e := s.match(query)
+	if e == nil {
+		if id, ok := parseKillQuery(query); ok {
+			s.killQuery(id)
+			return c.WriteOKPacket(0, 0, mysql.ServerStatusAutocommit, 0)
+		}
+		// 后端连接初始化时的SET语句默认返回OK
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SET") {
+			return c.WriteOKPacket(0, 0, mysql.ServerStatusAutocommit, 0)
+		}
+		s.lock.Lock()
+		s.unexpected = append(s.unexpected, query)
+		s.lock.Unlock()
+		return c.WriteErrorPacket(mysql.ErrUnknown, "HY000", "unexpected query by mock server: %s", query)
+	}
+
+	if e.delay > 0 && !s.wait(c.GetConnectionID(), e.delay) {
+		return c.WriteErrorPacketFromError(mysql.NewDefaultError(mysql.ErrQueryInterrupted))
+	}
+	if e.disconnect {
+		return fmt.Errorf("disconnect by expectation")
+	}
+	if e.err != nil {
+		return c.WriteErrorPacketFromError(e.err)
+	}
+	if e.result.Resultset == nil {
+		return c.WriteOKPacket(e.result.AffectedRows, e.result.InsertID, mysql.ServerStatusAutocommit, 0)
+	}
+	return s.writeResultset(c, e, deprecateEOF)
+}
+
+// wait sleep d before writing the response, return false if the query is killed by KILL QUERY
+func (s *Server) wait(connID uint32, d time.Duration) bool {
+	killed := make(chan struct{})
+	s.lock.Lock()
+	s.running[connID] = killed
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.running, connID)
+		s.lock.Unlock()
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-killed:
+		return false
+	}
+}
+
+// killQuery interrupt the query waiting for response on connection connID, like KILL QUERY of MySQL
+func (s *Server) killQuery(connID uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if killed, ok := s.running[connID]; ok {
+		close(killed)
+		delete(s.running, connID)
+	}
+}
+
+func parseKillQuery(query string) (uint32, bool) {
+	var id uint32
+	if _, err := fmt.Sscanf(strings.ToUpper(strings.TrimSpace(query)), "KILL QUERY %d", &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+func (s *Server) match(query string) *Expectation {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.queries = append(s.queries, query)
+	for _, e := range s.expectations {
+		if e.exhausted() || !e.pattern.MatchString(query) {
+			continue
+		}
+		e.matched++
+		return e
+	}
+	return nil
+}
+
+func (s *Server) writeResultset(c *mysql.Conn, e *Expectation, deprecateEOF bool) error {
+	rs := e.result.Resultset
+	write := func(data []byte) error {
+		if e.packetDelay > 0 {
+			time.Sleep(e.packetDelay)
+		}
+		return c.WritePacket(data)
+	}
+
+	if err := write(mysql.AppendLenEncInt(nil, uint64(len(rs.Fields)))); err != nil {
+		return err
+	}
+	for _, f := range rs.Fields {
+		if err := write(f.Dump()); err != nil {
+			return err
+		}
+	}
+	if !deprecateEOF {
+		if err := write(eofPacket()); err != nil {
+			return err
+		}
+	}
+	for i, row := range rs.RowDatas {
+		if e.disconnectAfterRows >= 0 && i >= e.disconnectAfterRows {
+			return fmt.Errorf("disconnect by expectation")
+		}
+		if err := write(row); err != nil {
+			return err
+		}
+	}
+	if e.disconnectAfterRows >= 0 && len(rs.RowDatas) <= e.disconnectAfterRows {
+		return fmt.Errorf("disconnect by expectation")
+	}
+	return write(endPacket(deprecateEOF))
+}
+
+// handshake return the connection after handshake, which is a new one if switched to tls,
+// and whether client negotiated CLIENT_DEPRECATE_EOF
+func (s *Server) handshake(c *mysql.Conn, conn net.Conn) (*mysql.Conn, bool, error) {
+	s.lock.Lock()
+	authPlugin, tlsConfig, deprecateEOF := s.authPlugin, s.tlsConfig, s.deprecateEOF
+	s.lock.Unlock()
+
+	salt, err := mysql.RandomBuf(20)
+	if err != nil {
+		return c, false, err
+	}
+	capability := serverCapability
+	if tlsConfig != nil {
+		capability |= mysql.ClientSSL
+	}
+	if deprecateEOF {
+		capability |= mysql.ClientDeprecateEOF
+	}
+	if err := c.WritePacket(initialHandshake(c.GetConnectionID(), salt, capability)); err != nil {
+		return c, false, err
+	}
+
+	// 不能使用带缓冲的读, 否则会读走SSLRequest之后的TLS握手数据
+	data, err := readPacketDirect(c)
+	if err != nil {
+		return c, false, err
+	}
+	if tlsConfig != nil {
+		if c, err = s.switchToTLS(c, conn, tlsConfig, data); err != nil {
+			return c, false, err
+		}
+		if data, err = c.ReadPacket(); err != nil {
+			return c, false, err
+		}
+	}
+
+	user, auth, err := parseHandshakeResponse(data)
+	if err != nil {
+		return c, false, c.WriteErrorPacket(mysql.ErrHandshake, "08S01", "%v", err)
+	}
+	if user != s.user {
+		c.WriteErrorPacket(mysql.ErrAccessDenied, "28000", "Access denied for user '%s'", user)
+		return c, false, fmt.Errorf("access denied")
+	}
+
+	var passed bool
+	switch authPlugin {
+	case "", mysql.AUTH_NATIVE_PASSWORD:
+		passed = bytes.Equal(auth, mysql.CalcPassword(salt, []byte(s.password)))
+	case mysql.AUTH_CLIENT_ED25519:
+		nonce, _ := mysql.RandomBuf(32)
+		resp, err := writeAuthSwitch(c, authPlugin, nonce)
+		if err != nil {
+			return c, false, err
+		}
+		passed = mysql.VerifyEd25519Password(nonce, []byte(s.password), resp)
+	case mysql.AUTH_CLEAR_PASSWORD:
+		resp, err := writeAuthSwitch(c, authPlugin, nil)
+		if err != nil {
+			return c, false, err
+		}
+		passed = string(bytes.TrimSuffix(resp, []byte{0})) == s.password
+	default:
+		return c, false, fmt.Errorf("unsupported auth plugin: %s", authPlugin)
+	}
+	if s.password != "" && !passed {
+		c.WriteErrorPacket(mysql.ErrAccessDenied, "28000", "Access denied for user '%s'", user)
+		return c, false, fmt.Errorf("access denied")
+	}
+	if err := c.WriteOKPacket(0, 0, mysql.ServerStatusAutocommit, 0); err != nil {
+		return c, false, err
+	}
+	clientCapability, _, _ := mysql.ReadUint32(data, 0)
+	deprecateEOF = deprecateEOF && clientCapability&mysql.ClientDeprecateEOF != 0
+	// 客户端请求压缩时, 握手完成后开启压缩协议, zstd的压缩级别是握手响应的最后一个字节
+	if clientCapability&mysql.ClientCompress != 0 {
+		return c, deprecateEOF, c.EnableCompression(mysql.CompressionZlib, 0)
+	}
+	if clientCapability&mysql.ClientZstdCompressionAlgorithm != 0 {
+		return c, deprecateEOF, c.EnableCompression(mysql.CompressionZstd, int(data[len(data)-1]))
+	}
+	return c, deprecateEOF, nil
+}
+
+// switchToTLS handle SSLRequest packet and replace c with the tls one
+func (s *Server) switchToTLS(c *mysql.Conn, conn net.Conn, tlsConfig *tls.Config, data []byte) (*mysql.Conn, error) {
+	capability, _, ok := mysql.ReadUint32(data, 0)
+	if !ok || capability&mysql.ClientSSL == 0 {
+		c.WriteErrorPacket(mysql.ErrAccessDenied, "28000", "Connections using insecure transport are prohibited")
+		return c, fmt.Errorf("client does not use tls")
+	}
+	tlsConn := tls.Server(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return c, err
+	}
+
+	nc := mysql.NewConn(tlsConn)
+	nc.SetConnectionID(c.GetConnectionID())
+	nc.SetSequence(c.GetSequence())
+	s.lock.Lock()
+	delete(s.conns, c)
+	s.conns[nc] = struct{}{}
+	s.lock.Unlock()
+	return nc, nil
+}
+
+func readPacketDirect(c *mysql.Conn) ([]byte, error) {
+	defer c.RecycleReadPacket()
+	data, err := c.ReadEphemeralPacketDirect()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// writeAuthSwitch send AuthSwitchRequest and return the response of client
+func writeAuthSwitch(c *mysql.Conn, plugin string, authData []byte) ([]byte, error) {
+	data := []byte{mysql.AuthSwitchHeader}
+	data = append(data, plugin...)
+	data = append(data, 0)
+	data = append(data, authData...)
+	if err := c.WritePacket(data); err != nil {
+		return nil, err
+	}
+	return c.ReadPacket()
+}
+
+func initialHandshake(connID uint32, salt []byte, capability uint32) []byte {
+	var data []byte
+	data = append(data, mysql.ProtocolVersion)
+	data = append(data, mysql.ServerVersion...)
+	data = append(data, 0)
+	data = mysql.AppendUint32(data, connID)
+	data = append(data, salt[:8]...)
+	data = append(data, 0)
+	data = mysql.AppendUint16(data, uint16(capability))
+	data = append(data, byte(mysql.DefaultCollationID))
+	data = mysql.AppendUint16(data, mysql.ServerStatusAutocommit)
+	data = mysql.AppendUint16(data, uint16(capability>>16))
+	data = append(data, byte(len(salt)+1))
+	data = append(data, make([]byte, 10)...)
+	data = append(data, salt[8:]...)
+	data = append(data, 0)
+	data = append(data, mysql.AUTH_NATIVE_PASSWORD...)
+	data = append(data, 0)
+	return data
+}
+
+func parseHandshakeResponse(data []byte) (string, []byte, error) {
+	capability, pos, ok := mysql.ReadUint32(data, 0)
+	if !ok {
+		return "", nil, fmt.Errorf("invalid handshake response")
+	}
+	// skip max packet size, charset and reserved bytes
+	pos += 4 + 1 + 23
+	user, pos, ok := mysql.ReadNullString(data, pos)
+	if !ok {
+		return "", nil, fmt.Errorf("invalid user in handshake response")
+	}
+
+	var l uint64
+	if capability&mysql.ClientPluginAuthLenencClientData != 0 {
+		l, pos, _, ok = mysql.ReadLenEncInt(data, pos)
+	} else {
+		var b byte
+		b, pos, ok = mysql.ReadByte(data, pos)
+		l = uint64(b)
+	}
+	if !ok {
+		return "", nil, fmt.Errorf("invalid auth data in handshake response")
+	}
+	auth, _, ok := mysql.ReadBytesCopy(data, pos, int(l))
+	if !ok {
+		return "", nil, fmt.Errorf("invalid auth data in handshake response")
+	}
+	return user, auth, nil
+}
+
+func eofPacket() []byte {
+	data := []byte{mysql.EOFHeader, 0, 0}
+	return mysql.AppendUint16(data, mysql.ServerStatusAutocommit)
+}
+
+// endPacket return packet at the end of resultset, OK packet with EOF header if CLIENT_DEPRECATE_EOF is negotiated
+func endPacket(deprecateEOF bool) []byte {
+	if !deprecateEOF {
+		return eofPacket()
+	}
+	data := []byte{mysql.EOFHeader, 0, 0}
+	data = mysql.AppendUint16(data, mysql.ServerStatusAutocommit)
+	return mysql.AppendUint16(data, 0)
+}
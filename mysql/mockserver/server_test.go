@@ -0,0 +1,249 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func newTestServer(t *testing.T) (*Server, *backend.DirectConnection) {
+	s, err := NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc, err := backend.NewDirectConnection(s.Addr(), "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33))
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, dc
+}
+
+func TestServerResultset(t *testing.T) {
+	s, dc := newTestServer(t)
+	defer s.Close()
+	defer dc.Close()
+
+	s.Expect(`^select id, name from t`).WillReturnRows([]string{"id", "name"}, [][]interface{}{{1, "a"}, {2, "b"}})
+	s.Expect(`^update t`).WillReturnOK(3, 0).Times(1)
+
+	r, err := dc.Execute("select id, name from t where id > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowNumber() != 2 {
+		t.Fatalf("row number not equal, expect: 2, actual: %d", r.RowNumber())
+	}
+	if name, _ := r.GetString(1, 1); name != "b" {
+		t.Errorf("value not equal, expect: b, actual: %s", name)
+	}
+
+	r, err = dc.Execute("update t set name = 'c'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.AffectedRows != 3 {
+		t.Errorf("affected rows not equal, expect: 3, actual: %d", r.AffectedRows)
+	}
+	if err := s.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Times(1)已用完, 再次执行视为未预期的查询
+	if _, err := dc.Execute("update t set name = 'd'"); err == nil {
+		t.Error("expect error for unexpected query")
+	}
+	if err := s.ExpectationsWereMet(); err == nil {
+		t.Error("expect error for unexpected query")
+	}
+}
+
+func TestServerError(t *testing.T) {
+	s, dc := newTestServer(t)
+	defer s.Close()
+	defer dc.Close()
+
+	s.Expect(`^delete`).WillReturnError(mysql.ErrLockWaitTimeout, "Lock wait timeout exceeded")
+	_, err := dc.Execute("delete from t")
+	sqlErr, ok := err.(*mysql.SQLError)
+	if !ok {
+		t.Fatalf("expect SQLError, actual: %v", err)
+	}
+	if sqlErr.SQLCode() != mysql.ErrLockWaitTimeout {
+		t.Errorf("error code not equal, expect: %d, actual: %d", mysql.ErrLockWaitTimeout, sqlErr.SQLCode())
+	}
+}
+
+func TestServerNotMet(t *testing.T) {
+	s, dc := newTestServer(t)
+	defer s.Close()
+	defer dc.Close()
+
+	s.Expect(`^select 1`).WillReturnRows([]string{"1"}, [][]interface{}{{1}}).Times(2)
+	if _, err := dc.Execute("select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ExpectationsWereMet(); err == nil {
+		t.Error("expect error for expectation not met")
+	}
+}
+
+func TestServerAccessDenied(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := backend.NewDirectConnection(s.Addr(), "root", "wrong", "", mysql.CharsetUTF8, mysql.CollationID(33)); err == nil {
+		t.Error("expect access denied")
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s, dc := newTestServer(t)
+	defer s.Close()
+	defer dc.Close()
+
+	s.Expect(`^select slow`).WillReturnRows([]string{"id"}, [][]interface{}{{1}}).WillDelay(50 * time.Millisecond).Times(1)
+	s.Expect(`^select broken`).WillReturnRows([]string{"id"}, [][]interface{}{{1}, {2}, {3}}).WillDisconnectAfterRows(2)
+
+	start := time.Now()
+	if _, err := dc.Execute("select slow"); err != nil {
+		t.Fatal(err)
+	}
+	if cost := time.Since(start); cost < 50*time.Millisecond {
+		t.Errorf("expect delay at least 50ms, actual: %v", cost)
+	}
+
+	if _, err := dc.Execute("select broken"); err == nil {
+		t.Error("expect error for mid-stream disconnect")
+	}
+}
+
+func TestServerSlowWrite(t *testing.T) {
+	s, dc := newTestServer(t)
+	defer s.Close()
+	defer dc.Close()
+
+	// 1个column count + 1个field + 2个EOF + 2行, 共6个packet
+	s.Expect(`^select`).WillReturnRows([]string{"id"}, [][]interface{}{{1}, {2}}).WillWriteSlowly(10 * time.Millisecond)
+	start := time.Now()
+	r, err := dc.Execute("select id from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.RowNumber() != 2 {
+		t.Errorf("row number not equal, expect: 2, actual: %d", r.RowNumber())
+	}
+	if cost := time.Since(start); cost < 60*time.Millisecond {
+		t.Errorf("expect slow write at least 60ms, actual: %v", cost)
+	}
+}
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestServerEd25519Auth(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.SetAuthPlugin(mysql.AUTH_CLIENT_ED25519)
+
+	dc, err := backend.NewDirectConnection(s.Addr(), "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.Close()
+
+	if _, err := backend.NewDirectConnection(s.Addr(), "root", "wrong", "", mysql.CharsetUTF8, mysql.CollationID(33)); err == nil {
+		t.Error("expect access denied")
+	}
+}
+
+func TestServerClearPasswordAuth(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.SetAuthPlugin(mysql.AUTH_CLEAR_PASSWORD)
+
+	// 非TLS连接拒绝发送明文密码
+	if _, err := backend.NewDirectConnection(s.Addr(), "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33)); err == nil {
+		t.Fatal("expect error for clear password without tls")
+	}
+
+	s.SetTLSConfig(newTestTLSConfig(t))
+	dc, err := backend.NewDirectConnectionWithTLS(s.Addr(), "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+
+	s.Expect(`^select 1`).WillReturnRows([]string{"1"}, [][]interface{}{{1}})
+	if _, err := dc.Execute("select 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerEndpointFailover(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", "root", "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 第一个地址不可用时连接下一个地址
+	dc, err := backend.NewDirectConnection("127.0.0.1:1,"+s.Addr(), "root", "root", "", mysql.CharsetUTF8, mysql.CollationID(33))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	if dc.GetAddr() != s.Addr() {
+		t.Errorf("connected addr not equal, expect: %s, actual: %s", s.Addr(), dc.GetAddr())
+	}
+}
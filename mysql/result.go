@@ -600,6 +600,7 @@ func formatField(field *Field, value interface{}) error {
 		field.Charset = 63
 		field.Type = TypeDouble
 		field.Flag = uint16(BinaryFlag | NotNullFlag)
+		field.Decimal = NotFixedDec
 	case string, []byte:
 		field.Charset = 33
 		field.Type = TypeVarString
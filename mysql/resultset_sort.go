@@ -77,26 +77,26 @@ func (r *ResultsetSorter) Len() int {
 }
 
 func (r *ResultsetSorter) Less(i, j int) bool {
-	v1 := r.Values[i]
-	v2 := r.Values[j]
+	return CompareRows(r.Values[i], r.Values[j], r.sk) < 0
+}
 
-	for _, k := range r.sk {
+// CompareRows 按SortKey比较两行, 返回值小于0表示v1排在v2之前
+func CompareRows(v1, v2 []interface{}, sk []SortKey) int {
+	for _, k := range sk {
 		v := cmpValue(v1[k.Column], v2[k.Column])
 
 		if k.Direction == SortDesc {
 			v = -v
 		}
 
-		if v < 0 {
-			return true
-		} else if v > 0 {
-			return false
+		if v != 0 {
+			return v
 		}
 
 		//equal, cmp next key
 	}
 
-	return false
+	return 0
 }
 
 //compare value using asc
@@ -92,7 +92,14 @@ var ReplaceNumbersInWords = false
 // original query without affecting its performance characteristics. For
 // example, "ORDER BY col ASC" is the same as "ORDER BY col", so "ASC" in the
 // fingerprint is removed.
+// Literals are replaced by a number before fingerprinting, so hex literals,
+// strings with charset introducer and strings with escaped quotes are handled
+// the same way as numbers.
 func GetFingerprint(q string) string {
+	return getFingerprint(normalizeSQL(q, "0").SQL)
+}
+
+func getFingerprint(q string) string {
 	q += " " // need range to run off end of original query
 	prevWord := ""
 	f := make([]byte, len(q)+1)
@@ -391,6 +391,32 @@ func TestFingerprintTricky(t *testing.T) {
 
 }
 
+func TestFingerprintLiterals(t *testing.T) {
+	var q, fp string
+
+	// Doubled quotes in string
+	q = "select * from t where a='it''s'"
+	fp = "select * from t where a=?"
+	if GetFingerprint(q) != fp {
+		t.Fatalf("query=%s,and fingerPrint=%s\n", q, fp)
+	}
+
+	// Strings with charset introducer
+	q = "select * from t where a=_utf8mb4'abc' collate utf8mb4_bin and b = _binary 'abc' and c=N'abc'"
+	fp = "select * from t where a=? collate utf8mb4_bin and b = ? and c=?"
+	if GetFingerprint(q) != fp {
+		t.Fatalf("query=%s,and fingerPrint=%s\n", q, fp)
+	}
+
+	// Hex/bit after operator
+	q = "select * from t where a = X'1F' and c=b'01'"
+	fp = "select * from t where a = ? and c=?"
+	if GetFingerprint(q) != fp {
+		t.Fatalf("query=%s,and fingerPrint=%s\n", q, fp)
+	}
+
+}
+
 func TestNumbersInFunctions(t *testing.T) {
 	var q, fp string
 
@@ -0,0 +1,299 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"strings"
+)
+
+// LiteralType type of literal in sql
+type LiteralType int
+
+// literal types
+const (
+	LiteralString LiteralType = iota // 'abc', "abc", _utf8mb4'abc', N'abc'
+	LiteralNumber                    // 123, 1.5, 1e-9
+	LiteralHex                       // 0x1F, X'1F'
+	LiteralBit                       // 0b01, B'01'
+)
+
+// Literal literal extracted from sql
+type Literal struct {
+	Type    LiteralType
+	Offset  int    // 在原始SQL中的字节偏移
+	Text    string // 原始SQL中的文本, 包含引号和字符集前缀
+	Value   string // 字符串为去掉引号并处理转义后的值, hex和bit为去掉前缀和引号的数字
+	Charset string // 字符集前缀, 如_utf8mb4'abc'为utf8mb4, N'abc'为utf8, 没有前缀时为空
+}
+
+// NormalizedSQL normalized sql and literals extracted from it
+type NormalizedSQL struct {
+	SQL      string // 字面量替换为?, 去掉注释并合并空白, 其他部分保持原样
+	Literals []Literal
+}
+
+// NormalizeSQL replace literals in q with ?, and return literals with their positions.
+// 与GetFingerprint不同, 保留标识符大小写和IN/VALUES列表的长度, 可用于执行计划缓存, 日志脱敏和限流等场景.
+// /*!...*/和/*+...*/中的内容原样保留, 其他注释会被去掉.
+func NormalizeSQL(q string) *NormalizedSQL {
+	return normalizeSQL(q, "?")
+}
+
+func normalizeSQL(q string, placeholder string) *NormalizedSQL {
+	n := &NormalizedSQL{}
+	var b strings.Builder
+	b.Grow(len(q))
+
+	pendingSpace := false
+	write := func(s string) {
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteString(s)
+	}
+	addLiteral := func(tp LiteralType, start, end int, value, charset string) {
+		n.Literals = append(n.Literals, Literal{Type: tp, Offset: start, Text: q[start:end], Value: value, Charset: charset})
+		write(placeholder)
+	}
+
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case isSpace(rune(c)):
+			pendingSpace = true
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--") && (i+2 == len(q) || q[i+2] <= ' ')):
+			end := strings.IndexByte(q[i:], '\n')
+			if end < 0 {
+				end = len(q) - i
+			}
+			pendingSpace = true
+			i += end
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			end := strings.Index(q[i+2:], "*/")
+			if end < 0 {
+				end = len(q)
+			} else {
+				end += i + 4
+			}
+			if strings.HasPrefix(q[i:], "/*!") || strings.HasPrefix(q[i:], "/*+") {
+				write(q[i:end])
+			} else {
+				pendingSpace = true
+			}
+			i = end
+		case c == '\'' || c == '"':
+			end, value := scanQuotedString(q, i)
+			addLiteral(LiteralString, i, end, value, "")
+			i = end
+		case c == '`':
+			end := scanQuotedIdentifier(q, i)
+			write(q[i:end])
+			i = end
+		case isDigit(c) || (c == '.' && i+1 < len(q) && isDigit(q[i+1]) && (i == 0 || !isIdentifierChar(q[i-1]) && q[i-1] != '`')):
+			tp, end, value := scanNumber(q, i)
+			if end < len(q) && isIdentifierChar(q[end]) {
+				// 123abc, 0xzz是标识符
+				end = scanIdentifier(q, i)
+				write(q[i:end])
+			} else {
+				addLiteral(tp, i, end, value, "")
+			}
+			i = end
+		case isIdentifierChar(c):
+			end := scanIdentifier(q, i)
+			if tp, lend, value, charset, ok := scanPrefixedLiteral(q, i, end); ok {
+				addLiteral(tp, i, lend, value, charset)
+				i = lend
+				continue
+			}
+			write(q[i:end])
+			i = end
+		default:
+			write(q[i : i+1])
+			i++
+		}
+	}
+
+	n.SQL = b.String()
+	return n
+}
+
+// scanPrefixedLiteral scan X'1F', B'01', N'abc' and _charset'abc'
+func scanPrefixedLiteral(q string, start, wordEnd int) (LiteralType, int, string, string, bool) {
+	word := strings.ToLower(q[start:wordEnd])
+	if wordEnd < len(q) && q[wordEnd] == '\'' {
+		switch word {
+		case "x", "b":
+			end, value := scanQuotedString(q, wordEnd)
+			if word == "x" {
+				return LiteralHex, end, value, "", true
+			}
+			return LiteralBit, end, value, "", true
+		case "n":
+			end, value := scanQuotedString(q, wordEnd)
+			return LiteralString, end, value, "utf8", true
+		}
+	}
+
+	// 字符集前缀和字符串之间允许有空白, 如_binary 'abc'
+	if len(word) < 2 || word[0] != '_' || !IsValidCharset(word[1:]) {
+		return 0, 0, "", "", false
+	}
+	quote := wordEnd
+	for quote < len(q) && isSpace(rune(q[quote])) {
+		quote++
+	}
+	if quote == len(q) || (q[quote] != '\'' && q[quote] != '"') {
+		return 0, 0, "", "", false
+	}
+	end, value := scanQuotedString(q, quote)
+	return LiteralString, end, value, word[1:], true
+}
+
+// scanQuotedString scan '...' or "...", supports backslash escapes and doubled quotes
+func scanQuotedString(q string, start int) (int, string) {
+	quote := q[start]
+	var value strings.Builder
+	i := start + 1
+	for i < len(q) {
+		c := q[i]
+		if c == '\\' && i+1 < len(q) {
+			value.WriteString(unescapeChar(q[i+1]))
+			i += 2
+			continue
+		}
+		if c == quote {
+			if i+1 < len(q) && q[i+1] == quote {
+				value.WriteByte(quote)
+				i += 2
+				continue
+			}
+			return i + 1, value.String()
+		}
+		value.WriteByte(c)
+		i++
+	}
+	// 引号不完整时把剩余部分都当作字面量
+	return len(q), value.String()
+}
+
+func unescapeChar(c byte) string {
+	switch c {
+	case '0':
+		return "\x00"
+	case 'b':
+		return "\b"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'Z':
+		return "\x1a"
+	case '%', '_':
+		// \%和\_在LIKE中使用, MySQL保留反斜杠
+		return "\\" + string(c)
+	default:
+		return string(c)
+	}
+}
+
+func scanQuotedIdentifier(q string, start int) int {
+	i := start + 1
+	for i < len(q) {
+		if q[i] == '`' {
+			if i+1 < len(q) && q[i+1] == '`' {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(q)
+}
+
+// scanNumber scan 123, 1.5, .5, 1e-9, 0x1F and 0b01
+func scanNumber(q string, start int) (LiteralType, int, string) {
+	if q[start] == '0' && start+2 < len(q) {
+		prefix := q[start+1]
+		if prefix == 'x' || prefix == 'X' {
+			end := start + 2
+			for end < len(q) && isHexDigit(q[end]) {
+				end++
+			}
+			if end > start+2 {
+				return LiteralHex, end, q[start+2 : end]
+			}
+		}
+		if prefix == 'b' || prefix == 'B' {
+			end := start + 2
+			for end < len(q) && (q[end] == '0' || q[end] == '1') {
+				end++
+			}
+			if end > start+2 {
+				return LiteralBit, end, q[start+2 : end]
+			}
+		}
+	}
+
+	end := start
+	for end < len(q) && isDigit(q[end]) {
+		end++
+	}
+	if end < len(q) && q[end] == '.' {
+		end++
+		for end < len(q) && isDigit(q[end]) {
+			end++
+		}
+	}
+	if end < len(q) && (q[end] == 'e' || q[end] == 'E') {
+		exp := end + 1
+		if exp < len(q) && (q[exp] == '+' || q[exp] == '-') {
+			exp++
+		}
+		if exp < len(q) && isDigit(q[exp]) {
+			end = exp
+			for end < len(q) && isDigit(q[end]) {
+				end++
+			}
+		}
+	}
+	return LiteralNumber, end, q[start:end]
+}
+
+func scanIdentifier(q string, start int) int {
+	end := start
+	for end < len(q) && isIdentifierChar(q[end]) {
+		end++
+	}
+	return end
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// isIdentifierChar 非ASCII字符也可以出现在标识符中
+func isIdentifierChar(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' || c >= 0x80
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expect   string
+		literals []Literal
+	}{
+		{
+			sql:    "SELECT c FROM t1 WHERE id=1 AND name = 'abc'",
+			expect: "SELECT c FROM t1 WHERE id=? AND name = ?",
+			literals: []Literal{
+				{Type: LiteralNumber, Offset: 26, Text: "1", Value: "1"},
+				{Type: LiteralString, Offset: 39, Text: "'abc'", Value: "abc"},
+			},
+		},
+		{
+			sql:    "select * from t where a in (1, -2.5, 1e-9, .5)",
+			expect: "select * from t where a in (?, -?, ?, ?)",
+			literals: []Literal{
+				{Type: LiteralNumber, Offset: 28, Text: "1", Value: "1"},
+				{Type: LiteralNumber, Offset: 32, Text: "2.5", Value: "2.5"},
+				{Type: LiteralNumber, Offset: 37, Text: "1e-9", Value: "1e-9"},
+				{Type: LiteralNumber, Offset: 43, Text: ".5", Value: ".5"},
+			},
+		},
+		{
+			sql:    `select 'it''s', "a\"b", 'a\nb'`,
+			expect: "select ?, ?, ?",
+			literals: []Literal{
+				{Type: LiteralString, Offset: 7, Text: `'it''s'`, Value: "it's"},
+				{Type: LiteralString, Offset: 16, Text: `"a\"b"`, Value: `a"b`},
+				{Type: LiteralString, Offset: 24, Text: `'a\nb'`, Value: "a\nb"},
+			},
+		},
+		{
+			sql:    "select 0x1F, X'1f', 0b01, b'10'",
+			expect: "select ?, ?, ?, ?",
+			literals: []Literal{
+				{Type: LiteralHex, Offset: 7, Text: "0x1F", Value: "1F"},
+				{Type: LiteralHex, Offset: 13, Text: "X'1f'", Value: "1f"},
+				{Type: LiteralBit, Offset: 20, Text: "0b01", Value: "01"},
+				{Type: LiteralBit, Offset: 26, Text: "b'10'", Value: "10"},
+			},
+		},
+		{
+			sql:    "select * from t where a = _utf8mb4'abc' COLLATE utf8mb4_bin or a = _binary 'x' or a = N'y'",
+			expect: "select * from t where a = ? COLLATE utf8mb4_bin or a = ? or a = ?",
+			literals: []Literal{
+				{Type: LiteralString, Offset: 26, Text: "_utf8mb4'abc'", Value: "abc", Charset: "utf8mb4"},
+				{Type: LiteralString, Offset: 67, Text: "_binary 'x'", Value: "x", Charset: "binary"},
+				{Type: LiteralString, Offset: 86, Text: "N'y'", Value: "y", Charset: "utf8"},
+			},
+		},
+		{
+			sql:    "select /*!40001 SQL_NO_CACHE */ `a``1`, db2.t_3, 123abc, _id /* id */ from t -- comment\n where x = ?",
+			expect: "select /*!40001 SQL_NO_CACHE */ `a``1`, db2.t_3, 123abc, _id from t where x = ?",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			n := NormalizeSQL(test.sql)
+			if n.SQL != test.expect {
+				t.Errorf("normalized sql not match, expect: %s, actual: %s", test.expect, n.SQL)
+			}
+			if !reflect.DeepEqual(n.Literals, test.literals) {
+				t.Errorf("literals not match, expect: %+v, actual: %+v", test.literals, n.Literals)
+			}
+			for _, l := range n.Literals {
+				if test.sql[l.Offset:l.Offset+len(l.Text)] != l.Text {
+					t.Errorf("literal offset not match: %+v", l)
+				}
+			}
+		})
+	}
+}
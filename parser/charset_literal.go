@@ -0,0 +1,103 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/tidb/types"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+)
+
+// literalCollation 解析时字符串常量使用的字符序, 带_charset前缀的字符串使用该字符集的默认字符序(如utf8mb4_bin),
+// 两者不同才能在语法树中区分出带前缀的字符串
+const literalCollation = "utf8mb4_general_ci"
+
+// CharsetLiteralExpr string literal with charset introducer, such as _utf8mb4'...' or _binary'...'
+// pingcap parser还原SQL时会丢掉字符集前缀, 如果连接字符集为utf8, 丢掉_utf8mb4前缀后4字节的字符会被后端拒绝或替换为'?',
+// 所以解析后将带前缀的字符串替换为该节点, 还原时保留前缀
+type CharsetLiteralExpr struct {
+	*driver.ValueExpr
+}
+
+// Restore implement ast.Node
+func (c *CharsetLiteralExpr) Restore(ctx *format.RestoreCtx) error {
+	ctx.WritePlain("_" + c.Type.Charset)
+	return c.ValueExpr.Restore(ctx)
+}
+
+// Accept implement ast.Node
+func (c *CharsetLiteralExpr) Accept(v ast.Visitor) (ast.Node, bool) {
+	newNode, _ := v.Enter(c)
+	return v.Leave(newNode)
+}
+
+// charsetLiteralVisitor replace string literals with charset introducer by CharsetLiteralExpr
+type charsetLiteralVisitor struct{}
+
+// Enter implement ast.Visitor
+func (charsetLiteralVisitor) Enter(n ast.Node) (ast.Node, bool) {
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (charsetLiteralVisitor) Leave(n ast.Node) (ast.Node, bool) {
+	v, ok := n.(*driver.ValueExpr)
+	if !ok || v.Kind() != types.KindString || v.Type.Charset == "" || v.Type.Collate == literalCollation {
+		return n, true
+	}
+	return &CharsetLiteralExpr{ValueExpr: v}, true
+}
+
+// hasCharsetIntroducer check if sql may contain string literal with charset introducer like _utf8mb4'...',
+// 用于跳过不含前缀的SQL, 避免每次解析都遍历语法树. 字符串、带引号的标识符和注释中的内容不检查
+func hasCharsetIntroducer(sql string) bool {
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(sql, i)
+			if err != nil {
+				return false
+			}
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end
+		default:
+			word, end := readWord(sql, i)
+			if word == "" {
+				continue
+			}
+			if word[0] == '_' {
+				if pos := skipSpaces(sql, end); pos < len(sql) && (sql[pos] == '\'' || sql[pos] == '"') {
+					return true
+				}
+			}
+			i = end - 1
+		}
+	}
+	return false
+}
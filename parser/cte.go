@@ -0,0 +1,334 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+)
+
+// commonTableExpr is a non-recursive common table expression in WITH clause
+type commonTableExpr struct {
+	name    model.CIStr
+	columns []string
+	sql     string // 子查询SQL, 每次引用时重新解析, 避免多处引用共享同一棵语法树
+}
+
+// HasWithClause check if sql starts with WITH clause
+func HasWithClause(sql string) bool {
+	word, _ := readWord(StripLeadingComments(sql), 0)
+	return strings.EqualFold(word, "with")
+}
+
+// parseWithClause 当前parser不支持WITH子句, 将非递归的公共表表达式内联为派生表后再解析
+// 多处引用同一个公共表表达式时, 每处引用都内联一份子查询
+func parseWithClause(p SQLParser, sql string) (ast.StmtNode, error) {
+	ctes, mainSQL, err := splitWithClause(StripLeadingComments(sql))
+	if err != nil {
+		return nil, err
+	}
+
+	inliner := &cteInliner{p: p}
+	for _, cte := range ctes {
+		// 公共表表达式可以引用前面定义的公共表表达式
+		if _, err := inliner.parseSubquery(cte); err != nil {
+			return nil, fmt.Errorf("parse common table expression %s error: %v", cte.name.O, err)
+		}
+		inliner.ctes = append(inliner.ctes, cte)
+	}
+
+	stmt, err := p.ParseOneStmt(mainSQL)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt.(type) {
+	case *ast.SelectStmt, *ast.UnionStmt:
+	default:
+		return nil, fmt.Errorf("common table expression is only supported in SELECT statement")
+	}
+	// 保留包含WITH子句的原始SQL, 生成SQL时可以从中找到公共表表达式中的常量
+	stmt.SetText(sql)
+	return inliner.inline(stmt)
+}
+
+// splitWithClause split WITH clause into common table expressions and the main statement
+func splitWithClause(sql string) ([]*commonTableExpr, string, error) {
+	_, pos := readWord(sql, 0)
+	pos = skipSpaces(sql, pos)
+	if word, _ := readWord(sql, pos); strings.EqualFold(word, "recursive") {
+		return nil, "", fmt.Errorf("recursive common table expression is not supported")
+	}
+
+	var ctes []*commonTableExpr
+	for {
+		cte := &commonTableExpr{}
+		name, end, err := readIdentifier(sql, pos)
+		if err != nil {
+			return nil, "", err
+		}
+		cte.name = model.NewCIStr(name)
+		pos = skipSpaces(sql, end)
+
+		if pos < len(sql) && sql[pos] == '(' {
+			end, err = matchParenthesis(sql, pos)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, c := range strings.Split(sql[pos+1:end], ",") {
+				c = strings.TrimSpace(c)
+				if len(c) > 1 && c[0] == '`' && c[len(c)-1] == '`' {
+					c = strings.Replace(c[1:len(c)-1], "``", "`", -1)
+				}
+				if c == "" {
+					return nil, "", fmt.Errorf("invalid column list of common table expression %s", name)
+				}
+				cte.columns = append(cte.columns, c)
+			}
+			pos = skipSpaces(sql, end+1)
+		}
+
+		word, end := readWord(sql, pos)
+		if !strings.EqualFold(word, "as") {
+			return nil, "", fmt.Errorf("expect AS after common table expression %s", name)
+		}
+		pos = skipSpaces(sql, end)
+		if pos >= len(sql) || sql[pos] != '(' {
+			return nil, "", fmt.Errorf("expect subquery of common table expression %s", name)
+		}
+		end, err = matchParenthesis(sql, pos)
+		if err != nil {
+			return nil, "", err
+		}
+		cte.sql = strings.TrimSpace(sql[pos+1 : end])
+		ctes = append(ctes, cte)
+
+		pos = skipSpaces(sql, end+1)
+		if pos < len(sql) && sql[pos] == ',' {
+			pos = skipSpaces(sql, pos+1)
+			continue
+		}
+		return ctes, sql[pos:], nil
+	}
+}
+
+// skipSpaces 只跳过ASCII空白, 按字节判断时0x85、0xa0是多字节字符的后续字节, 不能当作空白
+func skipSpaces(sql string, pos int) int {
+	for pos < len(sql) && isSpaceByte(sql[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// readWord read letters, digits, '_' and '$' from pos, return the word and the end position
+func readWord(sql string, pos int) (string, int) {
+	end := pos
+	for end < len(sql) {
+		c := sql[end]
+		if !(c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80) {
+			break
+		}
+		end++
+	}
+	return sql[pos:end], end
+}
+
+// readIdentifier read a bare or back quoted identifier
+func readIdentifier(sql string, pos int) (string, int, error) {
+	if pos < len(sql) && sql[pos] == '`' {
+		end, err := skipQuoted(sql, pos)
+		if err != nil {
+			return "", 0, err
+		}
+		return strings.Replace(sql[pos+1:end-1], "``", "`", -1), end, nil
+	}
+	word, end := readWord(sql, pos)
+	if word == "" {
+		return "", 0, fmt.Errorf("expect name of common table expression")
+	}
+	return word, end, nil
+}
+
+// skipQuoted return the position after the quoted string starting at pos
+func skipQuoted(sql string, pos int) (int, error) {
+	return skipQuotedEscape(sql, pos, true)
+}
+
+// skipQuotedEscape 与skipQuoted相同, escapeBackslash为false时反斜杠不转义, 对应NO_BACKSLASH_ESCAPES
+func skipQuotedEscape(sql string, pos int, escapeBackslash bool) (int, error) {
+	quote := sql[pos]
+	for i := pos + 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			if quote != '`' && escapeBackslash {
+				i++
+			}
+		case quote:
+			// 连续两个引号表示引号本身
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed quote in WITH clause")
+}
+
+// matchParenthesis return the position of ')' matching '(' at pos, quotes and comments are skipped
+func matchParenthesis(sql string, pos int) (int, error) {
+	depth := 0
+	for i := pos; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(sql, i)
+			if err != nil {
+				return 0, err
+			}
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return 0, fmt.Errorf("unclosed comment in WITH clause")
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return 0, fmt.Errorf("unclosed parenthesis in WITH clause")
+			}
+			i += end
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed parenthesis in WITH clause")
+}
+
+// cteInliner replace references of common table expressions with derived tables
+type cteInliner struct {
+	p    SQLParser
+	ctes []*commonTableExpr
+	err  error
+}
+
+func (c *cteInliner) inline(stmt ast.StmtNode) (ast.StmtNode, error) {
+	stmt.Accept(c)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return stmt, nil
+}
+
+// parseSubquery parse subquery of cte, references of ctes defined before it are inlined
+func (c *cteInliner) parseSubquery(cte *commonTableExpr) (ast.ResultSetNode, error) {
+	stmt, err := c.p.ParseOneStmt(cte.sql)
+	if err != nil {
+		return nil, err
+	}
+	var fields []*ast.SelectField
+	switch s := stmt.(type) {
+	case *ast.SelectStmt:
+		fields = s.Fields.Fields
+	case *ast.UnionStmt:
+		fields = s.SelectList.Selects[0].Fields.Fields
+	default:
+		return nil, fmt.Errorf("common table expression must be SELECT statement")
+	}
+
+	if len(cte.columns) != 0 {
+		if len(cte.columns) != len(fields) {
+			return nil, fmt.Errorf("column count of common table expression %s not match", cte.name.O)
+		}
+		for i, f := range fields {
+			if f.WildCard != nil {
+				return nil, fmt.Errorf("column list of common table expression %s can not be used with wildcard", cte.name.O)
+			}
+			f.AsName = model.NewCIStr(cte.columns[i])
+		}
+	}
+
+	// 只能引用在当前公共表表达式之前定义的, 同名的表引用的是实际的表
+	var defined []*commonTableExpr
+	for _, v := range c.ctes {
+		if v == cte {
+			break
+		}
+		defined = append(defined, v)
+	}
+	inliner := &cteInliner{p: c.p, ctes: defined}
+	if _, err := inliner.inline(stmt); err != nil {
+		return nil, err
+	}
+	return stmt.(ast.ResultSetNode), nil
+}
+
+func (c *cteInliner) findCTE(t *ast.TableName) *commonTableExpr {
+	if t.Schema.L != "" {
+		return nil
+	}
+	for i := len(c.ctes) - 1; i >= 0; i-- {
+		if c.ctes[i].name.L == t.Name.L {
+			return c.ctes[i]
+		}
+	}
+	return nil
+}
+
+// Enter implement ast.Visitor
+func (c *cteInliner) Enter(n ast.Node) (ast.Node, bool) {
+	if c.err != nil {
+		return n, true
+	}
+	ts, ok := n.(*ast.TableSource)
+	if !ok {
+		return n, false
+	}
+	t, ok := ts.Source.(*ast.TableName)
+	if !ok {
+		return n, false
+	}
+	cte := c.findCTE(t)
+	if cte == nil {
+		return n, false
+	}
+
+	subquery, err := c.parseSubquery(cte)
+	if err != nil {
+		c.err = fmt.Errorf("inline common table expression %s error: %v", cte.name.O, err)
+		return n, true
+	}
+	ts.Source = subquery
+	if ts.AsName.L == "" {
+		ts.AsName = cte.name
+	}
+	return n, true
+}
+
+// Leave implement ast.Visitor
+func (c *cteInliner) Leave(n ast.Node) (ast.Node, bool) {
+	return n, c.err == nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	pmysql "github.com/pingcap/parser/mysql"
+	_ "github.com/pingcap/tidb/types/parser_driver"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// SQLParser is the facade of sql parser
+// proxy只通过SQLParser解析SQL, 通过Restore生成SQL, 通过Visit遍历语法树,
+// 升级或替换parser(如vitess sqlparser)时只需替换NewSQLParser, 新的实现需要将语法树转换为ast包中的节点
+type SQLParser interface {
+	// ParseOneStmt parse one statement
+	ParseOneStmt(sql string) (ast.StmtNode, error)
+	// SetSQLMode set sql_mode affecting syntax, such as ANSI_QUOTES
+	SetSQLMode(mode mysql.SQLMode)
+}
+
+// NewSQLParser constructor of SQLParser, replace it to swap parser implementation
+var NewSQLParser = newTiDBParser
+
+// tidbParser is SQLParser implemented by pingcap parser
+type tidbParser struct {
+	p *parser.Parser
+}
+
+func newTiDBParser() SQLParser {
+	return &tidbParser{p: parser.New()}
+}
+
+// ParseOneStmt implement SQLParser
+func (t *tidbParser) ParseOneStmt(sql string) (ast.StmtNode, error) {
+	if HasWithClause(sql) {
+		return parseWithClause(t, sql)
+	}
+	stmt, err := t.p.ParseOneStmt(sql, "", literalCollation)
+	if err != nil {
+		return nil, err
+	}
+	if hasCharsetIntroducer(sql) {
+		stmt = Visit(stmt, charsetLiteralVisitor{}).(ast.StmtNode)
+	}
+	return stmt, nil
+}
+
+// SetSQLMode implement SQLParser
+func (t *tidbParser) SetSQLMode(mode mysql.SQLMode) {
+	t.p.SetSQLMode(pmysql.SQLMode(mode))
+}
+
+// Restore generate sql of node with restore flags
+func Restore(node ast.Node, flags format.RestoreFlags) (string, error) {
+	s := &strings.Builder{}
+	if err := node.Restore(format.NewRestoreCtx(flags, s)); err != nil {
+		return "", err
+	}
+	if flags&RestorePreserveLiterals != 0 {
+		return spliceLiterals(node.Text(), s.String(), flags), nil
+	}
+	return s.String(), nil
+}
+
+// Visit traverse node with visitor, return the node which may be rewritten by visitor
+func Visit(node ast.Node, v ast.Visitor) ast.Node {
+	n, _ := node.Accept(v)
+	return n
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/pingcap/parser/format"
+)
+
+// RestorePreserveLiterals 生成SQL时字符串、十六进制和二进制常量使用原始SQL中的写法, 不重新转义.
+// 不是pingcap parser的flag, 由Restore在生成SQL后处理
+const RestorePreserveLiterals format.RestoreFlags = 1 << 32
+
+// literal kinds
+const (
+	literalString = 's' // 字符串, 带字符集前缀时前缀是类型的一部分
+	literalHex    = 'x' // x'..'或0x..
+	literalBit    = 'b' // b'..'或0b..
+)
+
+// sqlLiteral string, hex or bit literal in sql text
+type sqlLiteral struct {
+	start, end int
+	key        string // 类型和解码后的值, key相同的常量在后端的含义相同
+}
+
+// spliceLiterals replace literals in generated sql with the same literals in origin sql.
+// 两边的常量都按生成SQL的转义规则解码, 解码后的值相同才替换, 所以替换后后端看到的值不变;
+// 原始SQL中同一个值有多种不同写法时无法确定对应关系, 使用重新生成的写法
+func spliceLiterals(origin, generated string, flags format.RestoreFlags) string {
+	if origin == "" {
+		return generated
+	}
+	texts := make(map[string]string)
+	for _, l := range scanLiterals(origin, flags) {
+		text := origin[l.start:l.end]
+		if t, ok := texts[l.key]; ok && t != text {
+			text = ""
+		}
+		texts[l.key] = text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, l := range scanLiterals(generated, flags) {
+		if text := texts[l.key]; text != "" {
+			b.WriteString(generated[last:l.start])
+			b.WriteString(text)
+			last = l.end
+		}
+	}
+	if last == 0 {
+		return generated
+	}
+	b.WriteString(generated[last:])
+	return b.String()
+}
+
+// scanLiterals return literals in sql, strings are decoded by escape rules of flags.
+// 名称使用双引号时双引号中的内容是名称, 否则是字符串; 注释和名称中的内容不检查
+func scanLiterals(sql string, flags format.RestoreFlags) []sqlLiteral {
+	escapeBackslash := flags.HasStringEscapeBackslashFlag()
+	doubleQuotedName := flags.HasNameDoubleQuotesFlag()
+
+	var literals []sqlLiteral
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' && !doubleQuotedName:
+			end, err := skipQuotedEscape(sql, i, escapeBackslash)
+			if err != nil {
+				return literals
+			}
+			literals = append(literals, sqlLiteral{start: i, end: end, key: string(literalString) + ":" + unquoteString(sql[i:end], escapeBackslash)})
+			i = end - 1
+		case c == '"' || c == '`':
+			end, err := skipQuotedEscape(sql, i, false)
+			if err != nil {
+				return literals
+			}
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return literals
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return literals
+			}
+			i += end
+		default:
+			word, end := readWord(sql, i)
+			if word == "" {
+				continue
+			}
+			if l, ok := readWordLiteral(sql, i, word, end, escapeBackslash, doubleQuotedName); ok {
+				literals = append(literals, l)
+				end = l.end
+			}
+			i = end - 1
+		}
+	}
+	return literals
+}
+
+// readWordLiteral read literal starting with word at pos: _charset'..', x'..', b'..', 0x.., 0b..
+func readWordLiteral(sql string, pos int, word string, end int, escapeBackslash, doubleQuotedName bool) (sqlLiteral, bool) {
+	lower := strings.ToLower(word)
+	switch {
+	case len(lower) > 2 && strings.HasPrefix(lower, "0x"):
+		if value, ok := decodeHexDigits(lower[2:]); ok {
+			return sqlLiteral{start: pos, end: end, key: string(literalHex) + ":" + value}, true
+		}
+	case len(lower) > 2 && strings.HasPrefix(lower, "0b"):
+		if value, ok := decodeBitDigits(lower[2:]); ok {
+			return sqlLiteral{start: pos, end: end, key: string(literalBit) + ":" + value}, true
+		}
+	case (lower == "x" || lower == "b") && end < len(sql) && sql[end] == '\'':
+		n := strings.IndexByte(sql[end+1:], '\'')
+		if n < 0 {
+			return sqlLiteral{}, false
+		}
+		digits := strings.ToLower(sql[end+1 : end+1+n])
+		value, ok := decodeHexDigits(digits)
+		kind := literalHex
+		if lower == "b" {
+			value, ok = decodeBitDigits(digits)
+			kind = literalBit
+		}
+		if ok {
+			return sqlLiteral{start: pos, end: end + n + 2, key: string(kind) + ":" + value}, true
+		}
+	case lower[0] == '_' && len(lower) > 1:
+		start := skipSpaces(sql, end)
+		if start >= len(sql) || !(sql[start] == '\'' || sql[start] == '"' && !doubleQuotedName) {
+			return sqlLiteral{}, false
+		}
+		quoteEnd, err := skipQuotedEscape(sql, start, escapeBackslash)
+		if err != nil {
+			return sqlLiteral{}, false
+		}
+		key := string(literalString) + lower + ":" + unquoteString(sql[start:quoteEnd], escapeBackslash)
+		return sqlLiteral{start: pos, end: quoteEnd, key: key}, true
+	}
+	return sqlLiteral{}, false
+}
+
+// unquoteString decode quoted string by MySQL escape rules, \% and \_ keep the backslash
+func unquoteString(s string, escapeBackslash bool) string {
+	quote := s[0]
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && escapeBackslash && i+1 < len(s):
+			i++
+			switch s[i] {
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'Z':
+				b.WriteByte(0x1a)
+			case '%', '_':
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte(s[i])
+			}
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// decodeHexDigits decode hex digits, odd number of digits is padded with a leading zero
+func decodeHexDigits(digits string) (string, bool) {
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	value, err := hex.DecodeString(digits)
+	return string(value), err == nil
+}
+
+// decodeBitDigits decode binary digits, leading zero bytes are trimmed since the parser drops them when restoring
+func decodeBitDigits(digits string) (string, bool) {
+	if strings.Trim(digits, "01") != "" {
+		return "", false
+	}
+	digits = strings.TrimLeft(digits, "0")
+	value := make([]byte, (len(digits)+7)/8)
+	for i := 0; i < len(digits); i++ {
+		if digits[len(digits)-1-i] == '1' {
+			value[len(value)-1-i/8] |= 1 << uint(i%8)
+		}
+	}
+	return string(value), true
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pingcap/parser/ast"
+)
+
+// 解析限制的名称, 与namespace的配置项同名
+const (
+	LimitParseTimeout = "parse_timeout"
+	LimitMaxASTDepth  = "max_ast_depth"
+	LimitMaxASTNodes  = "max_ast_nodes"
+)
+
+// ParseLimits limits parsing of adversarial or machine-generated statements, zero value means no limit
+type ParseLimits struct {
+	Timeout  time.Duration // 解析的时间预算
+	MaxDepth int           // 语法树的最大深度, 解析之前先按括号嵌套层数检查
+	MaxNodes int           // 语法树的最大节点数, 限制后续改写和生成执行计划的开销
+}
+
+// ParseLimitError is returned when statement exceeds parse limits
+type ParseLimitError struct {
+	Limit  string // 超过的限制, 如LimitMaxASTDepth
+	Actual int    // 解析之前检查时为语句的实际值, 遍历语法树时超过限制即停止, 为0
+	Max    int    // 限制值, 超时时单位为毫秒
+}
+
+func (e *ParseLimitError) Error() string {
+	if e.Limit == LimitParseTimeout {
+		return fmt.Sprintf("parsing statement exceeds %s %dms", e.Limit, e.Max)
+	}
+	if e.Actual > 0 {
+		return fmt.Sprintf("statement exceeds %s %d, actual: %d", e.Limit, e.Max, e.Actual)
+	}
+	return fmt.Sprintf("statement exceeds %s %d", e.Limit, e.Max)
+}
+
+// IsParseTimeout return true if err is returned by ParseWithLimits because of timeout,
+// in this case the parser is still in use by the timed out parsing and must not be used any more
+func IsParseTimeout(err error) bool {
+	var e *ParseLimitError
+	return errors.As(err, &e) && e.Limit == LimitParseTimeout
+}
+
+// ParseWithLimits parse one statement with p, return ParseLimitError if any limit is hit
+func ParseWithLimits(p SQLParser, sql string, limits ParseLimits) (ast.StmtNode, error) {
+	if limits.MaxDepth > 0 {
+		if depth := MaxParenDepth(sql); depth > limits.MaxDepth {
+			return nil, &ParseLimitError{Limit: LimitMaxASTDepth, Actual: depth, Max: limits.MaxDepth}
+		}
+	}
+
+	stmt, err := parseWithTimeout(p, sql, limits.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if limits.MaxDepth > 0 || limits.MaxNodes > 0 {
+		c := &astLimitChecker{limits: limits}
+		stmt.Accept(c)
+		if c.err != nil {
+			return nil, c.err
+		}
+	}
+	return stmt, nil
+}
+
+// parseWithTimeout 解析无法中断, 超时后解析在后台继续执行直到结束, 调用方不能再使用该parser
+func parseWithTimeout(p SQLParser, sql string, timeout time.Duration) (ast.StmtNode, error) {
+	if timeout <= 0 {
+		return p.ParseOneStmt(sql)
+	}
+
+	type result struct {
+		stmt ast.StmtNode
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				ch <- result{err: fmt.Errorf("parse statement panic: %v", e)}
+			}
+		}()
+		stmt, err := p.ParseOneStmt(sql)
+		ch <- result{stmt: stmt, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.stmt, r.err
+	case <-timer.C:
+		return nil, &ParseLimitError{Limit: LimitParseTimeout, Max: int(timeout / time.Millisecond)}
+	}
+}
+
+// astLimitChecker 遍历语法树统计深度和节点数, 超过限制后不再遍历子节点
+type astLimitChecker struct {
+	limits ParseLimits
+	depth  int
+	nodes  int
+	err    error
+}
+
+func (c *astLimitChecker) Enter(n ast.Node) (ast.Node, bool) {
+	// Leave总会被调用, 跳过子节点时也需要增加深度
+	c.depth++
+	if c.err != nil {
+		return n, true
+	}
+	c.nodes++
+	if c.limits.MaxDepth > 0 && c.depth > c.limits.MaxDepth {
+		c.err = &ParseLimitError{Limit: LimitMaxASTDepth, Max: c.limits.MaxDepth}
+		return n, true
+	}
+	if c.limits.MaxNodes > 0 && c.nodes > c.limits.MaxNodes {
+		c.err = &ParseLimitError{Limit: LimitMaxASTNodes, Max: c.limits.MaxNodes}
+		return n, true
+	}
+	return n, false
+}
+
+func (c *astLimitChecker) Leave(n ast.Node) (ast.Node, bool) {
+	c.depth--
+	return n, true
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitSelectIntoVars 当前parser不支持SELECT ... INTO @var, 去掉最外层的INTO @var子句后返回查询语句和用户变量名,
+// 不包含INTO @var时返回原语句, vars为空. 引号或注释不完整时同样返回原语句, 由parser报告语法错误
+func SplitSelectIntoVars(sql string) (string, []string, error) {
+	depth := 0
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(sql, i)
+			if err != nil {
+				return sql, nil, nil
+			}
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return sql, nil, nil
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return sql, nil, nil
+			}
+			i += end
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '@':
+			// 跳过查询中引用的变量, 避免把变量名当作关键字
+			_, end := readWord(sql, i+1)
+			i = end - 1
+		default:
+			word, end := readWord(sql, i)
+			if word == "" {
+				continue
+			}
+			if depth == 0 && strings.EqualFold(word, "into") {
+				pos := skipSpaces(sql, end)
+				if pos < len(sql) && sql[pos] == '@' {
+					vars, varsEnd, err := readIntoVars(sql, pos)
+					if err != nil {
+						return "", nil, err
+					}
+					return sql[:i] + " " + sql[varsEnd:], vars, nil
+				}
+			}
+			i = end - 1
+		}
+	}
+	return sql, nil, nil
+}
+
+// readIntoVars read user variable list like @a, @`b`, @'c' from pos
+func readIntoVars(sql string, pos int) ([]string, int, error) {
+	var vars []string
+	for {
+		if pos >= len(sql) || sql[pos] != '@' {
+			return nil, 0, fmt.Errorf("expect user variable in SELECT ... INTO")
+		}
+		pos++
+		if pos < len(sql) && sql[pos] == '@' {
+			return nil, 0, fmt.Errorf("system variable is not supported in SELECT ... INTO")
+		}
+
+		var name string
+		if pos < len(sql) && (sql[pos] == '`' || sql[pos] == '\'' || sql[pos] == '"') {
+			end, err := skipQuoted(sql, pos)
+			if err != nil {
+				return nil, 0, fmt.Errorf("unclosed quote in SELECT ... INTO")
+			}
+			quote := sql[pos : pos+1]
+			name = strings.Replace(sql[pos+1:end-1], quote+quote, quote, -1)
+			pos = end
+		} else {
+			name, pos = readWord(sql, pos)
+		}
+		if name == "" {
+			return nil, 0, fmt.Errorf("expect user variable name in SELECT ... INTO")
+		}
+		vars = append(vars, name)
+
+		pos = skipSpaces(sql, pos)
+		if pos < len(sql) && sql[pos] == ',' {
+			pos = skipSpaces(sql, pos+1)
+			continue
+		}
+		return vars, pos, nil
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+)
+
+// MaxInListSize return the max number of values in IN (...) lists of sql, scanned without parsing,
+// so that pathological generated sql can be rejected before parsing.
+// 字符串、带引号的标识符和注释中的内容不计算
+func MaxInListSize(sql string) int {
+	// 每层括号的逗号数, isIn表示括号前是IN关键字
+	type paren struct {
+		isIn   bool
+		commas int
+	}
+	var stack []paren
+	maxSize := 0
+	afterIn := false
+scan:
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(sql, i)
+			if err != nil {
+				break scan
+			}
+			i = end - 1
+			afterIn = false
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				break scan
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				break scan
+			}
+			i += end
+		case c == '(':
+			stack = append(stack, paren{isIn: afterIn})
+			afterIn = false
+		case c == ',':
+			if len(stack) != 0 {
+				stack[len(stack)-1].commas++
+			}
+			afterIn = false
+		case c == ')':
+			if len(stack) == 0 {
+				continue
+			}
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if top.isIn && top.commas+1 > maxSize {
+				maxSize = top.commas + 1
+			}
+			afterIn = false
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			word, end := readWord(sql, i)
+			if word == "" {
+				afterIn = false
+				continue
+			}
+			afterIn = strings.EqualFold(word, "in")
+			i = end - 1
+		}
+	}
+	// 未闭合的IN列表同样统计, 避免不完整的超长语句绕过限制
+	for _, p := range stack {
+		if p.isIn && p.commas+1 > maxSize {
+			maxSize = p.commas + 1
+		}
+	}
+	return maxSize
+}
+
+// MaxParenDepth return the max nesting depth of parentheses in sql, scanned without parsing,
+// it's the lower bound of AST depth, so that deeply nested statements can be rejected before parsing.
+// 字符串、带引号的标识符和注释中的括号不计算
+func MaxParenDepth(sql string) int {
+	depth, maxDepth := 0, 0
+scan:
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			end, err := skipQuoted(sql, i)
+			if err != nil {
+				break scan
+			}
+			i = end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				break scan
+			}
+			i += end + 3
+		case c == '-' && strings.HasPrefix(sql[i:], "-- ") || c == '#':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				break scan
+			}
+			i += end
+		case c == '(':
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return maxDepth
+}
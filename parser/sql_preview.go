@@ -29,6 +29,9 @@ const (
 	StmtSavepoint
 	StmtRelease
 	StmtSRollback
+	StmtPrepare
+	StmtExecute
+	StmtDeallocate
 )
 
 // Preview analyzes the beginning of the query using a simpler and faster
@@ -63,6 +66,18 @@ func PreviewSql(sql string) StatementType {
 		return StmtDelete
 	case "savepoint":
 		return StmtSavepoint
+	case "prepare":
+		return StmtPrepare
+	case "execute":
+		return StmtExecute
+	case "deallocate":
+		return StmtDeallocate
+	case "with":
+		// 按WITH子句之后的语句判断类型
+		if _, mainSQL, err := splitWithClause(trimmed); err == nil {
+			return PreviewSql(mainSQL)
+		}
+		return StmtUnknown
 	}
 	// For the following statements it is not sufficient to rely
 	// on loweredFirstWord. This is because they are not statements
@@ -78,6 +93,12 @@ func PreviewSql(sql string) StatementType {
 	case "rollback":
 		return StmtRollback
 	}
+	// DROP PREPARE与DEALLOCATE PREPARE相同
+	if loweredFirstWord == "drop" {
+		if fields := strings.Fields(strings.ToLower(trimmedNoComments)); len(fields) > 1 && fields[1] == "prepare" {
+			return StmtDeallocate
+		}
+	}
 	switch loweredFirstWord {
 	case "create", "alter", "rename", "drop", "truncate", "flush":
 		return StmtDDL
@@ -141,6 +162,12 @@ func (s StatementType) String() string {
 		return "SAVEPOINT_ROLLBACK"
 	case StmtRelease:
 		return "RELEASE"
+	case StmtPrepare:
+		return "PREPARE"
+	case StmtExecute:
+		return "EXECUTE"
+	case StmtDeallocate:
+		return "DEALLOCATE"
 	default:
 		return "UNKNOWN"
 	}
@@ -148,7 +175,8 @@ func (s StatementType) String() string {
 
 func (s StatementType) CanHandleWithoutPlan() bool {
 	switch s {
-	case StmtShow, StmtSet, StmtBegin, StmtComment, StmtRollback, StmtUse, StmtPriv, StmtSavepoint, StmtRelease:
+	case StmtShow, StmtSet, StmtBegin, StmtComment, StmtRollback, StmtUse, StmtPriv, StmtSavepoint, StmtRelease,
+		StmtPrepare, StmtExecute, StmtDeallocate:
 		return true
 	}
 	return false
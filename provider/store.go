@@ -22,6 +22,8 @@ import (
 	"github.com/XiaoMi/Gaea/logging"
 	"github.com/XiaoMi/Gaea/models"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -32,10 +34,14 @@ const (
 	ConfigEtcd = "etcd"
 )
 
+// 并发写入版本记录冲突时的重试次数
+const maxAddVersionRetry = 3
+
 // Store means exported client to use
 type Store struct {
-	client config.SourceProvider
-	prefix string
+	client      config.SourceProvider
+	prefix      string
+	environment string // 展开namespace中按环境覆盖的配置
 }
 
 // NewClient constructor to create client by case etcd/file/zk etc.
@@ -69,6 +75,11 @@ func NewStore(client config.SourceProvider) *Store {
 	}
 }
 
+// SetEnvironment set environment used to resolve overrides of namespace
+func (s *Store) SetEnvironment(env string) {
+	s.environment = env
+}
+
 // Close close store
 func (s *Store) Close() error {
 	return s.client.Close()
@@ -84,6 +95,11 @@ func (s *Store) NamespacePath(name string) string {
 	return filepath.Join(s.prefix, "namespace", name)
 }
 
+// IncludePath concat path of file included by namespace
+func (s *Store) IncludePath(name string) string {
+	return filepath.Join(s.prefix, "include", name)
+}
+
 // ProxyBase return proxy path base
 func (s *Store) ProxyBase() string {
 	return filepath.Join(s.prefix, "proxy")
@@ -117,8 +133,45 @@ func (s *Store) ListNamespace() ([]string, error) {
 	return files, nil
 }
 
-// LoadNamespace load namespace value
+// LoadNamespace load namespace value as stored, with user/password decrypted.
+// Slice templates, includes and base shard rules are kept unresolved, so that cc can modify and save it back,
+// proxy should use LoadResolvedNamespace instead.
 func (s *Store) LoadNamespace(key, name string) (*models.Namespace, error) {
+	p, err := s.loadDecryptedNamespace(key, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.VerifyNamespace(p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// LoadResolvedNamespace load namespace value with slice templates, includes and base shard rules resolved, used by proxy
+func (s *Store) LoadResolvedNamespace(key, name string) (*models.Namespace, error) {
+	p, err := s.loadDecryptedNamespace(key, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.ResolveSlices(s.environment, s.readInclude); err != nil {
+		return nil, err
+	}
+
+	if err = p.ResolveShardRules(); err != nil {
+		return nil, err
+	}
+
+	if err = p.Verify(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (s *Store) loadDecryptedNamespace(key, name string) (*models.Namespace, error) {
 	b, err := s.client.Read(s.NamespacePath(name))
 	if err != nil {
 		return nil, err
@@ -133,15 +186,38 @@ func (s *Store) LoadNamespace(key, name string) (*models.Namespace, error) {
 		return nil, err
 	}
 
-	if err = p.Verify(); err != nil {
+	// 先解密, 模板和slices中加密的用户名密码可以引用变量
+	if err = p.Decrypt(key); err != nil {
 		return nil, err
 	}
 
-	if err = p.Decrypt(key); err != nil {
+	return p, nil
+}
+
+func (s *Store) readInclude(name string) ([]byte, error) {
+	b, err := s.client.Read(s.IncludePath(name))
+	if err != nil {
 		return nil, err
 	}
+	if b == nil {
+		return nil, fmt.Errorf("node %s not exists", s.IncludePath(name))
+	}
+	return b, nil
+}
 
-	return p, nil
+// VerifyNamespace verify namespace with slice templates and base shard rules resolved, p is not modified
+func (s *Store) VerifyNamespace(p *models.Namespace) error {
+	resolved := &models.Namespace{}
+	if err := models.JSONDecode(resolved, p.Encode()); err != nil {
+		return err
+	}
+	if err := resolved.ResolveSlices(s.environment, s.readInclude); err != nil {
+		return err
+	}
+	if err := resolved.ResolveShardRules(); err != nil {
+		return err
+	}
+	return resolved.Verify()
 }
 
 // UpdateNamespace update namespace path with data
@@ -154,6 +230,115 @@ func (s *Store) DelNamespace(name string) error {
 	return s.client.Delete(s.NamespacePath(name))
 }
 
+// ReadNamespace read namespace config as stored, return nil if not exists
+func (s *Store) ReadNamespace(name string) ([]byte, error) {
+	return s.client.Read(s.NamespacePath(name))
+}
+
+// CompareAndSwapNamespace write namespace only if stored config equals prev, nil prev means namespace must not exist
+func (s *Store) CompareAndSwapNamespace(name string, prev, next []byte) error {
+	err := s.client.CompareAndSwap(s.NamespacePath(name), prev, next)
+	if err == source.ErrCompareFailed {
+		return models.ErrNamespaceConflict
+	}
+	return err
+}
+
+// NamespaceHistoryPath concat path of namespace config version
+func (s *Store) NamespaceHistoryPath(name string, version int64) string {
+	return filepath.Join(s.prefix, "namespace_history", name, strconv.FormatInt(version, 10))
+}
+
+// ListNamespaceVersions list config versions of namespace, sorted by version
+func (s *Store) ListNamespaceVersions(name string) ([]*models.NamespaceVersion, error) {
+	files, err := s.client.List(filepath.Join(s.prefix, "namespace_history", name))
+	if err != nil {
+		return nil, err
+	}
+	var versions []*models.NamespaceVersion
+	for _, f := range files {
+		tmp := strings.Split(f, "/")
+		version, err := strconv.ParseInt(tmp[len(tmp)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		v, err := s.LoadNamespaceVersion(name, version)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+// LoadNamespaceVersion load config version of namespace, return nil if not exists
+func (s *Store) LoadNamespaceVersion(name string, version int64) (*models.NamespaceVersion, error) {
+	b, err := s.client.Read(s.NamespaceHistoryPath(name, version))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	v := &models.NamespaceVersion{}
+	if err = models.JSONDecode(v, b); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// AddNamespaceVersion save v as the next version of namespace, v.Version is set
+func (s *Store) AddNamespaceVersion(v *models.NamespaceVersion) error {
+	for i := 0; i < maxAddVersionRetry; i++ {
+		versions, err := s.ListNamespaceVersions(v.Name)
+		if err != nil {
+			return err
+		}
+		v.Version = 1
+		if len(versions) != 0 {
+			v.Version = versions[len(versions)-1].Version + 1
+		}
+		err = s.client.CompareAndSwap(s.NamespaceHistoryPath(v.Name, v.Version), nil, v.Encode())
+		if err != source.ErrCompareFailed {
+			return err
+		}
+	}
+	return fmt.Errorf("add version of namespace %s conflict", v.Name)
+}
+
+// SequencePath concat sequence path
+func (s *Store) SequencePath(namespace, name string) string {
+	return filepath.Join(s.prefix, "sequence", namespace, name)
+}
+
+// LoadSequenceSegment load sequence segment record, return nil if not exists
+func (s *Store) LoadSequenceSegment(namespace, name string) (*models.SequenceSegment, error) {
+	b, err := s.client.Read(s.SequencePath(namespace, name))
+	if err != nil || b == nil {
+		return nil, err
+	}
+	p := &models.SequenceSegment{}
+	if err = models.JSONDecode(p, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CompareAndSwapSequenceSegment write next only if stored record equals prev, nil prev means record must not exist
+func (s *Store) CompareAndSwapSequenceSegment(prev, next *models.SequenceSegment) error {
+	var prevData []byte
+	if prev != nil {
+		prevData = prev.Encode()
+	}
+	err := s.client.CompareAndSwap(s.SequencePath(next.Namespace, next.Name), prevData, next.Encode())
+	if err == source.ErrCompareFailed {
+		return models.ErrSequenceSegmentConflict
+	}
+	return err
+}
+
 // ListProxyMonitorMetrics list proxies in proxy register path
 func (s *Store) ListProxyMonitorMetrics() (map[string]*models.ProxyMonitorMetric, error) {
 	files, err := s.client.List(s.ProxyBase())
@@ -0,0 +1,168 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// memorySource 保存在内存中的配置, 用于测试Store
+type memorySource struct {
+	data map[string][]byte
+}
+
+func newMemorySource() *memorySource {
+	return &memorySource{data: make(map[string][]byte)}
+}
+
+func (m *memorySource) GetName() string { return "memory" }
+func (m *memorySource) OnLoad()         {}
+func (m *memorySource) Close() error    { return nil }
+func (m *memorySource) BasePrefix() string {
+	return "/gaea"
+}
+
+func (m *memorySource) Create(path string, data []byte) error {
+	if _, ok := m.data[path]; ok {
+		return fmt.Errorf("node %s exists", path)
+	}
+	return m.Update(path, data)
+}
+
+func (m *memorySource) Update(path string, data []byte) error {
+	m.data[path] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memorySource) UpdateWithTTL(path string, data []byte, ttl time.Duration) error {
+	return m.Update(path, data)
+}
+
+func (m *memorySource) CompareAndSwap(path string, prevData, data []byte) error {
+	if string(m.data[path]) != string(prevData) {
+		return fmt.Errorf("node %s modified", path)
+	}
+	return m.Update(path, data)
+}
+
+func (m *memorySource) Delete(path string) error {
+	delete(m.data, path)
+	return nil
+}
+
+func (m *memorySource) Read(path string) ([]byte, error) {
+	return m.data[path], nil
+}
+
+func (m *memorySource) List(path string) ([]string, error) {
+	var files []string
+	for p := range m.data {
+		if strings.HasPrefix(p, path+"/") {
+			files = append(files, p)
+		}
+	}
+	return files, nil
+}
+
+const testEncryptKey = "1234abcd5678efg*"
+
+const testTemplateNamespace = `{
+	"name": "ns",
+	"online": true,
+	"allowed_dbs": {"db_ks": true},
+	"slice_templates": [{
+		"name": "slice-${index}",
+		"user_name": "root",
+		"password": "root",
+		"master": "127.0.0.1:${port}",
+		"capacity": 8,
+		"max_capacity": 8,
+		"count": 2,
+		"base_port": 3306,
+		"port_offset": 1
+	}],
+	"base_shard_rules": [
+		{"name": "by_user", "type": "mod", "key": "user_id", "locations": [2, 2], "slices": ["slice-0", "slice-1"]}
+	],
+	"shard_rules": [
+		{"db": "db_ks", "table": "t_order", "extends": "by_user"}
+	],
+	"users": [
+		{"user_name": "test", "password": "test", "namespace": "ns", "rw_flag": 2, "rw_split": 1}
+	],
+	"default_slice": "slice-0"
+}`
+
+func TestLoadNamespaceRoundTrip(t *testing.T) {
+	store := NewStore(newMemorySource())
+	ns := &models.Namespace{}
+	if err := models.JSONDecode(ns, []byte(testTemplateNamespace)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Encrypt(testEncryptKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateNamespace(ns); err != nil {
+		t.Fatal(err)
+	}
+
+	// cc读取的是保存的原始配置, 模板和基础分片规则没有展开
+	raw, err := store.LoadNamespace(testEncryptKey, "ns")
+	if err != nil {
+		t.Fatalf("load namespace error: %v", err)
+	}
+	if len(raw.SliceTemplates) != 1 || len(raw.Slices) != 0 {
+		t.Errorf("slice templates should not be resolved, templates: %d, slices: %d", len(raw.SliceTemplates), len(raw.Slices))
+	}
+	if len(raw.BaseShardRules) != 1 || raw.ShardRules[0].Type != "" {
+		t.Errorf("base shard rules should not be resolved, base rules: %d, rule: %+v", len(raw.BaseShardRules), raw.ShardRules[0])
+	}
+	if raw.Users[0].Password != "test" || raw.SliceTemplates[0].Password != "root" {
+		t.Errorf("user and slice template password should be decrypted")
+	}
+
+	// 按cc修改配置的方式保存后再读取, 配置保持不变
+	expect := string(raw.Encode())
+	if err := raw.Encrypt(testEncryptKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateNamespace(raw); err != nil {
+		t.Fatal(err)
+	}
+	again, err := store.LoadNamespace(testEncryptKey, "ns")
+	if err != nil {
+		t.Fatalf("load namespace after saved error: %v", err)
+	}
+	if actual := string(again.Encode()); actual != expect {
+		t.Errorf("namespace changed after round trip, expect: %s, actual: %s", expect, actual)
+	}
+
+	// proxy读取展开后的配置
+	resolved, err := store.LoadResolvedNamespace(testEncryptKey, "ns")
+	if err != nil {
+		t.Fatalf("load resolved namespace error: %v", err)
+	}
+	if len(resolved.Slices) != 2 || resolved.SliceTemplates != nil {
+		t.Errorf("slice templates should be resolved, slices: %d", len(resolved.Slices))
+	}
+	if resolved.BaseShardRules != nil || resolved.ShardRules[0].Type != models.ShardMod {
+		t.Errorf("base shard rules should be resolved, rule: %+v", resolved.ShardRules[0])
+	}
+}
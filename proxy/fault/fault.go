@@ -0,0 +1,188 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fault provides fault injection in backend execution path,
+// so operators can rehearse failure handling in staging.
+// Injection is disabled by default, it can be enabled by admin api or by building with tag faultinject.
+package fault
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+// Rule describes which statements to inject and what fault to inject
+type Rule struct {
+	ID          int64   `json:"id"`
+	Namespace   string  `json:"namespace"`   // 为空表示所有namespace
+	Slice       string  `json:"slice"`       // 为空表示所有分片
+	Fingerprint string  `json:"fingerprint"` // sql指纹的md5, 为空表示所有sql
+	Probability float64 `json:"probability"` // 注入概率, 取值(0, 1]
+	Latency     int64   `json:"latency"`     // 注入的延迟, 单位毫秒
+	ErrorCode   uint16  `json:"error_code"`  // 返回的mysql错误码, 0表示不注入错误
+	ErrorMsg    string  `json:"error_msg"`
+	ResetConn   bool    `json:"reset_conn"` // 断开后端连接
+}
+
+// Verify check rule
+func (r *Rule) Verify() error {
+	if r.Probability <= 0 || r.Probability > 1 {
+		return fmt.Errorf("invalid probability: %v, must be in (0, 1]", r.Probability)
+	}
+	if r.Latency < 0 {
+		return fmt.Errorf("invalid latency: %d", r.Latency)
+	}
+	if r.Latency == 0 && r.ErrorCode == 0 && !r.ResetConn {
+		return fmt.Errorf("no fault specified, must set latency, error_code or reset_conn")
+	}
+	if r.ErrorCode != 0 && r.ResetConn {
+		return fmt.Errorf("error_code and reset_conn can not be both set")
+	}
+	return nil
+}
+
+func (r *Rule) match(namespace, slice, md5 string) bool {
+	if r.Namespace != "" && r.Namespace != namespace {
+		return false
+	}
+	if r.Slice != "" && r.Slice != slice {
+		return false
+	}
+	if r.Fingerprint != "" && r.Fingerprint != md5 {
+		return false
+	}
+	return true
+}
+
+// Fault is the fault to inject into one statement
+type Fault struct {
+	Latency   time.Duration
+	Err       error
+	ResetConn bool
+}
+
+// Injector holds fault rules
+type Injector struct {
+	enabled sync2.AtomicBool
+
+	lock   sync.RWMutex
+	rules  []*Rule
+	nextID int64
+}
+
+// NewInjector create injector, enabled when built with tag faultinject
+func NewInjector() *Injector {
+	i := &Injector{}
+	i.enabled.Set(defaultEnabled)
+	return i
+}
+
+// SetEnabled enable or disable fault injection
+func (i *Injector) SetEnabled(enabled bool) {
+	i.enabled.Set(enabled)
+}
+
+// IsEnabled return if fault injection enabled
+func (i *Injector) IsEnabled() bool {
+	return i.enabled.Get()
+}
+
+// AddRule verify and add rule, return id of the rule
+func (i *Injector) AddRule(r *Rule) (int64, error) {
+	if err := r.Verify(); err != nil {
+		return 0, err
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.nextID++
+	r.ID = i.nextID
+	i.rules = append(i.rules, r)
+	return r.ID, nil
+}
+
+// RemoveRule remove rule by id, return false if not found
+func (i *Injector) RemoveRule(id int64) bool {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	for idx, r := range i.rules {
+		if r.ID == id {
+			i.rules = append(i.rules[:idx], i.rules[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ClearRules remove all rules
+func (i *Injector) ClearRules() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.rules = nil
+}
+
+// Rules return all rules
+func (i *Injector) Rules() []*Rule {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	ret := make([]*Rule, 0, len(i.rules))
+	for _, r := range i.rules {
+		c := *r
+		ret = append(ret, &c)
+	}
+	return ret
+}
+
+// Inject return the fault of the first matched rule, nil if no fault to inject
+func (i *Injector) Inject(namespace, slice, sql string) *Fault {
+	if i == nil || !i.IsEnabled() {
+		return nil
+	}
+
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	if len(i.rules) == 0 {
+		return nil
+	}
+
+	var md5 string
+	for _, r := range i.rules {
+		if r.Fingerprint != "" && md5 == "" {
+			md5 = mysql.GetMd5(mysql.GetFingerprint(sql))
+		}
+		if !r.match(namespace, slice, md5) {
+			continue
+		}
+		if rand.Float64() >= r.Probability {
+			continue
+		}
+		f := &Fault{
+			Latency:   time.Duration(r.Latency) * time.Millisecond,
+			ResetConn: r.ResetConn,
+		}
+		if r.ErrorCode != 0 {
+			msg := r.ErrorMsg
+			if msg == "" {
+				msg = fmt.Sprintf("injected fault, rule id: %d", r.ID)
+			}
+			f.Err = mysql.NewError(r.ErrorCode, msg)
+		}
+		return f
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestRuleVerify(t *testing.T) {
+	tests := []struct {
+		rule  Rule
+		valid bool
+	}{
+		{Rule{Probability: 1, Latency: 10}, true},
+		{Rule{Probability: 0.5, ErrorCode: mysql.ErrLockWaitTimeout}, true},
+		{Rule{Probability: 1, ResetConn: true}, true},
+		{Rule{Probability: 0, Latency: 10}, false},
+		{Rule{Probability: 1.5, Latency: 10}, false},
+		{Rule{Probability: 1, Latency: -1}, false},
+		{Rule{Probability: 1}, false},
+		{Rule{Probability: 1, ErrorCode: mysql.ErrLockWaitTimeout, ResetConn: true}, false},
+	}
+	for i, test := range tests {
+		if err := test.rule.Verify(); (err == nil) != test.valid {
+			t.Errorf("test %d: verify not expected, valid: %v, err: %v", i, test.valid, err)
+		}
+	}
+}
+
+func TestInject(t *testing.T) {
+	i := NewInjector()
+	if _, err := i.AddRule(&Rule{Namespace: "ns", Slice: "slice-1", Probability: 1, ErrorCode: mysql.ErrLockWaitTimeout}); err != nil {
+		t.Fatal(err)
+	}
+	sql := "select * from t where id = 1"
+	md5 := mysql.GetMd5(mysql.GetFingerprint(sql))
+	id, err := i.AddRule(&Rule{Fingerprint: md5, Probability: 1, Latency: 20, ResetConn: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.SetEnabled(false)
+	if f := i.Inject("ns", "slice-1", sql); f != nil {
+		t.Fatalf("expect no fault when disabled, actual: %v", f)
+	}
+
+	i.SetEnabled(true)
+	f := i.Inject("ns", "slice-1", "insert into t values (1)")
+	if f == nil || f.Err.(*mysql.SQLError).SQLCode() != mysql.ErrLockWaitTimeout {
+		t.Fatalf("expect lock wait timeout error, actual: %v", f)
+	}
+	f = i.Inject("ns", "slice-0", "select * from t where id = 2")
+	if f == nil || !f.ResetConn || f.Latency != 20*time.Millisecond || f.Err != nil {
+		t.Fatalf("expect reset conn with latency, actual: %v", f)
+	}
+	if f = i.Inject("ns", "slice-0", "insert into t values (1)"); f != nil {
+		t.Fatalf("expect no fault, actual: %v", f)
+	}
+
+	if !i.RemoveRule(id) || i.RemoveRule(id) {
+		t.Fatal("remove rule not expected")
+	}
+	if len(i.Rules()) != 1 {
+		t.Fatalf("rules count not equal, expect: 1, actual: %d", len(i.Rules()))
+	}
+	i.ClearRules()
+	if f = i.Inject("ns", "slice-1", sql); f != nil {
+		t.Fatalf("expect no fault after rules cleared, actual: %v", f)
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/opcode"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// ConditionInfo is the sharding analysis of a statement, same as the analysis used in planning,
+// custom planners or validators can be built on top of it.
+type ConditionInfo struct {
+	ShardTables []string          `json:"shard_tables"` // 使用到的分片表, 格式为db.table
+	Conditions  []*ShardCondition `json:"conditions"`
+	OrderBy     []*OrderByItem    `json:"order_by"`
+	Offset      int64             `json:"offset"` // LIMIT offset, 未设置则为-1
+	Count       int64             `json:"count"`  // LIMIT count, 未设置则为-1
+}
+
+// ShardCondition is a condition on the sharding column found in WHERE clause
+type ShardCondition struct {
+	DB     string        `json:"db"`
+	Table  string        `json:"table"`
+	Column string        `json:"column"`
+	Op     string        `json:"op"` // =, !=, <, <=, >, >=, in, not in, between, not between
+	Values []interface{} `json:"values"`
+
+	// 条件可以命中的子表索引, 与proxy路由计算的结果一致
+	TableIndexes []int `json:"table_indexes"`
+	// 条件位于OR或NOT中, 不能单独用于缩小路由范围
+	InDisjunction bool `json:"in_disjunction"`
+}
+
+// OrderByItem is an item of ORDER BY clause
+type OrderByItem struct {
+	Expr string `json:"expr"`
+	Desc bool   `json:"desc"`
+}
+
+// ExtractConditions analyze sharding conditions, order by and limit of SELECT, UPDATE and DELETE statement.
+// db is the session db, the statement is not modified.
+func ExtractConditions(stmt ast.StmtNode, db string, r *router.Router) (*ConditionInfo, error) {
+	var where ast.ExprNode
+	var orderBy *ast.OrderByClause
+	var limit *ast.Limit
+	switch s := stmt.(type) {
+	case *ast.SelectStmt:
+		where, orderBy, limit = s.Where, s.OrderBy, s.Limit
+	case *ast.UpdateStmt:
+		where, orderBy, limit = s.Where, s.Order, s.Limit
+	case *ast.DeleteStmt:
+		where, orderBy, limit = s.Where, s.Order, s.Limit
+	default:
+		return nil, fmt.Errorf("unsupport statement to extract conditions, type: %T", stmt)
+	}
+
+	v := NewConditionVisitor(db, r)
+	stmt.Accept(newShardTableCollector(v))
+	if where != nil {
+		where.Accept(v)
+		if v.err != nil {
+			return nil, v.err
+		}
+	}
+
+	info := &ConditionInfo{
+		ShardTables: v.shardTables,
+		Conditions:  v.conditions,
+		OrderBy:     []*OrderByItem{},
+	}
+	if orderBy != nil {
+		for _, item := range orderBy.Items {
+			s := &strings.Builder{}
+			if err := item.Expr.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, s)); err != nil {
+				return nil, fmt.Errorf("restore order by item error: %w", err)
+			}
+			info.OrderBy = append(info.OrderBy, &OrderByItem{Expr: s.String(), Desc: item.Desc})
+		}
+	}
+	info.Offset, info.Count = getLimitValue(limit)
+	return info, nil
+}
+
+// count == -1代表没有Limit子句, 参数化的LIMIT也视为没有
+func getLimitValue(limit *ast.Limit) (int64, int64) {
+	if limit == nil {
+		return -1, -1
+	}
+	count, ok := limit.Count.(*driver.ValueExpr)
+	if !ok {
+		return -1, -1
+	}
+	if limit.Offset == nil {
+		return 0, count.GetInt64()
+	}
+	offset, ok := limit.Offset.(*driver.ValueExpr)
+	if !ok {
+		return -1, -1
+	}
+	return offset.GetInt64(), count.GetInt64()
+}
+
+// ConditionVisitor collect conditions of sharding columns in WHERE clause, without modifying the ast
+type ConditionVisitor struct {
+	db     string
+	router *router.Router
+
+	tables      map[string]router.Rule // key = table name or table alias
+	shardTables []string
+	conditions  []*ShardCondition
+
+	disjunctionDepth int
+	err              error
+}
+
+// NewConditionVisitor db is the session db
+func NewConditionVisitor(db string, r *router.Router) *ConditionVisitor {
+	return &ConditionVisitor{
+		db:          db,
+		router:      r,
+		tables:      make(map[string]router.Rule),
+		shardTables: []string{},
+		conditions:  []*ShardCondition{},
+	}
+}
+
+// AddTable register a table and its alias used in the statement, return false if it's not a shard table
+func (v *ConditionVisitor) AddTable(db, table, alias string) bool {
+	if db == "" {
+		db = v.db
+	}
+	rule, ok := v.router.GetShardRule(db, table)
+	if !ok || rule.GetType() == router.GlobalTableRuleType {
+		return false
+	}
+	if alias == "" {
+		alias = table
+	}
+	v.tables[alias] = rule
+	v.shardTables = append(v.shardTables, db+"."+table)
+	return true
+}
+
+// Conditions return the collected conditions
+func (v *ConditionVisitor) Conditions() []*ShardCondition {
+	return v.conditions
+}
+
+// Err return the error during visiting
+func (v *ConditionVisitor) Err() error {
+	return v.err
+}
+
+// Enter implement ast.Visitor
+func (v *ConditionVisitor) Enter(n ast.Node) (ast.Node, bool) {
+	if v.err != nil {
+		return n, true
+	}
+	switch nn := n.(type) {
+	case *ast.SubqueryExpr:
+		// 子查询中的条件不影响外层语句的路由
+		return n, true
+	case *ast.BinaryOperationExpr:
+		switch nn.Op {
+		case opcode.LogicOr, opcode.LogicXor:
+			v.disjunctionDepth++
+		case opcode.EQ, opcode.NE, opcode.GT, opcode.GE, opcode.LT, opcode.LE:
+			v.err = v.visitCompare(nn)
+			return n, true
+		}
+	case *ast.UnaryOperationExpr:
+		if nn.Op == opcode.Not {
+			v.disjunctionDepth++
+		}
+	case *ast.PatternInExpr:
+		v.err = v.visitPatternIn(nn)
+		return n, true
+	case *ast.BetweenExpr:
+		v.err = v.visitBetween(nn)
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *ConditionVisitor) Leave(n ast.Node) (ast.Node, bool) {
+	switch nn := n.(type) {
+	case *ast.BinaryOperationExpr:
+		if nn.Op == opcode.LogicOr || nn.Op == opcode.LogicXor {
+			v.disjunctionDepth--
+		}
+	case *ast.UnaryOperationExpr:
+		if nn.Op == opcode.Not {
+			v.disjunctionDepth--
+		}
+	}
+	return n, v.err == nil
+}
+
+func (v *ConditionVisitor) visitCompare(n *ast.BinaryOperationExpr) error {
+	op := n.Op
+	column, ok := n.L.(*ast.ColumnNameExpr)
+	value, vok := n.R.(*driver.ValueExpr)
+	if !ok || !vok {
+		column, ok = n.R.(*ast.ColumnNameExpr)
+		value, vok = n.L.(*driver.ValueExpr)
+		op = inverseOperator(op)
+	}
+	if !ok || !vok {
+		return nil
+	}
+	rule, c := v.newShardCondition(column.Name)
+	if c == nil {
+		return nil
+	}
+
+	val, err := util.GetValueExprResult(value)
+	if err != nil {
+		return fmt.Errorf("get ValueExpr value error: %w", err)
+	}
+	s := &strings.Builder{}
+	op.Format(s)
+	c.Op = s.String()
+	c.Values = []interface{}{val}
+	if c.TableIndexes, err = getFindTableIndexesFunc(op)(rule, c.Column, val); err != nil {
+		return fmt.Errorf("find table index error: %w", err)
+	}
+	v.conditions = append(v.conditions, c)
+	return nil
+}
+
+func (v *ConditionVisitor) visitPatternIn(n *ast.PatternInExpr) error {
+	column, ok := n.Expr.(*ast.ColumnNameExpr)
+	if !ok || n.Sel != nil || checkValueType(n.List) != nil {
+		return nil
+	}
+	rule, c := v.newShardCondition(column.Name)
+	if c == nil {
+		return nil
+	}
+
+	c.Op = "in"
+	if n.Not {
+		c.Op = "not in"
+	}
+	for _, item := range n.List {
+		val, err := util.GetValueExprResult(item.(*driver.ValueExpr))
+		if err != nil {
+			return fmt.Errorf("get ValueExpr value error: %w", err)
+		}
+		c.Values = append(c.Values, val)
+	}
+	indexes, _, err := getPatternInRouteResult(column.Name, n.Not, rule, n.List)
+	if err != nil {
+		return fmt.Errorf("get PatternInExpr route result error: %w", err)
+	}
+	c.TableIndexes = indexes
+	v.conditions = append(v.conditions, c)
+	return nil
+}
+
+func (v *ConditionVisitor) visitBetween(n *ast.BetweenExpr) error {
+	column, ok := n.Expr.(*ast.ColumnNameExpr)
+	if !ok || checkValueType([]ast.ExprNode{n.Left, n.Right}) != nil {
+		return nil
+	}
+	rule, c := v.newShardCondition(column.Name)
+	if c == nil {
+		return nil
+	}
+
+	c.Op = "between"
+	if n.Not {
+		c.Op = "not between"
+	}
+	for _, item := range []ast.ExprNode{n.Left, n.Right} {
+		val, err := util.GetValueExprResult(item.(*driver.ValueExpr))
+		if err != nil {
+			return fmt.Errorf("get ValueExpr value error: %w", err)
+		}
+		c.Values = append(c.Values, val)
+	}
+	indexes, err := getBetweenExprRouteResult(rule, n)
+	if err != nil {
+		return fmt.Errorf("get BetweenExpr route result error: %w", err)
+	}
+	c.TableIndexes = indexes
+	v.conditions = append(v.conditions, c)
+	return nil
+}
+
+// 列为分片表的分片列时返回分片规则和待填充的条件, 否则返回nil
+func (v *ConditionVisitor) newShardCondition(n *ast.ColumnName) (router.Rule, *ShardCondition) {
+	_, table, column := getColumnInfoFromColumnName(n)
+	var rule router.Rule
+	if table == "" {
+		// 未指定表名时, 只有一个分片表才能确定列所属的表
+		if len(v.tables) != 1 {
+			return nil, nil
+		}
+		for _, r := range v.tables {
+			rule = r
+		}
+	} else if r, ok := v.tables[table]; ok {
+		rule = r
+	} else {
+		return nil, nil
+	}
+	if rule.GetShardingColumn() != column {
+		return nil, nil
+	}
+	return rule, &ShardCondition{
+		DB:            rule.GetDB(),
+		Table:         rule.GetTable(),
+		Column:        column,
+		InDisjunction: v.disjunctionDepth > 0,
+	}
+}
+
+// shardTableCollector register tables in FROM clause to ConditionVisitor
+type shardTableCollector struct {
+	v *ConditionVisitor
+}
+
+func newShardTableCollector(v *ConditionVisitor) *shardTableCollector {
+	return &shardTableCollector{v: v}
+}
+
+// Enter implement ast.Visitor
+func (s *shardTableCollector) Enter(n ast.Node) (ast.Node, bool) {
+	switch nn := n.(type) {
+	case *ast.SubqueryExpr:
+		return n, true
+	case *ast.TableSource:
+		if t, ok := nn.Source.(*ast.TableName); ok {
+			db, table := getTableInfoFromTableName(t)
+			s.v.AddTable(db, table, nn.AsName.L)
+		}
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (s *shardTableCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
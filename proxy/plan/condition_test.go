@@ -0,0 +1,106 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestExtractConditions(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	sql := "select * from tbl_ks a where a.id in (1, 2) and (5 > id or id between 6 and 7) and name = 'a' and id = (select id from tbl_ks_range where id = 1) order by a.name desc, id limit 5, 10"
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, err := ExtractConditions(stmt, "db_ks", info.rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ci.ShardTables, []string{"db_ks.tbl_ks"}) {
+		t.Errorf("shard tables not equal, actual: %v", ci.ShardTables)
+	}
+	expect := []*ShardCondition{
+		{DB: "db_ks", Table: "tbl_ks", Column: "id", Op: "in", Values: []interface{}{int64(1), int64(2)}, TableIndexes: []int{1, 2}},
+		{DB: "db_ks", Table: "tbl_ks", Column: "id", Op: "<", Values: []interface{}{int64(5)}, TableIndexes: []int{0, 1, 2, 3}, InDisjunction: true},
+		{DB: "db_ks", Table: "tbl_ks", Column: "id", Op: "between", Values: []interface{}{int64(6), int64(7)}, TableIndexes: []int{0, 1, 2, 3}, InDisjunction: true},
+	}
+	if len(ci.Conditions) != len(expect) {
+		t.Fatalf("conditions count not equal, expect: %d, actual: %d", len(expect), len(ci.Conditions))
+	}
+	for i, c := range ci.Conditions {
+		if !reflect.DeepEqual(expect[i], c) {
+			t.Errorf("condition %d not equal, expect: %+v, actual: %+v", i, expect[i], c)
+		}
+	}
+
+	if len(ci.OrderBy) != 2 || ci.OrderBy[0].Expr != "`a`.`name`" || !ci.OrderBy[0].Desc || ci.OrderBy[1].Desc {
+		t.Errorf("order by not equal, actual: %+v, %+v", ci.OrderBy[0], ci.OrderBy[1])
+	}
+	if ci.Offset != 5 || ci.Count != 10 {
+		t.Errorf("limit not equal, actual: %d, %d", ci.Offset, ci.Count)
+	}
+
+	// 分析不修改语句, 仍然可以用于生成执行计划
+	if _, err := BuildPlan(stmt, info.phyDBs, "db_ks", sql, info.rt, info.seqs); err != nil {
+		t.Errorf("build plan after extracting conditions error: %v", err)
+	}
+}
+
+func TestExtractConditionsRange(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sql     string
+		op      string
+		indexes []int
+	}{
+		{"update tbl_ks_range set name = 'a' where id < 150", "<", []int{0, 1}},
+		{"delete from db_ks.tbl_ks_range where 250 <= id", ">=", []int{2, 3}},
+		{"delete from tbl_ks_range where id not in (1, 2)", "not in", []int{0, 1, 2, 3}},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ci, err := ExtractConditions(stmt, "db_ks", info.rt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ci.Conditions) != 1 || ci.Conditions[0].Op != test.op || !reflect.DeepEqual(ci.Conditions[0].TableIndexes, test.indexes) {
+			t.Errorf("condition not equal, sql: %s, actual: %+v", test.sql, ci.Conditions)
+		}
+		if ci.Offset != -1 || ci.Count != -1 {
+			t.Errorf("limit not equal, sql: %s, actual: %d, %d", test.sql, ci.Offset, ci.Count)
+		}
+	}
+
+	stmt, _ := parser.ParseSQL("insert into tbl_ks (id) values (1)")
+	if _, err := ExtractConditions(stmt, "db_ks", info.rt); err == nil {
+		t.Error("expect error for insert statement")
+	}
+}
@@ -46,7 +46,7 @@ func NeedCreateBetweenExprDecorator(p *TableAliasStmtInfo, n *ast.BetweenExpr) (
 
 	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, columnNameExpr)
 	if err != nil {
-		return nil, false, false, fmt.Errorf("check ColumnName error: %v", err)
+		return nil, false, false, fmt.Errorf("check ColumnName error: %w", err)
 	}
 
 	return rule, need, isAlias, nil
@@ -59,7 +59,7 @@ func CreateBetweenExprDecorator(n *ast.BetweenExpr, rule router.Rule, isAlias bo
 
 	tableIndexes, err := getBetweenExprRouteResult(rule, n)
 	if err != nil {
-		return nil, fmt.Errorf("getBetweenExprRouteResult error: %v", err)
+		return nil, fmt.Errorf("getBetweenExprRouteResult error: %w", err)
 	}
 
 	ret := &BetweenExprDecorator{
@@ -80,7 +80,7 @@ func (b *BetweenExprDecorator) Accept(v ast.Visitor) (ast.Node, bool) {
 // Restore column name restore is different from BetweenExpr
 func (b *BetweenExprDecorator) Restore(ctx *format.RestoreCtx) error {
 	if err := b.column.Restore(ctx); err != nil {
-		return fmt.Errorf("an error occurred while restore BetweenExpr.Expr: %v", err)
+		return fmt.Errorf("an error occurred while restore BetweenExpr.Expr: %w", err)
 	}
 	if b.Not {
 		ctx.WriteKeyWord(" NOT BETWEEN ")
@@ -88,11 +88,11 @@ func (b *BetweenExprDecorator) Restore(ctx *format.RestoreCtx) error {
 		ctx.WriteKeyWord(" BETWEEN ")
 	}
 	if err := b.Left.Restore(ctx); err != nil {
-		return fmt.Errorf("an error occurred while restore BetweenExpr.Left: %v", err)
+		return fmt.Errorf("an error occurred while restore BetweenExpr.Left: %w", err)
 	}
 	ctx.WriteKeyWord(" AND ")
 	if err := b.Right.Restore(ctx); err != nil {
-		return fmt.Errorf("an error occurred while restore BetweenExpr.Right: %v", err)
+		return fmt.Errorf("an error occurred while restore BetweenExpr.Right: %w", err)
 	}
 	return nil
 }
@@ -135,7 +135,7 @@ func getShardBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int
 	}
 	leftValue, err := util.GetValueExprResult(leftValueExpr)
 	if err != nil {
-		return nil, fmt.Errorf("get value from n.Left error: %v", err)
+		return nil, fmt.Errorf("get value from n.Left error: %w", err)
 	}
 
 	rightValueExpr, ok := n.Right.(*driver.ValueExpr)
@@ -144,16 +144,16 @@ func getShardBetweenExprRouteResult(rule router.Rule, n *ast.BetweenExpr) ([]int
 	}
 	rightValue, err := util.GetValueExprResult(rightValueExpr)
 	if err != nil {
-		return nil, fmt.Errorf("get value from n.Right error: %v", err)
+		return nil, fmt.Errorf("get value from n.Right error: %w", err)
 	}
 
 	start, err := rule.FindTableIndex(leftValue)
 	if err != nil {
-		return nil, fmt.Errorf("FindTableIndex for n.Left error: %v", err)
+		return nil, fmt.Errorf("FindTableIndex for n.Left error: %w", err)
 	}
 	last, err := rule.FindTableIndex(rightValue)
 	if err != nil {
-		return nil, fmt.Errorf("FindTableIndex for n.Right error: %v", err)
+		return nil, fmt.Errorf("FindTableIndex for n.Right error: %w", err)
 	}
 
 	if n.Not {
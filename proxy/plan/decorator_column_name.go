@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/model"
 
 	"github.com/XiaoMi/Gaea/proxy/router"
 )
@@ -97,57 +98,50 @@ func (c *ColumnNameDecorator) GetColumnInfo() (string, string, string) {
 
 // Restore implement ast.Node
 func (c *ColumnNameDecorator) Restore(ctx *format.RestoreCtx) error {
-	tableIndex, err := c.result.GetCurrentTableIndex()
+	if err := restoreColumnQualifier(ctx, c.origin.Schema, c.origin.Table, c.rule, c.isAlias, c.result); err != nil {
+		return err
+	}
+
+	// 列名不需要改写
+	ctx.WriteName(c.origin.Name.O)
+
+	return nil
+}
+
+// 改写列名或通配符前的库名和表名, 库名改写为物理库名, 表名改写为分表名, 表别名不需要改写
+func restoreColumnQualifier(ctx *format.RestoreCtx, schema, table model.CIStr, rule router.Rule, isAlias bool, result *RouteResult) error {
+	tableIndex, err := result.GetCurrentTableIndex()
 	if err != nil {
 		return err
 	}
 
-	ruleType := c.rule.GetType()
+	ruleType := rule.GetType()
 
-	// kingshard不需改写库名, mycat需要改写
-	if c.origin.Schema.O != "" {
-		if ruleType == router.GlobalTableRuleType {
-			dbName, err := c.rule.GetDatabaseNameByTableIndex(tableIndex)
-			if err != nil {
-				return fmt.Errorf("get mycat database name error: %v", err)
-			}
-			ctx.WriteName(dbName)
-			ctx.WritePlain(".")
-		} else if router.IsMycatShardingRule(ruleType) {
-			dbName, err := c.rule.GetDatabaseNameByTableIndex(tableIndex)
+	// kingshard改写为默认物理库名, mycat和全局表改写为分片对应的物理库名
+	if schema.O != "" {
+		if ruleType == router.GlobalTableRuleType || router.IsMycatShardingRule(ruleType) {
+			dbName, err := rule.GetDatabaseNameByTableIndex(tableIndex)
 			if err != nil {
-				return fmt.Errorf("get mycat database name error: %v", err)
+				return fmt.Errorf("get mycat database name error: %w", err)
 			}
 			ctx.WriteName(dbName)
 			ctx.WritePlain(".")
 		} else {
-			ctx.WriteName(c.origin.Schema.String())
+			ctx.WriteName(result.GetPhyDB(schema.String()))
 			ctx.WritePlain(".")
 		}
 	}
 
 	// kingshard需要改写表名, mycat不需要改写, 全局表不需要改写
-	if c.origin.Table.O != "" {
-		if ruleType == router.GlobalTableRuleType {
-			ctx.WriteName(c.origin.Table.String())
-			ctx.WritePlain(".")
-		} else if router.IsMycatShardingRule(ruleType) {
-			ctx.WriteName(c.origin.Table.String())
+	if table.O != "" {
+		if ruleType == router.GlobalTableRuleType || router.IsMycatShardingRule(ruleType) || isAlias {
+			ctx.WriteName(table.String())
 			ctx.WritePlain(".")
 		} else {
-			if c.isAlias {
-				ctx.WriteName(c.origin.Table.String())
-				ctx.WritePlain(".")
-			} else {
-				ctx.WriteName(fmt.Sprintf("%s_%04d", c.origin.Table.String(), tableIndex))
-				ctx.WritePlain(".")
-			}
+			ctx.WriteName(fmt.Sprintf("%s_%04d", table.String(), tableIndex))
+			ctx.WritePlain(".")
 		}
 	}
-
-	// 列名不需要改写
-	ctx.WriteName(c.origin.Name.O)
-
 	return nil
 }
 
@@ -170,7 +164,7 @@ func (c *ColumnNameDecorator) SetText(text string) {
 // Restore implement ast.Node
 func (cc *ColumnNameExprDecorator) Restore(ctx *format.RestoreCtx) error {
 	if err := cc.Name.Restore(ctx); err != nil {
-		return fmt.Errorf("restore ColumnNameExprDecorator error: %v", err)
+		return fmt.Errorf("restore ColumnNameExprDecorator error: %w", err)
 	}
 	return nil
 }
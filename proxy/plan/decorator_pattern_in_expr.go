@@ -22,6 +22,7 @@ import (
 	"io"
 	"sort"
 
+	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/XiaoMi/Gaea/util"
 	driver "github.com/pingcap/tidb/types/parser_driver"
@@ -48,7 +49,7 @@ type PatternInExprDecorator struct {
 // NeedCreatePatternInExprDecorator check if PatternInExpr needs decoration
 func NeedCreatePatternInExprDecorator(p *TableAliasStmtInfo, n *ast.PatternInExpr) (router.Rule, bool, bool, error) {
 	if n.Sel != nil {
-		return nil, false, false, fmt.Errorf("TableName does not support Sel in sharding")
+		return nil, false, false, mysql.UnsupportedSubqueryInShardKey.Err()
 	}
 
 	// 如果不是ColumnNameExpr, 则不做任何路由计算和装饰, 直接返回
@@ -59,7 +60,7 @@ func NeedCreatePatternInExprDecorator(p *TableAliasStmtInfo, n *ast.PatternInExp
 
 	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, columnNameExpr)
 	if err != nil {
-		return nil, false, false, fmt.Errorf("check ColumnName error: %v", err)
+		return nil, false, false, fmt.Errorf("check ColumnName error: %w", err)
 	}
 
 	if !need && rule == nil {
@@ -82,7 +83,7 @@ func CreatePatternInExprDecorator(n *ast.PatternInExpr, rule router.Rule, isAlia
 
 	tableIndexes, indexValueMap, err := getPatternInRouteResult(columnNameExpr.Name, n.Not, rule, n.List)
 	if err != nil {
-		return nil, fmt.Errorf("getPatternInRouteResult error: %v", err)
+		return nil, fmt.Errorf("getPatternInRouteResult error: %w", err)
 	}
 
 	ret := &PatternInExprDecorator{
@@ -111,7 +112,7 @@ func getPatternInRouteResult(n *ast.ColumnName, isNotIn bool, rule router.Rule,
 	}
 
 	if err := checkValueType(values); err != nil {
-		return nil, nil, fmt.Errorf("check value error: %v", err)
+		return nil, nil, fmt.Errorf("check value error: %w", err)
 	}
 
 	_, _, column := getColumnInfoFromColumnName(n)
@@ -135,14 +136,16 @@ func getPatternInRouteResult(n *ast.ColumnName, isNotIn bool, rule router.Rule,
 		if err != nil {
 			return nil, nil, err
 		}
-		idx, err := rule.FindTableIndex(value)
+		idxs, err := router.FindReadTableIndexes(rule, value)
 		if err != nil {
 			return nil, nil, err
 		}
-		if _, ok := valueMap[idx]; !ok {
-			indexes = append(indexes, idx)
+		for _, idx := range idxs {
+			if _, ok := valueMap[idx]; !ok {
+				indexes = append(indexes, idx)
+			}
+			valueMap[idx] = append(valueMap[idx], vi)
 		}
-		valueMap[idx] = append(valueMap[idx], vi)
 	}
 	sort.Ints(indexes)
 	return indexes, valueMap, nil
@@ -179,7 +182,7 @@ func (p *PatternInExprDecorator) Restore(ctx *format.RestoreCtx) error {
 	}
 
 	if err := p.Expr.Restore(ctx); err != nil {
-		return fmt.Errorf("an error occurred while restore PatternInExpr.Expr: %v", err)
+		return fmt.Errorf("an error occurred while restore PatternInExpr.Expr: %w", err)
 	}
 	if p.Not {
 		ctx.WriteKeyWord(" NOT IN ")
@@ -193,7 +196,7 @@ func (p *PatternInExprDecorator) Restore(ctx *format.RestoreCtx) error {
 			ctx.WritePlain(",")
 		}
 		if err := expr.Restore(ctx); err != nil {
-			return fmt.Errorf("an error occurred while restore PatternInExpr.List[%d], err: %v", i, err)
+			return fmt.Errorf("an error occurred while restore PatternInExpr.List[%d], err: %w", i, err)
 		}
 	}
 	ctx.WritePlain(")")
@@ -19,6 +19,7 @@ import (
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/format"
 
+	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/pingcap/errors"
 )
@@ -37,7 +38,7 @@ func NeedCreateTableNameDecoratorWithoutAlias(p *StmtInfo, n *ast.TableName) (ro
 
 	rule, err := p.RecordShardTable(db, table)
 	if err != nil {
-		return nil, false, fmt.Errorf("record shard table in SelectPlan error, db: %s, table, %s, err: %v", db, table, err)
+		return nil, false, fmt.Errorf("record shard table in SelectPlan error, db: %s, table, %s, err: %w", db, table, err)
 	}
 
 	return rule, true, nil
@@ -50,7 +51,7 @@ func NeedCreateTableNameDecorator(p *TableAliasStmtInfo, n *ast.TableName, alias
 
 	rule, err := p.RecordShardTable(db, table, alias)
 	if err != nil {
-		return nil, false, fmt.Errorf("record shard table in SelectPlan error, db: %s, table, %s, alias: %s, err: %v", db, table, alias, err)
+		return nil, false, fmt.Errorf("record shard table in SelectPlan error, db: %s, table, %s, alias: %s, err: %w", db, table, alias, err)
 	}
 
 	return rule, true, nil
@@ -60,7 +61,7 @@ func NeedCreateTableNameDecorator(p *TableAliasStmtInfo, n *ast.TableName, alias
 // the table has been checked before
 func CreateTableNameDecorator(n *ast.TableName, rule router.Rule, result *RouteResult) (*TableNameDecorator, error) {
 	if len(n.PartitionNames) != 0 {
-		return nil, fmt.Errorf("TableName does not support PartitionNames in sharding")
+		return nil, mysql.UnsupportedPartitionSelection.Err()
 	}
 
 	ret := &TableNameDecorator{
@@ -81,24 +82,24 @@ func (t *TableNameDecorator) Restore(ctx *format.RestoreCtx) error {
 
 	ruleType := t.rule.GetType()
 
-	// kingshard不需改写库名, mycat需要改写, 全局表需要改写
+	// kingshard改写为默认物理库名, mycat需要改写, 全局表需要改写
 	if t.origin.Schema.String() != "" {
 		if ruleType == router.GlobalTableRuleType {
 			dbName, err := t.rule.GetDatabaseNameByTableIndex(tableIndex)
 			if err != nil {
-				return fmt.Errorf("get mycat database name error: %v", err)
+				return fmt.Errorf("get mycat database name error: %w", err)
 			}
 			ctx.WriteName(dbName)
 			ctx.WritePlain(".")
 		} else if router.IsMycatShardingRule(ruleType) {
 			dbName, err := t.rule.GetDatabaseNameByTableIndex(tableIndex)
 			if err != nil {
-				return fmt.Errorf("get mycat database name error: %v", err)
+				return fmt.Errorf("get mycat database name error: %w", err)
 			}
 			ctx.WriteName(dbName)
 			ctx.WritePlain(".")
 		} else {
-			ctx.WriteName(t.origin.Schema.String())
+			ctx.WriteName(t.result.GetPhyDB(t.origin.Schema.String()))
 			ctx.WritePlain(".")
 		}
 	}
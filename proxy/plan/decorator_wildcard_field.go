@@ -0,0 +1,66 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// WildCardFieldDecorator decorate qualified WildCardField (tbl.*) in field list to rewrite db and table name
+// WildCardField不是ExprNode, 无法直接替换, 因此作为SelectField.Expr使用, 嵌入ColumnNameExpr只用于实现ExprNode
+type WildCardFieldDecorator struct {
+	*ast.ColumnNameExpr
+	origin  *ast.WildCardField
+	rule    router.Rule
+	result  *RouteResult
+	isAlias bool
+}
+
+// NeedCreateWildCardFieldDecorator check if WildCardField needs decoration, only qualified wildcard needs
+func NeedCreateWildCardFieldDecorator(p *TableAliasStmtInfo, n *ast.WildCardField) (router.Rule, bool, bool, error) {
+	if n.Table.O == "" {
+		return nil, false, false, nil
+	}
+	return p.GetSettedRuleFromColumnInfo(n.Schema.O, n.Table.L, "")
+}
+
+// CreateWildCardFieldDecorator create WildCardFieldDecorator
+func CreateWildCardFieldDecorator(n *ast.WildCardField, rule router.Rule, isAlias bool, result *RouteResult) *WildCardFieldDecorator {
+	return &WildCardFieldDecorator{
+		ColumnNameExpr: &ast.ColumnNameExpr{Name: &ast.ColumnName{Schema: n.Schema, Table: n.Table}},
+		origin:         n,
+		rule:           rule,
+		result:         result,
+		isAlias:        isAlias,
+	}
+}
+
+// Restore implement ast.Node
+func (w *WildCardFieldDecorator) Restore(ctx *format.RestoreCtx) error {
+	if err := restoreColumnQualifier(ctx, w.origin.Schema, w.origin.Table, w.rule, w.isAlias, w.result); err != nil {
+		return err
+	}
+	ctx.WritePlain("*")
+	return nil
+}
+
+// Accept implement ast.Node
+// do nothing and return current decorator
+func (w *WildCardFieldDecorator) Accept(v ast.Visitor) (ast.Node, bool) {
+	return w, true
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// numeric type rank used to reconcile field types, larger rank can hold values of smaller rank
+var numericTypeRank = map[uint8]int{
+	mysql.TypeTiny:       1,
+	mysql.TypeShort:      2,
+	mysql.TypeInt24:      3,
+	mysql.TypeLong:       4,
+	mysql.TypeLonglong:   5,
+	mysql.TypeNewDecimal: 6,
+	mysql.TypeFloat:      7,
+	mysql.TypeDouble:     8,
+}
+
+// mergeFields 合并各分片返回的列信息, 结果保存在rs[0]中:
+// 列长度和小数位取最大值, NOT NULL和UNSIGNED标记只在所有分片都有时保留, 数值类型不一致时取范围更大的类型
+func mergeFields(rs []*mysql.Result) {
+	fields := rs[0].Fields
+	for _, r := range rs[1:] {
+		if r.Resultset == nil || len(r.Fields) != len(fields) {
+			continue
+		}
+		for i, f := range r.Fields {
+			mergeField(fields[i], f)
+		}
+	}
+}
+
+func mergeField(to, from *mysql.Field) {
+	if from.ColumnLength > to.ColumnLength {
+		to.ColumnLength = from.ColumnLength
+	}
+	if from.Decimal != to.Decimal {
+		if from.Decimal == mysql.NotFixedDec || to.Decimal == mysql.NotFixedDec {
+			to.Decimal = mysql.NotFixedDec
+		} else if from.Decimal > to.Decimal {
+			to.Decimal = from.Decimal
+		}
+	}
+	to.Flag &^= uint16(mysql.NotNullFlag|mysql.UnsignedFlag) &^ from.Flag
+	if from.Type != to.Type {
+		fromRank, fromOk := numericTypeRank[from.Type]
+		toRank, toOk := numericTypeRank[to.Type]
+		if fromOk && toOk && fromRank > toRank {
+			to.Type = from.Type
+		}
+	}
+}
+
+// restoreLogicalFieldNames 将列信息中的物理库名和物理表名还原为逻辑库名和逻辑表名
+func restoreLogicalFieldNames(p *SelectPlan, fields []*mysql.Field) {
+	if len(fields) == 0 {
+		return
+	}
+	dbs := make(map[string]string)
+	tables := make(map[string]string)
+	addRule := func(rule router.Rule) {
+		if mycatRule, ok := rule.(router.MycatRule); ok {
+			for _, phyDB := range mycatRule.GetDatabases() {
+				dbs[phyDB] = rule.GetDB()
+			}
+		}
+		ruleType := rule.GetType()
+		if ruleType == router.GlobalTableRuleType || router.IsMycatShardingRule(ruleType) {
+			return
+		}
+		for _, idx := range rule.GetSubTableIndexes() {
+			tables[fmt.Sprintf("%s_%04d", rule.GetTable(), idx)] = rule.GetTable()
+		}
+	}
+	for _, rule := range p.tableRules {
+		addRule(rule)
+	}
+	for _, rule := range p.globalTableRules {
+		addRule(rule)
+	}
+	if len(dbs) == 0 && len(tables) == 0 {
+		return
+	}
+
+	for _, f := range fields {
+		if db, ok := dbs[string(f.Schema)]; ok {
+			f.Schema = []byte(db)
+		}
+		if table, ok := tables[string(f.Table)]; ok {
+			f.Table = []byte(table)
+		}
+		if table, ok := tables[string(f.OrgTable)]; ok {
+			f.OrgTable = []byte(table)
+		}
+	}
+}
+
+// formatFieldValue 按列的小数位格式化浮点数, 保留DECIMAL等类型末尾的0
+func formatFieldValue(field *mysql.Field, value interface{}) ([]byte, error) {
+	v, ok := value.(float64)
+	if !ok || field == nil || field.Decimal >= mysql.NotFixedDec {
+		return formatValue(value)
+	}
+	switch field.Type {
+	case mysql.TypeNewDecimal, mysql.TypeFloat, mysql.TypeDouble:
+		return strconv.AppendFloat(nil, v, 'f', int(field.Decimal), 64), nil
+	default:
+		return formatValue(value)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+func TestMergeFields(t *testing.T) {
+	newResult := func(fields ...*mysql.Field) *mysql.Result {
+		return &mysql.Result{Resultset: &mysql.Resultset{Fields: fields}}
+	}
+	rs := []*mysql.Result{
+		newResult(
+			&mysql.Field{Name: []byte("id"), Type: mysql.TypeLong, ColumnLength: 11, Flag: uint16(mysql.NotNullFlag | mysql.UnsignedFlag)},
+			&mysql.Field{Name: []byte("price"), Type: mysql.TypeNewDecimal, ColumnLength: 10, Decimal: 2},
+			&mysql.Field{Name: []byte("rate"), Type: mysql.TypeDouble, Decimal: 2, Charset: 63},
+		),
+		newResult(
+			&mysql.Field{Name: []byte("id"), Type: mysql.TypeLonglong, ColumnLength: 20, Flag: uint16(mysql.NotNullFlag)},
+			&mysql.Field{Name: []byte("price"), Type: mysql.TypeNewDecimal, ColumnLength: 12, Decimal: 4},
+			&mysql.Field{Name: []byte("rate"), Type: mysql.TypeDouble, Decimal: mysql.NotFixedDec, Charset: 63},
+		),
+	}
+	mergeFields(rs)
+
+	fields := rs[0].Fields
+	if fields[0].Type != mysql.TypeLonglong || fields[0].ColumnLength != 20 || fields[0].Flag != uint16(mysql.NotNullFlag) {
+		t.Errorf("merge id field error: %+v", fields[0])
+	}
+	if fields[1].ColumnLength != 12 || fields[1].Decimal != 4 {
+		t.Errorf("merge price field error: %+v", fields[1])
+	}
+	if fields[2].Decimal != mysql.NotFixedDec {
+		t.Errorf("merge rate field error: %+v", fields[2])
+	}
+}
+
+func TestRestoreLogicalFieldNames(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	ksRule, _ := info.rt.GetShardRule("db_ks", "tbl_ks")
+	mycatRule, _ := info.rt.GetShardRule("db_mycat", "tbl_mycat")
+	p := &SelectPlan{
+		TableAliasStmtInfo: &TableAliasStmtInfo{
+			StmtInfo: &StmtInfo{
+				tableRules:       map[string]router.Rule{"tbl_ks": ksRule, "tbl_mycat": mycatRule},
+				globalTableRules: map[string]router.Rule{},
+			},
+		},
+	}
+	fields := []*mysql.Field{
+		{Schema: []byte("db_ks"), Table: []byte("t"), OrgTable: []byte("tbl_ks_0002")},
+		{Schema: []byte("db_mycat_3"), Table: []byte("tbl_mycat"), OrgTable: []byte("tbl_mycat")},
+		{Schema: []byte("db_ks"), Table: []byte("tbl_unshard"), OrgTable: []byte("tbl_unshard")},
+	}
+	restoreLogicalFieldNames(p, fields)
+
+	expects := [][3]string{
+		{"db_ks", "t", "tbl_ks"},
+		{"db_mycat", "tbl_mycat", "tbl_mycat"},
+		{"db_ks", "tbl_unshard", "tbl_unshard"},
+	}
+	for i, expect := range expects {
+		actual := [3]string{string(fields[i].Schema), string(fields[i].Table), string(fields[i].OrgTable)}
+		if actual != expect {
+			t.Errorf("field %d not equal, expect: %v, actual: %v", i, expect, actual)
+		}
+	}
+}
+
+func TestFormatFieldValue(t *testing.T) {
+	tests := []struct {
+		field  *mysql.Field
+		value  interface{}
+		expect string
+	}{
+		{&mysql.Field{Type: mysql.TypeNewDecimal, Decimal: 2}, 1.5, "1.50"},
+		{&mysql.Field{Type: mysql.TypeNewDecimal, Decimal: 0}, float64(15), "15"},
+		{&mysql.Field{Type: mysql.TypeDouble, Decimal: mysql.NotFixedDec}, 1.25, "1.25"},
+		{&mysql.Field{Type: mysql.TypeLonglong}, int64(3), "3"},
+		{&mysql.Field{Type: mysql.TypeNewDecimal, Decimal: 2}, "abc", "abc"},
+	}
+	for _, test := range tests {
+		b, err := formatFieldValue(test.field, test.value)
+		if err != nil {
+			t.Fatalf("format value error: %v", err)
+		}
+		if string(b) != test.expect {
+			t.Errorf("format value not equal, expect: %s, actual: %s", test.expect, string(b))
+		}
+	}
+}
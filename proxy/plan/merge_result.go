@@ -133,7 +133,7 @@ func CreateAggregateFunctionMerger(funcType string, fieldIndex int) (AggregateFu
 		ret.fieldIndex = fieldIndex
 		return ret, nil
 	default:
-		return nil, fmt.Errorf("aggregate function type is not support: %s", funcType)
+		return nil, mysql.UnsupportedAggregateFunc.Err(funcType)
 	}
 }
 
@@ -151,11 +151,11 @@ func (a *AggregateFuncCountMerger) MergeTo(from, to ResultRow) error {
 
 	valueToMerge, err := from.GetInt(idx)
 	if err != nil {
-		return fmt.Errorf("get from int value error: %v", err)
+		return fmt.Errorf("get from int value error: %w", err)
 	}
 	originValue, err := to.GetInt(idx)
 	if err != nil {
-		return fmt.Errorf("get to int value error: %v", err)
+		return fmt.Errorf("get to int value error: %w", err)
 	}
 	to.SetValue(idx, originValue+valueToMerge)
 	return nil
@@ -198,11 +198,11 @@ func (a *AggregateFuncSumMerger) sumToInt64(from, to ResultRow) error {
 	idx := a.fieldIndex // does not need to check
 	valueToMerge, err := from.GetInt(idx)
 	if err != nil {
-		return fmt.Errorf("get from int value error: %v", err)
+		return fmt.Errorf("get from int value error: %w", err)
 	}
 	originValue, err := to.GetInt(idx)
 	if err != nil {
-		return fmt.Errorf("get to int value error: %v", err)
+		return fmt.Errorf("get to int value error: %w", err)
 	}
 	to.SetValue(idx, originValue+valueToMerge)
 	return nil
@@ -212,11 +212,11 @@ func (a *AggregateFuncSumMerger) sumToUint64(from, to ResultRow) error {
 	idx := a.fieldIndex // does not need to check
 	valueToMerge, err := from.GetUint(idx)
 	if err != nil {
-		return fmt.Errorf("get from int value error: %v", err)
+		return fmt.Errorf("get from int value error: %w", err)
 	}
 	originValue, err := to.GetUint(idx)
 	if err != nil {
-		return fmt.Errorf("get to int value error: %v", err)
+		return fmt.Errorf("get to int value error: %w", err)
 	}
 	to.SetValue(idx, originValue+valueToMerge)
 	return nil
@@ -226,11 +226,11 @@ func (a *AggregateFuncSumMerger) sumToFloat64(from, to ResultRow) error {
 	idx := a.fieldIndex // does not need to check
 	valueToMerge, err := from.GetFloat(idx)
 	if err != nil {
-		return fmt.Errorf("get from int value error: %v", err)
+		return fmt.Errorf("get from int value error: %w", err)
 	}
 	originValue, err := to.GetFloat(idx)
 	if err != nil {
-		return fmt.Errorf("get to int value error: %v", err)
+		return fmt.Errorf("get to int value error: %w", err)
 	}
 	to.SetValue(idx, originValue+valueToMerge)
 	return nil
@@ -355,7 +355,19 @@ func MergeExecResult(rs []*mysql.Result) (*mysql.Result, error) {
 }
 
 // MergeSelectResult merge select results
-func MergeSelectResult(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result) (*mysql.Result, error) {
+// 合并结果超过spill中的内存限制时溢写到磁盘后归并, spill为nil表示不限制
+func MergeSelectResult(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result, spill *MergeSpillConfig) (*mysql.Result, error) {
+	if size := estimateResultSize(rs); len(rs) > 1 && spill.exceeded(size) {
+		if spill.Dir == "" {
+			return nil, fmt.Errorf("%w, size: %d, limit: %d", ErrMergeMemoryExceeded, size, spill.MemoryLimit)
+		}
+		ret, err := spillMergeSelectResult(p, stmt, rs, spill, size)
+		if err != nil {
+			return nil, fmt.Errorf("spill merge error: %w", err)
+		}
+		return finishSelectResult(p, ret)
+	}
+
 	ret := mergeMultiResultSet(rs)
 
 	if p.distinct {
@@ -382,12 +394,19 @@ func MergeSelectResult(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result)
 		return nil, err
 	}
 
+	return finishSelectResult(p, ret)
+}
+
+// finishSelectResult 去掉补充的列, 还原逻辑库表名, 并生成RowData
+func finishSelectResult(p *SelectPlan, ret *mysql.Result) (*mysql.Result, error) {
 	if err := trimExtraFields(p, ret); err != nil {
-		return nil, fmt.Errorf("trimExtraFields error: %v", err)
+		return nil, fmt.Errorf("trimExtraFields error: %w", err)
 	}
 
+	restoreLogicalFieldNames(p, ret.Fields)
+
 	if err := GenerateSelectResultRowData(ret); err != nil {
-		return nil, fmt.Errorf("generate RowData error: %v", err)
+		return nil, fmt.Errorf("generate RowData error: %w", err)
 	}
 
 	return ret, nil
@@ -399,7 +418,7 @@ func mergeMultiResultSet(rs []*mysql.Result) *mysql.Result {
 		return rs[0]
 	}
 
-	// 列信息认为相同, 因此只合并结果
+	mergeFields(rs)
 	for i := 1; i < len(rs); i++ {
 		rs[0].Status |= rs[i].Status
 		rs[0].Values = append(rs[0].Values, rs[i].Values...)
@@ -494,14 +513,14 @@ func buildSelectGroupByResult(p *SelectPlan, r *mysql.Result) error {
 		retToMerge := ResultRow(r.Values[i])
 		for _, mfunc := range p.aggregateFuncs {
 			if err := mfunc.MergeTo(retToMerge, resultMap[mk]); err != nil {
-				return fmt.Errorf("MergeTo error, func: %v, value: %v, err: %v", mfunc, retToMerge, err)
+				return fmt.Errorf("MergeTo error, func: %v, value: %v, err: %w", mfunc, retToMerge, err)
 			}
 		}
 	}
 
 	err := buildResultFromResultMap(r, resultMap)
 	if err != nil {
-		return fmt.Errorf("buildResultFromResultMap error: %v", err)
+		return fmt.Errorf("buildResultFromResultMap error: %w", err)
 	}
 
 	return nil
@@ -527,7 +546,7 @@ func buildSelectOnlyResult(p *SelectPlan, rs *mysql.Result) error {
 		retToMerge := ResultRow(r.Values[i])
 		for _, mfunc := range p.aggregateFuncs {
 			if err := mfunc.MergeTo(retToMerge, currRet); err != nil {
-				return fmt.Errorf("MergeTo error, func: %v, value: %v, err: %v", mfunc, retToMerge, err)
+				return fmt.Errorf("MergeTo error, func: %v, value: %v, err: %w", mfunc, retToMerge, err)
 			}
 		}
 	}
@@ -578,6 +597,11 @@ func sortSelectResult(p *SelectPlan, stmt *ast.SelectStmt, ret *mysql.Result) er
 		return nil
 	}
 
+	return ret.SortWithoutColumnName(getSortKeys(p, ret))
+}
+
+// getSortKeys 返回ORDER BY列在结果集中对应的SortKey
+func getSortKeys(p *SelectPlan, ret *mysql.Result) []mysql.SortKey {
 	resultFieldLength := len(ret.Fields)
 	originColumnCount := p.GetColumnCount()
 	deltaColumnCount := resultFieldLength - originColumnCount
@@ -595,7 +619,7 @@ func sortSelectResult(p *SelectPlan, stmt *ast.SelectStmt, ret *mysql.Result) er
 		sortKeys = append(sortKeys, sortKey)
 	}
 
-	return ret.SortWithoutColumnName(sortKeys)
+	return sortKeys
 }
 
 // the result from backend is aggregated and offset = 0, count = (originOffset + originCount)
@@ -630,12 +654,12 @@ func GenerateSelectResultRowData(r *mysql.Result) error {
 		}
 
 		var row []byte
-		for _, value := range vs {
+		for j, value := range vs {
 			// build row values
 			if value == nil {
 				row = append(row, 0xfb)
 			} else {
-				b, err := formatValue(value)
+				b, err := formatFieldValue(r.Fields[j], value)
 				if err != nil {
 					return err
 				}
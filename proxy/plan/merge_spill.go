@@ -0,0 +1,398 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bufio"
+	"compress/gzip"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/pingcap/parser/ast"
+)
+
+// ErrMergeMemoryExceeded 合并结果超过内存限制, 且没有配置溢写目录
+var ErrMergeMemoryExceeded = errors.New("merge result exceeds memory limit")
+
+const maxSpillPartitions = 64
+
+// MergeSpillConfig 跨分片合并结果的内存限制, 超过限制时溢写到磁盘
+type MergeSpillConfig struct {
+	MemoryLimit int64  // 单位字节, 0表示不限制
+	Dir         string // 溢写临时文件的目录, 为空时超过内存限制直接返回错误
+}
+
+func (c *MergeSpillConfig) exceeded(size int64) bool {
+	return c != nil && c.MemoryLimit > 0 && size > c.MemoryLimit
+}
+
+// estimateResultSize 估算各分片结果占用的内存
+func estimateResultSize(rs []*mysql.Result) int64 {
+	var size int64
+	for _, r := range rs {
+		if r.Resultset == nil {
+			continue
+		}
+		for _, row := range r.Values {
+			size += estimateRowSize(row)
+		}
+		for _, row := range r.RowDatas {
+			size += int64(len(row))
+		}
+	}
+	return size
+}
+
+func estimateRowSize(row []interface{}) int64 {
+	size := int64(24 + 16*len(row))
+	for _, v := range row {
+		switch v := v.(type) {
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
+
+// spillMergeSelectResult 将各分片结果溢写为磁盘上的有序文件, 再多路归并得到最终结果.
+// 存在GROUP BY, DISTINCT或聚合函数时, 先按分组列哈希分区溢写, 逐个分区在内存中聚合后再生成有序文件.
+// 结果集的内存在溢写后释放, 归并时只保留LIMIT范围内的行.
+func spillMergeSelectResult(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result, cfg *MergeSpillConfig, size int64) (*mysql.Result, error) {
+	mergeFields(rs)
+	ret := rs[0]
+	for _, r := range rs[1:] {
+		ret.Status |= r.Status
+	}
+
+	var runs []*spillFile
+	defer func() {
+		for _, f := range runs {
+			f.close()
+		}
+	}()
+
+	if stmt.GroupBy != nil || p.distinct || len(p.aggregateFuncs) != 0 {
+		partitionCount := 1
+		if stmt.GroupBy != nil || p.distinct {
+			partitionCount = int(size*2/cfg.MemoryLimit) + 1
+			if partitionCount > maxSpillPartitions {
+				partitionCount = maxSpillPartitions
+			}
+		}
+		partitions, err := spillPartitions(p, stmt, rs, cfg.Dir, partitionCount)
+		defer func() {
+			for _, f := range partitions {
+				f.close()
+			}
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range partitions {
+			r, err := loadSpillFile(part, ret.Fields)
+			if err != nil {
+				return nil, err
+			}
+			if len(r.Values) == 0 {
+				continue
+			}
+			if err := aggregatePartition(p, stmt, r); err != nil {
+				return nil, err
+			}
+			run, err := spillSortedRun(p, stmt, r, cfg.Dir)
+			if run != nil {
+				runs = append(runs, run)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, r := range rs {
+			if r.Resultset == nil {
+				continue
+			}
+			run, err := spillSortedRun(p, stmt, r, cfg.Dir)
+			if run != nil {
+				runs = append(runs, run)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ret.Values = nil
+	ret.RowDatas = nil
+	if err := mergeSortedRuns(p, ret, runs); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// spillPartitions 按分组列(或DISTINCT列)的哈希值将各分片结果溢写到多个分区文件, 并释放结果集内存
+func spillPartitions(p *SelectPlan, stmt *ast.SelectStmt, rs []*mysql.Result, dir string, count int) ([]*spillFile, error) {
+	partitions := make([]*spillFile, 0, count)
+	for i := 0; i < count; i++ {
+		f, err := newSpillFile(dir)
+		if err != nil {
+			return partitions, err
+		}
+		partitions = append(partitions, f)
+	}
+
+	for _, r := range rs {
+		if r.Resultset == nil {
+			continue
+		}
+		deltaColumnCount := len(r.Fields) - p.GetColumnCount()
+		for _, row := range r.Values {
+			var keySlice []interface{}
+			if stmt.GroupBy != nil {
+				for _, index := range p.GetGroupByColumnInfo() {
+					keySlice = append(keySlice, row[index+deltaColumnCount])
+				}
+			} else if p.distinct {
+				keySlice = row[0 : p.originColumnCount+deltaColumnCount]
+			}
+			mk, err := generateMapKey(keySlice)
+			if err != nil {
+				return partitions, err
+			}
+			h := fnv.New32a()
+			h.Write([]byte(mk))
+			if err := partitions[h.Sum32()%uint32(count)].write(row); err != nil {
+				return partitions, err
+			}
+		}
+		r.Values = nil
+		r.RowDatas = nil
+	}
+	return partitions, nil
+}
+
+// aggregatePartition 在一个分区内去重和聚合, 相同分组的行一定在同一个分区内
+func aggregatePartition(p *SelectPlan, stmt *ast.SelectStmt, r *mysql.Result) error {
+	if p.distinct {
+		if err := removeDistinctRowInResult(p, r); err != nil {
+			return err
+		}
+	}
+	if stmt.GroupBy != nil {
+		return buildSelectGroupByResult(p, r)
+	}
+	return buildSelectOnlyResult(p, r)
+}
+
+// spillSortedRun 将结果排序后溢写为有序文件, 并释放结果集内存
+func spillSortedRun(p *SelectPlan, stmt *ast.SelectStmt, r *mysql.Result, dir string) (*spillFile, error) {
+	if err := sortSelectResult(p, stmt, r); err != nil {
+		return nil, err
+	}
+	f, err := newSpillFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range r.Values {
+		if err := f.write(row); err != nil {
+			return f, err
+		}
+	}
+	r.Values = nil
+	r.RowDatas = nil
+	return f, nil
+}
+
+// mergeSortedRuns 多路归并有序文件, 按LIMIT跳过和截取结果行
+func mergeSortedRuns(p *SelectPlan, ret *mysql.Result, runs []*spillFile) error {
+	var offset, count int64 = 0, -1
+	if p.HasLimit() {
+		offset, count = p.GetLimitValue()
+	}
+	var sortKeys []mysql.SortKey
+	if p.HasOrderBy() {
+		sortKeys = getSortKeys(p, ret)
+	}
+
+	h := &spillRunHeap{sortKeys: sortKeys}
+	for i, f := range runs {
+		reader, err := f.reader()
+		if err != nil {
+			return err
+		}
+		item := &spillRunItem{reader: reader, index: i}
+		ok, err := item.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.items = append(h.items, item)
+		}
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 && count != 0 {
+		item := h.items[0]
+		if offset > 0 {
+			offset--
+		} else {
+			ret.Values = append(ret.Values, item.row)
+			count--
+		}
+		ok, err := item.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
+
+type spillRunItem struct {
+	reader *spillReader
+	index  int // 没有ORDER BY或排序列相同时按文件顺序输出
+	row    []interface{}
+}
+
+func (i *spillRunItem) next() (bool, error) {
+	row, ok, err := i.reader.next()
+	if err != nil || !ok {
+		return false, err
+	}
+	i.row = row
+	return true, nil
+}
+
+type spillRunHeap struct {
+	items    []*spillRunItem
+	sortKeys []mysql.SortKey
+}
+
+func (h *spillRunHeap) Len() int { return len(h.items) }
+
+func (h *spillRunHeap) Less(i, j int) bool {
+	if v := mysql.CompareRows(h.items[i].row, h.items[j].row, h.sortKeys); v != 0 {
+		return v < 0
+	}
+	return h.items[i].index < h.items[j].index
+}
+
+func (h *spillRunHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *spillRunHeap) Push(x interface{}) { h.items = append(h.items, x.(*spillRunItem)) }
+
+func (h *spillRunHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
+
+// spillFile 溢写到磁盘的临时文件, 行数据使用gob编码, gzip压缩
+type spillFile struct {
+	f    *os.File
+	bw   *bufio.Writer
+	zw   *gzip.Writer
+	enc  *gob.Encoder
+	rows int
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := ioutil.TempFile(dir, "gaea-merge-")
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(f)
+	zw := gzip.NewWriter(bw)
+	return &spillFile{f: f, bw: bw, zw: zw, enc: gob.NewEncoder(zw)}, nil
+}
+
+func (s *spillFile) write(row []interface{}) error {
+	s.rows++
+	return s.enc.Encode(row)
+}
+
+// reader 结束写入, 返回从头读取文件的reader
+func (s *spillFile) reader() (*spillReader, error) {
+	if err := s.zw.Close(); err != nil {
+		return nil, err
+	}
+	if err := s.bw.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := s.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(s.f))
+	if err != nil {
+		return nil, err
+	}
+	return &spillReader{dec: gob.NewDecoder(zr), remain: s.rows}, nil
+}
+
+func (s *spillFile) close() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+type spillReader struct {
+	dec    *gob.Decoder
+	remain int
+}
+
+func (r *spillReader) next() ([]interface{}, bool, error) {
+	if r.remain == 0 {
+		return nil, false, nil
+	}
+	var row []interface{}
+	if err := r.dec.Decode(&row); err != nil {
+		return nil, false, err
+	}
+	r.remain--
+	return row, true, nil
+}
+
+// loadSpillFile 将分区文件读回内存
+func loadSpillFile(f *spillFile, fields []*mysql.Field) (*mysql.Result, error) {
+	reader, err := f.reader()
+	if err != nil {
+		return nil, err
+	}
+	r := &mysql.Result{Resultset: &mysql.Resultset{Fields: fields}}
+	for {
+		row, ok, err := reader.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return r, nil
+		}
+		r.Values = append(r.Values, row)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/pingcap/parser/ast"
+)
+
+func newSpillTestResults() []*mysql.Result {
+	var rs []*mysql.Result
+	for shard := 0; shard < 4; shard++ {
+		r := &mysql.Result{Resultset: &mysql.Resultset{
+			Fields: []*mysql.Field{
+				{Name: []byte("id"), Type: mysql.TypeLonglong},
+				{Name: []byte("name"), Type: mysql.TypeVarString},
+			},
+		}}
+		for i := 0; i < 50; i++ {
+			var name interface{} = fmt.Sprintf("name_%d", i%7)
+			if i%11 == 0 {
+				name = nil
+			}
+			r.Values = append(r.Values, []interface{}{int64(i*4 + shard), name})
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func TestSpillMergeSelectResult(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []string{
+		"select id, name from tbl_ks order by id desc limit 5, 20",
+		"select id, name from tbl_ks order by name, id",
+		"select distinct id, name from tbl_ks order by id",
+		"select id, name from tbl_ks group by name order by name",
+		"select count(id), name from tbl_ks group by name order by name",
+		"select max(id), name from tbl_ks",
+	}
+	for _, sql := range tests {
+		t.Run(sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := BuildPlan(stmt, info.phyDBs, "db_ks", sql, info.rt, info.seqs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			selectPlan := p.(*SelectPlan)
+			selectStmt := stmt.(*ast.SelectStmt)
+
+			rs := newSpillTestResults()
+			// 聚合函数的结果每个分片只有一行
+			if len(selectPlan.aggregateFuncs) != 0 && selectStmt.GroupBy == nil {
+				for _, r := range rs {
+					r.Values = r.Values[:1]
+				}
+			}
+			expect, err := MergeSelectResult(selectPlan, selectStmt, rs, nil)
+			if err != nil {
+				t.Fatalf("merge error: %v", err)
+			}
+
+			rs = newSpillTestResults()
+			if len(selectPlan.aggregateFuncs) != 0 && selectStmt.GroupBy == nil {
+				for _, r := range rs {
+					r.Values = r.Values[:1]
+				}
+			}
+			spill := &MergeSpillConfig{MemoryLimit: 1024, Dir: t.TempDir()}
+			actual, err := MergeSelectResult(selectPlan, selectStmt, rs, spill)
+			if err != nil {
+				t.Fatalf("spill merge error: %v", err)
+			}
+
+			if len(expect.RowDatas) == 0 {
+				t.Fatalf("expect merge result not empty")
+			}
+			if !reflect.DeepEqual(expect.RowDatas, actual.RowDatas) {
+				t.Errorf("spill merge result not equal, expect: %v, actual: %v", expect.Values, actual.Values)
+			}
+		})
+	}
+}
+
+func TestMergeSelectResultMemoryExceeded(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	sql := "select id, name from tbl_ks order by id"
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := BuildPlan(stmt, info.phyDBs, "db_ks", sql, info.rt, info.seqs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MergeSelectResult(p.(*SelectPlan), stmt.(*ast.SelectStmt), newSpillTestResults(), &MergeSpillConfig{MemoryLimit: 1024})
+	if !errors.Is(err, ErrMergeMemoryExceeded) {
+		t.Errorf("expect memory exceeded error, actual: %v", err)
+	}
+}
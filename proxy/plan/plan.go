@@ -19,7 +19,6 @@ import (
 	"github.com/XiaoMi/Gaea/parser"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/format"
-	"strings"
 
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/proxy/router"
@@ -35,6 +34,8 @@ var _ Plan = &DeletePlan{}
 var _ Plan = &UpdatePlan{}
 var _ Plan = &InsertPlan{}
 var _ Plan = &SelectLastInsertIDPlan{}
+var _ Plan = &SelectIntoOutfilePlan{}
+var _ Plan = &ConstantPlan{}
 
 // Plan is a interface for select/insert etc.
 type Plan interface {
@@ -158,43 +159,72 @@ type StmtInfo struct {
 	tableRules       map[string]router.Rule // key = table name, value = router.Rule, 记录使用到的分片表
 	globalTableRules map[string]router.Rule // 记录使用到的全局表
 	result           *RouteResult
+	restoreFlags     format.RestoreFlags // 生成分片SQL的格式, 与session的sql_mode相关
 }
 
 // TableAliasStmtInfo 使用到表别名, 且依赖表别名做路由计算的StmtNode, 目前包括UPDATE, SELECT
 // INSERT也可以使用表别名, 但是由于只存在一个表, 可以直接去掉, 因此不需要.
 type TableAliasStmtInfo struct {
 	*StmtInfo
-	tableAlias map[string]string // key = table alias, value = table
-	hintPhyDB  string            // 记录mycat分片时DATABASE()函数指定的物理DB名
+	tableAlias        map[string]string // key = table alias, value = table
+	tableWithoutAlias map[string]bool   // 记录不带别名出现的表, 只带别名出现的表不能再用表名引用列
+	hintPhyDB         string            // 记录mycat分片时DATABASE()函数指定的物理DB名
 }
 
 // BuildPlan build plan for ast
 func BuildPlan(stmt ast.StmtNode, phyDBs map[string]string, db, sql string, router *router.Router, seq *sequence.SequenceManager) (Plan, error) {
+	return BuildPlanWithSQLMode(stmt, phyDBs, db, sql, router, seq, mysql.ModeNone)
+}
+
+// BuildPlanWithSQLMode build plan for ast, the rewritten sqls are generated according to the session sql_mode
+func BuildPlanWithSQLMode(stmt ast.StmtNode, phyDBs map[string]string, db, sql string, router *router.Router, seq *sequence.SequenceManager, sqlMode mysql.SQLMode) (Plan, error) {
 	if IsSelectLastInsertIDStmt(stmt) {
 		return CreateSelectLastInsertIDPlan(), nil
 	}
 
+	if IsConstantStmt(stmt) {
+		return createConstantPlan(stmt, phyDBs, db, getRestoreFlags(router, sqlMode))
+	}
+
 	if estmt, ok := stmt.(*ast.ExplainStmt); ok {
-		return buildExplainPlan(estmt, phyDBs, db, sql, router, seq)
+		return buildExplainPlan(estmt, phyDBs, db, sql, router, seq, sqlMode)
+	}
+
+	if sstmt, ok := stmt.(*ast.SelectStmt); ok && sstmt.SelectIntoOpt != nil {
+		return buildSelectIntoOutfilePlan(sstmt, phyDBs, db, sql, router, seq, sqlMode)
 	}
 
 	checker := NewChecker(db, router)
-	stmt.Accept(checker)
+	parser.Visit(stmt, checker)
 
 	if checker.IsDatabaseInvalid() {
 		return nil, fmt.Errorf("no database selected") // TODO: return standard MySQL error
 	}
 
+	restoreFlags := getRestoreFlags(router, sqlMode)
 	if checker.IsShard() {
-		return buildShardPlan(stmt, db, sql, router, seq)
+		return buildShardPlan(stmt, db, sql, router, seq, restoreFlags)
+	}
+	return createUnshardPlan(stmt, phyDBs, db, checker.GetUnshardTableNames(), restoreFlags)
+}
+
+// 改写格式取namespace配置, NO_BACKSLASH_ESCAPES模式下, 后端不会处理字符串中的转义字符, 改写时也不能转义反斜杠
+func getRestoreFlags(r *router.Router, sqlMode mysql.SQLMode) format.RestoreFlags {
+	restoreFlags := util.EscapeRestoreFlags
+	if r != nil {
+		restoreFlags = r.GetRestoreFlags()
+	}
+	if sqlMode.HasNoBackslashEscapesMode() {
+		return restoreFlags &^ format.RestoreStringEscapeBackslash
 	}
-	return CreateUnshardPlan(stmt, phyDBs, db, checker.GetUnshardTableNames())
+	return restoreFlags
 }
 
-func buildShardPlan(stmt ast.StmtNode, db string, sql string, router *router.Router, seq *sequence.SequenceManager) (Plan, error) {
+func buildShardPlan(stmt ast.StmtNode, db string, sql string, router *router.Router, seq *sequence.SequenceManager, restoreFlags format.RestoreFlags) (Plan, error) {
 	switch s := stmt.(type) {
 	case *ast.SelectStmt:
 		plan := NewSelectPlan(db, sql, router)
+		plan.restoreFlags = restoreFlags
 		if err := HandleSelectStmt(plan, s); err != nil {
 			return nil, err
 		}
@@ -202,44 +232,53 @@ func buildShardPlan(stmt ast.StmtNode, db string, sql string, router *router.Rou
 	case *ast.InsertStmt:
 		// InsertStmt contains REPLACE statement
 		plan := NewInsertPlan(db, sql, router, seq)
+		plan.restoreFlags = restoreFlags
 		if err := HandleInsertStmt(plan, s); err != nil {
 			return nil, err
 		}
 		return plan, nil
 	case *ast.UpdateStmt:
 		plan := NewUpdatePlan(s, db, sql, router)
+		plan.restoreFlags = restoreFlags
 		if err := HandleUpdatePlan(plan); err != nil {
 			return nil, err
 		}
 		return plan, nil
 	case *ast.DeleteStmt:
 		plan := NewDeletePlan(s, db, sql, router)
+		plan.restoreFlags = restoreFlags
 		if err := HandleDeletePlan(plan); err != nil {
 			return nil, err
 		}
 		return plan, nil
 	default:
-		return nil, fmt.Errorf("stmt type does not support shard now")
+		return nil, mysql.UnsupportedShardStmt.Err()
 	}
 }
 
 // NewStmtInfo constructor of StmtInfo
 func NewStmtInfo(db string, sql string, r *router.Router) *StmtInfo {
+	result := NewRouteResult("", "", nil) // nil route result
+	if r != nil {
+		result.phyDB = r.GetPhyDB
+	}
 	return &StmtInfo{
 		db:               db,
 		sql:              sql,
 		router:           r,
 		tableRules:       make(map[string]router.Rule),
 		globalTableRules: make(map[string]router.Rule),
-		result:           NewRouteResult("", "", nil), // nil route result
+		result:           result,
+		restoreFlags:     getRestoreFlags(r, mysql.ModeNone),
 	}
 }
 
 // NewTableAliasStmtInfo means table alias StmtInfo
 func NewTableAliasStmtInfo(db string, sql string, r *router.Router) *TableAliasStmtInfo {
 	return &TableAliasStmtInfo{
-		StmtInfo:   NewStmtInfo(db, sql, r),
-		tableAlias: make(map[string]string),
+		StmtInfo:          NewStmtInfo(db, sql, r),
+		tableAlias:        make(map[string]string),
+		tableWithoutAlias: make(map[string]bool),
 	}
 }
 
@@ -259,11 +298,11 @@ func (s *StmtInfo) checkAndGetDB(db string) (string, error) {
 func (s *StmtInfo) RecordShardTable(db, table string) (router.Rule, error) {
 	rule, err := s.getShardRule(db, table)
 	if err != nil {
-		return nil, fmt.Errorf("get shard rule error, db: %s, table: %s, err: %v", db, table, err)
+		return nil, fmt.Errorf("get shard rule error, db: %s, table: %s, err: %w", db, table, err)
 	}
 
 	if err := s.checkStmtRouteResult(rule); err != nil {
-		return nil, fmt.Errorf("check route result error, db: %s, table: %s, err: %v", db, table, err)
+		return nil, fmt.Errorf("check route result error, db: %s, table: %s, err: %w", db, table, err)
 	}
 
 	return rule, nil
@@ -312,7 +351,7 @@ func (s *StmtInfo) checkStmtRouteResult(rule router.Rule) error {
 		s.result.indexes = rule.GetSubTableIndexes()
 	} else {
 		if err := s.result.Check(db, table); err != nil {
-			return fmt.Errorf("check db and table error: %v", err)
+			return fmt.Errorf("check db and table error: %w", err)
 		}
 	}
 
@@ -338,7 +377,7 @@ func (s *StmtInfo) getSettedRuleByColumnName(column string) (router.Rule, bool,
 }
 
 // 处理SELECT只含有全局表的情况
-// 这种情况只路由到默认分片
+// 这种情况只路由到默认分片, 如果默认分片被禁止读, 则路由到第一个可读的分片
 // 如果有多个全局表, 则只取第一个全局表的配置, 因此需要业务上保证这些全局表的配置是一致的.
 func postHandleGlobalTableRouteResultInQuery(p *StmtInfo) error {
 	if len(p.tableRules) == 0 && len(p.globalTableRules) != 0 {
@@ -351,11 +390,22 @@ func postHandleGlobalTableRouteResultInQuery(p *StmtInfo) error {
 		}
 		p.result.db = rule.GetDB()
 		p.result.table = tableName
-		p.result.indexes = []int{0} // 全局表SELECT只取默认分片
+		p.result.indexes = []int{getReadableGlobalTableIndex(p.router, rule)} // 全局表SELECT只取一个分片
 	}
 	return nil
 }
 
+// 返回第一个可读分片对应的全局表下标, 都不可读时返回默认分片, 由执行阶段报错
+func getReadableGlobalTableIndex(rt *router.Router, rule router.Rule) int {
+	for _, idx := range rule.GetSubTableIndexes() {
+		slice := rule.GetSlice(rule.GetSliceIndexFromTableIndex(idx))
+		if rt.IsSliceReadEnabled(slice) {
+			return idx
+		}
+	}
+	return 0
+}
+
 // 处理UPDATE, DELETE只含有全局表的情况
 // 这种情况只路由到默认分片
 // 如果有多个全局表, 则只取第一个全局表的配置, 因此需要业务上保证这些全局表的配置是一致的.
@@ -389,7 +439,7 @@ func (t *TableAliasStmtInfo) RecordSubqueryTableAlias(alias string) (router.Rule
 
 	table := "gaea_subquery_" + alias
 	if err := t.setTableAlias(table, alias); err != nil {
-		return nil, fmt.Errorf("set subquery table alias error: %v", err)
+		return nil, fmt.Errorf("set subquery table alias error: %w", err)
 	}
 
 	var rule router.Rule
@@ -438,14 +488,7 @@ func (t *TableAliasStmtInfo) getSettedRuleFromTable(db, table string) (router.Ru
 	if err != nil {
 		return nil, false, err
 	}
-	if rule, ok := t.tableRules[table]; ok {
-		return rule, false, nil
-	}
-
-	if rule, ok := t.globalTableRules[table]; ok {
-		return rule, false, nil
-	}
-
+	// 先查找别名, 别名可能与表名相同
 	if originTable, ok := t.getAliasTable(table); ok {
 		if rule, ok := t.tableRules[originTable]; ok {
 			return rule, true, nil
@@ -455,19 +498,44 @@ func (t *TableAliasStmtInfo) getSettedRuleFromTable(db, table string) (router.Ru
 		}
 	}
 
-	return nil, false, fmt.Errorf("rule not found")
+	rule, ok := t.tableRules[table]
+	if !ok {
+		rule, ok = t.globalTableRules[table]
+	}
+	if !ok {
+		return nil, false, fmt.Errorf("rule not found")
+	}
+	if t.isTableOnlyAliased(table) {
+		return nil, false, fmt.Errorf("unknown table %s, table with alias must be referred by alias", table)
+	}
+	return rule, false, nil
+}
+
+// 表只以别名出现时, MySQL不允许再使用表名引用列
+func (t *TableAliasStmtInfo) isTableOnlyAliased(table string) bool {
+	if t.tableWithoutAlias[table] {
+		return false
+	}
+	for _, originTable := range t.tableAlias {
+		if originTable == table {
+			return true
+		}
+	}
+	return false
 }
 
 // RecordShardTable 将表信息记录到StmtInfo中, 并返回表信息对应的路由规则
 func (t *TableAliasStmtInfo) RecordShardTable(db, table, alias string) (router.Rule, error) {
 	rule, err := t.StmtInfo.RecordShardTable(db, table)
 	if err != nil {
-		return nil, fmt.Errorf("record shard table error, db: %s, table: %s, alias: %s, err: %v", db, table, alias, err)
+		return nil, fmt.Errorf("record shard table error, db: %s, table: %s, alias: %s, err: %w", db, table, alias, err)
 	}
 
-	if alias != "" {
+	if alias == "" {
+		t.tableWithoutAlias[table] = true
+	} else {
 		if err := t.setTableAlias(table, alias); err != nil {
-			return nil, fmt.Errorf("set table alias error: %v", err)
+			return nil, fmt.Errorf("set table alias error: %w", err)
 		}
 	}
 
@@ -495,14 +563,22 @@ func (t *TableAliasStmtInfo) getAliasTable(alias string) (string, bool) {
 	return table, ok
 }
 
+// 检查写入的分表是否已归档且禁止写入
+func checkArchivedWrite(result *RouteResult, rt *router.Router) error {
+	rule, ok := rt.GetShardRule(result.db, result.table)
+	if !ok {
+		return nil
+	}
+	return router.CheckWriteTableIndexes(rule, result.indexes)
+}
+
 // 根据StmtNode和路由信息生成分片SQL
-func generateShardingSQLs(stmt ast.StmtNode, result *RouteResult, router *router.Router) (map[string]map[string][]string, error) {
+func generateShardingSQLs(stmt ast.StmtNode, result *RouteResult, router *router.Router, restoreFlags format.RestoreFlags) (map[string]map[string][]string, error) {
 	ret := make(map[string]map[string][]string)
 
 	for result.HasNext() {
-		sb := &strings.Builder{}
-		ctx := format.NewRestoreCtx(util.EscapeRestoreFlags, sb)
-		if err := stmt.Restore(ctx); err != nil {
+		sql, err := parser.Restore(stmt, restoreFlags)
+		if err != nil {
 			return nil, err
 		}
 
@@ -520,7 +596,7 @@ func generateShardingSQLs(stmt ast.StmtNode, result *RouteResult, router *router
 			ret[sliceName] = sliceSQLs
 		}
 
-		ret[sliceName][dbName] = append(ret[sliceName][dbName], sb.String())
+		ret[sliceName][dbName] = append(ret[sliceName][dbName], sql)
 	}
 
 	result.Reset() // must reset the cursor for next call
@@ -560,7 +636,7 @@ func newEmptyResultset(info *SelectPlan, stmt *ast.SelectStmt) *mysql.Resultset
 	r.Fields = make([]*mysql.Field, fieldLen)
 	for i, expr := range stmt.Fields.Fields {
 		r.Fields[i] = &mysql.Field{}
-		if expr.WildCard != nil {
+		if _, ok := expr.Expr.(*WildCardFieldDecorator); ok || expr.WildCard != nil {
 			r.Fields[i].Name = []byte("*")
 		} else {
 			if expr.AsName.String() != "" {
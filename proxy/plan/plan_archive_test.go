@@ -0,0 +1,107 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+)
+
+func TestArchivedRulePlan(t *testing.T) {
+	nsStr := `
+{
+    "name": "gaea_namespace_archive",
+    "online": true,
+    "allowed_dbs": {"db_ks": true},
+    "default_phy_dbs": {"db_ks": "db_ks"},
+    "slices": [
+        {"name": "slice-0", "user_name": "root", "password": "root", "master": "127.0.0.1:3306", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-1", "user_name": "root", "password": "root", "master": "127.0.0.1:3307", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-cold", "user_name": "root", "password": "root", "master": "127.0.0.1:3308", "capacity": 64, "max_capacity": 128}
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_archive",
+            "type": "date_year",
+            "key": "create_time",
+            "slices": ["slice-0", "slice-1"],
+            "date_range": ["2014-2017", "2018-2019"],
+            "archive_slices": ["slice-cold"],
+            "archive_cutoff": "2016"
+        }
+    ],
+    "users": [
+        {"user_name": "test_archive", "password": "test_archive", "namespace": "gaea_namespace_archive", "rw_flag": 2, "rw_split": 1}
+    ],
+    "default_slice": "slice-0"
+}`
+	nsModel, err := createNamespace(nsStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := createRouter(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := createSequenceManager(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &PlanInfo{phyDBs: nsModel.DefaultPhyDBS, rt: rt, seqs: seqs}
+
+	// 早于2016年的分表从归档slice读取, 写入被拒绝
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_archive where create_time = '2015-03-01'",
+			sqls: map[string]map[string][]string{
+				"slice-cold": {"db_ks": {"SELECT * FROM `tbl_archive_2015` WHERE `create_time`='2015-03-01'"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_archive where create_time >= '2015-03-01' and create_time <= '2016-03-01'",
+			sqls: map[string]map[string][]string{
+				"slice-cold": {"db_ks": {"SELECT * FROM `tbl_archive_2015` WHERE `create_time`>='2015-03-01' AND `create_time`<='2016-03-01'"}},
+				"slice-0":    {"db_ks": {"SELECT * FROM `tbl_archive_2016` WHERE `create_time`>='2015-03-01' AND `create_time`<='2016-03-01'"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "insert into tbl_archive (id, create_time) values (1, '2018-03-01')",
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"INSERT INTO `tbl_archive_2018` (`id`,`create_time`) VALUES (1,'2018-03-01')"}},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "insert into tbl_archive (id, create_time) values (1, '2015-03-01')",
+			hasErr: true,
+		},
+		{
+			db:     "db_ks",
+			sql:    "update tbl_archive set id = 2 where create_time = '2014-03-01'",
+			hasErr: true,
+		},
+		{
+			db:     "db_ks",
+			sql:    "delete from tbl_archive where id = 2",
+			hasErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(info, test))
+	}
+}
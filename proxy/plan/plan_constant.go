@@ -0,0 +1,322 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+	"github.com/pingcap/parser/opcode"
+	"github.com/pingcap/tidb/types"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// ConstantPlan is the plan for SELECT of constant expressions without FROM (SELECT 1, SELECT NOW()) and DO statement,
+// the result is computed by gaea without backend round trip.
+// 依赖会话时区的函数(如NOW())只在会话设置了time_zone时计算, 否则仍然发往后端
+type ConstantPlan struct {
+	basePlan
+
+	isDo         bool
+	names        []string
+	fields       []constantEvaluator
+	needTimeZone bool
+	fallback     Plan
+}
+
+// constantValue is the value of a constant expression, value is nil for NULL
+type constantValue struct {
+	value   interface{}
+	tp      byte
+	flag    uint16
+	decimal uint8
+}
+
+// constantEvaluator compute value of a constant expression, loc is the session time zone
+type constantEvaluator func(now time.Time, loc *time.Location) *constantValue
+
+// IsConstantStmt check if the statement is SELECT of constant expressions without FROM or DO statement
+// which can be computed by gaea
+func IsConstantStmt(stmt ast.StmtNode) bool {
+	switch s := stmt.(type) {
+	case *ast.SelectStmt:
+		if s.From != nil || s.Where != nil || s.GroupBy != nil || s.Having != nil || s.OrderBy != nil || s.Limit != nil ||
+			s.WindowSpecs != nil || s.SelectIntoOpt != nil || s.Fields == nil {
+			return false
+		}
+		for _, f := range s.Fields.Fields {
+			if f.WildCard != nil {
+				return false
+			}
+			if _, _, ok := compileConstantExpr(f.Expr); !ok {
+				return false
+			}
+		}
+		return true
+	case *ast.DoStmt:
+		for _, e := range s.Exprs {
+			if _, _, ok := compileConstantExpr(e); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func createConstantPlan(stmt ast.StmtNode, phyDBs map[string]string, db string, restoreFlags format.RestoreFlags) (*ConstantPlan, error) {
+	s, ok := stmt.(*ast.SelectStmt)
+	if !ok {
+		return &ConstantPlan{isDo: true}, nil
+	}
+
+	p := &ConstantPlan{}
+	for _, f := range s.Fields.Fields {
+		eval, needTimeZone, _ := compileConstantExpr(f.Expr)
+		p.fields = append(p.fields, eval)
+		p.names = append(p.names, getConstantFieldName(f))
+		p.needTimeZone = p.needTimeZone || needTimeZone
+	}
+	if p.needTimeZone {
+		fallback, err := createUnshardPlan(stmt, phyDBs, db, nil, restoreFlags)
+		if err != nil {
+			return nil, err
+		}
+		p.fallback = fallback
+	}
+	return p, nil
+}
+
+// getConstantFieldName 与MySQL一致, 列名为别名或原始的表达式, 字符串常量为字符串的值
+func getConstantFieldName(f *ast.SelectField) string {
+	if f.AsName.O != "" {
+		return f.AsName.O
+	}
+	if v, ok := f.Expr.(*driver.ValueExpr); ok && v.Kind() == types.KindString {
+		return v.GetString()
+	}
+	if text := strings.TrimSpace(f.Text()); text != "" {
+		return text
+	}
+	s := &strings.Builder{}
+	if err := f.Expr.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, s)); err != nil {
+		return ""
+	}
+	return s.String()
+}
+
+// ExecuteIn implement Plan
+func (p *ConstantPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	if p.isDo {
+		return &mysql.Result{}, nil
+	}
+
+	loc := time.Local
+	if p.needTimeZone {
+		timeZone, _ := reqCtx.Get(util.TimeZone).(string)
+		if timeZone == "" {
+			return p.fallback.ExecuteIn(reqCtx, se)
+		}
+		var err error
+		if loc, err = parseTimeZone(timeZone); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	r := &mysql.Resultset{
+		Fields:     make([]*mysql.Field, len(p.fields)),
+		FieldNames: make(map[string]int, len(p.fields)),
+		Values:     [][]interface{}{make([]interface{}, len(p.fields))},
+	}
+	var row []byte
+	for i, eval := range p.fields {
+		v := eval(now, loc)
+		r.Fields[i] = &mysql.Field{
+			Name:    hack.Slice(p.names[i]),
+			Charset: 63,
+			Type:    v.tp,
+			Flag:    v.flag,
+			Decimal: v.decimal,
+		}
+		r.FieldNames[p.names[i]] = i
+		r.Values[0][i] = v.value
+
+		switch value := v.value.(type) {
+		case nil:
+			row = append(row, 0xfb)
+		case string:
+			if v.tp == mysql.TypeVarString {
+				r.Fields[i].Charset = 33
+			}
+			row = mysql.AppendLenEncStringBytes(row, hack.Slice(value))
+		default:
+			row = mysql.AppendLenEncStringBytes(row, hack.Slice(fmt.Sprintf("%v", value)))
+		}
+	}
+	r.RowDatas = []mysql.RowData{row}
+	return &mysql.Result{Resultset: r}, nil
+}
+
+// parseTimeZone parse time_zone in format of +08:00, which is verified when set
+func parseTimeZone(timeZone string) (*time.Location, error) {
+	values := strings.Split(timeZone, ":")
+	if len(values) != 2 || len(values[0]) == 0 {
+		return nil, fmt.Errorf("invalid time_zone: %s", timeZone)
+	}
+	hour, err := strconv.Atoi(values[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone: %s", timeZone)
+	}
+	minute, err := strconv.Atoi(values[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone: %s", timeZone)
+	}
+	offset := hour*3600 + minute*60
+	if values[0][0] == '-' {
+		offset = hour*3600 - minute*60
+	}
+	return time.FixedZone(timeZone, offset), nil
+}
+
+// compileConstantExpr 只支持结果确定、没有副作用的表达式: 常量, 负号, 括号以及当前时间函数
+func compileConstantExpr(expr ast.ExprNode) (constantEvaluator, bool, bool) {
+	switch e := expr.(type) {
+	case *driver.ValueExpr:
+		v, ok := getLiteralValue(e, false)
+		if !ok {
+			return nil, false, false
+		}
+		return func(time.Time, *time.Location) *constantValue { return v }, false, true
+	case *ast.UnaryOperationExpr:
+		literal, ok := e.V.(*driver.ValueExpr)
+		if !ok || e.Op != opcode.Minus {
+			return nil, false, false
+		}
+		v, ok := getLiteralValue(literal, true)
+		if !ok {
+			return nil, false, false
+		}
+		return func(time.Time, *time.Location) *constantValue { return v }, false, true
+	case *ast.ParenthesesExpr:
+		return compileConstantExpr(e.Expr)
+	case *ast.FuncCallExpr:
+		return compileTimeFunc(e)
+	}
+	return nil, false, false
+}
+
+const binaryFlag = uint16(mysql.BinaryFlag)
+
+func getLiteralValue(e *driver.ValueExpr, negative bool) (*constantValue, bool) {
+	notNull := binaryFlag | uint16(mysql.NotNullFlag)
+	switch e.Kind() {
+	case types.KindNull:
+		if negative {
+			return nil, false
+		}
+		return &constantValue{tp: mysql.TypeNull, flag: binaryFlag}, true
+	case types.KindInt64:
+		if negative {
+			return &constantValue{value: -e.GetInt64(), tp: mysql.TypeLonglong, flag: notNull}, true
+		}
+		return &constantValue{value: e.GetInt64(), tp: mysql.TypeLonglong, flag: notNull}, true
+	case types.KindUint64:
+		// 超过int64范围的整数取负后为DECIMAL
+		if negative {
+			return &constantValue{value: "-" + strconv.FormatUint(e.GetUint64(), 10), tp: mysql.TypeNewDecimal, flag: notNull}, true
+		}
+		return &constantValue{value: e.GetUint64(), tp: mysql.TypeLonglong, flag: notNull | uint16(mysql.UnsignedFlag)}, true
+	case types.KindFloat64:
+		value := e.GetFloat64()
+		if negative {
+			value = -value
+		}
+		return &constantValue{value: value, tp: mysql.TypeDouble, flag: notNull, decimal: mysql.NotFixedDec}, true
+	case types.KindMysqlDecimal:
+		d := e.GetMysqlDecimal()
+		_, frac := d.PrecisionAndFrac()
+		value := d.String()
+		if negative && !strings.HasPrefix(value, "-") {
+			value = "-" + value
+		}
+		return &constantValue{value: value, tp: mysql.TypeNewDecimal, flag: notNull, decimal: uint8(frac)}, true
+	case types.KindString:
+		// 带字符集前缀的字符串与连接字符集相关, 由后端计算
+		if negative || e.Type.Charset != "" && e.Type.Charset != mysql.CharsetUTF8MB4 && e.Type.Charset != mysql.CharsetUTF8 {
+			return nil, false
+		}
+		return &constantValue{value: e.GetString(), tp: mysql.TypeVarString, flag: uint16(mysql.NotNullFlag)}, true
+	}
+	return nil, false
+}
+
+// compileTimeFunc 当前时间函数, UTC_*以外的函数依赖会话时区
+func compileTimeFunc(e *ast.FuncCallExpr) (constantEvaluator, bool, bool) {
+	var layout string
+	var tp byte
+	utc := false
+	switch e.FnName.L {
+	case ast.Now, ast.CurrentTimestamp, ast.LocalTime, ast.LocalTimestamp, ast.Sysdate:
+		layout, tp = "2006-01-02 15:04:05", mysql.TypeDatetime
+	case ast.UTCTimestamp:
+		layout, tp, utc = "2006-01-02 15:04:05", mysql.TypeDatetime, true
+	case ast.Curdate, ast.CurrentDate:
+		layout, tp = "2006-01-02", mysql.TypeDate
+	case ast.UTCDate:
+		layout, tp, utc = "2006-01-02", mysql.TypeDate, true
+	case ast.Curtime, ast.CurrentTime:
+		layout, tp = "15:04:05", mysql.TypeDuration
+	case ast.UTCTime:
+		layout, tp, utc = "15:04:05", mysql.TypeDuration, true
+	default:
+		return nil, false, false
+	}
+
+	var fsp int64
+	switch len(e.Args) {
+	case 0:
+	case 1:
+		arg, ok := e.Args[0].(*driver.ValueExpr)
+		if !ok || tp == mysql.TypeDate || arg.Kind() != types.KindInt64 && arg.Kind() != types.KindUint64 {
+			return nil, false, false
+		}
+		if fsp = arg.GetInt64(); fsp < 0 || fsp > 6 {
+			return nil, false, false
+		}
+	default:
+		return nil, false, false
+	}
+	if fsp > 0 {
+		layout += "." + strings.Repeat("0", int(fsp))
+	}
+
+	flag := binaryFlag | uint16(mysql.NotNullFlag)
+	eval := func(now time.Time, loc *time.Location) *constantValue {
+		if utc {
+			loc = time.UTC
+		}
+		return &constantValue{value: now.In(loc).Format(layout), tp: tp, flag: flag, decimal: uint8(fsp)}
+	}
+	return eval, !utc, true
+}
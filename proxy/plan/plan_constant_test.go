@@ -0,0 +1,151 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestIsConstantStmt(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect bool
+	}{
+		{"select 1", true},
+		{"SELECT 1, -2.5, 'a' AS b, NULL, now(3), CURRENT_TIMESTAMP, utc_date()", true},
+		{"do 1, (2)", true},
+		{"do now()", true},
+		{"select 1 from tbl_ks", false},
+		{"select 1 limit 0", false},
+		{"select @@version", false},
+		{"select 1 + 1", false},
+		{"select database()", false},
+		{"select sleep(1)", false},
+		{"select now(7)", false},
+		{"select 0x41", false},
+		{"select _latin1'a'", false},
+		{"do sleep(1)", false},
+		{"select 1 union select 2", false},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatalf("parse sql error, sql: %s, err: %v", test.sql, err)
+		}
+		if actual := IsConstantStmt(stmt); actual != test.expect {
+			t.Errorf("sql: %s, expect: %v, actual: %v", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestConstantPlanExecuteIn(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	se := &dryRunExecutor{}
+
+	p := buildTestPlan(t, info, "db_ks", "select 1, -2, 1.50, 'abc', 'x' as y, null, 18446744073709551615")
+	r, err := p.ExecuteIn(util.NewRequestContext(), se)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNames := []string{"1", "-2", "1.50", "abc", "y", "null", "18446744073709551615"}
+	expectTypes := []byte{mysql.TypeLonglong, mysql.TypeLonglong, mysql.TypeNewDecimal, mysql.TypeVarString, mysql.TypeVarString, mysql.TypeNull, mysql.TypeLonglong}
+	expectValues := []interface{}{int64(1), int64(-2), "1.50", "abc", "x", nil, uint64(18446744073709551615)}
+	if len(r.Fields) != len(expectNames) || len(r.Values) != 1 || len(r.RowDatas) != 1 {
+		t.Fatalf("result not match, fields: %d, rows: %d", len(r.Fields), len(r.Values))
+	}
+	for i, f := range r.Fields {
+		if string(f.Name) != expectNames[i] || f.Type != expectTypes[i] || r.Values[0][i] != expectValues[i] {
+			t.Errorf("column %d not match, name: %s, type: %d, value: %v", i, f.Name, f.Type, r.Values[0][i])
+		}
+	}
+	if r.Fields[2].Decimal != 2 {
+		t.Errorf("decimal of column 2 not match: %d", r.Fields[2].Decimal)
+	}
+	values, err := r.RowDatas[0].Parse(r.Fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[5] != nil || values[3] != "abc" {
+		t.Errorf("row data not match: %v", values)
+	}
+	if len(se.sqls) != 0 {
+		t.Errorf("constant select should not be sent to backend: %v", se.sqls)
+	}
+
+	// 会话设置了time_zone时计算当前时间
+	reqCtx := util.NewRequestContext()
+	reqCtx.Set(util.TimeZone, "+08:00")
+	p = buildTestPlan(t, info, "db_ks", "select now(3), curdate(), utc_time()")
+	if r, err = p.ExecuteIn(reqCtx, se); err != nil {
+		t.Fatal(err)
+	}
+	patterns := []string{`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3}$`, `^\d{4}-\d{2}-\d{2}$`, `^\d{2}:\d{2}:\d{2}$`}
+	for i, pattern := range patterns {
+		if !regexp.MustCompile(pattern).MatchString(r.Values[0][i].(string)) {
+			t.Errorf("column %d not match, expect: %s, actual: %v", i, pattern, r.Values[0][i])
+		}
+	}
+	if r.Fields[0].Type != mysql.TypeDatetime || r.Fields[0].Decimal != 3 || string(r.Fields[0].Name) != "now(3)" {
+		t.Errorf("now field not match: %+v", r.Fields[0])
+	}
+
+	// 未设置time_zone时由后端计算
+	if _, err = p.ExecuteIn(util.NewRequestContext(), se); err != nil {
+		t.Fatal(err)
+	}
+	if len(se.sqls) != 1 || se.sqls[0] != "SELECT NOW(3),CURDATE(),UTC_TIME()" {
+		t.Errorf("fallback sql not match: %v", se.sqls)
+	}
+
+	p = buildTestPlan(t, info, "db_ks", "do 1, now()")
+	if r, err = p.ExecuteIn(util.NewRequestContext(), se); err != nil {
+		t.Fatal(err)
+	}
+	if r.Resultset != nil || len(se.sqls) != 1 {
+		t.Errorf("do result not match: %+v", r)
+	}
+}
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		timeZone string
+		offset   int
+	}{
+		{"+08:00", 8 * 3600},
+		{"-03:30", -(3*3600 + 30*60)},
+		{"+00:00", 0},
+	}
+	for _, test := range tests {
+		loc, err := parseTimeZone(test.timeZone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, offset := time.Now().In(loc).Zone(); offset != test.offset {
+			t.Errorf("time_zone: %s, expect: %d, actual: %d", test.timeZone, test.offset, offset)
+		}
+	}
+	if _, err := parseTimeZone("SYSTEM"); err == nil {
+		t.Errorf("parse invalid time_zone should fail")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+)
+
+// 非递归的公共表表达式内联为派生表后再计算路由
+func TestSelectWithCommonTableExpression(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_mycat",
+			sql: "with a as (select user from tbl_mycat_unknown) select user from a",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `user` FROM (SELECT `user` FROM (`tbl_mycat_unknown`)) AS `a`"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "/*master*/ WITH `a` (`uid`, name) AS (select id, user from tbl_mycat_unknown where user = '(a)'), b as (select uid from a) select b.uid from b join a x on b.uid = x.uid",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `b`.`uid` FROM (SELECT `uid` FROM ((SELECT `id` AS `uid`,`user` AS `name` FROM (`tbl_mycat_unknown`) WHERE `user`='(a)') AS `a`)) AS `b` JOIN (SELECT `id` AS `uid`,`user` AS `name` FROM (`tbl_mycat_unknown`) WHERE `user`='(a)') AS `x` ON `b`.`uid`=`x`.`uid`"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "with a as (select user from tbl_mycat) select user from a",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `user` FROM (SELECT `user` FROM (`tbl_mycat`)) AS `a`"},
+					"db_mycat_1": {"SELECT `user` FROM (SELECT `user` FROM (`tbl_mycat`)) AS `a`"},
+				},
+				"slice-1": {
+					"db_mycat_2": {"SELECT `user` FROM (SELECT `user` FROM (`tbl_mycat`)) AS `a`"},
+					"db_mycat_3": {"SELECT `user` FROM (SELECT `user` FROM (`tbl_mycat`)) AS `a`"},
+				},
+			},
+		},
+		{
+			db:     "db_mycat",
+			sql:    "with recursive a as (select 1 union all select 1 from a) select * from a",
+			hasErr: true,
+		},
+		{
+			db:     "db_mycat",
+			sql:    "with a as (select id from tbl_mycat_unknown) delete from tbl_mycat_unknown where id in (select id from a)",
+			hasErr: true,
+		},
+		{
+			db:     "db_mycat",
+			sql:    "with a (x, y) as (select user from tbl_mycat_unknown) select * from a",
+			hasErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
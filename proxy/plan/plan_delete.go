@@ -53,13 +53,13 @@ func (p *DeletePlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 
 	rs, err := sess.ExecuteSQLs(reqCtx, sqls)
 	if err != nil {
-		return nil, fmt.Errorf("execute in UpdatePlan error: %v", err)
+		return nil, fmt.Errorf("execute in UpdatePlan error: %w", err)
 	}
 
 	r, err := MergeExecResult(rs)
 
 	if err != nil {
-		return nil, fmt.Errorf("merge update result error: %v", err)
+		return nil, fmt.Errorf("merge update result error: %w", err)
 	}
 
 	return r, nil
@@ -68,27 +68,31 @@ func (p *DeletePlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 // HandleDeletePlan build a DeletePlan
 func HandleDeletePlan(p *DeletePlan) error {
 	if err := handleDeleteTableRefs(p); err != nil {
-		return fmt.Errorf("handle From error: %v", err)
+		return fmt.Errorf("handle From error: %w", err)
 	}
 
 	if err := handleDeleteWhere(p); err != nil {
-		return fmt.Errorf("handle Where error: %v", err)
+		return fmt.Errorf("handle Where error: %w", err)
 	}
 
 	if err := handleDeleteOrderBy(p); err != nil {
-		return fmt.Errorf("handle OrderBy error: %v", err)
+		return fmt.Errorf("handle OrderBy error: %w", err)
 	}
 
 	// Limit clause does not need to handle
 
 	// handle global table
 	if err := postHandleGlobalTableRouteResultInModify(p.StmtInfo); err != nil {
-		return fmt.Errorf("post handle global table error: %v", err)
+		return fmt.Errorf("post handle global table error: %w", err)
 	}
 
-	sqls, err := generateShardingSQLs(p.stmt, p.GetRouteResult(), p.router)
+	if err := checkArchivedWrite(p.GetRouteResult(), p.router); err != nil {
+		return err
+	}
+
+	sqls, err := generateShardingSQLs(p.stmt, p.GetRouteResult(), p.router, p.restoreFlags)
 	if err != nil {
-		return fmt.Errorf("generate sqls error: %v", err)
+		return fmt.Errorf("generate sqls error: %w", err)
 	}
 
 	p.sqls = sqls
@@ -107,7 +111,7 @@ func handleDeleteTableRefs(p *DeletePlan) error {
 	}
 
 	if join.Right != nil {
-		return fmt.Errorf("does not support update multiple tables in sharding")
+		return mysql.UnsupportedMultiTableDelete.Err()
 	}
 
 	return handleJoin(p.TableAliasStmtInfo, join)
@@ -121,7 +125,7 @@ func handleDeleteWhere(p *DeletePlan) error {
 
 	has, result, decorator, err := handleComparisonExpr(p.TableAliasStmtInfo, stmt.Where)
 	if err != nil {
-		return fmt.Errorf("rewrite Where error: %v", err)
+		return fmt.Errorf("rewrite Where error: %w", err)
 	}
 	if has {
 		p.GetRouteResult().Inter(result)
@@ -0,0 +1,165 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/XiaoMi/Gaea/backend"
+)
+
+// constants of plan description type
+const (
+	PlanTypeSelect             = "select"
+	PlanTypeInsert             = "insert"
+	PlanTypeUpdate             = "update"
+	PlanTypeDelete             = "delete"
+	PlanTypeUnshard            = "unshard"
+	PlanTypeExplain            = "explain"
+	PlanTypeSelectLastInsertID = "select_last_insert_id"
+	PlanTypeConstant           = "constant"
+)
+
+// Description is the inspectable structure of a plan,
+// external tools can consume the plan without executing it.
+type Description struct {
+	Type      string       `json:"type"`
+	ShardType string       `json:"shard_type"` // shard or unshard
+	Targets   []*Target    `json:"targets"`    // 按slice, db排序
+	Merge     *MergeOption `json:"merge,omitempty"`
+}
+
+// Target is the rewritten sqls executed in one db of a slice
+type Target struct {
+	Slice string   `json:"slice"`
+	DB    string   `json:"db"`
+	SQLs  []string `json:"sqls"`
+}
+
+// MergeOption describes how results from slices are merged, only for select plan
+type MergeOption struct {
+	Distinct          bool                 `json:"distinct"`
+	GroupByColumns    []int                `json:"group_by_columns"`
+	OrderByColumns    []*OrderByColumn     `json:"order_by_columns"`
+	AggregateFuncs    []*AggregateFuncDesc `json:"aggregate_funcs"`
+	Offset            int64                `json:"offset"` // 未设置则为-1
+	Count             int64                `json:"count"`  // 未设置则为-1
+	OriginColumnCount int                  `json:"origin_column_count"`
+	ColumnCount       int                  `json:"column_count"` // 补列后的列数, 大于OriginColumnCount时合并后去掉多余的列
+}
+
+// OrderByColumn is the column index and direction of ORDER BY
+type OrderByColumn struct {
+	Column int  `json:"column"`
+	Desc   bool `json:"desc"`
+}
+
+// AggregateFuncDesc is the aggregate function merged in proxy
+type AggregateFuncDesc struct {
+	Column int    `json:"column"`
+	Func   string `json:"func"`
+}
+
+// Describe return the description of plan
+func Describe(p Plan) (*Description, error) {
+	switch pl := p.(type) {
+	case *SelectPlan:
+		return &Description{
+			Type:      PlanTypeSelect,
+			ShardType: ShardTypeShard,
+			Targets:   describeTargets(pl.sqls),
+			Merge:     describeMergeOption(pl),
+		}, nil
+	case *InsertPlan:
+		return &Description{Type: PlanTypeInsert, ShardType: ShardTypeShard, Targets: describeTargets(pl.sqls)}, nil
+	case *UpdatePlan:
+		return &Description{Type: PlanTypeUpdate, ShardType: ShardTypeShard, Targets: describeTargets(pl.sqls)}, nil
+	case *DeletePlan:
+		return &Description{Type: PlanTypeDelete, ShardType: ShardTypeShard, Targets: describeTargets(pl.sqls)}, nil
+	case *UnshardPlan:
+		db := pl.db
+		if phyDB, ok := pl.phyDBs[db]; ok {
+			db = phyDB
+		}
+		return &Description{
+			Type:      PlanTypeUnshard,
+			ShardType: ShardTypeUnshard,
+			Targets:   []*Target{{Slice: backend.DefaultSlice, DB: db, SQLs: []string{pl.sql}}},
+		}, nil
+	case *ExplainPlan:
+		return &Description{Type: PlanTypeExplain, ShardType: pl.shardType, Targets: describeTargets(pl.sqls)}, nil
+	case *SelectLastInsertIDPlan:
+		return &Description{Type: PlanTypeSelectLastInsertID, ShardType: ShardTypeUnshard, Targets: []*Target{}}, nil
+	case *ConstantPlan:
+		return &Description{Type: PlanTypeConstant, ShardType: ShardTypeUnshard, Targets: []*Target{}}, nil
+	default:
+		return nil, fmt.Errorf("unsupport plan to describe, type: %T", p)
+	}
+}
+
+func describeTargets(sqls map[string]map[string][]string) []*Target {
+	ret := make([]*Target, 0, len(sqls))
+	for slice, dbSQLs := range sqls {
+		for db, s := range dbSQLs {
+			ret = append(ret, &Target{Slice: slice, DB: db, SQLs: append([]string(nil), s...)})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Slice != ret[j].Slice {
+			return ret[i].Slice < ret[j].Slice
+		}
+		return ret[i].DB < ret[j].DB
+	})
+	return ret
+}
+
+func describeMergeOption(p *SelectPlan) *MergeOption {
+	m := &MergeOption{
+		Distinct:          p.distinct,
+		GroupByColumns:    append([]int{}, p.groupByColumn...),
+		OrderByColumns:    make([]*OrderByColumn, 0, len(p.orderByColumn)),
+		AggregateFuncs:    make([]*AggregateFuncDesc, 0, len(p.aggregateFuncs)),
+		Offset:            p.offset,
+		Count:             p.count,
+		OriginColumnCount: p.originColumnCount,
+		ColumnCount:       p.columnCount,
+	}
+	for i, column := range p.orderByColumn {
+		m.OrderByColumns = append(m.OrderByColumns, &OrderByColumn{Column: column, Desc: p.orderByDirections[i]})
+	}
+	for column, merger := range p.aggregateFuncs {
+		m.AggregateFuncs = append(m.AggregateFuncs, &AggregateFuncDesc{Column: column, Func: aggregateFuncName(merger)})
+	}
+	sort.Slice(m.AggregateFuncs, func(i, j int) bool {
+		return m.AggregateFuncs[i].Column < m.AggregateFuncs[j].Column
+	})
+	return m
+}
+
+func aggregateFuncName(merger AggregateFuncMerger) string {
+	switch merger.(type) {
+	case *AggregateFuncCountMerger:
+		return "count"
+	case *AggregateFuncSumMerger:
+		return "sum"
+	case *AggregateFuncMaxMerger:
+		return "max"
+	case *AggregateFuncMinMerger:
+		return "min"
+	default:
+		return fmt.Sprintf("%T", merger)
+	}
+}
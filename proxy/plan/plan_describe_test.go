@@ -0,0 +1,114 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func buildTestPlan(t *testing.T, info *PlanInfo, db, sql string) Plan {
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatalf("parse sql error: %v", err)
+	}
+	p, err := BuildPlan(stmt, info.phyDBs, db, sql, info.rt, info.seqs)
+	if err != nil {
+		t.Fatalf("build plan error: %v", err)
+	}
+	return p
+}
+
+func TestDescribeSelectPlan(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	p := buildTestPlan(t, info, "db_ks", "select name, count(id) from tbl_ks where id in (1, 2) group by name order by name desc limit 10")
+	d, err := Describe(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Type != PlanTypeSelect || d.ShardType != ShardTypeShard {
+		t.Errorf("type not equal, actual: %s, %s", d.Type, d.ShardType)
+	}
+	if len(d.Targets) != 2 || d.Targets[0].Slice != "slice-0" || d.Targets[1].Slice != "slice-1" {
+		t.Fatalf("targets not equal, actual: %v", d.Targets)
+	}
+	if d.Targets[0].DB != "db_ks" || len(d.Targets[0].SQLs) != 1 {
+		t.Errorf("target not equal, actual: %+v", d.Targets[0])
+	}
+
+	m := d.Merge
+	if m == nil {
+		t.Fatal("merge option is nil")
+	}
+	if len(m.GroupByColumns) != 1 || m.GroupByColumns[0] != 0 {
+		t.Errorf("group by columns not equal, actual: %v", m.GroupByColumns)
+	}
+	if len(m.OrderByColumns) != 1 || m.OrderByColumns[0].Column != 0 || !m.OrderByColumns[0].Desc {
+		t.Errorf("order by columns not equal, actual: %v", m.OrderByColumns)
+	}
+	if len(m.AggregateFuncs) != 1 || m.AggregateFuncs[0].Column != 1 || m.AggregateFuncs[0].Func != "count" {
+		t.Errorf("aggregate funcs not equal, actual: %v", m.AggregateFuncs)
+	}
+	if m.Offset != 0 || m.Count != 10 {
+		t.Errorf("limit not equal, actual: %d, %d", m.Offset, m.Count)
+	}
+}
+
+func TestDescribePlan(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		db        string
+		sql       string
+		planType  string
+		shardType string
+		targets   int
+	}{
+		{"db_ks", "insert into tbl_ks (id, name) values (1, 'a')", PlanTypeInsert, ShardTypeShard, 1},
+		{"db_ks", "update tbl_ks set name = 'a' where id = 1", PlanTypeUpdate, ShardTypeShard, 1},
+		{"db_ks", "delete from tbl_ks where id = 2", PlanTypeDelete, ShardTypeShard, 1},
+		{"db_mycat", "select * from tbl_unshard", PlanTypeUnshard, ShardTypeUnshard, 1},
+		{"db_ks", "explain select * from tbl_ks where id = 1", PlanTypeExplain, ShardTypeShard, 1},
+		{"db_ks", "select last_insert_id()", PlanTypeSelectLastInsertID, ShardTypeUnshard, 0},
+		{"db_ks", "select 1", PlanTypeConstant, ShardTypeUnshard, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			d, err := Describe(buildTestPlan(t, info, test.db, test.sql))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Type != test.planType || d.ShardType != test.shardType || len(d.Targets) != test.targets {
+				t.Errorf("description not equal, actual: %+v", d)
+			}
+			if d.Merge != nil {
+				t.Errorf("expect nil merge option, actual: %+v", d.Merge)
+			}
+		})
+	}
+
+	d, _ := Describe(buildTestPlan(t, info, "db_mycat", "select * from tbl_unshard"))
+	if d.Targets[0].DB != "db_mycat_0" {
+		t.Errorf("unshard db not equal, expect: db_mycat_0, actual: %s", d.Targets[0].DB)
+	}
+}
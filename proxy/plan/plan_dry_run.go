@@ -0,0 +1,194 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
+)
+
+// dryRunDerivedTable 统计影响行数时使用的派生表别名
+const dryRunDerivedTable = "gaea_dry_run"
+
+// DryRunPlan 试运行DML: 只返回路由到的slice, db, 改写后的SQL以及预估影响行数, 不执行写入
+type DryRunPlan struct {
+	shardType    string
+	sqls         map[string]map[string][]string
+	count        bool // 是否在后端执行COUNT统计UPDATE, DELETE, INSERT ... SELECT的影响行数
+	sqlMode      mysql.SQLMode
+	restoreFlags format.RestoreFlags
+}
+
+// CreateDryRunPlan constructor of DryRunPlan, p为已经生成的DML执行计划
+func CreateDryRunPlan(p Plan, phyDBs map[string]string, r *router.Router, sqlMode mysql.SQLMode, count bool) (*DryRunPlan, error) {
+	shardType, sqls, err := GetPlanSQLs(p, phyDBs)
+	if err != nil {
+		return nil, fmt.Errorf("unsupport plan to dry run, %w", err)
+	}
+	return &DryRunPlan{
+		shardType:    shardType,
+		sqls:         sqls,
+		count:        count,
+		sqlMode:      sqlMode,
+		restoreFlags: getRestoreFlags(r, sqlMode),
+	}, nil
+}
+
+// ExecuteIn implement Plan
+func (p *DryRunPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	var rows [][]interface{}
+	var names = []string{"type", "slice", "db", "sql", "rows"}
+
+	sqlParser := parser.NewSQLParser()
+	sqlParser.SetSQLMode(p.sqlMode)
+
+	slices := make([]string, 0, len(p.sqls))
+	for slice := range p.sqls {
+		slices = append(slices, slice)
+	}
+	sort.Strings(slices)
+
+	for _, slice := range slices {
+		dbSQLs := p.sqls[slice]
+		dbs := make([]string, 0, len(dbSQLs))
+		for db := range dbSQLs {
+			dbs = append(dbs, db)
+		}
+		sort.Strings(dbs)
+
+		for _, db := range dbs {
+			for _, sql := range dbSQLs[db] {
+				affected, err := p.estimateRows(reqCtx, se, sqlParser, slice, db, sql)
+				if err != nil {
+					return nil, fmt.Errorf("estimate rows error, slice: %s, db: %s, sql: %s, err: %w", slice, db, sql, err)
+				}
+				rows = append(rows, []interface{}{p.shardType, slice, db, sql, affected})
+			}
+		}
+	}
+
+	r, err := mysql.BuildResultset(nil, names, rows)
+	if err != nil {
+		return nil, err
+	}
+	return &mysql.Result{Resultset: r}, nil
+}
+
+// Size implement Plan
+func (p *DryRunPlan) Size() int {
+	return 1
+}
+
+// estimateRows 预估单条SQL的影响行数, 无法预估时返回空字符串
+func (p *DryRunPlan) estimateRows(reqCtx *util.RequestContext, se Executor, sqlParser parser.SQLParser, slice, db, sql string) (string, error) {
+	stmt, err := sqlParser.ParseOneStmt(sql)
+	if err != nil {
+		return "", err
+	}
+
+	if s, ok := stmt.(*ast.InsertStmt); ok && s.Select == nil {
+		if len(s.Lists) != 0 {
+			return strconv.Itoa(len(s.Lists)), nil
+		}
+		return "1", nil // INSERT ... SET
+	}
+
+	if !p.count {
+		return "", nil
+	}
+
+	countSQL, err := p.generateCountSQL(stmt)
+	if err != nil {
+		return "", err
+	}
+	if countSQL == "" {
+		return "", nil
+	}
+
+	rs, err := se.ExecuteSQLs(reqCtx, map[string]map[string][]string{slice: {db: {countSQL}}})
+	if err != nil {
+		return "", err
+	}
+	if len(rs) == 0 || rs[0].Resultset == nil || len(rs[0].Values) == 0 || len(rs[0].Values[0]) == 0 {
+		return "", fmt.Errorf("empty count result")
+	}
+	if v, ok := rs[0].Values[0][0].([]byte); ok {
+		return string(v), nil
+	}
+	return fmt.Sprintf("%v", rs[0].Values[0][0]), nil
+}
+
+// generateCountSQL 将UPDATE, DELETE, INSERT ... SELECT改写为统计影响行数的SELECT COUNT语句
+func (p *DryRunPlan) generateCountSQL(stmt ast.StmtNode) (string, error) {
+	var tableRefs *ast.TableRefsClause
+	var where ast.ExprNode
+	var order *ast.OrderByClause
+	var limit *ast.Limit
+
+	switch s := stmt.(type) {
+	case *ast.UpdateStmt:
+		tableRefs, where, order, limit = s.TableRefs, s.Where, s.Order, s.Limit
+	case *ast.DeleteStmt:
+		tableRefs, where, order, limit = s.TableRefs, s.Where, s.Order, s.Limit
+	case *ast.InsertStmt:
+		str, err := parser.Restore(s.Select, p.restoreFlags)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("SELECT COUNT(1) FROM (%s) AS `%s`", str, dryRunDerivedTable), nil
+	default:
+		return "", nil
+	}
+
+	// 带ORDER BY ... LIMIT时只统计实际会被修改的行, 因此统一使用派生表
+	sb := &strings.Builder{}
+	sb.WriteString("SELECT 1 FROM ")
+	str, err := parser.Restore(tableRefs, p.restoreFlags)
+	if err != nil {
+		return "", err
+	}
+	sb.WriteString(str)
+	if where != nil {
+		if str, err = parser.Restore(where, p.restoreFlags); err != nil {
+			return "", err
+		}
+		sb.WriteString(" WHERE ")
+		sb.WriteString(str)
+	}
+	if order != nil {
+		if str, err = parser.Restore(order, p.restoreFlags); err != nil {
+			return "", err
+		}
+		sb.WriteString(" ")
+		sb.WriteString(str)
+	}
+	if limit != nil {
+		if str, err = parser.Restore(limit, p.restoreFlags); err != nil {
+			return "", err
+		}
+		sb.WriteString(" ")
+		sb.WriteString(str)
+	}
+	return fmt.Sprintf("SELECT COUNT(1) FROM (%s) AS `%s`", sb.String(), dryRunDerivedTable), nil
+}
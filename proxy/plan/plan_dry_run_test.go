@@ -0,0 +1,148 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// dryRunExecutor 记录下发的COUNT语句, 每个分片返回固定的行数
+type dryRunExecutor struct {
+	count int64
+	sqls  []string
+}
+
+func (e *dryRunExecutor) ExecuteSQL(ctx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
+	rs, err := e.ExecuteSQLs(ctx, map[string]map[string][]string{slice: {db: {sql}}})
+	if err != nil {
+		return nil, err
+	}
+	return rs[0], nil
+}
+
+func (e *dryRunExecutor) ExecuteSQLs(ctx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
+	var ret []*mysql.Result
+	for _, dbSQLs := range sqls {
+		for _, tableSQLs := range dbSQLs {
+			for _, sql := range tableSQLs {
+				e.sqls = append(e.sqls, sql)
+				r, err := mysql.BuildResultset(nil, []string{"COUNT(1)"}, [][]interface{}{{e.count}})
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, &mysql.Result{Resultset: r})
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (e *dryRunExecutor) SetLastInsertID(uint64) {}
+
+func (e *dryRunExecutor) GetLastInsertID() uint64 { return 0 }
+
+func TestDryRunPlan(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sql       string
+		count     bool
+		rows      [][]interface{}
+		countSQLs []string
+	}{
+		{
+			sql: "insert into tbl_mycat (id, a) values (5, 'x'), (9, 'y')",
+			rows: [][]interface{}{
+				{ShardTypeShard, "slice-0", "db_mycat_1", "INSERT INTO `tbl_mycat` (`id`,`a`) VALUES (5,'x'),(9,'y')", "2"},
+			},
+		},
+		{
+			sql: "delete from tbl_mycat where id = 5",
+			rows: [][]interface{}{
+				{ShardTypeShard, "slice-0", "db_mycat_1", "DELETE FROM `tbl_mycat` WHERE `id`=5", ""},
+			},
+		},
+		{
+			sql:   "update tbl_mycat set a = 'x' where id in (5, 6) order by id limit 10",
+			count: true,
+			rows: [][]interface{}{
+				{ShardTypeShard, "slice-0", "db_mycat_1", "UPDATE `tbl_mycat` SET `a`='x' WHERE `id` IN (5) ORDER BY `id` LIMIT 10", "3"},
+				{ShardTypeShard, "slice-1", "db_mycat_2", "UPDATE `tbl_mycat` SET `a`='x' WHERE `id` IN (6) ORDER BY `id` LIMIT 10", "3"},
+			},
+			countSQLs: []string{
+				"SELECT COUNT(1) FROM (SELECT 1 FROM `tbl_mycat` WHERE `id` IN (5) ORDER BY `id` LIMIT 10) AS `gaea_dry_run`",
+				"SELECT COUNT(1) FROM (SELECT 1 FROM `tbl_mycat` WHERE `id` IN (6) ORDER BY `id` LIMIT 10) AS `gaea_dry_run`",
+			},
+		},
+		{
+			sql:   "delete from tbl_mycat_unknown",
+			count: true,
+			rows: [][]interface{}{
+				{ShardTypeUnshard, "slice-0", "db_mycat_0", "DELETE FROM `tbl_mycat_unknown`", "3"},
+			},
+			countSQLs: []string{
+				"SELECT COUNT(1) FROM (SELECT 1 FROM `tbl_mycat_unknown`) AS `gaea_dry_run`",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			if err != nil {
+				t.Fatalf("parse sql error: %v", err)
+			}
+			p, err := BuildPlan(stmt, ns.phyDBs, "db_mycat", test.sql, ns.rt, ns.seqs)
+			if err != nil {
+				t.Fatalf("build plan error: %v", err)
+			}
+			dp, err := CreateDryRunPlan(p, ns.phyDBs, ns.rt, mysql.ModeNone, test.count)
+			if err != nil {
+				t.Fatalf("create dry run plan error: %v", err)
+			}
+
+			e := &dryRunExecutor{count: 3}
+			r, err := dp.ExecuteIn(util.NewRequestContext(), e)
+			if err != nil {
+				t.Fatalf("execute dry run plan error: %v", err)
+			}
+			if len(r.Values) != len(test.rows) {
+				t.Fatalf("rows not equal, expect: %v, actual: %v", test.rows, r.Values)
+			}
+			for i, row := range test.rows {
+				for j, v := range row {
+					if r.Values[i][j] != v {
+						t.Errorf("row %d column %s not equal, expect: %v, actual: %v", i, r.Fields[j].Name, v, r.Values[i][j])
+					}
+				}
+			}
+			if len(e.sqls) != len(test.countSQLs) {
+				t.Fatalf("count sqls not equal, expect: %v, actual: %v", test.countSQLs, e.sqls)
+			}
+			for i, sql := range test.countSQLs {
+				if e.sqls[i] != sql {
+					t.Errorf("count sql not equal, expect: %s, actual: %s", sql, e.sqls[i])
+				}
+			}
+		})
+	}
+}
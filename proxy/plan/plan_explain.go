@@ -36,48 +36,47 @@ type ExplainPlan struct {
 	sqls      map[string]map[string][]string
 }
 
-func buildExplainPlan(stmt *ast.ExplainStmt, phyDBs map[string]string, db, sql string, r *router.Router, seq *sequence.SequenceManager) (*ExplainPlan, error) {
+func buildExplainPlan(stmt *ast.ExplainStmt, phyDBs map[string]string, db, sql string, r *router.Router, seq *sequence.SequenceManager, sqlMode mysql.SQLMode) (*ExplainPlan, error) {
 	stmtToExplain := stmt.Stmt
 	if _, ok := stmtToExplain.(*ast.ExplainStmt); ok {
 		return nil, fmt.Errorf("nested explain")
 	}
 
-	p, err := BuildPlan(stmtToExplain, phyDBs, db, sql, r, seq)
+	p, err := BuildPlanWithSQLMode(stmtToExplain, phyDBs, db, sql, r, seq, sqlMode)
 	if err != nil {
-		return nil, fmt.Errorf("build plan to explain error: %v", err)
+		return nil, fmt.Errorf("build plan to explain error: %w", err)
 	}
 
-	ep := &ExplainPlan{}
+	shardType, sqls, err := GetPlanSQLs(p, phyDBs)
+	if err != nil {
+		return nil, fmt.Errorf("unsupport plan to explain, %w", err)
+	}
+	return &ExplainPlan{shardType: shardType, sqls: sqls}, nil
+}
 
+// GetPlanSQLs 获取执行计划下发到各个slice的SQL, 返回分片类型和slice -> 物理db -> sqls
+func GetPlanSQLs(p Plan, phyDBs map[string]string) (string, map[string]map[string][]string, error) {
 	switch pl := p.(type) {
 	case *SelectPlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *DeletePlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *UpdatePlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *InsertPlan:
-		ep.shardType = ShardTypeShard
-		ep.sqls = pl.sqls
-		return ep, nil
+		return ShardTypeShard, pl.sqls, nil
 	case *UnshardPlan:
-		ep.shardType = ShardTypeUnshard
-		ep.sqls = make(map[string]map[string][]string)
+		sqls := make(map[string]map[string][]string)
 		dbSQLs := make(map[string][]string)
-		if phyDB, ok := phyDBs[pl.db]; ok {
-			pl.db = phyDB
+		db := pl.db
+		if phyDB, ok := phyDBs[db]; ok {
+			db = phyDB
 		}
-		dbSQLs[pl.db] = []string{pl.sql}
-		ep.sqls[backend.DefaultSlice] = dbSQLs
-		return ep, nil
+		dbSQLs[db] = []string{pl.sql}
+		sqls[backend.DefaultSlice] = dbSQLs
+		return ShardTypeUnshard, sqls, nil
 	default:
-		return nil, fmt.Errorf("unsupport plan to explain, type: %T", p)
+		return "", nil, fmt.Errorf("type: %T", p)
 	}
 }
 
@@ -19,6 +19,7 @@ import (
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/logging"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/XiaoMi/Gaea/proxy/sequence"
 	"github.com/XiaoMi/Gaea/util"
@@ -37,7 +38,8 @@ type InsertPlan struct {
 	isAssignmentMode    bool
 	shardingColumnIndex int
 
-	sequences *sequence.SequenceManager
+	sequences    *sequence.SequenceManager
+	usedSequence bool // 是否从全局序列号取了值
 
 	sqls map[string]map[string][]string
 }
@@ -56,6 +58,11 @@ func (s *InsertPlan) GetStmt() *ast.InsertStmt {
 	return s.stmt
 }
 
+// UsesGlobalSequence check if values of the insert are taken from global sequence
+func (s *InsertPlan) UsesGlobalSequence() bool {
+	return s.usedSequence
+}
+
 // HandleInsertStmt build a InsertPlan
 func HandleInsertStmt(p *InsertPlan, stmt *ast.InsertStmt) error {
 	p.stmt = stmt
@@ -67,29 +74,33 @@ func HandleInsertStmt(p *InsertPlan, stmt *ast.InsertStmt) error {
 	// 处理全局表成功时会触发fastReturn
 	fastReturn, err := handleInsertTableRefs(p)
 	if err != nil {
-		return fmt.Errorf("handleInsertTableRefs error: %v", err)
+		return fmt.Errorf("handleInsertTableRefs error: %w", err)
 	}
 	if fastReturn {
 		return nil
 	}
 
 	if err := handleInsertGlobalSequenceValue(p); err != nil {
-		return fmt.Errorf("handleInsertGlobalSequenceValue error: %v", err)
+		return fmt.Errorf("handleInsertGlobalSequenceValue error: %w", err)
 	}
 
 	if err := handleInsertColumnNames(p); err != nil {
-		return fmt.Errorf("handleInsertColumnNames error: %v", err)
+		return fmt.Errorf("handleInsertColumnNames error: %w", err)
 	}
 
 	if err := handleInsertOnDuplicate(p); err != nil {
-		return fmt.Errorf("handleInsertOnDuplicate error: %v", err)
+		return fmt.Errorf("handleInsertOnDuplicate error: %w", err)
 	}
 
 	if err := handleInsertValues(p); err != nil {
-		return fmt.Errorf("handleInsertValues error: %v", err)
+		return fmt.Errorf("handleInsertValues error: %w", err)
+	}
+
+	if err := checkArchivedWrite(p.result, p.router); err != nil {
+		return err
 	}
 
-	sqls, err := generateShardingSQLs(p.stmt, p.result, p.router)
+	sqls, err := generateShardingSQLs(p.stmt, p.result, p.router, p.restoreFlags)
 	if err != nil {
 		logging.DefaultLogger.Warnf("generate insert parser failed, %v", err)
 		return err
@@ -138,7 +149,7 @@ func handleInsertTableRefs(p *InsertPlan) (fastReturn bool, err error) {
 
 	rule, need, err := NeedCreateTableNameDecoratorWithoutAlias(p.StmtInfo, tableName)
 	if err != nil {
-		return false, fmt.Errorf("check table name need to decorate error: %v", err)
+		return false, fmt.Errorf("check table name need to decorate error: %w", err)
 	}
 
 	if !need {
@@ -148,7 +159,7 @@ func handleInsertTableRefs(p *InsertPlan) (fastReturn bool, err error) {
 
 	decorator, err := CreateTableNameDecorator(tableName, rule, p.GetRouteResult())
 	if err != nil {
-		return false, fmt.Errorf("create table name decorator error: %v", err)
+		return false, fmt.Errorf("create table name decorator error: %w", err)
 	}
 
 	tableSource.Source = decorator
@@ -158,9 +169,9 @@ func handleInsertTableRefs(p *InsertPlan) (fastReturn bool, err error) {
 		p.result.db = rule.GetDB()
 		p.result.table = rule.GetTable()
 		p.result.indexes = rule.GetSubTableIndexes()
-		sqls, err := generateShardingSQLs(p.stmt, p.result, p.router)
+		sqls, err := generateShardingSQLs(p.stmt, p.result, p.router, p.restoreFlags)
 		if err != nil {
-			return false, fmt.Errorf("generate global table insert parser error: %v", err)
+			return false, fmt.Errorf("generate global table insert parser error: %w", err)
 		}
 		p.sqls = sqls
 		return true, nil
@@ -206,23 +217,31 @@ func removeSchemaAndTableInfoInColumnName(column *ast.ColumnName) {
 	column.Table.L = ""
 }
 
+// shardingValueExpr 带字符集前缀的字符串按字符串本身计算路由, 与去掉前缀时一致
+func shardingValueExpr(expr ast.ExprNode) ast.ExprNode {
+	if c, ok := expr.(*parser.CharsetLiteralExpr); ok {
+		return c.ValueExpr
+	}
+	return expr
+}
+
 // TODO: refactor
 func handleInsertValues(p *InsertPlan) error {
 	// assignment mode
 	if p.isAssignmentMode {
 		valueItem := p.stmt.Setlist[p.shardingColumnIndex].Expr
-		switch x := valueItem.(type) {
+		switch x := shardingValueExpr(valueItem).(type) {
 		case *driver.ValueExpr:
 			v, err := util.GetValueExprResult(x)
 			if err != nil {
-				return fmt.Errorf("get value expr result failed, %v", err)
+				return fmt.Errorf("get value expr result failed, %w", err)
 			}
 			if v == nil {
 				return fmt.Errorf("sharding value cannot be null")
 			}
 			routeIdx, err := p.tableRules[p.table].FindTableIndex(v)
 			if err != nil {
-				return fmt.Errorf("find table index error: %v", err)
+				return fmt.Errorf("find table index error: %w", err)
 			}
 			p.result.Inter([]int{routeIdx})
 		}
@@ -232,18 +251,18 @@ func handleInsertValues(p *InsertPlan) error {
 	// not assignment mode
 	for _, valueList := range p.stmt.Lists {
 		valueItem := valueList[p.shardingColumnIndex]
-		switch x := valueItem.(type) {
+		switch x := shardingValueExpr(valueItem).(type) {
 		case *driver.ValueExpr:
 			v, err := util.GetValueExprResult(x)
 			if err != nil {
-				return fmt.Errorf("get value expr result failed, %v", err)
+				return fmt.Errorf("get value expr result failed, %w", err)
 			}
 			if v == nil {
 				return fmt.Errorf("sharding value cannot be null")
 			}
 			routeIdx, err := p.tableRules[p.table].FindTableIndex(v)
 			if err != nil {
-				return fmt.Errorf("find table index error: %v", err)
+				return fmt.Errorf("find table index error: %w", err)
 			}
 			p.result.Inter([]int{routeIdx})
 		}
@@ -268,11 +287,31 @@ func handleInsertOnDuplicate(p *InsertPlan) error {
 			return errors.ErrUpdateKey
 		}
 		removeSchemaAndTableInfoInColumnName(a.Column)
+		a.Expr.Accept(&columnQualifierRemover{})
 	}
 
 	return nil
 }
 
+// columnQualifierRemover 去掉表达式中列名的库名和表名, INSERT只有一个表, 因此可以直接去掉
+type columnQualifierRemover struct{}
+
+// Enter implement ast.Visitor
+func (v *columnQualifierRemover) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*ast.SubqueryExpr); ok {
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (v *columnQualifierRemover) Leave(n ast.Node) (node ast.Node, ok bool) {
+	if column, ok := n.(*ast.ColumnName); ok {
+		removeSchemaAndTableInfoInColumnName(column)
+	}
+	return n, true
+}
+
 // 处理全局序列号, 目前一条SQL中只允许一个列使用全局序列号
 func handleInsertGlobalSequenceValue(p *InsertPlan) error {
 	seq, ok := p.sequences.GetSequence(p.db, p.table)
@@ -290,9 +329,10 @@ func handleInsertGlobalSequenceValue(p *InsertPlan) error {
 					if x.FnName.L == "nextval" {
 						id, err := seq.NextSeq()
 						if err != nil {
-							return fmt.Errorf("get next seq error: %v", err)
+							return fmt.Errorf("get next seq error: %w", err)
 						}
 						assignment.Expr = ast.NewValueExpr(id, "", "")
+						p.usedSequence = true
 						break
 					}
 				}
@@ -321,9 +361,10 @@ func handleInsertGlobalSequenceValue(p *InsertPlan) error {
 			if x.FnName.L == "nextval" {
 				id, err := seq.NextSeq()
 				if err != nil {
-					return fmt.Errorf("get next seq error: %v", err)
+					return fmt.Errorf("get next seq error: %w", err)
 				}
 				valueList[seqIndex] = ast.NewValueExpr(id, "", "")
+				p.usedSequence = true
 			}
 		}
 	}
@@ -335,7 +376,7 @@ func handleInsertGlobalSequenceValue(p *InsertPlan) error {
 func (s *InsertPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mysql.Result, error) {
 	rs, err := sess.ExecuteSQLs(reqCtx, s.sqls)
 	if err != nil {
-		return nil, fmt.Errorf("execute in InsertPlan error: %v", err)
+		return nil, fmt.Errorf("execute in InsertPlan error: %w", err)
 	}
 
 	r, err := MergeExecResult(rs)
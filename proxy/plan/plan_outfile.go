@@ -0,0 +1,206 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/pingcap/parser/ast"
+)
+
+// SelectIntoOutfilePlan 后端只能各自导出本分片的数据, 因此去掉INTO OUTFILE后执行查询, 由gaea把合并后的结果写入本地文件
+type SelectIntoOutfilePlan struct {
+	plan     Plan
+	fileName string
+	fields   *ast.FieldsClause
+	lines    *ast.LinesClause
+}
+
+func buildSelectIntoOutfilePlan(stmt *ast.SelectStmt, phyDBs map[string]string, db, sql string, r *router.Router, seq *sequence.SequenceManager, sqlMode mysql.SQLMode) (*SelectIntoOutfilePlan, error) {
+	opt := stmt.SelectIntoOpt
+	if opt.Tp != ast.SelectIntoOutfile {
+		return nil, fmt.Errorf("only support SELECT ... INTO OUTFILE")
+	}
+	stmt.SelectIntoOpt = nil
+
+	p, err := BuildPlanWithSQLMode(stmt, phyDBs, db, sql, r, seq, sqlMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SelectIntoOutfilePlan{
+		plan:     p,
+		fileName: opt.FileName,
+		fields:   opt.FieldsInfo,
+		lines:    opt.LinesInfo,
+	}, nil
+}
+
+// ExecuteIn implement Plan
+func (p *SelectIntoOutfilePlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	dir, _ := reqCtx.Get(util.OutfileDir).(string)
+	path, err := getOutfilePath(dir, p.fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := p.plan.ExecuteIn(reqCtx, se)
+	if err != nil {
+		return nil, err
+	}
+	if r.Resultset == nil {
+		return nil, fmt.Errorf("no result set to write into outfile")
+	}
+
+	if err := p.writeFile(path, r.Resultset); err != nil {
+		return nil, err
+	}
+	return &mysql.Result{Status: r.Status, AffectedRows: uint64(len(r.Values))}, nil
+}
+
+// Size implement Plan
+func (p *SelectIntoOutfilePlan) Size() int {
+	return 1
+}
+
+// 与MySQL的secure_file_priv类似, 只允许写入配置的目录, 且不覆盖已有文件
+func getOutfilePath(dir, fileName string) (string, error) {
+	if dir == "" {
+		return "", mysql.NewError(mysql.ErrUnknown, "SELECT ... INTO OUTFILE is disabled, outfile_dir is not configured")
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := fileName
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("outfile %s is not in outfile_dir", fileName))
+	}
+	return path, nil
+}
+
+func (p *SelectIntoOutfilePlan) writeFile(path string, rs *mysql.Resultset) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		if os.IsExist(err) {
+			return mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("File '%s' already exists", p.fileName))
+		}
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, row := range rs.Values {
+		w.WriteString(p.lines.Starting)
+		for i, value := range row {
+			if i > 0 {
+				w.WriteString(p.fields.Terminated)
+			}
+			w.WriteString(p.formatField(rs.Fields[i], value))
+		}
+		w.WriteString(p.lines.Terminated)
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// formatField 按FIELDS/LINES子句格式化字段, 规则与MySQL一致
+func (p *SelectIntoOutfilePlan) formatField(field *mysql.Field, value interface{}) string {
+	escaped := p.fields.Escaped
+	if value == nil {
+		if escaped == 0 {
+			return "NULL"
+		}
+		return string([]byte{escaped, 'N'})
+	}
+
+	var s string
+	switch v := value.(type) {
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+
+	enclosed := p.fields.Enclosed
+	if p.fields.OptEnclosed && !isOutfileStringType(field.Type) {
+		enclosed = 0
+	}
+
+	var b strings.Builder
+	if enclosed != 0 {
+		b.WriteByte(enclosed)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if escaped != 0 && p.needEscape(c) {
+			b.WriteByte(escaped)
+			if c == 0 {
+				c = '0'
+			}
+		}
+		b.WriteByte(c)
+	}
+	if enclosed != 0 {
+		b.WriteByte(enclosed)
+	}
+	return b.String()
+}
+
+// 需要转义: 转义符本身, 包围符, NUL, 未设置包围符时字段和行分隔符的首字符
+func (p *SelectIntoOutfilePlan) needEscape(c byte) bool {
+	if c == p.fields.Escaped || c == 0 {
+		return true
+	}
+	if p.fields.Enclosed != 0 {
+		return c == p.fields.Enclosed
+	}
+	if p.fields.Terminated != "" && c == p.fields.Terminated[0] {
+		return true
+	}
+	return p.lines.Terminated != "" && c == p.lines.Terminated[0]
+}
+
+func isOutfileStringType(tp byte) bool {
+	switch tp {
+	case mysql.TypeVarchar, mysql.TypeVarString, mysql.TypeString, mysql.TypeTinyBlob, mysql.TypeMediumBlob,
+		mysql.TypeLongBlob, mysql.TypeBlob, mysql.TypeEnum, mysql.TypeSet, mysql.TypeJSON:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/pingcap/parser/ast"
+)
+
+type resultPlan struct {
+	r *mysql.Result
+}
+
+func (p *resultPlan) ExecuteIn(*util.RequestContext, Executor) (*mysql.Result, error) {
+	return p.r, nil
+}
+
+func (p *resultPlan) Size() int {
+	return 1
+}
+
+func TestBuildSelectIntoOutfilePlan(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+	sql := `select name from tbl_ks where id in (1, 2) into outfile 'a.csv' fields terminated by ','`
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := BuildPlan(stmt, info.phyDBs, "db_ks", sql, info.rt, info.seqs)
+	if err != nil {
+		t.Fatalf("BuildPlan error: %v", err)
+	}
+	op, ok := p.(*SelectIntoOutfilePlan)
+	if !ok {
+		t.Fatalf("plan type not match, actual: %T", p)
+	}
+	if op.fileName != "a.csv" || op.fields.Terminated != "," {
+		t.Errorf("outfile options not match, file: %s, terminated: %s", op.fileName, op.fields.Terminated)
+	}
+	sp, ok := op.plan.(*SelectPlan)
+	if !ok {
+		t.Fatalf("inner plan type not match, actual: %T", op.plan)
+	}
+	expect := map[string]map[string][]string{
+		"slice-0": {"db_ks": {"SELECT `name` FROM `tbl_ks_0001` WHERE `id` IN (1)"}},
+		"slice-1": {"db_ks": {"SELECT `name` FROM `tbl_ks_0002` WHERE `id` IN (2)"}},
+	}
+	if !checkSQLs(expect, sp.GetSQLs()) {
+		t.Errorf("not equal, expect: %v, actual: %v", expect, sp.GetSQLs())
+	}
+}
+
+func TestSelectIntoOutfilePlanExecuteIn(t *testing.T) {
+	rs := &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: []byte("id"), Type: mysql.TypeLonglong}, {Name: []byte("name"), Type: mysql.TypeVarString}},
+		Values: [][]interface{}{
+			{int64(1), []byte("a\tb")},
+			{int64(2), nil},
+			{uint64(3), `x"y\z,`},
+		},
+	}
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{
+			`select 1 into outfile 'default.txt'`,
+			"1\ta\\\tb\n2\t\\N\n3\tx\"y\\\\z,\n",
+		},
+		{
+			`select 1 into outfile 'opt.csv' fields terminated by ',' optionally enclosed by '"' lines terminated by '\r\n'`,
+			"1,\"a\tb\"\r\n2,\\N\r\n3,\"x\\\"y\\\\z,\"\r\n",
+		},
+		{
+			`select 1 into outfile 'noescape.csv' fields terminated by ',' escaped by '' lines starting by '>'`,
+			">1,a\tb\n>2,NULL\n>3,x\"y\\z,\n",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opt := stmt.(*ast.SelectStmt).SelectIntoOpt
+		p := &SelectIntoOutfilePlan{
+			plan:     &resultPlan{r: &mysql.Result{Resultset: rs}},
+			fileName: opt.FileName,
+			fields:   opt.FieldsInfo,
+			lines:    opt.LinesInfo,
+		}
+
+		reqCtx := util.NewRequestContext()
+		reqCtx.Set(util.OutfileDir, dir)
+		r, err := p.ExecuteIn(reqCtx, nil)
+		if err != nil {
+			t.Fatalf("execute error, sql: %s, err: %v", test.sql, err)
+		}
+		if r.AffectedRows != 3 {
+			t.Errorf("affected rows not match, sql: %s, actual: %d", test.sql, r.AffectedRows)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, opt.FileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != test.expect {
+			t.Errorf("file content not match, sql: %s, expect: %q, actual: %q", test.sql, test.expect, string(data))
+		}
+
+		// 不覆盖已有文件
+		if _, err := p.ExecuteIn(reqCtx, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("write existing file should fail, err: %v", err)
+		}
+	}
+}
+
+func TestGetOutfilePath(t *testing.T) {
+	if _, err := getOutfilePath("", "a.csv"); err == nil {
+		t.Errorf("outfile should be disabled without outfile_dir")
+	}
+	for _, name := range []string{"../a.csv", "/etc/passwd", "/data/export/../a.csv"} {
+		if _, err := getOutfilePath("/data/export", name); err == nil {
+			t.Errorf("outfile out of outfile_dir should fail, file: %s", name)
+		}
+	}
+	for _, name := range []string{"a.csv", "sub/a.csv", "/data/export/a.csv"} {
+		path, err := getOutfilePath("/data/export", name)
+		if err != nil || !strings.HasPrefix(path, "/data/export/") {
+			t.Errorf("get outfile path failed, file: %s, path: %s, err: %v", name, path, err)
+		}
+	}
+}
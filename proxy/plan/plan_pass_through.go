@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// PassThroughPlan is the plan for statement which can not be parsed, the sql is sent to slice verbatim
+type PassThroughPlan struct {
+	basePlan
+
+	db    string
+	sql   string
+	slice string
+}
+
+// CreatePassThroughPlan constructor of PassThroughPlan
+func CreatePassThroughPlan(db, sql, slice string) *PassThroughPlan {
+	return &PassThroughPlan{
+		db:    db,
+		sql:   sql,
+		slice: slice,
+	}
+}
+
+// GetSlice return the slice which sql is sent to
+func (p *PassThroughPlan) GetSlice() string {
+	return p.slice
+}
+
+// ExecuteIn implement Plan
+func (p *PassThroughPlan) ExecuteIn(reqCtx *util.RequestContext, se Executor) (*mysql.Result, error) {
+	r, err := se.ExecuteSQL(reqCtx, p.slice, p.db, p.sql)
+	if err != nil {
+		return nil, err
+	}
+
+	// 无法得知语句类型, 返回了insert id时都设置到会话中
+	if r.InsertID != 0 {
+		se.SetLastInsertID(r.InsertID)
+	}
+	return r, nil
+}
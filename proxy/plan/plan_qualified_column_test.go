@@ -0,0 +1,121 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+)
+
+// 带库名、表名或表别名的列和通配符需要改写为物理库名和分表名
+func TestQualifiedColumnRewrite(t *testing.T) {
+	nsStr := `
+{
+    "name": "gaea_namespace_qualified",
+    "online": true,
+    "allowed_dbs": {"db_ks": true},
+    "default_phy_dbs": {"db_ks": "db_ks_phy"},
+    "slices": [
+        {"name": "slice-0", "user_name": "root", "password": "root", "master": "127.0.0.1:3306", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-1", "user_name": "root", "password": "root", "master": "127.0.0.1:3307", "capacity": 64, "max_capacity": 128}
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ks",
+            "type": "mod",
+            "key": "id",
+            "locations": [2, 2],
+            "slices": ["slice-0", "slice-1"]
+        }
+    ],
+    "users": [
+        {"user_name": "test_qualified", "password": "test_qualified", "namespace": "gaea_namespace_qualified", "rw_flag": 2, "rw_split": 1}
+    ],
+    "default_slice": "slice-0"
+}`
+	nsModel, err := createNamespace(nsStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := createRouter(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := createSequenceManager(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &PlanInfo{phyDBs: nsModel.DefaultPhyDBS, rt: rt, seqs: seqs}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "select db_ks.tbl_ks.name, tbl_ks.* from db_ks.tbl_ks where db_ks.tbl_ks.id = 1",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `db_ks_phy`.`tbl_ks_0001`.`name`,`tbl_ks_0001`.* FROM `db_ks_phy`.`tbl_ks_0001` WHERE `db_ks_phy`.`tbl_ks_0001`.`id`=1"}},
+			},
+		},
+		{
+			db:     "db_ks",
+			sql:    "select t.*, db_ks.tbl_ks.id from tbl_ks t where t.id = 1",
+			hasErr: true, // 使用表别名后不能再用表名引用
+		},
+		{
+			db:  "db_ks",
+			sql: "select tbl_ks.name from tbl_ks as tbl_ks where tbl_ks.id = 1",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `tbl_ks`.`name` FROM `tbl_ks_0001` AS `tbl_ks` WHERE `tbl_ks`.`id`=1"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select t.* from db_ks.tbl_ks as t where t.id = 1 and upper(t.name) = 'A'",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `t`.* FROM `db_ks_phy`.`tbl_ks_0001` AS `t` WHERE `t`.`id`=1 AND UPPER(`t`.`name`)='A'"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select * from tbl_ks where tbl_ks.id = 1 and tbl_ks.name = concat(tbl_ks.nick, 'a') and case when tbl_ks.age > 1 then 1 else 0 end = 1",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT * FROM `tbl_ks_0001` WHERE `tbl_ks_0001`.`id`=1 AND `tbl_ks_0001`.`name`=CONCAT(`tbl_ks_0001`.`nick`, 'a') AND CASE WHEN `tbl_ks_0001`.`age`>1 THEN 1 ELSE 0 END=1"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "update db_ks.tbl_ks set name = concat(db_ks.tbl_ks.name, 'x') where db_ks.tbl_ks.id = 2",
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"UPDATE `db_ks_phy`.`tbl_ks_0002` SET `name`=CONCAT(`db_ks_phy`.`tbl_ks_0002`.`name`, 'x') WHERE `db_ks_phy`.`tbl_ks_0002`.`id`=2"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "delete from db_ks.tbl_ks where db_ks.tbl_ks.id = 3 and length(db_ks.tbl_ks.name) > 3",
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"DELETE FROM `db_ks_phy`.`tbl_ks_0003` WHERE `db_ks_phy`.`tbl_ks_0003`.`id`=3 AND LENGTH(`db_ks_phy`.`tbl_ks_0003`.`name`)>3"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "insert into tbl_ks (id, name) values (1, 'a') on duplicate key update name = concat(tbl_ks.name, values(tbl_ks.name))",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"INSERT INTO `tbl_ks_0001` (`id`,`name`) VALUES (1,'a') ON DUPLICATE KEY UPDATE `name`=CONCAT(`name`, VALUES(`name`))"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(info, test))
+	}
+}
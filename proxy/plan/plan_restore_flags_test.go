@@ -0,0 +1,173 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+)
+
+// namespace配置restore_flags时, 按配置的格式生成发往后端的SQL
+func TestRestoreFlagsConfig(t *testing.T) {
+	nsStr := `
+{
+    "name": "gaea_namespace_restore",
+    "online": true,
+    "allowed_dbs": {"db_ks": true},
+    "slices": [
+        {"name": "slice-0", "user_name": "root", "password": "root", "master": "127.0.0.1:3306", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-1", "user_name": "root", "password": "root", "master": "127.0.0.1:3307", "capacity": 64, "max_capacity": 128}
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ks",
+            "type": "mod",
+            "key": "id",
+            "locations": [2, 2],
+            "slices": ["slice-0", "slice-1"]
+        }
+    ],
+    "users": [
+        {"user_name": "test_restore", "password": "test_restore", "namespace": "gaea_namespace_restore", "rw_flag": 2, "rw_split": 1}
+    ],
+    "default_slice": "slice-0",
+    "restore_flags": {
+        "keyword_case": "lower",
+        "no_escape_backslash": true,
+        "spaces_around_binary_operation": true
+    }
+}`
+	nsModel, err := createNamespace(nsStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := createRouter(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := createSequenceManager(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &PlanInfo{phyDBs: nsModel.DefaultPhyDBS, rt: rt, seqs: seqs}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: `select name from tbl_ks where id = 1 and name = 'a\\b'`,
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"select `name` from `tbl_ks_0001` where `id` = 1 and `name` = 'a\\b'"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "insert into tbl_ks (id, name) values (2, 'b')",
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"insert into `tbl_ks_0002` (`id`,`name`) values (2,'b')"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select name from tbl_unshard where id = 1",
+			sqls: map[string]map[string][]string{
+				backend.DefaultSlice: {"db_ks": {"select `name` from `tbl_unshard` where `id` = 1"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(info, test))
+	}
+}
+
+// 配置preserve_literals时, 字符串、十六进制和二进制常量使用原始SQL中的写法
+func TestRestoreFlagsPreserveLiterals(t *testing.T) {
+	nsStr := `
+{
+    "name": "gaea_namespace_restore",
+    "online": true,
+    "allowed_dbs": {"db_ks": true},
+    "slices": [
+        {"name": "slice-0", "user_name": "root", "password": "root", "master": "127.0.0.1:3306", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-1", "user_name": "root", "password": "root", "master": "127.0.0.1:3307", "capacity": 64, "max_capacity": 128}
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ks",
+            "type": "mod",
+            "key": "id",
+            "locations": [2, 2],
+            "slices": ["slice-0", "slice-1"]
+        }
+    ],
+    "users": [
+        {"user_name": "test_restore", "password": "test_restore", "namespace": "gaea_namespace_restore", "rw_flag": 2, "rw_split": 1}
+    ],
+    "default_slice": "slice-0",
+    "restore_flags": {
+        "preserve_literals": true
+    }
+}`
+	nsModel, err := createNamespace(nsStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := createRouter(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := createSequenceManager(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &PlanInfo{phyDBs: nsModel.DefaultPhyDBS, rt: rt, seqs: seqs}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: `insert into tbl_ks (id, name, data) values (2, 'b', _binary '\0\Z\'\\` + "\xff\xfe" + `')`,
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"INSERT INTO `tbl_ks_0002` (`id`,`name`,`data`) VALUES (2,'b',_binary '\\0\\Z\\'\\\\" + "\xff\xfe" + "')"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select name from tbl_ks where id = 1 and data in (0xDEADbeef, X'00FF', b'0000000001', 0b11, x'')",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `name` FROM `tbl_ks_0001` WHERE `id`=1 AND `data` IN (0xDEADbeef,X'00FF',b'0000000001',0b11,x'')"}},
+			},
+		},
+		{
+			// 同一个值有多种写法时无法确定对应关系, 重新生成
+			db:  "db_ks",
+			sql: `update tbl_ks set name = 'it''s', data = "a\nb" where id = 1 and name = 'it\'s'`,
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"UPDATE `tbl_ks_0001` SET `name`='it''s', `data`=\"a\\nb\" WHERE `id`=1 AND `name`='it''s'"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: `select name from tbl_unshard where data = 0x00ff /* 'x' */ and name = ''`,
+			sqls: map[string]map[string][]string{
+				backend.DefaultSlice: {"db_ks": {"SELECT `name` FROM `tbl_unshard` WHERE `data`=0x00ff AND `name`=''"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(info, test))
+	}
+}
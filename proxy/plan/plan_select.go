@@ -75,12 +75,13 @@ func (s *SelectPlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 
 	rs, err := sess.ExecuteSQLs(reqCtx, sqls)
 	if err != nil {
-		return nil, fmt.Errorf("execute in SelectPlan error: %v", err)
+		return nil, fmt.Errorf("execute in SelectPlan error: %w", err)
 	}
 
-	r, err := MergeSelectResult(s, s.stmt, rs)
+	spill, _ := reqCtx.Get(util.MergeSpill).(*MergeSpillConfig)
+	r, err := MergeSelectResult(s, s.stmt, rs, spill)
 	if err != nil {
-		return nil, fmt.Errorf("merge select result error: %v", err)
+		return nil, fmt.Errorf("merge select result error: %w", err)
 	}
 
 	return r, nil
@@ -154,13 +155,13 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 	p.distinct = stmt.Distinct
 
 	if err := handleTableRefs(p, stmt); err != nil {
-		return fmt.Errorf("handle From error: %v", err)
+		return fmt.Errorf("handle From error: %w", err)
 	}
 
 	// field list的处理必须在group by之前, 因为group by, order by会补列, 而这些补充的列是已经处理过的
 	if stmt.Fields != nil {
 		if err := handleFieldList(p, stmt); err != nil {
-			return fmt.Errorf("handle Fields error: %v", err)
+			return fmt.Errorf("handle Fields error: %w", err)
 		}
 
 		// 记录补列前的Fields长度
@@ -169,13 +170,13 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 
 	// group by的处理必须在table处理之后
 	if err := handleGroupBy(p, stmt); err != nil {
-		return fmt.Errorf("handle GroupBy error: %v", err)
+		return fmt.Errorf("handle GroupBy error: %w", err)
 	}
 
 	// order by的处理必须在table处理之后
 	// 与group by补列的顺序没有要求, 只要保证处理返回结果去掉这些补充列时保持相反的顺序, 这里放在group by之后
 	if err := handleOrderBy(p, stmt); err != nil {
-		return fmt.Errorf("handle OrderBy error: %v", err)
+		return fmt.Errorf("handle OrderBy error: %w", err)
 	}
 
 	handleExtraFieldList(p, stmt)
@@ -186,28 +187,28 @@ func HandleSelectStmt(p *SelectPlan, stmt *ast.SelectStmt) error {
 	}
 
 	if err := handleWhere(p, stmt); err != nil {
-		return fmt.Errorf("handle Where error: %v", err)
+		return fmt.Errorf("handle Where error: %w", err)
 	}
 
 	if err := handleHaving(p, stmt); err != nil {
-		return fmt.Errorf("handle Having error: %v", err)
+		return fmt.Errorf("handle Having error: %w", err)
 	}
 
 	if err := handleLimit(p, stmt); err != nil {
-		return fmt.Errorf("handle Limit error: %v", err)
+		return fmt.Errorf("handle Limit error: %w", err)
 	}
 
 	if err := postHandleGlobalTableRouteResultInQuery(p.StmtInfo); err != nil {
-		return fmt.Errorf("post handle global table error: %v", err)
+		return fmt.Errorf("post handle global table error: %w", err)
 	}
 
 	if err := postHandleHintDatabaseFunction(p); err != nil {
-		return fmt.Errorf("handle Hint error: %v", err)
+		return fmt.Errorf("handle Hint error: %w", err)
 	}
 
-	sqls, err := generateShardingSQLs(p.stmt, p.result, p.router)
+	sqls, err := generateShardingSQLs(p.stmt, p.result, p.router, p.restoreFlags)
 	if err != nil {
-		return fmt.Errorf("generate select SQL error: %v", err)
+		return fmt.Errorf("generate select SQL error: %w", err)
 	}
 
 	p.sqls = sqls
@@ -223,7 +224,7 @@ func handleGroupBy(p *SelectPlan, stmt *ast.SelectStmt) error {
 
 	groupByFields, err := createSelectFieldsFromByItems(p, stmt.GroupBy.Items)
 	if err != nil {
-		return fmt.Errorf("get group by fields error: %v", err)
+		return fmt.Errorf("get group by fields error: %w", err)
 	}
 
 	for i := 0; i < len(groupByFields); i++ {
@@ -243,7 +244,7 @@ func handleOrderBy(p *SelectPlan, stmt *ast.SelectStmt) error {
 
 	orderByFields, err := createSelectFieldsFromByItems(p, stmt.OrderBy.Items)
 	if err != nil {
-		return fmt.Errorf("get order by fields error: %v", err)
+		return fmt.Errorf("get order by fields error: %w", err)
 	}
 
 	for i := 0; i < len(orderByFields); i++ {
@@ -367,7 +368,7 @@ func handleTableRefs(p *SelectPlan, stmt *ast.SelectStmt) error {
 
 func handleJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 	if err := precheckJoinClause(join); err != nil {
-		return fmt.Errorf("precheck Join error: %v", err)
+		return fmt.Errorf("precheck Join error: %w", err)
 	}
 
 	// 只允许最多两个表的JOIN
@@ -376,11 +377,11 @@ func handleJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 		case *ast.TableSource:
 			// 改写两个表的node
 			if err := rewriteTableSource(p, left); err != nil {
-				return fmt.Errorf("rewrite left TableSource error: %v", err)
+				return fmt.Errorf("rewrite left TableSource error: %w", err)
 			}
 		case *ast.Join:
 			if err := handleJoin(p, left); err != nil {
-				return fmt.Errorf("handle nested left Join error: %v", err)
+				return fmt.Errorf("handle nested left Join error: %w", err)
 			}
 		default:
 			return fmt.Errorf("invalid left Join type: %T", join.Left)
@@ -393,7 +394,7 @@ func handleJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 		}
 
 		if err := rewriteTableSource(p, right); err != nil {
-			return fmt.Errorf("rewrite right TableSource error: %v", err)
+			return fmt.Errorf("rewrite right TableSource error: %w", err)
 		}
 	}
 
@@ -401,7 +402,7 @@ func handleJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 	if join.On != nil {
 		err := rewriteOnCondition(p, join.On)
 		if err != nil {
-			return fmt.Errorf("rewrite on condition error: %v", err)
+			return fmt.Errorf("rewrite on condition error: %w", err)
 		}
 	}
 
@@ -415,7 +416,7 @@ func handleWhere(p *SelectPlan, stmt *ast.SelectStmt) (err error) {
 
 	has, result, decorator, err := handleComparisonExpr(p.TableAliasStmtInfo, stmt.Where)
 	if err != nil {
-		return fmt.Errorf("rewrite Where error: %v", err)
+		return fmt.Errorf("rewrite Where error: %w", err)
 	}
 	if has {
 		p.GetRouteResult().Inter(result)
@@ -429,10 +430,10 @@ func precheckJoinClause(join *ast.Join) error {
 	// 不允许USING的列名中出现DB名和表名, 因为目前Join子句的TableName不方便加装饰器
 	for _, c := range join.Using {
 		if c.Schema.String() != "" {
-			return fmt.Errorf("JOIN does not support USING column with schema")
+			return mysql.UnsupportedQualifiedUsingColumn.Err("schema")
 		}
 		if c.Table.String() != "" {
-			return fmt.Errorf("JOIN does not support USING column with table")
+			return mysql.UnsupportedQualifiedUsingColumn.Err("table")
 		}
 	}
 	return nil
@@ -446,12 +447,12 @@ func rewriteTableSource(p *TableAliasStmtInfo, tableSource *ast.TableSource) err
 		return rewriteTableNameInTableSource(p, tableSource)
 	case *ast.SelectStmt:
 		if err := handleSubquerySelectStmt(p, ss); err != nil {
-			return fmt.Errorf("handleSubquerySelectStmt error: %v", err)
+			return fmt.Errorf("handleSubquerySelectStmt error: %w", err)
 		}
 		alias := tableSource.AsName.L
 		if alias != "" {
 			if _, err := p.RecordSubqueryTableAlias(alias); err != nil {
-				return fmt.Errorf("record subquery alias error: %v", err)
+				return fmt.Errorf("record subquery alias error: %w", err)
 			}
 		}
 		return nil
@@ -469,7 +470,7 @@ func rewriteTableNameInTableSource(p *TableAliasStmtInfo, tableSource *ast.Table
 
 	rule, need, err := NeedCreateTableNameDecorator(p, tableName, alias)
 	if err != nil {
-		return fmt.Errorf("check NeedCreateTableNameDecorator error: %v", err)
+		return fmt.Errorf("check NeedCreateTableNameDecorator error: %w", err)
 	}
 
 	if !need {
@@ -479,7 +480,7 @@ func rewriteTableNameInTableSource(p *TableAliasStmtInfo, tableSource *ast.Table
 	// 这是一个分片表或关联表, 创建一个TableName的装饰器, 并替换原有节点
 	d, err := CreateTableNameDecorator(tableName, rule, p.GetRouteResult())
 	if err != nil {
-		return fmt.Errorf("create TableNameDecorator error: %v", err)
+		return fmt.Errorf("create TableNameDecorator error: %w", err)
 	}
 	tableSource.Source = d
 	return nil
@@ -488,7 +489,7 @@ func rewriteTableNameInTableSource(p *TableAliasStmtInfo, tableSource *ast.Table
 func rewriteOnCondition(p *TableAliasStmtInfo, on *ast.OnCondition) error {
 	has, result, decorator, err := handleComparisonExpr(p, on.Expr)
 	if err != nil {
-		return fmt.Errorf("rewrite Expr in OnCondition error: %v", err)
+		return fmt.Errorf("rewrite Expr in OnCondition error: %w", err)
 	}
 	if has {
 		p.GetRouteResult().Inter(result)
@@ -529,7 +530,8 @@ func postHandleHintDatabaseFunction(p *SelectPlan) error {
 
 // ColumnNameRewriteVisitor visit ColumnNameExpr, check if need decorate, and then decorate it.
 type ColumnNameRewriteVisitor struct {
-	info *TableAliasStmtInfo
+	info         *TableAliasStmtInfo
+	skipSubquery bool // 不改写子查询中的列名, 子查询中的表不在外层查询的表信息中
 }
 
 // NewColumnNameRewriteVisitor constructor of ColumnNameRewriteVisitor
@@ -541,6 +543,9 @@ func NewColumnNameRewriteVisitor(p *TableAliasStmtInfo) *ColumnNameRewriteVisito
 
 // Enter implement ast.Visitor
 func (s *ColumnNameRewriteVisitor) Enter(n ast.Node) (node ast.Node, skipChildren bool) {
+	if _, ok := n.(*ast.SubqueryExpr); ok && s.skipSubquery {
+		return n, true
+	}
 	return n, false
 }
 
@@ -552,7 +557,7 @@ func (s *ColumnNameRewriteVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
 	}
 	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInField(s.info, field)
 	if err != nil {
-		panic(fmt.Errorf("check NeedCreateColumnNameExprDecoratorInField in ColumnNameExpr error: %v", err))
+		panic(fmt.Errorf("check NeedCreateColumnNameExprDecoratorInField in ColumnNameExpr error: %w", err))
 	}
 	if need {
 		decorator := CreateColumnNameExprDecorator(field, rule, isAlias, s.info.GetRouteResult())
@@ -562,6 +567,21 @@ func (s *ColumnNameRewriteVisitor) Leave(n ast.Node) (node ast.Node, ok bool) {
 	return n, true
 }
 
+// 改写表达式中带库名或表名的列, 用于比较运算中既不是列名也不是值的一侧, 如函数参数
+func rewriteColumnNamesInExpr(p *TableAliasStmtInfo, expr ast.ExprNode) (ret ast.ExprNode, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("rewrite column names panic: %v", e)
+		}
+	}()
+
+	// 这里如果出错, 只能通过panic返回err
+	rewriter := NewColumnNameRewriteVisitor(p)
+	rewriter.skipSubquery = true
+	node, _ := expr.Accept(rewriter)
+	return node.(ast.ExprNode), nil
+}
+
 func handleFieldList(p *SelectPlan, stmt *ast.SelectStmt) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -579,6 +599,21 @@ func handleFieldList(p *SelectPlan, stmt *ast.SelectStmt) (err error) {
 	columnNameRewriter := NewColumnNameRewriteVisitor(p.TableAliasStmtInfo)
 	fields.Accept(columnNameRewriter)
 
+	// 带表名的通配符 (tbl.*) 同样需要改写
+	for _, f := range fields.Fields {
+		if f.WildCard == nil {
+			continue
+		}
+		rule, need, isAlias, err := NeedCreateWildCardFieldDecorator(p.TableAliasStmtInfo, f.WildCard)
+		if err != nil {
+			return fmt.Errorf("check WildCardField error: %w", err)
+		}
+		if need {
+			f.Expr = CreateWildCardFieldDecorator(f.WildCard, rule, isAlias, p.GetRouteResult())
+			f.WildCard = nil
+		}
+	}
+
 	// 如果最外层是聚合函数, 则生成一个聚合函数装饰器, 并记录对应的列位置
 	// 只处理最外层的聚合函数.
 	for i, f := range fields.Fields {
@@ -586,10 +621,10 @@ func handleFieldList(p *SelectPlan, stmt *ast.SelectStmt) (err error) {
 		case *ast.AggregateFuncExpr:
 			merger, err := CreateAggregateFunctionMerger(field.F, i)
 			if err != nil {
-				return fmt.Errorf("create aggregate function merger error, column index: %d, err: %v", i, err)
+				return fmt.Errorf("create aggregate function merger error, column index: %d, err: %w", i, err)
 			}
 			if err := p.setAggregateFuncMerger(i, merger); err != nil {
-				return fmt.Errorf("set aggregate function merger error, column index: %d, err: %v", i, err)
+				return fmt.Errorf("set aggregate function merger error, column index: %d, err: %w", i, err)
 			}
 		default:
 			// do nothing
@@ -640,14 +675,14 @@ func handleComparisonExpr(p *TableAliasStmtInfo, comp ast.ExprNode) (bool, []int
 func handlePatternInExpr(p *TableAliasStmtInfo, expr *ast.PatternInExpr) (bool, []int, ast.ExprNode, error) {
 	rule, need, isAlias, err := NeedCreatePatternInExprDecorator(p, expr)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("check PatternInExpr error: %v", err)
+		return false, nil, nil, fmt.Errorf("check PatternInExpr error: %w", err)
 	}
 	if !need {
 		return false, nil, expr, nil
 	}
 	decorator, err := CreatePatternInExprDecorator(expr, rule, isAlias, p.GetRouteResult())
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("create PatternInExprDecorator error: %v", err)
+		return false, nil, nil, fmt.Errorf("create PatternInExprDecorator error: %w", err)
 	}
 	return true, decorator.GetCurrentRouteResult(), decorator, nil
 }
@@ -655,7 +690,7 @@ func handlePatternInExpr(p *TableAliasStmtInfo, expr *ast.PatternInExpr) (bool,
 func handleBetweenExpr(p *TableAliasStmtInfo, expr *ast.BetweenExpr) (bool, []int, ast.ExprNode, error) {
 	rule, need, isAlias, err := NeedCreateBetweenExprDecorator(p, expr)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("check BetweenExpr error: %v", err)
+		return false, nil, nil, fmt.Errorf("check BetweenExpr error: %w", err)
 	}
 	if !need {
 		return false, nil, expr, nil
@@ -663,7 +698,7 @@ func handleBetweenExpr(p *TableAliasStmtInfo, expr *ast.BetweenExpr) (bool, []in
 
 	decorator, err := CreateBetweenExprDecorator(expr, rule, isAlias, p.GetRouteResult())
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("create CreateBetweenExprDecorator error: %v", err)
+		return false, nil, nil, fmt.Errorf("create CreateBetweenExprDecorator error: %w", err)
 	}
 
 	return true, decorator.GetCurrentRouteResult(), decorator, nil
@@ -721,7 +756,7 @@ func handleBinaryOperationExprMathCompare(p *TableAliasStmtInfo, expr *ast.Binar
 		if lType == FuncCallExpr {
 			hintDB, err := getDatabaseFuncHint(expr.L.(*ast.FuncCallExpr), expr.R)
 			if err != nil {
-				return false, nil, nil, fmt.Errorf("get database function hint error: %v", err)
+				return false, nil, nil, fmt.Errorf("get database function hint error: %w", err)
 			}
 			if hintDB != "" {
 				p.hintPhyDB = hintDB
@@ -730,7 +765,7 @@ func handleBinaryOperationExprMathCompare(p *TableAliasStmtInfo, expr *ast.Binar
 		} else if rType == FuncCallExpr {
 			hintDB, err := getDatabaseFuncHint(expr.R.(*ast.FuncCallExpr), expr.L)
 			if err != nil {
-				return false, nil, nil, fmt.Errorf("get database function hint error: %v", err)
+				return false, nil, nil, fmt.Errorf("get database function hint error: %w", err)
 			}
 			if hintDB != "" {
 				p.hintPhyDB = hintDB
@@ -750,14 +785,14 @@ func handleBinaryOperationExprMathCompare(p *TableAliasStmtInfo, expr *ast.Binar
 		column := expr.L.(*ast.ColumnNameExpr)
 		rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, column)
 		if err != nil {
-			return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.L: %v", err)
+			return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.L: %w", err)
 		}
-		if !need {
-			return false, nil, expr, nil
+		if need {
+			expr.L = CreateColumnNameExprDecorator(column, rule, isAlias, p.GetRouteResult())
+		}
+		if expr.R, err = rewriteColumnNamesInExpr(p, expr.R); err != nil {
+			return false, nil, nil, fmt.Errorf("rewrite BinaryOperationExpr.R error: %w", err)
 		}
-
-		decorator := CreateColumnNameExprDecorator(column, rule, isAlias, p.GetRouteResult())
-		expr.L = decorator
 		return false, nil, expr, nil
 	}
 
@@ -768,18 +803,19 @@ func handleBinaryOperationExprMathCompare(p *TableAliasStmtInfo, expr *ast.Binar
 		column := expr.R.(*ast.ColumnNameExpr)
 		rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, column)
 		if err != nil {
-			return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.R: %v", err)
+			return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.R: %w", err)
 		}
-		if !need {
-			return false, nil, expr, nil
+		if need {
+			expr.R = CreateColumnNameExprDecorator(column, rule, isAlias, p.GetRouteResult())
+		}
+		if expr.L, err = rewriteColumnNamesInExpr(p, expr.L); err != nil {
+			return false, nil, nil, fmt.Errorf("rewrite BinaryOperationExpr.L error: %w", err)
 		}
-
-		decorator := CreateColumnNameExprDecorator(column, rule, isAlias, p.GetRouteResult())
-		expr.R = decorator
 		return false, nil, expr, nil
 	}
 
-	return false, nil, expr, nil
+	// 两侧都不是列名, 如 UPPER(tbl.name) = 'A', 只改写其中的列名
+	return handleBinaryOperationExprOther(p, expr)
 }
 
 // 处理其他情况的运算
@@ -795,6 +831,12 @@ func handleBinaryOperationExprOther(p *TableAliasStmtInfo, expr *ast.BinaryOpera
 			lDecorator := CreateColumnNameExprDecorator(lColumn, lRule, lIsAlias, p.GetRouteResult())
 			expr.L = lDecorator
 		}
+	} else {
+		lExpr, err := rewriteColumnNamesInExpr(p, expr.L)
+		if err != nil {
+			return false, nil, nil, fmt.Errorf("rewrite BinaryOperationExpr.L error: %w", err)
+		}
+		expr.L = lExpr
 	}
 	if rColumn, ok := expr.R.(*ast.ColumnNameExpr); ok {
 		rRule, rNeed, rIsAlias, rErr := NeedCreateColumnNameExprDecoratorInCondition(p, rColumn)
@@ -805,6 +847,12 @@ func handleBinaryOperationExprOther(p *TableAliasStmtInfo, expr *ast.BinaryOpera
 			rDecorator := CreateColumnNameExprDecorator(rColumn, rRule, rIsAlias, p.GetRouteResult())
 			expr.R = rDecorator
 		}
+	} else {
+		rExpr, err := rewriteColumnNamesInExpr(p, expr.R)
+		if err != nil {
+			return false, nil, nil, fmt.Errorf("rewrite BinaryOperationExpr.R error: %w", err)
+		}
+		expr.R = rExpr
 	}
 	return false, nil, expr, nil
 }
@@ -836,11 +884,7 @@ func getFindTableIndexesFunc(op opcode.Op) func(rule router.Rule, columnName str
 		// 如果是分表列, 还需要根据运算符判断
 		switch op {
 		case opcode.EQ:
-			index, err := rule.FindTableIndex(v)
-			if err != nil {
-				return nil, err
-			}
-			return []int{index}, nil
+			return router.FindReadTableIndexes(rule, v)
 		case opcode.NE:
 			return rule.GetSubTableIndexes(), nil
 		case opcode.GT, opcode.GE, opcode.LT, opcode.LE:
@@ -920,7 +964,7 @@ func handleBinaryOperationExprCompareLeftColumnRightValue(p *TableAliasStmtInfo,
 	column := expr.L.(*ast.ColumnNameExpr)
 	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, column)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.L: %v", err)
+		return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.L: %w", err)
 	}
 	if !need {
 		return false, nil, expr, nil
@@ -936,12 +980,12 @@ func handleBinaryOperationExprCompareLeftColumnRightValue(p *TableAliasStmtInfo,
 	valueExpr := expr.R.(*driver.ValueExpr)
 	v, err := util.GetValueExprResult(valueExpr)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("get ValueExpr value error: %v", err)
+		return false, nil, nil, fmt.Errorf("get ValueExpr value error: %w", err)
 	}
 
 	tableIndexes, err := findTableIndexes(rule, column.Name.Name.L, v)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("find table index error: %v", err)
+		return false, nil, nil, fmt.Errorf("find table index error: %w", err)
 	}
 
 	return true, tableIndexes, expr, nil
@@ -951,7 +995,7 @@ func handleBinaryOperationExprCompareLeftValueRightColumn(p *TableAliasStmtInfo,
 	column := expr.R.(*ast.ColumnNameExpr)
 	rule, need, isAlias, err := NeedCreateColumnNameExprDecoratorInCondition(p, column)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.R: %v", err)
+		return false, nil, nil, fmt.Errorf("check ColumnNameExpr error in BinaryOperationExpr.R: %w", err)
 	}
 	if !need {
 		return false, nil, expr, nil
@@ -967,12 +1011,12 @@ func handleBinaryOperationExprCompareLeftValueRightColumn(p *TableAliasStmtInfo,
 	valueExpr := expr.L.(*driver.ValueExpr)
 	v, err := util.GetValueExprResult(valueExpr)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("get ValueExpr value error: %v", err)
+		return false, nil, nil, fmt.Errorf("get ValueExpr value error: %w", err)
 	}
 
 	tableIndexes, err := findTableIndexes(rule, column.Name.Name.L, v)
 	if err != nil {
-		return false, nil, nil, fmt.Errorf("find table index error: %v", err)
+		return false, nil, nil, fmt.Errorf("find table index error: %w", err)
 	}
 
 	return true, tableIndexes, expr, nil
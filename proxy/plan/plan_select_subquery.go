@@ -64,7 +64,7 @@ func handleSubquerySelectStmt(p *TableAliasStmtInfo, subquery *ast.SelectStmt) (
 	}()
 
 	if err = handleSubqueryTableRefs(p, subquery); err != nil {
-		return fmt.Errorf("handle From error: %v", err)
+		return fmt.Errorf("handle From error: %w", err)
 	}
 
 	// 对所有可能含有ColumnName的Node做装饰.
@@ -102,14 +102,14 @@ func handleSubqueryTableRefs(p *TableAliasStmtInfo, stmt *ast.SelectStmt) error
 	}
 
 	if err := handleSubqueryJoin(p, join); err != nil {
-		return fmt.Errorf("handleSubqueryTableRefs error: %v", err)
+		return fmt.Errorf("handleSubqueryTableRefs error: %w", err)
 	}
 	return nil
 }
 
 func handleSubqueryJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 	if err := precheckJoinClause(join); err != nil {
-		return fmt.Errorf("precheck Join error: %v", err)
+		return fmt.Errorf("precheck Join error: %w", err)
 	}
 
 	// 只允许最多两个表的JOIN
@@ -118,11 +118,11 @@ func handleSubqueryJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 		case *ast.TableSource:
 			// 改写两个表的node
 			if err := rewriteSubqueryTableSource(p, left); err != nil {
-				return fmt.Errorf("rewrite left TableSource error: %v", err)
+				return fmt.Errorf("rewrite left TableSource error: %w", err)
 			}
 		case *ast.Join:
 			if err := handleSubqueryJoin(p, left); err != nil {
-				return fmt.Errorf("handle nested left Join error: %v", err)
+				return fmt.Errorf("handle nested left Join error: %w", err)
 			}
 		default:
 			return fmt.Errorf("invalid left Join type: %T", join.Left)
@@ -135,7 +135,7 @@ func handleSubqueryJoin(p *TableAliasStmtInfo, join *ast.Join) error {
 		}
 
 		if err := rewriteSubqueryTableSource(p, right); err != nil {
-			return fmt.Errorf("rewrite right TableSource error: %v", err)
+			return fmt.Errorf("rewrite right TableSource error: %w", err)
 		}
 	}
 
@@ -169,7 +169,7 @@ func rewriteSubqueryTableNameInTableSource(p *TableAliasStmtInfo, tableSource *a
 	// 不记录子查询的表名alias
 	rule, need, err := NeedCreateTableNameDecorator(p, tableName, "")
 	if err != nil {
-		return fmt.Errorf("check NeedCreateTableNameDecorator error: %v", err)
+		return fmt.Errorf("check NeedCreateTableNameDecorator error: %w", err)
 	}
 
 	if !need {
@@ -179,7 +179,7 @@ func rewriteSubqueryTableNameInTableSource(p *TableAliasStmtInfo, tableSource *a
 	// 这是一个分片表或关联表, 创建一个TableName的装饰器, 并替换原有节点
 	d, err := CreateTableNameDecorator(tableName, rule, p.GetRouteResult())
 	if err != nil {
-		return fmt.Errorf("create TableNameDecorator error: %v", err)
+		return fmt.Errorf("create TableNameDecorator error: %w", err)
 	}
 	tableSource.Source = d
 	return nil
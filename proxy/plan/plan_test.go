@@ -20,8 +20,12 @@ import (
 	"sync/atomic"
 	"testing"
 
+	pparser "github.com/pingcap/parser"
+	pmysql "github.com/pingcap/parser/mysql"
+
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/XiaoMi/Gaea/proxy/sequence"
 )
@@ -500,3 +504,86 @@ func preparePlanInfo() (*PlanInfo, error) {
 	}
 	return planInfo, nil
 }
+
+func TestBuildPlanWithSQLMode(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sqlMode mysql.SQLMode
+		db      string
+		sql     string
+		sqls    map[string]map[string][]string
+	}{
+		{
+			mysql.ModeANSIQuotes,
+			"db_ks",
+			`select "name" from "tbl_ks" where "id" = 1`,
+			map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `name` FROM `tbl_ks_0001` WHERE `id`=1"}},
+			},
+		},
+		{
+			mysql.ModePipesAsConcat,
+			"db_ks",
+			`select name || 'a' from tbl_ks where id = 1`,
+			map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT CONCAT(`name`, 'a') FROM `tbl_ks_0001` WHERE `id`=1"}},
+			},
+		},
+		{
+			mysql.ModeNoBackslashEscapes,
+			"db_ks",
+			`update tbl_ks set name = 'a\b' where id = 1`,
+			map[string]map[string][]string{
+				"slice-0": {"db_ks": {"UPDATE `tbl_ks_0001` SET `name`='a\\b' WHERE `id`=1"}},
+			},
+		},
+		{
+			mysql.ModeNoBackslashEscapes,
+			"db_mycat",
+			`select 'a\b' from tbl_unshard`,
+			map[string]map[string][]string{
+				backend.DefaultSlice: {"db_mycat_0": {"SELECT 'a\\b' FROM `tbl_unshard`"}},
+			},
+		},
+		{
+			mysql.ModeNone,
+			"db_ks",
+			`update tbl_ks set name = 'a\\b' where id = 1`,
+			map[string]map[string][]string{
+				"slice-0": {"db_ks": {"UPDATE `tbl_ks_0001` SET `name`='a\\\\b' WHERE `id`=1"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			p := pparser.New()
+			p.SetSQLMode(pmysql.SQLMode(test.sqlMode))
+			stmt, err := p.ParseOneStmt(test.sql, "", "")
+			if err != nil {
+				t.Fatalf("parse sql error: %v", err)
+			}
+			pl, err := BuildPlanWithSQLMode(stmt, info.phyDBs, test.db, test.sql, info.rt, info.seqs, test.sqlMode)
+			if err != nil {
+				t.Fatalf("build plan error: %v", err)
+			}
+			d, err := Describe(pl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := make(map[string]map[string][]string)
+			for _, target := range d.Targets {
+				if actual[target.Slice] == nil {
+					actual[target.Slice] = make(map[string][]string)
+				}
+				actual[target.Slice][target.DB] = target.SQLs
+			}
+			if !checkSQLs(test.sqls, actual) {
+				t.Errorf("not equal, expect: %v, actual: %v", test.sqls, actual)
+			}
+		})
+	}
+}
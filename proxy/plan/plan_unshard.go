@@ -22,6 +22,7 @@ import (
 
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/util"
 )
 
@@ -69,15 +70,19 @@ func IsSelectLastInsertIDStmt(stmt ast.StmtNode) bool {
 
 // CreateUnshardPlan constructor of UnshardPlan
 func CreateUnshardPlan(stmt ast.StmtNode, phyDBs map[string]string, db string, tableNames []*ast.TableName) (*UnshardPlan, error) {
+	return createUnshardPlan(stmt, phyDBs, db, tableNames, util.EscapeRestoreFlags)
+}
+
+func createUnshardPlan(stmt ast.StmtNode, phyDBs map[string]string, db string, tableNames []*ast.TableName, restoreFlags format.RestoreFlags) (*UnshardPlan, error) {
 	p := &UnshardPlan{
 		db:     db,
 		phyDBs: phyDBs,
 		stmt:   stmt,
 	}
 	rewriteUnshardTableName(phyDBs, tableNames)
-	rsql, err := generateUnshardingSQL(stmt)
+	rsql, err := generateUnshardingSQL(stmt, restoreFlags)
 	if err != nil {
-		return nil, fmt.Errorf("generate unshardPlan SQL error: %v", err)
+		return nil, fmt.Errorf("generate unshardPlan SQL error: %w", err)
 	}
 	p.sql = rsql
 	return p, nil
@@ -92,11 +97,9 @@ func rewriteUnshardTableName(phyDBs map[string]string, tableNames []*ast.TableNa
 	}
 }
 
-func generateUnshardingSQL(stmt ast.StmtNode) (string, error) {
-	s := &strings.Builder{}
-	ctx := format.NewRestoreCtx(util.EscapeRestoreFlags, s)
-	_ = stmt.Restore(ctx)
-	return s.String(), nil
+func generateUnshardingSQL(stmt ast.StmtNode, restoreFlags format.RestoreFlags) (string, error) {
+	sql, _ := parser.Restore(stmt, restoreFlags)
+	return sql, nil
 }
 
 // CreateSelectLastInsertIDPlan constructor of SelectLastInsertIDPlan
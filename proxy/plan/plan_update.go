@@ -53,13 +53,13 @@ func (s *UpdatePlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 
 	rs, err := sess.ExecuteSQLs(reqCtx, sqls)
 	if err != nil {
-		return nil, fmt.Errorf("execute in UpdatePlan error: %v", err)
+		return nil, fmt.Errorf("execute in UpdatePlan error: %w", err)
 	}
 
 	r, err := MergeExecResult(rs)
 
 	if err != nil {
-		return nil, fmt.Errorf("merge update result error: %v", err)
+		return nil, fmt.Errorf("merge update result error: %w", err)
 	}
 
 	return r, nil
@@ -68,31 +68,35 @@ func (s *UpdatePlan) ExecuteIn(reqCtx *util.RequestContext, sess Executor) (*mys
 // HandleUpdatePlan build a UpdatePlan
 func HandleUpdatePlan(p *UpdatePlan) error {
 	if err := handleUpdateTableRefs(p); err != nil {
-		return fmt.Errorf("handle From error: %v", err)
+		return fmt.Errorf("handle From error: %w", err)
 	}
 
 	if err := handleUpdateAssignmentList(p); err != nil {
-		return fmt.Errorf("handle assignment list error: %v", err)
+		return fmt.Errorf("handle assignment list error: %w", err)
 	}
 
 	if err := handleUpdateWhere(p); err != nil {
-		return fmt.Errorf("handle Where error: %v", err)
+		return fmt.Errorf("handle Where error: %w", err)
 	}
 
 	if err := handleUpdateOrderBy(p); err != nil {
-		return fmt.Errorf("handle OrderBy error: %v", err)
+		return fmt.Errorf("handle OrderBy error: %w", err)
 	}
 
 	// Limit clause does not need to handle
 
 	// handle global table
 	if err := postHandleGlobalTableRouteResultInModify(p.StmtInfo); err != nil {
-		return fmt.Errorf("post handle global table error: %v", err)
+		return fmt.Errorf("post handle global table error: %w", err)
 	}
 
-	sqls, err := generateShardingSQLs(p.stmt, p.GetRouteResult(), p.router)
+	if err := checkArchivedWrite(p.GetRouteResult(), p.router); err != nil {
+		return err
+	}
+
+	sqls, err := generateShardingSQLs(p.stmt, p.GetRouteResult(), p.router, p.restoreFlags)
 	if err != nil {
-		return fmt.Errorf("generate sqls error: %v", err)
+		return fmt.Errorf("generate sqls error: %w", err)
 	}
 
 	p.sqls = sqls
@@ -111,7 +115,7 @@ func handleUpdateTableRefs(p *UpdatePlan) error {
 	}
 
 	if join.Right != nil {
-		return fmt.Errorf("does not support update multiple tables in sharding")
+		return mysql.UnsupportedMultiTableUpdate.Err()
 	}
 
 	return handleJoin(p.TableAliasStmtInfo, join)
@@ -125,7 +129,7 @@ func handleUpdateWhere(p *UpdatePlan) error {
 
 	has, result, decorator, err := handleComparisonExpr(p.TableAliasStmtInfo, stmt.Where)
 	if err != nil {
-		return fmt.Errorf("rewrite Where error: %v", err)
+		return fmt.Errorf("rewrite Where error: %w", err)
 	}
 	if has {
 		p.GetRouteResult().Inter(result)
@@ -173,6 +177,12 @@ func handleUpdateAssignmentList(p *UpdatePlan) error {
 			return fmt.Errorf("cannot update shard column value")
 		}
 		removeSchemaAndTableInfoInColumnName(assignment.Column)
+
+		expr, err := rewriteColumnNamesInExpr(p.TableAliasStmtInfo, assignment.Expr)
+		if err != nil {
+			return err
+		}
+		assignment.Expr = expr
 	}
 	return nil
 }
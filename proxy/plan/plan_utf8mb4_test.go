@@ -0,0 +1,91 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+)
+
+// 4字节的utf8mb4字符在标识符和字符串中改写前后保持不变, 字符集前缀不能丢失
+func TestUTF8MB4IdentifierAndLiteral(t *testing.T) {
+	ns, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []SQLTestcase{
+		{
+			db:  "db_mycat",
+			sql: "select `列😀`, 'a😀\\'b' as `别名😀` from tbl_mycat where id = 0 and `名` = '𝄞\\\\'",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `列😀`,'a😀''b' AS `别名😀` FROM `tbl_mycat` WHERE `id`=0 AND `名`='𝄞\\\\'"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "update tbl_mycat set a = '😀`\"' where id in (0, 2)",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"UPDATE `tbl_mycat` SET `a`='😀`\"' WHERE `id` IN (0)"},
+				},
+				"slice-1": {
+					"db_mycat_2": {"UPDATE `tbl_mycat` SET `a`='😀`\"' WHERE `id` IN (2)"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "select a from tbl_mycat where id = 0 and a = _utf8mb4'😀' and b = _binary 'x' and c = '_utf8mb4'",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `a` FROM `tbl_mycat` WHERE `id`=0 AND `a`=_utf8mb4'😀' AND `b`=_binary'x' AND `c`='_utf8mb4'"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "insert into tbl_mycat (id, `列😀`) values (1, _utf8mb4'😀😀')",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_1": {"INSERT INTO `tbl_mycat` (`id`,`列😀`) VALUES (1,_utf8mb4'😀😀')"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "insert into tbl_mycat (id, a) values (_utf8mb4'2', 'x')",
+			sqls: map[string]map[string][]string{
+				"slice-1": {
+					"db_mycat_2": {"INSERT INTO `tbl_mycat` (`id`,`a`) VALUES (_utf8mb4'2','x')"},
+				},
+			},
+		},
+		{
+			db:  "db_mycat",
+			sql: "with `😀` (`列😀`) as (select user from tbl_mycat_unknown where user = _utf8mb4'😀)') select `列😀` from `😀`",
+			sqls: map[string]map[string][]string{
+				"slice-0": {
+					"db_mycat_0": {"SELECT `列😀` FROM (SELECT `user` AS `列😀` FROM (`tbl_mycat_unknown`) WHERE `user`=_utf8mb4'😀)') AS `😀`"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(ns, test))
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"testing"
+)
+
+func TestVersionedRulePlan(t *testing.T) {
+	nsStr := `
+{
+    "name": "gaea_namespace_version",
+    "online": true,
+    "allowed_dbs": {"db_ks": true},
+    "default_phy_dbs": {"db_ks": "db_ks"},
+    "slices": [
+        {"name": "slice-0", "user_name": "root", "password": "root", "master": "127.0.0.1:3306", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-1", "user_name": "root", "password": "root", "master": "127.0.0.1:3307", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-2", "user_name": "root", "password": "root", "master": "127.0.0.1:3308", "capacity": 64, "max_capacity": 128},
+        {"name": "slice-3", "user_name": "root", "password": "root", "master": "127.0.0.1:3309", "capacity": 64, "max_capacity": 128}
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ver",
+            "type": "mod",
+            "key": "id",
+            "locations": [2, 2, 2, 2],
+            "slices": ["slice-0", "slice-1", "slice-2", "slice-3"],
+            "effective_from": "2020-01-01 00:00:00",
+            "previous_version": {
+                "type": "mod",
+                "locations": [2, 2],
+                "slices": ["slice-0", "slice-1"]
+            }
+        }
+    ],
+    "users": [
+        {"user_name": "test_version", "password": "test_version", "namespace": "gaea_namespace_version", "rw_flag": 2, "rw_split": 1}
+    ],
+    "default_slice": "slice-0"
+}`
+	nsModel, err := createNamespace(nsStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := createRouter(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqs, err := createSequenceManager(nsModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &PlanInfo{phyDBs: nsModel.DefaultPhyDBS, rt: rt, seqs: seqs}
+
+	// 过渡期内写入按新规则路由, 查询、更新和删除同时路由到两个版本的分表
+	tests := []SQLTestcase{
+		{
+			db:  "db_ks",
+			sql: "insert into tbl_ver (id, a) values (5, 'hi')",
+			sqls: map[string]map[string][]string{
+				"slice-2": {"db_ks": {"INSERT INTO `tbl_ver_0005` (`id`,`a`) VALUES (5,'hi')"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "select a from tbl_ver where id = 5",
+			sqls: map[string]map[string][]string{
+				"slice-0": {"db_ks": {"SELECT `a` FROM `tbl_ver_0001` WHERE `id`=5"}},
+				"slice-2": {"db_ks": {"SELECT `a` FROM `tbl_ver_0005` WHERE `id`=5"}},
+			},
+		},
+		{
+			db:  "db_ks",
+			sql: "update tbl_ver set a = 'b' where id in (5, 6)",
+			sqls: map[string]map[string][]string{
+				"slice-1": {"db_ks": {"UPDATE `tbl_ver_0002` SET `a`='b' WHERE `id` IN (6)"}},
+				"slice-0": {"db_ks": {"UPDATE `tbl_ver_0001` SET `a`='b' WHERE `id` IN (5)"}},
+				"slice-2": {"db_ks": {"UPDATE `tbl_ver_0005` SET `a`='b' WHERE `id` IN (5)"}},
+				"slice-3": {"db_ks": {"UPDATE `tbl_ver_0006` SET `a`='b' WHERE `id` IN (6)"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, getTestFunc(info, test))
+	}
+}
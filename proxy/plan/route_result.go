@@ -27,6 +27,8 @@ type RouteResult struct {
 
 	currentIndex int   // 当前遍历indexes位置下标
 	indexes      []int // 分片索引列表, 是有序的
+
+	phyDB func(db string) string // 逻辑库名对应的物理库名, 用于改写分片SQL中的库名
 }
 
 // NewRouteResult constructor of RouteResult
@@ -61,6 +63,14 @@ func (r *RouteResult) Union(indexes []int) {
 	r.indexes = unionList(r.indexes, indexes)
 }
 
+// GetPhyDB get physical database name of db in rewritten sql
+func (r *RouteResult) GetPhyDB(db string) string {
+	if r.phyDB == nil {
+		return db
+	}
+	return r.phyDB(db)
+}
+
 // GetShardIndexes get shard indexes
 func (r *RouteResult) GetShardIndexes() []int {
 	return r.indexes
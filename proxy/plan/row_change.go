@@ -0,0 +1,145 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"github.com/pingcap/parser/ast"
+	driver "github.com/pingcap/tidb/types/parser_driver"
+
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// row change operations
+const (
+	RowChangeInsert  = "insert"
+	RowChangeReplace = "replace"
+	RowChangeUpdate  = "update"
+	RowChangeDelete  = "delete"
+)
+
+// RowChange describes the rows changed by a single table DML statement
+type RowChange struct {
+	DB             string        `json:"db"`
+	Table          string        `json:"table"`
+	Operation      string        `json:"operation"`
+	ShardingColumn string        `json:"sharding_column"` // 非分片表和全局表为空
+	ShardingValues []interface{} `json:"sharding_values"` // 分片列的插入值或等值条件, 无法确定时为空
+}
+
+// GetRowChange return the row change of single table INSERT, REPLACE, UPDATE and DELETE, nil for other statements.
+// It must be called before building plan, since building plan rewrites the statement.
+func GetRowChange(stmt ast.StmtNode, db string, r *router.Router) (*RowChange, error) {
+	var tableName *ast.TableName
+	var operation string
+	switch s := stmt.(type) {
+	case *ast.InsertStmt:
+		if s.Select != nil {
+			return nil, nil
+		}
+		tableName, operation = getSingleTableName(s.Table), RowChangeInsert
+		if s.IsReplace {
+			operation = RowChangeReplace
+		}
+	case *ast.UpdateStmt:
+		tableName, operation = getSingleTableName(s.TableRefs), RowChangeUpdate
+	case *ast.DeleteStmt:
+		if s.IsMultiTable {
+			return nil, nil
+		}
+		tableName, operation = getSingleTableName(s.TableRefs), RowChangeDelete
+	default:
+		return nil, nil
+	}
+	if tableName == nil {
+		return nil, nil
+	}
+
+	rc := &RowChange{DB: db, Table: tableName.Name.L, Operation: operation}
+	if tableName.Schema.L != "" {
+		rc.DB = tableName.Schema.L
+	}
+	rule, ok := r.GetShardRule(rc.DB, rc.Table)
+	if !ok || rule.GetType() == router.GlobalTableRuleType {
+		return rc, nil
+	}
+	rc.ShardingColumn = rule.GetShardingColumn()
+
+	if s, ok := stmt.(*ast.InsertStmt); ok {
+		rc.ShardingValues = getInsertShardingValues(s, rc.ShardingColumn)
+		return rc, nil
+	}
+
+	info, err := ExtractConditions(stmt, db, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range info.Conditions {
+		// 只取AND连接的等值条件, 多个条件时取第一个
+		if c.InDisjunction || (c.Op != "=" && c.Op != "in") {
+			continue
+		}
+		rc.ShardingValues = c.Values
+		break
+	}
+	return rc, nil
+}
+
+func getSingleTableName(refs *ast.TableRefsClause) *ast.TableName {
+	if refs == nil || refs.TableRefs == nil || refs.TableRefs.Right != nil {
+		return nil
+	}
+	ts, ok := refs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return nil
+	}
+	tn, _ := ts.Source.(*ast.TableName)
+	return tn
+}
+
+// 只返回常量值, 表达式和nextval()等无法在执行计划生成前确定的值忽略
+func getInsertShardingValues(stmt *ast.InsertStmt, column string) []interface{} {
+	var values []interface{}
+	appendValue := func(expr ast.ExprNode) {
+		x, ok := expr.(*driver.ValueExpr)
+		if !ok {
+			return
+		}
+		if v, err := util.GetValueExprResult(x); err == nil && v != nil {
+			values = append(values, v)
+		}
+	}
+
+	if len(stmt.Setlist) != 0 {
+		for _, assignment := range stmt.Setlist {
+			if assignment.Column.Name.L == column {
+				appendValue(assignment.Expr)
+			}
+		}
+		return values
+	}
+	for i, col := range stmt.Columns {
+		if col.Name.L != column {
+			continue
+		}
+		for _, valueList := range stmt.Lists {
+			if i < len(valueList) {
+				appendValue(valueList[i])
+			}
+		}
+		break
+	}
+	return values
+}
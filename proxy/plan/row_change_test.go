@@ -0,0 +1,59 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestGetRowChange(t *testing.T) {
+	info, err := preparePlanInfo()
+	if err != nil {
+		t.Fatalf("prepare namespace error: %v", err)
+	}
+
+	tests := []struct {
+		sql    string
+		expect *RowChange
+	}{
+		{"insert into tbl_ks (id, name) values (1, 'a'), (5, 'b')", &RowChange{DB: "db_ks", Table: "tbl_ks", Operation: RowChangeInsert, ShardingColumn: "id", ShardingValues: []interface{}{int64(1), int64(5)}}},
+		{"replace into db_ks.tbl_ks set id = 3, name = 'a'", &RowChange{DB: "db_ks", Table: "tbl_ks", Operation: RowChangeReplace, ShardingColumn: "id", ShardingValues: []interface{}{int64(3)}}},
+		{"update tbl_ks set name = 'a' where id in (1, 2) and name = 'b'", &RowChange{DB: "db_ks", Table: "tbl_ks", Operation: RowChangeUpdate, ShardingColumn: "id", ShardingValues: []interface{}{int64(1), int64(2)}}},
+		{"delete from tbl_ks where id = 1 or id = 2", &RowChange{DB: "db_ks", Table: "tbl_ks", Operation: RowChangeDelete, ShardingColumn: "id"}},
+		{"delete from tbl_ks where id > 1", &RowChange{DB: "db_ks", Table: "tbl_ks", Operation: RowChangeDelete, ShardingColumn: "id"}},
+		{"update tbl_ks_global_one set name = 'a' where id = 1", &RowChange{DB: "db_ks", Table: "tbl_ks_global_one", Operation: RowChangeUpdate}},
+		{"delete from tbl_unshard where id = 1", &RowChange{DB: "db_ks", Table: "tbl_unshard", Operation: RowChangeDelete}},
+		{"select * from tbl_ks where id = 1", nil},
+		{"delete a, b from tbl_ks a join tbl_ks_child b on a.id = b.id where a.id = 1", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			stmt, err := parser.ParseSQL(test.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rc, err := GetRowChange(stmt, "db_ks", info.rt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rc, test.expect) {
+				t.Errorf("row change not equal, expect: %+v, actual: %+v", test.expect, rc)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record means one captured client statement, stored as a json line
+type Record struct {
+	Time       time.Time `json:"time"`    // 语句开始执行的时间
+	ConnID     uint32    `json:"conn_id"` // 客户端连接ID, 回放时同一连接的语句串行执行
+	Namespace  string    `json:"namespace"`
+	User       string    `json:"user"`
+	DB         string    `json:"db"`
+	ClientAddr string    `json:"client_addr"`
+	SQL        string    `json:"sql"`
+	Cost       int64     `json:"cost"` // 执行耗时, 单位: 微秒
+	Succ       bool      `json:"succ"`
+}
+
+// Recorder write captured records to file
+type Recorder struct {
+	sync.Mutex
+	namespace string // 只记录该namespace的语句, 为空时记录全部
+	file      *os.File
+	w         *bufio.Writer
+	enc       *json.Encoder
+	closed    bool
+}
+
+// NewRecorder create recorder which append records to file in path
+func NewRecorder(path string, namespace string) (*Recorder, error) {
+	if path == "" {
+		return nil, errors.New("capture file path is empty")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &Recorder{
+		namespace: namespace,
+		file:      f,
+		w:         w,
+		enc:       json.NewEncoder(w),
+	}, nil
+}
+
+// ShouldRecord check if statements of namespace should be captured
+func (r *Recorder) ShouldRecord(namespace string) bool {
+	return r.namespace == "" || r.namespace == namespace
+}
+
+// Record write one record
+func (r *Recorder) Record(rec *Record) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return errors.New("recorder is closed")
+	}
+	return r.enc.Encode(rec)
+}
+
+// Close flush and close the capture file
+func (r *Recorder) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// ReadRecords read all records from reader
+func ReadRecords(reader io.Reader) ([]*Record, error) {
+	var records []*Record
+	dec := json.NewDecoder(reader)
+	for {
+		rec := new(Record)
+		err := dec.Decode(rec)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	sync.Mutex
+	executed *[]string
+}
+
+func (c *fakeConn) UseDB(db string) error {
+	return nil
+}
+
+func (c *fakeConn) Execute(sql string) error {
+	c.Lock()
+	defer c.Unlock()
+	*c.executed = append(*c.executed, sql)
+	if sql == "bad" {
+		return errors.New("bad sql")
+	}
+	return nil
+}
+
+func (c *fakeConn) Close() {}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.log")
+	r, err := NewRecorder(path, "ns1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.ShouldRecord("ns1") || r.ShouldRecord("ns2") {
+		t.Fatal("namespace filter not correct")
+	}
+
+	now := time.Now()
+	sqls := []string{"select 1", "bad", "select 2"}
+	for i, sql := range sqls {
+		rec := &Record{Time: now.Add(time.Duration(i) * time.Millisecond), ConnID: 1, Namespace: "ns1", DB: "db1", SQL: sql}
+		if err := r.Record(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := ReadRecords(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(sqls) {
+		t.Fatalf("record count not equal, expect: %d, actual: %d", len(sqls), len(records))
+	}
+
+	var executed []string
+	dialer := func(rec *Record) (Conn, error) {
+		return &fakeConn{executed: &executed}, nil
+	}
+	stats, err := NewReplayer(dialer, 0).Replay(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 3 || stats.Failed != 1 {
+		t.Errorf("stats not correct, total: %d, failed: %d", stats.Total, stats.Failed)
+	}
+	for i, sql := range sqls {
+		if executed[i] != sql {
+			t.Errorf("replay order not correct, expect: %s, actual: %s", sql, executed[i])
+		}
+	}
+}
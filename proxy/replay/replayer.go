@@ -0,0 +1,130 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replay
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+)
+
+// Conn means connection used by replayer to execute statements
+type Conn interface {
+	UseDB(db string) error
+	Execute(sql string) error
+	Close()
+}
+
+// Dialer create a connection for captured client connection
+type Dialer func(rec *Record) (Conn, error)
+
+// Stats means result of replay
+type Stats struct {
+	Total    int64
+	Failed   int64
+	Duration time.Duration
+}
+
+// Replayer re-execute captured records, statements of one client connection are executed in order,
+// different connections are executed concurrently.
+type Replayer struct {
+	dialer Dialer
+	speed  float64 // 回放速度倍数, 1为原始速度, 小于等于0时不等待直接执行
+}
+
+// NewReplayer create replayer
+func NewReplayer(dialer Dialer, speed float64) *Replayer {
+	return &Replayer{dialer: dialer, speed: speed}
+}
+
+// Replay replay records and return stats
+func (r *Replayer) Replay(records []*Record) (*Stats, error) {
+	if len(records) == 0 {
+		return nil, errors.New("no record to replay")
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	origin := records[0].Time
+
+	conns := make(map[uint32][]*Record)
+	var order []uint32
+	for _, rec := range records {
+		if _, ok := conns[rec.ConnID]; !ok {
+			order = append(order, rec.ConnID)
+		}
+		conns[rec.ConnID] = append(conns[rec.ConnID], rec)
+	}
+
+	stats := &Stats{}
+	start := time.Now()
+	var wg sync.WaitGroup
+	wg.Add(len(order))
+	for _, id := range order {
+		go func(recs []*Record) {
+			defer wg.Done()
+			r.replayConn(recs, origin, start, stats)
+		}(conns[id])
+	}
+	wg.Wait()
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+func (r *Replayer) replayConn(recs []*Record, origin, start time.Time, stats *Stats) {
+	conn, err := r.dialer(recs[0])
+	if err != nil {
+		logging.DefaultLogger.Warnf("replay dial failed, conn id: %d, err: %v", recs[0].ConnID, err)
+		atomic.AddInt64(&stats.Total, int64(len(recs)))
+		atomic.AddInt64(&stats.Failed, int64(len(recs)))
+		return
+	}
+	defer conn.Close()
+
+	db := recs[0].DB
+	for _, rec := range recs {
+		r.wait(rec.Time.Sub(origin), start)
+		atomic.AddInt64(&stats.Total, 1)
+
+		if rec.DB != "" && rec.DB != db {
+			if err := conn.UseDB(rec.DB); err != nil {
+				logging.DefaultLogger.Warnf("replay use db failed, conn id: %d, db: %s, err: %v", rec.ConnID, rec.DB, err)
+				atomic.AddInt64(&stats.Failed, 1)
+				continue
+			}
+			db = rec.DB
+		}
+		if err := conn.Execute(rec.SQL); err != nil {
+			logging.DefaultLogger.Debugf("replay execute failed, conn id: %d, sql: %s, err: %v", rec.ConnID, rec.SQL, err)
+			atomic.AddInt64(&stats.Failed, 1)
+		}
+	}
+}
+
+// wait until the scaled offset of record since replay started
+func (r *Replayer) wait(offset time.Duration, start time.Time) {
+	if r.speed <= 0 {
+		return
+	}
+	d := time.Duration(float64(offset)/r.speed) - time.Since(start)
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"github.com/pingcap/parser/format"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// parseRestoreFlags convert restore flags config of namespace to format.RestoreFlags
+func parseRestoreFlags(cfg *models.RestoreFlags) format.RestoreFlags {
+	if cfg == nil {
+		return util.EscapeRestoreFlags
+	}
+
+	flags := format.RestoreKeyWordUppercase
+	if cfg.KeywordCase == models.RestoreKeywordLower {
+		flags = format.RestoreKeyWordLowercase
+	}
+
+	if cfg.StringQuote == models.RestoreStringDoubleQuote {
+		flags |= format.RestoreStringDoubleQuotes
+	} else {
+		flags |= format.RestoreStringSingleQuotes
+	}
+	if !cfg.NoEscapeBackslash {
+		flags |= format.RestoreStringEscapeBackslash
+	}
+
+	if cfg.NameQuote == models.RestoreNameDoubleQuote {
+		flags |= format.RestoreNameDoubleQuotes
+	} else {
+		flags |= format.RestoreNameBackQuotes
+	}
+
+	if cfg.SpacesAroundBinaryOperation {
+		flags |= format.RestoreSpacesAroundBinaryOperation
+	}
+	if cfg.PreserveLiterals {
+		flags |= parser.RestorePreserveLiterals
+	}
+	return flags
+}
+
+// GetRestoreFlags return restore flags used to generate SQL sent to backends
+func (r *Router) GetRestoreFlags() format.RestoreFlags {
+	return r.restoreFlags
+}
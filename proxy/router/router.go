@@ -15,14 +15,27 @@ package router
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/pingcap/parser/format"
 
 	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util/cache"
 )
 
 type Router struct {
-	rules       map[string]map[string]Rule // dbname-tablename
-	defaultRule Rule
+	rules        map[string]map[string]Rule // dbname-tablename
+	defaultRule  Rule
+	phyDBs       map[string]string   // key: 逻辑库名, value: 默认物理库名, 用于改写分片SQL中的库名
+	restoreFlags format.RestoreFlags // 改写SQL的生成格式
+
+	patternRules     []*patternRule  // 表名带通配符的规则, 依次为shard_rules中的规则和默认分片模板
+	patternRuleCache *cache.LRUCache // key: db.table, value: 通配符规则为表生成的规则, 表名来自客户端, 限制容量
+
+	disabledReadSlices  sync.Map // key: slice name, 运行时禁止读的分片
+	disabledWriteSlices sync.Map // key: slice name, 运行时禁止写的分片
 }
 
 //NewRouter build router according to the models of namespace
@@ -42,7 +55,13 @@ func NewRouter(namespace *models.Namespace) (*Router, error) {
 	// create router of special namespace
 	rt := new(Router)
 	rt.rules = make(map[string]map[string]Rule)
+	rt.patternRuleCache = cache.NewLRUCache(patternRuleCacheCapacity)
 	rt.defaultRule = NewDefaultRule(namespace.DefaultSlice)
+	rt.phyDBs = make(map[string]string, len(namespace.DefaultPhyDBS))
+	for db, phyDB := range namespace.DefaultPhyDBS {
+		rt.phyDBs[db] = phyDB
+	}
+	rt.restoreFlags = parseRestoreFlags(namespace.RestoreFlags)
 
 	linkedRuleIndexes := make([]int, 0)
 
@@ -53,6 +72,20 @@ func NewRouter(namespace *models.Namespace) (*Router, error) {
 					shard.Table, slice, strings.Join(shard.Slices, ","))
 			}
 		}
+		for _, slice := range shard.ArchiveSlices {
+			if !includeSlice(sliceNames, slice) {
+				return nil, fmt.Errorf("shard table[%s] archive slice[%s] not in the namespace.slices list", shard.Table, slice)
+			}
+		}
+
+		if models.IsTablePattern(shard.Table) {
+			p, err := newPatternRule(shard.DB, shard.Table, shard, sliceNames)
+			if err != nil {
+				return nil, err
+			}
+			rt.patternRules = append(rt.patternRules, p)
+			continue
+		}
 
 		// get index of linked table source and handle it later
 		if shard.Type == LinkedTableRuleType {
@@ -60,31 +93,48 @@ func NewRouter(namespace *models.Namespace) (*Router, error) {
 			continue
 		}
 
-		rule, err := parseRule(shard)
-		if err != nil {
-			return nil, err
-		}
+		var rule Rule
+		if shard.PreviousVersion != nil {
+			versionedRule, err := parseVersionedRule(shard)
+			if err != nil {
+				return nil, err
+			}
+			rule = versionedRule
+		} else if len(shard.ArchiveSlices) != 0 {
+			archivedRule, err := parseArchivedRule(shard)
+			if err != nil {
+				return nil, err
+			}
+			rule = archivedRule
+		} else {
+			baseRule, err := parseRule(shard)
+			if err != nil {
+				return nil, err
+			}
 
-		// if global table rule, use the namespace slice names
-		// TODO: refactor
-		if rule.ruleType == GlobalTableRuleType {
-			rule.slices = sliceNames
-		}
+			// if global table rule, use the namespace slice names
+			// TODO: refactor
+			if baseRule.ruleType == GlobalTableRuleType {
+				baseRule.slices = sliceNames
+			}
 
-		if rule.ruleType == DefaultRuleType {
-			return nil, fmt.Errorf("[default-rule] duplicate, must only one")
+			if baseRule.ruleType == DefaultRuleType {
+				return nil, fmt.Errorf("[default-rule] duplicate, must only one")
+			}
+			rule = baseRule
 		}
+		db, table := rule.GetDB(), rule.GetTable()
 		//if the database exist in rules
-		if _, ok := rt.rules[rule.db]; ok {
-			if _, ok := rt.rules[rule.db][rule.table]; ok {
-				return nil, fmt.Errorf("table %s rule in %s duplicate", rule.table, rule.db)
+		if _, ok := rt.rules[db]; ok {
+			if _, ok := rt.rules[db][table]; ok {
+				return nil, fmt.Errorf("table %s rule in %s duplicate", table, db)
 			} else {
-				rt.rules[rule.db][rule.table] = rule
+				rt.rules[db][table] = rule
 			}
 		} else {
 			m := make(map[string]Rule)
-			rt.rules[rule.db] = m
-			rt.rules[rule.db][rule.table] = rule
+			rt.rules[db] = m
+			rt.rules[db][table] = rule
 		}
 	}
 
@@ -97,6 +147,21 @@ func NewRouter(namespace *models.Namespace) (*Router, error) {
 		rt.rules[rule.db][rule.table] = rule
 	}
 
+	if t := namespace.DefaultShardRule; t != nil {
+		for _, slice := range t.Rule.Slices {
+			if !includeSlice(sliceNames, slice) {
+				return nil, fmt.Errorf("default shard rule slice[%s] not in the namespace.slices list", slice)
+			}
+		}
+		for _, pattern := range t.Tables {
+			p, err := newPatternRule("", pattern, t.Rule, sliceNames)
+			if err != nil {
+				return nil, fmt.Errorf("default shard rule error: %v", err)
+			}
+			rt.patternRules = append(rt.patternRules, p)
+		}
+	}
+
 	return rt, nil
 }
 
@@ -106,8 +171,31 @@ func (r *Router) GetShardRule(db, table string) (Rule, bool) {
 		table = strings.Trim(arry[1], "`")
 		db = strings.Trim(arry[0], "`")
 	}
-	rule, ok := r.rules[db][table]
-	return rule, ok
+	if rule, ok := r.rules[db][table]; ok {
+		return rule, true
+	}
+	return r.getPatternRule(db, table)
+}
+
+// GetRules return all shard rules, sorted by db and table.
+// rules of table patterns are included with the pattern as table name, db of default shard rule is empty
+func (r *Router) GetRules() []Rule {
+	var rules []Rule
+	for _, tables := range r.rules {
+		for _, rule := range tables {
+			rules = append(rules, rule)
+		}
+	}
+	for _, p := range r.patternRules {
+		rules = append(rules, p.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].GetDB() != rules[j].GetDB() {
+			return rules[i].GetDB() < rules[j].GetDB()
+		}
+		return rules[i].GetTable() < rules[j].GetTable()
+	})
+	return rules
 }
 
 func (r *Router) GetRule(db, table string) Rule {
@@ -116,8 +204,11 @@ func (r *Router) GetRule(db, table string) Rule {
 		table = strings.Trim(arry[1], "`")
 		db = strings.Trim(arry[0], "`")
 	}
-	rule := r.rules[db][table]
-	if rule == nil {
+	rule, ok := r.rules[db][table]
+	if !ok {
+		rule, ok = r.getPatternRule(db, table)
+	}
+	if !ok {
 		//set the database of default rule
 		r.defaultRule.(*BaseRule).db = db
 		return r.defaultRule
@@ -125,3 +216,41 @@ func (r *Router) GetRule(db, table string) Rule {
 		return rule
 	}
 }
+
+// SetSliceReadEnabled enable or disable reads of slice at runtime
+func (r *Router) SetSliceReadEnabled(slice string, enabled bool) {
+	if enabled {
+		r.disabledReadSlices.Delete(slice)
+	} else {
+		r.disabledReadSlices.Store(slice, true)
+	}
+}
+
+// SetSliceWriteEnabled enable or disable writes of slice at runtime
+func (r *Router) SetSliceWriteEnabled(slice string, enabled bool) {
+	if enabled {
+		r.disabledWriteSlices.Delete(slice)
+	} else {
+		r.disabledWriteSlices.Store(slice, true)
+	}
+}
+
+// GetPhyDB return default physical database of db, or db itself if not configured
+func (r *Router) GetPhyDB(db string) string {
+	if phyDB, ok := r.phyDBs[db]; ok && phyDB != "" {
+		return phyDB
+	}
+	return db
+}
+
+// IsSliceReadEnabled check if slice could be read
+func (r *Router) IsSliceReadEnabled(slice string) bool {
+	_, disabled := r.disabledReadSlices.Load(slice)
+	return !disabled
+}
+
+// IsSliceWriteEnabled check if slice could be written
+func (r *Router) IsSliceWriteEnabled(slice string) bool {
+	_, disabled := r.disabledWriteSlices.Load(slice)
+	return !disabled
+}
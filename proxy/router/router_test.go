@@ -0,0 +1,45 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+)
+
+func TestSliceSwitch(t *testing.T) {
+	rt := new(Router)
+	if !rt.IsSliceReadEnabled("slice-0") || !rt.IsSliceWriteEnabled("slice-0") {
+		t.Fatal("slice should be enabled by default")
+	}
+
+	rt.SetSliceReadEnabled("slice-0", false)
+	if rt.IsSliceReadEnabled("slice-0") {
+		t.Fatal("read of slice-0 should be disabled")
+	}
+	if !rt.IsSliceWriteEnabled("slice-0") || !rt.IsSliceReadEnabled("slice-1") {
+		t.Fatal("disable read of slice-0 should not affect others")
+	}
+
+	rt.SetSliceWriteEnabled("slice-1", false)
+	if rt.IsSliceWriteEnabled("slice-1") {
+		t.Fatal("write of slice-1 should be disabled")
+	}
+
+	rt.SetSliceReadEnabled("slice-0", true)
+	rt.SetSliceWriteEnabled("slice-1", true)
+	if !rt.IsSliceReadEnabled("slice-0") || !rt.IsSliceWriteEnabled("slice-1") {
+		t.Fatal("slice should be enabled again")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+// ArchivedRule route sub tables older than cutoff of date rule to archive slices.
+// slices of BaseRule are hot slices followed by archive slices.
+type ArchivedRule struct {
+	*BaseRule
+
+	hotSliceCount     int
+	archiveSliceCount int
+	redirectWrite     bool
+	cutoff            sync2.AtomicInt64 // 小于该值的分表已归档, 0表示不归档
+}
+
+func parseArchivedRule(cfg *models.Shard) (*ArchivedRule, error) {
+	base, err := parseRule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if base.ruleType != DateYearRuleType && base.ruleType != DateMonthRuleType && base.ruleType != DateDayRuleType {
+		return nil, fmt.Errorf("table %s: only date rule can be archived", cfg.Table)
+	}
+	if len(cfg.ArchiveSlices) != 1 && len(cfg.ArchiveSlices) != len(base.slices) {
+		return nil, fmt.Errorf("table %s: count of archive_slices must be 1 or the same as slices", cfg.Table)
+	}
+
+	r := &ArchivedRule{
+		BaseRule:          base,
+		hotSliceCount:     len(base.slices),
+		archiveSliceCount: len(cfg.ArchiveSlices),
+		redirectWrite:     cfg.ArchiveWrite == models.ArchiveWriteRedirect,
+	}
+	base.slices = append(append([]string{}, base.slices...), cfg.ArchiveSlices...)
+	if err := r.SetCutoff(cfg.ArchiveCutoff); err != nil {
+		return nil, fmt.Errorf("table %s: %v", cfg.Table, err)
+	}
+	return r, nil
+}
+
+// SetCutoff change archive cutoff at runtime, empty cutoff means no sub table is archived
+func (r *ArchivedRule) SetCutoff(cutoff string) error {
+	if cutoff == "" {
+		r.cutoff.Set(0)
+		return nil
+	}
+	v, err := models.ParseArchiveCutoff(r.ruleType, cutoff)
+	if err != nil {
+		return fmt.Errorf("invalid archive cutoff %s: %v", cutoff, err)
+	}
+	r.cutoff.Set(int64(v))
+	return nil
+}
+
+// GetCutoff return current archive cutoff as table index, 0 means no sub table is archived
+func (r *ArchivedRule) GetCutoff() int {
+	return int(r.cutoff.Get())
+}
+
+// IsArchived return if the sub table is located in archive slice
+func (r *ArchivedRule) IsArchived(index int) bool {
+	return index < int(r.cutoff.Get())
+}
+
+// GetSliceIndexFromTableIndex return index of archive slice if the sub table is archived
+func (r *ArchivedRule) GetSliceIndexFromTableIndex(i int) int {
+	sliceIndex := r.BaseRule.GetSliceIndexFromTableIndex(i)
+	if sliceIndex < 0 || !r.IsArchived(i) {
+		return sliceIndex
+	}
+	if r.archiveSliceCount == 1 {
+		return r.hotSliceCount
+	}
+	return r.hotSliceCount + sliceIndex
+}
+
+// CheckWriteTableIndexes return error if writes to archived sub tables are rejected
+func CheckWriteTableIndexes(rule Rule, indexes []int) error {
+	r, ok := rule.(*ArchivedRule)
+	if !ok || r.redirectWrite {
+		return nil
+	}
+	for _, idx := range indexes {
+		if r.IsArchived(idx) {
+			return fmt.Errorf("sub table %s_%04d is archived and can not be written", r.table, idx)
+		}
+	}
+	return nil
+}
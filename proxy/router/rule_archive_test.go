@@ -0,0 +1,85 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func TestArchivedRule(t *testing.T) {
+	ns := &models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}, {Name: "slice-cold-0"}, {Name: "slice-cold-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_year", Type: "date_year", Key: "create_time", Slices: []string{"slice-0", "slice-1"}, DateRange: []string{"2014-2017", "2018-2019"},
+				ArchiveSlices: []string{"slice-cold-0", "slice-cold-1"}, ArchiveCutoff: "2016"},
+			{DB: "db_ks", Table: "tbl_month", Type: "date_month", Key: "create_time", Slices: []string{"slice-0", "slice-1"}, DateRange: []string{"201901-201906", "201907-201912"},
+				ArchiveSlices: []string{"slice-cold-0"}, ArchiveCutoff: "201908", ArchiveWrite: models.ArchiveWriteRedirect},
+		},
+	}
+	rt, err := NewRouter(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yearRule := rt.GetRule("db_ks", "tbl_year").(*ArchivedRule)
+	tests := []struct {
+		index int
+		slice string
+	}{
+		{2014, "slice-cold-0"},
+		{2015, "slice-cold-0"},
+		{2016, "slice-0"},
+		{2019, "slice-1"},
+	}
+	for _, test := range tests {
+		if slice := yearRule.GetSlice(yearRule.GetSliceIndexFromTableIndex(test.index)); slice != test.slice {
+			t.Errorf("slice of table %d not match, expect: %s, actual: %s", test.index, test.slice, slice)
+		}
+	}
+	if err := CheckWriteTableIndexes(yearRule, []int{2016, 2019}); err != nil {
+		t.Errorf("write to hot tables should be allowed: %v", err)
+	}
+	if err := CheckWriteTableIndexes(yearRule, []int{2015, 2016}); err == nil {
+		t.Error("write to archived tables should be rejected")
+	}
+
+	// 运行时移动归档点
+	if err := yearRule.SetCutoff("2019"); err != nil {
+		t.Fatal(err)
+	}
+	if slice := yearRule.GetSlice(yearRule.GetSliceIndexFromTableIndex(2018)); slice != "slice-cold-1" {
+		t.Errorf("slice of archived table 2018 not match: %s", slice)
+	}
+	if err := yearRule.SetCutoff("201901"); err == nil {
+		t.Error("cutoff with wrong granularity should fail")
+	}
+	if err := yearRule.SetCutoff(""); err != nil || yearRule.IsArchived(2014) {
+		t.Errorf("clear cutoff failed: %v", err)
+	}
+
+	monthRule := rt.GetRule("db_ks", "tbl_month").(*ArchivedRule)
+	if slice := monthRule.GetSlice(monthRule.GetSliceIndexFromTableIndex(201907)); slice != "slice-cold-0" {
+		t.Errorf("slice of archived table 201907 not match: %s", slice)
+	}
+	if slice := monthRule.GetSlice(monthRule.GetSliceIndexFromTableIndex(201908)); slice != "slice-1" {
+		t.Errorf("slice of table 201908 not match: %s", slice)
+	}
+	if err := CheckWriteTableIndexes(monthRule, []int{201901}); err != nil {
+		t.Errorf("write to archived table should be redirected: %v", err)
+	}
+}
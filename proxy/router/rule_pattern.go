@@ -0,0 +1,116 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// patternRuleCacheCapacity 缓存的通配符规则生成的表规则数, 超过时淘汰最久未访问的表
+const patternRuleCacheCapacity = 10000
+
+// patternRule 表名带通配符的分片规则, 匹配的表按相同的分片方式分片, 访问时为每个表生成规则
+type patternRule struct {
+	db         string // 为空时匹配所有逻辑库, 用于默认分片模板
+	pattern    string // 小写的表名模式
+	shard      *models.Shard
+	sliceNames []string // namespace的所有slice, 用于全局表
+	rule       Rule     // 以表名模式为表名生成的规则, 用于GetRules
+}
+
+// cachedPatternRule 缓存通配符规则为表生成的规则
+type cachedPatternRule struct {
+	rule Rule
+}
+
+// Size implement cache.Value
+func (c *cachedPatternRule) Size() int {
+	return 1
+}
+
+func newPatternRule(db, pattern string, shard *models.Shard, sliceNames []string) (*patternRule, error) {
+	if shard.Type == LinkedTableRuleType || shard.Type == DefaultRuleType || shard.PreviousVersion != nil || len(shard.ArchiveSlices) != 0 {
+		return nil, fmt.Errorf("table pattern %s: only base rule could be used with table pattern", pattern)
+	}
+	p := &patternRule{
+		db:         db,
+		pattern:    strings.ToLower(pattern),
+		shard:      shard,
+		sliceNames: sliceNames,
+	}
+	if _, err := path.Match(p.pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid table pattern %s: %v", pattern, err)
+	}
+	// 提前检查分片配置, 访问时生成规则不会出错
+	rule, err := p.createRule(db, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("table pattern %s: %v", pattern, err)
+	}
+	p.rule = rule
+	return p, nil
+}
+
+func (p *patternRule) match(db, table string) bool {
+	if p.db != "" && p.db != db {
+		return false
+	}
+	matched, _ := path.Match(p.pattern, strings.ToLower(table))
+	return matched
+}
+
+func (p *patternRule) createRule(db, table string) (Rule, error) {
+	cfg := *p.shard
+	cfg.DB = db
+	cfg.Table = table
+	rule, err := parseRule(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	if rule.ruleType == GlobalTableRuleType {
+		rule.slices = p.sliceNames
+	}
+	return rule, nil
+}
+
+// getPatternRule 返回表名匹配的通配符规则生成的规则, 按配置顺序匹配, shard_rules中的规则优先于默认分片模板
+func (r *Router) getPatternRule(db, table string) (Rule, bool) {
+	if len(r.patternRules) == 0 {
+		return nil, false
+	}
+	key := db + "." + table
+	if v, ok := r.patternRuleCache.Get(key); ok {
+		return v.(*cachedPatternRule).rule, true
+	}
+	for _, p := range r.patternRules {
+		if !p.match(db, table) {
+			continue
+		}
+		rule, err := p.createRule(db, table)
+		if err != nil {
+			return nil, false
+		}
+		// 并发生成同一个表的规则时使用先缓存的规则
+		r.patternRuleCache.SetIfAbsent(key, &cachedPatternRule{rule: rule})
+		if v, ok := r.patternRuleCache.Peek(key); ok {
+			return v.(*cachedPatternRule).rule, true
+		}
+		return rule, true
+	}
+	return nil, false
+}
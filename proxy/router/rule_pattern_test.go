@@ -0,0 +1,135 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func newPatternTestNamespace() *models.Namespace {
+	return &models.Namespace{
+		Name:         "ns",
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "t_log_special", Type: "mod", Key: "id", Locations: []int{1, 1}, Slices: []string{"slice-0", "slice-1"}},
+			{DB: "db_ks", Table: "t_log_*", Type: "mod", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		},
+		DefaultShardRule: &models.DefaultShardRule{
+			Tables: []string{"t_event_*", "t_log_?"},
+			Rule:   &models.Shard{Type: "hash", Key: "user_id", Locations: []int{4}, Slices: []string{"slice-1"}},
+		},
+	}
+}
+
+func TestPatternRule(t *testing.T) {
+	rt, err := NewRouter(newPatternTestNamespace())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		db, table string
+		ok        bool
+		column    string
+		tables    int
+	}{
+		{"db_ks", "t_log_special", true, "id", 2}, // 单独配置的规则优先
+		{"db_ks", "t_log_2024", true, "id", 4},    // shard_rules中的通配符规则
+		{"db_ks", "t_log_a", true, "id", 4},       // shard_rules中的规则优先于默认分片模板
+		{"db_ks", "t_event_click", true, "user_id", 4},
+		{"db_other", "t_event_click", true, "user_id", 4}, // 默认分片模板匹配所有逻辑库
+		{"db_other", "t_log_2024", false, "", 0},
+		{"db_ks", "t_user", false, "", 0},
+	}
+	for _, test := range tests {
+		rule, ok := rt.GetShardRule(test.db, test.table)
+		if ok != test.ok {
+			t.Fatalf("shard rule of %s.%s, expect: %v, actual: %v", test.db, test.table, test.ok, ok)
+		}
+		if !ok {
+			if r := rt.GetRule(test.db, test.table); r.GetType() != DefaultRuleType {
+				t.Errorf("expect default rule of %s.%s, actual: %s", test.db, test.table, r.GetType())
+			}
+			continue
+		}
+		if rule.GetDB() != test.db || rule.GetTable() != test.table || rule.GetShardingColumn() != test.column || len(rule.GetSubTableIndexes()) != test.tables {
+			t.Errorf("unexpected rule of %s.%s: db: %s, table: %s, column: %s, tables: %v",
+				test.db, test.table, rule.GetDB(), rule.GetTable(), rule.GetShardingColumn(), rule.GetSubTableIndexes())
+		}
+		if r := rt.GetRule(test.db, test.table); r != rule {
+			t.Errorf("GetRule of %s.%s should return the same rule", test.db, test.table)
+		}
+	}
+
+	// 通配符规则以表名模式返回, 默认分片模板的库名为空
+	expect := []string{".t_event_*", ".t_log_?", "db_ks.t_log_*", "db_ks.t_log_special"}
+	rules := rt.GetRules()
+	if len(rules) != len(expect) {
+		t.Fatalf("rules count, expect: %d, actual: %d", len(expect), len(rules))
+	}
+	for i, rule := range rules {
+		if actual := rule.GetDB() + "." + rule.GetTable(); actual != expect[i] {
+			t.Errorf("rule %d, expect: %s, actual: %s", i, expect[i], actual)
+		}
+	}
+}
+
+func TestPatternRuleCacheCapacity(t *testing.T) {
+	rt, err := NewRouter(newPatternTestNamespace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.patternRuleCache.SetCapacity(2)
+	for _, table := range []string{"t_event_1", "t_event_2", "t_event_3"} {
+		if _, ok := rt.GetShardRule("db_ks", table); !ok {
+			t.Fatalf("shard rule of %s not found", table)
+		}
+	}
+	// 只缓存最近访问的表, 被淘汰的表再次访问时重新生成
+	if l := rt.patternRuleCache.Length(); l != 2 {
+		t.Errorf("cached rules, expect: 2, actual: %d", l)
+	}
+	if rule, ok := rt.GetShardRule("db_ks", "t_event_1"); !ok || rule.GetTable() != "t_event_1" {
+		t.Errorf("evicted rule should be created again")
+	}
+	// 不匹配的表不缓存
+	rt.GetShardRule("db_ks", "t_user")
+	if _, ok := rt.patternRuleCache.Peek("db_ks.t_user"); ok {
+		t.Errorf("unmatched table should not be cached")
+	}
+}
+
+func TestPatternRuleError(t *testing.T) {
+	ns := newPatternTestNamespace()
+	ns.ShardRules = append(ns.ShardRules, &models.Shard{DB: "db_ks", Table: "t_order_*", ParentTable: "t_log_special", Type: "linked", Key: "id"})
+	if _, err := NewRouter(ns); err == nil {
+		t.Errorf("table pattern should not be used with linked rule")
+	}
+
+	ns = newPatternTestNamespace()
+	ns.DefaultShardRule.Tables = []string{"t_[a"}
+	if _, err := NewRouter(ns); err == nil {
+		t.Errorf("invalid table pattern should be rejected")
+	}
+
+	ns = newPatternTestNamespace()
+	ns.DefaultShardRule.Rule.Slices = []string{"slice-2"}
+	if _, err := NewRouter(ns); err == nil {
+		t.Errorf("slice of default shard rule should be in namespace")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// VersionedRule route by current and previous version of shard rule.
+// BaseRule contains merged sub tables of two versions, writes are routed by current version after cutover,
+// reads are routed to both versions during transition, since old data remains in tables of previous version.
+type VersionedRule struct {
+	*BaseRule
+
+	current  *BaseRule
+	previous *BaseRule
+
+	effectiveFrom time.Time
+	transitionEnd time.Time // zero表示一直同时查询两个版本
+	cutoverKey    *int64
+
+	now func() time.Time
+}
+
+// versionedShard is not a RangeShard, so range conditions are routed to all sub tables of two versions
+type versionedShard struct {
+	rule *VersionedRule
+}
+
+func (s *versionedShard) FindForKey(key interface{}) (int, error) {
+	return s.rule.FindTableIndex(key)
+}
+
+func parseVersionedRule(cfg *models.Shard) (*VersionedRule, error) {
+	current, err := parseRule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	prevCfg := *cfg.PreviousVersion
+	prevCfg.DB, prevCfg.Table, prevCfg.Key = cfg.DB, cfg.Table, cfg.Key
+	previous, err := parseRule(&prevCfg)
+	if err != nil {
+		return nil, fmt.Errorf("parse previous version error: %v", err)
+	}
+	if IsMycatShardingRule(current.ruleType) != IsMycatShardingRule(previous.ruleType) {
+		return nil, fmt.Errorf("table %s: mycat and kingshard rule can not be versioned to each other", cfg.Table)
+	}
+
+	merged, err := mergeRuleVersions(current, previous)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %v", cfg.Table, err)
+	}
+	r := &VersionedRule{
+		BaseRule:   merged,
+		current:    current,
+		previous:   previous,
+		cutoverKey: cfg.CutoverKey,
+		now:        time.Now,
+	}
+	if cfg.EffectiveFrom != "" {
+		if r.effectiveFrom, err = time.ParseInLocation(models.RuleVersionTimeFormat, cfg.EffectiveFrom, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.TransitionEnd != "" {
+		if r.transitionEnd, err = time.ParseInLocation(models.RuleVersionTimeFormat, cfg.TransitionEnd, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	merged.shard = &versionedShard{rule: r}
+	return r, nil
+}
+
+// mergeRuleVersions merge sub tables of two versions, a sub table in both versions must be in the same slice and database
+func mergeRuleVersions(current, previous *BaseRule) (*BaseRule, error) {
+	merged := &BaseRule{
+		db:                           current.db,
+		table:                        current.table,
+		shardingColumn:               current.shardingColumn,
+		ruleType:                     current.ruleType,
+		tableToSlice:                 make(map[int]int),
+		mycatDatabaseToTableIndexMap: make(map[string]int),
+	}
+	sliceIndexes := make(map[string]int)
+	databases := make(map[int]string)
+	add := func(r *BaseRule) error {
+		for _, idx := range r.subTableIndexes {
+			slice := r.GetSlice(r.GetSliceIndexFromTableIndex(idx))
+			db, err := r.GetDatabaseNameByTableIndex(idx)
+			if err != nil {
+				return err
+			}
+			if sliceIndex, ok := merged.tableToSlice[idx]; ok {
+				if merged.slices[sliceIndex] != slice || databases[idx] != db {
+					return fmt.Errorf("sub table %d is located in %s.%s and %s.%s in two versions", idx, merged.slices[sliceIndex], databases[idx], slice, db)
+				}
+				continue
+			}
+			sliceIndex, ok := sliceIndexes[slice]
+			if !ok {
+				sliceIndex = len(merged.slices)
+				sliceIndexes[slice] = sliceIndex
+				merged.slices = append(merged.slices, slice)
+			}
+			merged.tableToSlice[idx] = sliceIndex
+			merged.subTableIndexes = append(merged.subTableIndexes, idx)
+			databases[idx] = db
+		}
+		return nil
+	}
+	if err := add(current); err != nil {
+		return nil, err
+	}
+	if err := add(previous); err != nil {
+		return nil, err
+	}
+	sort.Ints(merged.subTableIndexes)
+
+	if IsMycatShardingRule(merged.ruleType) {
+		// mycat规则的分表序号从0开始连续
+		for i, idx := range merged.subTableIndexes {
+			if i != idx {
+				return nil, fmt.Errorf("sub tables of mycat rule are not continuous")
+			}
+			merged.mycatDatabases = append(merged.mycatDatabases, databases[idx])
+			merged.mycatDatabaseToTableIndexMap[databases[idx]] = idx
+		}
+	}
+	return merged, nil
+}
+
+// FindTableIndex return table index that key is written to
+func (r *VersionedRule) FindTableIndex(key interface{}) (int, error) {
+	if r.cutoverKey != nil {
+		v, err := cutoverKeyValue(key)
+		if err != nil {
+			return -1, err
+		}
+		if v >= *r.cutoverKey {
+			return r.current.FindTableIndex(key)
+		}
+		return r.previous.FindTableIndex(key)
+	}
+	if r.now().Before(r.effectiveFrom) {
+		return r.previous.FindTableIndex(key)
+	}
+	return r.current.FindTableIndex(key)
+}
+
+// FindReadTableIndexes return table indexes that rows of key may be located in
+func (r *VersionedRule) FindReadTableIndexes(key interface{}) ([]int, error) {
+	now := r.now()
+	if r.cutoverKey != nil || now.Before(r.effectiveFrom) || (!r.transitionEnd.IsZero() && !now.Before(r.transitionEnd)) {
+		idx, err := r.FindTableIndex(key)
+		if err != nil {
+			return nil, err
+		}
+		return []int{idx}, nil
+	}
+	idx, err := r.current.FindTableIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	prevIdx, err := r.previous.FindTableIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	if idx == prevIdx {
+		return []int{idx}, nil
+	}
+	if idx > prevIdx {
+		idx, prevIdx = prevIdx, idx
+	}
+	return []int{idx, prevIdx}, nil
+}
+
+func cutoverKeyValue(key interface{}) (int64, error) {
+	switch v := key.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case []byte:
+		return strconv.ParseInt(hack.String(v), 10, 64)
+	}
+	return 0, fmt.Errorf("invalid cutover key type %T", key)
+}
+
+// FindReadTableIndexes return table indexes that rows of key may be located in, multiple indexes only for versioned rule in transition
+func FindReadTableIndexes(rule Rule, key interface{}) ([]int, error) {
+	if v, ok := rule.(*VersionedRule); ok {
+		return v.FindReadTableIndexes(key)
+	}
+	idx, err := rule.FindTableIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	return []int{idx}, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func newVersionedTestNamespace(current, previous *models.Shard) *models.Namespace {
+	current.PreviousVersion = previous
+	return &models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}, {Name: "slice-2"}, {Name: "slice-3"}},
+		DefaultSlice: "slice-0",
+		ShardRules:   []*models.Shard{current},
+	}
+}
+
+func TestVersionedRuleEffectiveFrom(t *testing.T) {
+	ns := newVersionedTestNamespace(
+		&models.Shard{DB: "db_ks", Table: "tbl_ver", Type: "mod", Key: "id", Locations: []int{2, 2, 2, 2}, Slices: []string{"slice-0", "slice-1", "slice-2", "slice-3"},
+			EffectiveFrom: "2020-01-01 00:00:00", TransitionEnd: "2020-02-01 00:00:00"},
+		&models.Shard{Type: "mod", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+	)
+	rt, err := NewRouter(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rt.GetRule("db_ks", "tbl_ver").(*VersionedRule)
+	if !reflect.DeepEqual(rule.GetSubTableIndexes(), []int{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Errorf("sub table indexes not match: %v", rule.GetSubTableIndexes())
+	}
+	if _, ok := rule.GetShard().(RangeShard); ok {
+		t.Error("versioned rule should not be range shard")
+	}
+
+	tests := []struct {
+		now   string
+		write int
+		read  []int
+	}{
+		{"2019-12-31 23:59:59", 1, []int{1}},
+		{"2020-01-01 00:00:00", 5, []int{1, 5}},
+		{"2020-02-01 00:00:00", 5, []int{5}},
+	}
+	for _, test := range tests {
+		now, _ := time.ParseInLocation(models.RuleVersionTimeFormat, test.now, time.Local)
+		rule.now = func() time.Time { return now }
+		idx, err := rule.FindTableIndex(int64(5))
+		if err != nil || idx != test.write {
+			t.Errorf("write index not match, now: %s, expect: %d, actual: %d, err: %v", test.now, test.write, idx, err)
+		}
+		indexes, err := FindReadTableIndexes(rule, int64(5))
+		if err != nil || !reflect.DeepEqual(indexes, test.read) {
+			t.Errorf("read indexes not match, now: %s, expect: %v, actual: %v, err: %v", test.now, test.read, indexes, err)
+		}
+	}
+}
+
+func TestVersionedRuleCutoverKey(t *testing.T) {
+	cutover := int64(100)
+	ns := newVersionedTestNamespace(
+		&models.Shard{DB: "db_ks", Table: "tbl_ver", Type: "mod", Key: "id", Locations: []int{2, 2, 2, 2}, Slices: []string{"slice-0", "slice-1", "slice-2", "slice-3"}, CutoverKey: &cutover},
+		&models.Shard{Type: "mod", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+	)
+	rt, err := NewRouter(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := rt.GetRule("db_ks", "tbl_ver")
+	for key, expect := range map[interface{}]int{int64(13): 1, "13": 1, int64(105): 1, uint64(110): 6} {
+		indexes, err := FindReadTableIndexes(rule, key)
+		if err != nil || !reflect.DeepEqual(indexes, []int{expect}) {
+			t.Errorf("indexes not match, key: %v, expect: %d, actual: %v, err: %v", key, expect, indexes, err)
+		}
+	}
+	if _, err := rule.FindTableIndex("abc"); err == nil {
+		t.Error("expect error for non numeric key")
+	}
+}
+
+func TestVersionedRuleConflict(t *testing.T) {
+	// 分表1在两个版本中位于不同的slice
+	ns := newVersionedTestNamespace(
+		&models.Shard{DB: "db_ks", Table: "tbl_ver", Type: "mod", Key: "id", Locations: []int{1, 1}, Slices: []string{"slice-0", "slice-1"}, EffectiveFrom: "2020-01-01 00:00:00"},
+		&models.Shard{Type: "mod", Locations: []int{2}, Slices: []string{"slice-0"}},
+	)
+	if _, err := NewRouter(ns); err == nil {
+		t.Error("expect error when sub table located in different slices")
+	}
+}
@@ -20,32 +20,39 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/models"
 )
 
+const maxSegmentAllocRetry = 3
+
 // MySQLSequence struct of sequence number with specific sequence name
 type MySQLSequence struct {
-	slice   *backend.Slice
-	pkName  string
-	seqName string
-	lock    *sync.Mutex
-	curr    int64
-	max     int64
-	sql     string
+	slice     *backend.Slice
+	namespace string
+	pkName    string
+	seqName   string
+	lock      *sync.Mutex
+	curr      int64
+	max       int64
+	sql       string
 }
 
 // NewMySQLSequence init sequence item
 // TODO: 直接注入slice需要考虑关闭的问题, 目前是在Namespace中管理Slice的关闭的. 如果单独使用MySQLSequence, 需要注意.
-func NewMySQLSequence(slice *backend.Slice, seqName, pkName string) *MySQLSequence {
+func NewMySQLSequence(slice *backend.Slice, namespace, seqName, pkName string) *MySQLSequence {
 	t := &MySQLSequence{
-		slice:   slice,
-		seqName: seqName,
-		pkName:  pkName,
-		lock:    new(sync.Mutex),
-		curr:    0,
-		max:     0,
-		sql:     "SELECT mycat_seq_nextval('" + seqName + "') as seq_val",
+		slice:     slice,
+		namespace: namespace,
+		seqName:   seqName,
+		pkName:    pkName,
+		lock:      new(sync.Mutex),
+		curr:      0,
+		max:       0,
+		sql:       "SELECT mycat_seq_nextval('" + seqName + "') as seq_val",
 	}
 	return t
 }
@@ -55,7 +62,7 @@ func (s *MySQLSequence) NextSeq() (int64, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	if s.curr >= s.max {
-		err := s.getSeqFromDB()
+		err := s.allocSegment()
 		if err != nil {
 			return 0, err
 		}
@@ -69,6 +76,121 @@ func (s *MySQLSequence) GetPKName() string {
 	return s.pkName
 }
 
+// GetName return sequence name
+func (s *MySQLSequence) GetName() string {
+	return s.seqName
+}
+
+// Status return current value and max value of local segment
+func (s *MySQLSequence) Status() (int64, int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.curr, s.max
+}
+
+// Advance 将序列号推进到value之后, 数据库和已分配记录都不会小于value, 本地号段失效
+func (s *MySQLSequence) Advance(value int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.curr, s.max = 0, 0
+
+	if store, owner := getSegmentStore(); store != nil {
+		if err := s.advanceSegment(store, owner, value); err != nil {
+			return err
+		}
+	}
+
+	conn, err := s.slice.GetMasterConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Recycle()
+
+	if err = conn.UseDB("mycat"); err != nil {
+		return err
+	}
+	sql := fmt.Sprintf("UPDATE MYCAT_SEQUENCE SET current_value = %d WHERE name = '%s' AND current_value < %d", value, s.seqName, value)
+	_, err = conn.Execute(sql)
+	return err
+}
+
+func (s *MySQLSequence) advanceSegment(store SegmentStore, owner string, value int64) error {
+	for i := 0; i < maxSegmentAllocRetry; i++ {
+		prev, err := store.LoadSequenceSegment(s.namespace, s.seqName)
+		if err != nil {
+			return err
+		}
+		if prev != nil && prev.Max >= value {
+			return nil
+		}
+		err = store.CompareAndSwapSequenceSegment(prev, s.nextSegment(prev, owner, value))
+		if err != models.ErrSequenceSegmentConflict {
+			return err
+		}
+	}
+	return fmt.Errorf("advance sequence %s conflict after %d retries", s.seqName, maxSegmentAllocRetry)
+}
+
+func (s *MySQLSequence) nextSegment(prev *models.SequenceSegment, owner string, max int64) *models.SequenceSegment {
+	next := &models.SequenceSegment{
+		Namespace:  s.namespace,
+		Name:       s.seqName,
+		Max:        max,
+		Epoch:      1,
+		Owner:      owner,
+		UpdateTime: time.Now().Unix(),
+	}
+	if prev != nil {
+		next.Epoch = prev.Epoch + 1
+		if prev.Max > next.Max {
+			next.Max = prev.Max
+		}
+	}
+	return next
+}
+
+// allocSegment 从数据库获取号段, 配置了SegmentStore时将号段记录写入配置中心
+// 读取记录、获取号段、写入记录之间如果有其他proxy分配过号段, 写入会失败并重试,
+// 因此写入成功时数据库返回的号段一定不小于记录中的最大值, 否则说明数据库中的序列号发生了回退
+func (s *MySQLSequence) allocSegment() error {
+	store, owner := getSegmentStore()
+	if store == nil {
+		return s.getSeqFromDB()
+	}
+
+	for i := 0; i < maxSegmentAllocRetry; i++ {
+		prev, err := store.LoadSequenceSegment(s.namespace, s.seqName)
+		if err != nil {
+			return err
+		}
+		if err = s.getSeqFromDB(); err != nil {
+			return err
+		}
+
+		if prev != nil && s.curr < prev.Max {
+			if s.max <= prev.Max {
+				logging.DefaultLogger.Warnf("sequence %s of namespace %s rolled back, segment: (%d, %d], allocated max: %d",
+					s.seqName, s.namespace, s.curr, s.max, prev.Max)
+				s.curr, s.max = 0, 0
+				return fmt.Errorf("sequence %s rolled back, allocated max: %d, advance it by admin api", s.seqName, prev.Max)
+			}
+			// 跳过已经分配过的部分
+			logging.DefaultLogger.Warnf("sequence %s of namespace %s rolled back, skip to %d", s.seqName, s.namespace, prev.Max)
+			s.curr = prev.Max
+		}
+
+		err = store.CompareAndSwapSequenceSegment(prev, s.nextSegment(prev, owner, s.max))
+		if err == nil {
+			return nil
+		}
+		s.curr, s.max = 0, 0
+		if err != models.ErrSequenceSegmentConflict {
+			return err
+		}
+	}
+	return fmt.Errorf("alloc sequence %s segment conflict after %d retries", s.seqName, maxSegmentAllocRetry)
+}
+
 func (s *MySQLSequence) getSeqFromDB() error {
 	conn, err := s.slice.GetMasterConn()
 	if err != nil {
@@ -0,0 +1,48 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"sync"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// SegmentStore 号段分配记录存储, 每次从数据库获取号段后写入已分配的最大值
+// CompareAndSwapSequenceSegment仅在存储中的记录与prev一致时写入, 冲突时返回models.ErrSequenceSegmentConflict
+type SegmentStore interface {
+	LoadSequenceSegment(namespace, name string) (*models.SequenceSegment, error)
+	CompareAndSwapSequenceSegment(prev, next *models.SequenceSegment) error
+}
+
+var segmentStore struct {
+	sync.RWMutex
+	store SegmentStore
+	owner string
+}
+
+// SetSegmentStore set store of sequence segment records, nil store disables persistence
+func SetSegmentStore(store SegmentStore, owner string) {
+	segmentStore.Lock()
+	defer segmentStore.Unlock()
+	segmentStore.store = store
+	segmentStore.owner = owner
+}
+
+func getSegmentStore() (SegmentStore, string) {
+	segmentStore.RLock()
+	defer segmentStore.RUnlock()
+	return segmentStore.store, segmentStore.owner
+}
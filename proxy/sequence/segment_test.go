@@ -0,0 +1,100 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+type memorySegmentStore struct {
+	segments map[string]*models.SequenceSegment
+	// conflicts 模拟其他proxy并发写入的次数
+	conflicts int
+}
+
+func (m *memorySegmentStore) LoadSequenceSegment(namespace, name string) (*models.SequenceSegment, error) {
+	return m.segments[namespace+"/"+name], nil
+}
+
+func (m *memorySegmentStore) CompareAndSwapSequenceSegment(prev, next *models.SequenceSegment) error {
+	key := next.Namespace + "/" + next.Name
+	if m.conflicts > 0 {
+		m.conflicts--
+		curr := *next
+		curr.Epoch = next.Epoch + 100
+		curr.Max = 0
+		if prev != nil {
+			curr.Max = prev.Max
+		}
+		m.segments[key] = &curr
+		return models.ErrSequenceSegmentConflict
+	}
+	curr := m.segments[key]
+	if (prev == nil) != (curr == nil) || (prev != nil && prev.Epoch != curr.Epoch) {
+		return models.ErrSequenceSegmentConflict
+	}
+	m.segments[key] = next
+	return nil
+}
+
+func TestNextSegment(t *testing.T) {
+	s := NewMySQLSequence(nil, "ns", "DB.TBL", "id")
+	next := s.nextSegment(nil, "proxy-1", 100)
+	if next.Epoch != 1 || next.Max != 100 || next.Owner != "proxy-1" || next.Namespace != "ns" || next.Name != "DB.TBL" {
+		t.Errorf("unexpected first segment: %+v", next)
+	}
+
+	next = s.nextSegment(&models.SequenceSegment{Max: 200, Epoch: 3}, "proxy-2", 100)
+	if next.Epoch != 4 || next.Max != 200 {
+		t.Errorf("segment max must not go back, actual: %+v", next)
+	}
+}
+
+func TestAdvanceSegment(t *testing.T) {
+	store := &memorySegmentStore{segments: make(map[string]*models.SequenceSegment)}
+	s := NewMySQLSequence(nil, "ns", "DB.TBL", "id")
+
+	if err := s.advanceSegment(store, "proxy-1", 1000); err != nil {
+		t.Fatalf("advance error: %v", err)
+	}
+	segment := store.segments["ns/DB.TBL"]
+	if segment == nil || segment.Max != 1000 || segment.Epoch != 1 {
+		t.Fatalf("unexpected segment: %+v", segment)
+	}
+
+	// 小于已分配最大值时不修改记录
+	if err := s.advanceSegment(store, "proxy-1", 500); err != nil {
+		t.Fatalf("advance error: %v", err)
+	}
+	if store.segments["ns/DB.TBL"].Max != 1000 {
+		t.Errorf("segment max must not go back, actual: %+v", store.segments["ns/DB.TBL"])
+	}
+
+	// 冲突后重新读取记录重试
+	store.conflicts = 1
+	if err := s.advanceSegment(store, "proxy-1", 2000); err != nil {
+		t.Fatalf("advance error: %v", err)
+	}
+	if segment := store.segments["ns/DB.TBL"]; segment.Max != 2000 || segment.Epoch != 103 {
+		t.Errorf("unexpected segment after conflict: %+v", segment)
+	}
+
+	store.conflicts = maxSegmentAllocRetry
+	if err := s.advanceSegment(store, "proxy-1", 3000); err == nil {
+		t.Errorf("expect error after %d conflicts", maxSegmentAllocRetry)
+	}
+}
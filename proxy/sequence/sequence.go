@@ -52,3 +52,14 @@ func (s *SequenceManager) GetSequence(db, table string) (Sequence, bool) {
 	seq, ok := dbSeq[table]
 	return seq, ok
 }
+
+// GetAllSequences return all sequences, key is db.table
+func (s *SequenceManager) GetAllSequences() map[string]Sequence {
+	ret := make(map[string]Sequence)
+	for db, tables := range s.sequences {
+		for table, seq := range tables {
+			ret[db+"."+table] = seq
+		}
+	}
+	return ret
+}
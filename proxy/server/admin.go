@@ -15,6 +15,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"fmt"
 	"github.com/XiaoMi/Gaea/logging"
 	"github.com/XiaoMi/Gaea/provider"
@@ -23,11 +24,15 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/proxy/fault"
 	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/adminauth"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 )
@@ -55,7 +60,9 @@ type AdminServer struct {
 	listener      net.Listener
 	adminUser     string
 	adminPassword string
+	auth          *adminauth.Authenticator
 	engine        *gin.Engine
+	certReloader  *adminauth.CertReloader // 开启https时热加载证书, 否则为nil
 
 	configType          string
 	coordinatorAddr     string
@@ -90,11 +97,30 @@ func NewAdminServer(proxy *Server, cfg *models.Proxy) (*AdminServer, error) {
 	s.coordinatorPassword = cfg.Password
 	s.coordinatorRoot = cfg.CoordinatorRoot
 
+	s.auth, err = adminauth.NewAuthenticator(cfg.AdminUser, cfg.AdminPassword, cfg.AdminTokens, cfg.AdminCertRoles)
+	if err != nil {
+		return nil, err
+	}
+	s.certReloader, err = adminauth.NewCertReloader(cfg.AdminTLSCert, cfg.AdminTLSKey, cfg.AdminTLSCA, func(err error) {
+		if err != nil {
+			log.Warnf("[server] reload admin tls cert failed, keep using the previous cert, %v", err)
+			return
+		}
+		log.Infof("[server] admin tls cert reloaded")
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	s.engine = gin.New()
 	l, err := net.Listen(cfg.ProtoType, cfg.AdminAddr)
 	if err != nil {
 		return nil, err
 	}
+	if s.certReloader != nil {
+		l = tls.NewListener(l, s.certReloader.TLSConfig())
+		s.certReloader.Watch(adminauth.DefaultCertCheckInterval)
+	}
 	s.listener = l
 	s.registerURL()
 	s.registerMetric()
@@ -137,6 +163,9 @@ func (s *AdminServer) Run() {
 // Close close admin server
 func (s *AdminServer) Close() error {
 	close(s.exit.C)
+	if s.certReloader != nil {
+		s.certReloader.Close()
+	}
 	if err := s.unregisterProxy(); err != nil {
 		log.Fatalf("unregister proxy failed, %v", err)
 		return err
@@ -144,18 +173,60 @@ func (s *AdminServer) Close() error {
 	return nil
 }
 
+// ReloadTLS reload cert of admin server, do nothing if https is not enabled
+func (s *AdminServer) ReloadTLS() error {
+	if s.certReloader == nil {
+		return nil
+	}
+	return s.certReloader.Reload()
+}
+
 func (s *AdminServer) registerURL() {
-	adminGroup := s.engine.Group("/api/proxy", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
-	adminGroup.GET("/ping", s.ping)
-	adminGroup.PUT("/source/prepare/:name", s.prepareConfig)
-	adminGroup.PUT("/source/commit/:name", s.commitConfig)
-	adminGroup.PUT("/namespace/delete/:name", s.deleteNamespace)
-	adminGroup.GET("/source/fingerprint", s.configFingerprint)
-
-	adminGroup.GET("/stats/sessionsqlfingerprint/:namespace", s.getNamespaceSessionSQLFingerprint)
-	adminGroup.GET("/stats/backendsqlfingerprint/:namespace", s.getNamespaceBackendSQLFingerprint)
-	adminGroup.DELETE("/stats/sessionsqlfingerprint/:namespace", s.clearNamespaceSessionSQLFingerprint)
-	adminGroup.DELETE("/stats/backendsqlfingerprint/:namespace", s.clearNamespaceBackendSQLFingerprint)
+	viewer := adminauth.RequireRole(models.AdminRoleViewer)
+	operator := adminauth.RequireRole(models.AdminRoleOperator)
+	admin := adminauth.RequireRole(models.AdminRoleAdmin)
+
+	adminGroup := s.engine.Group("/api/proxy", s.auth.Authenticate())
+	adminGroup.GET("/ping", viewer, s.ping)
+	adminGroup.PUT("/source/prepare/:name", admin, s.prepareConfig)
+	adminGroup.PUT("/source/commit/:name", admin, s.commitConfig)
+	adminGroup.PUT("/namespace/delete/:name", admin, s.deleteNamespace)
+	adminGroup.PUT("/namespace/readonly/:name", operator, s.setNamespaceReadOnly)
+	adminGroup.PUT("/namespace/readwrite/:name", operator, s.setNamespaceReadWrite)
+	adminGroup.PUT("/slice/:namespace/:slice/:op/:action", operator, s.setSliceSwitch)
+	adminGroup.GET("/writebuffering", viewer, s.getWriteBuffering)
+	adminGroup.GET("/connections", viewer, s.getConnCounts)
+	adminGroup.GET("/commits", viewer, s.getCommitProgress)
+	adminGroup.GET("/transactions", viewer, s.getTransactions)
+	adminGroup.PUT("/commits/resolve/:connid/:action", operator, s.resolveCommit)
+	adminGroup.PUT("/writebuffering", operator, s.setWriteBuffering)
+	adminGroup.PUT("/materializedview/refresh/:namespace/:db/:name", operator, s.refreshMaterializedView)
+	adminGroup.GET("/shardtables/check/:namespace", viewer, s.checkShardTables)
+	adminGroup.PUT("/shardtables/create/:namespace", admin, s.createShardTables)
+	adminGroup.GET("/archive/:namespace", viewer, s.getArchiveStatus)
+	adminGroup.PUT("/archive/cutoff/:namespace/:db/:table/:cutoff", operator, s.setArchiveCutoff)
+	adminGroup.DELETE("/archive/cutoff/:namespace/:db/:table", operator, s.setArchiveCutoff)
+	adminGroup.GET("/sequence/:namespace", viewer, s.getSequenceStatus)
+	adminGroup.GET("/routingaudit/:namespace", viewer, s.getRoutingAuditStatus)
+	adminGroup.GET("/backendinfo/:namespace", viewer, s.getBackendInfos)
+	adminGroup.PUT("/sequence/advance/:namespace/:db/:table/:value", operator, s.advanceSequence)
+	adminGroup.POST("/export/:namespace", operator, s.exportResult)
+	adminGroup.GET("/source/fingerprint", viewer, s.configFingerprint)
+	adminGroup.PUT("/capture/start", admin, s.startCapture)
+	adminGroup.PUT("/capture/stop", admin, s.stopCapture)
+	adminGroup.PUT("/fault/:action", admin, s.setFaultInjection)
+	adminGroup.GET("/fault/rules", viewer, s.getFaultRules)
+	adminGroup.POST("/fault/rule", admin, s.addFaultRule)
+	adminGroup.DELETE("/fault/rule/:id", admin, s.removeFaultRule)
+	adminGroup.DELETE("/fault/rules", admin, s.clearFaultRules)
+
+	adminGroup.GET("/stats/sessionsqlfingerprint/:namespace", viewer, s.getNamespaceSessionSQLFingerprint)
+	adminGroup.GET("/stats/backendsqlfingerprint/:namespace", viewer, s.getNamespaceBackendSQLFingerprint)
+	adminGroup.DELETE("/stats/sessionsqlfingerprint/:namespace", operator, s.clearNamespaceSessionSQLFingerprint)
+	adminGroup.DELETE("/stats/backendsqlfingerprint/:namespace", operator, s.clearNamespaceBackendSQLFingerprint)
+	adminGroup.GET("/audit", viewer, s.getAdminAudit)
+	adminGroup.GET("/diagnostic/state", admin, s.diagnosticLimit, s.getDiagnosticState)
+	adminGroup.GET("/diagnostic/bundle", admin, s.diagnosticLimit, s.getDiagnosticBundle)
 
 	adminGroup.Use(gzip.Gzip(gzip.DefaultCompression))
 	adminGroup.Use(gin.Recovery())
@@ -165,7 +236,7 @@ func (s *AdminServer) registerURL() {
 }
 
 func (s *AdminServer) registerMetric() {
-	metricGroup := s.engine.Group("/api/metric", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
+	metricGroup := s.engine.Group("/api/metric", s.auth.Authenticate(), adminauth.RequireRole(models.AdminRoleViewer))
 	for path, handler := range s.proxy.manager.GetStatisticManager().GetHandlers() {
 		log.Debugf("[server] AdminServer got metric handler, path: %s", path)
 		metricGroup.GET(path, gin.WrapH(handler))
@@ -173,19 +244,20 @@ func (s *AdminServer) registerMetric() {
 }
 
 func (s *AdminServer) registerProf() {
-	profGroup := s.engine.Group("/debug/pprof", gin.BasicAuth(gin.Accounts{s.adminUser: s.adminPassword}))
+	profGroup := s.engine.Group("/debug/pprof", s.auth.Authenticate(), adminauth.RequireRole(models.AdminRoleAdmin))
 	profGroup.GET("/", gin.WrapF(pprof.Index))
 	profGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
-	profGroup.GET("/profile", gin.WrapF(pprof.Profile))
 	profGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
 	profGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
-	profGroup.GET("/trace", gin.WrapF(pprof.Trace))
-	profGroup.GET("/block", gin.WrapF(pprof.Handler("block").ServeHTTP))
-	profGroup.GET("/goroutine", gin.WrapF(pprof.Handler("goroutine").ServeHTTP))
-	profGroup.GET("/heap", gin.WrapF(pprof.Handler("heap").ServeHTTP))
-	profGroup.GET("/mutex", gin.WrapF(pprof.Handler("mutex").ServeHTTP))
-	profGroup.GET("/threadcreate", gin.WrapF(pprof.Handler("threadcreate").ServeHTTP))
-	profGroup.GET("/allocs", gin.WrapF(pprof.Handler("allocs").ServeHTTP))
+	// 采集profile会影响线上服务, 限制并发、频率和采集时间
+	profGroup.GET("/profile", s.diagnosticLimit, gin.WrapF(pprof.Profile))
+	profGroup.GET("/trace", s.diagnosticLimit, gin.WrapF(pprof.Trace))
+	profGroup.GET("/block", s.diagnosticLimit, gin.WrapF(pprof.Handler("block").ServeHTTP))
+	profGroup.GET("/goroutine", s.diagnosticLimit, gin.WrapF(pprof.Handler("goroutine").ServeHTTP))
+	profGroup.GET("/heap", s.diagnosticLimit, gin.WrapF(pprof.Handler("heap").ServeHTTP))
+	profGroup.GET("/mutex", s.diagnosticLimit, gin.WrapF(pprof.Handler("mutex").ServeHTTP))
+	profGroup.GET("/threadcreate", s.diagnosticLimit, gin.WrapF(pprof.Handler("threadcreate").ServeHTTP))
+	profGroup.GET("/allocs", s.diagnosticLimit, gin.WrapF(pprof.Handler("allocs").ServeHTTP))
 }
 
 // NewProxyInfo create proxy information
@@ -195,13 +267,16 @@ func NewProxyInfo(cfg *models.Proxy, addr string) (*models.ProxyInfo, error) {
 		return nil, err
 	}
 
-	proxyIPPort := strings.Split(cfg.ProxyAddr, ":")
+	proxyPort, err := getProxyPort(cfg.ProtoType, cfg.ProxyAddr)
+	if err != nil {
+		return nil, err
+	}
 	adminIPPort := strings.Split(cfg.AdminAddr, ":")
 
 	proxyInfo := &models.ProxyInfo{
 		StartTime: time.Now().String(),
 		ProtoType: cfg.ProtoType,
-		ProxyPort: proxyIPPort[1],
+		ProxyPort: proxyPort,
 		AdminPort: adminIPPort[1],
 	}
 	tmp := strings.Split(ipPort, ":")
@@ -275,6 +350,7 @@ func (s *AdminServer) prepareConfig(c *gin.Context) {
 	client := provider.NewClient(provider.ConfigEtcd, s.coordinatorAddr, s.coordinatorUsername, s.coordinatorPassword, s.coordinatorRoot)
 	defer client.Close()
 	err := s.proxy.ReloadNamespacePrepare(name, client)
+	s.audit(c, "config_prepare", name, "", nil, nil, err)
 	if err != nil {
 		log.Warnf("prepare source of namespace: %s failed, err: %v", name, err)
 		c.JSON(selfDefinedInternalError, err.Error())
@@ -289,7 +365,9 @@ func (s *AdminServer) commitConfig(c *gin.Context) {
 		c.JSON(selfDefinedInternalError, "missing namespace name")
 		return
 	}
+	before := s.namespaceConfigMD5(name)
 	err := s.proxy.ReloadNamespaceCommit(name)
+	s.audit(c, "config_commit", name, "", before, s.namespaceConfigMD5(name), err)
 	if err != nil {
 		c.JSON(selfDefinedInternalError, err.Error())
 		return
@@ -304,7 +382,51 @@ func (s *AdminServer) deleteNamespace(c *gin.Context) {
 		return
 	}
 	// delete namespace
+	before := s.namespaceConfigMD5(name)
 	err := s.proxy.DeleteNamespace(name)
+	s.audit(c, "namespace_delete", name, "", before, s.namespaceConfigMD5(name), err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
+
+// setNamespaceReadOnly reject writes of namespace, the flag is reset after namespace reloaded
+func (s *AdminServer) setNamespaceReadOnly(c *gin.Context) {
+	s.setNamespaceReadOnlyFlag(c, true)
+}
+
+// setNamespaceReadWrite allow writes of namespace, maintenance windows still take effect
+func (s *AdminServer) setNamespaceReadWrite(c *gin.Context) {
+	s.setNamespaceReadOnlyFlag(c, false)
+}
+
+func (s *AdminServer) setNamespaceReadOnlyFlag(c *gin.Context, readOnly bool) {
+	name := strings.TrimSpace(c.Param("name"))
+	if name == "" {
+		c.JSON(selfDefinedInternalError, "missing namespace name")
+		return
+	}
+	namespace := s.proxy.manager.GetNamespace(name)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	before := namespace.readOnly.Get()
+	namespace.SetReadOnly(readOnly)
+	s.audit(c, "namespace_readonly", name, "", before, readOnly, nil)
+	log.Infof("set read only of namespace: %s to %v", name, readOnly)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// refreshMaterializedView refresh materialized view immediately, returns after the materialized table is rewritten
+func (s *AdminServer) refreshMaterializedView(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	db := strings.TrimSpace(c.Param("db"))
+	name := strings.TrimSpace(c.Param("name"))
+	err := s.proxy.manager.RefreshMaterializedView(ns, db, name)
+	s.audit(c, "materialized_view_refresh", ns, db+"."+name, nil, nil, err)
 	if err != nil {
 		c.JSON(selfDefinedInternalError, err.Error())
 		return
@@ -312,6 +434,386 @@ func (s *AdminServer) deleteNamespace(c *gin.Context) {
 	c.JSON(http.StatusOK, "OK")
 }
 
+// checkShardTables return physical tables of shard rules missing on or not expected by backends
+func (s *AdminServer) checkShardTables(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.CheckShardTables(ns, false)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// createShardTables create missing physical tables with DDL of an existing physical table of the same rule
+func (s *AdminServer) createShardTables(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.CheckShardTables(ns, true)
+	s.audit(c, "shard_tables_create", ns, "", nil, ret, err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// getArchiveStatus return runtime archive cutoffs of archived shard rules in namespace
+func (s *AdminServer) getArchiveStatus(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.GetArchiveStatus(ns)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// setArchiveCutoff move archive cutoff of shard rule, or clear it when cutoff is not given
+func (s *AdminServer) setArchiveCutoff(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	db := strings.TrimSpace(c.Param("db"))
+	table := strings.TrimSpace(c.Param("table"))
+	cutoff := strings.TrimSpace(c.Param("cutoff"))
+	before := s.archiveCutoff(ns, db, table)
+	err := s.proxy.manager.SetArchiveCutoff(ns, db, table, cutoff)
+	s.audit(c, "archive_cutoff", ns, db+"."+table, before, s.archiveCutoff(ns, db, table), err)
+	if err != nil {
+		log.Warnf("set archive cutoff failed, namespace: %s, table: %s.%s, cutoff: %s, err: %v", ns, db, table, cutoff, err)
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("set archive cutoff, namespace: %s, table: %s.%s, cutoff: %s", ns, db, table, cutoff)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getSequenceStatus return local segments and persisted segment records of global sequences in namespace
+func (s *AdminServer) getSequenceStatus(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.GetSequenceStatus(ns)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// getRoutingAuditStatus return compare counts and recent mismatches of candidate shard rules
+func (s *AdminServer) getRoutingAuditStatus(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.GetRoutingAuditStatus(ns)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// getBackendInfos return version, capabilities and default charset of backends probed when connecting
+func (s *AdminServer) getBackendInfos(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	ret, err := s.proxy.manager.GetBackendInfos(ns)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ret)
+}
+
+// advanceSequence advance global sequence so that ids issued later are greater than value
+func (s *AdminServer) advanceSequence(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	db := strings.TrimSpace(c.Param("db"))
+	table := strings.TrimSpace(c.Param("table"))
+	value, err := strconv.ParseInt(c.Param("value"), 10, 64)
+	if err != nil || value < 0 {
+		c.JSON(selfDefinedInternalError, "invalid value")
+		return
+	}
+	before := s.sequenceStatus(ns, db, table)
+	err = s.proxy.manager.AdvanceSequence(ns, db, table, value)
+	s.audit(c, "sequence_advance", ns, db+"."+table, before, s.sequenceStatus(ns, db, table), err)
+	if err != nil {
+		log.Warnf("advance sequence failed, namespace: %s, table: %s.%s, value: %d, err: %v", ns, db, table, value, err)
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("advance sequence, namespace: %s, table: %s.%s, value: %d", ns, db, table, value)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// exportRequest request of export api
+type exportRequest struct {
+	DB     string `json:"db"`
+	SQL    string `json:"sql"`
+	Format string `json:"format"` // csv或json, 默认csv
+}
+
+// exportResult execute select statement through planner, and write the merged result as csv or json lines
+func (s *AdminServer) exportResult(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	req := &exportRequest{}
+	if err := c.BindJSON(req); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	if req.Format == "" {
+		req.Format = ExportFormatCSV
+	}
+	if req.Format != ExportFormatCSV && req.Format != ExportFormatJSON {
+		c.JSON(selfDefinedInternalError, "invalid export format: "+req.Format)
+		return
+	}
+
+	r, err := s.proxy.manager.ExecuteReadOnlySQL(ns, req.DB, req.SQL)
+	if namespace := s.proxy.manager.GetNamespace(ns); namespace != nil {
+		s.audit(c, "export", ns, namespace.redactSQL(req.SQL), nil, nil, err)
+	}
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("export result, namespace: %s, db: %s, sql: %s, rows: %d", ns, req.DB, s.proxy.manager.GetNamespace(ns).redactSQL(req.SQL), len(r.Values))
+
+	if req.Format == ExportFormatJSON {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		err = writeResultJSONLines(c.Writer, r.Resultset)
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		err = writeResultCSV(c.Writer, r.Resultset)
+	}
+	if err != nil {
+		log.Warnf("write export result failed, namespace: %s, sql: %s, err: %v", ns, s.proxy.manager.GetNamespace(ns).redactSQL(req.SQL), err)
+	}
+}
+
+// setSliceSwitch enable or disable reads or writes of slice, op: read/write, action: enable/disable
+// the switch is reset after namespace reloaded
+func (s *AdminServer) setSliceSwitch(c *gin.Context) {
+	ns := strings.TrimSpace(c.Param("namespace"))
+	sliceName := strings.TrimSpace(c.Param("slice"))
+	op := c.Param("op")
+	action := c.Param("action")
+
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	if namespace.GetSlice(sliceName) == nil {
+		c.JSON(selfDefinedInternalError, "slice not found")
+		return
+	}
+
+	var enabled bool
+	switch action {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		c.JSON(selfDefinedInternalError, "invalid action, must be enable or disable")
+		return
+	}
+
+	var before bool
+	switch op {
+	case "read":
+		before = namespace.GetRouter().IsSliceReadEnabled(sliceName)
+		namespace.GetRouter().SetSliceReadEnabled(sliceName, enabled)
+	case "write":
+		before = namespace.GetRouter().IsSliceWriteEnabled(sliceName)
+		namespace.GetRouter().SetSliceWriteEnabled(sliceName, enabled)
+	default:
+		c.JSON(selfDefinedInternalError, "invalid op, must be read or write")
+		return
+	}
+	s.audit(c, "slice_"+op, ns, sliceName, before, enabled, nil)
+	log.Infof("%s %s of slice: %s in namespace: %s", action, op, sliceName, ns)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// startCapture start capturing client statements to file for replay, query params: path(relative to capture_dir), namespace(optional)
+func (s *AdminServer) startCapture(c *gin.Context) {
+	path, err := getCapturePath(s.proxy.captureDir, strings.TrimSpace(c.Query("path")))
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	ns := strings.TrimSpace(c.Query("namespace"))
+	if ns != "" && s.proxy.manager.GetNamespace(ns) == nil {
+		c.JSON(selfDefinedInternalError, "namespace not found")
+		return
+	}
+	err = s.proxy.manager.StartCapture(path, ns)
+	s.audit(c, "capture_start", ns, path, nil, nil, err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("start capture, path: %s, namespace: %s", path, ns)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// getCapturePath 录制文件只能写入capture_dir, name必须是相对路径且不能包含..
+func getCapturePath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("capture is disabled, capture_dir is not configured")
+	}
+	if name == "" {
+		return "", fmt.Errorf("missing capture file path")
+	}
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("capture file path should be relative to capture_dir: %s", name)
+	}
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("capture file path should not contain '..': %s", name)
+		}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("capture file path is not in capture_dir: %s", name)
+	}
+	return path, nil
+}
+
+func (s *AdminServer) stopCapture(c *gin.Context) {
+	err := s.proxy.manager.StopCapture()
+	s.audit(c, "capture_stop", "", "", nil, nil, err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("stop capture")
+	c.JSON(http.StatusOK, "OK")
+}
+
+// setFaultInjection enable or disable fault injection of backend execution, action: enable/disable
+func (s *AdminServer) setFaultInjection(c *gin.Context) {
+	action := c.Param("action")
+	injector := s.proxy.manager.GetFaultInjector()
+	before := injector.IsEnabled()
+	switch action {
+	case "enable":
+		injector.SetEnabled(true)
+	case "disable":
+		injector.SetEnabled(false)
+	default:
+		c.JSON(selfDefinedInternalError, "invalid action, must be enable or disable")
+		return
+	}
+	s.audit(c, "fault_injection", "", "", before, injector.IsEnabled(), nil)
+	log.Infof("%s fault injection", action)
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (s *AdminServer) getFaultRules(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.manager.GetFaultInjector().Rules())
+}
+
+func (s *AdminServer) getConnCounts(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.connLimiter.counts())
+}
+
+// getCommitProgress return multi-slice commits in progress of all namespaces
+func (s *AdminServer) getCommitProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.manager.getCommitTracker().list(""))
+}
+
+// getTransactions return open transactions, filtered by namespace query parameter if given
+func (s *AdminServer) getTransactions(c *gin.Context) {
+	ns := strings.TrimSpace(c.Query("namespace"))
+	c.JSON(http.StatusOK, s.proxy.manager.getTransactionTracker().list(ns))
+}
+
+// resolveCommit interrupt hung multi-slice commit, and commit or rollback the remaining slices
+func (s *AdminServer) resolveCommit(c *gin.Context) {
+	connID, err := strconv.ParseUint(c.Param("connid"), 10, 32)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, "invalid connection id")
+		return
+	}
+	action := strings.TrimSpace(c.Param("action"))
+	ret, err := s.proxy.manager.getCommitTracker().resolve(uint32(connID), action)
+	s.audit(c, "commit_resolve", ret.Namespace, c.Param("connid"), nil, ret, err)
+	if err != nil {
+		log.Warnf("resolve commit failed, conn: %d, action: %s, err: %v", connID, action, err)
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("resolve commit, conn: %d, namespace: %s, action: %s, interrupted slice: %s", connID, ret.Namespace, action, ret.Current)
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (s *AdminServer) getWriteBuffering(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.GetWriteBuffering())
+}
+
+// setWriteBuffering change write buffering of proxy from json body, namespace config still overrides it
+func (s *AdminServer) setWriteBuffering(c *gin.Context) {
+	wb := WriteBuffering{}
+	if err := c.BindJSON(&wb); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	before := s.proxy.GetWriteBuffering()
+	err := s.proxy.SetWriteBuffering(wb)
+	s.audit(c, "write_buffering", "", "", before, wb, err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("set write buffering: %+v", wb)
+	c.JSON(http.StatusOK, "OK")
+}
+
+// addFaultRule add fault rule from json body, return id of the rule
+func (s *AdminServer) addFaultRule(c *gin.Context) {
+	rule := &fault.Rule{}
+	if err := c.BindJSON(rule); err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	id, err := s.proxy.manager.GetFaultInjector().AddRule(rule)
+	s.audit(c, "fault_rule_add", rule.Namespace, strconv.FormatInt(id, 10), nil, rule, err)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, err.Error())
+		return
+	}
+	log.Infof("add fault rule: %+v", rule)
+	c.JSON(http.StatusOK, id)
+}
+
+func (s *AdminServer) removeFaultRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(selfDefinedInternalError, "invalid rule id")
+		return
+	}
+	before := s.faultRule(id)
+	if !s.proxy.manager.GetFaultInjector().RemoveRule(id) {
+		c.JSON(selfDefinedInternalError, "fault rule not found")
+		return
+	}
+	s.audit(c, "fault_rule_remove", "", c.Param("id"), before, nil, nil)
+	log.Infof("remove fault rule: %d", id)
+	c.JSON(http.StatusOK, "OK")
+}
+
+func (s *AdminServer) clearFaultRules(c *gin.Context) {
+	before := s.proxy.manager.GetFaultInjector().Rules()
+	s.proxy.manager.GetFaultInjector().ClearRules()
+	s.audit(c, "fault_rules_clear", "", "", before, nil, nil)
+	log.Infof("clear fault rules")
+	c.JSON(http.StatusOK, "OK")
+}
+
 func (s *AdminServer) configFingerprint(c *gin.Context) {
 	c.JSON(http.StatusOK, s.proxy.manager.ConfigFingerprint())
 }
@@ -355,8 +857,10 @@ func (s *AdminServer) clearNamespaceSessionSQLFingerprint(c *gin.Context) {
 		return
 	}
 
+	before := &SQLFingerprint{SlowSQL: namespace.GetSlowSQLFingerprints(), ErrorSQL: namespace.GetErrorSQLFingerprints()}
 	namespace.ClearSlowSQLFingerprints()
 	namespace.ClearErrorSQLFingerprints()
+	s.audit(c, "session_sql_fingerprint_clear", ns, "", fingerprintCount(before), nil, nil)
 
 	c.JSON(http.StatusOK, "OK")
 }
@@ -369,8 +873,31 @@ func (s *AdminServer) clearNamespaceBackendSQLFingerprint(c *gin.Context) {
 		return
 	}
 
+	before := &SQLFingerprint{SlowSQL: namespace.GetBackendSlowSQLFingerprints(), ErrorSQL: namespace.GetBackendErrorSQLFingerprints()}
 	namespace.ClearBackendSlowSQLFingerprints()
 	namespace.ClearBackendErrorSQLFingerprints()
+	s.audit(c, "backend_sql_fingerprint_clear", ns, "", fingerprintCount(before), nil, nil)
 
 	c.JSON(http.StatusOK, "OK")
 }
+
+// getAdminAudit return audit entries of admin actions kept in memory, query params:
+// since(only entries with greater id), action, namespace, limit(latest n entries)
+func (s *AdminServer) getAdminAudit(c *gin.Context) {
+	var since int64
+	var limit int
+	var err error
+	if v := c.Query("since"); v != "" {
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(selfDefinedInternalError, "invalid since")
+			return
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(selfDefinedInternalError, "invalid limit")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, s.proxy.manager.GetAdminAuditLog().Query(since, c.Query("action"), c.Query("namespace"), limit))
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/models"
+	parser2 "github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/fault"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+	"github.com/XiaoMi/Gaea/util/adminauth"
+)
+
+var auditLogger = logging.GetLogger("admin-audit")
+
+// 管理操作来源
+const (
+	AdminAuditSourceAPI = "api" // 管理接口
+	AdminAuditSourceSQL = "sql" // KILL, FLUSH等管理语句
+)
+
+// 内存中保留的最近审计记录数, 全部记录都会输出到日志
+const defaultAdminAuditCapacity = 1000
+
+// AdminAuditEntry 一次管理操作的审计记录
+type AdminAuditEntry struct {
+	ID        int64       `json:"id"`
+	Time      string      `json:"time"`
+	Source    string      `json:"source"`
+	Actor     string      `json:"actor"` // 管理接口为认证的身份, 管理语句为数据库用户名
+	Role      string      `json:"role"`
+	Client    string      `json:"client"`
+	Action    string      `json:"action"`
+	Namespace string      `json:"namespace,omitempty"`
+	Target    string      `json:"target,omitempty"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// AdminAuditLog 管理操作审计, 在内存中保留最近的记录用于查询, 同时输出到日志
+type AdminAuditLog struct {
+	lock     sync.Mutex
+	entries  []*AdminAuditEntry // 环形缓冲, 按id取模存放
+	capacity int
+	lastID   int64
+}
+
+// NewAdminAuditLog constructor of AdminAuditLog
+func NewAdminAuditLog(capacity int) *AdminAuditLog {
+	return &AdminAuditLog{
+		entries:  make([]*AdminAuditEntry, 0, capacity),
+		capacity: capacity,
+	}
+}
+
+// Record assign id and time to entry, and save it
+func (a *AdminAuditLog) Record(e *AdminAuditEntry) {
+	a.lock.Lock()
+	a.lastID++
+	e.ID = a.lastID
+	e.Time = time.Now().Format("2006-01-02 15:04:05.000")
+	if len(a.entries) < a.capacity {
+		a.entries = append(a.entries, e)
+	} else {
+		a.entries[(e.ID-1)%int64(a.capacity)] = e
+	}
+	a.lock.Unlock()
+
+	auditLogger.Infof("admin audit: %s", models.JSONEncode(e))
+}
+
+// Query return entries whose id is greater than since, filtered by action and namespace if not empty,
+// at most limit latest entries are returned in order of id
+func (a *AdminAuditLog) Query(since int64, action, namespace string, limit int) []*AdminAuditEntry {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	ret := make([]*AdminAuditEntry, 0)
+	first := a.lastID - int64(len(a.entries)) + 1
+	if since >= first {
+		first = since + 1
+	}
+	for id := first; id <= a.lastID; id++ {
+		e := a.entries[(id-1)%int64(a.capacity)]
+		if action != "" && e.Action != action {
+			continue
+		}
+		if namespace != "" && e.Namespace != namespace {
+			continue
+		}
+		ret = append(ret, e)
+	}
+	if limit > 0 && len(ret) > limit {
+		ret = ret[len(ret)-limit:]
+	}
+	return ret
+}
+
+// recordAdminAudit record admin statement or variable executed by session
+func (se *SessionExecutor) recordAdminAudit(action, target string, before, after interface{}, err error) {
+	ns := se.GetNamespace()
+	e := &AdminAuditEntry{
+		Source:    AdminAuditSourceSQL,
+		Actor:     se.user,
+		Role:      ns.getUserProperty(se.user).AdminRole,
+		Client:    se.clientAddr,
+		Action:    action,
+		Namespace: se.namespace,
+		Target:    target,
+		Before:    before,
+		After:     after,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	se.manager.GetAdminAuditLog().Record(e)
+}
+
+// auditAdminStmt record KILL, FLUSH statements, including rejected ones
+func (se *SessionExecutor) auditAdminStmt(stmtType parser2.StatementType, sql string, err error) {
+	if action := getAdminStmtAction(stmtType, sql); action != "" {
+		se.recordAdminAudit(action, se.GetNamespace().redactSQL(sql), nil, nil, err)
+	}
+}
+
+// configDigest md5 of namespace config, used as state of config in audit entries
+func configDigest(cfg *models.Namespace) string {
+	return fmt.Sprintf("%x", md5.Sum(models.JSONEncode(cfg)))
+}
+
+// audit record action of admin api, with identity and role of the request
+func (s *AdminServer) audit(c *gin.Context, action, namespace, target string, before, after interface{}, err error) {
+	e := &AdminAuditEntry{
+		Source:    AdminAuditSourceAPI,
+		Actor:     c.GetString(gin.AuthUserKey),
+		Role:      c.GetString(adminauth.RoleKey),
+		Client:    c.ClientIP(),
+		Action:    action,
+		Namespace: namespace,
+		Target:    target,
+		Before:    before,
+		After:     after,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.proxy.manager.GetAdminAuditLog().Record(e)
+}
+
+// namespaceConfigMD5 return md5 of config of namespace in use, or empty string if not found
+func (s *AdminServer) namespaceConfigMD5(name string) string {
+	if ns := s.proxy.manager.GetNamespace(name); ns != nil {
+		return ns.configMD5
+	}
+	return ""
+}
+
+func (s *AdminServer) archiveCutoff(ns, db, table string) interface{} {
+	status, err := s.proxy.manager.GetArchiveStatus(ns)
+	if err != nil {
+		return nil
+	}
+	for _, st := range status {
+		if st.DB == db && st.Table == table {
+			return st.Cutoff
+		}
+	}
+	return nil
+}
+
+// sequenceStatus return local segment of sequence, persisted segment is not loaded
+func (s *AdminServer) sequenceStatus(ns, db, table string) interface{} {
+	namespace := s.proxy.manager.GetNamespace(ns)
+	if namespace == nil {
+		return nil
+	}
+	seq, ok := namespace.GetSequences().GetSequence(db, table)
+	if !ok {
+		return nil
+	}
+	mysqlSeq, ok := seq.(*sequence.MySQLSequence)
+	if !ok {
+		return nil
+	}
+	status := &SequenceStatus{DB: db, Table: table, Name: mysqlSeq.GetName(), PKName: mysqlSeq.GetPKName()}
+	status.Curr, status.Max = mysqlSeq.Status()
+	return status
+}
+
+func (s *AdminServer) faultRule(id int64) *fault.Rule {
+	for _, r := range s.proxy.manager.GetFaultInjector().Rules() {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// fingerprintCount 清空指纹时只记录清空前的数量
+func fingerprintCount(f *SQLFingerprint) map[string]int {
+	return map[string]int{"slow_sql": len(f.SlowSQL), "error_sql": len(f.ErrorSQL)}
+}
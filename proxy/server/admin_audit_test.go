@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func TestAdminAuditLog(t *testing.T) {
+	a := NewAdminAuditLog(3)
+	if entries := a.Query(0, "", "", 0); len(entries) != 0 {
+		t.Fatalf("expect no entries, actual: %d", len(entries))
+	}
+
+	actions := []string{"kill", "namespace_readonly", "kill", "flush", "kill"}
+	for _, action := range actions {
+		a.Record(&AdminAuditEntry{Source: AdminAuditSourceSQL, Actor: "ops", Action: action, Namespace: "ns1"})
+	}
+
+	// 只保留最近3条
+	entries := a.Query(0, "", "", 0)
+	if len(entries) != 3 || entries[0].ID != 3 || entries[2].ID != 5 || entries[2].Time == "" {
+		t.Fatalf("query all error, entries: %s", models.JSONEncode(entries))
+	}
+	if entries = a.Query(0, "kill", "", 0); len(entries) != 2 || entries[0].ID != 3 || entries[1].ID != 5 {
+		t.Errorf("query by action error, entries: %s", models.JSONEncode(entries))
+	}
+	if entries = a.Query(4, "", "", 0); len(entries) != 1 || entries[0].ID != 5 {
+		t.Errorf("query since error, entries: %s", models.JSONEncode(entries))
+	}
+	if entries = a.Query(0, "", "", 2); len(entries) != 2 || entries[0].ID != 4 {
+		t.Errorf("query with limit error, entries: %s", models.JSONEncode(entries))
+	}
+	if entries = a.Query(0, "", "ns2", 0); len(entries) != 0 {
+		t.Errorf("query by namespace error, entries: %s", models.JSONEncode(entries))
+	}
+}
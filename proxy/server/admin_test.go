@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGetCapturePath(t *testing.T) {
+	dir := "/data/gaea/capture"
+	tests := []struct {
+		dir    string
+		name   string
+		expect string
+		hasErr bool
+	}{
+		{dir, "capture.log", filepath.Join(dir, "capture.log"), false},
+		{dir, "ns1/capture.log", filepath.Join(dir, "ns1", "capture.log"), false},
+		{dir, "./capture.log", filepath.Join(dir, "capture.log"), false},
+		{dir, "", "", true},
+		{dir, ".", "", true},
+		{dir, "/etc/passwd", "", true},
+		{dir, "../gaea.ini", "", true},
+		{dir, "ns1/../../gaea.ini", "", true},
+		{dir, "ns1/..", "", true},
+		{"", "capture.log", "", true},
+	}
+	for _, test := range tests {
+		path, err := getCapturePath(test.dir, test.name)
+		if (err != nil) != test.hasErr {
+			t.Errorf("capture path error not match, dir: %s, name: %s, expect error: %v, err: %v", test.dir, test.name, test.hasErr, err)
+			continue
+		}
+		if path != test.expect {
+			t.Errorf("capture path not match, dir: %s, name: %s, expect: %s, actual: %s", test.dir, test.name, test.expect, path)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// ArchiveStatus archive cutoff of shard rule, returned by admin api
+type ArchiveStatus struct {
+	DB     string `json:"db"`
+	Table  string `json:"table"`
+	Cutoff int    `json:"cutoff"` // 小于该下标的分表已归档, 0表示不归档
+}
+
+// GetArchiveStatus return runtime archive cutoffs of archived shard rules in namespace
+func (m *Manager) GetArchiveStatus(namespace string) ([]ArchiveStatus, error) {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+	ret := make([]ArchiveStatus, 0)
+	for _, rule := range ns.GetRouter().GetRules() {
+		if r, ok := rule.(*router.ArchivedRule); ok {
+			ret = append(ret, ArchiveStatus{DB: r.GetDB(), Table: r.GetTable(), Cutoff: r.GetCutoff()})
+		}
+	}
+	return ret, nil
+}
+
+// SetArchiveCutoff move archive cutoff of shard rule at runtime, empty cutoff means no sub table is archived.
+// the change is not persisted, and is overwritten by archive_cutoff in config when namespace is reloaded
+func (m *Manager) SetArchiveCutoff(namespace, db, table, cutoff string) error {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", namespace)
+	}
+	rule, ok := ns.GetRouter().GetShardRule(db, table)
+	if !ok {
+		return fmt.Errorf("shard rule not found: %s.%s", db, table)
+	}
+	r, ok := rule.(*router.ArchivedRule)
+	if !ok {
+		return fmt.Errorf("shard rule %s.%s is not archived", db, table)
+	}
+	return r.SetCutoff(cutoff)
+}
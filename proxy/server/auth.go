@@ -6,19 +6,53 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
-	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"github.com/XiaoMi/Gaea/mysql"
+	"net"
 	"sync"
 )
 
 var ErrAccessDenied = errors.New("access denied")
-var tlsConfig tls.Config
+
+// cachingSha2RSAKeySize 与MySQL自动生成的RSA密钥长度一致
+const cachingSha2RSAKeySize = 2048
+
+// cachingSha2RSAKey caching_sha2_password完整认证使用的RSA密钥, 第一次完整认证时生成, 进程内共享
+var cachingSha2RSAKey struct {
+	once   sync.Once
+	key    *rsa.PrivateKey
+	pemKey []byte // PEM格式的公钥, 发送给客户端
+	err    error
+}
+
+func getCachingSha2RSAKey() (*rsa.PrivateKey, []byte, error) {
+	cachingSha2RSAKey.once.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, cachingSha2RSAKeySize)
+		if err != nil {
+			cachingSha2RSAKey.err = fmt.Errorf("generate rsa key failed: %v", err)
+			return
+		}
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			cachingSha2RSAKey.err = fmt.Errorf("marshal rsa public key failed: %v", err)
+			return
+		}
+		cachingSha2RSAKey.key = key
+		cachingSha2RSAKey.pemKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	})
+	return cachingSha2RSAKey.key, cachingSha2RSAKey.pemKey, cachingSha2RSAKey.err
+}
 
 var ShaPasswordCache = &sync.Map{}
 
 func (c *Session) auth(authInfo HandshakeResponseInfo, password string) error {
+	if c.c.mariadbCompat {
+		return c.mariadbAuth(authInfo, password)
+	}
+
 	//尝试交换
 	if authInfo.AuthPlugin != mysql.AUTH_CACHING_SHA2_PASSWORD && authInfo.ClientPluginAuth {
 		if err := c.c.WriteAuthSwitchRequest(mysql.AUTH_CACHING_SHA2_PASSWORD); err != nil {
@@ -57,6 +91,111 @@ func (c *Session) auth(authInfo HandshakeResponseInfo, password string) error {
 	}
 }
 
+// mariadbAuth mariadb兼容模式下默认使用mysql_native_password, 支持client_ed25519, 其他插件统一切换到mysql_native_password
+func (c *Session) mariadbAuth(authInfo HandshakeResponseInfo, password string) error {
+	switch authInfo.AuthPlugin {
+	case mysql.AUTH_NATIVE_PASSWORD:
+		return c.compareNativePasswordAuthData(authInfo.AuthResponse, password)
+
+	case mysql.AUTH_CLIENT_ED25519:
+		// client_ed25519 签名需要32字节的nonce, 与握手包中的20字节salt不同, 需要重新发送
+		nonce, _ := mysql.RandomBuf(32)
+		if err := c.c.writeAuthSwitchRequestWithData(mysql.AUTH_CLIENT_ED25519, nonce); err != nil {
+			return err
+		}
+		authData, err := c.readAuthSwitchRequestResponse()
+		if err != nil {
+			return err
+		}
+		if !mysql.VerifyEd25519Password(nonce, []byte(password), authData) {
+			return ErrAccessDenied
+		}
+		return nil
+
+	default:
+		if !authInfo.ClientPluginAuth {
+			return c.compareNativePasswordAuthData(authInfo.AuthResponse, password)
+		}
+		if err := c.c.WriteAuthSwitchRequest(mysql.AUTH_NATIVE_PASSWORD); err != nil {
+			return err
+		}
+		authInfo.AuthPlugin = mysql.AUTH_NATIVE_PASSWORD
+		return c.handleAuthSwitchResponse(authInfo, password)
+	}
+}
+
+// authAccount 按用户来源返回的账号选择校验方式
+func (c *Session) authAccount(authInfo HandshakeResponseInfo, account *UserAccount, provider UserProvider, host string) error {
+	switch {
+	case account.ClearPassword:
+		return c.authClearPassword(authInfo, provider, host)
+	case len(account.PasswordHash) != 0:
+		return c.authNativePasswordHash(authInfo, account.PasswordHash)
+	default:
+		return c.auth(authInfo, account.Password)
+	}
+}
+
+// authNativePasswordHash 只有密码hash时只能使用mysql_native_password校验, 其他插件切换到mysql_native_password
+func (c *Session) authNativePasswordHash(authInfo HandshakeResponseInfo, hash []byte) error {
+	authData := authInfo.AuthResponse
+	if authInfo.AuthPlugin != mysql.AUTH_NATIVE_PASSWORD && authInfo.ClientPluginAuth {
+		if err := c.c.WriteAuthSwitchRequest(mysql.AUTH_NATIVE_PASSWORD); err != nil {
+			return err
+		}
+		var err error
+		if authData, err = c.readAuthSwitchRequestResponse(); err != nil {
+			return err
+		}
+	}
+	if !verifyNativePasswordHash(c.c.salt, hash, authData) {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
+// verifyNativePasswordHash scramble = SHA1(password) XOR SHA1(salt + SHA1(SHA1(password)))
+func verifyNativePasswordHash(salt, hash, scramble []byte) bool {
+	if len(scramble) != sha1.Size {
+		return false
+	}
+	crypt := sha1.New()
+	crypt.Write(salt)
+	crypt.Write(hash)
+	stage1 := crypt.Sum(nil)
+	for i := range stage1 {
+		stage1[i] ^= scramble[i]
+	}
+	crypt.Reset()
+	crypt.Write(stage1)
+	return bytes.Equal(crypt.Sum(nil), hash)
+}
+
+// authClearPassword 客户端通过mysql_clear_password发送明文密码, 由用户来源校验, 用于LDAP等身份系统
+func (c *Session) authClearPassword(authInfo HandshakeResponseInfo, provider UserProvider, host string) error {
+	if !authInfo.ClientPluginAuth {
+		return fmt.Errorf("client does not support authentication plugin %s", mysql.AUTH_CLEAR_PASSWORD)
+	}
+	if err := c.c.writeAuthSwitchRequestWithData(mysql.AUTH_CLEAR_PASSWORD, nil); err != nil {
+		return err
+	}
+	authData, err := c.readAuthSwitchRequestResponse()
+	if err != nil {
+		return err
+	}
+	if l := len(authData); l != 0 && authData[l-1] == 0x00 {
+		authData = authData[:l-1]
+	}
+	ok, err := provider.VerifyPassword(authInfo.User, host, string(authData))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrAccessDenied
+	}
+	return nil
+}
+
 func scrambleValidation(cached, nonce, scramble []byte) bool {
 	// SHA256(SHA256(SHA256(STORED_PASSWORD)), NONCE)
 	crypt := sha256.New()
@@ -143,9 +282,12 @@ func (c *Session) compareCacheSha2PasswordAuthData(clientAuthData []byte, passwo
 		// 'fast' auth: write "More data" packet (first byte == 0x01) with the second byte = 0x03
 		return c.c.WriteAuthMoreDataFastAuth()
 	}
-	return ErrAccessDenied
-
-	//return c.fastShaCacheAuth(clientAuthData, handshakeInfo)
+	// 与MySQL一致, 快速认证失败时要求客户端进行完整认证, 由调用方读取客户端发送的密码
+	if err := c.c.WriteAuthMoreDataFullAuth(); err != nil {
+		return err
+	}
+	c.cachingSha2FullAuth = true
+	return nil
 }
 
 //https://dev.mysql.com/doc/dev/mysql-server/latest/page_caching_sha2_authentication_exchanges.html
@@ -232,24 +374,39 @@ func (c *Session) handleAuthSwitchResponse(info HandshakeResponseInfo, password
 	}
 }
 
+// handleCachingSha2PasswordFullAuth caching_sha2_password完整认证, unix socket连接上客户端发送明文密码,
+// 其他连接上客户端请求公钥(0x02)后发送RSA加密的密码, 客户端已有公钥时直接发送加密的密码
 func (c *Session) handleCachingSha2PasswordFullAuth(authData []byte, password string) error {
+	if isSecureTransport(c.c.RemoteAddr()) {
+		// deal with the trailing \NUL added for plain text password received
+		if l := len(authData); l != 0 && authData[l-1] == 0x00 {
+			authData = authData[:l-1]
+		}
+		if !bytes.Equal(authData, []byte(password)) {
+			return ErrAccessDenied
+		}
+		return nil
+	}
 
+	key, pemKey, err := getCachingSha2RSAKey()
+	if err != nil {
+		return err
+	}
 	if len(authData) == 1 && authData[0] == 0x02 {
 		// send the public key
-		if err := c.c.WriteAuthMoreDataFullAuth(); err != nil {
+		if err := c.c.writeAuthMoreDataPublicKey(pemKey); err != nil {
 			return err
 		}
 		// read the encrypted password
-		var err error
 		if authData, err = c.readAuthSwitchRequestResponse(); err != nil {
 			return err
 		}
 	}
 	// the encrypted password
 	// decrypt
-	dbytes, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, (tlsConfig.Certificates[0].PrivateKey).(*rsa.PrivateKey), authData, nil)
+	dbytes, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, key, authData, nil)
 	if err != nil {
-		return err
+		return ErrAccessDenied
 	}
 	plain := make([]byte, len(password)+1)
 	copy(plain, password)
@@ -263,6 +420,11 @@ func (c *Session) handleCachingSha2PasswordFullAuth(authData []byte, password st
 	return ErrAccessDenied
 }
 
+// isSecureTransport 连接是否可以传输明文密码, 前端不支持TLS, 只有unix socket连接
+func isSecureTransport(addr net.Addr) bool {
+	return addr != nil && addr.Network() == "unix"
+}
+
 func (c *Session) writeCachingSha2Cache(user string, password string) {
 	// write cache
 	if password == "" {
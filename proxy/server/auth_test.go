@@ -0,0 +1,268 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func newMariaDBTestSession(t *testing.T) (*Session, *mysql.Conn) {
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() {
+		serverSide.Close()
+		clientSide.Close()
+	})
+	s := &Session{c: NewClientConn(mysql.NewConn(serverSide), nil)}
+	s.c.mariadbCompat = true
+	return s, mysql.NewConn(clientSide)
+}
+
+func TestMariaDBInitialHandshake(t *testing.T) {
+	s, client := newMariaDBTestSession(t)
+	go s.c.writeInitialHandshake()
+
+	data, err := client.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := 1
+	version, pos, _ := mysql.ReadNullString(data, pos)
+	if version != mysql.MariaDBServerVersion {
+		t.Errorf("server version not match, got: %s", version)
+	}
+	// connection id, salt part1, filler
+	pos += 4 + 8 + 1
+	capabilityLower, _, _ := mysql.ReadUint16(data, pos)
+	if uint32(capabilityLower)&mysql.ClientLongPassword != 0 {
+		t.Errorf("CLIENT_MYSQL should not be set in mariadb compatibility mode")
+	}
+	if !bytes.HasSuffix(data, append([]byte(mysql.AUTH_NATIVE_PASSWORD), 0)) {
+		t.Errorf("default auth plugin should be %s", mysql.AUTH_NATIVE_PASSWORD)
+	}
+}
+
+func TestMariaDBEd25519Auth(t *testing.T) {
+	tests := []struct {
+		password  string
+		input     string
+		expectErr error
+	}{
+		{"root", "root", nil},
+		{"root", "wrong", ErrAccessDenied},
+	}
+	for _, test := range tests {
+		s, client := newMariaDBTestSession(t)
+		info := HandshakeResponseInfo{AuthPlugin: mysql.AUTH_CLIENT_ED25519, ClientPluginAuth: true}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- s.auth(info, test.password)
+		}()
+
+		data, err := client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := append([]byte{mysql.AuthSwitchHeader}, append([]byte(mysql.AUTH_CLIENT_ED25519), 0)...)
+		if !bytes.HasPrefix(data, prefix) {
+			t.Fatalf("expect auth switch request to %s, got: %v", mysql.AUTH_CLIENT_ED25519, data)
+		}
+		nonce := data[len(prefix) : len(data)-1]
+		if len(nonce) != 32 {
+			t.Fatalf("nonce length should be 32, got: %d", len(nonce))
+		}
+		if err := client.WritePacket(mysql.CalcEd25519Password(nonce, []byte(test.input))); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errCh; err != test.expectErr {
+			t.Errorf("auth error not match, password: %s, input: %s, got: %v", test.password, test.input, err)
+		}
+	}
+}
+
+func TestMariaDBAuthSwitchToNative(t *testing.T) {
+	s, client := newMariaDBTestSession(t)
+	info := HandshakeResponseInfo{AuthPlugin: "dialog", ClientPluginAuth: true}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.auth(info, "root")
+	}()
+
+	data, err := client.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := append([]byte{mysql.AuthSwitchHeader}, append([]byte(mysql.AUTH_NATIVE_PASSWORD), 0)...)
+	if !bytes.HasPrefix(data, prefix) {
+		t.Fatalf("expect auth switch request to %s, got: %v", mysql.AUTH_NATIVE_PASSWORD, data)
+	}
+	if err := client.WritePacket(mysql.CalcPassword(s.c.salt, []byte("root"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("auth failed: %v", err)
+	}
+}
+
+func newCachingSha2TestSession(t *testing.T) (*Session, *mysql.Conn) {
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() {
+		serverSide.Close()
+		clientSide.Close()
+	})
+	return &Session{c: NewClientConn(mysql.NewConn(serverSide), nil)}, mysql.NewConn(clientSide)
+}
+
+func TestCachingSha2FastAuth(t *testing.T) {
+	s, client := newCachingSha2TestSession(t)
+	info := HandshakeResponseInfo{
+		AuthPlugin:       mysql.AUTH_CACHING_SHA2_PASSWORD,
+		ClientPluginAuth: true,
+		AuthResponse:     mysql.CalcCachingSha2Password(s.c.salt, "root"),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.auth(info, "root")
+	}()
+
+	data, err := client.ReadPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{mysql.MoreDataHeader, mysql.CacheSha2FastAuth}) {
+		t.Fatalf("expect fast auth packet, got: %v", data)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("auth failed: %v", err)
+	}
+}
+
+func TestCachingSha2FullAuthWithPublicKey(t *testing.T) {
+	tests := []struct {
+		password  string
+		input     string
+		expectErr error
+	}{
+		{"root", "root", nil},
+		{"root", "wrong", ErrAccessDenied},
+	}
+	for _, test := range tests {
+		s, client := newCachingSha2TestSession(t)
+		// 快速认证失败后进行完整认证
+		info := HandshakeResponseInfo{
+			AuthPlugin:       mysql.AUTH_CACHING_SHA2_PASSWORD,
+			ClientPluginAuth: true,
+			AuthResponse:     mysql.CalcCachingSha2Password(s.c.salt, "stale"),
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- s.auth(info, test.password)
+		}()
+
+		data, err := client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, []byte{mysql.MoreDataHeader, mysql.CacheSha2FullAuth}) {
+			t.Fatalf("expect full auth packet, got: %v", data)
+		}
+		// request public key
+		if err := client.WritePacket([]byte{0x02}); err != nil {
+			t.Fatal(err)
+		}
+		data, err = client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) == 0 || data[0] != mysql.MoreDataHeader {
+			t.Fatalf("expect public key packet, got: %v", data)
+		}
+		block, _ := pem.Decode(data[1:])
+		if block == nil {
+			t.Fatalf("decode public key failed: %s", data[1:])
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain := append([]byte(test.input), 0)
+		for i := range plain {
+			plain[i] ^= s.c.salt[i%len(s.c.salt)]
+		}
+		encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub.(*rsa.PublicKey), plain, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.WritePacket(encrypted); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errCh; err != test.expectErr {
+			t.Errorf("auth error not match, password: %s, input: %s, got: %v", test.password, test.input, err)
+		}
+	}
+}
+
+func TestCachingSha2FullAuthEncryptedPassword(t *testing.T) {
+	s, client := newCachingSha2TestSession(t)
+	info := HandshakeResponseInfo{
+		AuthPlugin:       mysql.AUTH_CACHING_SHA2_PASSWORD,
+		ClientPluginAuth: true,
+		AuthResponse:     mysql.CalcCachingSha2Password(s.c.salt, "stale"),
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.auth(info, "root")
+	}()
+
+	if _, err := client.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+	// 客户端已有公钥, 直接发送加密的密码
+	key, _, err := getCachingSha2RSAKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte("root\x00")
+	for i := range plain {
+		plain[i] ^= s.c.salt[i%len(s.c.salt)]
+	}
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, plain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WritePacket(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err != nil {
+		t.Errorf("auth failed: %v", err)
+	}
+}
+
+func TestIsSecureTransport(t *testing.T) {
+	if !isSecureTransport(&net.UnixAddr{Name: "/tmp/gaea.sock", Net: "unix"}) {
+		t.Errorf("unix socket should be secure transport")
+	}
+	if isSecureTransport(&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 13306}) {
+		t.Errorf("tcp should not be secure transport")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// handleChangeUser COM_CHANGE_USER, 连接池复用连接前切换用户并重置会话状态.
+// 与MySQL一致, 切换失败时返回错误后关闭连接, 原会话状态不变. 返回true表示写出响应后关闭会话
+func (cc *Session) handleChangeUser(data []byte) (Response, bool) {
+	info, err := cc.c.readChangeUser(data)
+	if err != nil {
+		logging.DefaultLogger.Warnf("[server] Session read change user error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+		return CreateErrorResponse(cc.executor.sessionStatus(), mysql.NewDefaultError(mysql.ErrMalformedPacket)), true
+	}
+	// 老版本客户端不发送字符集, 沿用当前的字符集
+	if info.CollationID == 0 {
+		info.CollationID = cc.executor.GetCollationID()
+	}
+	charset, err := collationCharset(info.CollationID)
+	if err != nil {
+		return CreateErrorResponse(cc.executor.sessionStatus(), err), true
+	}
+
+	account, err := cc.authenticate(info)
+	if err != nil {
+		logging.DefaultLogger.Warnf("[server] Session change user error, connId: %d, user: %s, err: %v", cc.c.GetConnectionID(), info.User, err)
+		return CreateErrorResponse(cc.executor.sessionStatus(), err), true
+	}
+	if err := cc.switchConnLimitUser(info.User); err != nil {
+		logging.DefaultLogger.Warnf("[server] Session change user rejected by connection limit, connId: %d, user: %s, err: %v", cc.c.GetConnectionID(), info.User, err)
+		return CreateErrorResponse(cc.executor.sessionStatus(), err), true
+	}
+
+	prevNamespace, prevState := cc.namespace, cc.sessionState()
+	cc.resetExecutor()
+	cc.setupSession(info, account, charset)
+	if info.Attributes != nil {
+		cc.c.attributes = info.Attributes
+	}
+	if prevNamespace != cc.namespace {
+		cc.manager.GetStatisticManager().DescSessionCount(prevNamespace)
+		cc.manager.GetStatisticManager().IncrSessionCount(cc.namespace)
+	}
+	if hasSessionHooks() {
+		fireSessionHooks(cc.newSessionEvent(SessionChangeUser, prevState, cc.sessionState()))
+	}
+
+	if cc.connInfo != nil {
+		if err := cc.interceptAuthenticated(); err != nil {
+			logging.DefaultLogger.Warnf("[server] Session rejected by conn interceptor after change user, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+			return CreateErrorResponse(cc.executor.sessionStatus(), err), true
+		}
+	}
+	return CreateOKResponse(cc.executor.sessionStatus()), false
+}
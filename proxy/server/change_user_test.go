@@ -0,0 +1,164 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/stats"
+)
+
+func encodeChangeUser(user string, auth []byte, db string, collationID mysql.CollationID, plugin string, attrs map[string]string) []byte {
+	var data []byte
+	data = append(data, user...)
+	data = append(data, 0)
+	data = append(data, byte(len(auth)))
+	data = append(data, auth...)
+	data = append(data, db...)
+	data = append(data, 0)
+	data = append(data, byte(collationID), byte(collationID>>8))
+	data = append(data, plugin...)
+	data = append(data, 0)
+	if attrs != nil {
+		var kv []byte
+		for k, v := range attrs {
+			kv = mysql.AppendLenEncInt(kv, uint64(len(k)))
+			kv = append(kv, k...)
+			kv = mysql.AppendLenEncInt(kv, uint64(len(v)))
+			kv = append(kv, v...)
+		}
+		data = mysql.AppendLenEncInt(data, uint64(len(kv)))
+		data = append(data, kv...)
+	}
+	return data
+}
+
+func TestReadChangeUser(t *testing.T) {
+	cc := NewClientConn(nil, nil)
+	cc.capability = mysql.ClientProtocol41 | mysql.ClientSecureConnection | mysql.ClientPluginAuth |
+		mysql.ClientPluginAuthLenencClientData | mysql.ClientConnectAtts
+	auth := mysql.CalcPassword(cc.salt, []byte("root"))
+	data := encodeChangeUser("root", auth, "db", 45, mysql.AUTH_NATIVE_PASSWORD, map[string]string{"program_name": "app"})
+
+	info, err := cc.readChangeUser(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "root" || !bytes.Equal(info.AuthResponse, auth) || info.Database != "db" || info.CollationID != 45 ||
+		info.AuthPlugin != mysql.AUTH_NATIVE_PASSWORD || !info.ClientPluginAuth || info.Attributes["program_name"] != "app" {
+		t.Errorf("unexpected change user info: %+v", info)
+	}
+
+	// 老版本客户端只发送用户名, 认证数据和数据库
+	cc.capability = mysql.ClientProtocol41 | mysql.ClientSecureConnection
+	info, err = cc.readChangeUser(append([]byte("root\x00\x00db"), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "root" || len(info.AuthResponse) != 0 || info.Database != "db" || info.CollationID != 0 || info.AuthPlugin != mysql.AUTH_NATIVE_PASSWORD {
+		t.Errorf("unexpected change user info: %+v", info)
+	}
+
+	if _, err := cc.readChangeUser([]byte("root\x00\x14")); err == nil {
+		t.Error("expect error when auth response is truncated")
+	}
+}
+
+type accountsProvider map[string]*UserAccount
+
+func (p accountsProvider) LookupUser(user, host string) (*UserAccount, error) {
+	return p[user], nil
+}
+
+func (p accountsProvider) VerifyPassword(user, host, password string) (bool, error) {
+	return false, errPasswordVerifyUnsupported
+}
+
+func TestHandleChangeUser(t *testing.T) {
+	m := NewManager()
+	m.statistics = &StatisticManager{
+		clusterName:    "gaea_cluster",
+		sessionCounts:  stats.NewGaugesWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace}),
+		userConnCounts: stats.NewGaugesWithMultiLabels("", "", []string{statsLabelCluster, statsLabelUser}),
+	}
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+	provider := accountsProvider{
+		"a":      {Namespace: "ns1", Password: "pa"},
+		"b":      {Namespace: "ns2", Password: "pb"},
+		"locked": {Namespace: "ns1", Locked: true},
+	}
+	cc := newSession(&Server{manager: m, userProvider: provider}, serverSide)
+	cc.c.capability = mysql.ClientProtocol41 | mysql.ClientSecureConnection
+	cc.setupSession(HandshakeResponseInfo{User: "a", Database: "db_ks", CollationID: 33}, provider["a"], "utf8")
+	m.GetStatisticManager().IncrSessionCount(cc.namespace)
+	cc.executor.userVariables["v"] = int64(1)
+	old := cc.executor
+
+	var events []*SessionEvent
+	RegisterSessionHook("test_change_user", func(event *SessionEvent) {
+		events = append(events, event)
+	})
+	defer UnregisterSessionHook("test_change_user")
+
+	tests := []struct {
+		user     string
+		password string
+		errCode  uint16
+	}{
+		{"b", "wrong", mysql.ErrAccessDenied},
+		{"unknown", "pb", mysql.ErrAccessDenied},
+		{"locked", "", mysql.ErrAccountHasBeenLocked},
+	}
+	for _, test := range tests {
+		data := encodeChangeUser(test.user, mysql.CalcPassword(cc.c.salt, []byte(test.password)), "db_mycat", 0, "", nil)
+		rs, closeAfterWrite := cc.handleChangeUser(data)
+		sqlErr, ok := rs.Data.(*mysql.SQLError)
+		if rs.RespType != RespError || !ok || sqlErr.SQLCode() != test.errCode {
+			t.Errorf("expect error %d, user: %s, response: %+v", test.errCode, test.user, rs)
+		}
+		// 认证失败时关闭连接, 关闭前会话状态不变
+		if !closeAfterWrite {
+			t.Errorf("connection should be closed after change user failed, user: %s", test.user)
+		}
+		if cc.executor != old || cc.executor.user != "a" || cc.executor.GetDatabase() != "db_ks" {
+			t.Errorf("session should not be changed, user: %s, db: %s", cc.executor.user, cc.executor.GetDatabase())
+		}
+	}
+
+	data := encodeChangeUser("b", mysql.CalcPassword(cc.c.salt, []byte("pb")), "db_mycat", 0, "", nil)
+	rs, closeAfterWrite := cc.handleChangeUser(data)
+	if rs.RespType != RespOK || closeAfterWrite {
+		t.Fatalf("change user failed, response: %+v", rs)
+	}
+	se := cc.executor
+	if se == old || se.user != "b" || se.GetDatabase() != "db_mycat" || se.namespace != "ns2" ||
+		se.GetCollationID() != 33 || se.GetCharset() != "utf8" || len(se.userVariables) != 0 || se.connID != old.connID {
+		t.Errorf("session not reset, user: %s, db: %s, collation: %d, user variables: %v", se.user, se.GetDatabase(), se.GetCollationID(), se.userVariables)
+	}
+	if cc.connLimitUser != "b" {
+		t.Errorf("connection limit user not changed: %s", cc.connLimitUser)
+	}
+	if counts := m.statistics.sessionCounts.Counts(); counts["gaea_cluster.ns1"] != 0 || counts["gaea_cluster.ns2"] != 1 {
+		t.Errorf("session counts not moved to new namespace: %v", counts)
+	}
+	if len(events) != 1 || events[0].Type != SessionChangeUser || events[0].User != "b" {
+		t.Errorf("expect one change user event, got: %v", events)
+	}
+}
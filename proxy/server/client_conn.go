@@ -17,6 +17,8 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"strings"
+
 	"github.com/XiaoMi/Gaea/logging"
 
 	"github.com/XiaoMi/Gaea/mysql"
@@ -33,6 +35,13 @@ type ClientConn struct {
 	manager *Manager
 
 	namespace string // TODO: remove it when refactor is done
+
+	mariadbCompat bool
+
+	attributes map[string]string // 握手时客户端发送的连接属性
+	capability uint32            // 握手时客户端声明的capability flags, 解析COM_CHANGE_USER时使用
+
+	compressCapability uint32 // 握手时声明支持的压缩协议, CLIENT_COMPRESS和CLIENT_ZSTD_COMPRESSION_ALGORITHM
 }
 
 // HandshakeResponseInfo handshake response information
@@ -44,6 +53,9 @@ type HandshakeResponseInfo struct {
 	Database         string
 	AuthPlugin       string
 	ClientPluginAuth bool
+	Compression      mysql.CompressionAlgorithm // 协商的压缩协议, 客户端同时请求zlib和zstd时使用zlib
+	ZstdLevel        int                        // 客户端请求的zstd压缩级别
+	Attributes       map[string]string          // 连接属性(CLIENT_CONNECT_ATTRS), 如_client_name、_pid、program_name
 }
 
 // NewClientConn constructor of ClientConn
@@ -63,8 +75,15 @@ func (cc *ClientConn) writeInitialHandshake() error {
 	//min version 10
 	data = append(data, mysql.ProtocolVersion)
 
+	capability, serverVersion, status, authPlugin := DefaultCapability, mysql.ServerVersion, uint16(0), mysql.AUTH_CACHING_SHA2_PASSWORD
+	if cc.mariadbCompat {
+		capability, serverVersion, status, authPlugin = MariaDBCapability, mysql.MariaDBServerVersion, initClientConnStatus, mysql.AUTH_NATIVE_PASSWORD
+	}
+	// 压缩协议由protocol_compression_algorithms配置
+	capability |= cc.compressCapability
+
 	//server version[00]
-	data = append(data, mysql.ServerVersion...)
+	data = append(data, serverVersion...)
 	data = append(data, 0x00)
 
 	//connection id
@@ -77,21 +96,22 @@ func (cc *ClientConn) writeInitialHandshake() error {
 	data = append(data, 0x00)
 
 	//capability flag lower 2 bytes, using default capability here
-	data = append(data, byte(DefaultCapability), byte(DefaultCapability>>8))
+	data = append(data, byte(capability), byte(capability>>8))
 
 	//charset
 	data = append(data, uint8(mysql.DefaultCollationID))
 
 	//status
-	data = append(data, byte(0), byte(0>>8))
+	data = append(data, byte(status), byte(status>>8))
 
 	//capability flag upper 2 bytes, using default capability here
-	data = append(data, byte(DefaultCapability>>16), byte(DefaultCapability>>24))
+	data = append(data, byte(capability>>16), byte(capability>>24))
 
 	// server supports CLIENT_PLUGIN_AUTH and CLIENT_SECURE_CONNECTION
 	data = append(data, byte(8+12+1))
 
-	//reserved 10 [00]
+	//reserved 10 [00], mariadb uses the last 4 bytes as extended capability, we advertise none of them,
+	//so mariadb clients use the same protocol as mysql clients
 	data = append(data, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
 
 	//auth-plugin-data-part-2
@@ -102,7 +122,7 @@ func (cc *ClientConn) writeInitialHandshake() error {
 	data = append(data, 0x00)
 
 	// auth plugin name
-	data = append(data, mysql.AUTH_CACHING_SHA2_PASSWORD...)
+	data = append(data, authPlugin...)
 
 	// EOF if MySQL version (>= 5.5.7 and < 5.5.10) or (>= 5.6.0 and < 5.6.2)
 	// \NUL otherwise, so we use \NUL
@@ -251,6 +271,7 @@ func (cc *ClientConn) readHandshakeResponse() (HandshakeResponseInfo, error) {
 	if capability&mysql.ClientProtocol41 == 0 {
 		return info, fmt.Errorf("readHandshakeResponse: only support protocol 4.1")
 	}
+	cc.capability = capability
 
 	// Max packet size. Don't do anything with this now.
 	_, pos, ok = mysql.ReadUint32(data, pos)
@@ -288,10 +309,133 @@ func (cc *ClientConn) readHandshakeResponse() (HandshakeResponseInfo, error) {
 		info.Database = db
 	}
 
-	info.AuthPlugin, _ = readPluginName(data, pos, capability)
+	info.AuthPlugin, pos = readPluginName(data, pos, capability)
+
+	if capability&mysql.ClientConnectAtts > 0 {
+		if capability&mysql.ClientPluginAuth > 0 {
+			pos++ // 插件名称结尾的0x00
+		}
+		info.Attributes, ok = readConnAttrs(data, pos)
+		if !ok {
+			return info, fmt.Errorf("readHandshakeResponse: can't read connection attributes")
+		}
+	}
+
+	// 只使用握手时声明过的压缩协议, zstd的压缩级别是握手响应的最后一个字节
+	switch compress := capability & cc.compressCapability; {
+	case compress&mysql.ClientCompress != 0:
+		info.Compression = mysql.CompressionZlib
+	case compress&mysql.ClientZstdCompressionAlgorithm != 0:
+		info.Compression = mysql.CompressionZstd
+		info.ZstdLevel = int(data[len(data)-1])
+	}
+	return info, nil
+}
+
+// parseCompressCapability 解析protocol_compression_algorithms(zlib,zstd,uncompressed, 逗号分隔), 返回握手时声明的压缩协议capability
+func parseCompressCapability(algorithms string) (uint32, error) {
+	var capability uint32
+	for _, name := range strings.Split(algorithms, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		algorithm, err := mysql.ParseCompressionAlgorithm(name)
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol_compression_algorithms: %v", err)
+		}
+		switch algorithm {
+		case mysql.CompressionZlib:
+			capability |= mysql.ClientCompress
+		case mysql.CompressionZstd:
+			capability |= mysql.ClientZstdCompressionAlgorithm
+		}
+	}
+	return capability, nil
+}
+
+// readChangeUser parse COM_CHANGE_USER packet without command byte, auth response is scrambled with salt of initial handshake
+// see: https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_change_user.html
+func (cc *ClientConn) readChangeUser(data []byte) (HandshakeResponseInfo, error) {
+	info := HandshakeResponseInfo{Salt: cc.salt, ClientPluginAuth: cc.capability&mysql.ClientPluginAuth != 0}
+
+	user, pos, ok := mysql.ReadNullString(data, 0)
+	if !ok {
+		return info, fmt.Errorf("readChangeUser: can't read username")
+	}
+	info.User = user
+
+	// 与握手响应不同, 即使声明了CLIENT_PLUGIN_AUTH_LENENC_CLIENT_DATA, 认证数据也是1字节长度加数据
+	if cc.capability&mysql.ClientSecureConnection != 0 {
+		authLen, p, ok := mysql.ReadByte(data, pos)
+		if !ok || len(data) < p+int(authLen) {
+			return info, fmt.Errorf("readChangeUser: can't read auth response")
+		}
+		info.AuthResponse = append([]byte(nil), data[p:p+int(authLen)]...)
+		pos = p + int(authLen)
+	} else {
+		var auth string
+		if auth, pos, ok = mysql.ReadNullString(data, pos); !ok {
+			return info, fmt.Errorf("readChangeUser: can't read auth response")
+		}
+		info.AuthResponse = []byte(auth)
+	}
+
+	if info.Database, pos, ok = mysql.ReadNullString(data, pos); !ok {
+		return info, fmt.Errorf("readChangeUser: can't read db")
+	}
+
+	// 以下字段都是可选的, 老版本客户端不发送
+	if pos+2 <= len(data) {
+		var collationID uint16
+		collationID, pos, _ = mysql.ReadUint16(data, pos)
+		info.CollationID = mysql.CollationID(collationID)
+	}
+	info.AuthPlugin = mysql.AUTH_NATIVE_PASSWORD
+	if info.ClientPluginAuth && pos < len(data) {
+		if info.AuthPlugin, pos, ok = mysql.ReadNullString(data, pos); !ok {
+			return info, fmt.Errorf("readChangeUser: can't read auth plugin")
+		}
+	}
+	if cc.capability&mysql.ClientConnectAtts != 0 {
+		if info.Attributes, ok = readConnAttrs(data, pos); !ok {
+			return info, fmt.Errorf("readChangeUser: can't read connection attributes")
+		}
+	}
 	return info, nil
 }
 
+// readConnAttrs 读取连接属性: 属性总长度(lenenc_int) + 多个键值对(lenenc_str), 客户端没有发送属性时返回nil
+func readConnAttrs(data []byte, pos int) (map[string]string, bool) {
+	if pos >= len(data) {
+		return nil, true
+	}
+	length, pos, _, ok := mysql.ReadLenEncInt(data, pos)
+	if !ok || uint64(len(data)-pos) < length {
+		return nil, false
+	}
+	end := pos + int(length)
+	attrs := make(map[string]string)
+	for pos < end {
+		key, p, _, ok := mysql.ReadLenEncStringAsBytes(data[:end], pos)
+		if !ok {
+			return nil, false
+		}
+		value, p, _, ok := mysql.ReadLenEncStringAsBytes(data[:end], p)
+		if !ok {
+			return nil, false
+		}
+		attrs[string(key)] = string(value)
+		pos = p
+	}
+	return attrs, true
+}
+
+// Attributes return connection attributes sent by client in handshake, such as _client_name, _pid and program_name,
+// nil if client doesn't send attributes. The returned map should not be modified.
+func (cc *ClientConn) Attributes() map[string]string {
+	return cc.attributes
+}
+
 func (cc *ClientConn) writeOK(status uint16) error {
 	err := cc.WriteOKPacket(0, 0, status, 0)
 	if err != nil {
@@ -317,13 +461,25 @@ func (cc *ClientConn) WriteAuthMoreDataFullAuth() error {
 	return cc.writeMoreDataFlag(mysql.CacheSha2FullAuth)
 }
 
+// writeAuthMoreDataPublicKey 回复客户端的公钥请求, caching_sha2_password完整认证时客户端用公钥加密密码
+func (cc *ClientConn) writeAuthMoreDataPublicKey(pemKey []byte) error {
+	data := cc.StartEphemeralPacket(1 + len(pemKey))
+	pos := mysql.WriteByte(data, 0, mysql.MoreDataHeader)
+	mysql.WriteBytes(data, pos, pemKey)
+	return cc.WriteEphemeralPacket()
+}
+
 func (cc *ClientConn) WriteAuthSwitchRequest(authMethod string) error {
-	l := 1 + len(authMethod) + 1 + len(cc.salt) + 1
+	return cc.writeAuthSwitchRequestWithData(authMethod, cc.salt)
+}
+
+func (cc *ClientConn) writeAuthSwitchRequestWithData(authMethod string, authData []byte) error {
+	l := 1 + len(authMethod) + 1 + len(authData) + 1
 	data := cc.StartEphemeralPacket(l)
 	pos := 0
 	pos = mysql.WriteByte(data, pos, mysql.AuthSwitchHeader)
 	pos = mysql.WriteNullString(data, pos, authMethod)
-	pos = mysql.WriteBytes(data, pos, cc.salt)
+	pos = mysql.WriteBytes(data, pos, authData)
 	mysql.WriteByte(data, pos, 0)
 	return cc.WriteEphemeralPacket()
 }
@@ -344,6 +500,37 @@ func (cc *ClientConn) writeEOFPacket(status uint16) error {
 	return nil
 }
 
+// deprecateEOF check if client negotiated CLIENT_DEPRECATE_EOF, 协商后列定义之后不再发送EOF包, 结果集以0xfe开头的OK包结束
+func (cc *ClientConn) deprecateEOF() bool {
+	return cc.capability&mysql.ClientDeprecateEOF != 0
+}
+
+// writeEndPacket write EOF packet at the end of resultset, or OK packet with EOF header if client negotiated CLIENT_DEPRECATE_EOF
+func (cc *ClientConn) writeEndPacket(status uint16) error {
+	if !cc.deprecateEOF() {
+		return cc.writeEOFPacket(status)
+	}
+	err := cc.WriteOKPacketWithEOFHeader(0, 0, status, 0)
+	if err != nil {
+		connLogger.Warnf("write ok packet with eof header failed, %v", err)
+		return err
+	}
+	return nil
+}
+
+// writeColumnDefinitions write column definitions of resultset or prepare response, followed by EOF packet if client doesn't negotiate CLIENT_DEPRECATE_EOF
+func (cc *ClientConn) writeColumnDefinitions(status uint16, fs []*mysql.Field) error {
+	for _, f := range fs {
+		if err := cc.writeColumnDefinition(f); err != nil {
+			return err
+		}
+	}
+	if cc.deprecateEOF() {
+		return nil
+	}
+	return cc.writeEOFPacket(status)
+}
+
 func (cc *ClientConn) writeErrorPacket(err error) error {
 	e := cc.WriteErrorPacketFromError(err)
 	if e != nil {
@@ -383,7 +570,7 @@ func (cc *ClientConn) writeResultset(status uint16, r *mysql.Resultset) error {
 	}
 
 	// write columns
-	err = cc.writeFieldList(status, r.Fields)
+	err = cc.writeColumnDefinitions(status, r.Fields)
 	if err != nil {
 		return err
 	}
@@ -397,7 +584,7 @@ func (cc *ClientConn) writeResultset(status uint16, r *mysql.Resultset) error {
 		}
 	}
 
-	err = cc.writeEOFPacket(status)
+	err = cc.writeEndPacket(status)
 	if err != nil {
 		return err
 	}
@@ -410,6 +597,37 @@ func (cc *ClientConn) writeResultset(status uint16, r *mysql.Resultset) error {
 	return nil
 }
 
+// https://dev.mysql.com/doc/internals/en/com-stmt-execute-response.html
+// 打开游标时只返回列信息, 行数据由COM_STMT_FETCH获取.
+// 列定义之后总是发送带SERVER_STATUS_CURSOR_EXISTS的结束包, 协商CLIENT_DEPRECATE_EOF时为0xfe开头的OK包
+func (cc *ClientConn) writeCursorResultset(status uint16, r *mysql.Resultset) error {
+	cc.StartWriterBuffering()
+
+	if err := cc.writeColumnCount(uint64(len(r.Fields))); err != nil {
+		return err
+	}
+	if err := cc.writeFieldList(status, r.Fields); err != nil {
+		return err
+	}
+	return cc.Flush()
+}
+
+// https://dev.mysql.com/doc/internals/en/com-stmt-fetch.html
+func (cc *ClientConn) writeFetchRows(status uint16, rows []mysql.RowData) error {
+	cc.StartWriterBuffering()
+
+	for _, row := range rows {
+		if err := cc.writeRow(row); err != nil {
+			return err
+		}
+	}
+	if err := cc.writeEndPacket(status); err != nil {
+		return err
+	}
+	return cc.Flush()
+}
+
+// writeFieldList write column definitions and end packet, used by COM_FIELD_LIST and cursor
 func (cc *ClientConn) writeFieldList(status uint16, fs []*mysql.Field) error {
 	var err error
 	for _, f := range fs {
@@ -419,7 +637,7 @@ func (cc *ClientConn) writeFieldList(status uint16, fs []*mysql.Field) error {
 		}
 	}
 
-	err = cc.writeEOFPacket(status)
+	err = cc.writeEndPacket(status)
 	return err
 }
 
@@ -527,6 +745,9 @@ func (cc *ClientConn) writePrepareResponse(status uint16, s *Stmt) error {
 				return err
 			}
 		}
+		if cc.deprecateEOF() {
+			return nil
+		}
 		err = cc.writeEOFPacket(status)
 		return err
 	}
@@ -538,6 +759,9 @@ func (cc *ClientConn) writePrepareResponse(status uint16, s *Stmt) error {
 				return err
 			}
 		}
+		if cc.deprecateEOF() {
+			return nil
+		}
 		err = cc.writeEOFPacket(status)
 		return err
 	}
@@ -0,0 +1,192 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/stats"
+)
+
+func appendConnAttrs(data []byte, kvs ...string) []byte {
+	var attrs []byte
+	for _, s := range kvs {
+		attrs = mysql.AppendLenEncStringBytes(attrs, []byte(s))
+	}
+	data = mysql.AppendLenEncInt(data, uint64(len(attrs)))
+	return append(data, attrs...)
+}
+
+func TestReadHandshakeResponseConnAttrs(t *testing.T) {
+	capability := mysql.ClientProtocol41 | mysql.ClientSecureConnection | mysql.ClientPluginAuth |
+		mysql.ClientPluginAuthLenencClientData | mysql.ClientConnectWithDB | mysql.ClientConnectAtts
+	data := mysql.AppendUint32(nil, capability)
+	data = mysql.AppendUint32(data, mysql.MaxPacketSize)
+	data = append(data, 33)
+	data = append(data, make([]byte, 23)...)
+	data = append(data, "root\x00"...)
+	data = mysql.AppendLenEncStringBytes(data, []byte{1, 2, 3})
+	data = append(data, "db1\x00"...)
+	data = append(data, mysql.AUTH_NATIVE_PASSWORD+"\x00"...)
+	data = appendConnAttrs(data, "_client_name", "libmysql", "_pid", "1234", "program_name", "order-service", "empty", "")
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+	cc := NewClientConn(mysql.NewConn(serverSide), nil)
+	go mysql.NewConn(clientSide).WritePacket(data)
+
+	info, err := cc.readHandshakeResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "root" || info.Database != "db1" || info.AuthPlugin != mysql.AUTH_NATIVE_PASSWORD {
+		t.Errorf("handshake response not match: %+v", info)
+	}
+	expect := map[string]string{"_client_name": "libmysql", "_pid": "1234", "program_name": "order-service", "empty": ""}
+	if !reflect.DeepEqual(info.Attributes, expect) {
+		t.Errorf("attributes not match, expect: %v, actual: %v", expect, info.Attributes)
+	}
+}
+
+func TestReadHandshakeResponseCompression(t *testing.T) {
+	tests := []struct {
+		server    string // protocol_compression_algorithms
+		client    uint32
+		expect    mysql.CompressionAlgorithm
+		zstdLevel int
+	}{
+		{"", mysql.ClientCompress, mysql.CompressionNone, 0},
+		{"zlib", mysql.ClientCompress, mysql.CompressionZlib, 0},
+		{"zlib", mysql.ClientZstdCompressionAlgorithm, mysql.CompressionNone, 0},
+		{"zstd", mysql.ClientZstdCompressionAlgorithm, mysql.CompressionZstd, 7},
+		{"zlib,zstd", mysql.ClientCompress | mysql.ClientZstdCompressionAlgorithm, mysql.CompressionZlib, 0},
+		{"zlib, zstd", 0, mysql.CompressionNone, 0},
+	}
+	for _, test := range tests {
+		capability := mysql.ClientProtocol41 | mysql.ClientSecureConnection | mysql.ClientPluginAuth | mysql.ClientConnectAtts | test.client
+		data := mysql.AppendUint32(nil, capability)
+		data = mysql.AppendUint32(data, mysql.MaxPacketSize)
+		data = append(data, 33)
+		data = append(data, make([]byte, 23)...)
+		data = append(data, "root\x00"...)
+		data = append(data, 3, 1, 2, 3)
+		data = append(data, mysql.AUTH_NATIVE_PASSWORD+"\x00"...)
+		data = appendConnAttrs(data, "_client_name", "libmysql")
+		if test.client&mysql.ClientZstdCompressionAlgorithm != 0 {
+			data = append(data, 7)
+		}
+
+		serverSide, clientSide := net.Pipe()
+		cc := NewClientConn(mysql.NewConn(serverSide), nil)
+		compressCapability, err := parseCompressCapability(test.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cc.compressCapability = compressCapability
+		go mysql.NewConn(clientSide).WritePacket(data)
+
+		info, err := cc.readHandshakeResponse()
+		serverSide.Close()
+		clientSide.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Compression != test.expect || info.ZstdLevel != test.zstdLevel || info.Attributes["_client_name"] != "libmysql" {
+			t.Errorf("compression not match, server: %s, client: %d, expect: %s, actual: %s, zstd level: %d", test.server, test.client, test.expect, info.Compression, info.ZstdLevel)
+		}
+	}
+
+	if _, err := parseCompressCapability("zlib,lz4"); err == nil {
+		t.Errorf("unknown compression algorithm should be rejected")
+	}
+}
+
+func TestReadConnAttrs(t *testing.T) {
+	attrs, ok := readConnAttrs(nil, 0)
+	if !ok || attrs != nil {
+		t.Errorf("attributes should be nil when client doesn't send them, attrs: %v, ok: %v", attrs, ok)
+	}
+
+	data := appendConnAttrs(nil, "program_name", "mysql")
+	if attrs, ok := readConnAttrs(data, 0); !ok || attrs["program_name"] != "mysql" {
+		t.Errorf("read attributes failed, attrs: %v, ok: %v", attrs, ok)
+	}
+	// 总长度超出包长度
+	if _, ok := readConnAttrs(data[:len(data)-1], 0); ok {
+		t.Error("expect error of truncated attributes")
+	}
+	// 缺少属性值
+	data = appendConnAttrs(nil, "program_name")
+	if _, ok := readConnAttrs(data, 0); ok {
+		t.Error("expect error of missing value")
+	}
+}
+
+func TestWriteResultsetDeprecateEOF(t *testing.T) {
+	m := NewManager()
+	m.statistics = &StatisticManager{
+		clusterName: "gaea_cluster",
+		flowCounts:  stats.NewCountersWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelFlowDirection}),
+	}
+	rs, err := mysql.BuildResultset(nil, []string{"id", "name"}, [][]interface{}{{1, "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 列数, 列定义, [EOF], 行数据, 结束包
+	tests := []struct {
+		capability uint32
+		packets    int
+		endLength  int
+	}{
+		{mysql.ClientProtocol41, 6, 5},
+		{mysql.ClientProtocol41 | mysql.ClientDeprecateEOF, 5, 7},
+	}
+	for _, test := range tests {
+		serverSide, clientSide := net.Pipe()
+		cc := NewClientConn(mysql.NewConn(serverSide), m)
+		cc.capability = test.capability
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- cc.writeResultset(mysql.ServerStatusAutocommit, rs)
+		}()
+
+		client := mysql.NewConn(clientSide)
+		var packets [][]byte
+		for len(packets) < test.packets {
+			data, err := client.ReadPacket()
+			if err != nil {
+				t.Fatal(err)
+			}
+			packets = append(packets, data)
+		}
+		if err := <-errCh; err != nil {
+			t.Fatal(err)
+		}
+		if packets[3][0] == mysql.EOFHeader != (test.capability&mysql.ClientDeprecateEOF == 0) {
+			t.Errorf("eof packet after column definitions not match, capability: %d, packet: %v", test.capability, packets[3])
+		}
+		end := packets[len(packets)-1]
+		if end[0] != mysql.EOFHeader || len(end) != test.endLength {
+			t.Errorf("end packet not match, capability: %d, packet: %v", test.capability, end)
+		}
+		serverSide.Close()
+		clientSide.Close()
+	}
+}
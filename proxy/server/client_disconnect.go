@@ -0,0 +1,96 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultClientCheckInterval 默认的客户端断开检测间隔
+const defaultClientCheckInterval = time.Second
+
+// disconnectWatcher 执行命令期间定期检查客户端连接是否已断开, 断开时调用onDisconnect中断后端查询.
+// 检查时只窥探socket而不读取数据, 不影响后续命令的读取; 命令在第一次检查前完成时不产生额外开销
+type disconnectWatcher struct {
+	rc           syscall.RawConn
+	interval     time.Duration
+	onDisconnect func()
+
+	mu           sync.Mutex
+	timer        *time.Timer
+	stopped      bool
+	disconnected bool
+}
+
+// newDisconnectWatcher return nil if the connection doesn't support disconnect detection
+func newDisconnectWatcher(c net.Conn, interval time.Duration, onDisconnect func()) *disconnectWatcher {
+	if interval <= 0 || !peekConnSupported {
+		return nil
+	}
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return &disconnectWatcher{rc: rc, interval: interval, onDisconnect: onDisconnect}
+}
+
+// start 开始检查, 每个命令执行前调用
+func (w *disconnectWatcher) start() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = false
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.interval, w.check)
+	} else {
+		w.timer.Reset(w.interval)
+	}
+}
+
+// stop 停止检查, 返回命令执行期间客户端是否已断开
+func (w *disconnectWatcher) stop() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	w.timer.Stop()
+	return w.disconnected
+}
+
+func (w *disconnectWatcher) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped || w.disconnected {
+		return
+	}
+	closed, err := peekConnClosed(w.rc)
+	if err != nil || !closed {
+		w.timer.Reset(w.interval)
+		return
+	}
+	w.disconnected = true
+	w.onDisconnect()
+}
@@ -0,0 +1,30 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// peekConnSupported 当前平台不支持窥探socket, 不检测客户端断开
+const peekConnSupported = false
+
+func peekConnClosed(rc syscall.RawConn) (bool, error) {
+	return false, errors.New("peek connection is not supported on this platform")
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func newTCPConnPair(t *testing.T) (server, client net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return server, client
+}
+
+func TestDisconnectWatcher(t *testing.T) {
+	if !peekConnSupported {
+		t.Skip("peek connection is not supported")
+	}
+	server, client := newTCPConnPair(t)
+
+	disconnected := make(chan struct{}, 1)
+	w := newDisconnectWatcher(server, 10*time.Millisecond, func() {
+		disconnected <- struct{}{}
+	})
+	if w == nil {
+		t.Fatal("watcher should be created for tcp connection")
+	}
+
+	// 客户端发送了数据但没有断开
+	if _, err := client.Write([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	w.start()
+	time.Sleep(50 * time.Millisecond)
+	if w.stop() {
+		t.Fatal("client should not be disconnected")
+	}
+	// 窥探不消费数据
+	buf := make([]byte, 1)
+	if _, err := server.Read(buf); err != nil || buf[0] != 1 {
+		t.Fatalf("data should not be consumed, data: %v, err: %v", buf, err)
+	}
+
+	w.start()
+	client.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("disconnect not detected")
+	}
+	if !w.stop() {
+		t.Error("stop should report disconnected")
+	}
+}
+
+func TestDisconnectWatcherDisabled(t *testing.T) {
+	server, _ := newTCPConnPair(t)
+	if w := newDisconnectWatcher(server, 0, func() {}); w != nil {
+		t.Error("watcher should be disabled when interval is 0")
+	}
+	pipe, _ := net.Pipe()
+	defer pipe.Close()
+	w := newDisconnectWatcher(pipe, time.Millisecond, func() {})
+	if w != nil {
+		t.Error("watcher should be nil for connection without file descriptor")
+	}
+	// nil watcher可以直接调用
+	w.start()
+	if w.stop() {
+		t.Error("nil watcher should not report disconnected")
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package server
+
+import (
+	"syscall"
+)
+
+const peekConnSupported = true
+
+// peekConnClosed 以MSG_PEEK|MSG_DONTWAIT窥探socket, 读到EOF或连接重置时认为客户端已断开, 不消费socket中的数据
+func peekConnClosed(rc syscall.RawConn) (bool, error) {
+	var n int
+	var peekErr error
+	buf := make([]byte, 1)
+	err := rc.Read(func(fd uintptr) bool {
+		n, _, peekErr = syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		// 返回true表示不等待socket可读
+		return true
+	})
+	if err != nil {
+		return false, err
+	}
+	switch peekErr {
+	case nil:
+		return n == 0, nil
+	case syscall.EAGAIN, syscall.EINTR:
+		return false, nil
+	case syscall.ECONNRESET, syscall.EPIPE, syscall.ENOTCONN:
+		return true, nil
+	default:
+		return false, peekErr
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+const defaultCommitHangThreshold = 5 * time.Second
+
+// 挂起的跨分片提交的处理方式, 两种方式都会中断正在提交的slice, 该slice的提交结果未知
+const (
+	CommitResolveCommit   = "commit"   // 继续提交其余slice
+	CommitResolveRollback = "rollback" // 回滚尚未提交的slice
+)
+
+// 跨分片提交的状态, 用于监控
+const (
+	commitStateCommitting = "committing"
+	commitStateHung       = "hung"
+)
+
+// CommitProgress progress of transaction committing on multiple slices, returned by admin api.
+// gaea依次在各slice提交, 部分slice已提交而其余slice未提交时事务处于不确定状态
+type CommitProgress struct {
+	ConnID     uint32   `json:"conn_id"`
+	Namespace  string   `json:"namespace"`
+	User       string   `json:"user"`
+	ClientAddr string   `json:"client_addr"`
+	DB         string   `json:"db"`
+	Slices     []string `json:"slices"`      // 按提交顺序
+	Committed  []string `json:"committed"`   // 已提交的slice
+	Failed     []string `json:"failed"`      // 提交失败或被中断的slice, 结果未知
+	RolledBack []string `json:"rolled_back"` // 按管理接口的要求回滚的slice
+	Current    string   `json:"current"`     // 正在提交的slice
+	Elapsed    int64    `json:"elapsed"`     // 单位: 毫秒, 开始提交至今的时间
+	Hung       bool     `json:"hung"`        // 超过commit_hang_threshold仍未完成
+	Resolution string   `json:"resolution"`  // 管理接口指定的处理方式, 为空时正常提交
+}
+
+// commitProgress 一次跨分片提交的进度, 提交的会话和管理接口并发访问
+type commitProgress struct {
+	connID     uint32
+	namespace  string
+	user       string
+	clientAddr string
+	db         string
+	start      time.Time
+	slices     []string
+
+	lock       sync.Mutex
+	current    int                   // 正在提交的slice下标
+	conn       backend.PooledConnect // 正在提交的连接, 管理接口中断提交时关闭
+	committed  []string
+	failed     []string
+	rolledBack []string
+	resolution string
+	reported   bool // 挂起已输出过日志
+}
+
+// begin 开始提交slice, 返回管理接口指定的处理方式
+func (p *commitProgress) begin(pc backend.PooledConnect) string {
+	if p == nil {
+		return ""
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.conn = pc
+	return p.resolution
+}
+
+// end 记录slice的提交结果
+func (p *commitProgress) end(rollback bool, err error) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	slice := p.slices[p.current]
+	switch {
+	case err != nil:
+		p.failed = append(p.failed, slice)
+	case rollback:
+		p.rolledBack = append(p.rolledBack, slice)
+	default:
+		p.committed = append(p.committed, slice)
+	}
+	p.conn = nil
+	p.current++
+}
+
+// partial 部分slice已提交, 其余slice失败或被回滚
+func (p *commitProgress) partial() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.committed) > 0 && len(p.failed)+len(p.rolledBack) > 0
+}
+
+func (p *commitProgress) snapshot(now time.Time, threshold time.Duration) CommitProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	s := CommitProgress{
+		ConnID:     p.connID,
+		Namespace:  p.namespace,
+		User:       p.user,
+		ClientAddr: p.clientAddr,
+		DB:         p.db,
+		Slices:     p.slices,
+		Committed:  append([]string{}, p.committed...),
+		Failed:     append([]string{}, p.failed...),
+		RolledBack: append([]string{}, p.rolledBack...),
+		Elapsed:    int64(now.Sub(p.start) / time.Millisecond),
+		Hung:       threshold > 0 && now.Sub(p.start) >= threshold,
+		Resolution: p.resolution,
+	}
+	if p.current < len(p.slices) {
+		s.Current = p.slices[p.current]
+	}
+	return s
+}
+
+// state SHOW PROCESSLIST中的State列
+func (s *CommitProgress) state() string {
+	if s.Hung {
+		return fmt.Sprintf("commit hung on %s, %d/%d slices committed", s.Current, len(s.Committed), len(s.Slices))
+	}
+	return fmt.Sprintf("committing on %s, %d/%d slices committed", s.Current, len(s.Committed), len(s.Slices))
+}
+
+// commitTracker 记录进行中的跨分片提交, 检测挂起的提交
+type commitTracker struct {
+	threshold time.Duration // 小于等于0时不检测挂起
+
+	lock    sync.Mutex
+	commits map[uint32]*commitProgress // key: 前端连接ID
+}
+
+func newCommitTracker(threshold time.Duration) *commitTracker {
+	return &commitTracker{
+		threshold: threshold,
+		commits:   make(map[uint32]*commitProgress),
+	}
+}
+
+// parseCommitHangThreshold 0使用默认值, -1关闭检测
+func parseCommitHangThreshold(cfg *models.Proxy) (time.Duration, error) {
+	switch {
+	case cfg.CommitHangThreshold == 0:
+		return defaultCommitHangThreshold, nil
+	case cfg.CommitHangThreshold == -1:
+		return 0, nil
+	case cfg.CommitHangThreshold < -1:
+		return 0, fmt.Errorf("invalid commit_hang_threshold: %d", cfg.CommitHangThreshold)
+	}
+	return time.Duration(cfg.CommitHangThreshold) * time.Millisecond, nil
+}
+
+func (t *commitTracker) start(se *SessionExecutor, slices []string) *commitProgress {
+	if t == nil {
+		return nil
+	}
+	p := &commitProgress{
+		connID:     se.connID,
+		namespace:  se.namespace,
+		user:       se.user,
+		clientAddr: se.clientAddr,
+		db:         se.db,
+		start:      time.Now(),
+		slices:     slices,
+	}
+	t.lock.Lock()
+	t.commits[p.connID] = p
+	t.lock.Unlock()
+	return p
+}
+
+func (t *commitTracker) finish(p *commitProgress) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	delete(t.commits, p.connID)
+	t.lock.Unlock()
+
+	s := p.snapshot(time.Now(), t.threshold)
+	if s.Hung || s.Resolution != "" {
+		logging.DefaultLogger.Warnf("[commit] slow commit finished, conn: %d, namespace: %s, elapsed: %dms, committed: %v, failed: %v, rolled back: %v, resolution: %s",
+			s.ConnID, s.Namespace, s.Elapsed, s.Committed, s.Failed, s.RolledBack, s.Resolution)
+	}
+}
+
+// list 返回进行中的跨分片提交, namespace为空时返回所有namespace的提交
+func (t *commitTracker) list(namespace string) []CommitProgress {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	commits := make([]*commitProgress, 0, len(t.commits))
+	for _, p := range t.commits {
+		if namespace == "" || p.namespace == namespace {
+			commits = append(commits, p)
+		}
+	}
+	t.lock.Unlock()
+
+	now := time.Now()
+	progress := make([]CommitProgress, 0, len(commits))
+	for _, p := range commits {
+		progress = append(progress, p.snapshot(now, t.threshold))
+	}
+	sort.Slice(progress, func(i, j int) bool {
+		return progress[i].ConnID < progress[j].ConnID
+	})
+	return progress
+}
+
+// resolve 处理挂起的提交: 中断正在提交的slice, 之后的slice按action提交或回滚
+func (t *commitTracker) resolve(connID uint32, action string) (CommitProgress, error) {
+	if action != CommitResolveCommit && action != CommitResolveRollback {
+		return CommitProgress{}, fmt.Errorf("invalid action, must be %s or %s", CommitResolveCommit, CommitResolveRollback)
+	}
+	t.lock.Lock()
+	p, ok := t.commits[connID]
+	t.lock.Unlock()
+	if !ok {
+		return CommitProgress{}, fmt.Errorf("no commit in progress of connection %d", connID)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if t.threshold <= 0 || time.Since(p.start) < t.threshold {
+		return CommitProgress{}, fmt.Errorf("commit of connection %d is not hung", connID)
+	}
+	if p.resolution != "" {
+		return CommitProgress{}, fmt.Errorf("commit of connection %d is already resolved by %s", connID, p.resolution)
+	}
+	p.resolution = action
+	if p.conn != nil {
+		// 被中断的连接已关闭, 回收时由连接池丢弃
+		p.conn.Abort()
+	}
+	logging.DefaultLogger.Warnf("[commit] resolve hung commit by %s, conn: %d, namespace: %s, committed: %v, interrupted: %s",
+		action, connID, p.namespace, p.committed, p.slices[p.current])
+	return CommitProgress{ConnID: connID, Namespace: p.namespace, Slices: p.slices, Current: p.slices[p.current], Resolution: action}, nil
+}
+
+// recordMetrics 记录各namespace进行中和挂起的跨分片提交数, 挂起的提交输出一次日志
+func (t *commitTracker) recordMetrics(s *StatisticManager, namespaces []string) {
+	if t == nil || s == nil {
+		return
+	}
+	counts := make(map[string][2]int64, len(namespaces))
+	for _, ns := range namespaces {
+		counts[ns] = [2]int64{}
+	}
+	for _, c := range t.list("") {
+		n := counts[c.Namespace]
+		n[0]++
+		if c.Hung {
+			n[1]++
+			t.reportHung(c)
+		}
+		counts[c.Namespace] = n
+	}
+	for ns, n := range counts {
+		s.RecordCommitProgress(ns, commitStateCommitting, n[0])
+		s.RecordCommitProgress(ns, commitStateHung, n[1])
+	}
+}
+
+func (t *commitTracker) reportHung(c CommitProgress) {
+	t.lock.Lock()
+	p, ok := t.commits[c.ConnID]
+	t.lock.Unlock()
+	if !ok {
+		return
+	}
+	p.lock.Lock()
+	reported := p.reported
+	p.reported = true
+	p.lock.Unlock()
+	if !reported {
+		logging.DefaultLogger.Warnf("[commit] commit hung, conn: %d, namespace: %s, user: %s, elapsed: %dms, current slice: %s, committed: %v",
+			c.ConnID, c.Namespace, c.User, c.Elapsed, c.Current, c.Committed)
+	}
+}
+
+// processListColumns SHOW PROCESSLIST的列数: Id, User, Host, db, Command, Time, State, Info
+const processListColumns = 8
+
+// appendCommitProgress 在后端SHOW PROCESSLIST的结果后追加本namespace进行中的跨分片提交,
+// Id为gaea的前端连接ID, State中是提交进度. SHOW FULL PROCESSLIST的列相同
+func (se *SessionExecutor) appendCommitProgress(r *mysql.Result) error {
+	if r == nil || r.Resultset == nil || len(r.Fields) != processListColumns {
+		return nil
+	}
+	commits := se.manager.getCommitTracker().list(se.namespace)
+	if len(commits) == 0 {
+		return nil
+	}
+	for i := range commits {
+		c := &commits[i]
+		var db interface{}
+		if c.DB != "" {
+			db = c.DB
+		}
+		r.Values = append(r.Values, []interface{}{
+			int64(c.ConnID), c.User, c.ClientAddr, db, "Query", c.Elapsed / 1000, c.state(), "COMMIT",
+		})
+	}
+	return plan.GenerateSelectResultRowData(r)
+}
+
+// commitSlices 按slice名称依次提交跨分片事务并记录进度, 提交挂起时可以通过管理接口中断.
+// 与单分片提交一致, 某个slice提交失败时仍继续提交其余slice
+func (se *SessionExecutor) commitSlices() (err error) {
+	slices := make([]string, 0, len(se.txConns))
+	for slice := range se.txConns {
+		slices = append(slices, slice)
+	}
+	sort.Strings(slices)
+
+	tracker := se.manager.getCommitTracker()
+	p := tracker.start(se, slices)
+	defer tracker.finish(p)
+
+	for _, slice := range slices {
+		pc := se.txConns[slice]
+		rollback := p.begin(pc) == CommitResolveRollback
+		var e error
+		if rollback {
+			e = pc.Rollback()
+		} else {
+			e = pc.Commit()
+		}
+		p.end(rollback, e)
+		if e != nil {
+			err = e
+		}
+	}
+
+	if p != nil && p.partial() && se.manager != nil && se.manager.statistics != nil {
+		se.manager.GetStatisticManager().RecordPartialCommit(se.namespace)
+	}
+	return
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/stats"
+)
+
+func newCommitTestExecutor(threshold time.Duration) *SessionExecutor {
+	m := NewManager()
+	m.commits = newCommitTracker(threshold)
+	m.statistics = &StatisticManager{
+		clusterName:          "test",
+		commitProgressCounts: stats.NewGaugesWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelState}),
+		partialCommitCounts:  stats.NewCountersWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace}),
+	}
+	se := newSessionExecutor(m)
+	se.namespace = "test_ns"
+	se.user = "test_user"
+	se.clientAddr = "127.0.0.1:12345"
+	se.connID = 100
+	se.status |= mysql.ServerStatusInTrans
+	return se
+}
+
+func TestCommitSlicesInOrder(t *testing.T) {
+	se := newCommitTestExecutor(time.Minute)
+	var order []string
+	for _, slice := range []string{"slice-2", "slice-0", "slice-1"} {
+		slice := slice
+		pc := new(mocks.PooledConnect)
+		pc.On("Commit").Run(func(mock.Arguments) { order = append(order, slice) }).Return(nil)
+		pc.On("Recycle").Return()
+		se.txConns[slice] = pc
+	}
+
+	if err := se.commit(); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if len(order) != 3 || order[0] != "slice-0" || order[1] != "slice-1" || order[2] != "slice-2" {
+		t.Errorf("slices should be committed in order, got: %v", order)
+	}
+	if len(se.manager.commits.list("")) != 0 {
+		t.Errorf("finished commit should be removed")
+	}
+}
+
+func TestResolveHungCommit(t *testing.T) {
+	tests := []struct {
+		action   string
+		commit   int // slice-2提交的次数
+		rollback int // slice-2回滚的次数
+		partial  int64
+	}{
+		{action: CommitResolveCommit, commit: 1, partial: 1},
+		{action: CommitResolveRollback, rollback: 1, partial: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			se := newCommitTestExecutor(10 * time.Millisecond)
+			aborted := make(chan struct{})
+
+			pc0 := new(mocks.PooledConnect)
+			pc0.On("Commit").Return(nil)
+			pc1 := new(mocks.PooledConnect)
+			pc1.On("Commit").Run(func(mock.Arguments) { <-aborted }).Return(errors.New("connection aborted"))
+			pc1.On("Abort").Run(func(mock.Arguments) { close(aborted) }).Return()
+			pc2 := new(mocks.PooledConnect)
+			pc2.On("Commit").Return(nil)
+			pc2.On("Rollback").Return(nil)
+			for _, pc := range []*mocks.PooledConnect{pc0, pc1, pc2} {
+				pc.On("Recycle").Return()
+			}
+			se.txConns = map[string]backend.PooledConnect{"slice-0": pc0, "slice-1": pc1, "slice-2": pc2}
+
+			done := make(chan error)
+			go func() {
+				done <- se.commit()
+			}()
+
+			tracker := se.manager.commits
+			var commits []CommitProgress
+			for i := 0; i < 100; i++ {
+				time.Sleep(10 * time.Millisecond)
+				if commits = tracker.list("test_ns"); len(commits) == 1 && commits[0].Hung {
+					break
+				}
+			}
+			if len(commits) != 1 || !commits[0].Hung || commits[0].Current != "slice-1" || len(commits[0].Committed) != 1 {
+				t.Fatalf("commit should hang on slice-1, got: %+v", commits)
+			}
+			if len(tracker.list("other_ns")) != 0 {
+				t.Errorf("commits of other namespace should not be listed")
+			}
+
+			tracker.recordMetrics(se.manager.statistics, []string{"test_ns", "other_ns"})
+			counts := se.manager.statistics.commitProgressCounts.Counts()
+			if counts["test.test_ns.hung"] != 1 || counts["test.test_ns.committing"] != 1 || counts["test.other_ns.hung"] != 0 {
+				t.Errorf("unexpected commit progress counts: %v", counts)
+			}
+
+			if _, err := tracker.resolve(100, "abort"); err == nil {
+				t.Errorf("invalid action should be rejected")
+			}
+			if _, err := tracker.resolve(101, test.action); err == nil {
+				t.Errorf("resolve unknown connection should fail")
+			}
+			if _, err := tracker.resolve(100, test.action); err != nil {
+				t.Fatalf("resolve error: %v", err)
+			}
+			if _, err := tracker.resolve(100, test.action); err == nil {
+				t.Errorf("resolve twice should fail")
+			}
+
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Errorf("interrupted commit should return error")
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("commit is not interrupted")
+			}
+			pc2.AssertNumberOfCalls(t, "Commit", test.commit)
+			pc2.AssertNumberOfCalls(t, "Rollback", test.rollback)
+			if n := se.manager.statistics.partialCommitCounts.Counts()["test.test_ns"]; n != test.partial {
+				t.Errorf("partial commit count, expect: %d, got: %d", test.partial, n)
+			}
+			if se.status&mysql.ServerStatusInTrans != 0 || len(se.txConns) != 0 {
+				t.Errorf("transaction should be finished")
+			}
+		})
+	}
+}
+
+func TestResolveCommitNotHung(t *testing.T) {
+	for _, threshold := range []time.Duration{time.Minute, 0} {
+		tracker := newCommitTracker(threshold)
+		se := newCommitTestExecutor(threshold)
+		p := tracker.start(se, []string{"slice-0", "slice-1"})
+		if _, err := tracker.resolve(se.connID, CommitResolveRollback); err == nil {
+			t.Errorf("commit not hung should not be resolved, threshold: %v", threshold)
+		}
+		tracker.finish(p)
+	}
+}
+
+func TestParseCommitHangThreshold(t *testing.T) {
+	tests := []struct {
+		value  int
+		expect time.Duration
+		err    bool
+	}{
+		{value: 0, expect: defaultCommitHangThreshold},
+		{value: -1, expect: 0},
+		{value: 200, expect: 200 * time.Millisecond},
+		{value: -2, err: true},
+	}
+	for _, test := range tests {
+		d, err := parseCommitHangThreshold(&models.Proxy{CommitHangThreshold: test.value})
+		if (err != nil) != test.err || d != test.expect {
+			t.Errorf("parse %d, expect: %v %v, got: %v %v", test.value, test.expect, test.err, d, err)
+		}
+	}
+}
+
+func TestAppendCommitProgress(t *testing.T) {
+	se := newCommitTestExecutor(-1)
+	se.db = "test_db"
+	p := se.manager.commits.start(se, []string{"slice-0", "slice-1"})
+	p.begin(nil)
+	p.end(false, nil)
+
+	names := []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}
+	r := &mysql.Result{Resultset: &mysql.Resultset{}}
+	for _, name := range names {
+		r.Fields = append(r.Fields, &mysql.Field{Name: []byte(name)})
+	}
+	r.Values = [][]interface{}{{int64(1), "root", "127.0.0.1:3306", nil, "Sleep", int64(3), "", nil}}
+	if err := se.appendCommitProgress(r); err != nil {
+		t.Fatalf("append commit progress error: %v", err)
+	}
+	if len(r.Values) != 2 || len(r.RowDatas) != 2 {
+		t.Fatalf("expect 2 rows, got values: %d, row datas: %d", len(r.Values), len(r.RowDatas))
+	}
+	row := r.Values[1]
+	if row[0] != int64(100) || row[1] != "test_user" || row[3] != "test_db" || row[7] != "COMMIT" {
+		t.Errorf("unexpected commit row: %v", row)
+	}
+	if row[6] != "committing on slice-1, 1/2 slices committed" {
+		t.Errorf("unexpected commit state: %v", row[6])
+	}
+
+	// 其他namespace的提交不显示
+	se.namespace = "other_ns"
+	r.Values = r.Values[:1]
+	if err := se.appendCommitProgress(r); err != nil || len(r.Values) != 1 {
+		t.Errorf("commits of other namespace should not be appended, err: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// ConnInfo is the client connection passed to interceptors
+type ConnInfo struct {
+	ConnID     uint32
+	RemoteAddr net.Addr
+	Namespace  string // 认证成功之前为空
+	User       string // 认证成功之前为空
+
+	// Attributes 客户端发送的连接属性, 如program_name, 认证成功之前为空, 不能修改
+	Attributes map[string]string
+
+	// Tags 拦截器给连接打的标签, 在后续阶段的拦截器和会话生命周期钩子中可见, 只在会话goroutine中访问
+	Tags map[string]string
+}
+
+// ConnInterceptor intercepts client connection at accept, after authentication and before each command,
+// returning error rejects the connection or command. Nil functions are skipped.
+// It's called synchronously in session goroutine, so it should not block.
+type ConnInterceptor struct {
+	// OnAccept 握手之前调用, 返回错误时向客户端返回错误包并关闭连接
+	OnAccept func(conn *ConnInfo) error
+	// OnAuthenticated 认证成功、返回OK包之前调用, COM_CHANGE_USER切换用户后也会调用, 返回错误时向客户端返回错误包并关闭连接
+	OnAuthenticated func(conn *ConnInfo) error
+	// OnCommand 执行每个命令之前调用, 返回错误时该命令返回错误, 连接保持
+	OnCommand func(conn *ConnInfo, cmd byte, data []byte) error
+}
+
+type namedConnInterceptor struct {
+	name        string
+	interceptor *ConnInterceptor
+}
+
+// 拦截器按注册顺序组成调用链, 任一拦截器返回错误时不再调用后续的拦截器
+var connInterceptors = struct {
+	sync.RWMutex
+	chain []namedConnInterceptor
+}{}
+
+// RegisterConnInterceptor register interceptor with name at the end of the chain,
+// the interceptor registered with the same name is replaced in place
+func RegisterConnInterceptor(name string, interceptor *ConnInterceptor) {
+	connInterceptors.Lock()
+	defer connInterceptors.Unlock()
+	for i := range connInterceptors.chain {
+		if connInterceptors.chain[i].name == name {
+			connInterceptors.chain[i].interceptor = interceptor
+			return
+		}
+	}
+	connInterceptors.chain = append(connInterceptors.chain, namedConnInterceptor{name: name, interceptor: interceptor})
+}
+
+// UnregisterConnInterceptor remove interceptor with name
+func UnregisterConnInterceptor(name string) {
+	connInterceptors.Lock()
+	defer connInterceptors.Unlock()
+	for i := range connInterceptors.chain {
+		if connInterceptors.chain[i].name == name {
+			connInterceptors.chain = append(connInterceptors.chain[:i:i], connInterceptors.chain[i+1:]...)
+			return
+		}
+	}
+}
+
+func hasConnInterceptors() bool {
+	connInterceptors.RLock()
+	defer connInterceptors.RUnlock()
+	return len(connInterceptors.chain) != 0
+}
+
+// interceptAccept 握手之前调用, 创建连接信息
+func (cc *Session) interceptAccept() error {
+	cc.connInfo = &ConnInfo{
+		ConnID:     cc.c.GetConnectionID(),
+		RemoteAddr: cc.c.RemoteAddr(),
+		Tags:       make(map[string]string),
+	}
+	return callConnInterceptors(func(i *ConnInterceptor) error {
+		if i.OnAccept == nil {
+			return nil
+		}
+		return i.OnAccept(cc.connInfo)
+	})
+}
+
+func (cc *Session) interceptAuthenticated() error {
+	cc.connInfo.Namespace = cc.namespace
+	cc.connInfo.User = cc.executor.user
+	cc.connInfo.Attributes = cc.c.Attributes()
+	return callConnInterceptors(func(i *ConnInterceptor) error {
+		if i.OnAuthenticated == nil {
+			return nil
+		}
+		return i.OnAuthenticated(cc.connInfo)
+	})
+}
+
+// interceptCommandIfNeeded 接受连接时没有注册拦截器则不拦截
+func (cc *Session) interceptCommandIfNeeded(cmd byte, data []byte) error {
+	if cc.connInfo == nil {
+		return nil
+	}
+	return callConnInterceptors(func(i *ConnInterceptor) error {
+		if i.OnCommand == nil {
+			return nil
+		}
+		return i.OnCommand(cc.connInfo, cmd, data)
+	})
+}
+
+// callConnInterceptors 依次调用拦截器, 拦截器panic时拒绝连接或命令
+func callConnInterceptors(call func(i *ConnInterceptor) error) error {
+	connInterceptors.RLock()
+	defer connInterceptors.RUnlock()
+	for _, c := range connInterceptors.chain {
+		if err := callConnInterceptor(c.name, c.interceptor, call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func callConnInterceptor(name string, i *ConnInterceptor, call func(i *ConnInterceptor) error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			exeLogger.Warnf("conn interceptor %s panic, error: %v, stack: %s", name, e, string(buf))
+			err = toInterceptorError(fmt.Errorf("conn interceptor %s panic", name))
+		}
+	}()
+	if err = call(i); err != nil {
+		exeLogger.Debugf("conn interceptor %s rejected, err: %v", name, err)
+		return toInterceptorError(err)
+	}
+	return nil
+}
+
+// toInterceptorError 非SQLError的拒绝原因以ER_ACCESS_DENIED_ERROR返回给客户端
+func toInterceptorError(err error) error {
+	if _, ok := err.(*mysql.SQLError); ok {
+		return err
+	}
+	return mysql.NewError(mysql.ErrAccessDenied, err.Error())
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestConnInterceptorChain(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	cc := newSession(&Server{}, server)
+	if err := cc.interceptCommandIfNeeded(mysql.ComQuery, []byte("select 1")); err != nil {
+		t.Fatalf("expect no interception without conn info: %v", err)
+	}
+
+	var calls []string
+	RegisterConnInterceptor("tagger", &ConnInterceptor{
+		OnAccept: func(conn *ConnInfo) error {
+			calls = append(calls, "tagger.accept")
+			conn.Tags["tier"] = "gold"
+			return nil
+		},
+		OnAuthenticated: func(conn *ConnInfo) error {
+			calls = append(calls, "tagger.auth:"+conn.User)
+			return nil
+		},
+	})
+	RegisterConnInterceptor("quota", &ConnInterceptor{
+		OnCommand: func(conn *ConnInfo, cmd byte, data []byte) error {
+			calls = append(calls, "quota.command:"+conn.Tags["tier"])
+			if string(data) == "delete from t" {
+				return fmt.Errorf("quota exceeded")
+			}
+			return nil
+		},
+	})
+	RegisterConnInterceptor("last", &ConnInterceptor{
+		OnCommand: func(conn *ConnInfo, cmd byte, data []byte) error {
+			calls = append(calls, "last.command")
+			return nil
+		},
+	})
+	defer UnregisterConnInterceptor("tagger")
+	defer UnregisterConnInterceptor("quota")
+	defer UnregisterConnInterceptor("last")
+
+	if err := cc.interceptAccept(); err != nil {
+		t.Fatal(err)
+	}
+	cc.executor.user = "test_user"
+	if err := cc.interceptAuthenticated(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.interceptCommandIfNeeded(mysql.ComQuery, []byte("select 1")); err != nil {
+		t.Fatal(err)
+	}
+	// 拒绝后不再调用后续的拦截器, 非SQLError转换为ER_ACCESS_DENIED_ERROR
+	err := cc.interceptCommandIfNeeded(mysql.ComQuery, []byte("delete from t"))
+	se, ok := err.(*mysql.SQLError)
+	if !ok || se.Code != mysql.ErrAccessDenied || se.Message != "quota exceeded" {
+		t.Errorf("reject error not match: %v", err)
+	}
+
+	expect := []string{"tagger.accept", "tagger.auth:test_user", "quota.command:gold", "last.command", "quota.command:gold"}
+	if fmt.Sprint(calls) != fmt.Sprint(expect) {
+		t.Errorf("calls not match, expect: %v, actual: %v", expect, calls)
+	}
+}
+
+func TestConnInterceptorRegister(t *testing.T) {
+	RegisterConnInterceptor("a", &ConnInterceptor{})
+	RegisterConnInterceptor("b", &ConnInterceptor{})
+	panicInterceptor := &ConnInterceptor{OnAccept: func(conn *ConnInfo) error { panic("interceptor panic") }}
+	RegisterConnInterceptor("a", panicInterceptor)
+	defer UnregisterConnInterceptor("b")
+
+	if len(connInterceptors.chain) != 2 || connInterceptors.chain[0].name != "a" || connInterceptors.chain[0].interceptor != panicInterceptor {
+		t.Fatalf("replaced interceptor should keep position: %+v", connInterceptors.chain)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	cc := newSession(&Server{}, server)
+	err := cc.interceptAccept()
+	if se, ok := err.(*mysql.SQLError); !ok || se.Code != mysql.ErrAccessDenied {
+		t.Errorf("panic in interceptor should reject connection: %v", err)
+	}
+
+	UnregisterConnInterceptor("a")
+	if len(connInterceptors.chain) != 1 || connInterceptors.chain[0].name != "b" {
+		t.Errorf("unregister not match: %+v", connInterceptors.chain)
+	}
+}
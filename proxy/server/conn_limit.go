@@ -0,0 +1,163 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+const (
+	connRejectReasonMaxConnections     = "max_connections"
+	connRejectReasonMaxUserConnections = "max_user_connections"
+)
+
+// ConnCounts current client connections, returned by admin api
+type ConnCounts struct {
+	Total                 int64            `json:"total"`
+	Users                 map[string]int64 `json:"users"`
+	MaxConnections        int64            `json:"max_connections"`
+	MaxConnectionsPerUser int64            `json:"max_connections_per_user"`
+}
+
+// connLimiter 限制认证通过的前端连接总数和每个用户的连接数, 上限为0时不限制
+type connLimiter struct {
+	maxConns        int64
+	maxConnsPerUser int64
+
+	mu    sync.Mutex
+	total int64
+	users map[string]int64
+}
+
+func newConnLimiter(maxConns, maxConnsPerUser int) *connLimiter {
+	return &connLimiter{
+		maxConns:        int64(maxConns),
+		maxConnsPerUser: int64(maxConnsPerUser),
+		users:           make(map[string]int64),
+	}
+}
+
+// acquire 占用一个连接, 超出上限时返回拒绝原因和错误
+func (l *connLimiter) acquire(user string) (string, error) {
+	if l == nil {
+		return "", nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxConns > 0 && l.total >= l.maxConns {
+		return connRejectReasonMaxConnections, mysql.NewDefaultError(mysql.ErrConCount)
+	}
+	if l.maxConnsPerUser > 0 && l.users[user] >= l.maxConnsPerUser {
+		return connRejectReasonMaxUserConnections, mysql.NewDefaultError(mysql.ErrTooManyUserConnections, user)
+	}
+	l.total++
+	l.users[user]++
+	return "", nil
+}
+
+func (l *connLimiter) release(user string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.users[user]--; l.users[user] <= 0 {
+		delete(l.users, user)
+	}
+}
+
+// switchUser 会话切换用户, 总连接数不变, 只检查新用户的连接数
+func (l *connLimiter) switchUser(oldUser, newUser string) (string, error) {
+	if l == nil || oldUser == newUser {
+		return "", nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxConnsPerUser > 0 && l.users[newUser] >= l.maxConnsPerUser {
+		return connRejectReasonMaxUserConnections, mysql.NewDefaultError(mysql.ErrTooManyUserConnections, newUser)
+	}
+	l.users[newUser]++
+	if l.users[oldUser]--; l.users[oldUser] <= 0 {
+		delete(l.users, oldUser)
+	}
+	return "", nil
+}
+
+func (l *connLimiter) counts() ConnCounts {
+	counts := ConnCounts{Users: make(map[string]int64)}
+	if l == nil {
+		return counts
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	counts.Total = l.total
+	for user, n := range l.users {
+		counts.Users[user] = n
+	}
+	counts.MaxConnections = l.maxConns
+	counts.MaxConnectionsPerUser = l.maxConnsPerUser
+	return counts
+}
+
+// acquireConnLimit 认证通过后占用连接数, 会话关闭时释放
+func (cc *Session) acquireConnLimit(user string) error {
+	reason, err := cc.proxy.connLimiter.acquire(user)
+	if err != nil {
+		if cc.manager != nil {
+			cc.manager.GetStatisticManager().RecordConnReject(reason)
+		}
+		return err
+	}
+	cc.connLimitUser = user
+	cc.connLimitAcquired = true
+	if cc.manager != nil {
+		cc.manager.GetStatisticManager().RecordUserConn(user, 1)
+	}
+	return nil
+}
+
+// switchConnLimitUser COM_CHANGE_USER认证通过后, 连接数从原用户转移到新用户
+func (cc *Session) switchConnLimitUser(user string) error {
+	if !cc.connLimitAcquired {
+		return cc.acquireConnLimit(user)
+	}
+	reason, err := cc.proxy.connLimiter.switchUser(cc.connLimitUser, user)
+	if err != nil {
+		if cc.manager != nil {
+			cc.manager.GetStatisticManager().RecordConnReject(reason)
+		}
+		return err
+	}
+	if cc.manager != nil && cc.connLimitUser != user {
+		cc.manager.GetStatisticManager().RecordUserConn(cc.connLimitUser, -1)
+		cc.manager.GetStatisticManager().RecordUserConn(user, 1)
+	}
+	cc.connLimitUser = user
+	return nil
+}
+
+func (cc *Session) releaseConnLimit() {
+	if !cc.connLimitAcquired {
+		return
+	}
+	cc.connLimitAcquired = false
+	cc.proxy.connLimiter.release(cc.connLimitUser)
+	if cc.manager != nil {
+		cc.manager.GetStatisticManager().RecordUserConn(cc.connLimitUser, -1)
+	}
+}
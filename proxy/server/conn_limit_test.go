@@ -0,0 +1,65 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(3, 2)
+	for _, user := range []string{"u1", "u1", "u2"} {
+		if _, err := l.acquire(user); err != nil {
+			t.Fatalf("acquire %s error: %v", user, err)
+		}
+	}
+
+	// 总数超出上限
+	reason, err := l.acquire("u3")
+	var sqlErr *mysql.SQLError
+	if !errors.As(err, &sqlErr) || sqlErr.SQLCode() != mysql.ErrConCount || reason != connRejectReasonMaxConnections {
+		t.Errorf("expect ER_CON_COUNT_ERROR, reason: %s, err: %v", reason, err)
+	}
+
+	l.release("u2")
+	// 用户连接数超出上限
+	reason, err = l.acquire("u1")
+	if !errors.As(err, &sqlErr) || sqlErr.SQLCode() != mysql.ErrTooManyUserConnections || reason != connRejectReasonMaxUserConnections {
+		t.Errorf("expect ER_TOO_MANY_USER_CONNECTIONS, reason: %s, err: %v", reason, err)
+	}
+	if _, err := l.acquire("u2"); err != nil {
+		t.Errorf("acquire after release error: %v", err)
+	}
+
+	counts := l.counts()
+	if counts.Total != 3 || counts.Users["u1"] != 2 || counts.Users["u2"] != 1 || counts.MaxConnections != 3 || counts.MaxConnectionsPerUser != 2 {
+		t.Errorf("counts not match: %+v", counts)
+	}
+	l.release("u2")
+	if _, ok := l.counts().Users["u2"]; ok {
+		t.Errorf("user without connections should be removed")
+	}
+
+	// 不限制
+	l = newConnLimiter(0, 0)
+	for i := 0; i < 10; i++ {
+		if _, err := l.acquire("u1"); err != nil {
+			t.Fatalf("acquire without limit error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+const (
+	connRejectReasonQueueFull    = "queue_full"
+	connRejectReasonQueueTimeout = "queue_timeout"
+
+	defaultConnQueueTimeout = 1000 * time.Millisecond
+)
+
+// connWorkerPool 限制处理前端连接的goroutine总数, 超出部分排队等待或直接拒绝
+type connWorkerPool struct {
+	workers      chan struct{}
+	queueSize    int64
+	queueTimeout time.Duration
+
+	queued sync2.AtomicInt64
+}
+
+// newConnWorkerPool maxWorkers为0时不限制, 返回nil
+func newConnWorkerPool(maxWorkers, queueSize int, queueTimeout time.Duration) *connWorkerPool {
+	if maxWorkers <= 0 {
+		return nil
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = defaultConnQueueTimeout
+	}
+	return &connWorkerPool{
+		workers:      make(chan struct{}, maxWorkers),
+		queueSize:    int64(queueSize),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire 获取一个worker, 失败时返回拒绝原因
+func (p *connWorkerPool) acquire() (bool, string) {
+	if p.tryAcquire() {
+		return true, ""
+	}
+	if !p.enqueue() {
+		return false, connRejectReasonQueueFull
+	}
+	return p.waitQueued()
+}
+
+// tryAcquire 不等待地获取一个worker
+func (p *connWorkerPool) tryAcquire() bool {
+	if p == nil {
+		return true
+	}
+	select {
+	case p.workers <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue 占用一个排队位置, 队列已满时返回false, 成功后需要调用waitQueued
+func (p *connWorkerPool) enqueue() bool {
+	if p.queued.Add(1) > p.queueSize {
+		p.queued.Add(-1)
+		return false
+	}
+	return true
+}
+
+// waitQueued 排队等待worker直到超时, 并释放排队位置
+func (p *connWorkerPool) waitQueued() (bool, string) {
+	defer p.queued.Add(-1)
+
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+	select {
+	case p.workers <- struct{}{}:
+		return true, ""
+	case <-timer.C:
+		return false, connRejectReasonQueueTimeout
+	}
+}
+
+// release 归还worker
+func (p *connWorkerPool) release() {
+	if p == nil {
+		return
+	}
+	<-p.workers
+}
+
+// active 正在处理的连接数
+func (p *connWorkerPool) active() int64 {
+	if p == nil {
+		return 0
+	}
+	return int64(len(p.workers))
+}
+
+// queuedCount 排队等待的连接数
+func (p *connWorkerPool) queuedCount() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.queued.Get()
+}
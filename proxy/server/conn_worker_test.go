@@ -0,0 +1,148 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestConnWorkerPoolUnlimited(t *testing.T) {
+	p := newConnWorkerPool(0, 10, 0)
+	if p != nil {
+		t.Fatalf("expect nil pool when max workers is 0")
+	}
+	if ok, _ := p.acquire(); !ok {
+		t.Errorf("nil pool should always acquire")
+	}
+	p.release()
+	if p.active() != 0 || p.queuedCount() != 0 {
+		t.Errorf("nil pool should report zero counts")
+	}
+}
+
+func TestConnWorkerPoolQueueFull(t *testing.T) {
+	p := newConnWorkerPool(1, 0, time.Second)
+	if ok, _ := p.acquire(); !ok {
+		t.Fatalf("first acquire should succeed")
+	}
+	if p.active() != 1 {
+		t.Errorf("active, expect: 1, actual: %d", p.active())
+	}
+	ok, reason := p.acquire()
+	if ok || reason != connRejectReasonQueueFull {
+		t.Errorf("expect reject with %s, actual: %v, %s", connRejectReasonQueueFull, ok, reason)
+	}
+	p.release()
+	if ok, _ := p.acquire(); !ok {
+		t.Errorf("acquire after release should succeed")
+	}
+}
+
+func TestConnWorkerPoolQueueTimeout(t *testing.T) {
+	p := newConnWorkerPool(1, 1, 20*time.Millisecond)
+	p.acquire()
+	ok, reason := p.acquire()
+	if ok || reason != connRejectReasonQueueTimeout {
+		t.Errorf("expect reject with %s, actual: %v, %s", connRejectReasonQueueTimeout, ok, reason)
+	}
+	if p.queuedCount() != 0 {
+		t.Errorf("queued, expect: 0, actual: %d", p.queuedCount())
+	}
+}
+
+func TestConnWorkerPoolQueueWait(t *testing.T) {
+	p := newConnWorkerPool(1, 1, time.Second)
+	p.acquire()
+
+	done := make(chan bool)
+	go func() {
+		ok, _ := p.acquire()
+		done <- ok
+	}()
+	for p.queuedCount() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	p.release()
+	if ok := <-done; !ok {
+		t.Errorf("queued acquire should succeed after release")
+	}
+	if p.queuedCount() != 0 || p.active() != 1 {
+		t.Errorf("unexpected counts, active: %d, queued: %d", p.active(), p.queuedCount())
+	}
+}
+
+func TestRejectConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	go rejectConn(server)
+
+	c := mysql.NewConn(client)
+	data, err := c.ReadPacket()
+	if err != nil {
+		t.Fatalf("read packet error: %v", err)
+	}
+	if data[0] != mysql.ErrHeader {
+		t.Fatalf("expect error packet, actual header: %d", data[0])
+	}
+	code := uint16(data[1]) | uint16(data[2])<<8
+	if code != mysql.ErrConCount {
+		t.Errorf("error code, expect: %d, actual: %d", mysql.ErrConCount, code)
+	}
+}
+
+func TestAcceptConnWorkerLimit(t *testing.T) {
+	s := &Server{
+		connWorkers:   newConnWorkerPool(1, 0, time.Second),
+		proxyProtocol: &proxyProtocolConfig{allowAll: true, headerTimeout: time.Second},
+	}
+
+	// 在读取PROXY protocol头之前已占用worker
+	server1, client1 := net.Pipe()
+	defer client1.Close()
+	s.acceptConn(server1)
+	if s.connWorkers.active() != 1 {
+		t.Fatalf("worker should be acquired before reading proxy protocol header, active: %d", s.connWorkers.active())
+	}
+
+	// 没有空闲worker且不允许排队时直接拒绝
+	server2, client2 := net.Pipe()
+	defer client2.Close()
+	codeCh := make(chan uint16, 1)
+	go func() {
+		data, err := mysql.NewConn(client2).ReadPacket()
+		if err != nil || data[0] != mysql.ErrHeader {
+			codeCh <- 0
+			return
+		}
+		codeCh <- uint16(data[1]) | uint16(data[2])<<8
+	}()
+	s.acceptConn(server2)
+	if code := <-codeCh; code != mysql.ErrConCount {
+		t.Errorf("error code, expect: %d, actual: %d", mysql.ErrConCount, code)
+	}
+
+	// PROXY protocol头错误时关闭连接并归还worker
+	client1.Write([]byte("GET / HTTP/1.1\r\n"))
+	for i := 0; s.connWorkers.active() != 0; i++ {
+		if i > 1000 {
+			t.Fatal("worker should be released after proxy protocol header error")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
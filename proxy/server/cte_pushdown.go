@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+// pushDownCTE 后端都支持WITH子句时, 不分片的语句直接发送原始SQL, 不使用公共表表达式内联为派生表后的SQL
+func pushDownCTE(ns *Namespace, db, sql string, p plan.Plan) plan.Plan {
+	if _, ok := p.(*plan.UnshardPlan); !ok || !parser.HasWithClause(sql) {
+		return p
+	}
+	// 逻辑库名和视图需要改写SQL, 不能发送原始SQL
+	if len(ns.views) != 0 || len(ns.materializedViews) != 0 {
+		return p
+	}
+	for logicDB, phyDB := range ns.GetPhysicalDBs() {
+		if logicDB != phyDB {
+			return p
+		}
+	}
+	slice := ns.GetSlice(backend.DefaultSlice)
+	if slice == nil || !slice.SupportsCTE() {
+		return p
+	}
+	return plan.CreatePassThroughPlan(db, sql, backend.DefaultSlice)
+}
+
+// GetBackendInfos return probed version and capabilities of backends in namespace, key: slice name
+func (m *Manager) GetBackendInfos(namespace string) (map[string][]backend.PoolBackendInfo, error) {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+	ret := make(map[string][]backend.PoolBackendInfo, len(ns.slices))
+	for name, slice := range ns.slices {
+		ret[name] = slice.BackendInfos()
+	}
+	return ret, nil
+}
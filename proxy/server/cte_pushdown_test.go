@@ -0,0 +1,62 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+func TestPushDownCTE(t *testing.T) {
+	const sql = "WITH t AS (SELECT 1 AS a) SELECT a FROM t"
+	tests := []struct {
+		masterInfo *backend.BackendInfo
+		slaveInfo  *backend.BackendInfo
+		phyDB      string
+		sql        string
+		pushDown   bool
+	}{
+		{&backend.BackendInfo{Major: 8}, &backend.BackendInfo{Major: 8, Minor: 0, Patch: 32}, "db", sql, true},
+		{&backend.BackendInfo{Major: 8}, &backend.BackendInfo{Major: 5, Minor: 7}, "db", sql, false},
+		{&backend.BackendInfo{Major: 8}, nil, "db", sql, false},
+		{&backend.BackendInfo{Major: 8}, &backend.BackendInfo{Major: 8}, "db_0", sql, false},
+		{&backend.BackendInfo{Major: 8}, &backend.BackendInfo{Major: 8}, "db", "SELECT a FROM t", false},
+	}
+	for _, test := range tests {
+		master := new(mocks.ConnectionPool)
+		master.On("Addr").Return("127.0.0.1:3306")
+		master.On("BackendInfo").Return(test.masterInfo)
+		slave := new(mocks.ConnectionPool)
+		slave.On("Addr").Return("127.0.0.1:3307")
+		slave.On("BackendInfo").Return(test.slaveInfo)
+		ns := &Namespace{
+			slices:        map[string]*backend.Slice{backend.DefaultSlice: {Master: master, Slave: []backend.ConnectionPool{slave}}},
+			defaultPhyDBs: map[string]string{"db": test.phyDB},
+		}
+
+		p := pushDownCTE(ns, "db", test.sql, &plan.UnshardPlan{})
+		pt, ok := p.(*plan.PassThroughPlan)
+		if ok != test.pushDown {
+			t.Errorf("push down not match, master: %+v, slave: %+v, phy db: %s, sql: %s, expect: %v", test.masterInfo, test.slaveInfo, test.phyDB, test.sql, test.pushDown)
+			continue
+		}
+		if ok && pt.GetSlice() != backend.DefaultSlice {
+			t.Errorf("push down slice not match, actual: %s", pt.GetSlice())
+		}
+	}
+}
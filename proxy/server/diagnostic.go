@@ -0,0 +1,328 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/core"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// 两次诊断操作之间的最小间隔
+	diagnosticMinInterval = time.Second
+	// pprof profile和trace最长采集时间, 单位: 秒
+	maxDiagnosticProfileSeconds = 60
+	// gaea_diagnostic_bundle变量, 在diagnostic_dir中生成诊断包
+	gaeaDiagnosticBundleVariable = "gaea_diagnostic_bundle"
+)
+
+// 诊断包中的pprof profile, debug为WriteTo的参数
+var diagnosticProfiles = []struct {
+	name  string
+	file  string
+	debug int
+}{
+	{"goroutine", "goroutine.txt", 2},
+	{"heap", "heap.pprof", 0},
+	{"allocs", "allocs.pprof", 0},
+	{"block", "block.pprof", 0},
+	{"mutex", "mutex.pprof", 0},
+	{"threadcreate", "threadcreate.pprof", 0},
+}
+
+var diagnosticLabelRegexp = regexp.MustCompile(`^[0-9A-Za-z_.-]{0,64}$`)
+
+var processStartTime = time.Now()
+
+// diagnosticGuard 限制诊断操作同时只有一个, 且两次之间至少间隔minInterval, 避免诊断本身影响线上服务
+type diagnosticGuard struct {
+	mu          sync.Mutex
+	running     bool
+	last        time.Time
+	minInterval time.Duration
+}
+
+func newDiagnosticGuard(minInterval time.Duration) *diagnosticGuard {
+	return &diagnosticGuard{minInterval: minInterval}
+}
+
+// acquire start a diagnostic operation, release must be called after done
+func (g *diagnosticGuard) acquire() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running {
+		return fmt.Errorf("another diagnostic operation is running")
+	}
+	if wait := g.minInterval - time.Since(g.last); wait > 0 {
+		return fmt.Errorf("diagnostic operation is too frequent, retry after %v", wait.Round(time.Millisecond))
+	}
+	g.running = true
+	g.last = time.Now()
+	return nil
+}
+
+func (g *diagnosticGuard) release() {
+	g.mu.Lock()
+	g.running = false
+	g.mu.Unlock()
+}
+
+// DiagnosticState internal state of proxy for troubleshooting
+type DiagnosticState struct {
+	Time       time.Time                            `json:"time"`
+	Build      core.BuildInfo                       `json:"build"`
+	Runtime    DiagnosticRuntime                    `json:"runtime"`
+	Sessions   map[string]int64                     `json:"sessions"`     // key: cluster.namespace
+	ConnWorker map[string]int64                     `json:"conn_workers"` // key: cluster.active/queued
+	Namespaces map[string]*NamespaceDiagnosticState `json:"namespaces"`
+}
+
+// DiagnosticRuntime go runtime information
+type DiagnosticRuntime struct {
+	StartTime    time.Time `json:"start_time"`
+	GoVersion    string    `json:"go_version"`
+	NumCPU       int       `json:"num_cpu"`
+	GOMAXPROCS   int       `json:"gomaxprocs"`
+	NumGoroutine int       `json:"num_goroutine"`
+	HeapAlloc    uint64    `json:"heap_alloc"`
+	HeapInuse    uint64    `json:"heap_inuse"`
+	Sys          uint64    `json:"sys"`
+	NumGC        uint32    `json:"num_gc"`
+	PauseTotalNs uint64    `json:"pause_total_ns"`
+}
+
+// NamespaceDiagnosticState state of backend pools and caches of namespace
+type NamespaceDiagnosticState struct {
+	ReadOnly          bool                              `json:"read_only"`
+	Pools             map[string][]*PoolDiagnosticState `json:"pools"` // key: slice name
+	Caches            map[string]int64                  `json:"caches"`
+	IdempotencyTables int                               `json:"idempotency_tables"`
+}
+
+// PoolDiagnosticState state of backend connection pool
+type PoolDiagnosticState struct {
+	Role        string `json:"role"` // master, slave, statistic_slave
+	Addr        string `json:"addr"`
+	Capacity    int64  `json:"capacity"`
+	MaxCap      int64  `json:"max_cap"`
+	Active      int64  `json:"active"`
+	InUse       int64  `json:"in_use"`
+	Available   int64  `json:"available"`
+	WaitCount   int64  `json:"wait_count"`
+	WaitTime    string `json:"wait_time"`
+	IdleClosed  int64  `json:"idle_closed"`
+	IdleTimeout string `json:"idle_timeout"`
+}
+
+// DiagnosticState collect internal state of proxy, which contains no passwords or sql text
+func (m *Manager) DiagnosticState() *DiagnosticState {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	state := &DiagnosticState{
+		Time:  time.Now(),
+		Build: core.Info,
+		Runtime: DiagnosticRuntime{
+			StartTime:    processStartTime,
+			GoVersion:    runtime.Version(),
+			NumCPU:       runtime.NumCPU(),
+			GOMAXPROCS:   runtime.GOMAXPROCS(0),
+			NumGoroutine: runtime.NumGoroutine(),
+			HeapAlloc:    ms.HeapAlloc,
+			HeapInuse:    ms.HeapInuse,
+			Sys:          ms.Sys,
+			NumGC:        ms.NumGC,
+			PauseTotalNs: ms.PauseTotalNs,
+		},
+		Namespaces: make(map[string]*NamespaceDiagnosticState),
+	}
+	if m.statistics != nil {
+		state.Sessions = m.statistics.sessionCounts.Counts()
+		state.ConnWorker = m.statistics.connWorkerCounts.Counts()
+	}
+
+	current, _, _ := m.switchIndex.Get()
+	for name, ns := range m.namespaces[current].GetNamespaces() {
+		state.Namespaces[name] = ns.diagnosticState()
+	}
+	return state
+}
+
+func (n *Namespace) diagnosticState() *NamespaceDiagnosticState {
+	s := &NamespaceDiagnosticState{
+		ReadOnly: n.IsReadOnly(),
+		Pools:    make(map[string][]*PoolDiagnosticState, len(n.slices)),
+		Caches: map[string]int64{
+			"slow_sql":          n.slowSQLCache.Length(),
+			"error_sql":         n.errorSQLCache.Length(),
+			"backend_slow_sql":  n.backendSlowSQLCache.Length(),
+			"backend_error_sql": n.backendErrorSQLCache.Length(),
+		},
+	}
+	for name, slice := range n.slices {
+		slice.RLock()
+		master, slaves, statisticSlaves := slice.Master, slice.Slave, slice.StatisticSlave
+		slice.RUnlock()
+		pools := []*PoolDiagnosticState{poolDiagnosticState("master", master)}
+		for _, cp := range slaves {
+			pools = append(pools, poolDiagnosticState("slave", cp))
+		}
+		for _, cp := range statisticSlaves {
+			pools = append(pools, poolDiagnosticState("statistic_slave", cp))
+		}
+		s.Pools[name] = pools
+	}
+	n.idempotencyTables.Range(func(k, v interface{}) bool {
+		s.IdempotencyTables++
+		return true
+	})
+	return s
+}
+
+func poolDiagnosticState(role string, cp backend.ConnectionPool) *PoolDiagnosticState {
+	return &PoolDiagnosticState{
+		Role:        role,
+		Addr:        cp.Addr(),
+		Capacity:    cp.Capacity(),
+		MaxCap:      cp.MaxCap(),
+		Active:      cp.Active(),
+		InUse:       cp.InUse(),
+		Available:   cp.Available(),
+		WaitCount:   cp.WaitCount(),
+		WaitTime:    cp.WaitTime().String(),
+		IdleClosed:  cp.IdleClosed(),
+		IdleTimeout: cp.IdleTimeout().String(),
+	}
+}
+
+// WriteDiagnosticBundle write tar.gz bundle of internal state and pprof profiles for support cases
+func (m *Manager) WriteDiagnosticBundle(w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	addFile := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	state, err := json.MarshalIndent(m.DiagnosticState(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addFile("state.json", state); err != nil {
+		return err
+	}
+	for _, p := range diagnosticProfiles {
+		profile := pprof.Lookup(p.name)
+		if profile == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := profile.WriteTo(&buf, p.debug); err != nil {
+			return fmt.Errorf("write profile %s error: %v", p.name, err)
+		}
+		if err := addFile(p.file, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// createDiagnosticBundle 在dir中生成诊断包, 返回文件路径, label用于区分不同的问题
+func (m *Manager) createDiagnosticBundle(dir, label string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("diagnostic_dir is not configured")
+	}
+	if !diagnosticLabelRegexp.MatchString(label) {
+		return "", fmt.Errorf("invalid diagnostic bundle label: %s", label)
+	}
+	if err := m.diagnosticGuard.acquire(); err != nil {
+		return "", err
+	}
+	defer m.diagnosticGuard.release()
+
+	name := "gaea-diagnostic-" + time.Now().Format("20060102150405")
+	if label != "" {
+		name += "-" + label
+	}
+	path := filepath.Join(dir, name+".tar.gz")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := m.WriteDiagnosticBundle(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// diagnosticLimit gin middleware which limits concurrency and frequency of diagnostic requests, and seconds of profile and trace
+func (s *AdminServer) diagnosticLimit(c *gin.Context) {
+	if v := c.Query("seconds"); v != "" {
+		if seconds, err := strconv.Atoi(v); err != nil || seconds <= 0 || seconds > maxDiagnosticProfileSeconds {
+			c.AbortWithStatusJSON(selfDefinedInternalError, fmt.Sprintf("seconds should be between 1 and %d", maxDiagnosticProfileSeconds))
+			return
+		}
+	}
+	guard := s.proxy.manager.diagnosticGuard
+	if err := guard.acquire(); err != nil {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, err.Error())
+		return
+	}
+	defer guard.release()
+	c.Next()
+}
+
+func (s *AdminServer) getDiagnosticState(c *gin.Context) {
+	c.JSON(http.StatusOK, s.proxy.manager.DiagnosticState())
+}
+
+// getDiagnosticBundle download tar.gz bundle of state and profiles
+func (s *AdminServer) getDiagnosticBundle(c *gin.Context) {
+	name := "gaea-diagnostic-" + time.Now().Format("20060102150405") + ".tar.gz"
+	s.audit(c, gaeaDiagnosticBundleVariable, "", name, nil, nil, nil)
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", "attachment; filename="+name)
+	c.Status(http.StatusOK)
+	if err := s.proxy.manager.WriteDiagnosticBundle(c.Writer); err != nil {
+		log.Warnf("write diagnostic bundle error: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDiagnosticGuard(t *testing.T) {
+	g := newDiagnosticGuard(time.Hour)
+	if err := g.acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.acquire(); err == nil {
+		t.Error("expect error when another diagnostic is running")
+	}
+	g.release()
+	if err := g.acquire(); err == nil {
+		t.Error("expect error when diagnostic is too frequent")
+	}
+
+	g = newDiagnosticGuard(0)
+	for i := 0; i < 2; i++ {
+		if err := g.acquire(); err != nil {
+			t.Fatal(err)
+		}
+		g.release()
+	}
+}
+
+func TestCreateDiagnosticBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_diagnostic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := newStateSnapshotManager("md5")
+	m.diagnosticGuard = newDiagnosticGuard(0)
+	if _, err := m.createDiagnosticBundle("", "case-1"); err == nil {
+		t.Error("expect error when diagnostic dir is not configured")
+	}
+	if _, err := m.createDiagnosticBundle(dir, "../case"); err == nil {
+		t.Error("expect error of invalid label")
+	}
+
+	path, err := m.createDiagnosticBundle(dir, "case-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = data
+	}
+	for _, name := range []string{"state.json", "goroutine.txt", "heap.pprof"} {
+		if len(files[name]) == 0 {
+			t.Errorf("missing %s in diagnostic bundle", name)
+		}
+	}
+	state := &DiagnosticState{}
+	if err := json.Unmarshal(files["state.json"], state); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Namespaces["test_namespace"]; !ok || state.Runtime.NumGoroutine == 0 {
+		t.Errorf("unexpected diagnostic state: %s", files["state.json"])
+	}
+}
+
+func TestDiagnosticLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := NewManager()
+	s := &AdminServer{proxy: &Server{manager: m}}
+	engine := gin.New()
+	engine.GET("/profile", s.diagnosticLimit, func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{"/profile?seconds=600", selfDefinedInternalError},
+		{"/profile?seconds=10", http.StatusOK},
+		{"/profile?seconds=10", http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+		if w.Code != test.code {
+			t.Errorf("status code of %s not equal, expect: %d, actual: %d", test.url, test.code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+var (
+	// 排空期间检查会话状态的间隔
+	drainCheckInterval = 100 * time.Millisecond
+	// 强制关闭会话后等待会话退出的时间, 超时后直接关闭连接
+	forceCloseWait = time.Second
+)
+
+// sessionSet sessions of server, used to drain sessions on shutdown
+type sessionSet struct {
+	mu       sync.Mutex
+	sessions map[*Session]struct{}
+}
+
+func newSessionSet() *sessionSet {
+	return &sessionSet{sessions: make(map[*Session]struct{})}
+}
+
+func (ss *sessionSet) add(cc *Session) {
+	ss.mu.Lock()
+	ss.sessions[cc] = struct{}{}
+	ss.mu.Unlock()
+}
+
+func (ss *sessionSet) remove(cc *Session) {
+	ss.mu.Lock()
+	delete(ss.sessions, cc)
+	ss.mu.Unlock()
+}
+
+func (ss *sessionSet) list() []*Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	sessions := make([]*Session, 0, len(ss.sessions))
+	for cc := range ss.sessions {
+		sessions = append(sessions, cc)
+	}
+	return sessions
+}
+
+// Shutdown drain sessions up to shutdown_drain_timeout and close proxy server
+func (s *Server) Shutdown() error {
+	if s.drainTimeout > 0 {
+		s.drain(s.drainTimeout)
+	}
+	return s.Close()
+}
+
+// isDraining check if server is draining sessions
+func (s *Server) isDraining() bool {
+	return s.draining.Get()
+}
+
+// drain 停止接受新连接, 空闲会话立即关闭, 事务中的会话在事务结束后关闭, 超时后强制关闭剩余会话
+func (s *Server) drain(timeout time.Duration) {
+	s.draining.Set(true)
+	s.closed.Set(true)
+	if s.listener != nil {
+		if err := s.listener.Close(); err != nil {
+			logging.DefaultLogger.Warnf("[server] close listener error when draining: %v", err)
+		}
+	}
+
+	logging.DefaultLogger.Infof("[server] start draining sessions, timeout: %v", timeout)
+	deadline := time.Now().Add(timeout)
+	for {
+		sessions := s.sessions.list()
+		if len(sessions) == 0 {
+			logging.DefaultLogger.Infof("[server] all sessions drained")
+			return
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+		for _, cc := range sessions {
+			cc.drain()
+		}
+		time.Sleep(drainCheckInterval)
+	}
+
+	sessions := s.sessions.list()
+	logging.DefaultLogger.Warnf("[server] drain timeout, force close %d sessions", len(sessions))
+	for _, cc := range sessions {
+		cc.forceShutdown()
+	}
+	waitDeadline := time.Now().Add(forceCloseWait)
+	for time.Now().Before(waitDeadline) {
+		if len(s.sessions.list()) == 0 {
+			return
+		}
+		time.Sleep(drainCheckInterval)
+	}
+	// 仍在等待后端返回的会话直接关闭
+	for _, cc := range s.sessions.list() {
+		cc.Close()
+	}
+}
+
+// drain 会话没有正在执行的命令且不在事务中时, 中断等待请求的读取, 会话退出
+func (cc *Session) drain() {
+	if cc.executing.Get() || cc.executor.hasTxConns() {
+		return
+	}
+	cc.c.SetReadDeadline(time.Now())
+}
+
+// forceShutdown 中断正在执行的命令和等待请求的读取, 会话返回ER_SERVER_SHUTDOWN后退出
+func (cc *Session) forceShutdown() {
+	cc.shutdown.Set(true)
+	if cc.executor.cancel != nil {
+		cc.executor.cancel()
+	}
+	cc.c.SetReadDeadline(time.Now())
+}
+
+// writeShutdownError 退出前通知客户端服务正在关闭
+func (cc *Session) writeShutdownError() {
+	cc.c.SetWriteTimeout(rejectConnWriteTimeout)
+	if err := cc.c.writeErrorPacket(mysql.NewDefaultError(mysql.ErrServerShutdown)); err != nil {
+		logging.DefaultLogger.Warnf("Session write shutdown error packet error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+	}
+}
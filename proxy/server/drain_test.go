@@ -0,0 +1,89 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// startDrainSession 模拟会话等待请求, 读取失败时与Session.Run一样退出
+func startDrainSession(t *testing.T, s *Server) (*Session, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	cc := newSession(s, server)
+	s.sessions.add(cc)
+	go func() {
+		defer s.sessions.remove(cc)
+		if _, err := cc.c.ReadEphemeralPacket(); err != nil && cc.shutdown.Get() {
+			cc.writeShutdownError()
+		}
+	}()
+	return cc, client
+}
+
+func TestDrainIdleSession(t *testing.T) {
+	s := &Server{sessions: newSessionSet()}
+	startDrainSession(t, s)
+
+	start := time.Now()
+	s.drain(5 * time.Second)
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("idle session should be closed immediately, cost: %v", cost)
+	}
+	if !s.isDraining() || !s.closed.Get() {
+		t.Errorf("server should be draining and closed")
+	}
+}
+
+func TestDrainForceShutdownTransaction(t *testing.T) {
+	s := &Server{sessions: newSessionSet()}
+	cc, client := startDrainSession(t, s)
+	cc.executor.txConns["slice-0"] = new(mocks.PooledConnect)
+
+	errCh := make(chan error, 1)
+	go func() {
+		data, err := mysql.NewConn(client).ReadPacket()
+		if err == nil {
+			err = errors.New("unexpected packet")
+			if data[0] == mysql.ErrHeader {
+				err = mysql.ParseErrorPacket(data)
+			}
+		}
+		errCh <- err
+	}()
+
+	start := time.Now()
+	s.drain(200 * time.Millisecond)
+	if cost := time.Since(start); cost < 200*time.Millisecond {
+		t.Errorf("session in transaction should be waited until timeout, cost: %v", cost)
+	}
+	if !cc.shutdown.Get() {
+		t.Fatalf("session should be force closed")
+	}
+
+	var sqlErr *mysql.SQLError
+	if err := <-errCh; !errors.As(err, &sqlErr) || sqlErr.SQLCode() != mysql.ErrServerShutdown {
+		t.Errorf("expect ER_SERVER_SHUTDOWN, actual: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// values of gaea_dry_run
+const (
+	dryRunOn    = "on"    // 只返回DML路由到的分片和改写后的SQL, INSERT返回写入行数
+	dryRunCount = "count" // 在on的基础上, 在各个分片执行SELECT COUNT统计UPDATE, DELETE的影响行数
+)
+
+func (se *SessionExecutor) setDryRunVariable(value string) error {
+	switch value {
+	case "0", "off", mysql.KeywordDefault:
+		se.dryRun = ""
+	case "1", dryRunOn:
+		se.dryRun = dryRunOn
+	case dryRunCount:
+		se.dryRun = dryRunCount
+	default:
+		return fmt.Errorf("invalid dry run value: %s", value)
+	}
+	return nil
+}
+
+// isDryRun check if the statement should be dry run instead of executing
+func (se *SessionExecutor) isDryRun(stmtType parser.StatementType) bool {
+	return se.dryRun != "" && isDMLWriteStmt(stmtType)
+}
+
+// executeDryRun 返回DML的路由结果和预估影响行数, 不执行写入
+func (se *SessionExecutor) executeDryRun(reqCtx *util.RequestContext, p plan.Plan) (*mysql.Result, error) {
+	if tp, ok := p.(*temporaryTablePlan); ok {
+		p = tp.Plan
+	}
+
+	ns := se.GetNamespace()
+	dp, err := plan.CreateDryRunPlan(p, ns.GetPhysicalDBs(), ns.GetRouter(), se.sqlMode, se.dryRun == dryRunCount)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := dp.ExecuteIn(reqCtx, se)
+	if err != nil {
+		exeLogger.Warnf("execute dry run: %s", err.Error())
+		return nil, err
+	}
+
+	modifyResultStatus(r, se)
+	return r, nil
+}
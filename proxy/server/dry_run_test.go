@@ -0,0 +1,57 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestSetDryRunVariable(t *testing.T) {
+	se := newSessionExecutor(nil)
+	tests := []struct {
+		sql    string
+		expect string
+		hasErr bool
+	}{
+		{sql: "SET gaea_dry_run = 1", expect: dryRunOn},
+		{sql: "SET gaea_dry_run = off", expect: ""},
+		{sql: "SET SESSION GAEA_DRY_RUN = 'COUNT'", expect: dryRunCount},
+		{sql: "SET gaea_dry_run = 'maybe'", expect: dryRunCount, hasErr: true},
+		{sql: "SET gaea_dry_run = DEFAULT", expect: ""},
+		{sql: "SET @@gaea_dry_run = ON", expect: dryRunOn},
+	}
+	for _, test := range tests {
+		_, err := runTextStmt(t, se, test.sql)
+		if (err != nil) != test.hasErr {
+			t.Fatalf("set dry run error, sql: %s, err: %v", test.sql, err)
+		}
+		if se.dryRun != test.expect {
+			t.Errorf("dry run not equal, sql: %s, expect: %s, actual: %s", test.sql, test.expect, se.dryRun)
+		}
+	}
+
+	if !se.isDryRun(parser.StmtUpdate) || !se.isDryRun(parser.StmtReplace) {
+		t.Errorf("dml should be dry run")
+	}
+	if se.isDryRun(parser.StmtSelect) || se.isDryRun(parser.StmtDDL) {
+		t.Errorf("non-dml should not be dry run")
+	}
+	se.dryRun = ""
+	if se.isDryRun(parser.StmtDelete) {
+		t.Errorf("dml should not be dry run when disabled")
+	}
+}
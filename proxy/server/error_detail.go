@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// withSliceErrorDetail 记录后端返回错误的slice, 其他信息在返回给客户端前补充
+func withSliceErrorDetail(err error, slice string) error {
+	se, ok := err.(*mysql.SQLError)
+	if !ok {
+		return err
+	}
+	return se.WithDetail(&mysql.ErrorDetail{Slice: slice})
+}
+
+// attachErrorDetail attach namespace, sql fingerprint and retryable flag to error returned to client,
+// error which is not SQLError is converted to ER_UNKNOWN_ERROR, same as writing error packet
+func (n *Namespace) attachErrorDetail(sql string, err error) error {
+	var se *mysql.SQLError
+	if !errors.As(err, &se) {
+		se = mysql.NewError(mysql.ErrUnknown, "unknown error: "+err.Error())
+	}
+
+	detail := &mysql.ErrorDetail{}
+	if se.Detail != nil {
+		*detail = *se.Detail
+	}
+	detail.Namespace = n.name
+	// EXECUTE等嵌套执行的语句保留实际执行的SQL指纹
+	if detail.Fingerprint == "" {
+		detail.Fingerprint = mysql.GetMd5(mysql.GetFingerprint(sql))
+	}
+	detail.Retryable = mysql.IsRetryableCode(se.Code)
+	return se.WithDetail(detail)
+}
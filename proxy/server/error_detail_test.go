@@ -0,0 +1,54 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestAttachErrorDetail(t *testing.T) {
+	ns := &Namespace{name: "test_ns", errorDetail: true}
+	sql := "update tbl set a = 1 where id = 2"
+	fingerprint := mysql.GetMd5(mysql.GetFingerprint(sql))
+
+	backendErr := withSliceErrorDetail(mysql.NewDefaultError(mysql.ErrLockDeadlock), "slice-1")
+	err := ns.attachErrorDetail(sql, fmt.Errorf("execute error: %w", backendErr))
+	se, ok := err.(*mysql.SQLError)
+	if !ok {
+		t.Fatalf("expect SQLError, actual: %T", err)
+	}
+	expect := mysql.ErrorDetail{Namespace: "test_ns", Slice: "slice-1", Fingerprint: fingerprint, Retryable: true}
+	if se.Code != mysql.ErrLockDeadlock || *se.Detail != expect {
+		t.Errorf("detail not match, code: %d, detail: %+v", se.Code, se.Detail)
+	}
+
+	err = ns.attachErrorDetail(sql, fmt.Errorf("no backend connection"))
+	se = err.(*mysql.SQLError)
+	message, detail := mysql.ParseErrorDetail(se.FullMessage())
+	if se.Code != mysql.ErrUnknown || message != "unknown error: no backend connection" {
+		t.Errorf("message not match, code: %d, message: %s", se.Code, message)
+	}
+	expect = mysql.ErrorDetail{Namespace: "test_ns", Fingerprint: fingerprint}
+	if detail == nil || *detail != expect {
+		t.Errorf("detail not match: %+v", detail)
+	}
+
+	if err := withSliceErrorDetail(mysql.ErrBadConn, "slice-1"); err != mysql.ErrBadConn {
+		t.Errorf("non SQLError should not be changed: %v", err)
+	}
+}
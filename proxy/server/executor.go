@@ -15,13 +15,12 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/XiaoMi/Gaea/logging"
 	parser2 "github.com/XiaoMi/Gaea/parser"
-	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
 	"github.com/pingcap/parser/format"
-	_ "github.com/pingcap/tidb/types/parser_driver"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +29,7 @@ import (
 
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/core/errors"
+	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/proxy/plan"
 	"github.com/XiaoMi/Gaea/util"
@@ -43,6 +43,8 @@ const (
 	masterComment = "/*master*/"
 	// general query log variable
 	gaeaGeneralLogVariable = "gaea_general_log"
+	// dry run variable of session
+	gaeaDryRunVariable = "gaea_dry_run"
 )
 
 // SessionExecutor is bound to a session, so requests are serializable
@@ -53,6 +55,7 @@ type SessionExecutor struct {
 	user       string
 	db         string
 	clientAddr string
+	connID     uint32
 
 	status       uint16
 	lastInsertID uint64
@@ -64,10 +67,39 @@ type SessionExecutor struct {
 	txConns map[string]backend.PooledConnect
 	txLock  sync.Mutex
 
-	stmtID uint32
-	stmts  map[uint32]*Stmt //prepare相关,client端到proxy的stmt
+	stmtID    uint32
+	stmts     map[uint32]*Stmt //prepare相关,client端到proxy的stmt
+	textStmts map[string]*Stmt // SQL语句PREPARE name FROM ...创建的stmt, key: 小写的name
 
-	parser *parser.Parser
+	userVariables map[string]interface{} // SET @var = ...设置的用户变量, key: 小写的变量名
+
+	parser  parser2.SQLParser
+	sqlMode mysql.SQLMode // 影响解析和改写的sql_mode
+
+	sampled bool // 会话是否被采样, 采样会话的所有语句都会记录采样日志
+
+	outfileDir    string // SELECT ... INTO OUTFILE写入的本地目录, 为空时禁止
+	diagnosticDir string // SET gaea_diagnostic_bundle生成诊断包的目录, 为空时禁止
+	healthCheck   bool   // 连接池校验语句(SELECT 1)由gaea直接返回
+
+	lastQueryProfile *queryProfile // 上一条下发到后端的语句在各分片的执行耗时
+
+	tempTables map[string]bool       // 会话创建的临时表, key: db.table, 小写
+	tempConn   backend.PooledConnect // 存在临时表时独占的default slice主库连接
+
+	txn *transaction // 进行中的事务, 不在事务中时为nil
+
+	clientQueryAttributes bool              // 客户端协商了CLIENT_QUERY_ATTRIBUTES
+	queryAttributes       map[string]string // 当前语句的query attributes, 没有时为nil
+
+	dryRun      string // gaea_dry_run试运行模式, 为空时关闭
+	pinnedSlice string // PIN TO SLICE指定的slice, 不为空时语句不经过路由直接发往该slice
+
+	allowDangerousSQL bool // gaea_allow_dangerous_sql, 允许执行strict_mode拒绝的语句
+
+	// 会话关闭时取消, 中断正在执行的跨分片查询
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Response response info
@@ -92,6 +124,10 @@ const (
 	RespEOF
 	// RespNoop means empty message
 	RespNoop
+	// RespCursor means column definitions of a result set opened as cursor
+	RespCursor
+	// RespFetch means rows fetched from cursor
+	RespFetch
 )
 
 // CreateOKResponse create ok response
@@ -146,6 +182,24 @@ func CreateEOFResponse(status uint16) Response {
 	}
 }
 
+// CreateCursorResponse create cursor response, only column definitions are written
+func CreateCursorResponse(status uint16, result *mysql.Result) Response {
+	return Response{
+		RespType: RespCursor,
+		Status:   status,
+		Data:     result,
+	}
+}
+
+// CreateFetchResponse create fetch response
+func CreateFetchResponse(status uint16, result *StmtFetchResult) Response {
+	return Response{
+		RespType: RespFetch,
+		Status:   status,
+		Data:     result,
+	}
+}
+
 // CreateNoopResponse no op response, for ComStmtClose
 func CreateNoopResponse() Response {
 	return Response{
@@ -154,14 +208,18 @@ func CreateNoopResponse() Response {
 }
 
 func newSessionExecutor(manager *Manager) *SessionExecutor {
-
+	ctx, cancel := context.WithCancel(context.Background())
 	return &SessionExecutor{
 		sessionVariables: mysql.NewSessionVariables(),
 		txConns:          make(map[string]backend.PooledConnect),
 		stmts:            make(map[uint32]*Stmt),
-		parser:           parser.New(),
+		textStmts:        make(map[string]*Stmt),
+		userVariables:    make(map[string]interface{}),
+		parser:           parser2.NewSQLParser(),
 		status:           initClientConnStatus,
 		manager:          manager,
+		ctx:              ctx,
+		cancel:           cancel,
 	}
 }
 
@@ -200,6 +258,30 @@ func (se *SessionExecutor) setStringSessionVariable(name string, valueStr string
 	return se.sessionVariables.Set(name, valueStr)
 }
 
+// setSQLMode set sql_mode of session, and configure the parser with the sql_mode,
+// so statements valid under the client's sql_mode parse and rewrite correctly
+func (se *SessionExecutor) setSQLMode(valueStr string) error {
+	if err := se.setStringSessionVariable(mysql.SQLModeStr, valueStr); err != nil {
+		return err
+	}
+
+	sqlMode := mysql.ModeNone
+	if strings.ToLower(valueStr) != mysql.KeywordDefault {
+		m, err := mysql.GetSQLMode(strings.ToUpper(strings.Trim(valueStr, "'`\"")))
+		if err != nil {
+			return err
+		}
+		sqlMode = m
+	}
+	// ANSI是组合模式, 需要展开
+	if sqlMode&mysql.ModeANSI != 0 {
+		sqlMode |= mysql.ModeRealAsFloat | mysql.ModePipesAsConcat | mysql.ModeANSIQuotes | mysql.ModeIgnoreSpace
+	}
+	se.sqlMode = sqlMode
+	se.parser.SetSQLMode(sqlMode)
+	return nil
+}
+
 func (se *SessionExecutor) setGeneralLogVariable(valueStr string) error {
 	v, err := strconv.Atoi(valueStr)
 	if err != nil {
@@ -269,6 +351,12 @@ func (se *SessionExecutor) GetDatabase() string {
 	return se.db
 }
 
+// GetQueryAttributes return query attributes of current statement, nil if client sent none.
+// 属性值统一转为字符串, 值为NULL的属性不包含在内
+func (se *SessionExecutor) GetQueryAttributes() map[string]string {
+	return se.queryAttributes
+}
+
 // ExecuteCommand execute command
 func (se *SessionExecutor) ExecuteCommand(cmd byte, data []byte) Response {
 	switch cmd {
@@ -282,63 +370,73 @@ func (se *SessionExecutor) ExecuteCommand(cmd byte, data []byte) Response {
 		// handle phase
 		r, err := se.handleQuery(sql)
 		if err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreateResultResponse(se.status, r)
+		return CreateResultResponse(se.resultStatus(r), r)
 	case mysql.ComPing:
-		return CreateOKResponse(se.status)
+		return CreateOKResponse(se.sessionStatus())
 	case mysql.ComInitDB:
 		db := string(data)
 		// handle phase
 		err := se.handleUseDB(db)
 		if err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreateOKResponse(se.status)
+		return CreateOKResponse(se.sessionStatus())
 	case mysql.ComFieldList:
 		fs, err := se.handleFieldList(data)
 		if err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreateFieldListResponse(se.status, fs)
+		return CreateFieldListResponse(se.sessionStatus(), fs)
 	case mysql.ComStmtPrepare:
 		sql := string(data)
 		stmt, err := se.handleStmtPrepare(sql)
 		if err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreatePrepareResponse(se.status, stmt)
+		return CreatePrepareResponse(se.sessionStatus(), stmt)
 	case mysql.ComStmtExecute:
 		values := make([]byte, len(data))
 		copy(values, data)
-		r, err := se.handleStmtExecute(values)
+		r, cursorOpened, err := se.handleStmtExecute(values)
+		if err != nil {
+			return CreateErrorResponse(se.sessionStatus(), err)
+		}
+		if cursorOpened {
+			return CreateCursorResponse(se.resultStatus(r)|mysql.ServerStatusCursorExists, r)
+		}
+		return CreateResultResponse(se.resultStatus(r), r)
+	case mysql.ComStmtFetch:
+		r, err := se.handleStmtFetch(data)
 		if err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreateResultResponse(se.status, r)
+		if r.Last {
+			return CreateFetchResponse(se.sessionStatus()|mysql.ServerStatusLastRowSend, r)
+		}
+		return CreateFetchResponse(se.sessionStatus()|mysql.ServerStatusCursorExists, r)
 	case mysql.ComStmtClose: // no response
 		if err := se.handleStmtClose(data); err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
 		return CreateNoopResponse()
 	case mysql.ComStmtSendLongData: // no response
-		values := make([]byte, len(data))
-		copy(values, data)
-		if err := se.handleStmtSendLongData(values); err != nil {
-			return CreateErrorResponse(se.status, err)
+		if err := se.handleStmtSendLongData(data); err != nil {
+			exeLogger.Warnf("handle stmt send long data failed, namespace: %s, error: %v", se.namespace, err)
 		}
 		return CreateNoopResponse()
 	case mysql.ComStmtReset:
 		if err := se.handleStmtReset(data); err != nil {
-			return CreateErrorResponse(se.status, err)
+			return CreateErrorResponse(se.sessionStatus(), err)
 		}
-		return CreateOKResponse(se.status)
+		return CreateOKResponse(se.sessionStatus())
 	case mysql.ComSetOption:
-		return CreateEOFResponse(se.status)
+		return CreateEOFResponse(se.sessionStatus())
 	default:
 		msg := fmt.Sprintf("command %d not supported now", cmd)
 		exeLogger.Warnf("dispatch command failed, error: %s", msg)
-		return CreateErrorResponse(se.status, mysql.NewError(mysql.ErrUnknown, msg))
+		return CreateErrorResponse(se.sessionStatus(), mysql.NewError(mysql.ErrUnknown, msg))
 	}
 }
 
@@ -357,8 +455,14 @@ func (se *SessionExecutor) getBackendConns(sqls map[string]map[string][]string,
 
 func (se *SessionExecutor) getBackendConn(sliceName string, fromSlave bool) (pc backend.PooledConnect, err error) {
 	if !se.isInTransaction() {
+		if sliceName == backend.DefaultSlice && se.tempConn != nil {
+			return se.tempConn, nil
+		}
 		slice := se.GetNamespace().GetSlice(sliceName)
-		return slice.GetConn(fromSlave, se.GetNamespace().GetUserProperty(se.user))
+		if pc, err = slice.GetConn(fromSlave, se.GetNamespace().GetUserProperty(se.user)); err != nil {
+			se.manager.RecordBackendTimeout(se.namespace, sliceName, err)
+		}
+		return
 	}
 	return se.getTransactionConn(sliceName)
 }
@@ -371,35 +475,47 @@ func (se *SessionExecutor) getTransactionConn(sliceName string) (pc backend.Pool
 	pc, ok = se.txConns[sliceName]
 
 	if !ok {
-		slice := se.GetNamespace().GetSlice(sliceName) // returns nil only when the conf is error (fatal) so panic is correct
-		if pc, err = slice.GetMasterConn(); err != nil {
-			return
+		if sliceName == backend.DefaultSlice && se.tempConn != nil {
+			pc = se.tempConn // 临时表所在的连接
+		} else {
+			slice := se.GetNamespace().GetSlice(sliceName) // returns nil only when the conf is error (fatal) so panic is correct
+			if pc, err = slice.GetMasterConn(); err != nil {
+				se.manager.RecordBackendTimeout(se.namespace, sliceName, err)
+				return
+			}
 		}
 
 		if !se.isAutoCommit() {
 			if err = pc.SetAutoCommit(0); err != nil {
-				pc.Close()
-				pc.Recycle()
+				se.closeBackendConn(pc)
 				return
 			}
 		} else {
 			if err = pc.Begin(); err != nil {
-				pc.Close()
-				pc.Recycle()
+				se.closeBackendConn(pc)
 				return
 			}
 		}
 
+		se.beginTransaction()
+		se.txn.addSlice(sliceName)
 		se.txConns[sliceName] = pc
 	}
 
 	return
 }
 
-func (se *SessionExecutor) executeInSlice(reqCtx *util.RequestContext, pc backend.PooledConnect, sql string) ([]*mysql.Result, error) {
+// executeInSlice execute sql in pc, the executing statement is killed and pc is closed when ctx is done
+func (se *SessionExecutor) executeInSlice(ctx context.Context, reqCtx *util.RequestContext, pc backend.PooledConnect, slice, sql string) ([]*mysql.Result, error) {
 	startTime := time.Now()
-	r, err := pc.Execute(sql)
-	se.manager.RecordBackendSQLMetrics(reqCtx, se.namespace, sql, pc.GetAddr(), startTime, err)
+	stop := interruptOnCancel(ctx, pc)
+	r, err := se.executeInConn(pc, slice, sql)
+	stop()
+	if err != nil && ctx.Err() == context.Canceled {
+		err = errQueryInterrupted
+	}
+	se.manager.RecordBackendSQLMetrics(reqCtx, se.namespace, slice, sql, pc.GetAddr(), startTime, err)
+	recordBackendSample(reqCtx, slice, pc.GetAddr(), sql, startTime, r, err)
 
 	if err != nil {
 		return nil, err
@@ -408,12 +524,34 @@ func (se *SessionExecutor) executeInSlice(reqCtx *util.RequestContext, pc backen
 	return []*mysql.Result{r}, err
 }
 
+// executeInConn execute sql in backend connection, with faults injected if fault injection enabled
+func (se *SessionExecutor) executeInConn(pc backend.PooledConnect, slice, sql string) (*mysql.Result, error) {
+	if f := se.manager.GetFaultInjector().Inject(se.namespace, slice, sql); f != nil {
+		if f.Latency > 0 {
+			time.Sleep(f.Latency)
+		}
+		if f.ResetConn {
+			// 关闭后的连接在回收时会被连接池丢弃
+			pc.Close()
+			return nil, mysql.ErrBadConn
+		}
+		if f.Err != nil {
+			return nil, f.Err
+		}
+	}
+	r, err := pc.Execute(sql)
+	if err != nil && se.GetNamespace().errorDetail {
+		return nil, withSliceErrorDetail(err, slice)
+	}
+	return r, err
+}
+
 func (se *SessionExecutor) recycleBackendConn(pc backend.PooledConnect, rollback bool) {
 	if pc == nil {
 		return
 	}
 
-	if se.isInTransaction() {
+	if se.isInTransaction() || se.isTempConn(pc) {
 		return
 	}
 
@@ -430,7 +568,7 @@ func (se *SessionExecutor) recycleBackendConns(pcs map[string]backend.PooledConn
 	}
 
 	for _, pc := range pcs {
-		if pc == nil {
+		if pc == nil || se.isTempConn(pc) {
 			continue
 		}
 		if rollback {
@@ -474,14 +612,10 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 		return nil, errors.ErrConnNotEqual
 	}
 
-	var wg sync.WaitGroup
-
 	if len(pcs) == 0 {
 		return nil, errors.ErrNoPlan
 	}
 
-	wg.Add(len(pcs))
-
 	resultCount := 0
 	for _, sqlSlice := range sqls {
 		for _, sqlDB := range sqlSlice {
@@ -491,38 +625,80 @@ func (se *SessionExecutor) executeInMultiSlices(reqCtx *util.RequestContext, pcs
 
 	rs := make([]interface{}, resultCount)
 
-	f := func(reqCtx *util.RequestContext, rs []interface{}, i int, execSqls map[string][]string, pc backend.PooledConnect) {
+	execSlice := func(sliceName string, execSqls map[string][]string, pc backend.PooledConnect) []interface{} {
+		// 在各分片的goroutine中执行, 采样时单独统计CPU时间
+		defer getResourceUsage(reqCtx).trackCPU()()
+		var results []interface{}
 		for db, sqls := range execSqls {
 			err := initBackendConn(pc, db, se.GetCharset(), se.GetCollationID(), se.GetVariables())
 			if err != nil {
-				rs[i] = err
+				results = append(results, err)
 				break
 			}
 			for _, v := range sqls {
 				startTime := time.Now()
-				r, err := pc.Execute(v)
-				se.manager.RecordBackendSQLMetrics(reqCtx, se.namespace, v, pc.GetAddr(), startTime, err)
+				r, err := se.executeInConn(pc, sliceName, v)
+				se.manager.RecordBackendSQLMetrics(reqCtx, se.namespace, sliceName, v, pc.GetAddr(), startTime, err)
+				recordBackendSample(reqCtx, sliceName, pc.GetAddr(), v, startTime, r, err)
 				if err != nil {
-					rs[i] = err
+					results = append(results, err)
 				} else {
-					rs[i] = r
+					results = append(results, r)
 				}
-				i++
 			}
 		}
-		wg.Done()
+		return results
+	}
+
+	hedge := se.getHedgeReadTracker(reqCtx, len(pcs))
+	sliceNames := make([]string, 0, len(pcs))
+	winners := make([]backend.PooledConnect, len(pcs))
+
+	offsets := make([]int, 0, len(pcs))
+	f := func(j int) error {
+		sliceName, i := sliceNames[j], offsets[j]
+		execSqls, pc := sqls[sliceName], pcs[sliceName]
+		if hedge == nil {
+			results := execSlice(sliceName, execSqls, pc)
+			copy(rs[i:], results)
+			return firstErrorResult(results)
+		}
+		results, winner := se.executeInSliceWithHedge(hedge, sliceName, pc, func(pc backend.PooledConnect) []interface{} {
+			return execSlice(sliceName, execSqls, pc)
+		})
+		copy(rs[i:], results)
+		winners[j] = winner
+		return firstErrorResult(results)
 	}
 
 	offset := 0
-	for sliceName, pc := range pcs {
-		s := sqls[sliceName] //map[string][]string
-		go f(reqCtx, rs, offset, s, pc)
+	for sliceName := range pcs {
+		sliceNames = append(sliceNames, sliceName)
+		offsets = append(offsets, offset)
 		for _, sqlDB := range sqls[sliceName] {
 			offset += len(sqlDB)
 		}
 	}
 
-	wg.Wait()
+	// 某个分片出错时终止其他分片正在执行的语句, 会话关闭时还要关闭被中断的连接, 回收时由连接池丢弃
+	scatterErr := runScatter(se.context(), len(sliceNames), f, func(j int, abort bool) {
+		killBackendQuery(pcs[sliceNames[j]], abort)
+	})
+
+	if hedge != nil {
+		// 对冲请求先返回时使用对冲请求的连接, 原连接在执行结束后已单独回收
+		for j, sliceName := range sliceNames {
+			if winners[j] != nil {
+				pcs[sliceName] = winners[j]
+			}
+		}
+	}
+
+	if scatterErr == context.Canceled {
+		return nil, errQueryInterrupted
+	} else if scatterErr != nil {
+		return nil, scatterErr
+	}
 
 	var err error
 	r := make([]*mysql.Result, resultCount)
@@ -584,8 +760,154 @@ func isSQLNotAllowedByUser(c *SessionExecutor, stmtType parser2.StatementType) b
 	return stmtType == parser2.StmtDelete || stmtType == parser2.StmtInsert || stmtType == parser2.StmtUpdate
 }
 
+// checkNamespaceReadOnly 如果namespace只读(维护中), 且SQL是写操作, 则拒绝执行, 只读例外表除外.
+// 配置了例外表时需要解析SQL, 返回解析出的语句供生成执行计划时复用, 其他情况返回nil
+func (se *SessionExecutor) checkNamespaceReadOnly(stmtType parser2.StatementType, sql string) (ast.StmtNode, error) {
+	if !isNamespaceReadOnlyFor(se, stmtType) {
+		return nil, nil
+	}
+	if !se.GetNamespace().HasReadOnlyExceptTables() {
+		return nil, newNamespaceReadOnlyError()
+	}
+
+	n, err := se.Parse(sql)
+	if err != nil {
+		return nil, newNamespaceReadOnlyError()
+	}
+	tables := &tableNameCollector{}
+	parser2.Visit(n, tables)
+	if !isTablesWritableInReadOnly(se, tables.names) {
+		return nil, newNamespaceReadOnlyError()
+	}
+	return n, nil
+}
+
+// checkStmtNamespaceReadOnly 预处理语句的只读检查, 语句中的表在预处理后不变, 只在第一次检查时解析
+func (se *SessionExecutor) checkStmtNamespaceReadOnly(s *Stmt) error {
+	if !isNamespaceReadOnlyFor(se, parser2.PreviewSql(s.sql)) {
+		return nil
+	}
+	if !se.GetNamespace().HasReadOnlyExceptTables() {
+		return newNamespaceReadOnlyError()
+	}
+
+	if s.tables == nil {
+		n, err := se.Parse(s.sql)
+		if err != nil {
+			return newNamespaceReadOnlyError()
+		}
+		tables := &tableNameCollector{}
+		parser2.Visit(n, tables)
+		s.tables = tables.names
+	}
+	if !isTablesWritableInReadOnly(se, s.tables) {
+		return newNamespaceReadOnlyError()
+	}
+	return nil
+}
+
+// isNamespaceReadOnlyFor namespace只读且SQL是写操作时返回true, 不考虑只读例外表
+func isNamespaceReadOnlyFor(c *SessionExecutor, stmtType parser2.StatementType) bool {
+	return isWriteStmt(stmtType) && c.GetNamespace().IsReadOnly()
+}
+
+// isTablesWritableInReadOnly 所有表都是只读例外表时返回true, 没有表时返回false
+func isTablesWritableInReadOnly(c *SessionExecutor, tables []*ast.TableName) bool {
+	if len(tables) == 0 {
+		return false
+	}
+	ns := c.GetNamespace()
+	for _, t := range tables {
+		db := t.Schema.O
+		if db == "" {
+			db = c.db
+		}
+		if !ns.IsTableWritableInReadOnly(db, t.Name.O) {
+			return false
+		}
+	}
+	return true
+}
+
+func newNamespaceReadOnlyError() error {
+	return mysql.NewError(mysql.ErrReadOnlyMode, "namespace is read only for maintenance, write is not allowed")
+}
+
+// 如果SQL是KILL, FLUSH等管理语句, 且用户没有相应的管理角色, 则拒绝执行, 返回需要的角色
+func isSQLNotAllowedByAdminRole(c *SessionExecutor, stmtType parser2.StatementType, sql string) (string, bool) {
+	role := getAdminStmtRole(stmtType, sql)
+	if role == "" {
+		return "", false
+	}
+	return role, !c.GetNamespace().IsAdminRoleAllowed(c.user, role)
+}
+
+// getAdminStmtAction 返回管理语句的类型(小写的第一个单词), 不是管理语句时返回空字符串
+func getAdminStmtAction(stmtType parser2.StatementType, sql string) string {
+	if stmtType != parser2.StmtUnknown && stmtType != parser2.StmtDDL {
+		return ""
+	}
+	trimmed, _ := parser2.SplitMarginComments(sql)
+	firstWord := trimmed
+	if i := strings.IndexAny(trimmed, " \t\r\n("); i != -1 {
+		firstWord = trimmed[:i]
+	}
+	switch firstWord = strings.ToLower(firstWord); firstWord {
+	case "kill", "flush", pinStmtAction, unpinStmtAction:
+		return firstWord
+	}
+	return ""
+}
+
+// getAdminStmtRole 返回执行管理语句需要的角色, 不是管理语句时返回空字符串
+func getAdminStmtRole(stmtType parser2.StatementType, sql string) string {
+	// 任何用户都可以UNPIN
+	switch getAdminStmtAction(stmtType, sql) {
+	case "kill", "flush":
+		return models.AdminRoleOperator
+	case pinStmtAction:
+		return models.AdminRoleAdmin
+	}
+	if stmtType == parser2.StmtShow && isShowTop(sql) {
+		return models.AdminRoleViewer
+	}
+	return ""
+}
+
+func isWriteStmt(stmtType parser2.StatementType) bool {
+	switch stmtType {
+	case parser2.StmtInsert, parser2.StmtReplace, parser2.StmtUpdate, parser2.StmtDelete, parser2.StmtDDL:
+		return true
+	default:
+		return false
+	}
+}
+
+// isDMLWriteStmt INSERT, REPLACE, UPDATE, DELETE
+func isDMLWriteStmt(stmtType parser2.StatementType) bool {
+	return isWriteStmt(stmtType) && stmtType != parser2.StmtDDL
+}
+
+// tableNameCollector collect all table names in ast
+type tableNameCollector struct {
+	names []*ast.TableName
+}
+
+// Enter implement ast.Visitor
+func (t *tableNameCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if name, ok := n.(*ast.TableName); ok {
+		t.names = append(t.names, name)
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (t *tableNameCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
 func modifyResultStatus(r *mysql.Result, cc *SessionExecutor) {
-	r.Status = r.Status | cc.GetStatus()
+	r.Status = cc.resultStatus(r)
 }
 
 func createShowDatabaseResult(dbs []string) (*mysql.Result, error) {
@@ -642,11 +964,34 @@ func getFromSlave(reqCtx *util.RequestContext) bool {
 	return false
 }
 
+// 分片在运行时被禁止读或写时, 快速失败
+func (se *SessionExecutor) checkSliceEnabled(reqCtx *util.RequestContext, slice string) error {
+	rt := se.GetNamespace().GetRouter()
+	stmtType, _ := reqCtx.Get(util.StmtType).(parser2.StatementType)
+	if isWriteStmt(stmtType) {
+		if !rt.IsSliceWriteEnabled(slice) {
+			return fmt.Errorf("%w, slice: %s", errors.ErrSliceWriteDisabled, slice)
+		}
+		return nil
+	}
+	if !rt.IsSliceReadEnabled(slice) {
+		return fmt.Errorf("%w, slice: %s", errors.ErrSliceReadDisabled, slice)
+	}
+	return nil
+}
+
 func (se *SessionExecutor) isInTransaction() bool {
 	return se.status&mysql.ServerStatusInTrans > 0 ||
 		!se.isAutoCommit()
 }
 
+// hasTxConns 事务是否持有后端连接
+func (se *SessionExecutor) hasTxConns() bool {
+	se.txLock.Lock()
+	defer se.txLock.Unlock()
+	return len(se.txConns) > 0
+}
+
 func (se *SessionExecutor) isAutoCommit() bool {
 	return se.status&mysql.ServerStatusAutocommit > 0
 }
@@ -661,6 +1006,7 @@ func (se *SessionExecutor) handleBegin() error {
 		}
 	}
 	se.status |= mysql.ServerStatusInTrans
+	se.beginTransaction()
 	return nil
 }
 
@@ -683,14 +1029,20 @@ func (se *SessionExecutor) commit() (err error) {
 
 	se.status &= ^mysql.ServerStatusInTrans
 
+	if len(se.txConns) > 1 {
+		err = se.commitSlices()
+	}
 	for _, pc := range se.txConns {
-		if e := pc.Commit(); e != nil {
-			err = e
+		if len(se.txConns) == 1 {
+			err = pc.Commit()
+		}
+		if !se.isTempConn(pc) {
+			pc.Recycle()
 		}
-		pc.Recycle()
 	}
 
 	se.txConns = make(map[string]backend.PooledConnect)
+	se.endTransaction(commitResult(err))
 	return
 }
 
@@ -704,10 +1056,13 @@ func (se *SessionExecutor) rollback() (err error) {
 		if e := pc.Rollback(); e != nil {
 			err = e
 		}
-		pc.Recycle()
+		if !se.isTempConn(pc) {
+			pc.Recycle()
+		}
 	}
 
 	se.txConns = make(map[string]backend.PooledConnect)
+	se.endTransaction(txResultRollback)
 	return
 }
 
@@ -737,6 +1092,10 @@ func (se *SessionExecutor) executeSQLNoData(reqCtx *util.RequestContext, slice,
 
 // ExecuteSQL execute parser
 func (se *SessionExecutor) ExecuteSQL(reqCtx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
+	if err := se.checkSliceEnabled(reqCtx, slice); err != nil {
+		return nil, err
+	}
+
 	pc, err := se.getBackendConn(slice, getFromSlave(reqCtx))
 	defer se.recycleBackendConn(pc, false)
 	if err != nil {
@@ -757,14 +1116,14 @@ func (se *SessionExecutor) ExecuteSQL(reqCtx *util.RequestContext, slice, db, sq
 	}
 
 	// execute.parser may be rewritten in getShowExecDB
-	rs, err := se.executeInSlice(reqCtx, pc, sql)
+	rs, err := se.executeInSlice(se.context(), reqCtx, pc, slice, sql)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(rs) == 0 {
 		msg := fmt.Sprintf("result is empty")
-		exeLogger.Warnf("[server] Session handle Unsupport: %s, parser: %s", msg, sql)
+		exeLogger.Warnf("[server] Session handle Unsupport: %s, parser: %s", msg, se.GetNamespace().redactSQL(sql))
 		return nil, mysql.NewError(mysql.ErrUnknown, msg)
 	}
 	return rs[0], nil
@@ -776,6 +1135,12 @@ func (se *SessionExecutor) ExecuteSQLs(reqCtx *util.RequestContext, sqls map[str
 		return nil, fmt.Errorf("no parser to execute")
 	}
 
+	for sliceName := range sqls {
+		if err := se.checkSliceEnabled(reqCtx, sliceName); err != nil {
+			return nil, err
+		}
+	}
+
 	pcs, err := se.getBackendConns(sqls, getFromSlave(reqCtx))
 	defer se.recycleBackendConns(pcs, false)
 	if err != nil {
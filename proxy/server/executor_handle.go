@@ -21,6 +21,7 @@ import (
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/proxy/plan"
@@ -30,19 +31,32 @@ import (
 	"github.com/pingcap/parser/model"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// Parse parse parser
+// Parse parse sql with parse limits of namespace
 func (se *SessionExecutor) Parse(sql string) (ast.StmtNode, error) {
-	return se.parser.ParseOneStmt(sql, "", "")
+	var limits parser.ParseLimits
+	if se.manager != nil {
+		if ns := se.GetNamespace(); ns != nil {
+			limits = ns.parseLimits
+		}
+	}
+	n, err := parser.ParseWithLimits(se.parser, sql, limits)
+	if parser.IsParseTimeout(err) {
+		// 超时的解析仍在使用原parser, 需要换一个新的
+		se.parser = parser.NewSQLParser()
+		se.parser.SetSQLMode(se.sqlMode)
+	}
+	return n, err
 }
 
 // 处理query语句
 func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error) {
 	defer func() {
 		if e := recover(); e != nil {
-			exeLogger.Warnf("handle query command failed, error: %v, parser: %s", e, sql)
+			exeLogger.Warnf("handle query command failed, error: %v, parser: %s", e, se.GetNamespace().redactSQL(sql))
 
 			if err, ok := e.(error); ok {
 				const size = 4096
@@ -50,7 +64,7 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 				buf = buf[:runtime.Stack(buf, false)]
 
 				exeLogger.Warnf("handle query command catch panic error, parser: %s, error: %s, stack: %s",
-					sql, err.Error(), string(buf))
+					se.GetNamespace().redactSQL(sql), err.Error(), string(buf))
 			}
 
 			err = errors.ErrInternalServer
@@ -60,12 +74,22 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 
 	sql = strings.TrimRight(sql, ";") //删除sql语句最后的分号
 
+	// 连接池校验语句可能占很大比例的QPS, 跳过黑名单、统计和执行计划直接返回
+	if se.healthCheck && isHealthCheckQuery(sql) {
+		return createHealthCheckResult()
+	}
+
 	reqCtx := util.NewRequestContext()
-	// check black parser
 	ns := se.GetNamespace()
+	// 在指纹计算和解析之前检查, 避免超长的语句占用CPU
+	if err := ns.checkSQLLimits(sql); err != nil {
+		exeLogger.Warnf("sql exceeds limits, ns: %s, user: %s, length: %d, err: %v", ns.GetName(), se.user, len(sql), err)
+		return nil, err
+	}
+	// check black parser
 	if !ns.IsSQLAllowed(reqCtx, sql) {
 		fingerprint := mysql.GetFingerprint(sql)
-		exeLogger.Warnf("catch black parser, parser: %s", sql)
+		exeLogger.Warnf("catch black parser, parser: %s", ns.redactSQL(sql))
 		se.manager.GetStatisticManager().RecordSQLForbidden(fingerprint, se.GetNamespace().GetName())
 		err := mysql.NewError(mysql.ErrUnknown, "parser in blacklist")
 		return nil, err
@@ -74,9 +98,25 @@ func (se *SessionExecutor) handleQuery(sql string) (r *mysql.Result, err error)
 	startTime := time.Now()
 	stmtType := parser.PreviewSql(sql)
 	reqCtx.Set(util.StmtType, stmtType)
+	if se.shouldSample(ns) {
+		reqCtx.Set(util.SampleTrace, &sampleTrace{})
+	}
+
+	reqCtx.Set(util.QueryProfile, &queryProfile{})
 
-	r, err = se.doQuery(reqCtx, sql)
+	if ns.sampleResourceStats() {
+		r, err = se.doQueryWithResourceUsage(reqCtx, ns, sql)
+	} else {
+		r, err = se.doQuery(reqCtx, sql)
+	}
+	se.recordTransactionStatement(stmtType, sql)
+	se.auditAdminStmt(stmtType, sql, err)
+	se.saveQueryProfile(reqCtx)
 	se.manager.RecordSessionSQLMetrics(reqCtx, se, sql, startTime, err)
+	se.logSample(reqCtx, sql, startTime, r, err)
+	if err != nil && ns.errorDetail {
+		err = ns.attachErrorDetail(sql, err)
+	}
 	return r, err
 }
 
@@ -87,20 +127,78 @@ func (se *SessionExecutor) doQuery(reqCtx *util.RequestContext, sql string) (*my
 		return nil, fmt.Errorf("write DML is now allowed by read user")
 	}
 
+	// 只读检查解析过的语句在生成执行计划时复用
+	parsed, err := se.checkNamespaceReadOnly(stmtType, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	if role, denied := isSQLNotAllowedByAdminRole(se, stmtType, sql); denied {
+		return nil, mysql.NewDefaultError(mysql.ErrSpecificAccessDenied, "gaea "+role+" role")
+	}
+
+	if err := se.checkDangerousSQL(stmtType, sql); err != nil {
+		return nil, err
+	}
+
+	switch getAdminStmtAction(stmtType, sql) {
+	case pinStmtAction, unpinStmtAction:
+		return se.handlePinStmt(sql)
+	}
+	if se.pinnedSlice != "" && isPinnableStmt(stmtType) {
+		return se.executeInPinnedSlice(reqCtx, stmtType, sql)
+	}
+
+	if stmtType == parser.StmtSelect {
+		query, vars, err := parser.SplitSelectIntoVars(sql)
+		if err != nil {
+			return nil, err
+		}
+		if len(vars) != 0 {
+			return se.handleSelectIntoVars(reqCtx, query, vars)
+		}
+	}
+
 	if stmtType.CanHandleWithoutPlan() {
 		return se.handleQueryWithoutPlan(reqCtx, sql)
 	}
 
 	db := se.db
 
-	p, err := se.getPlan(se.GetNamespace(), db, sql)
+	p, err := se.getPlan(reqCtx, se.GetNamespace(), db, sql, parsed)
 	if err != nil {
-		return nil, fmt.Errorf("get plan error, db: %s, parser: %s, err: %v", db, sql, err)
+		return nil, fmt.Errorf("get plan error, db: %s, parser: %s, err: %w", db, sql, err)
+	}
+	recordPlanSample(reqCtx, p)
+
+	if se.isDryRun(stmtType) {
+		return se.executeDryRun(reqCtx, p)
+	}
+
+	if isDMLWriteStmt(stmtType) {
+		key, err := getIdempotencyKey(sql)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			if p, err = se.wrapIdempotentPlan(se.GetNamespace(), key, p); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	if canExecuteFromSlave(se, sql) {
 		reqCtx.Set(util.FromSlave, 1)
 	}
+	if se.outfileDir != "" {
+		reqCtx.Set(util.OutfileDir, se.outfileDir)
+	}
+	if v, ok := se.sessionVariables.Get(mysql.TimeZone); ok {
+		reqCtx.Set(util.TimeZone, v.(*mysql.Variable).Get())
+	}
+	if spill := se.GetNamespace().mergeSpill; spill != nil {
+		reqCtx.Set(util.MergeSpill, spill)
+	}
 
 	r, err := p.ExecuteIn(reqCtx, se)
 	if err != nil {
@@ -108,24 +206,46 @@ func (se *SessionExecutor) doQuery(reqCtx *util.RequestContext, sql string) (*my
 		return nil, err
 	}
 
+	if err = checkVersionConflict(reqCtx, r); err != nil {
+		return nil, err
+	}
+
+	if err = applyResultTransforms(reqCtx, r); err != nil {
+		return nil, fmt.Errorf("transform result error: %v", err)
+	}
+
 	modifyResultStatus(r, se)
+	se.fireRowChangeHooks(reqCtx, r)
 
 	return r, nil
 }
 
 // 处理逻辑较简单的SQL, 不走执行计划部分
 func (se *SessionExecutor) handleQueryWithoutPlan(reqCtx *util.RequestContext, sql string) (*mysql.Result, error) {
+	if isShowLastQueryProfile(sql) {
+		return se.handleShowLastQueryProfile()
+	}
+	if stmt, ok := parseShowTop(sql); ok {
+		return se.handleShowTop(stmt)
+	}
+	if isShowShardingRules(sql) {
+		return se.handleShowShardingRules()
+	}
+
 	n, err := se.Parse(sql)
 	if err != nil {
+		if limitErr := parseLimitSQLError(err); limitErr != nil {
+			return nil, limitErr
+		}
 		stmtType := reqCtx.Get(util.StmtType).(parser.StatementType)
 		if stmtType == parser.StmtShow { // SHOW SLAVE STATUS 等无法被 parse 解析, 应该屏蔽结果，使得某些客户端可以使用
 			if r, err := se.executeSQLNoData(reqCtx, backend.DefaultSlice, se.db, sql); err == nil {
 				return r, nil
 			}
 		} else {
-			logging.DefaultLogger.Warnf("parse parser error, parser: %s, err: %v", sql, err)
+			logging.DefaultLogger.Warnf("parse parser error, parser: %s, err: %s", se.GetNamespace().redactSQL(sql), se.GetNamespace().redactError(sql, err))
 		}
-		return nil, errors.ErrCmdUnsupport
+		return nil, mysql.UnsupportedCommand.Err()
 	}
 
 	switch stmt := n.(type) {
@@ -141,8 +261,14 @@ func (se *SessionExecutor) handleQueryWithoutPlan(reqCtx *util.RequestContext, s
 		return nil, se.handleRollback()
 	case *ast.UseStmt:
 		return nil, se.handleUseDB(stmt.DBName)
+	case *ast.PrepareStmt:
+		return nil, se.handleTextPrepare(stmt)
+	case *ast.ExecuteStmt:
+		return se.handleTextExecute(stmt)
+	case *ast.DeallocateStmt:
+		return nil, se.handleTextDeallocate(stmt)
 	default:
-		return nil, fmt.Errorf("cannot handle parser without plan, ns: %s, parser: %s", se.namespace, sql)
+		return nil, mysql.UnsupportedCommand.Err()
 	}
 }
 
@@ -159,21 +285,42 @@ func (se *SessionExecutor) handleUseDB(dbName string) error {
 	return mysql.NewDefaultError(mysql.ErrNoDB)
 }
 
-func (se *SessionExecutor) getPlan(ns *Namespace, db string, sql string) (plan.Plan, error) {
-	n, err := se.Parse(sql)
+// getPlan 生成执行计划, n为已经解析好的语句, 为nil时解析sql
+func (se *SessionExecutor) getPlan(reqCtx *util.RequestContext, ns *Namespace, db string, sql string, n ast.StmtNode) (plan.Plan, error) {
+	var err error
+	if n == nil {
+		n, err = se.Parse(sql)
+	}
 	if err != nil {
+		// 超过解析限制的语句不能透传
+		if limitErr := parseLimitSQLError(err); limitErr != nil {
+			return nil, limitErr
+		}
+		if ns.unparseablePassThrough {
+			stmtType := reqCtx.Get(util.StmtType).(parser.StatementType)
+			return createPassThroughPlan(ns, se.user, db, sql, stmtType)
+		}
 		return nil, fmt.Errorf("parse parser error, parser: %s, err: %v", sql, err)
 	}
 
+	if err := rewriteViews(ns, db, n); err != nil {
+		return nil, fmt.Errorf("expand view error: %v", err)
+	}
+	recordResultTransforms(reqCtx, ns, n, db, se.user)
+	rewriteMaterializedViews(ns, db, n)
+	rewriteVersionColumn(reqCtx, ns, db, n)
 	rt := ns.GetRouter()
+	recordRowChange(reqCtx, n, db, rt)
 	seq := ns.GetSequences()
 	phyDBs := ns.GetPhysicalDBs()
-	p, err := plan.BuildPlan(n, phyDBs, db, sql, rt, seq)
+	p, err := plan.BuildPlanWithSQLMode(n, phyDBs, db, sql, rt, seq, se.sqlMode)
 	if err != nil {
-		return nil, fmt.Errorf("create select plan error: %v", err)
+		return nil, fmt.Errorf("create select plan error: %w", err)
 	}
+	se.auditRouting(ns, db, sql, p)
+	p = pushDownCTE(ns, db, sql, p)
 
-	return p, nil
+	return se.wrapTemporaryTablePlan(ns, db, n, p)
 }
 
 func (se *SessionExecutor) handleShow(reqCtx *util.RequestContext, sql string, stmt *ast.ShowStmt, node ast.StmtNode) (*mysql.Result, error) {
@@ -215,6 +362,16 @@ func (se *SessionExecutor) handleShow(reqCtx *util.RequestContext, sql string, s
 			return nil, fmt.Errorf("execute parser error, parser: %s, err: %v", sql, err)
 		}
 		return r, nil
+	case ast.ShowProcessList:
+		r, err := se.ExecuteSQL(reqCtx, backend.DefaultSlice, se.db, sql)
+		if err != nil {
+			return nil, fmt.Errorf("execute parser error, parser: %s, err: %v", sql, err)
+		}
+		if err := se.appendCommitProgress(r); err != nil {
+			return nil, err
+		}
+		modifyResultStatus(r, se)
+		return r, nil
 	case ast.ShowVariables:
 		if strings.Contains(sql, gaeaGeneralLogVariable) {
 			return createShowGeneralLogResult(), nil
@@ -240,9 +397,38 @@ func (se *SessionExecutor) handleSet(reqCtx *util.RequestContext, sql string, st
 	return nil, nil
 }
 
+// handleSetGeneralLogVariable set general log of proxy, require admin role if rbac of admin statements is enabled
+func (se *SessionExecutor) handleSetGeneralLogVariable(name, value string) error {
+	if !se.GetNamespace().IsAdminRoleAllowed(se.user, models.AdminRoleAdmin) {
+		return mysql.NewDefaultError(mysql.ErrSpecificAccessDenied, "gaea "+models.AdminRoleAdmin+" role")
+	}
+	onOffValue, err := getOnOffVariable(value)
+	if err != nil {
+		return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, value)
+	}
+	return se.setGeneralLogVariable(onOffValue)
+}
+
+// handleSetDiagnosticBundleVariable 生成诊断包, value为诊断包文件名中的标签, 如工单号
+func (se *SessionExecutor) handleSetDiagnosticBundleVariable(value string) (string, error) {
+	if !se.GetNamespace().IsAdminRoleAllowed(se.user, models.AdminRoleAdmin) {
+		return "", mysql.NewDefaultError(mysql.ErrSpecificAccessDenied, "gaea "+models.AdminRoleAdmin+" role")
+	}
+	path, err := se.manager.createDiagnosticBundle(se.diagnosticDir, value)
+	if err != nil {
+		return "", err
+	}
+	exeLogger.Infof("create diagnostic bundle, namespace: %s, user: %s, path: %s", se.namespace, se.user, path)
+	return path, nil
+}
+
 func (se *SessionExecutor) handleSetVariable(v *ast.VariableAssignment) error {
 	if v.IsGlobal {
-		return fmt.Errorf("does not support set variable in global scope")
+		return mysql.UnsupportedSetGlobal.Err()
+	}
+	if !v.IsSystem && v.Name != ast.SetNames {
+		se.setUserVariable(v.Name, v.Value)
+		return nil
 	}
 	name := strings.ToLower(v.Name)
 	switch name {
@@ -310,7 +496,7 @@ func (se *SessionExecutor) handleSetVariable(v *ast.VariableAssignment) error {
 		return nil
 	case "sql_mode":
 		sqlMode := getVariableExprResult(v.Value)
-		return se.setStringSessionVariable(mysql.SQLModeStr, sqlMode)
+		return se.setSQLMode(sqlMode)
 	case "sql_safe_updates":
 		value := getVariableExprResult(v.Value)
 		onOffValue, err := getOnOffVariable(value)
@@ -331,14 +517,30 @@ func (se *SessionExecutor) handleSetVariable(v *ast.VariableAssignment) error {
 		return nil
 		// unsupported
 	case "transaction":
-		return fmt.Errorf("does not support set transaction in gaea")
+		return mysql.UnsupportedSetTransaction.Err()
 	case gaeaGeneralLogVariable:
 		value := getVariableExprResult(v.Value)
-		onOffValue, err := getOnOffVariable(value)
-		if err != nil {
+		before := atomic.LoadUint32(&ProcessGeneralLog)
+		err := se.handleSetGeneralLogVariable(name, value)
+		se.recordAdminAudit(gaeaGeneralLogVariable, "", before, atomic.LoadUint32(&ProcessGeneralLog), err)
+		return err
+	case gaeaDiagnosticBundleVariable:
+		value := getVariableExprResult(v.Value)
+		path, err := se.handleSetDiagnosticBundleVariable(value)
+		se.recordAdminAudit(gaeaDiagnosticBundleVariable, value, nil, path, err)
+		return err
+	case gaeaDryRunVariable:
+		value := getVariableExprResult(v.Value)
+		if err := se.setDryRunVariable(value); err != nil {
 			return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, value)
 		}
-		return se.setGeneralLogVariable(onOffValue)
+		return nil
+	case gaeaAllowDangerousSQLVariable:
+		value := getVariableExprResult(v.Value)
+		if err := se.setAllowDangerousSQLVariable(value); err != nil {
+			return mysql.NewDefaultError(mysql.ErrWrongValueForVar, name, value)
+		}
+		return nil
 	default:
 		return nil
 	}
@@ -357,9 +559,12 @@ func (se *SessionExecutor) handleSetAutoCommit(autocommit bool) (err error) {
 			if e := pc.SetAutoCommit(1); e != nil {
 				err = fmt.Errorf("set autocommit error, %v", e)
 			}
-			pc.Recycle()
+			if !se.isTempConn(pc) {
+				pc.Recycle()
+			}
 		}
 		se.txConns = make(map[string]backend.PooledConnect)
+		se.endTransaction(commitResult(err))
 		return
 	}
 
@@ -368,7 +573,7 @@ func (se *SessionExecutor) handleSetAutoCommit(autocommit bool) (err error) {
 }
 
 func (se *SessionExecutor) handleStmtPrepare(sql string) (*Stmt, error) {
-	exeLogger.Debugf("namespace: %s use prepare, parser: %s", se.GetNamespace().GetName(), sql)
+	exeLogger.Debugf("namespace: %s use prepare, parser: %s", se.GetNamespace().GetName(), se.GetNamespace().redactSQL(sql))
 
 	stmt := new(Stmt)
 
@@ -377,7 +582,7 @@ func (se *SessionExecutor) handleStmtPrepare(sql string) (*Stmt, error) {
 
 	paramCount, offsets, err := calcParams(stmt.sql)
 	if err != nil {
-		exeLogger.Warnf("prepare calc params failed, namespace: %s, parser: %s", se.GetNamespace().GetName(), sql)
+		exeLogger.Warnf("prepare calc params failed, namespace: %s, parser: %s", se.GetNamespace().GetName(), se.GetNamespace().redactSQL(sql))
 		return nil, err
 	}
 
@@ -37,8 +37,12 @@ import (
 
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/util"
+	"github.com/pingcap/parser/ast"
 )
 
+// maxStmtLongDataSize 单个参数通过COM_STMT_SEND_LONG_DATA发送数据的最大长度, 与MySQL max_allowed_packet上限一致
+const maxStmtLongDataSize = 1 << 30
+
 var p = &mysql.Field{Name: []byte("?")}
 var c = &mysql.Field{}
 
@@ -93,11 +97,44 @@ type Stmt struct {
 	paramCount  int
 	paramTypes  []byte
 	offsets     []int
+	cursor      *stmtCursor      // 以CURSOR_TYPE_READ_ONLY执行时打开的游标
+	tables      []*ast.TableName // namespace只读时检查例外表用, 第一次检查时解析
+
+	// longData COM_STMT_SEND_LONG_DATA按参数累积的数据, 执行时代替参数值, 执行或重置后清空
+	longData [][]byte
+	// longDataErr COM_STMT_SEND_LONG_DATA没有响应, 出错时保存错误, 执行时返回
+	longDataErr error
 }
 
-// ResetParams reset args
+// ResetParams reset args and long data
 func (s *Stmt) ResetParams() {
 	s.args = make([]interface{}, s.paramCount)
+	s.longData = nil
+	s.longDataErr = nil
+}
+
+// appendLongData append chunk to long data of param
+func (s *Stmt) appendLongData(paramID int, chunk []byte) error {
+	if paramID >= s.paramCount {
+		return mysql.NewDefaultError(mysql.ErrWrongArguments, "mysqld_stmt_send_long_data")
+	}
+	if s.longData == nil {
+		s.longData = make([][]byte, s.paramCount)
+	}
+	if len(s.longData[paramID])+len(chunk) > maxStmtLongDataSize {
+		return mysql.NewDefaultError(mysql.ErrNetPacketTooLarge)
+	}
+	// 长度为0的数据也表示发送过长数据
+	if s.longData[paramID] == nil {
+		s.longData[paramID] = make([]byte, 0, len(chunk))
+	}
+	s.longData[paramID] = append(s.longData[paramID], chunk...)
+	return nil
+}
+
+// hasLongData return true if long data of param has been sent
+func (s *Stmt) hasLongData(paramID int) bool {
+	return s.longData != nil && s.longData[paramID] != nil
 }
 
 func (s *Stmt) SetParamTypes(paramTypes []byte) {
@@ -130,9 +167,10 @@ func (s *Stmt) GetRewriteSQL() (string, error) {
 	return sql, nil
 }
 
-func (se *SessionExecutor) handleStmtExecute(data []byte) (*mysql.Result, error) {
+// handleStmtExecute 执行预处理语句, 以CURSOR_TYPE_READ_ONLY执行且返回结果集时打开游标, cursorOpened为true
+func (se *SessionExecutor) handleStmtExecute(data []byte) (r *mysql.Result, cursorOpened bool, err error) {
 	if len(data) < 9 {
-		return nil, mysql.ErrMalformPacket
+		return nil, false, mysql.ErrMalformPacket
 	}
 
 	pos := 0
@@ -141,15 +179,25 @@ func (se *SessionExecutor) handleStmtExecute(data []byte) (*mysql.Result, error)
 
 	s, ok := se.stmts[id]
 	if !ok {
-		return nil, mysql.NewDefaultError(mysql.ErrUnknownStmtHandler,
+		return nil, false, mysql.NewDefaultError(mysql.ErrUnknownStmtHandler,
 			strconv.FormatUint(uint64(id), 10), "stmt_execute")
 	}
 
-	flag := data[pos] & mysql.CursorTypeReadOnly
+	flag := data[pos]
 	pos++
-	//now we only support CURSOR_TYPE_NO_CURSOR flag
-	if flag != 0 {
-		return nil, mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("unsupported flag %d", flag))
+	//now we only support CURSOR_TYPE_NO_CURSOR and CURSOR_TYPE_READ_ONLY flag, PARAMETER_COUNT_AVAILABLE is set by clients sending query attributes
+	if flag&^(mysql.CursorTypeReadOnly|mysql.ParameterCountAvailable) != 0 {
+		return nil, false, mysql.NewError(mysql.ErrUnknown, fmt.Sprintf("unsupported flag %d", flag))
+	}
+	// 重新执行时关闭之前打开的游标
+	s.cursor = nil
+	// 无论执行是否成功, 参数和长数据只用于本次执行
+	defer s.ResetParams()
+	if s.longDataErr != nil {
+		return nil, false, s.longDataErr
+	}
+	if err := se.checkStmtNamespaceReadOnly(s); err != nil {
+		return nil, false, err
 	}
 
 	//skip iteration-count, always 1
@@ -160,196 +208,219 @@ func (se *SessionExecutor) handleStmtExecute(data []byte) (*mysql.Result, error)
 	var paramValues []byte
 
 	paramNum := s.paramCount
+	// 协商CLIENT_QUERY_ATTRIBUTES时单独发送参数个数, 语句参数之后是query attributes
+	if se.clientQueryAttributes && (paramNum > 0 || flag&mysql.ParameterCountAvailable != 0) {
+		n, next, _, ok := mysql.ReadLenEncInt(data, pos)
+		if !ok || n < uint64(s.paramCount) || n > uint64(len(data)) {
+			return nil, false, mysql.ErrMalformPacket
+		}
+		paramNum, pos = int(n), next
+	}
 
 	var executeSQL string
-	var err error
 	if paramNum > 0 {
-		nullBitmapLen := (s.paramCount + 7) >> 3
+		nullBitmapLen := (paramNum + 7) >> 3
 		if len(data) < (pos + nullBitmapLen + 1) {
-			return nil, mysql.ErrMalformPacket
+			return nil, false, mysql.ErrMalformPacket
 		}
 		nullBitmaps = data[pos : pos+nullBitmapLen]
 		pos += nullBitmapLen
 
+		var attrTypes []byte
+		var attrNames []string
 		//new param bound flag
 		if data[pos] == 1 {
 			pos++
-			if len(data) < (pos + (paramNum << 1)) {
-				return nil, mysql.ErrMalformPacket
-			}
+			if se.clientQueryAttributes {
+				// 参数类型后是参数名称, 语句参数的名称为空
+				paramTypes, attrNames, pos, err = readParamTypesWithNames(data, pos, paramNum)
+				if err != nil {
+					return nil, false, err
+				}
+				attrTypes, attrNames = paramTypes[s.paramCount<<1:], attrNames[s.paramCount:]
+				paramTypes = paramTypes[:s.paramCount<<1]
+			} else {
+				if len(data) < (pos + (paramNum << 1)) {
+					return nil, false, mysql.ErrMalformPacket
+				}
 
-			paramTypes = data[pos : pos+(paramNum<<1)]
-			pos += (paramNum << 1)
+				paramTypes = data[pos : pos+(paramNum<<1)]
+				pos += (paramNum << 1)
+			}
 
 			paramValues = data[pos:]
 			s.SetParamTypes(paramTypes)
+		} else if paramNum > s.paramCount {
+			// query attributes的类型和名称每次都要发送
+			return nil, false, mysql.ErrMalformPacket
 		} else {
 			paramValues = data[pos+1:]
 		}
 
-		if err := se.bindStmtArgs(s, nullBitmaps, s.GetParamTypes(), paramValues); err != nil {
-			return nil, err
+		end, err := se.bindStmtArgs(s, nullBitmaps, s.GetParamTypes(), paramValues)
+		if err != nil {
+			return nil, false, err
 		}
+		if len(attrNames) > 0 {
+			if se.queryAttributes, _, err = readQueryAttributeValues(nullBitmaps, s.paramCount, attrTypes, attrNames, paramValues, end); err != nil {
+				return nil, false, err
+			}
+		}
+	}
 
+	if s.paramCount > 0 {
 		executeSQL, err = s.GetRewriteSQL()
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 	} else {
 		executeSQL = s.sql
 	}
 
-	defer s.ResetParams()
-
 	// execute parser using ComQuery
-	r, err := se.handleQuery(executeSQL)
+	r, err = se.handleQuery(executeSQL)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// build binary result set
 	if r != nil && r.Resultset != nil {
 		resultSet, err := mysql.BuildBinaryResultset(r.Fields, r.Values)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		r.Resultset = resultSet
+
+		if flag&mysql.CursorTypeReadOnly != 0 {
+			s.cursor = newStmtCursor(resultSet.RowDatas)
+			return r, true, nil
+		}
 	}
 
-	return r, nil
+	return r, false, nil
 }
 
-// long data and generic args are all in s.args
-func (se *SessionExecutor) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramValues []byte) error {
+// long data and generic args are all in s.args, return position after the values of the statement params
+func (se *SessionExecutor) bindStmtArgs(s *Stmt, nullBitmap, paramTypes, paramValues []byte) (int, error) {
 	args := s.args
 
 	pos := 0
 
-	var v []byte
-	var isNull bool
-
 	for i := 0; i < s.paramCount; i++ {
+		// 与MySQL一致, 发送过长数据的参数忽略null bitmap, 执行包中也不包含参数值
+		if s.hasLongData(i) {
+			args[i] = s.longData[i]
+			continue
+		}
+
 		if nullBitmap[i>>3]&(1<<(uint(i)%8)) > 0 {
 			args[i] = nil
 			continue
 		}
 
 		if (i<<1)+1 >= len(paramTypes) {
-			return mysql.ErrMalformPacket
+			return 0, mysql.ErrMalformPacket
 		}
 
 		tp := paramTypes[i<<1]
 		isUnsigned := (paramTypes[(i<<1)+1] & 0x80) > 0
 
-		if s.args[i] != nil {
-			continue
+		v, next, err := readBinaryParam(tp, isUnsigned, paramValues, pos)
+		if err != nil {
+			return 0, err
 		}
-		switch tp {
-		case mysql.TypeNull:
-			args[i] = nil
-			continue
+		args[i] = v
+		pos = next
+	}
+	return pos, nil
+}
 
-		case mysql.TypeTiny:
-			if len(paramValues) < (pos + 1) {
-				return mysql.ErrMalformPacket
-			}
+// readBinaryParam read param value of binary protocol at pos, return the value and position after it
+func readBinaryParam(tp byte, isUnsigned bool, paramValues []byte, pos int) (interface{}, int, error) {
+	switch tp {
+	case mysql.TypeNull:
+		return nil, pos, nil
 
-			if isUnsigned {
-				args[i] = uint8(paramValues[pos])
-			} else {
-				args[i] = int8(paramValues[pos])
-			}
+	case mysql.TypeTiny:
+		if len(paramValues) < (pos + 1) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			pos++
-			continue
+		if isUnsigned {
+			return uint8(paramValues[pos]), pos + 1, nil
+		}
+		return int8(paramValues[pos]), pos + 1, nil
 
-		case mysql.TypeShort, mysql.TypeYear:
-			if len(paramValues) < (pos + 2) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeShort, mysql.TypeYear:
+		if len(paramValues) < (pos + 2) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			if isUnsigned {
-				args[i] = uint16(binary.LittleEndian.Uint16(paramValues[pos : pos+2]))
-			} else {
-				args[i] = int16((binary.LittleEndian.Uint16(paramValues[pos : pos+2])))
-			}
-			pos += 2
-			continue
+		if isUnsigned {
+			return uint16(binary.LittleEndian.Uint16(paramValues[pos : pos+2])), pos + 2, nil
+		}
+		return int16((binary.LittleEndian.Uint16(paramValues[pos : pos+2]))), pos + 2, nil
 
-		case mysql.TypeInt24, mysql.TypeLong:
-			if len(paramValues) < (pos + 4) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeInt24, mysql.TypeLong:
+		if len(paramValues) < (pos + 4) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			if isUnsigned {
-				args[i] = uint32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
-			} else {
-				args[i] = int32(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))
-			}
-			pos += 4
-			continue
+		if isUnsigned {
+			return uint32(binary.LittleEndian.Uint32(paramValues[pos : pos+4])), pos + 4, nil
+		}
+		return int32(binary.LittleEndian.Uint32(paramValues[pos : pos+4])), pos + 4, nil
 
-		case mysql.TypeLonglong:
-			if len(paramValues) < (pos + 8) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeLonglong:
+		if len(paramValues) < (pos + 8) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			if isUnsigned {
-				args[i] = binary.LittleEndian.Uint64(paramValues[pos : pos+8])
-			} else {
-				args[i] = int64(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
-			}
-			pos += 8
-			continue
+		if isUnsigned {
+			return binary.LittleEndian.Uint64(paramValues[pos : pos+8]), pos + 8, nil
+		}
+		return int64(binary.LittleEndian.Uint64(paramValues[pos : pos+8])), pos + 8, nil
 
-		case mysql.TypeFloat:
-			if len(paramValues) < (pos + 4) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeFloat:
+		if len(paramValues) < (pos + 4) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			args[i] = float32(math.Float32frombits(binary.LittleEndian.Uint32(paramValues[pos : pos+4])))
-			pos += 4
-			continue
+		return float32(math.Float32frombits(binary.LittleEndian.Uint32(paramValues[pos : pos+4]))), pos + 4, nil
 
-		case mysql.TypeDouble:
-			if len(paramValues) < (pos + 8) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeDouble:
+		if len(paramValues) < (pos + 8) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			args[i] = math.Float64frombits(binary.LittleEndian.Uint64(paramValues[pos : pos+8]))
-			pos += 8
-			continue
+		return math.Float64frombits(binary.LittleEndian.Uint64(paramValues[pos : pos+8])), pos + 8, nil
 
-		case mysql.TypeDecimal, mysql.TypeNewDecimal, mysql.TypeVarchar,
-			mysql.TypeBit, mysql.TypeEnum, mysql.TypeSet, mysql.TypeTinyBlob,
-			mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob,
-			mysql.TypeVarString, mysql.TypeString, mysql.TypeGeometry,
-			mysql.TypeDate, mysql.TypeNewDate,
-			mysql.TypeTimestamp, mysql.TypeDatetime, mysql.TypeDuration, mysql.TypeJSON:
-			if len(paramValues) < (pos + 1) {
-				return mysql.ErrMalformPacket
-			}
+	case mysql.TypeDecimal, mysql.TypeNewDecimal, mysql.TypeVarchar,
+		mysql.TypeBit, mysql.TypeEnum, mysql.TypeSet, mysql.TypeTinyBlob,
+		mysql.TypeMediumBlob, mysql.TypeLongBlob, mysql.TypeBlob,
+		mysql.TypeVarString, mysql.TypeString, mysql.TypeGeometry,
+		mysql.TypeDate, mysql.TypeNewDate,
+		mysql.TypeTimestamp, mysql.TypeDatetime, mysql.TypeDuration, mysql.TypeJSON:
+		if len(paramValues) < (pos + 1) {
+			return nil, 0, mysql.ErrMalformPacket
+		}
 
-			var ok = false
-			v, pos, isNull, ok = mysql.ReadLenEncStringAsBytes(paramValues, pos)
-			if !ok {
-				return errors.New("ReadLenEncStringAsBytes in bindStmtArgs failed")
-			}
+		v, next, isNull, ok := mysql.ReadLenEncStringAsBytes(paramValues, pos)
+		if !ok {
+			return nil, 0, errors.New("ReadLenEncStringAsBytes in bindStmtArgs failed")
+		}
 
-			if !isNull {
-				args[i] = v
-				continue
-			} else {
-				args[i] = nil
-				continue
-			}
-		default:
-			return fmt.Errorf("Stmt Unknown FieldType %d", tp)
+		if isNull {
+			return nil, next, nil
 		}
+		return v, next, nil
+	default:
+		return nil, 0, fmt.Errorf("Stmt Unknown FieldType %d", tp)
 	}
-	return nil
 }
 
+// handleStmtSendLongData 累积参数的长数据, COM_STMT_SEND_LONG_DATA没有响应,
+// 语句存在时错误保存在语句中由COM_STMT_EXECUTE返回, 返回的错误只用于记录日志
 func (se *SessionExecutor) handleStmtSendLongData(data []byte) error {
 	if len(data) < 6 {
 		return mysql.ErrMalformPacket
@@ -362,25 +433,15 @@ func (se *SessionExecutor) handleStmtSendLongData(data []byte) error {
 		return mysql.NewDefaultError(mysql.ErrUnknownStmtHandler,
 			strconv.FormatUint(uint64(id), 10), "stmt_send_longdata")
 	}
-
-	paramID := binary.LittleEndian.Uint16(data[4:6])
-	if paramID >= uint16(s.paramCount) {
-		return mysql.NewDefaultError(mysql.ErrWrongArguments, "stmt_send_longdata")
+	if s.longDataErr != nil {
+		return s.longDataErr
 	}
 
-	if s.args[paramID] == nil {
-		tmpSlice := make([]byte, len(data)-6)
-		copy(tmpSlice, data[6:])
-		s.args[paramID] = tmpSlice
-	} else {
-		if b, ok := s.args[paramID].([]byte); ok {
-			b = append(b, data[6:]...)
-			s.args[paramID] = b
-		} else {
-			return fmt.Errorf("invalid param long data type %T", s.args[paramID])
-		}
+	paramID := binary.LittleEndian.Uint16(data[4:6])
+	if err := s.appendLongData(int(paramID), data[6:]); err != nil {
+		s.longDataErr = err
+		return err
 	}
-
 	return nil
 }
 
@@ -398,5 +459,6 @@ func (se *SessionExecutor) handleStmtReset(data []byte) error {
 	}
 
 	s.ResetParams()
+	s.cursor = nil
 	return nil
 }
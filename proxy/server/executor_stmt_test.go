@@ -15,7 +15,10 @@
 package server
 
 import (
+	"encoding/binary"
 	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
 )
 
 func Test_calcParams(t *testing.T) {
@@ -41,3 +44,64 @@ func Test_calcParams(t *testing.T) {
 		t.Logf("test calcParams failed, %v\n", err)
 	}
 }
+
+func newSendLongData(id uint32, paramID uint16, chunk string) []byte {
+	data := make([]byte, 6)
+	binary.LittleEndian.PutUint32(data[0:4], id)
+	binary.LittleEndian.PutUint16(data[4:6], paramID)
+	return append(data, chunk...)
+}
+
+func TestStmtSendLongData(t *testing.T) {
+	se := newSessionExecutor(nil)
+	sql := "insert into t (id, content, extra) values (?, ?, ?)"
+	paramCount, offsets, _ := calcParams(sql)
+	s := &Stmt{id: 1, sql: sql, paramCount: paramCount, offsets: offsets}
+	s.ResetParams()
+	se.stmts[s.id] = s
+
+	for _, chunk := range []string{"it's ", "", "a blob"} {
+		if err := se.handleStmtSendLongData(newSendLongData(s.id, 1, chunk)); err != nil {
+			t.Fatalf("send long data error: %v", err)
+		}
+	}
+	// 空数据也作为参数值
+	if err := se.handleStmtSendLongData(newSendLongData(s.id, 2, "")); err != nil {
+		t.Fatalf("send long data error: %v", err)
+	}
+	if err := se.handleStmtSendLongData(newSendLongData(2, 0, "x")); err == nil {
+		t.Errorf("expect unknown stmt error")
+	}
+
+	// 发送过长数据的参数忽略null bitmap, 执行包中只有第一个参数的值
+	paramTypes := []byte{mysql.TypeLonglong, 0, mysql.TypeBlob, 0, mysql.TypeBlob, 0}
+	paramValues := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	end, err := se.bindStmtArgs(s, []byte{0x04}, paramTypes, paramValues)
+	if err != nil || end != len(paramValues) {
+		t.Fatalf("bind stmt args, end: %d, err: %v", end, err)
+	}
+	rewriteSQL, _ := s.GetRewriteSQL()
+	if expect := `insert into t (id, content, extra) values (1, 'it\'s a blob', '')`; rewriteSQL != expect {
+		t.Errorf("rewrite sql, expect: %s, actual: %s", expect, rewriteSQL)
+	}
+
+	// COM_STMT_RESET清空长数据
+	s.ResetParams()
+	if s.hasLongData(1) {
+		t.Errorf("long data should be cleared after reset")
+	}
+
+	// 参数序号错误时不立即返回, 执行时返回错误, 执行后清空
+	if err := se.handleStmtSendLongData(newSendLongData(s.id, 3, "x")); err == nil {
+		t.Errorf("expect wrong arguments error")
+	}
+	execute := make([]byte, 9)
+	binary.LittleEndian.PutUint32(execute[0:4], s.id)
+	_, _, err = se.handleStmtExecute(execute)
+	if e, ok := err.(*mysql.SQLError); !ok || e.SQLCode() != mysql.ErrWrongArguments {
+		t.Errorf("expect wrong arguments error on execute, actual: %v", err)
+	}
+	if s.longDataErr != nil {
+		t.Errorf("long data error should be cleared after execute")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/opcode"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// numericLiteral 不加引号直接写入SQL的数值, 如负的decimal
+type numericLiteral string
+
+// String implement fmt.Stringer
+func (n numericLiteral) String() string {
+	return string(n)
+}
+
+// unsupportedUserVariable 用户变量的值不是常量, gaea无法计算, 只在EXECUTE ... USING时报错
+type unsupportedUserVariable struct {
+	expr string
+}
+
+func (se *SessionExecutor) setUserVariable(name string, expr ast.ExprNode) {
+	name = strings.ToLower(name)
+	value, ok := getConstantValue(expr)
+	if !ok {
+		value = &unsupportedUserVariable{expr: getVariableExprResult(expr)}
+	}
+	se.userVariables[name] = value
+}
+
+// getUserVariable return value of user variable, undefined variable is NULL
+func (se *SessionExecutor) getUserVariable(name string) (interface{}, error) {
+	value := se.userVariables[strings.ToLower(name)]
+	if u, ok := value.(*unsupportedUserVariable); ok {
+		return nil, fmt.Errorf("value of user variable @%s is not a constant: %s", name, u.expr)
+	}
+	return value, nil
+}
+
+// handleSelectIntoVars 去掉INTO子句执行查询, 将单行结果保存到会话的用户变量中
+func (se *SessionExecutor) handleSelectIntoVars(reqCtx *util.RequestContext, sql string, vars []string) (*mysql.Result, error) {
+	r, err := se.doQuery(reqCtx, sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := se.assignSelectIntoVars(r, vars); err != nil {
+		return nil, err
+	}
+	return &mysql.Result{Status: r.Status, AffectedRows: uint64(r.RowNumber())}, nil
+}
+
+// assignSelectIntoVars 与MySQL一致, 没有结果时不修改变量, 多于一行时报错
+func (se *SessionExecutor) assignSelectIntoVars(r *mysql.Result, vars []string) error {
+	if r == nil || r.Resultset == nil || r.ColumnNumber() != len(vars) {
+		return mysql.NewDefaultError(mysql.ErrWrongNumberOfColumnsInSelect)
+	}
+	switch r.RowNumber() {
+	case 0:
+		return nil
+	case 1:
+	default:
+		return mysql.NewDefaultError(mysql.ErrTooManyRows)
+	}
+	for i, name := range vars {
+		value := r.Values[0][i]
+		// 结果集的[]byte可能引用读缓冲区, 复制为字符串保存
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		se.userVariables[strings.ToLower(name)] = value
+	}
+	return nil
+}
+
+func getConstantValue(expr ast.ExprNode) (interface{}, bool) {
+	switch e := expr.(type) {
+	case ast.ValueExpr:
+		return e.GetValue(), true
+	case *ast.UnaryOperationExpr:
+		v, ok := getConstantValue(e.V)
+		if !ok {
+			return nil, false
+		}
+		switch e.Op {
+		case opcode.Plus:
+			return v, true
+		case opcode.Minus:
+			switch n := v.(type) {
+			case int64:
+				return -n, true
+			case float64:
+				return -n, true
+			case uint64:
+				return numericLiteral("-" + strconv.FormatUint(n, 10)), true
+			case nil, string, []byte:
+				return nil, false
+			default:
+				return numericLiteral("-" + fmt.Sprintf("%v", n)), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// handleTextPrepare handle PREPARE name FROM 'sql' or PREPARE name FROM @var, the statement with the same name is replaced
+func (se *SessionExecutor) handleTextPrepare(stmt *ast.PrepareStmt) error {
+	sql := stmt.SQLText
+	if stmt.SQLVar != nil {
+		value, err := se.getUserVariable(stmt.SQLVar.Name)
+		if err != nil {
+			return err
+		}
+		switch v := value.(type) {
+		case string:
+			sql = v
+		case []byte:
+			sql = string(v)
+		default:
+			return mysql.NewDefaultError(mysql.ErrWrongArguments, "PREPARE")
+		}
+	}
+
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+	switch parser.PreviewSql(sql) {
+	case parser.StmtPrepare, parser.StmtExecute, parser.StmtDeallocate:
+		return mysql.NewDefaultError(mysql.ErrUnsupportedPs)
+	}
+
+	paramCount, offsets, err := calcParams(sql)
+	if err != nil {
+		return err
+	}
+	s := &Stmt{
+		sql:        sql,
+		paramCount: paramCount,
+		offsets:    offsets,
+	}
+	s.ResetParams()
+	se.textStmts[strings.ToLower(stmt.Name)] = s
+	return nil
+}
+
+// handleTextExecute handle EXECUTE name USING @a, @b, values of user variables are written into sql like binary protocol
+func (se *SessionExecutor) handleTextExecute(stmt *ast.ExecuteStmt) (*mysql.Result, error) {
+	sql, err := se.getTextExecuteSQL(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return se.handleQuery(sql)
+}
+
+func (se *SessionExecutor) getTextExecuteSQL(stmt *ast.ExecuteStmt) (string, error) {
+	s, ok := se.textStmts[strings.ToLower(stmt.Name)]
+	if !ok {
+		return "", mysql.NewDefaultError(mysql.ErrUnknownStmtHandler, len(stmt.Name), stmt.Name, "EXECUTE")
+	}
+	if len(stmt.UsingVars) != s.paramCount {
+		return "", mysql.NewDefaultError(mysql.ErrWrongArguments, "EXECUTE")
+	}
+
+	defer s.ResetParams()
+	for i, v := range stmt.UsingVars {
+		ve, ok := v.(*ast.VariableExpr)
+		if !ok || ve.IsSystem {
+			return "", mysql.NewDefaultError(mysql.ErrWrongArguments, "EXECUTE")
+		}
+		value, err := se.getUserVariable(ve.Name)
+		if err != nil {
+			return "", err
+		}
+		// 字符串以[]byte保存, 改写时加引号
+		if str, ok := value.(string); ok {
+			value = []byte(str)
+		}
+		s.args[i] = value
+	}
+	return s.GetRewriteSQL()
+}
+
+// handleTextDeallocate handle DEALLOCATE PREPARE name and DROP PREPARE name
+func (se *SessionExecutor) handleTextDeallocate(stmt *ast.DeallocateStmt) error {
+	name := strings.ToLower(stmt.Name)
+	if _, ok := se.textStmts[name]; !ok {
+		return mysql.NewDefaultError(mysql.ErrUnknownStmtHandler, len(stmt.Name), stmt.Name, "DEALLOCATE PREPARE")
+	}
+	delete(se.textStmts, name)
+	return nil
+}
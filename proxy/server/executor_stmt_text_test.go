@@ -0,0 +1,182 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func runTextStmt(t *testing.T, se *SessionExecutor, sql string) (string, error) {
+	n, err := se.Parse(sql)
+	if err != nil {
+		t.Fatalf("parse error, sql: %s, err: %v", sql, err)
+	}
+	switch stmt := n.(type) {
+	case *ast.SetStmt:
+		for _, v := range stmt.Variables {
+			if err := se.handleSetVariable(v); err != nil {
+				return "", err
+			}
+		}
+	case *ast.PrepareStmt:
+		return "", se.handleTextPrepare(stmt)
+	case *ast.ExecuteStmt:
+		return se.getTextExecuteSQL(stmt)
+	case *ast.DeallocateStmt:
+		return "", se.handleTextDeallocate(stmt)
+	default:
+		t.Fatalf("unexpected statement: %s", sql)
+	}
+	return "", nil
+}
+
+func TestTextPrepareExecute(t *testing.T) {
+	se := newSessionExecutor(nil)
+	steps := []struct {
+		sql    string
+		expect string
+		errNo  uint16
+	}{
+		{sql: "SET @id = 10, @name = 'it''s', @score = -1.5, @neg = -3"},
+		{sql: "PREPARE s1 FROM 'select * from tbl where id = ? and name = ? and score > ? and col = ? and n = ?'"},
+		{sql: "EXECUTE S1 USING @id, @name, @score, @undefined, @neg", expect: "select * from tbl where id = 10 and name = 'it\\'s' and score > -1.5 and col = NULL and n = -3"},
+		{sql: "EXECUTE s1 USING @id", errNo: mysql.ErrWrongArguments},
+		{sql: "SET @sql = 'update tbl set name = ? where id = ?'"},
+		{sql: "PREPARE s2 FROM @sql"},
+		{sql: "EXECUTE s2 USING @name, @id", expect: "update tbl set name = 'it\\'s' where id = 10"},
+		{sql: "PREPARE s3 FROM 'execute s1'", errNo: mysql.ErrUnsupportedPs},
+		{sql: "DEALLOCATE PREPARE s1"},
+		{sql: "EXECUTE s1 USING @id, @name, @score, @undefined, @neg", errNo: mysql.ErrUnknownStmtHandler},
+		{sql: "DROP PREPARE s2"},
+		{sql: "DEALLOCATE PREPARE s2", errNo: mysql.ErrUnknownStmtHandler},
+	}
+	for _, step := range steps {
+		sql, err := runTextStmt(t, se, step.sql)
+		if step.errNo != 0 {
+			sqlErr, ok := err.(*mysql.SQLError)
+			if !ok || sqlErr.SQLCode() != step.errNo {
+				t.Errorf("error not match, sql: %s, expect: %d, actual: %v", step.sql, step.errNo, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("execute error, sql: %s, err: %v", step.sql, err)
+		}
+		if sql != step.expect {
+			t.Errorf("rewrite sql not match, sql: %s, expect: %s, actual: %s", step.sql, step.expect, sql)
+		}
+	}
+}
+
+func TestTextExecuteWithUnsupportedVariable(t *testing.T) {
+	se := newSessionExecutor(nil)
+	for _, sql := range []string{"SET @now = now()", "PREPARE s FROM 'select ?'"} {
+		if _, err := runTextStmt(t, se, sql); err != nil {
+			t.Fatalf("execute error, sql: %s, err: %v", sql, err)
+		}
+	}
+	if _, err := runTextStmt(t, se, "EXECUTE s USING @now"); err == nil {
+		t.Errorf("execute with non constant user variable should fail")
+	}
+}
+
+func TestSplitSelectIntoVars(t *testing.T) {
+	tests := []struct {
+		sql    string
+		query  string
+		vars   []string
+		hasErr bool
+	}{
+		{sql: "select id, name from tbl where id = 1", query: "select id, name from tbl where id = 1"},
+		{sql: "select id, name into @a, @B from tbl where id = 1", query: "select id, name  from tbl where id = 1", vars: []string{"a", "B"}},
+		{sql: "SELECT count(*) FROM tbl INTO @`cnt`", query: "SELECT count(*) FROM tbl  ", vars: []string{"cnt"}},
+		{sql: "select 'into @a', @into from (select 1 into @x) t into @'it''s',@b for update", query: "select 'into @a', @into from (select 1 into @x) t  for update", vars: []string{"it's", "b"}},
+		{sql: "select /* into @a */ 1 -- into @b\n into @c", query: "select /* into @a */ 1 -- into @b\n  ", vars: []string{"c"}},
+		{sql: "select * from tbl into outfile '/tmp/a'", query: "select * from tbl into outfile '/tmp/a'"},
+		{sql: "select 'unclosed into @a", query: "select 'unclosed into @a"},
+		{sql: "select 1 into @@autocommit", hasErr: true},
+		{sql: "select 1, 2 into @a,", hasErr: true},
+	}
+	for _, test := range tests {
+		query, vars, err := parser.SplitSelectIntoVars(test.sql)
+		if test.hasErr {
+			if err == nil {
+				t.Errorf("sql: %s, expect error", test.sql)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("sql: %s, err: %v", test.sql, err)
+		}
+		if query != test.query || !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("sql: %s, expect: %q %v, actual: %q %v", test.sql, test.query, test.vars, query, vars)
+		}
+	}
+}
+
+func TestAssignSelectIntoVars(t *testing.T) {
+	se := newSessionExecutor(nil)
+	newResult := func(rows ...[]interface{}) *mysql.Result {
+		rs, err := mysql.BuildResultset(nil, []string{"id", "name"}, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &mysql.Result{Resultset: rs}
+	}
+
+	if err := se.assignSelectIntoVars(newResult([]interface{}{int64(10), []byte("it's")}), []string{"Id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if sql, err := runTextStmt(t, se, "PREPARE s FROM 'select ?, ?'"); err != nil || sql != "" {
+		t.Fatalf("prepare error: %v", err)
+	}
+	sql, err := runTextStmt(t, se, "EXECUTE s USING @id, @name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "select 10, 'it\\'s'"; sql != expect {
+		t.Errorf("rewrite sql not match, expect: %s, actual: %s", expect, sql)
+	}
+
+	// 没有结果时不修改变量
+	if err := se.assignSelectIntoVars(newResult(), []string{"id", "name"}); err != nil {
+		t.Fatal(err)
+	}
+	if se.userVariables["id"] != int64(10) {
+		t.Errorf("variable should not be changed: %v", se.userVariables["id"])
+	}
+
+	errTests := []struct {
+		r     *mysql.Result
+		vars  []string
+		errNo uint16
+	}{
+		{newResult([]interface{}{1, "a"}, []interface{}{2, "b"}), []string{"id", "name"}, mysql.ErrTooManyRows},
+		{newResult([]interface{}{1, "a"}), []string{"id"}, mysql.ErrWrongNumberOfColumnsInSelect},
+		{&mysql.Result{AffectedRows: 1}, []string{"id"}, mysql.ErrWrongNumberOfColumnsInSelect},
+	}
+	for i, test := range errTests {
+		err := se.assignSelectIntoVars(test.r, test.vars)
+		if sqlErr, ok := err.(*mysql.SQLError); !ok || sqlErr.SQLCode() != test.errNo {
+			t.Errorf("case %d error not match, expect: %d, actual: %v", i, test.errNo, err)
+		}
+	}
+}
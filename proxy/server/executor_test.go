@@ -297,3 +297,80 @@ encrypt_key=1234abcd5678efg*
 	m.users[current] = user
 	return m, nil
 }
+
+func TestSetSQLMode(t *testing.T) {
+	se := newSessionExecutor(NewManager())
+
+	if err := se.setSQLMode("'ansi,no_backslash_escapes'"); err != nil {
+		t.Fatal(err)
+	}
+	if !se.sqlMode.HasANSIQuotesMode() || !se.sqlMode.HasPipesAsConcatMode() || !se.sqlMode.HasNoBackslashEscapesMode() {
+		t.Errorf("sql mode not expected: %d", se.sqlMode)
+	}
+	// ANSI_QUOTES模式下双引号为标识符
+	n, err := se.Parse(`select "id" from t where name = 'a\b'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.(*ast.SelectStmt).Fields.Fields[0].Expr.(*ast.ColumnNameExpr); !ok {
+		t.Errorf("double quoted string should be parsed as identifier under ANSI_QUOTES")
+	}
+
+	if err := se.setSQLMode("default"); err != nil {
+		t.Fatal(err)
+	}
+	if se.sqlMode != mysql.ModeNone {
+		t.Errorf("sql mode not reset: %d", se.sqlMode)
+	}
+	if _, ok := se.sessionVariables.Get(mysql.SQLModeStr); ok {
+		t.Errorf("sql_mode session variable not deleted")
+	}
+	n, err = se.Parse(`select "id" from t`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := n.(*ast.SelectStmt).Fields.Fields[0].Expr.(*ast.ColumnNameExpr); ok {
+		t.Errorf("double quoted string should be parsed as string by default")
+	}
+
+	if err := se.setSQLMode("invalid_mode"); err == nil {
+		t.Errorf("expect error for invalid sql mode")
+	}
+}
+
+func TestAdminStmtRole(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{"KILL 12", models.AdminRoleOperator},
+		{"/* ops */ kill query 12", models.AdminRoleOperator},
+		{"FLUSH TABLES", models.AdminRoleOperator},
+		{"flush\tprivileges", models.AdminRoleOperator},
+		{"CREATE TABLE t (id int)", ""},
+		{"select 'kill'", ""},
+		{"PIN TO SLICE slice-1", models.AdminRoleAdmin},
+		{"unpin", ""},
+	}
+	for _, test := range tests {
+		if role := getAdminStmtRole(parser.PreviewSql(test.sql), test.sql); role != test.expect {
+			t.Errorf("admin stmt role not equal, sql: %s, expect: %s, actual: %s", test.sql, test.expect, role)
+		}
+	}
+
+	ns := &Namespace{userProperties: map[string]*UserProperty{
+		"ops":  {RWFlag: models.ReadWrite, AdminRole: models.AdminRoleOperator},
+		"user": {RWFlag: models.ReadWrite},
+	}}
+	// 未配置admin_role时不限制
+	if !ns.IsAdminRoleAllowed("user", models.AdminRoleAdmin) {
+		t.Errorf("admin statements should be allowed without rbac")
+	}
+	ns.adminSQLRBAC = true
+	if !ns.IsAdminRoleAllowed("ops", models.AdminRoleOperator) || ns.IsAdminRoleAllowed("ops", models.AdminRoleAdmin) {
+		t.Errorf("operator role check error")
+	}
+	if ns.IsAdminRoleAllowed("user", models.AdminRoleViewer) || ns.IsAdminRoleAllowed("", models.AdminRoleViewer) {
+		t.Errorf("user without admin role should not be allowed")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// export formats of admin export api
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json" // 每行一个JSON对象
+)
+
+// ExecuteReadOnlySQL execute select statement in namespace through planner, for proxy internal use
+func (m *Manager) ExecuteReadOnlySQL(namespace, db, sql string) (*mysql.Result, error) {
+	if m.GetNamespace(namespace) == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+	if parser.PreviewSql(sql) != parser.StmtSelect {
+		return nil, fmt.Errorf("only select statement is allowed")
+	}
+
+	// 内部会话与客户端会话相同, 由执行计划完成路由和跨分片合并
+	se := newSessionExecutor(m)
+	se.namespace = namespace
+	se.db = db
+	r, err := se.handleQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || r.Resultset == nil {
+		return nil, fmt.Errorf("no result set returned")
+	}
+	return r, nil
+}
+
+// writeResultCSV write result set as csv with header, NULL is written as empty field
+func writeResultCSV(w io.Writer, rs *mysql.Resultset) error {
+	cw := csv.NewWriter(w)
+	record := make([]string, len(rs.Fields))
+	for i, f := range rs.Fields {
+		record[i] = string(f.Name)
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, row := range rs.Values {
+		for i, v := range row {
+			record[i] = formatExportValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeResultJSONLines write each row as a json object, keys are in column order
+func writeResultJSONLines(w io.Writer, rs *mysql.Resultset) error {
+	keys := make([][]byte, len(rs.Fields))
+	for i, f := range rs.Fields {
+		key, err := json.Marshal(string(f.Name))
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	var buf bytes.Buffer
+	for _, row := range rs.Values {
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(keys[i])
+			buf.WriteByte(':')
+			value, err := json.Marshal(exportJSONValue(v))
+			if err != nil {
+				return err
+			}
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatExportValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(value)
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// []byte会被json编码为base64, 需要转为字符串
+func exportJSONValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
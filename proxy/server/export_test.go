@@ -0,0 +1,66 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func newExportTestResultset() *mysql.Resultset {
+	return &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: []byte("id")}, {Name: []byte("name")}, {Name: []byte("score")}},
+		Values: [][]interface{}{
+			{int64(1), []byte(`a,"b"`), 1.5},
+			{uint64(2), nil, float64(100)},
+		},
+	}
+}
+
+func TestWriteResultCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeResultCSV(&buf, newExportTestResultset()); err != nil {
+		t.Fatal(err)
+	}
+	expect := "id,name,score\n1,\"a,\"\"b\"\"\",1.5\n2,,100\n"
+	if buf.String() != expect {
+		t.Errorf("csv not match, expect: %q, actual: %q", expect, buf.String())
+	}
+}
+
+func TestWriteResultJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeResultJSONLines(&buf, newExportTestResultset()); err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"id":1,"name":"a,\"b\"","score":1.5}` + "\n" + `{"id":2,"name":null,"score":100}` + "\n"
+	if buf.String() != expect {
+		t.Errorf("json lines not match, expect: %q, actual: %q", expect, buf.String())
+	}
+}
+
+func TestInternalUserProperty(t *testing.T) {
+	ns := &Namespace{userProperties: map[string]*UserProperty{"rw": {RWFlag: models.ReadWrite, RWSplit: models.ReadWriteSplit}}}
+	if !ns.IsAllowWrite("rw") || !ns.IsRWSplit("rw") {
+		t.Errorf("user property of rw not match")
+	}
+	// 内部会话没有用户, 不允许写, 不走读写分离
+	if ns.IsAllowWrite("") || ns.IsRWSplit("") || ns.IsStatisticUser("") {
+		t.Errorf("internal user property not match")
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// 连接池常用的校验语句, 去掉首尾注释、合并空白并转为小写后比较
+var healthCheckQueries = map[string]bool{
+	"select 1":           true,
+	"select 1 from dual": true,
+}
+
+// isHealthCheckQuery check if sql is a connection pool validation query, such as SELECT 1 or /* ping */ SELECT 1
+func isHealthCheckQuery(sql string) bool {
+	// 校验语句都很短, 避免对普通语句做额外的字符串处理
+	if len(sql) > 128 {
+		return false
+	}
+	query, _ := parser.SplitMarginComments(sql)
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	return healthCheckQueries[query]
+}
+
+// createHealthCheckResult 与MySQL执行SELECT 1的结果一致
+func createHealthCheckResult() (*mysql.Result, error) {
+	r := &mysql.Resultset{
+		Fields: []*mysql.Field{{
+			Name:    hack.Slice("1"),
+			Charset: 63,
+			Type:    mysql.TypeLonglong,
+			Flag:    uint16(mysql.BinaryFlag | mysql.NotNullFlag),
+		}},
+		FieldNames: map[string]int{"1": 0},
+		Values:     [][]interface{}{{int64(1)}},
+		RowDatas:   []mysql.RowData{mysql.AppendLenEncStringBytes(nil, []byte("1"))},
+	}
+	return &mysql.Result{Resultset: r}, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestIsHealthCheckQuery(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect bool
+	}{
+		{"SELECT 1", true},
+		{"select 1", true},
+		{"  select\n\t1  ", true},
+		{"/* ping */ SELECT 1", true},
+		{"SELECT 1 FROM DUAL", true},
+		{"select 1 /* validation */", true},
+		{"select 2", false},
+		{"select 1, 2", false},
+		{"select 1 from tbl", false},
+		{"select 'select 1'", false},
+		{"/*!40000 select 1*/", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if actual := isHealthCheckQuery(test.sql); actual != test.expect {
+			t.Errorf("sql: %q, expect: %v, actual: %v", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestCreateHealthCheckResult(t *testing.T) {
+	r, err := createHealthCheckResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fields) != 1 || string(r.Fields[0].Name) != "1" || r.Fields[0].Type != mysql.TypeLonglong {
+		t.Fatalf("fields not match: %+v", r.Fields)
+	}
+	values, err := r.RowDatas[0].Parse(r.Fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0] != int64(1) || r.Values[0][0] != int64(1) {
+		t.Errorf("values not match: %v", values)
+	}
+}
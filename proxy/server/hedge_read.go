@@ -0,0 +1,209 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+const (
+	hedgeLatencyWindowSize = 256 // 每个slice保留的最近耗时样本数
+	hedgeMinSamples        = 20  // 样本数不足时不对冲
+
+	hedgeWinnerPrimary = "primary"
+	hedgeWinnerHedge   = "hedge"
+)
+
+// hedgeReadTracker 记录各slice最近的查询耗时, 按分位数计算对冲读的等待时间
+type hedgeReadTracker struct {
+	percentile int
+	minDelay   time.Duration
+
+	lock    sync.Mutex
+	windows map[string]*latencyWindow // key: slice name
+}
+
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func newHedgeReadTracker(percentile int, minDelay time.Duration) *hedgeReadTracker {
+	return &hedgeReadTracker{
+		percentile: percentile,
+		minDelay:   minDelay,
+		windows:    make(map[string]*latencyWindow),
+	}
+}
+
+func (t *hedgeReadTracker) record(slice string, d time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	w, ok := t.windows[slice]
+	if !ok {
+		w = &latencyWindow{samples: make([]time.Duration, 0, hedgeLatencyWindowSize)}
+		t.windows[slice] = w
+	}
+	if len(w.samples) < hedgeLatencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % hedgeLatencyWindowSize
+}
+
+// delay 返回slice的对冲等待时间, 不小于minDelay, 样本不足时返回false
+func (t *hedgeReadTracker) delay(slice string) (time.Duration, bool) {
+	t.lock.Lock()
+	w, ok := t.windows[slice]
+	if !ok || len(w.samples) < hedgeMinSamples {
+		t.lock.Unlock()
+		return 0, false
+	}
+	samples := make([]time.Duration, len(w.samples))
+	copy(samples, w.samples)
+	t.lock.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	idx := int(math.Ceil(float64(t.percentile)/100*float64(len(samples)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if d := samples[idx]; d > t.minDelay {
+		return d, true
+	}
+	return t.minDelay, true
+}
+
+// hedgeAttempt 一次在后端连接上的执行
+type hedgeAttempt struct {
+	results []interface{}
+	pc      backend.PooledConnect
+	hedge   bool // 是否是对冲请求
+}
+
+func (a *hedgeAttempt) failed() bool {
+	return hasErrorResult(a.results)
+}
+
+func hasErrorResult(results []interface{}) bool {
+	return firstErrorResult(results) != nil
+}
+
+// firstErrorResult return the first error in results, nil if all succeed
+func firstErrorResult(results []interface{}) error {
+	for _, r := range results {
+		if err, ok := r.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// hedgeRun 在pc上执行run, 超过delay未返回时从getHedgeConn获取另一个连接再执行一次, 返回先成功的执行.
+// 未被采用的执行完成后回收其连接. hedged表示是否发出了对冲请求.
+func hedgeRun(pc backend.PooledConnect, delay time.Duration, getHedgeConn func() (backend.PooledConnect, error),
+	run func(pc backend.PooledConnect) []interface{}) (winner *hedgeAttempt, hedged bool) {
+
+	ch := make(chan *hedgeAttempt, 2)
+	start := func(pc backend.PooledConnect, hedge bool) {
+		go func() {
+			ch <- &hedgeAttempt{results: run(pc), pc: pc, hedge: hedge}
+		}()
+	}
+	start(pc, false)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case a := <-ch:
+		return a, false
+	case <-timer.C:
+	}
+
+	hedgePC, err := getHedgeConn()
+	if err != nil {
+		return <-ch, false
+	}
+	start(hedgePC, true)
+
+	first := <-ch
+	if !first.failed() {
+		go func() {
+			loser := <-ch
+			loser.pc.Recycle()
+		}()
+		return first, true
+	}
+
+	// 先返回的执行失败时等待另一个执行
+	second := <-ch
+	if second.failed() {
+		// 都失败时返回原始请求的结果
+		if first.hedge {
+			first, second = second, first
+		}
+		second.pc.Recycle()
+		return first, true
+	}
+	first.pc.Recycle()
+	return second, true
+}
+
+// getHedgeReadTracker 返回对冲读的耗时统计, 只对事务外从库读的跨分片查询生效, 不生效时返回nil
+func (se *SessionExecutor) getHedgeReadTracker(reqCtx *util.RequestContext, sliceCount int) *hedgeReadTracker {
+	hedge := se.GetNamespace().hedgeRead
+	if hedge == nil || sliceCount < 2 || !getFromSlave(reqCtx) || se.isInTransaction() {
+		return nil
+	}
+	return hedge
+}
+
+// executeInSliceWithHedge 在slice上执行, 超过对冲等待时间未返回时在从库上再执行一次, 返回先成功的结果和使用的连接
+func (se *SessionExecutor) executeInSliceWithHedge(hedge *hedgeReadTracker, sliceName string, pc backend.PooledConnect,
+	run func(pc backend.PooledConnect) []interface{}) ([]interface{}, backend.PooledConnect) {
+
+	timedRun := func(pc backend.PooledConnect) []interface{} {
+		startTime := time.Now()
+		results := run(pc)
+		if !hasErrorResult(results) {
+			hedge.record(sliceName, time.Since(startTime))
+		}
+		return results
+	}
+
+	delay, ok := hedge.delay(sliceName)
+	if !ok {
+		return timedRun(pc), pc
+	}
+
+	slice := se.GetNamespace().GetSlice(sliceName)
+	winner, hedged := hedgeRun(pc, delay, slice.GetSlaveConn, timedRun)
+	if hedged {
+		result := hedgeWinnerPrimary
+		if winner.hedge {
+			result = hedgeWinnerHedge
+		}
+		se.manager.GetStatisticManager().RecordHedgeRead(se.namespace, sliceName, result)
+	}
+	return winner.results, winner.pc
+}
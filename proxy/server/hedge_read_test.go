@@ -0,0 +1,112 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/mocks"
+)
+
+func TestHedgeReadTrackerDelay(t *testing.T) {
+	tracker := newHedgeReadTracker(90, 5*time.Millisecond)
+	for i := 1; i < hedgeMinSamples; i++ {
+		tracker.record("slice-0", time.Duration(i)*time.Millisecond)
+	}
+	if _, ok := tracker.delay("slice-0"); ok {
+		t.Fatalf("expect no hedge delay without enough samples")
+	}
+
+	for i := hedgeMinSamples; i <= 100; i++ {
+		tracker.record("slice-0", time.Duration(i)*time.Millisecond)
+	}
+	if d, ok := tracker.delay("slice-0"); !ok || d != 90*time.Millisecond {
+		t.Errorf("hedge delay error, expect: 90ms, actual: %v, %v", d, ok)
+	}
+
+	for i := 0; i < hedgeLatencyWindowSize; i++ {
+		tracker.record("slice-0", time.Millisecond)
+	}
+	if d, _ := tracker.delay("slice-0"); d != 5*time.Millisecond {
+		t.Errorf("hedge delay should not less than min delay, actual: %v", d)
+	}
+}
+
+func TestHedgeRun(t *testing.T) {
+	newConn := func() *mocks.PooledConnect {
+		pc := new(mocks.PooledConnect)
+		pc.On("Recycle").Return(nil)
+		return pc
+	}
+	runWith := func(slow backend.PooledConnect, err error) func(pc backend.PooledConnect) []interface{} {
+		return func(pc backend.PooledConnect) []interface{} {
+			if pc == slow {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if err != nil && pc != slow {
+				return []interface{}{err}
+			}
+			return []interface{}{pc}
+		}
+	}
+
+	t.Run("primary answers before delay", func(t *testing.T) {
+		primary := newConn()
+		winner, hedged := hedgeRun(primary, 20*time.Millisecond, func() (backend.PooledConnect, error) {
+			t.Fatalf("should not get hedge connection")
+			return nil, nil
+		}, runWith(nil, nil))
+		if hedged || winner.pc != primary {
+			t.Errorf("expect primary answer without hedge")
+		}
+	})
+
+	t.Run("hedge answers first", func(t *testing.T) {
+		primary, hedgeConn := newConn(), newConn()
+		winner, hedged := hedgeRun(primary, 10*time.Millisecond, func() (backend.PooledConnect, error) {
+			return hedgeConn, nil
+		}, runWith(primary, nil))
+		if !hedged || !winner.hedge || winner.pc != hedgeConn {
+			t.Fatalf("expect hedge answer")
+		}
+		time.Sleep(80 * time.Millisecond)
+		primary.AssertCalled(t, "Recycle")
+		hedgeConn.AssertNotCalled(t, "Recycle")
+	})
+
+	t.Run("hedge fails", func(t *testing.T) {
+		primary, hedgeConn := newConn(), newConn()
+		winner, hedged := hedgeRun(primary, 10*time.Millisecond, func() (backend.PooledConnect, error) {
+			return hedgeConn, nil
+		}, runWith(primary, errors.New("hedge error")))
+		if !hedged || winner.hedge || winner.failed() {
+			t.Fatalf("expect primary answer when hedge fails")
+		}
+		hedgeConn.AssertCalled(t, "Recycle")
+	})
+
+	t.Run("no hedge connection", func(t *testing.T) {
+		primary := newConn()
+		winner, hedged := hedgeRun(primary, 10*time.Millisecond, func() (backend.PooledConnect, error) {
+			return nil, errors.New("no slave")
+		}, runWith(primary, nil))
+		if hedged || winner.pc != primary {
+			t.Errorf("expect primary answer without hedge connection")
+		}
+	})
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+const (
+	// idempotencyTable 记录已完成写入的幂等键, 由gaea在写入所在的物理库中创建
+	idempotencyTable = "gaea_idempotency_keys"
+	// maxIdempotencyKeyLen 幂等键最大长度
+	maxIdempotencyKeyLen = 128
+)
+
+// 幂等键hint, 如: INSERT /*+ idem('order-1001') */ INTO ...
+var idempotencyHintRegexp = regexp.MustCompile(`(?i)/\*\+\s*idem\s*\(\s*'([^']*)'\s*\)\s*\*/`)
+
+// getIdempotencyKey return idempotency key in hint of sql, or empty string if not specified
+func getIdempotencyKey(sql string) (string, error) {
+	m := idempotencyHintRegexp.FindStringSubmatch(sql)
+	if m == nil {
+		return "", nil
+	}
+	key := m[1]
+	if key == "" || len(key) > maxIdempotencyKeyLen || strings.ContainsRune(key, '\\') {
+		return "", fmt.Errorf("invalid idempotency key: %s", key)
+	}
+	return key, nil
+}
+
+// idempotentPlan 带幂等键的写入: 与幂等键记录在同一个事务中执行, 已记录的幂等键直接返回上次的执行结果
+type idempotentPlan struct {
+	plan.Plan
+
+	se    *SessionExecutor
+	ns    *Namespace
+	key   string
+	slice string
+	db    string // 物理库, 幂等键表所在的库
+}
+
+// wrapIdempotentPlan 幂等键表和写入必须在同一个事务中提交, 因此只支持路由到单个slice的写入
+func (se *SessionExecutor) wrapIdempotentPlan(ns *Namespace, key string, p plan.Plan) (plan.Plan, error) {
+	inner := p
+	if tp, ok := p.(*temporaryTablePlan); ok {
+		inner = tp.Plan
+	}
+	_, sqls, err := plan.GetPlanSQLs(inner, ns.GetPhysicalDBs())
+	if err != nil {
+		return nil, fmt.Errorf("unsupport plan for idempotency key, %v", err)
+	}
+	if len(sqls) != 1 {
+		return nil, fmt.Errorf("idempotency key only support write in one slice")
+	}
+
+	ip := &idempotentPlan{Plan: p, se: se, ns: ns, key: key}
+	for slice, dbSQLs := range sqls {
+		dbs := make([]string, 0, len(dbSQLs))
+		for db := range dbSQLs {
+			dbs = append(dbs, db)
+		}
+		sort.Strings(dbs)
+		ip.slice, ip.db = slice, dbs[0]
+	}
+	return ip, nil
+}
+
+// ExecuteIn implement Plan
+func (p *idempotentPlan) ExecuteIn(reqCtx *util.RequestContext, e plan.Executor) (*mysql.Result, error) {
+	se := p.se
+	if err := p.ns.ensureIdempotencyTable(p.slice, p.db); err != nil {
+		return nil, fmt.Errorf("create idempotency table error: %v", err)
+	}
+
+	// 非事务中的写入由gaea开启事务, 保证幂等键和写入同时提交
+	autoTx := !se.isInTransaction()
+	if autoTx {
+		se.txLock.Lock()
+		se.status |= mysql.ServerStatusInTrans
+		se.txLock.Unlock()
+	}
+
+	r, err := p.execute(reqCtx, e)
+	if !autoTx {
+		return r, err
+	}
+	if err != nil {
+		if rerr := se.rollback(); rerr != nil {
+			exeLogger.Warnf("rollback idempotent write error, key: %s, err: %v", p.key, rerr)
+		}
+		return nil, err
+	}
+	if err = se.commit(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (p *idempotentPlan) execute(reqCtx *util.RequestContext, e plan.Executor) (*mysql.Result, error) {
+	table := fmt.Sprintf("`%s`.`%s`", p.db, idempotencyTable)
+
+	// FOR UPDATE锁住幂等键, 并发重试的请求会等待前一个请求提交或回滚
+	selectSQL := fmt.Sprintf("SELECT `affected_rows`, `last_insert_id` FROM %s WHERE `idem_key` = '%s' FOR UPDATE", table, p.key)
+	rs, err := p.executeInTarget(reqCtx, e, selectSQL)
+	if err != nil {
+		return nil, err
+	}
+	if rs.Resultset != nil && len(rs.Values) != 0 {
+		return p.replay(rs)
+	}
+
+	r, err := p.Plan.ExecuteIn(reqCtx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	insertSQL := fmt.Sprintf("INSERT INTO %s (`idem_key`, `affected_rows`, `last_insert_id`) VALUES ('%s', %d, %d)", table, p.key, r.AffectedRows, r.InsertID)
+	if _, err = p.executeInTarget(reqCtx, e, insertSQL); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// replay 幂等键已记录, 返回上次写入的结果, 不再执行写入
+func (p *idempotentPlan) replay(rs *mysql.Result) (*mysql.Result, error) {
+	affectedRows, err := rs.GetUint(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	insertID, err := rs.GetUint(0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if insertID != 0 {
+		p.se.SetLastInsertID(insertID)
+	}
+	exeLogger.Infof("idempotency key already applied, skip write, key: %s, slice: %s, db: %s", p.key, p.slice, p.db)
+	return &mysql.Result{AffectedRows: affectedRows, InsertID: insertID}, nil
+}
+
+func (p *idempotentPlan) executeInTarget(reqCtx *util.RequestContext, e plan.Executor, sql string) (*mysql.Result, error) {
+	rs, err := e.ExecuteSQLs(reqCtx, map[string]map[string][]string{p.slice: {p.db: {sql}}})
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, fmt.Errorf("no result of sql: %s", sql)
+	}
+	return rs[0], nil
+}
+
+// ensureIdempotencyTable 使用单独的主库连接建表, 避免DDL隐式提交会话中的事务
+func (ns *Namespace) ensureIdempotencyTable(slice, db string) error {
+	key := slice + "." + db
+	if _, ok := ns.idempotencyTables.Load(key); ok {
+		return nil
+	}
+
+	pc, err := ns.GetSlice(slice).GetMasterConn()
+	if err != nil {
+		return err
+	}
+	defer pc.Recycle()
+
+	sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` ("+
+		"`idem_key` varchar(%d) NOT NULL, "+
+		"`affected_rows` bigint unsigned NOT NULL DEFAULT 0, "+
+		"`last_insert_id` bigint unsigned NOT NULL DEFAULT 0, "+
+		"`created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, "+
+		"PRIMARY KEY (`idem_key`)) ENGINE=InnoDB", db, idempotencyTable, maxIdempotencyKeyLen)
+	if _, err = pc.Execute(sql); err != nil {
+		return err
+	}
+	ns.idempotencyTables.Store(key, true)
+	return nil
+}
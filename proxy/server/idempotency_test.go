@@ -0,0 +1,166 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestGetIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		sql    string
+		key    string
+		hasErr bool
+	}{
+		{sql: "insert into t values (1)"},
+		{sql: "insert /*+ idem('order-1001') */ into t values (1)", key: "order-1001"},
+		{sql: "/*+ IDEM( 'k:1' ) */ update t set a = 1", key: "k:1"},
+		{sql: "insert /*+ idem('') */ into t values (1)", hasErr: true},
+		{sql: "insert /*+ idem('a\\') */ into t values (1)", hasErr: true},
+		{sql: "insert /*+ idem('" + strings.Repeat("a", maxIdempotencyKeyLen+1) + "') */ into t values (1)", hasErr: true},
+	}
+	for _, test := range tests {
+		key, err := getIdempotencyKey(test.sql)
+		if (err != nil) != test.hasErr {
+			t.Errorf("get idempotency key error, sql: %s, err: %v", test.sql, err)
+		}
+		if key != test.key {
+			t.Errorf("idempotency key not equal, sql: %s, expect: %s, actual: %s", test.sql, test.key, key)
+		}
+	}
+}
+
+type fakeWritePlan struct {
+	executed int
+}
+
+func (p *fakeWritePlan) ExecuteIn(*util.RequestContext, plan.Executor) (*mysql.Result, error) {
+	p.executed++
+	return &mysql.Result{AffectedRows: 1, InsertID: 7}, nil
+}
+
+func (p *fakeWritePlan) Size() int {
+	return 1
+}
+
+// idempotencyExecutor 模拟幂等键表, 记录下发到后端的SQL
+type idempotencyExecutor struct {
+	plan.Executor
+	applied bool
+	sqls    []string
+}
+
+func (e *idempotencyExecutor) ExecuteSQLs(ctx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
+	var ret []*mysql.Result
+	for _, dbSQLs := range sqls {
+		for _, tableSQLs := range dbSQLs {
+			for _, sql := range tableSQLs {
+				e.sqls = append(e.sqls, sql)
+				var rows [][]interface{}
+				if strings.HasPrefix(sql, "INSERT") {
+					e.applied = true
+				} else if e.applied {
+					rows = append(rows, []interface{}{uint64(1), uint64(7)})
+				}
+				r, err := mysql.BuildResultset(nil, []string{"affected_rows", "last_insert_id"}, rows)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, &mysql.Result{Resultset: r})
+			}
+		}
+	}
+	return ret, nil
+}
+
+func TestIdempotentPlan(t *testing.T) {
+	rt, err := router.NewRouter(&models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: models.ShardMod, Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &Namespace{router: rt}
+	se := &SessionExecutor{db: "db_ks", status: initClientConnStatus, txConns: make(map[string]backend.PooledConnect)}
+
+	wrap := func(sql string) (plan.Plan, error) {
+		stmt, err := parser.ParseSQL(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := plan.BuildPlan(stmt, ns.GetPhysicalDBs(), se.db, sql, rt, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return se.wrapIdempotentPlan(ns, "k1", p)
+	}
+
+	if _, err := wrap("delete from tbl_ks where id > 1"); err == nil {
+		t.Errorf("write in multiple slices should not support idempotency key")
+	}
+
+	p, err := wrap("delete from tbl_ks where id = 1")
+	if err != nil {
+		t.Fatalf("wrap plan error: %v", err)
+	}
+	ip := p.(*idempotentPlan)
+	if ip.slice != "slice-0" || ip.db != "db_ks" {
+		t.Fatalf("idempotency target not equal, slice: %s, db: %s", ip.slice, ip.db)
+	}
+	ns.idempotencyTables.Store(ip.slice+"."+ip.db, true)
+	write := &fakeWritePlan{}
+	ip.Plan = write
+
+	e := &idempotencyExecutor{}
+	for i := 0; i < 2; i++ {
+		r, err := ip.ExecuteIn(util.NewRequestContext(), e)
+		if err != nil {
+			t.Fatalf("execute idempotent plan error: %v", err)
+		}
+		if r.AffectedRows != 1 || r.InsertID != 7 {
+			t.Errorf("result not equal, affected rows: %d, insert id: %d", r.AffectedRows, r.InsertID)
+		}
+		if se.isInTransaction() {
+			t.Errorf("transaction opened by idempotent write should be committed")
+		}
+	}
+	if write.executed != 1 {
+		t.Errorf("write should be executed once, actual: %d", write.executed)
+	}
+	if se.GetLastInsertID() != 7 {
+		t.Errorf("last insert id should be restored, actual: %d", se.GetLastInsertID())
+	}
+	expect := []string{
+		"SELECT `affected_rows`, `last_insert_id` FROM `db_ks`.`gaea_idempotency_keys` WHERE `idem_key` = 'k1' FOR UPDATE",
+		"INSERT INTO `db_ks`.`gaea_idempotency_keys` (`idem_key`, `affected_rows`, `last_insert_id`) VALUES ('k1', 1, 7)",
+		"SELECT `affected_rows`, `last_insert_id` FROM `db_ks`.`gaea_idempotency_keys` WHERE `idem_key` = 'k1' FOR UPDATE",
+	}
+	if strings.Join(e.sqls, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("sqls not equal, expect: %v, actual: %v", expect, e.sqls)
+	}
+}
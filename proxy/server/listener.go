@@ -0,0 +1,202 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+var errListenerClosed = errors.New("listener closed")
+
+// listenAddr one endpoint of proxy_addr
+type listenAddr struct {
+	network string
+	address string
+}
+
+// parseListenAddrs parse proxy_addr, 多个地址以逗号分隔, 每个地址可以用network://指定协议,
+// 如 0.0.0.0:13306,tcp6://[::]:13306,unix:///tmp/gaea.sock, 未指定时使用proto_type
+func parseListenAddrs(protoType, addrs string) ([]listenAddr, error) {
+	var ret []listenAddr
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		network := protoType
+		if idx := strings.Index(addr, "://"); idx >= 0 {
+			network, addr = addr[:idx], addr[idx+3:]
+		}
+		switch network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return nil, fmt.Errorf("unsupported network %s of proxy addr %s", network, addr)
+		}
+		if addr == "" {
+			return nil, fmt.Errorf("empty address of network %s", network)
+		}
+		ret = append(ret, listenAddr{network: network, address: addr})
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("proxy addr is empty")
+	}
+	return ret, nil
+}
+
+// getProxyPort return port of the first tcp address in proxy_addr, used for proxy registration
+func getProxyPort(protoType, addrs string) (string, error) {
+	listenAddrs, err := parseListenAddrs(protoType, addrs)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range listenAddrs {
+		if addr.network == "unix" {
+			continue
+		}
+		_, port, err := net.SplitHostPort(addr.address)
+		return port, err
+	}
+	return "", fmt.Errorf("no tcp address in proxy addr %s", addrs)
+}
+
+// multiListener 在多个地址上监听, 对外表现为一个net.Listener, 所有连接由同一个Server处理
+type multiListener struct {
+	listeners  []net.Listener
+	tcpOptions util.TCPOptions
+	conns      chan acceptResult
+	closed     chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiAddr addresses of multiListener
+type multiAddr []net.Addr
+
+// Network implement net.Addr
+func (a multiAddr) Network() string {
+	networks := make([]string, 0, len(a))
+	for _, addr := range a {
+		networks = append(networks, addr.Network())
+	}
+	return strings.Join(networks, ",")
+}
+
+// String implement net.Addr
+func (a multiAddr) String() string {
+	addrs := make([]string, 0, len(a))
+	for _, addr := range a {
+		addrs = append(addrs, addr.Network()+"://"+addr.String())
+	}
+	return strings.Join(addrs, ",")
+}
+
+func newMultiListener(protoType, addrs string, tcpOptions util.TCPOptions) (*multiListener, error) {
+	listenAddrs, err := parseListenAddrs(protoType, addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &multiListener{
+		tcpOptions: tcpOptions,
+		conns:      make(chan acceptResult),
+		closed:     make(chan struct{}),
+	}
+	for _, addr := range listenAddrs {
+		ln, err := net.Listen(addr.network, addr.address)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("listen %s://%s error: %v", addr.network, addr.address, err)
+		}
+		l.listeners = append(l.listeners, ln)
+	}
+
+	for _, ln := range l.listeners {
+		l.wg.Add(1)
+		go l.serve(ln)
+	}
+	return l, nil
+}
+
+func (l *multiListener) serve(ln net.Listener) {
+	defer l.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err == nil {
+			if e := l.tcpOptions.Apply(conn); e != nil {
+				logging.DefaultLogger.Warnf("[server] set tcp options error, remoteAddr: %s, err: %v", conn.RemoteAddr().String(), e)
+			}
+		}
+		select {
+		case l.conns <- acceptResult{conn: conn, err: err}:
+		case <-l.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			// 非临时错误时该地址不再接受连接, 其他地址不受影响
+			if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+				return
+			}
+		}
+	}
+}
+
+// Accept implement net.Listener, return connection from any address
+func (l *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-l.conns:
+		return r.conn, r.err
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+// Close implement net.Listener, close all addresses and wait for accept goroutines
+func (l *multiListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		for _, ln := range l.listeners {
+			if e := ln.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		l.wg.Wait()
+	})
+	return err
+}
+
+// Addr implement net.Listener, return all addresses
+func (l *multiListener) Addr() net.Addr {
+	addrs := make(multiAddr, 0, len(l.listeners))
+	for _, ln := range l.listeners {
+		addrs = append(addrs, ln.Addr())
+	}
+	return addrs
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestParseListenAddrs(t *testing.T) {
+	tests := []struct {
+		addrs  string
+		expect []listenAddr
+		hasErr bool
+	}{
+		{addrs: "0.0.0.0:13306", expect: []listenAddr{{network: "tcp4", address: "0.0.0.0:13306"}}},
+		{
+			addrs: "0.0.0.0:13306, tcp6://[::]:13306,unix:///tmp/gaea.sock",
+			expect: []listenAddr{
+				{network: "tcp4", address: "0.0.0.0:13306"},
+				{network: "tcp6", address: "[::]:13306"},
+				{network: "unix", address: "/tmp/gaea.sock"},
+			},
+		},
+		{addrs: "udp://0.0.0.0:13306", hasErr: true},
+		{addrs: "tcp://", hasErr: true},
+		{addrs: " , ", hasErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.addrs, func(t *testing.T) {
+			actual, err := parseListenAddrs("tcp4", test.addrs)
+			if test.hasErr {
+				if err == nil {
+					t.Fatalf("expect error, actual: %v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, test.expect) {
+				t.Errorf("listen addrs not match, expect: %v, actual: %v", test.expect, actual)
+			}
+		})
+	}
+}
+
+func TestGetProxyPort(t *testing.T) {
+	port, err := getProxyPort("tcp4", "unix:///tmp/gaea.sock,0.0.0.0:13306,tcp6://[::]:13307")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port != "13306" {
+		t.Errorf("proxy port not match, expect: 13306, actual: %s", port)
+	}
+	if _, err := getProxyPort("tcp4", "unix:///tmp/gaea.sock"); err == nil {
+		t.Error("expect error when there is no tcp address")
+	}
+}
+
+func TestParseProxyTCPOptions(t *testing.T) {
+	opts, err := parseProxyTCPOptions(&models.Proxy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts != util.DefaultTCPOptions() {
+		t.Errorf("default tcp options not match: %+v", opts)
+	}
+
+	opts, err = parseProxyTCPOptions(&models.Proxy{TCPKeepAlivePeriod: 60, TCPNoDelay: "false", TCPReadBufferSize: 65536})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := util.TCPOptions{KeepAlivePeriod: 60 * time.Second, NoDelay: false, ReadBufferSize: 65536}
+	if opts != expect {
+		t.Errorf("tcp options not match, expect: %+v, actual: %+v", expect, opts)
+	}
+
+	for _, cfg := range []*models.Proxy{{TCPNoDelay: "yes"}, {TCPKeepAlivePeriod: -2}, {TCPWriteBufferSize: -1}} {
+		if _, err := parseProxyTCPOptions(cfg); err == nil {
+			t.Errorf("expect error of invalid tcp options: %+v", cfg)
+		}
+	}
+}
+
+func TestMultiListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "gaea.sock")
+
+	l, err := newMultiListener("tcp4", "127.0.0.1:0,unix://"+sock, util.DefaultTCPOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := l.Addr().(multiAddr)
+	if len(addrs) != 2 || !strings.Contains(l.Addr().String(), "unix://"+sock) {
+		t.Fatalf("listener addr not match: %s", l.Addr().String())
+	}
+
+	for _, addr := range addrs {
+		c, err := net.Dial(addr.Network(), addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.LocalAddr().Network() != addr.Network() {
+			t.Errorf("accepted conn network not match, expect: %s, actual: %s", addr.Network(), conn.LocalAddr().Network())
+		}
+		conn.Close()
+		c.Close()
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Accept(); err != errListenerClosed {
+		t.Errorf("accept after close, expect: %v, actual: %v", errListenerClosed, err)
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("unix socket should be removed after close, err: %v", err)
+	}
+}
+
+func TestMultiListenerListenError(t *testing.T) {
+	l, err := newMultiListener("tcp4", "127.0.0.1:0", util.DefaultTCPOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// 任一地址监听失败时已经监听的地址也要关闭
+	if _, err := newMultiListener("tcp4", "127.0.0.1:0,"+l.Addr().(multiAddr)[0].String(), util.DefaultTCPOptions()); err == nil {
+		t.Fatal("expect listen error for address in use")
+	}
+}
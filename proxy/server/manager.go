@@ -29,9 +29,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/core/errors"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/fault"
+	"github.com/XiaoMi/Gaea/proxy/replay"
 	"github.com/XiaoMi/Gaea/stats"
 	"github.com/XiaoMi/Gaea/stats/prometheus"
 	"github.com/XiaoMi/Gaea/util"
@@ -83,10 +86,11 @@ func loadAllNamespace(cfg *models.Proxy) (map[string]*models.Namespace, error) {
 		go func() {
 			client := provider.NewClient(cfg.ConfigType, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, root)
 			store := provider.NewStore(client)
+			store.SetEnvironment(cfg.Environ)
 			defer store.Close()
 			defer wg.Done()
 			for name := range nameC {
-				namespace, e := store.LoadNamespace(cfg.EncryptKey, name)
+				namespace, e := store.LoadResolvedNamespace(cfg.EncryptKey, name)
 				if e != nil {
 					log.Warnf("load namespace %s failed, err: %v", name, err)
 					// assign extent err out of this scope
@@ -135,17 +139,49 @@ type Manager struct {
 	namespaces     [2]*NamespaceManager
 	users          [2]*UserManager
 	statistics     *StatisticManager
+
+	captureLock sync.Mutex
+	recorder    *replay.Recorder // 非空时记录客户端语句, 用于流量回放
+
+	faultInjector *fault.Injector
+
+	adminAudit *AdminAuditLog // 管理接口和管理语句的操作审计
+
+	diagnosticGuard *diagnosticGuard // 限制pprof和诊断包等诊断操作的并发和频率
+
+	sequenceStore *provider.Store // 序列号号段分配记录存储, 仅etcd配置时使用
+
+	commits *commitTracker // 进行中的跨分片提交
+
+	transactions *transactionTracker // 进行中的事务
 }
 
 // NewManager return empty Manager
 func NewManager() *Manager {
-	return &Manager{}
+	return &Manager{
+		faultInjector:   fault.NewInjector(),
+		adminAudit:      NewAdminAuditLog(defaultAdminAuditCapacity),
+		diagnosticGuard: newDiagnosticGuard(diagnosticMinInterval),
+		commits:         newCommitTracker(defaultCommitHangThreshold),
+		transactions:    newTransactionTracker(defaultLongTransactionTime),
+	}
 }
 
 // CreateManager create manager
 func CreateManager(cfg *models.Proxy, namespaceConfigs map[string]*models.Namespace) (*Manager, error) {
 	m := NewManager()
 
+	commitHangThreshold, err := parseCommitHangThreshold(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.commits = newCommitTracker(commitHangThreshold)
+	longTransactionTime, err := parseLongTransactionTime(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.transactions = newTransactionTracker(longTransactionTime)
+
 	// init statistics
 	statisticManager, err := CreateStatisticManager(cfg, m)
 	if err != nil {
@@ -166,7 +202,9 @@ func CreateManager(cfg *models.Proxy, namespaceConfigs map[string]*models.Namesp
 	}
 	m.users[current] = user
 
+	m.initSequenceSegmentStore(cfg)
 	m.startConnectPoolMetricsTask(cfg.StatsInterval)
+	m.startMaterializedViewTask()
 	return m, nil
 }
 
@@ -180,6 +218,59 @@ func (m *Manager) Close() {
 	}
 
 	m.statistics.Close()
+	m.StopCapture()
+	m.closeSequenceSegmentStore()
+}
+
+// StartCapture start capturing client statements of namespace to file, capture all namespaces if namespace is empty
+func (m *Manager) StartCapture(path, namespace string) error {
+	m.captureLock.Lock()
+	defer m.captureLock.Unlock()
+	if m.recorder != nil {
+		return fmt.Errorf("capture is already running")
+	}
+	r, err := replay.NewRecorder(path, namespace)
+	if err != nil {
+		return err
+	}
+	m.recorder = r
+	return nil
+}
+
+// StopCapture stop capturing client statements
+func (m *Manager) StopCapture() error {
+	m.captureLock.Lock()
+	defer m.captureLock.Unlock()
+	if m.recorder == nil {
+		return nil
+	}
+	err := m.recorder.Close()
+	m.recorder = nil
+	return err
+}
+
+func (m *Manager) captureSQL(se *SessionExecutor, sql string, startTime time.Time, err error) {
+	m.captureLock.Lock()
+	r := m.recorder
+	m.captureLock.Unlock()
+	if r == nil || !r.ShouldRecord(se.namespace) {
+		return
+	}
+
+	rec := &replay.Record{
+		Time:       startTime,
+		ConnID:     se.connID,
+		Namespace:  se.namespace,
+		User:       se.user,
+		DB:         se.db,
+		ClientAddr: se.clientAddr,
+		SQL:        sql,
+		Cost:       time.Since(startTime).Microseconds(),
+		Succ:       err == nil,
+	}
+	if e := r.Record(rec); e != nil {
+		log.Warnf("capture SQL failed, namespace: %s, err: %v", se.namespace, e)
+	}
 }
 
 // ReloadNamespacePrepare prepare commit
@@ -275,6 +366,32 @@ func (m *Manager) CheckPassword(user string, salt, auth []byte) (bool, string) {
 	return m.users[current].CheckPassword(user, salt, auth)
 }
 
+// GetFaultInjector return fault injector of backend execution
+func (m *Manager) GetFaultInjector() *fault.Injector {
+	return m.faultInjector
+}
+
+// GetAdminAuditLog return audit log of admin actions
+func (m *Manager) GetAdminAuditLog() *AdminAuditLog {
+	return m.adminAudit
+}
+
+// getCommitTracker return tracker of multi-slice commits, nil if manager is nil
+func (m *Manager) getCommitTracker() *commitTracker {
+	if m == nil {
+		return nil
+	}
+	return m.commits
+}
+
+// getTransactionTracker return tracker of open transactions, nil if manager is nil
+func (m *Manager) getTransactionTracker() *transactionTracker {
+	if m == nil {
+		return nil
+	}
+	return m.transactions
+}
+
 // GetStatisticManager return proxy status to record status
 func (m *Manager) GetStatisticManager() *StatisticManager {
 	return m.statistics
@@ -294,9 +411,9 @@ func (m *Manager) ConfigFingerprint() string {
 
 // RecordSessionSQLMetrics record session SQL metrics, like response time, error
 func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *SessionExecutor, sql string, startTime time.Time, err error) {
-	trimmedSql := strings.ReplaceAll(sql, "\n", " ")
 	namespace := se.namespace
 	ns := m.GetNamespace(namespace)
+	trimmedSql := ns.redactSQL(sql)
 	if ns == nil {
 		log.Warnf("record session SQL metrics error, namespace: %s, parser: %s, err: %s", namespace, trimmedSql, "namespace not found")
 		return
@@ -312,6 +429,7 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 
 	// record parser timing
 	m.statistics.recordSessionSQLTiming(namespace, operation, startTime)
+	m.statistics.recordSessionSQLTypeTiming(namespace, getStmtTypeCategory(reqCtx, sql), startTime)
 
 	// record slow parser
 	duration := time.Since(startTime).Nanoseconds() / int64(time.Millisecond)
@@ -325,7 +443,7 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 
 	// record error parser
 	if err != nil {
-		logging.DefaultLogger.Warnf("session error SQL, namespace: %s, parser: %s, cost: %d ms, err: %v", namespace, trimmedSql, duration, err)
+		logging.DefaultLogger.Warnf("session error SQL, namespace: %s, parser: %s, cost: %d ms, err: %s", namespace, trimmedSql, duration, ns.redactError(sql, err))
 		fingerprint := mysql.GetFingerprint(sql)
 		hash := mysql.GetMd5(fingerprint)
 		ns.SetErrorSQLFingerprint(hash, fingerprint)
@@ -336,12 +454,14 @@ func (m *Manager) RecordSessionSQLMetrics(reqCtx *util.RequestContext, se *Sessi
 		m.statistics.generalLogger.Infof("client: %s, namespace: %s, db: %s, user: %s, cmd: %s, parser: %s, cost: %d ms, succ: %t",
 			se.clientAddr, namespace, se.db, se.user, operation, trimmedSql, duration, err == nil)
 	}
+
+	m.captureSQL(se, sql, startTime, err)
 }
 
 // RecordBackendSQLMetrics record backend SQL metrics, like response time, error
-func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, namespace string, sql, backendAddr string, startTime time.Time, err error) {
-	trimmedSql := strings.ReplaceAll(sql, "\n", " ")
+func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, namespace, slice string, sql, backendAddr string, startTime time.Time, err error) {
 	ns := m.GetNamespace(namespace)
+	trimmedSql := ns.redactSQL(sql)
 	if ns == nil {
 		logging.DefaultLogger.Warnf("record backend SQL metrics error, namespace: %s, backend addr: %s, parser: %s, err: %s", namespace, backendAddr, trimmedSql, "namespace not found")
 		return
@@ -357,6 +477,7 @@ func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, namespace
 
 	// record parser timing
 	m.statistics.recordBackendSQLTiming(namespace, operation, startTime)
+	m.statistics.recordBackendSQLTypeTiming(namespace, slice, getStmtTypeCategory(reqCtx, sql), startTime)
 
 	// record slow parser
 	duration := time.Since(startTime).Nanoseconds() / int64(time.Millisecond)
@@ -370,11 +491,52 @@ func (m *Manager) RecordBackendSQLMetrics(reqCtx *util.RequestContext, namespace
 
 	// record error parser
 	if err != nil {
-		logging.DefaultLogger.Warnf("backend error SQL, namespace: %s, addr: %s, parser: %s, cost %d ms, err: %v", namespace, backendAddr, trimmedSql, duration, err)
+		logging.DefaultLogger.Warnf("backend error SQL, namespace: %s, addr: %s, parser: %s, cost %d ms, err: %s", namespace, backendAddr, trimmedSql, duration, ns.redactError(sql, err))
 		fingerprint := mysql.GetFingerprint(sql)
 		hash := mysql.GetMd5(fingerprint)
 		ns.SetBackendErrorSQLFingerprint(hash, fingerprint)
 		m.statistics.recordBackendErrorSQLFingerprint(namespace, operation, hash)
+		m.RecordBackendTimeout(namespace, slice, err)
+	}
+}
+
+// RecordBackendTimeout record timeout of backend call by phase, other errors are ignored
+func (m *Manager) RecordBackendTimeout(namespace, slice string, err error) {
+	if te, ok := backend.GetTimeoutError(err); ok {
+		m.statistics.RecordBackendTimeout(namespace, slice, string(te.Phase))
+	}
+}
+
+// 语句类型耗时分布的分类
+const (
+	stmtTypeCategorySelect = "select"
+	stmtTypeCategoryInsert = "insert"
+	stmtTypeCategoryUpdate = "update"
+	stmtTypeCategoryDelete = "delete"
+	stmtTypeCategoryDDL    = "ddl"
+	stmtTypeCategoryOther  = "other"
+)
+
+// getStmtTypeCategory 将语句类型归并为select/insert/update/delete/ddl/other, 避免监控label过多
+func getStmtTypeCategory(reqCtx *util.RequestContext, sql string) string {
+	stmtType, ok := reqCtx.Get(util.StmtType).(parser.StatementType)
+	if !ok {
+		stmtType = parser.PreviewSql(sql)
+	}
+
+	switch stmtType {
+	case parser.StmtSelect:
+		return stmtTypeCategorySelect
+	case parser.StmtInsert, parser.StmtReplace:
+		return stmtTypeCategoryInsert
+	case parser.StmtUpdate:
+		return stmtTypeCategoryUpdate
+	case parser.StmtDelete:
+		return stmtTypeCategoryDelete
+	case parser.StmtDDL:
+		return stmtTypeCategoryDDL
+	default:
+		return stmtTypeCategoryOther
 	}
 }
 
@@ -391,9 +553,13 @@ func (m *Manager) startConnectPoolMetricsTask(interval int) {
 				return
 			case <-t.C:
 				current, _, _ := m.switchIndex.Get()
+				namespaces := make([]string, 0, len(m.namespaces[current].namespaces))
 				for nameSpaceName, _ := range m.namespaces[current].namespaces {
 					m.recordBackendConnectPoolMetrics(nameSpaceName)
+					namespaces = append(namespaces, nameSpaceName)
 				}
+				m.commits.recordMetrics(m.statistics, namespaces)
+				m.transactions.reportLongTransactions()
 			}
 		}
 	}()
@@ -407,10 +573,14 @@ func (m *Manager) recordBackendConnectPoolMetrics(namespace string) {
 	}
 
 	for sliceName, slice := range ns.slices {
-		m.statistics.recordConnectPoolInuseCount(namespace, sliceName, slice.Master.Addr(), slice.Master.InUse())
-		m.statistics.recordConnectPoolIdleCount(namespace, sliceName, slice.Master.Addr(), slice.Master.Available())
-		m.statistics.recordConnectPoolWaitCount(namespace, sliceName, slice.Master.Addr(), slice.Master.WaitCount())
-		for _, slave := range slice.Slave {
+		// 拓扑发现会切换master和slave连接池
+		slice.RLock()
+		master, slaves := slice.Master, slice.Slave
+		slice.RUnlock()
+		m.statistics.recordConnectPoolInuseCount(namespace, sliceName, master.Addr(), master.InUse())
+		m.statistics.recordConnectPoolIdleCount(namespace, sliceName, master.Addr(), master.Available())
+		m.statistics.recordConnectPoolWaitCount(namespace, sliceName, master.Addr(), master.WaitCount())
+		for _, slave := range slaves {
 			m.statistics.recordConnectPoolInuseCount(namespace, sliceName, slave.Addr(), slave.InUse())
 			m.statistics.recordConnectPoolIdleCount(namespace, sliceName, slave.Addr(), slave.Available())
 			m.statistics.recordConnectPoolWaitCount(namespace, sliceName, slave.Addr(), slave.WaitCount())
@@ -476,6 +646,9 @@ func (n *NamespaceManager) DeleteNamespace(ns string) {
 
 // GetNamespace get namespace in NamespaceManager
 func (n *NamespaceManager) GetNamespace(namespace string) *Namespace {
+	if n == nil {
+		return nil
+	}
 	return n.namespaces[namespace]
 }
 
@@ -618,6 +791,13 @@ const (
 	statsLabelFlowDirection = "Flowdirection"
 	statsLabelSlice         = "Slice"
 	statsLabelIPAddr        = "IPAddr"
+	statsLabelStmtType      = "StmtType"
+	statsLabelState         = "State"
+	statsLabelReason        = "Reason"
+	statsLabelWinner        = "Winner"
+	statsLabelPhase         = "Phase"
+	statsLabelUser          = "User"
+	statsLabelResult        = "Result"
 )
 
 // StatisticManager statistics manager
@@ -630,17 +810,28 @@ type StatisticManager struct {
 	generalLogger *zap.SugaredLogger
 
 	sqlTimings                *stats.MultiTimings            // SQL耗时统计
+	sqlTypeTimings            *stats.MultiTimings            // 按语句类型的SQL耗时分布
 	sqlFingerprintSlowCounts  *stats.CountersWithMultiLabels // 慢SQL指纹数量统计
 	sqlErrorCounts            *stats.CountersWithMultiLabels // SQL错误数统计
 	sqlFingerprintErrorCounts *stats.CountersWithMultiLabels // SQL指纹错误数统计
 	sqlForbidenCounts         *stats.CountersWithMultiLabels // SQL黑名单请求统计
 	flowCounts                *stats.CountersWithMultiLabels // 业务流量统计
 	sessionCounts             *stats.GaugesWithMultiLabels   // 前端会话数统计
+	connWorkerCounts          *stats.GaugesWithMultiLabels   // 前端连接处理worker统计(active/queued)
+	connRejectCounts          *stats.CountersWithMultiLabels // 前端连接被拒绝次数统计
+	hedgeReadCounts           *stats.CountersWithMultiLabels // 对冲读次数统计(primary/hedge先返回)
+	userConnCounts            *stats.GaugesWithMultiLabels   // 每个用户的前端连接数统计
+	routingAuditCounts        *stats.CountersWithMultiLabels // 新旧分片规则路由结果对比次数统计(match/mismatch)
+	commitProgressCounts      *stats.GaugesWithMultiLabels   // 进行中的跨分片提交数统计(committing/hung)
+	partialCommitCounts       *stats.CountersWithMultiLabels // 跨分片提交部分slice成功的次数统计
+	transactionTimings        *stats.MultiTimings            // 事务耗时统计(commit/commit_failed/rollback)
 
 	backendSQLTimings                *stats.MultiTimings            // 后端SQL耗时统计
+	backendSQLTypeTimings            *stats.MultiTimings            // 按slice和语句类型的后端SQL耗时分布
 	backendSQLFingerprintSlowCounts  *stats.CountersWithMultiLabels // 后端慢SQL指纹数量统计
 	backendSQLErrorCounts            *stats.CountersWithMultiLabels // 后端SQL错误数统计
 	backendSQLFingerprintErrorCounts *stats.CountersWithMultiLabels // 后端SQL指纹错误数统计
+	backendTimeoutCounts             *stats.CountersWithMultiLabels // 后端调用超时次数统计(connect/first_byte/total)
 	backendConnectPoolIdleCounts     *stats.GaugesWithMultiLabels   //后端空闲连接数统计
 	backendConnectPoolInUseCounts    *stats.GaugesWithMultiLabels   //后端正在使用连接数统计
 	backendConnectPoolWaitCounts     *stats.GaugesWithMultiLabels   //后端等待队列统计
@@ -702,6 +893,8 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 
 	s.sqlTimings = stats.NewMultiTimings("SqlTimings",
 		"gaea proxy parser sqlTimings", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation})
+	s.sqlTypeTimings = stats.NewMultiTimings("SqlTypeTimings",
+		"gaea proxy sql timings per statement type", []string{statsLabelCluster, statsLabelNamespace, statsLabelStmtType})
 	s.sqlFingerprintSlowCounts = stats.NewCountersWithMultiLabels("SqlFingerprintSlowCounts",
 		"gaea proxy parser fingerprint slow counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint})
 	s.sqlErrorCounts = stats.NewCountersWithMultiLabels("SqlErrorCounts",
@@ -714,15 +907,35 @@ func (s *StatisticManager) Init(cfg *models.Proxy) error {
 		"gaea proxy flow counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFlowDirection})
 	s.sessionCounts = stats.NewGaugesWithMultiLabels("SessionCounts",
 		"gaea proxy session counts", []string{statsLabelCluster, statsLabelNamespace})
+	s.connWorkerCounts = stats.NewGaugesWithMultiLabels("ConnWorkerCounts",
+		"gaea proxy connection worker counts", []string{statsLabelCluster, statsLabelState})
+	s.connRejectCounts = stats.NewCountersWithMultiLabels("ConnRejectCounts",
+		"gaea proxy rejected connection counts", []string{statsLabelCluster, statsLabelReason})
+	s.routingAuditCounts = stats.NewCountersWithMultiLabels("RoutingAuditCounts",
+		"gaea proxy routing audit counts of candidate shard rules", []string{statsLabelCluster, statsLabelNamespace, statsLabelResult})
+	s.commitProgressCounts = stats.NewGaugesWithMultiLabels("CommitProgressCounts",
+		"gaea proxy multi-slice commits in progress", []string{statsLabelCluster, statsLabelNamespace, statsLabelState})
+	s.partialCommitCounts = stats.NewCountersWithMultiLabels("PartialCommitCounts",
+		"gaea proxy multi-slice commits committed on part of slices", []string{statsLabelCluster, statsLabelNamespace})
+	s.transactionTimings = stats.NewMultiTimings("TransactionTimings",
+		"gaea proxy transaction timings per result", []string{statsLabelCluster, statsLabelNamespace, statsLabelResult})
+	s.hedgeReadCounts = stats.NewCountersWithMultiLabels("HedgeReadCounts",
+		"gaea proxy hedged read counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelWinner})
+	s.userConnCounts = stats.NewGaugesWithMultiLabels("UserConnCounts",
+		"gaea proxy client connection counts per user", []string{statsLabelCluster, statsLabelUser})
 
 	s.backendSQLTimings = stats.NewMultiTimings("BackendSqlTimings",
 		"gaea proxy backend parser sqlTimings", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation})
+	s.backendSQLTypeTimings = stats.NewMultiTimings("BackendSqlTypeTimings",
+		"gaea proxy backend sql timings per slice and statement type", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelStmtType})
 	s.backendSQLFingerprintSlowCounts = stats.NewCountersWithMultiLabels("BackendSqlFingerprintSlowCounts",
 		"gaea proxy backend parser fingerprint slow counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint})
 	s.backendSQLErrorCounts = stats.NewCountersWithMultiLabels("BackendSqlErrorCounts",
 		"gaea proxy backend parser error counts per error type", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation})
 	s.backendSQLFingerprintErrorCounts = stats.NewCountersWithMultiLabels("BackendSqlFingerprintErrorCounts",
 		"gaea proxy backend parser fingerprint error counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint})
+	s.backendTimeoutCounts = stats.NewCountersWithMultiLabels("BackendTimeoutCounts",
+		"gaea proxy backend timeout counts per phase", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelPhase})
 	s.backendConnectPoolIdleCounts = stats.NewGaugesWithMultiLabels("backendConnectPoolIdleCounts",
 		"gaea proxy backend idle connect counts", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelIPAddr})
 	s.backendConnectPoolInUseCounts = stats.NewGaugesWithMultiLabels("backendConnectPoolInUseCounts",
@@ -792,6 +1005,11 @@ func (s *StatisticManager) recordSessionSQLTiming(namespace string, operation st
 	s.sqlTimings.Record(operationStatsKey, startTime)
 }
 
+func (s *StatisticManager) recordSessionSQLTypeTiming(namespace string, stmtType string, startTime time.Time) {
+	statsKey := []string{s.clusterName, namespace, stmtType}
+	s.sqlTypeTimings.Record(statsKey, startTime)
+}
+
 // millisecond duration
 func (s *StatisticManager) isBackendSlowSQL(startTime time.Time) bool {
 	duration := time.Since(startTime).Nanoseconds() / int64(time.Millisecond)
@@ -815,6 +1033,11 @@ func (s *StatisticManager) recordBackendSQLTiming(namespace string, operation st
 	s.backendSQLTimings.Record(operationStatsKey, startTime)
 }
 
+func (s *StatisticManager) recordBackendSQLTypeTiming(namespace string, slice string, stmtType string, startTime time.Time) {
+	statsKey := []string{s.clusterName, namespace, slice, stmtType}
+	s.backendSQLTypeTimings.Record(statsKey, startTime)
+}
+
 // RecordSQLForbidden record forbidden parser
 func (s *StatisticManager) RecordSQLForbidden(fingerprint, namespace string) {
 	hash := mysql.GetMd5(fingerprint)
@@ -833,6 +1056,52 @@ func (s *StatisticManager) DescSessionCount(namespace string) {
 	s.sessionCounts.Add(statsKey, -1)
 }
 
+// RecordUserConn record client connection count of user
+func (s *StatisticManager) RecordUserConn(user string, delta int64) {
+	s.userConnCounts.Add([]string{s.clusterName, user}, delta)
+}
+
+// RecordConnWorkers record active and queued connection workers
+func (s *StatisticManager) RecordConnWorkers(active, queued int64) {
+	s.connWorkerCounts.Set([]string{s.clusterName, "active"}, active)
+	s.connWorkerCounts.Set([]string{s.clusterName, "queued"}, queued)
+}
+
+// RecordConnReject record rejected connection
+func (s *StatisticManager) RecordConnReject(reason string) {
+	s.connRejectCounts.Add([]string{s.clusterName, reason}, 1)
+}
+
+// RecordHedgeRead record hedged read and which request answered first
+func (s *StatisticManager) RecordHedgeRead(namespace, slice, winner string) {
+	s.hedgeReadCounts.Add([]string{s.clusterName, namespace, slice, winner}, 1)
+}
+
+// RecordBackendTimeout record timeout of backend call, phase is connect, first_byte or total
+func (s *StatisticManager) RecordBackendTimeout(namespace, slice, phase string) {
+	s.backendTimeoutCounts.Add([]string{s.clusterName, namespace, slice, phase}, 1)
+}
+
+// RecordCommitProgress record multi-slice commits in progress of namespace
+func (s *StatisticManager) RecordCommitProgress(namespace, state string, count int64) {
+	s.commitProgressCounts.Set([]string{s.clusterName, namespace, state}, count)
+}
+
+// RecordPartialCommit record multi-slice commit committed on part of slices
+func (s *StatisticManager) RecordPartialCommit(namespace string) {
+	s.partialCommitCounts.Add([]string{s.clusterName, namespace}, 1)
+}
+
+// RecordTransaction record duration of finished transaction
+func (s *StatisticManager) RecordTransaction(namespace, result string, elapsed time.Duration) {
+	s.transactionTimings.Add([]string{s.clusterName, namespace, result}, elapsed)
+}
+
+// RecordRoutingAudit record result of comparing routing of shard rules and candidate shard rules
+func (s *StatisticManager) RecordRoutingAudit(namespace, result string) {
+	s.routingAuditCounts.Add([]string{s.clusterName, namespace, result}, 1)
+}
+
 // AddReadFlowCount add read flow count
 func (s *StatisticManager) AddReadFlowCount(namespace string, byteCount int) {
 	statsKey := []string{s.clusterName, namespace, "read"}
@@ -15,11 +15,26 @@ package server
 
 import (
 	"testing"
+	"time"
 
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/stats"
+	"github.com/XiaoMi/Gaea/util"
 )
 
+// newTestManager return manager whose current namespaces are ns, used by tests which build Namespace directly
+func newTestManager(ns ...*Namespace) *Manager {
+	m := NewManager()
+	current, _, _ := m.switchIndex.Get()
+	m.namespaces[current] = NewNamespaceManager()
+	for _, n := range ns {
+		m.namespaces[current].namespaces[n.name] = n
+	}
+	return m
+}
+
 type userinfo struct {
 	username string
 	password string
@@ -321,6 +336,57 @@ func prepareNamespaceUsers() map[string]*models.Namespace {
 	return nsMap
 }
 
+func TestGetStmtTypeCategory(t *testing.T) {
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{"select * from t", stmtTypeCategorySelect},
+		{"insert into t values (1)", stmtTypeCategoryInsert},
+		{"replace into t values (1)", stmtTypeCategoryInsert},
+		{"update t set a = 1", stmtTypeCategoryUpdate},
+		{"delete from t", stmtTypeCategoryDelete},
+		{"create table t (a int)", stmtTypeCategoryDDL},
+		{"begin", stmtTypeCategoryOther},
+		{"show tables", stmtTypeCategoryOther},
+	}
+	for _, test := range tests {
+		t.Run(test.sql, func(t *testing.T) {
+			reqCtx := util.NewRequestContext()
+			if actual := getStmtTypeCategory(reqCtx, test.sql); actual != test.expected {
+				t.Errorf("without stmt type, expect: %s, actual: %s", test.expected, actual)
+			}
+			reqCtx.Set(util.StmtType, parser.PreviewSql(test.sql))
+			if actual := getStmtTypeCategory(reqCtx, test.sql); actual != test.expected {
+				t.Errorf("with stmt type, expect: %s, actual: %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestStatisticManager_RecordSQLTypeTiming(t *testing.T) {
+	s := &StatisticManager{
+		clusterName:           "gaea_cluster",
+		sqlTypeTimings:        stats.NewMultiTimings("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelStmtType}),
+		backendSQLTypeTimings: stats.NewMultiTimings("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelStmtType}),
+	}
+
+	startTime := time.Now()
+	s.recordSessionSQLTypeTiming("ns", stmtTypeCategorySelect, startTime)
+	s.recordSessionSQLTypeTiming("ns", stmtTypeCategorySelect, startTime)
+	s.recordBackendSQLTypeTiming("ns", "slice-0", stmtTypeCategoryInsert, startTime)
+	s.recordBackendSQLTypeTiming("ns", "slice-1", stmtTypeCategoryInsert, startTime)
+
+	sessionCounts := s.sqlTypeTimings.Counts()
+	if sessionCounts["gaea_cluster.ns.select"] != 2 {
+		t.Errorf("session select count, expect: 2, actual: %v", sessionCounts)
+	}
+	backendCounts := s.backendSQLTypeTimings.Counts()
+	if backendCounts["gaea_cluster.ns.slice-0.insert"] != 1 || backendCounts["gaea_cluster.ns.slice-1.insert"] != 1 {
+		t.Errorf("backend insert count, expect 1 per slice, actual: %v", backendCounts)
+	}
+}
+
 func createNamespaceUsers(ns string, users []*userinfo) *models.Namespace {
 	var userList []*models.User
 	for _, user := range users {
@@ -0,0 +1,255 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/util/sync2"
+	"github.com/pingcap/parser/ast"
+)
+
+// 物化表每批写入的行数
+const materializedViewInsertBatch = 500
+
+// materializedView runtime state of a materialized view, reset after namespace reloaded
+type materializedView struct {
+	cfg         *models.MaterializedView
+	interval    time.Duration // 小于等于0表示只能手动刷新
+	refreshing  sync2.AtomicBool
+	lastRefresh sync2.AtomicInt64 // unix nano of last refresh
+}
+
+func parseMaterializedViews(cfgViews []*models.MaterializedView) map[string]*materializedView {
+	views := make(map[string]*materializedView, len(cfgViews))
+	for _, v := range cfgViews {
+		interval := v.RefreshInterval
+		if interval == 0 {
+			interval = models.DefaultMaterializedViewRefreshInterval
+		}
+		views[v.DB+"."+v.Name] = &materializedView{
+			cfg:      v,
+			interval: time.Duration(interval) * time.Second,
+		}
+	}
+	return views
+}
+
+func (v *materializedView) isDue(now time.Time) bool {
+	if v.interval <= 0 {
+		return false
+	}
+	return now.Sub(time.Unix(0, v.lastRefresh.Get())) >= v.interval
+}
+
+// getMaterializedView return materialized view of db.name, nil if not exists
+func (n *Namespace) getMaterializedView(db, name string) *materializedView {
+	if len(n.materializedViews) == 0 {
+		return nil
+	}
+	return n.materializedViews[db+"."+name]
+}
+
+// materializedViewRewriter replace view names in statement with materialized tables
+type materializedViewRewriter struct {
+	ns *Namespace
+	db string
+}
+
+// Enter implement ast.Visitor
+func (r *materializedViewRewriter) Enter(n ast.Node) (ast.Node, bool) {
+	t, ok := n.(*ast.TableName)
+	if !ok {
+		return n, false
+	}
+	db := t.Schema.O
+	if db == "" {
+		db = r.db
+	}
+	if v := r.ns.getMaterializedView(db, t.Name.O); v != nil {
+		table := v.cfg.GetTable()
+		t.Name.O = table
+		t.Name.L = strings.ToLower(table)
+	}
+	return n, true
+}
+
+// Leave implement ast.Visitor
+func (r *materializedViewRewriter) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// rewriteMaterializedViews 查询物化视图时改为读取物化表, 物化表不在分片规则中, 由default slice直接返回, 避免跨分片扫描
+func rewriteMaterializedViews(ns *Namespace, db string, stmt ast.StmtNode) {
+	if len(ns.materializedViews) == 0 {
+		return
+	}
+	if _, ok := stmt.(*ast.SelectStmt); !ok {
+		return
+	}
+	parser.Visit(stmt, &materializedViewRewriter{ns: ns, db: db})
+}
+
+func (m *Manager) startMaterializedViewTask() {
+	go func() {
+		t := time.NewTicker(time.Second)
+		for {
+			select {
+			case <-m.GetStatisticManager().closeChan:
+				return
+			case now := <-t.C:
+				current, _, _ := m.switchIndex.Get()
+				for name, ns := range m.namespaces[current].namespaces {
+					for _, v := range ns.materializedViews {
+						if v.isDue(now) {
+							go m.refreshMaterializedView(name, v)
+						}
+					}
+				}
+			}
+		}
+	}()
+}
+
+// RefreshMaterializedView refresh materialized view immediately
+func (m *Manager) RefreshMaterializedView(namespace, db, name string) error {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", namespace)
+	}
+	v := ns.getMaterializedView(db, name)
+	if v == nil {
+		return fmt.Errorf("materialized view not found: %s.%s", db, name)
+	}
+	return m.refreshMaterializedView(namespace, v)
+}
+
+func (m *Manager) refreshMaterializedView(namespace string, v *materializedView) error {
+	if !v.refreshing.CompareAndSwap(false, true) {
+		return fmt.Errorf("materialized view %s.%s is refreshing", v.cfg.DB, v.cfg.Name)
+	}
+	defer v.refreshing.Set(false)
+
+	startTime := time.Now()
+	err := m.doRefreshMaterializedView(namespace, v)
+	// 失败时同样按间隔重试, 避免后端异常时频繁执行跨分片查询
+	v.lastRefresh.Set(time.Now().UnixNano())
+	if err != nil {
+		log.Warnf("refresh materialized view failed, namespace: %s, view: %s.%s, err: %v",
+			namespace, v.cfg.DB, v.cfg.Name, err)
+		return err
+	}
+	log.Infof("refresh materialized view success, namespace: %s, view: %s.%s, cost: %v",
+		namespace, v.cfg.DB, v.cfg.Name, time.Since(startTime))
+	return nil
+}
+
+func (m *Manager) doRefreshMaterializedView(namespace string, v *materializedView) error {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", namespace)
+	}
+
+	r, err := m.ExecuteReadOnlySQL(namespace, v.cfg.DB, v.cfg.SQL)
+	if err != nil {
+		return fmt.Errorf("execute view sql error: %v", err)
+	}
+
+	table := v.cfg.GetTable()
+	phyDB, err := ns.GetDefaultPhyDB(v.cfg.DB)
+	if err != nil {
+		return err
+	}
+	sliceName := ns.GetRouter().GetRule(v.cfg.DB, table).GetSlice(0)
+	slice := ns.GetSlice(sliceName)
+	if slice == nil {
+		return fmt.Errorf("slice not found: %s", sliceName)
+	}
+	pc, err := slice.GetMasterConn()
+	if err != nil {
+		return err
+	}
+	defer pc.Recycle()
+
+	if err = pc.UseDB(phyDB); err != nil {
+		return err
+	}
+	if err = pc.Begin(); err != nil {
+		return err
+	}
+	for _, sql := range buildMaterializedViewSQLs(table, r.Resultset) {
+		if _, err = pc.Execute(sql); err != nil {
+			pc.Rollback()
+			return fmt.Errorf("write materialized table error: %v", err)
+		}
+	}
+	return pc.Commit()
+}
+
+// buildMaterializedViewSQLs 生成全量替换物化表的SQL: 先清空, 再分批写入
+func buildMaterializedViewSQLs(table string, rs *mysql.Resultset) []string {
+	sqls := []string{fmt.Sprintf("DELETE FROM `%s`", table)}
+	if len(rs.Values) == 0 {
+		return sqls
+	}
+
+	columns := make([]string, 0, len(rs.Fields))
+	for _, f := range rs.Fields {
+		columns = append(columns, "`"+string(f.Name)+"`")
+	}
+	prefix := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES ", table, strings.Join(columns, ","))
+
+	for start := 0; start < len(rs.Values); start += materializedViewInsertBatch {
+		end := start + materializedViewInsertBatch
+		if end > len(rs.Values) {
+			end = len(rs.Values)
+		}
+		rows := make([]string, 0, end-start)
+		for _, row := range rs.Values[start:end] {
+			values := make([]string, 0, len(row))
+			for _, value := range row {
+				values = append(values, formatMaterializedValue(value))
+			}
+			rows = append(rows, "("+strings.Join(values, ",")+")")
+		}
+		sqls = append(sqls, prefix+strings.Join(rows, ","))
+	}
+	return sqls
+}
+
+func formatMaterializedValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		return "'" + mysql.Escape(string(v)) + "'"
+	case string:
+		return "'" + mysql.Escape(v) + "'"
+	default:
+		return "'" + mysql.Escape(fmt.Sprintf("%v", v)) + "'"
+	}
+}
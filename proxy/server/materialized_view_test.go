@@ -0,0 +1,90 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/format"
+)
+
+func TestRewriteMaterializedViews(t *testing.T) {
+	ns := &Namespace{
+		materializedViews: parseMaterializedViews([]*models.MaterializedView{
+			{DB: "db_ks", Name: "v_top_user", SQL: "select id from tbl_ks order by score desc limit 10", Table: "mv_top_user"},
+			{DB: "db_ks", Name: "v_count", SQL: "select count(*) as c from tbl_ks"},
+		}),
+	}
+	tests := []struct {
+		db     string
+		sql    string
+		expect string
+	}{
+		{"db_ks", "select * from v_top_user", "SELECT * FROM `mv_top_user`"},
+		{"db_ks", "select c from db_ks.v_count", "SELECT `c` FROM `db_ks`.`v_count`"},
+		{"other", "select * from v_top_user", "SELECT * FROM `v_top_user`"},
+		{"other", "select a.id from db_ks.v_top_user a join tbl_ks b on a.id = b.id", "SELECT `a`.`id` FROM `db_ks`.`mv_top_user` AS `a` JOIN `tbl_ks` AS `b` ON `a`.`id`=`b`.`id`"},
+	}
+	p := parser.New()
+	for _, test := range tests {
+		stmt, err := p.ParseOneStmt(test.sql, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rewriteMaterializedViews(ns, test.db, stmt)
+		s := &strings.Builder{}
+		if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, s)); err != nil {
+			t.Fatal(err)
+		}
+		if s.String() != test.expect {
+			t.Errorf("rewrite not match, sql: %s, expect: %s, actual: %s", test.sql, test.expect, s.String())
+		}
+	}
+}
+
+func TestBuildMaterializedViewSQLs(t *testing.T) {
+	rs := &mysql.Resultset{
+		Fields: []*mysql.Field{{Name: []byte("id")}, {Name: []byte("name")}, {Name: []byte("score")}},
+		Values: [][]interface{}{
+			{int64(1), []byte("it's"), 1.5},
+			{uint64(2), nil, float64(3)},
+		},
+	}
+	sqls := buildMaterializedViewSQLs("mv", rs)
+	expect := []string{
+		"DELETE FROM `mv`",
+		"INSERT INTO `mv` (`id`,`name`,`score`) VALUES (1,'it\\'s',1.5),(2,NULL,3)",
+	}
+	if len(sqls) != len(expect) {
+		t.Fatalf("sql count not match, expect: %v, actual: %v", expect, sqls)
+	}
+	for i := range expect {
+		if sqls[i] != expect[i] {
+			t.Errorf("sql not match, expect: %s, actual: %s", expect[i], sqls[i])
+		}
+	}
+
+	rs.Values = make([][]interface{}, materializedViewInsertBatch+1)
+	for i := range rs.Values {
+		rs.Values[i] = []interface{}{int64(i), "a", 0.0}
+	}
+	if sqls := buildMaterializedViewSQLs("mv", rs); len(sqls) != 3 {
+		t.Errorf("batch count not match, expect: 3, actual: %d", len(sqls))
+	}
+}
@@ -18,18 +18,22 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/XiaoMi/Gaea/backend"
 	"github.com/XiaoMi/Gaea/models"
 	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
 	"github.com/XiaoMi/Gaea/proxy/plan"
 	"github.com/XiaoMi/Gaea/proxy/router"
 	"github.com/XiaoMi/Gaea/proxy/sequence"
 	"github.com/XiaoMi/Gaea/util"
 	"github.com/XiaoMi/Gaea/util/cache"
+	"github.com/XiaoMi/Gaea/util/sync2"
 )
 
 const (
@@ -48,8 +52,12 @@ type UserProperty struct {
 	RWFlag        int
 	RWSplit       int
 	OtherProperty int
+	AdminRole     string
 }
 
+// proxy内部会话(物化视图刷新、结果导出等)没有用户, 按只读、不走读写分离的普通用户处理
+var internalUserProperty = &UserProperty{RWFlag: models.ReadOnly, RWSplit: models.NoReadWriteSplit}
+
 // Namespace is struct driected used by server
 type Namespace struct {
 	name               string
@@ -66,6 +74,50 @@ type Namespace struct {
 	defaultCollationID mysql.CollationID
 	openGeneralLog     bool
 
+	readOnly             sync2.AtomicBool    // 可通过管理接口在运行时修改
+	maintenanceWindows   []maintenanceWindow // 维护窗口期间只读
+	readOnlyExceptTables map[string]bool     // key: db.table, 只读期间仍可写入的表
+
+	sampleSessionRate  int64 // 每N个会话采样1个, 0表示关闭
+	sampleSQLRate      int64 // 每N条语句采样1条, 0表示关闭
+	sampleSessionCount sync2.AtomicInt64
+	sampleSQLCount     sync2.AtomicInt64
+
+	resourceSampleRate  int64 // 每N条语句统计1条的proxy资源消耗, 0表示关闭
+	resourceSampleCount sync2.AtomicInt64
+	resourceStats       *resourceStats
+
+	logRawSQL bool // 日志中输出原始SQL, 默认脱敏
+
+	errorDetail bool // 错误信息附加结构化信息
+
+	materializedViews map[string]*materializedView // key: db.view
+	views             map[string]*models.View      // 逻辑视图, key: db.view
+	resultTransforms  []*resultTransform
+	versionColumns    map[string]string      // 乐观锁版本列, key: db.table
+	mergeSpill        *plan.MergeSpillConfig // 跨分片合并结果的内存限制, nil表示不限制
+	hedgeRead         *hedgeReadTracker      // 从库读跨分片查询的对冲, nil表示关闭
+	routingAudit      *routingAudit          // 新旧分片规则的路由结果对比, nil表示关闭
+	shardRules        []*models.Shard        // 展开继承后的分片规则, 用于SHOW SHARDING RULES
+
+	writeBufferSize int // 前端连接合并写的缓冲区大小, 0使用proxy配置
+	flushDelay      int // 前端连接延迟写出的时间, 单位毫秒, 0使用proxy配置
+
+	unparseablePassThrough bool // 无法解析的语句原样发往默认slice或hint指定的slice
+
+	strictMode bool // 拒绝没有WHERE的UPDATE/DELETE, TRUNCATE分片表和DROP语句
+
+	maxSQLLength  int // 语句的最大长度, 0表示不限制
+	maxInListSize int // IN列表的最大值个数, 0表示不限制
+
+	parseLimits parser.ParseLimits // 解析时间和语法树大小的限制
+
+	idempotencyTables sync.Map // 已创建幂等键表的slice.db
+
+	adminSQLRBAC bool // 任一用户配置了admin_role时, 管理语句需要相应的角色
+
+	configMD5 string // 配置内容的md5, 审计记录中作为配置变更前后的状态
+
 	slowSQLCache         *cache.LRUCache
 	errorSQLCache        *cache.LRUCache
 	backendSlowSQLCache  *cache.LRUCache
@@ -73,6 +125,11 @@ type Namespace struct {
 	planCache            *cache.LRUCache
 }
 
+type maintenanceWindow struct {
+	start time.Time
+	end   time.Time
+}
+
 // DumpToJSON  means easy encode json
 func (n *Namespace) DumpToJSON() []byte {
 	return models.JSONEncode(n)
@@ -82,15 +139,28 @@ func (n *Namespace) DumpToJSON() []byte {
 func NewNamespace(namespaceConfig *models.Namespace) (*Namespace, error) {
 	var err error
 	namespace := &Namespace{
-		name:                 namespaceConfig.Name,
-		sqls:                 make(map[string]string, 16),
-		userProperties:       make(map[string]*UserProperty, 2),
-		openGeneralLog:       namespaceConfig.OpenGeneralLog,
-		slowSQLCache:         cache.NewLRUCache(defaultSQLCacheCapacity),
-		errorSQLCache:        cache.NewLRUCache(defaultSQLCacheCapacity),
-		backendSlowSQLCache:  cache.NewLRUCache(defaultSQLCacheCapacity),
-		backendErrorSQLCache: cache.NewLRUCache(defaultSQLCacheCapacity),
-		planCache:            cache.NewLRUCache(defaultPlanCacheCapacity),
+		name:                   namespaceConfig.Name,
+		configMD5:              configDigest(namespaceConfig),
+		sqls:                   make(map[string]string, 16),
+		userProperties:         make(map[string]*UserProperty, 2),
+		openGeneralLog:         namespaceConfig.OpenGeneralLog,
+		sampleSessionRate:      int64(namespaceConfig.SampleSessionRate),
+		sampleSQLRate:          int64(namespaceConfig.SampleSQLRate),
+		resourceSampleRate:     int64(namespaceConfig.ResourceStatsSampleRate),
+		resourceStats:          newResourceStats(defaultResourceStatsCapacity),
+		logRawSQL:              namespaceConfig.LogRawSQL,
+		errorDetail:            namespaceConfig.ErrorDetail,
+		unparseablePassThrough: namespaceConfig.UnparseablePolicy == models.UnparseablePassThrough,
+		strictMode:             namespaceConfig.StrictMode,
+		maxSQLLength:           namespaceConfig.MaxSQLLength,
+		maxInListSize:          namespaceConfig.MaxInListSize,
+		parseLimits:            newParseLimits(namespaceConfig),
+		readOnly:               sync2.NewAtomicBool(namespaceConfig.ReadOnly),
+		slowSQLCache:           cache.NewLRUCache(defaultSQLCacheCapacity),
+		errorSQLCache:          cache.NewLRUCache(defaultSQLCacheCapacity),
+		backendSlowSQLCache:    cache.NewLRUCache(defaultSQLCacheCapacity),
+		backendErrorSQLCache:   cache.NewLRUCache(defaultSQLCacheCapacity),
+		planCache:              cache.NewLRUCache(defaultPlanCacheCapacity),
 	}
 
 	defer func() {
@@ -136,14 +206,45 @@ func NewNamespace(namespaceConfig *models.Namespace) (*Namespace, error) {
 		return nil, fmt.Errorf("parse charset error: %v", err)
 	}
 
+	// init read only and maintenance windows
+	namespace.maintenanceWindows, err = parseMaintenanceWindows(namespaceConfig.MaintenanceWindows)
+	if err != nil {
+		return nil, fmt.Errorf("parse maintenance windows error: %v", err)
+	}
+	namespace.readOnlyExceptTables = parseReadOnlyExceptTables(namespaceConfig.ReadOnlyExceptTables)
+	namespace.materializedViews = parseMaterializedViews(namespaceConfig.MaterializedViews)
+	namespace.views, err = parseViews(namespaceConfig.Views)
+	if err != nil {
+		return nil, fmt.Errorf("parse views error: %v", err)
+	}
+	namespace.resultTransforms, err = parseResultTransforms(namespaceConfig.ResultTransforms)
+	if err != nil {
+		return nil, fmt.Errorf("parse result transforms error: %v", err)
+	}
+	namespace.versionColumns = parseVersionColumns(namespaceConfig.VersionColumns)
+	namespace.mergeSpill, err = parseMergeSpill(namespaceConfig.MergeMemoryLimit, namespaceConfig.MergeSpillDir)
+	if err != nil {
+		return nil, fmt.Errorf("parse merge spill error: %v", err)
+	}
+	if namespaceConfig.HedgeReadPercentile > 0 {
+		namespace.hedgeRead = newHedgeReadTracker(namespaceConfig.HedgeReadPercentile,
+			time.Duration(namespaceConfig.HedgeReadMinDelay)*time.Millisecond)
+	}
+
+	namespace.writeBufferSize = namespaceConfig.WriteBufferSize
+	namespace.flushDelay = namespaceConfig.FlushDelay
+
 	// init user properties
 	for _, user := range namespaceConfig.Users {
-		up := &UserProperty{RWFlag: user.RWFlag, RWSplit: user.RWSplit, OtherProperty: user.OtherProperty}
+		up := &UserProperty{RWFlag: user.RWFlag, RWSplit: user.RWSplit, OtherProperty: user.OtherProperty, AdminRole: user.AdminRole}
 		namespace.userProperties[user.UserName] = up
+		if user.AdminRole != "" {
+			namespace.adminSQLRBAC = true
+		}
 	}
 
 	// init backend slices
-	namespace.slices, err = parseSlices(namespaceConfig.Slices, namespace.defaultCharset, namespace.defaultCollationID)
+	namespace.slices, err = parseSlices(namespaceConfig.Slices, namespace.defaultCharset, namespace.defaultCollationID, namespaceConfig.InitSQLs)
 	if err != nil {
 		return nil, fmt.Errorf("init slices of namespace: %s failed, err: %v", namespaceConfig.Name, err)
 	}
@@ -153,6 +254,13 @@ func NewNamespace(namespaceConfig *models.Namespace) (*Namespace, error) {
 	if err != nil {
 		return nil, fmt.Errorf("init router of namespace: %s failed, err: %v", namespace.name, err)
 	}
+	namespace.shardRules = getShowShardingRules(namespaceConfig)
+	if len(namespaceConfig.CandidateShardRules) != 0 {
+		namespace.routingAudit, err = newRoutingAudit(namespaceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("init candidate router of namespace: %s failed, err: %v", namespace.name, err)
+		}
+	}
 
 	// init global sequences source
 	// 目前只支持基于mysql的序列号
@@ -163,14 +271,34 @@ func NewNamespace(namespaceConfig *models.Namespace) (*Namespace, error) {
 			return nil, fmt.Errorf("init global sequence error: slice not found, sequence: %v", v)
 		}
 		seqName := strings.ToUpper(v.DB) + "." + strings.ToUpper(v.Table)
-		seq := sequence.NewMySQLSequence(globalSequenceSlice, seqName, v.PKName)
+		seq := sequence.NewMySQLSequence(globalSequenceSlice, namespace.name, seqName, v.PKName)
 		sequences.SetSequence(v.DB, v.Table, seq)
 	}
 	namespace.sequences = sequences
 
+	// 加载时在后台检查物理表, 只输出日志
+	if namespaceConfig.CheckShardTablesOnLoad {
+		go namespace.logShardTableCheck()
+	}
+
 	return namespace, nil
 }
 
+// sampleSession return true for one in every sampleSessionRate sessions
+func (n *Namespace) sampleSession() bool {
+	return n.sampleSessionRate > 0 && n.sampleSessionCount.Add(1)%n.sampleSessionRate == 0
+}
+
+// sampleSQL return true for one in every sampleSQLRate statements
+func (n *Namespace) sampleSQL() bool {
+	return n.sampleSQLRate > 0 && n.sampleSQLCount.Add(1)%n.sampleSQLRate == 0
+}
+
+// sampleResourceStats return true for one in every resourceSampleRate statements
+func (n *Namespace) sampleResourceStats() bool {
+	return n.resourceSampleRate > 0 && n.resourceSampleCount.Add(1)%n.resourceSampleRate == 0
+}
+
 // GetName return namespace of namespace
 func (n *Namespace) GetName() string {
 	return n.name
@@ -209,22 +337,72 @@ func (n *Namespace) getSessionSlowSQLTime() int64 {
 
 // IsAllowWrite check if user allow to write
 func (n *Namespace) IsAllowWrite(user string) bool {
-	return n.userProperties[user].RWFlag == models.ReadWrite
+	return n.getUserProperty(user).RWFlag == models.ReadWrite
+}
+
+// IsAdminRoleAllowed check if user has the required role to execute admin statements,
+// always allowed if no user of namespace is configured with admin_role
+func (n *Namespace) IsAdminRoleAllowed(user, required string) bool {
+	if !n.adminSQLRBAC {
+		return true
+	}
+	return models.AdminRoleAllowed(n.getUserProperty(user).AdminRole, required)
+}
+
+// HasAdminRole check if user is configured with the required admin_role, regardless of whether rbac of admin statements is enabled
+func (n *Namespace) HasAdminRole(user, required string) bool {
+	return models.AdminRoleAllowed(n.getUserProperty(user).AdminRole, required)
+}
+
+// IsReadOnly check if namespace is read only, by flag or in maintenance window
+func (n *Namespace) IsReadOnly() bool {
+	if n.readOnly.Get() {
+		return true
+	}
+	now := time.Now()
+	for _, w := range n.maintenanceWindows {
+		if !now.Before(w.start) && now.Before(w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetReadOnly set read only flag of namespace
+func (n *Namespace) SetReadOnly(readOnly bool) {
+	n.readOnly.Set(readOnly)
+}
+
+// IsTableWritableInReadOnly check if table could be written while namespace is read only
+func (n *Namespace) IsTableWritableInReadOnly(db, table string) bool {
+	return n.readOnlyExceptTables[strings.ToLower(db+"."+table)]
+}
+
+// HasReadOnlyExceptTables check if any table could be written while namespace is read only
+func (n *Namespace) HasReadOnlyExceptTables() bool {
+	return len(n.readOnlyExceptTables) != 0
 }
 
 // IsRWSplit chekc if read write split
 func (n *Namespace) IsRWSplit(user string) bool {
-	return n.userProperties[user].RWSplit == models.ReadWriteSplit
+	return n.getUserProperty(user).RWSplit == models.ReadWriteSplit
 }
 
 // IsStatisticUser check if user is used to statistic
 func (n *Namespace) IsStatisticUser(user string) bool {
-	return n.userProperties[user].OtherProperty == models.StatisticUser
+	return n.getUserProperty(user).OtherProperty == models.StatisticUser
 }
 
 // GetUserProperty return user information
 func (n *Namespace) GetUserProperty(user string) int {
-	return n.userProperties[user].OtherProperty
+	return n.getUserProperty(user).OtherProperty
+}
+
+func (n *Namespace) getUserProperty(user string) *UserProperty {
+	if p, ok := n.userProperties[user]; ok {
+		return p
+	}
+	return internalUserProperty
 }
 
 // IsSQLAllowed check black parser
@@ -434,11 +612,24 @@ func (n *Namespace) Close(delay bool) {
 	n.backendErrorSQLCache.Clear()
 }
 
-func parseSlice(cfg *models.Slice, charset string, collationID mysql.CollationID) (*backend.Slice, error) {
+func parseSlice(cfg *models.Slice, charset string, collationID mysql.CollationID, initSQLs []string) (*backend.Slice, error) {
 	var err error
 	s := new(backend.Slice)
 	s.Cfg = *cfg
 	s.SetCharsetInfo(charset, collationID)
+	s.SetInitSQLs(initSQLs)
+
+	// parse tls config
+	err = s.ParseTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// parse dialer
+	err = s.ParseDialer()
+	if err != nil {
+		return nil, err
+	}
 
 	// parse master
 	err = s.ParseMaster(cfg.Master)
@@ -458,10 +649,19 @@ func parseSlice(cfg *models.Slice, charset string, collationID mysql.CollationID
 		return nil, err
 	}
 
+	// start topology discovery of group replication
+	err = s.StartTopologyDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	// start re-resolution of backend hostnames
+	s.StartDNSRefresh()
+
 	return s, nil
 }
 
-func parseSlices(cfgSlices []*models.Slice, charset string, collationID mysql.CollationID) (map[string]*backend.Slice, error) {
+func parseSlices(cfgSlices []*models.Slice, charset string, collationID mysql.CollationID, initSQLs []string) (map[string]*backend.Slice, error) {
 	slices := make(map[string]*backend.Slice, len(cfgSlices))
 	for _, v := range cfgSlices {
 		v.Name = strings.TrimSpace(v.Name) // modify origin slice name, trim space
@@ -469,7 +669,7 @@ func parseSlices(cfgSlices []*models.Slice, charset string, collationID mysql.Co
 			return nil, fmt.Errorf("duplicate slice [%s]", v.Name)
 		}
 
-		s, err := parseSlice(v, charset, collationID)
+		s, err := parseSlice(v, charset, collationID, initSQLs)
 		if err != nil {
 			return nil, err
 		}
@@ -496,6 +696,46 @@ func parseAllowIps(allowedIP []string) ([]util.IPInfo, error) {
 	return allowips, nil
 }
 
+func parseMaintenanceWindows(cfgWindows []*models.MaintenanceWindow) ([]maintenanceWindow, error) {
+	var windows []maintenanceWindow
+	for _, v := range cfgWindows {
+		start, end, err := v.Parse()
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, maintenanceWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+func parseReadOnlyExceptTables(tables []string) map[string]bool {
+	ret := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if len(t) == 0 {
+			continue
+		}
+		ret[t] = true
+	}
+	return ret
+}
+
+func parseMergeSpill(memoryLimit int64, dir string) (*plan.MergeSpillConfig, error) {
+	if memoryLimit <= 0 {
+		return nil, nil
+	}
+	if dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", dir)
+		}
+	}
+	return &plan.MergeSpillConfig{MemoryLimit: memoryLimit, Dir: dir}, nil
+}
+
 func parseBlackSqls(sqls []string) map[string]string {
 	sqlMap := make(map[string]string, 10)
 	for _, sql := range sqls {
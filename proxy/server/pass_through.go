@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+// 无法解析的语句可以通过开头的注释指定slice, 如: /*slice=slice-1*/ ...
+const sliceHintKey = "slice"
+
+// getSliceHint return slice name in leading comment of sql, or empty string if not specified
+func getSliceHint(sql string) string {
+	_, comments := parser.SplitMarginComments(sql)
+	leading := strings.TrimSpace(comments.Leading)
+	if !strings.HasPrefix(leading, "/*") || !strings.HasSuffix(leading, "*/") {
+		return ""
+	}
+	kv := strings.SplitN(leading[2:len(leading)-2], "=", 2)
+	if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), sliceHintKey) {
+		return ""
+	}
+	return strings.TrimSpace(kv[1])
+}
+
+// createPassThroughPlan 无法解析的语句原样发往默认slice或hint指定的slice
+// 只读用户或namespace只读时, 只允许透传SELECT和SHOW语句
+func createPassThroughPlan(ns *Namespace, user, db, sql string, stmtType parser.StatementType) (plan.Plan, error) {
+	if stmtType != parser.StmtSelect && stmtType != parser.StmtShow && (!ns.IsAllowWrite(user) || ns.IsReadOnly()) {
+		return nil, fmt.Errorf("unparseable statement is not allowed to pass through for read only user or namespace")
+	}
+
+	slice := backend.DefaultSlice
+	if hint := getSliceHint(sql); hint != "" {
+		if ns.GetSlice(hint) == nil {
+			return nil, fmt.Errorf("slice in hint not found: %s", hint)
+		}
+		slice = hint
+	}
+
+	logging.DefaultLogger.Warnf("pass through unparseable statement, ns: %s, user: %s, slice: %s, sql: %s", ns.GetName(), user, slice, ns.redactSQL(sql))
+	return plan.CreatePassThroughPlan(db, sql, slice), nil
+}
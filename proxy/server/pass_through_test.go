@@ -0,0 +1,85 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+)
+
+func TestGetSliceHint(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect string
+	}{
+		{"/*slice=slice-1*/ select 1", "slice-1"},
+		{"  /* SLICE = slice-1 */ select 1", "slice-1"},
+		{"/*master*/ select 1", ""},
+		{"select 1 /*slice=slice-1*/", ""},
+		{"select 1", ""},
+	}
+	for _, test := range tests {
+		if actual := getSliceHint(test.sql); actual != test.expect {
+			t.Errorf("slice hint not match, sql: %s, expect: %s, actual: %s", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestCreatePassThroughPlan(t *testing.T) {
+	ns := &Namespace{
+		slices: map[string]*backend.Slice{
+			"slice-0": {},
+			"slice-1": {},
+		},
+		userProperties: map[string]*UserProperty{
+			"rw_user": {RWFlag: models.ReadWrite},
+			"r_user":  {RWFlag: models.ReadOnly},
+		},
+	}
+	tests := []struct {
+		user     string
+		sql      string
+		stmtType parser.StatementType
+		slice    string
+		hasErr   bool
+	}{
+		{"rw_user", "select 1 from t window w as ()", parser.StmtSelect, backend.DefaultSlice, false},
+		{"rw_user", "/*slice=slice-1*/ insert into t values (1) as new", parser.StmtInsert, "slice-1", false},
+		{"rw_user", "/*slice=slice-2*/ select 1", parser.StmtSelect, "", true},
+		{"r_user", "/*slice=slice-1*/ select 1", parser.StmtSelect, "slice-1", false},
+		{"r_user", "insert into t values (1) as new", parser.StmtInsert, "", true},
+	}
+	for _, test := range tests {
+		p, err := createPassThroughPlan(ns, test.user, "db", test.sql, test.stmtType)
+		if (err != nil) != test.hasErr {
+			t.Fatalf("create pass through plan error not match, sql: %s, expect error: %v, err: %v", test.sql, test.hasErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if slice := p.(*plan.PassThroughPlan).GetSlice(); slice != test.slice {
+			t.Errorf("pass through slice not match, sql: %s, expect: %s, actual: %s", test.sql, test.slice, slice)
+		}
+	}
+
+	ns.SetReadOnly(true)
+	if _, err := createPassThroughPlan(ns, "rw_user", "db", "insert into t values (1) as new", parser.StmtInsert); err == nil {
+		t.Errorf("expect error when namespace is read only")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// PIN TO SLICE <slice>: 会话之后的语句不经过路由, 原样发往指定slice的主库, UNPIN恢复路由
+const (
+	pinStmtAction   = "pin"
+	unpinStmtAction = "unpin"
+)
+
+// parsePinStmt return slice of PIN TO SLICE statement, or empty string for UNPIN
+func parsePinStmt(sql string) (string, error) {
+	trimmed, _ := parser.SplitMarginComments(sql)
+	words := strings.Fields(trimmed)
+	switch {
+	case len(words) == 1 && strings.EqualFold(words[0], unpinStmtAction):
+		return "", nil
+	case len(words) == 4 && strings.EqualFold(words[0], pinStmtAction) &&
+		strings.EqualFold(words[1], "to") && strings.EqualFold(words[2], "slice"):
+		if slice := strings.Trim(words[3], "`'\""); slice != "" {
+			return slice, nil
+		}
+	}
+	return "", fmt.Errorf("invalid pin statement: %s, expect PIN TO SLICE <slice> or UNPIN", sql)
+}
+
+// handlePinStmt pin or unpin the session to a slice
+func (se *SessionExecutor) handlePinStmt(sql string) (*mysql.Result, error) {
+	slice, err := parsePinStmt(sql)
+	if err != nil {
+		return nil, mysql.NewError(mysql.ErrParse, err.Error())
+	}
+	ns := se.GetNamespace()
+	if slice != "" && ns.GetSlice(slice) == nil {
+		return nil, fmt.Errorf("slice not found: %s", slice)
+	}
+	// 事务中切换会导致一个事务跨多个slice
+	if se.isInTransaction() {
+		return nil, fmt.Errorf("pin or unpin slice is not allowed in transaction")
+	}
+
+	if slice != "" {
+		exeLogger.Warnf("session pinned to slice, ns: %s, user: %s, slice: %s", ns.GetName(), se.user, slice)
+	} else if se.pinnedSlice != "" {
+		exeLogger.Warnf("session unpinned from slice, ns: %s, user: %s, slice: %s", ns.GetName(), se.user, se.pinnedSlice)
+	}
+	se.pinnedSlice = slice
+	return nil, nil
+}
+
+// isPinnableStmt 会话pin到slice后, 需要路由的语句发往该slice, SET, SHOW和事务控制语句仍由gaea处理
+func isPinnableStmt(stmtType parser.StatementType) bool {
+	switch stmtType {
+	case parser.StmtSelect, parser.StmtInsert, parser.StmtReplace, parser.StmtUpdate, parser.StmtDelete,
+		parser.StmtDDL, parser.StmtUnknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// executeInPinnedSlice 语句原样发往pin的slice的主库, 不做路由和改写
+// 只读用户或namespace只读时, 只允许SELECT
+func (se *SessionExecutor) executeInPinnedSlice(reqCtx *util.RequestContext, stmtType parser.StatementType, sql string) (*mysql.Result, error) {
+	ns := se.GetNamespace()
+	if ns.GetSlice(se.pinnedSlice) == nil {
+		return nil, fmt.Errorf("pinned slice not found: %s", se.pinnedSlice)
+	}
+	if stmtType != parser.StmtSelect && (!ns.IsAllowWrite(se.user) || ns.IsReadOnly()) {
+		return nil, fmt.Errorf("only select is allowed in pinned slice for read only user or namespace")
+	}
+	p := plan.CreatePassThroughPlan(se.db, sql, se.pinnedSlice)
+	r, err := p.ExecuteIn(reqCtx, se)
+	if err != nil {
+		exeLogger.Warnf("execute in pinned slice %s: %s", se.pinnedSlice, err.Error())
+		return nil, err
+	}
+	modifyResultStatus(r, se)
+	return r, nil
+}
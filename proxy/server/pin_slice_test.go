@@ -0,0 +1,62 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestParsePinStmt(t *testing.T) {
+	tests := []struct {
+		sql    string
+		slice  string
+		hasErr bool
+	}{
+		{"PIN TO SLICE slice-1", "slice-1", false},
+		{"/* repair */ pin to slice `slice-1`", "slice-1", false},
+		{"pin\tto slice 'slice-0' ", "slice-0", false},
+		{"UNPIN", "", false},
+		{"pin slice-1", "", true},
+		{"pin to slice ``", "", true},
+		{"unpin slice-1", "", true},
+	}
+	for _, test := range tests {
+		if action := getAdminStmtAction(parser.PreviewSql(test.sql), test.sql); action != pinStmtAction && action != unpinStmtAction {
+			t.Errorf("pin statement not recognized, sql: %s, action: %s", test.sql, action)
+		}
+		slice, err := parsePinStmt(test.sql)
+		if (err != nil) != test.hasErr {
+			t.Fatalf("parse pin statement error not match, sql: %s, expect error: %v, err: %v", test.sql, test.hasErr, err)
+		}
+		if slice != test.slice {
+			t.Errorf("pinned slice not match, sql: %s, expect: %s, actual: %s", test.sql, test.slice, slice)
+		}
+	}
+}
+
+func TestIsPinnableStmt(t *testing.T) {
+	for _, sql := range []string{"select 1", "update t set a = 1", "alter table t add column b int", "check table t"} {
+		if !isPinnableStmt(parser.PreviewSql(sql)) {
+			t.Errorf("statement should be sent to pinned slice: %s", sql)
+		}
+	}
+	for _, sql := range []string{"set names utf8", "begin", "commit", "rollback", "show tables", "use db"} {
+		if isPinnableStmt(parser.PreviewSql(sql)) {
+			t.Errorf("statement should be handled by gaea: %s", sql)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// PROXY protocol, 负载均衡(HAProxy, NLB等)在连接建立后先发送客户端的真实地址, 再转发MySQL协议数据
+// see: https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+const (
+	proxyProtocolV1Prefix    = "PROXY "
+	proxyProtocolV1MaxLength = 107
+
+	proxyProtocolV2HeaderLength = 16
+
+	proxyProtocolV2CmdLocal = 0x0
+	proxyProtocolV2CmdProxy = 0x1
+
+	proxyProtocolV2FamilyInet  = 0x1
+	proxyProtocolV2FamilyInet6 = 0x2
+	proxyProtocolV2FamilyUnix  = 0x3
+
+	defaultProxyProtocolHeaderTimeout = 5 * time.Second
+)
+
+var proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolConfig 只解析来自受信任地址(负载均衡)的连接的PROXY protocol头, 其他连接按普通连接处理
+type proxyProtocolConfig struct {
+	allowAll      bool
+	networks      []*net.IPNet
+	headerTimeout time.Duration
+}
+
+// parseProxyProtocolConfig parse proxy_protocol_networks, return nil if PROXY protocol is disabled
+func parseProxyProtocolConfig(cfg *models.Proxy) (*proxyProtocolConfig, error) {
+	if strings.TrimSpace(cfg.ProxyProtocolNetworks) == "" {
+		return nil, nil
+	}
+	if cfg.ProxyProtocolHeaderTimeout < 0 {
+		return nil, fmt.Errorf("invalid proxy_protocol_header_timeout: %d", cfg.ProxyProtocolHeaderTimeout)
+	}
+	p := &proxyProtocolConfig{headerTimeout: defaultProxyProtocolHeaderTimeout}
+	if cfg.ProxyProtocolHeaderTimeout > 0 {
+		p.headerTimeout = time.Duration(cfg.ProxyProtocolHeaderTimeout) * time.Second
+	}
+	for _, network := range strings.Split(cfg.ProxyProtocolNetworks, ",") {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if network == "*" {
+			p.allowAll = true
+			continue
+		}
+		// 单个IP按/32或/128处理
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy_protocol_networks: %s", network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.networks = append(p.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy_protocol_networks: %s", network)
+		}
+		p.networks = append(p.networks, ipNet)
+	}
+	return p, nil
+}
+
+// trusted 判断连接是否来自受信任的负载均衡, unix socket连接只有配置*时受信任
+func (p *proxyProtocolConfig) trusted(addr net.Addr) bool {
+	if p.allowAll {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// accept 读取受信任连接的PROXY protocol头, 返回以客户端真实地址作为RemoteAddr的连接.
+// 受信任的连接必须发送PROXY protocol头, 否则返回错误, 避免负载均衡配置错误时所有客户端都被识别为负载均衡的地址
+func (p *proxyProtocolConfig) accept(c net.Conn) (net.Conn, error) {
+	if !p.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	if err := c.SetReadDeadline(time.Now().Add(p.headerTimeout)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	src, dst, err := readProxyProtocolHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: c, r: r, remoteAddr: src, localAddr: dst}, nil
+}
+
+// proxyProtocolConn 已读取PROXY protocol头的连接, RemoteAddr返回客户端真实地址
+type proxyProtocolConn struct {
+	net.Conn
+	r          *bufio.Reader // 包含读取头部时多读的数据
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+// Read implement net.Conn
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr return real client address, or address of load balancer for LOCAL command
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr return address which client connected to
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// ProxyAddr return address of load balancer
+func (c *proxyProtocolConn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// SyscallConn implement syscall.Conn, used to detect client disconnection
+func (c *proxyProtocolConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok {
+		return nil, fmt.Errorf("%T is not syscall.Conn", c.Conn)
+	}
+	return sc.SyscallConn()
+}
+
+// readProxyProtocolHeader read PROXY protocol v1 or v2 header,
+// 返回的地址为nil时表示头部没有携带地址(v1 UNKNOWN, v2 LOCAL或不支持的协议族), 使用连接本身的地址
+func readProxyProtocolHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	prefix, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read proxy protocol header error: %v", err)
+	}
+	if string(prefix) == proxyProtocolV1Prefix {
+		return readProxyProtocolV1(r)
+	}
+	signature, err := r.Peek(len(proxyProtocolV2Signature))
+	if err != nil || !bytes.Equal(signature, proxyProtocolV2Signature) {
+		return nil, nil, fmt.Errorf("invalid proxy protocol header")
+	}
+	return readProxyProtocolV2(r)
+}
+
+// readProxyProtocolV1 文本格式: PROXY TCP4 srcIP dstIP srcPort dstPort\r\n
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("read proxy protocol v1 header error: %v", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, nil, fmt.Errorf("proxy protocol v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("invalid proxy protocol v1 header: %q", line)
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid proxy protocol v1 header: %q", line)
+	}
+	src, err := parseProxyProtocolV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseProxyProtocolV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseProxyProtocolV1Addr(proto, host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (proto == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid proxy protocol v1 address: %s", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy protocol v1 port: %s", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyProtocolV2 二进制格式: 12字节签名 + 版本和命令(1字节) + 协议族(1字节) + 地址长度(2字节) + 地址 + TLV
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var header [proxyProtocolV2HeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, nil, fmt.Errorf("read proxy protocol v2 header error: %v", err)
+	}
+	if version := header[12] >> 4; version != 2 {
+		return nil, nil, fmt.Errorf("invalid proxy protocol v2 version: %d", version)
+	}
+	command := header[12] & 0x0f
+	family, transport := header[13]>>4, header[13]&0x0f
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, fmt.Errorf("read proxy protocol v2 address error: %v", err)
+	}
+
+	switch command {
+	case proxyProtocolV2CmdLocal:
+		// 负载均衡自身的健康检查等连接
+		return nil, nil, nil
+	case proxyProtocolV2CmdProxy:
+	default:
+		return nil, nil, fmt.Errorf("invalid proxy protocol v2 command: %d", command)
+	}
+
+	// 只处理STREAM协议, 其他协议不携带地址
+	if transport != 0x1 {
+		return nil, nil, nil
+	}
+	switch family {
+	case proxyProtocolV2FamilyInet:
+		if len(payload) < 12 {
+			return nil, nil, fmt.Errorf("invalid proxy protocol v2 ipv4 address length: %d", len(payload))
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:]))},
+			&net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:]))}, nil
+	case proxyProtocolV2FamilyInet6:
+		if len(payload) < 36 {
+			return nil, nil, fmt.Errorf("invalid proxy protocol v2 ipv6 address length: %d", len(payload))
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:]))},
+			&net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:]))}, nil
+	case proxyProtocolV2FamilyUnix:
+		if len(payload) < 216 {
+			return nil, nil, fmt.Errorf("invalid proxy protocol v2 unix address length: %d", len(payload))
+		}
+		return &net.UnixAddr{Name: unixPathName(payload[0:108]), Net: "unix"},
+			&net.UnixAddr{Name: unixPathName(payload[108:216]), Net: "unix"}, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+func unixPathName(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func proxyProtocolV2Header(command, family byte, addr []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyProtocolV2Signature)
+	buf.WriteByte(0x20 | command)
+	buf.WriteByte(family<<4 | 0x1)
+	binary.Write(&buf, binary.BigEndian, uint16(len(addr)))
+	buf.Write(addr)
+	return buf.Bytes()
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	ipv4 := []byte{192, 168, 1, 10, 10, 0, 0, 1, 0x30, 0x39, 0x0c, 0xea}
+	ipv6 := make([]byte, 36)
+	copy(ipv6, net.ParseIP("2001:db8::1"))
+	copy(ipv6[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(ipv6[32:], 12345)
+	binary.BigEndian.PutUint16(ipv6[34:], 3306)
+
+	tests := []struct {
+		name   string
+		header []byte
+		src    string
+		dst    string
+		hasErr bool
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.168.1.10 10.0.0.1 12345 3306\r\n"), src: "192.168.1.10:12345", dst: "10.0.0.1:3306"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 3306\r\n"), src: "[2001:db8::1]:12345", dst: "[2001:db8::2]:3306"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 mismatch family", header: []byte("PROXY TCP4 2001:db8::1 10.0.0.1 12345 3306\r\n"), hasErr: true},
+		{name: "v1 invalid port", header: []byte("PROXY TCP4 192.168.1.10 10.0.0.1 123456 3306\r\n"), hasErr: true},
+		{name: "v1 without crlf", header: []byte("PROXY TCP4 192.168.1.10 10.0.0.1 12345 3306\n"), hasErr: true},
+		{name: "v2 ipv4", header: proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyInet, ipv4), src: "192.168.1.10:12345", dst: "10.0.0.1:3306"},
+		{name: "v2 ipv6", header: proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyInet6, ipv6), src: "[2001:db8::1]:12345", dst: "[2001:db8::2]:3306"},
+		{name: "v2 local", header: proxyProtocolV2Header(proxyProtocolV2CmdLocal, 0, nil)},
+		{name: "v2 short address", header: proxyProtocolV2Header(proxyProtocolV2CmdProxy, proxyProtocolV2FamilyInet, ipv4[:8]), hasErr: true},
+		{name: "no header", header: []byte{0x4a, 0x00, 0x00, 0x00, 0x0a, '5', '.', '7', '.', '2', '5', 0}, hasErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// 头部之后的数据不应被读取
+			r := bufio.NewReader(bytes.NewReader(append(test.header, "payload"...)))
+			src, dst, err := readProxyProtocolHeader(r)
+			if test.hasErr {
+				if err == nil {
+					t.Fatalf("expect error, src: %v, dst: %v", src, dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.src == "" {
+				if src != nil || dst != nil {
+					t.Errorf("expect no address, src: %v, dst: %v", src, dst)
+				}
+			} else if src.String() != test.src || dst.String() != test.dst {
+				t.Errorf("address not match, src: %v, dst: %v", src, dst)
+			}
+			rest, _ := ioutil.ReadAll(r)
+			if string(rest) != "payload" {
+				t.Errorf("payload not match: %q", rest)
+			}
+		})
+	}
+}
+
+func TestParseProxyProtocolConfig(t *testing.T) {
+	p, err := parseProxyProtocolConfig(&models.Proxy{})
+	if err != nil || p != nil {
+		t.Fatalf("proxy protocol should be disabled, config: %v, err: %v", p, err)
+	}
+
+	p, err = parseProxyProtocolConfig(&models.Proxy{ProxyProtocolNetworks: "10.0.0.0/8, 192.168.1.1,2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.headerTimeout != defaultProxyProtocolHeaderTimeout {
+		t.Errorf("header timeout not match: %v", p.headerTimeout)
+	}
+	tests := []struct {
+		addr    net.Addr
+		trusted bool
+	}{
+		{addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}, trusted: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 1}, trusted: true},
+		{addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 1}, trusted: false},
+		{addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1}, trusted: true},
+		{addr: &net.UnixAddr{Name: "/tmp/gaea.sock", Net: "unix"}, trusted: false},
+	}
+	for _, test := range tests {
+		if actual := p.trusted(test.addr); actual != test.trusted {
+			t.Errorf("trusted of %s not match, expect: %v, actual: %v", test.addr, test.trusted, actual)
+		}
+	}
+
+	if _, err := parseProxyProtocolConfig(&models.Proxy{ProxyProtocolNetworks: "10.0.0.0/33"}); err == nil {
+		t.Error("expect error of invalid cidr")
+	}
+	if _, err := parseProxyProtocolConfig(&models.Proxy{ProxyProtocolNetworks: "*", ProxyProtocolHeaderTimeout: -1}); err == nil {
+		t.Error("expect error of invalid header timeout")
+	}
+}
+
+func TestProxyProtocolAccept(t *testing.T) {
+	p := &proxyProtocolConfig{allowAll: true, headerTimeout: time.Second}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	go client.Write([]byte("PROXY TCP4 192.168.1.10 10.0.0.1 12345 3306\r\nquit"))
+
+	c, err := p.accept(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.RemoteAddr().String() != "192.168.1.10:12345" {
+		t.Errorf("remote addr not match: %s", c.RemoteAddr())
+	}
+	if c.(*proxyProtocolConn).ProxyAddr() != server.RemoteAddr() {
+		t.Errorf("proxy addr not match: %s", c.(*proxyProtocolConn).ProxyAddr())
+	}
+	buf := make([]byte, 4)
+	if _, err := c.Read(buf); err != nil || string(buf) != "quit" {
+		t.Errorf("read after header not match: %q, err: %v", buf, err)
+	}
+
+	// 受信任的连接没有发送头部时超时
+	server2, client2 := net.Pipe()
+	defer server2.Close()
+	defer client2.Close()
+	p.headerTimeout = 10 * time.Millisecond
+	if _, err := p.accept(server2); err == nil {
+		t.Error("expect timeout error when header is missing")
+	}
+
+	// 不受信任的连接不解析头部
+	untrusted := &proxyProtocolConfig{headerTimeout: time.Second}
+	server3, client3 := net.Pipe()
+	defer server3.Close()
+	defer client3.Close()
+	c, err = untrusted.accept(server3)
+	if err != nil || c != server3 {
+		t.Errorf("untrusted connection should not be wrapped, err: %v", err)
+	}
+}
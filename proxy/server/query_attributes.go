@@ -0,0 +1,122 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// readQueryAttributes 协商CLIENT_QUERY_ATTRIBUTES时解析COM_QUERY中的query attributes, 返回属性和语句
+func (cc *Session) readQueryAttributes(cmd byte, data []byte) (map[string]string, []byte, error) {
+	if cmd != mysql.ComQuery || !cc.executor.clientQueryAttributes {
+		return nil, data, nil
+	}
+	return parseQueryAttributes(data)
+}
+
+// parseQueryAttributes parse query attributes before sql of COM_QUERY, return attributes and sql.
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_com_query.html
+func parseQueryAttributes(data []byte) (map[string]string, []byte, error) {
+	count, pos, _, ok := mysql.ReadLenEncInt(data, 0)
+	if !ok || count > uint64(len(data)) {
+		return nil, nil, mysql.ErrMalformPacket
+	}
+	// parameter_set_count, 目前总是1
+	if _, pos, _, ok = mysql.ReadLenEncInt(data, pos); !ok {
+		return nil, nil, mysql.ErrMalformPacket
+	}
+	if count == 0 {
+		return nil, data[pos:], nil
+	}
+
+	n := int(count)
+	nullBitmapLen := (n + 7) >> 3
+	if len(data) < pos+nullBitmapLen+1 {
+		return nil, nil, mysql.ErrMalformPacket
+	}
+	nullBitmap := data[pos : pos+nullBitmapLen]
+	pos += nullBitmapLen
+	// new_params_bind_flag, 不发送类型时无法解析属性值
+	if data[pos] != 1 {
+		return nil, nil, mysql.ErrMalformPacket
+	}
+	pos++
+
+	types, names, pos, err := readParamTypesWithNames(data, pos, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	attrs, pos, err := readQueryAttributeValues(nullBitmap, 0, types, names, data, pos)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attrs, data[pos:], nil
+}
+
+// readParamTypesWithNames read n param types followed by names, used when CLIENT_QUERY_ATTRIBUTES is negotiated
+func readParamTypesWithNames(data []byte, pos int, n int) ([]byte, []string, int, error) {
+	types := make([]byte, 0, n<<1)
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if len(data) < pos+2 {
+			return nil, nil, 0, mysql.ErrMalformPacket
+		}
+		types = append(types, data[pos], data[pos+1])
+		pos += 2
+		name, next, _, ok := mysql.ReadLenEncStringAsBytes(data, pos)
+		if !ok {
+			return nil, nil, 0, mysql.ErrMalformPacket
+		}
+		names = append(names, string(name))
+		pos = next
+	}
+	return types, names, pos, nil
+}
+
+// readQueryAttributeValues read values of attributes from pos, offset is the index of the first attribute in null bitmap.
+// 值为NULL的属性不返回, 同名属性后面的值覆盖前面的值
+func readQueryAttributeValues(nullBitmap []byte, offset int, types []byte, names []string, values []byte, pos int) (map[string]string, int, error) {
+	attrs := make(map[string]string, len(names))
+	for i, name := range names {
+		if bit := offset + i; nullBitmap[bit>>3]&(1<<(uint(bit)%8)) > 0 {
+			continue
+		}
+		v, next, err := readBinaryParam(types[i<<1], types[(i<<1)+1]&0x80 > 0, values, pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		pos = next
+		if v != nil {
+			attrs[name] = formatQueryAttribute(v)
+		}
+	}
+	return attrs, pos, nil
+}
+
+func formatQueryAttribute(v interface{}) string {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
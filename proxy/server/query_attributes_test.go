@@ -0,0 +1,138 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// queryParam param or attribute sent by client, value is nil for NULL
+type queryParam struct {
+	name  string
+	tp    byte
+	value []byte // binary protocol编码后的值
+}
+
+// appendQueryParams append null bitmap, new params bind flag, types with names and values
+func appendQueryParams(data []byte, params []queryParam) []byte {
+	nullBitmap := make([]byte, (len(params)+7)>>3)
+	for i, p := range params {
+		if p.value == nil {
+			nullBitmap[i>>3] |= 1 << (uint(i) % 8)
+		}
+	}
+	data = append(data, nullBitmap...)
+	data = append(data, 1)
+	for _, p := range params {
+		data = append(data, p.tp, 0)
+		data = mysql.AppendLenEncStringBytes(data, []byte(p.name))
+	}
+	for _, p := range params {
+		data = append(data, p.value...)
+	}
+	return data
+}
+
+func TestParseQueryAttributes(t *testing.T) {
+	id := make([]byte, 8)
+	binary.LittleEndian.PutUint64(id, 42)
+	attrs := []queryParam{
+		{name: "trace_id", tp: mysql.TypeVarString, value: mysql.AppendLenEncStringBytes(nil, []byte("0af7651916cd43dd"))},
+		{name: "null_attr", tp: mysql.TypeNull},
+		{name: "tenant", tp: mysql.TypeLonglong, value: id},
+	}
+	data := mysql.AppendLenEncInt(nil, uint64(len(attrs)))
+	data = mysql.AppendLenEncInt(data, 1)
+	data = appendQueryParams(data, attrs)
+	data = append(data, "select 1"...)
+
+	ret, sql, err := parseQueryAttributes(data)
+	if err != nil {
+		t.Fatalf("parse query attributes error: %v", err)
+	}
+	expect := map[string]string{"trace_id": "0af7651916cd43dd", "tenant": "42"}
+	if !reflect.DeepEqual(ret, expect) || string(sql) != "select 1" {
+		t.Errorf("parse query attributes, expect: %v, actual: %v %s", expect, ret, sql)
+	}
+
+	// 没有属性
+	ret, sql, err = parseQueryAttributes(append([]byte{0, 1}, "select 1"...))
+	if err != nil || ret != nil || string(sql) != "select 1" {
+		t.Errorf("parse empty query attributes, actual: %v %s %v", ret, sql, err)
+	}
+
+	// 截断的包和不发送类型的包
+	for _, data := range [][]byte{data[:10], {1, 1, 0, 0}, {}} {
+		if _, _, err := parseQueryAttributes(data); err != mysql.ErrMalformPacket {
+			t.Errorf("expect malformed packet error, data: %v, actual: %v", data, err)
+		}
+	}
+}
+
+func TestStmtExecuteQueryAttributes(t *testing.T) {
+	se := newSessionExecutor(nil)
+	se.healthCheck = true
+	se.clientQueryAttributes = true
+	paramCount, offsets, _ := calcParams("SELECT ?")
+	s := &Stmt{id: 1, sql: "SELECT ?", paramCount: paramCount, offsets: offsets}
+	s.ResetParams()
+	se.stmts[s.id] = s
+
+	newExecuteData := func(flag byte, params []queryParam) []byte {
+		data := make([]byte, 9)
+		binary.LittleEndian.PutUint32(data[0:4], s.id)
+		data[4] = flag
+		binary.LittleEndian.PutUint32(data[5:9], 1)
+		data = mysql.AppendLenEncInt(data, uint64(len(params)))
+		return appendQueryParams(data, params)
+	}
+
+	params := []queryParam{
+		{tp: mysql.TypeTiny, value: []byte{1}},
+		{name: "trace_id", tp: mysql.TypeString, value: mysql.AppendLenEncStringBytes(nil, []byte("abc"))},
+	}
+	r, _, err := se.handleStmtExecute(newExecuteData(mysql.ParameterCountAvailable, params))
+	if err != nil {
+		t.Fatalf("execute error: %v", err)
+	}
+	// 参数绑定后为健康检查语句SELECT 1, 由gaea直接返回
+	if r == nil || len(r.RowDatas) != 1 {
+		t.Errorf("statement param should be bound, actual: %v", r)
+	}
+	if expect := map[string]string{"trace_id": "abc"}; !reflect.DeepEqual(se.GetQueryAttributes(), expect) {
+		t.Errorf("query attributes, expect: %v, actual: %v", expect, se.GetQueryAttributes())
+	}
+
+	// 参数个数少于语句参数个数
+	se.queryAttributes = nil
+	if _, _, err := se.handleStmtExecute(newExecuteData(mysql.ParameterCountAvailable, nil)); err != mysql.ErrMalformPacket {
+		t.Errorf("expect malformed packet error, actual: %v", err)
+	}
+	// 没有协商CLIENT_QUERY_ATTRIBUTES时参数个数不单独发送
+	se.clientQueryAttributes = false
+	data := make([]byte, 9)
+	binary.LittleEndian.PutUint32(data[0:4], s.id)
+	data = append(data, 0, 1, mysql.TypeTiny, 0, 1)
+	if _, _, err := se.handleStmtExecute(data); err != nil {
+		t.Errorf("execute without query attributes error: %v", err)
+	}
+	if se.GetQueryAttributes() != nil {
+		t.Errorf("expect no query attributes, actual: %v", se.GetQueryAttributes())
+	}
+}
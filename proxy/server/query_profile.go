@@ -0,0 +1,97 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// 会话保存上一条下发到后端的语句在各分片的耗时, 通过SHOW LAST QUERY PROFILE查看
+const showLastQueryProfileSQL = "show last query profile"
+
+var queryProfileColumns = []string{"Slice", "Addr", "Sql", "Cost_us", "Rows", "Affected_rows", "Error"}
+
+// queryProfile collect per slice execution details of a request
+type queryProfile struct {
+	lock     sync.Mutex
+	backends []*backendSample
+}
+
+func getQueryProfile(reqCtx *util.RequestContext) *queryProfile {
+	p, _ := reqCtx.Get(util.QueryProfile).(*queryProfile)
+	return p
+}
+
+// add 可能在多个分片的goroutine中并发调用
+func (p *queryProfile) add(s *backendSample) {
+	p.lock.Lock()
+	p.backends = append(p.backends, s)
+	p.lock.Unlock()
+}
+
+func isShowLastQueryProfile(sql string) bool {
+	return strings.Join(strings.Fields(strings.ToLower(sql)), " ") == showLastQueryProfileSQL
+}
+
+// saveQueryProfile 只保存实际下发到后端的语句, 避免SHOW LAST QUERY PROFILE等语句覆盖上一次的结果
+func (se *SessionExecutor) saveQueryProfile(reqCtx *util.RequestContext) {
+	p := getQueryProfile(reqCtx)
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.backends) == 0 {
+		return
+	}
+	sort.SliceStable(p.backends, func(i, j int) bool {
+		return p.backends[i].Slice < p.backends[j].Slice
+	})
+	se.lastQueryProfile = p
+}
+
+func (se *SessionExecutor) handleShowLastQueryProfile() (*mysql.Result, error) {
+	r := new(mysql.Resultset)
+	for _, column := range queryProfileColumns {
+		field := &mysql.Field{}
+		field.Name = hack.Slice(column)
+		r.Fields = append(r.Fields, field)
+	}
+
+	if p := se.lastQueryProfile; p != nil {
+		for _, s := range p.backends {
+			var errMsg interface{}
+			if s.Err != "" {
+				errMsg = s.Err
+			}
+			r.Values = append(r.Values, []interface{}{s.Slice, s.Addr, s.SQL, s.CostUs, int64(s.Rows), s.AffectedRows, errMsg})
+		}
+	}
+
+	result := &mysql.Result{
+		Resultset: r,
+	}
+	if err := plan.GenerateSelectResultRowData(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestIsShowLastQueryProfile(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect bool
+	}{
+		{"show last query profile", true},
+		{"SHOW  LAST QUERY\nPROFILE", true},
+		{"show profile", false},
+		{"show last query profiles", false},
+	}
+	for _, test := range tests {
+		if actual := isShowLastQueryProfile(test.sql); actual != test.expect {
+			t.Errorf("sql: %s, expect: %v, actual: %v", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestShowLastQueryProfile(t *testing.T) {
+	se := &SessionExecutor{}
+	r, err := se.handleShowLastQueryProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fields) != len(queryProfileColumns) || len(r.Values) != 0 {
+		t.Fatalf("empty profile not match, fields: %d, rows: %d", len(r.Fields), len(r.Values))
+	}
+
+	reqCtx := util.NewRequestContext()
+	reqCtx.Set(util.QueryProfile, &queryProfile{})
+	res := &mysql.Result{Resultset: &mysql.Resultset{Values: [][]interface{}{{1}, {2}}}}
+	recordBackendSample(reqCtx, "slice-1", "127.0.0.1:3307", "select * from t_1", time.Now(), nil, errors.New("timeout"))
+	recordBackendSample(reqCtx, "slice-0", "127.0.0.1:3306", "select * from t_0", time.Now(), res, nil)
+	se.saveQueryProfile(reqCtx)
+
+	// 没有下发到后端的语句不覆盖上一次的结果
+	emptyCtx := util.NewRequestContext()
+	emptyCtx.Set(util.QueryProfile, &queryProfile{})
+	se.saveQueryProfile(emptyCtx)
+
+	r, err = se.handleShowLastQueryProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Values) != 2 || len(r.RowDatas) != 2 {
+		t.Fatalf("profile rows not match, expect: 2, actual: %d", len(r.Values))
+	}
+	if r.Values[0][0] != "slice-0" || r.Values[0][4] != int64(2) || r.Values[0][6] != nil {
+		t.Errorf("first profile row not match: %v", r.Values[0])
+	}
+	if r.Values[1][0] != "slice-1" || r.Values[1][6] != "timeout" {
+		t.Errorf("second profile row not match: %v", r.Values[1])
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func newReadOnlyExecutor() *SessionExecutor {
+	ns := &Namespace{
+		name:                 "test_namespace",
+		readOnlyExceptTables: parseReadOnlyExceptTables([]string{"db_ks.tbl_log"}),
+		userProperties:       map[string]*UserProperty{"test_user": {RWFlag: models.ReadWrite}},
+	}
+	ns.SetReadOnly(true)
+	m := newTestManager(ns)
+
+	se := newSessionExecutor(m)
+	se.namespace = ns.name
+	se.user = "test_user"
+	se.db = "db_ks"
+	return se
+}
+
+func isReadOnlyError(err error) bool {
+	e, ok := err.(*mysql.SQLError)
+	return ok && e.SQLCode() == mysql.ErrReadOnlyMode
+}
+
+func TestCheckNamespaceReadOnly(t *testing.T) {
+	se := newReadOnlyExecutor()
+
+	tests := []struct {
+		sql    string
+		denied bool
+		parsed bool
+	}{
+		{"insert into tbl_ks (id) values (1)", true, false},
+		{"update db_ks.tbl_ks set a = 1 where id = 1", true, false},
+		{"insert into tbl_log (id) values (1)", false, true},
+		{"delete from db_ks.tbl_log where id = 1", false, true},
+		{"insert into tbl_log select * from tbl_ks", true, false},
+		{"select * from tbl_ks", false, false},
+	}
+	for _, test := range tests {
+		n, err := se.checkNamespaceReadOnly(parser.PreviewSql(test.sql), test.sql)
+		if test.denied != isReadOnlyError(err) {
+			t.Errorf("read only check not match, sql: %s, expect denied: %v, err: %v", test.sql, test.denied, err)
+		}
+		if test.parsed != (n != nil) {
+			t.Errorf("parsed statement not match, sql: %s, expect parsed: %v", test.sql, test.parsed)
+		}
+	}
+
+	se.GetNamespace().SetReadOnly(false)
+	if _, err := se.checkNamespaceReadOnly(parser.StmtInsert, "insert into tbl_ks (id) values (1)"); err != nil {
+		t.Errorf("write should be allowed when namespace is not read only, err: %v", err)
+	}
+}
+
+func TestStmtExecuteReadOnly(t *testing.T) {
+	se := newReadOnlyExecutor()
+	for i, sql := range []string{"insert into tbl_ks (id) values (?)", "insert into tbl_log (id) values (?)"} {
+		paramCount, offsets, _ := calcParams(sql)
+		s := &Stmt{id: uint32(i), sql: sql, paramCount: paramCount, offsets: offsets}
+		s.ResetParams()
+		se.stmts[s.id] = s
+	}
+
+	data := make([]byte, 9)
+	binary.LittleEndian.PutUint32(data[0:4], 0)
+	if _, _, err := se.handleStmtExecute(data); !isReadOnlyError(err) {
+		t.Errorf("stmt execute should be denied in read only namespace, err: %v", err)
+	}
+
+	// 例外表的语句通过检查, 解析出的表缓存在Stmt中
+	s := se.stmts[1]
+	if err := se.checkStmtNamespaceReadOnly(s); err != nil {
+		t.Errorf("stmt on except table should be allowed, err: %v", err)
+	}
+	if len(s.tables) != 1 || s.tables[0].Name.L != "tbl_log" {
+		t.Errorf("stmt tables not cached, tables: %v", s.tables)
+	}
+}
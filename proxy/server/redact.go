@@ -0,0 +1,42 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// redactSQL 将日志中SQL的字面量替换为?, 避免敏感数据写入日志, namespace开启log_raw_sql时只去掉换行.
+// namespace为nil时同样脱敏
+func (n *Namespace) redactSQL(sql string) string {
+	if n != nil && n.logRawSQL {
+		return strings.ReplaceAll(sql, "\n", " ")
+	}
+	return mysql.NormalizeSQL(sql).SQL
+}
+
+// redactError 错误信息中可能包含原始SQL, 如get plan error
+func (n *Namespace) redactError(sql string, err error) string {
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	if (n != nil && n.logRawSQL) || sql == "" {
+		return msg
+	}
+	return strings.ReplaceAll(msg, sql, n.redactSQL(sql))
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRedactSQL(t *testing.T) {
+	sql := "select * from t\nwhere phone = '13800000000' and id = 1"
+	redacted := "select * from t where phone = ? and id = ?"
+
+	var nilNamespace *Namespace
+	if actual := nilNamespace.redactSQL(sql); actual != redacted {
+		t.Errorf("nil namespace, expect: %s, actual: %s", redacted, actual)
+	}
+	ns := &Namespace{}
+	if actual := ns.redactSQL(sql); actual != redacted {
+		t.Errorf("default namespace, expect: %s, actual: %s", redacted, actual)
+	}
+	err := fmt.Errorf("get plan error, parser: %s, err: unknown column", sql)
+	expectErr := "get plan error, parser: " + redacted + ", err: unknown column"
+	if actual := ns.redactError(sql, err); actual != expectErr {
+		t.Errorf("redact error, expect: %s, actual: %s", expectErr, actual)
+	}
+	if actual := ns.redactError(sql, nil); actual != "" {
+		t.Errorf("redact nil error, expect empty, actual: %s", actual)
+	}
+
+	rawNamespace := &Namespace{logRawSQL: true}
+	raw := "select * from t where phone = '13800000000' and id = 1"
+	if actual := rawNamespace.redactSQL(sql); actual != raw {
+		t.Errorf("log raw sql, expect: %s, actual: %s", raw, actual)
+	}
+	if actual := rawNamespace.redactError(sql, err); actual != err.Error() {
+		t.Errorf("log raw sql error, expect: %s, actual: %s", err.Error(), actual)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/cache"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// 采样语句的proxy CPU时间和内存分配按指纹和用户聚合, 通过SHOW TOP {QUERIES|USERS} BY {CPU|MEMORY} [LIMIT n]查看
+const (
+	defaultResourceStatsCapacity = 1000
+	defaultShowTopLimit          = 10
+
+	heapAllocsMetric = "/gc/heap/allocs:bytes" // 进程累计的堆分配字节数
+)
+
+var (
+	topQueriesColumns = []string{"Fingerprint", "User", "Count", "Total_cpu_us", "Avg_cpu_us", "Max_cpu_us", "Total_alloc_bytes", "Avg_alloc_bytes", "Max_alloc_bytes"}
+	topUsersColumns   = []string{"User", "Count", "Total_cpu_us", "Avg_cpu_us", "Max_cpu_us", "Total_alloc_bytes", "Avg_alloc_bytes", "Max_alloc_bytes"}
+)
+
+// resourceStat aggregated cpu time and allocated bytes of a fingerprint or a user
+type resourceStat struct {
+	fingerprint     string
+	user            string
+	count           int64
+	totalCPUUs      int64
+	maxCPUUs        int64
+	totalAllocBytes int64
+	maxAllocBytes   int64
+}
+
+// Size implement cache.Value
+func (s *resourceStat) Size() int {
+	return 1
+}
+
+func (s *resourceStat) add(cpuUs, allocBytes int64) {
+	s.count++
+	s.totalCPUUs += cpuUs
+	s.totalAllocBytes += allocBytes
+	if cpuUs > s.maxCPUUs {
+		s.maxCPUUs = cpuUs
+	}
+	if allocBytes > s.maxAllocBytes {
+		s.maxAllocBytes = allocBytes
+	}
+}
+
+// resourceStats 按指纹+用户以及按用户聚合, 超过容量时淘汰最久未更新的记录
+type resourceStats struct {
+	lock    sync.Mutex
+	queries *cache.LRUCache
+	users   *cache.LRUCache
+}
+
+func newResourceStats(capacity int64) *resourceStats {
+	return &resourceStats{
+		queries: cache.NewLRUCache(capacity),
+		users:   cache.NewLRUCache(capacity),
+	}
+}
+
+func (rs *resourceStats) record(fingerprint, user string, cpuUs, allocBytes int64) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	key := mysql.GetMd5(fingerprint) + "|" + user
+	if v, ok := rs.queries.Get(key); ok {
+		v.(*resourceStat).add(cpuUs, allocBytes)
+	} else {
+		s := &resourceStat{fingerprint: fingerprint, user: user}
+		s.add(cpuUs, allocBytes)
+		rs.queries.Set(key, s)
+	}
+
+	if v, ok := rs.users.Get(user); ok {
+		v.(*resourceStat).add(cpuUs, allocBytes)
+	} else {
+		s := &resourceStat{user: user}
+		s.add(cpuUs, allocBytes)
+		rs.users.Set(user, s)
+	}
+}
+
+// top return copies of the first limit stats ordered by total cpu time or total allocated bytes
+func (rs *resourceStats) top(users, byMemory bool, limit int) []resourceStat {
+	c := rs.queries
+	if users {
+		c = rs.users
+	}
+
+	rs.lock.Lock()
+	items := c.Items()
+	stats := make([]resourceStat, 0, len(items))
+	for _, item := range items {
+		stats = append(stats, *item.Value.(*resourceStat))
+	}
+	rs.lock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if byMemory {
+			return stats[i].totalAllocBytes > stats[j].totalAllocBytes
+		}
+		return stats[i].totalCPUUs > stats[j].totalCPUUs
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// showTopStmt SHOW TOP {QUERIES|USERS} BY {CPU|MEMORY} [LIMIT n]
+type showTopStmt struct {
+	users    bool
+	byMemory bool
+	limit    int
+}
+
+func parseShowTop(sql string) (*showTopStmt, bool) {
+	fields := strings.Fields(strings.ToLower(sql))
+	if (len(fields) != 5 && len(fields) != 7) || fields[0] != "show" || fields[1] != "top" || fields[3] != "by" {
+		return nil, false
+	}
+
+	stmt := &showTopStmt{limit: defaultShowTopLimit}
+	switch fields[2] {
+	case "queries":
+	case "users":
+		stmt.users = true
+	default:
+		return nil, false
+	}
+	switch fields[4] {
+	case "cpu":
+	case "memory":
+		stmt.byMemory = true
+	default:
+		return nil, false
+	}
+	if len(fields) == 7 {
+		limit, err := strconv.Atoi(fields[6])
+		if fields[5] != "limit" || err != nil || limit <= 0 {
+			return nil, false
+		}
+		stmt.limit = limit
+	}
+	return stmt, true
+}
+
+func isShowTop(sql string) bool {
+	_, ok := parseShowTop(sql)
+	return ok
+}
+
+// resourceUsage 采样语句的资源消耗:
+// CPU时间为会话goroutine和并发执行分片的goroutine绑定线程期间线程的CPU时间, 不支持的平台为0;
+// 内存分配为执行期间进程堆分配的增量, 包含同时执行的其他请求的分配, 是近似值
+type resourceUsage struct {
+	cpuNs      int64 // 原子累加, 各分片goroutine并发更新
+	allocStart uint64
+}
+
+func startResourceUsage(reqCtx *util.RequestContext) *resourceUsage {
+	u := &resourceUsage{allocStart: heapAllocBytes()}
+	reqCtx.Set(util.ResourceUsage, u)
+	return u
+}
+
+func getResourceUsage(reqCtx *util.RequestContext) *resourceUsage {
+	u, _ := reqCtx.Get(util.ResourceUsage).(*resourceUsage)
+	return u
+}
+
+// trackCPU 绑定当前goroutine到线程, 返回的函数把期间线程的CPU时间计入u并解除绑定.
+// 绑定后线程只执行当前goroutine, 线程的CPU时间即goroutine的CPU时间, 未采样时u为nil, 不做任何事
+func (u *resourceUsage) trackCPU() func() {
+	if u == nil {
+		return func() {}
+	}
+	runtime.LockOSThread()
+	start, ok := threadCPUTime()
+	return func() {
+		if end, endOk := threadCPUTime(); ok && endOk {
+			atomic.AddInt64(&u.cpuNs, int64(end-start))
+		}
+		runtime.UnlockOSThread()
+	}
+}
+
+// stop return cpu time in microseconds and allocated bytes
+func (u *resourceUsage) stop() (int64, int64) {
+	cpuUs := time.Duration(atomic.LoadInt64(&u.cpuNs)).Microseconds()
+	return cpuUs, int64(heapAllocBytes() - u.allocStart)
+}
+
+func heapAllocBytes() uint64 {
+	samples := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64()
+}
+
+// doQueryWithResourceUsage 执行采样的语句, 统计proxy的CPU时间和内存分配
+func (se *SessionExecutor) doQueryWithResourceUsage(reqCtx *util.RequestContext, ns *Namespace, sql string) (*mysql.Result, error) {
+	u := startResourceUsage(reqCtx)
+	defer func() {
+		cpuUs, allocBytes := u.stop()
+		ns.resourceStats.record(mysql.GetFingerprint(sql), se.user, cpuUs, allocBytes)
+	}()
+	defer u.trackCPU()()
+	return se.doQuery(reqCtx, sql)
+}
+
+func (se *SessionExecutor) handleShowTop(stmt *showTopStmt) (*mysql.Result, error) {
+	columns := topQueriesColumns
+	if stmt.users {
+		columns = topUsersColumns
+	}
+	r := new(mysql.Resultset)
+	for _, column := range columns {
+		field := &mysql.Field{}
+		field.Name = hack.Slice(column)
+		r.Fields = append(r.Fields, field)
+	}
+
+	for _, s := range se.GetNamespace().resourceStats.top(stmt.users, stmt.byMemory, stmt.limit) {
+		row := []interface{}{s.user, s.count, s.totalCPUUs, s.totalCPUUs / s.count, s.maxCPUUs, s.totalAllocBytes, s.totalAllocBytes / s.count, s.maxAllocBytes}
+		if !stmt.users {
+			row = append([]interface{}{s.fingerprint}, row...)
+		}
+		r.Values = append(r.Values, row)
+	}
+
+	result := &mysql.Result{
+		Resultset: r,
+	}
+	if err := plan.GenerateSelectResultRowData(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
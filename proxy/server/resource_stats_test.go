@@ -0,0 +1,155 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestParseShowTop(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect *showTopStmt
+	}{
+		{"show top queries by cpu", &showTopStmt{limit: defaultShowTopLimit}},
+		{"SHOW TOP USERS BY MEMORY LIMIT 3", &showTopStmt{users: true, byMemory: true, limit: 3}},
+		{"show  top queries\nby memory", &showTopStmt{byMemory: true, limit: defaultShowTopLimit}},
+		{"show top queries by io", nil},
+		{"show top tables by cpu", nil},
+		{"show top users by cpu limit 0", nil},
+		{"show top users by cpu offset 3", nil},
+		{"show top users", nil},
+	}
+	for _, test := range tests {
+		actual, ok := parseShowTop(test.sql)
+		if test.expect == nil {
+			if ok {
+				t.Errorf("sql: %s, expect not match, actual: %v", test.sql, actual)
+			}
+			continue
+		}
+		if !ok || *actual != *test.expect {
+			t.Errorf("sql: %s, expect: %v, actual: %v", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestResourceStats(t *testing.T) {
+	rs := newResourceStats(2)
+	rs.record("SELECT * FROM t WHERE id = ?", "u1", 100, 1000)
+	rs.record("SELECT * FROM t WHERE id = ?", "u1", 300, 10)
+	rs.record("SELECT * FROM t WHERE id = ?", "u2", 50, 5000)
+
+	queries := rs.top(false, false, 10)
+	if len(queries) != 2 || queries[0].user != "u1" || queries[0].count != 2 || queries[0].totalCPUUs != 400 || queries[0].maxCPUUs != 300 {
+		t.Fatalf("top queries by cpu not match: %v", queries)
+	}
+	queries = rs.top(false, true, 1)
+	if len(queries) != 1 || queries[0].user != "u2" || queries[0].maxAllocBytes != 5000 {
+		t.Fatalf("top queries by memory not match: %v", queries)
+	}
+
+	// 超过容量时淘汰最久未更新的记录
+	rs.record("DELETE FROM t", "u3", 1, 1)
+	if users := rs.top(true, false, 10); len(users) != 2 || users[0].user != "u2" || users[1].user != "u3" {
+		t.Fatalf("top users not match: %v", users)
+	}
+}
+
+func TestResourceUsage(t *testing.T) {
+	reqCtx := util.NewRequestContext()
+	u := startResourceUsage(reqCtx)
+	if getResourceUsage(reqCtx) != u {
+		t.Fatal("resource usage should be set in request context")
+	}
+
+	// 在另一个goroutine中消耗CPU, 模拟并发执行的分片
+	var sink [][]byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer u.trackCPU()()
+		busyLoop(20 * time.Millisecond)
+	}()
+	stop := u.trackCPU()
+	busyLoop(20 * time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		sink = append(sink, make([]byte, 1024))
+	}
+	stop()
+	<-done
+
+	cpuUs, allocBytes := u.stop()
+	// 小对象的分配按span统计, 可能少算未用完的span
+	if allocBytes < int64(len(sink)*1024/2) {
+		t.Errorf("allocated bytes not counted, alloc: %d", allocBytes)
+	}
+	if _, ok := threadCPUTime(); !ok {
+		t.Skip("thread cpu time is not supported on this platform")
+	}
+	// 两个goroutine各消耗20ms, 机器繁忙时分到的CPU时间可能少于墙上时间, 只检查下限的一半
+	if cpuUs < 20000 || cpuUs > 1000000 {
+		t.Errorf("cpu time not match, cpu: %dus", cpuUs)
+	}
+
+	// 未采样时不统计
+	var nilUsage *resourceUsage
+	nilUsage.trackCPU()()
+}
+
+// busyLoop 消耗d时间的CPU
+func busyLoop(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func TestShowTop(t *testing.T) {
+	m := newStateSnapshotManager("md5")
+	ns := m.GetNamespace("test_namespace")
+	ns.resourceSampleRate = 1
+	ns.resourceStats = newResourceStats(defaultResourceStatsCapacity)
+	se := &SessionExecutor{manager: m, namespace: ns.name, user: "u1"}
+
+	sql := "select * from t where id = 1"
+	if !ns.sampleResourceStats() {
+		t.Fatal("statement should be sampled")
+	}
+	ns.resourceStats.record(mysql.GetFingerprint(sql), se.user, 700, 4096)
+
+	stmt, _ := parseShowTop("show top queries by memory")
+	r, err := se.handleShowTop(stmt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fields) != len(topQueriesColumns) || len(r.Values) != 1 || len(r.RowDatas) != 1 {
+		t.Fatalf("top queries not match, fields: %d, rows: %d", len(r.Fields), len(r.Values))
+	}
+	row := r.Values[0]
+	if row[0] != mysql.GetFingerprint(sql) || row[1] != "u1" || row[2] != int64(1) || row[3] != int64(700) || row[6] != int64(4096) {
+		t.Errorf("top queries row not match: %v", row)
+	}
+
+	stmt, _ = parseShowTop("show top users by cpu")
+	if r, err = se.handleShowTop(stmt); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fields) != len(topUsersColumns) || len(r.Values) != 1 || r.Values[0][0] != "u1" {
+		t.Errorf("top users not match: %v", r.Values)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// resultTransform runtime result transform rule
+type resultTransform struct {
+	db      string
+	table   string
+	users   map[string]bool // 为空表示所有用户
+	compute []*computedColumn
+	drop    map[string]bool   // key: 小写列名
+	rename  map[string]string // key: 小写原列名
+}
+
+type computedColumn struct {
+	name    string
+	parts   []string
+	columns []string // 小写列名, 为空时对应parts中的字面值
+}
+
+func parseResultTransforms(cfgTransforms []*models.ResultTransform) ([]*resultTransform, error) {
+	var transforms []*resultTransform
+	for _, cfg := range cfgTransforms {
+		t := &resultTransform{
+			db:     cfg.DB,
+			table:  strings.ToLower(cfg.Table),
+			drop:   make(map[string]bool, len(cfg.Drop)),
+			rename: make(map[string]string, len(cfg.Rename)),
+		}
+		if len(cfg.Users) != 0 {
+			t.users = make(map[string]bool, len(cfg.Users))
+			for _, u := range cfg.Users {
+				t.users[u] = true
+			}
+		}
+		for _, c := range cfg.Compute {
+			parts, columns, err := models.ParseComputedExpr(c.Expr)
+			if err != nil {
+				return nil, err
+			}
+			for i := range columns {
+				columns[i] = strings.ToLower(columns[i])
+			}
+			t.compute = append(t.compute, &computedColumn{name: c.Name, parts: parts, columns: columns})
+		}
+		for _, d := range cfg.Drop {
+			t.drop[strings.ToLower(d)] = true
+		}
+		for from, to := range cfg.Rename {
+			t.rename[strings.ToLower(from)] = to
+		}
+		transforms = append(transforms, t)
+	}
+	return transforms, nil
+}
+
+// resultTransformTableCollector collect tables referenced by select statement
+type resultTransformTableCollector struct {
+	db     string
+	tables map[string]bool // key: db.table, 表名小写
+}
+
+// Enter implement ast.Visitor
+func (c *resultTransformTableCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if t, ok := n.(*ast.TableName); ok {
+		db := t.Schema.O
+		if db == "" {
+			db = c.db
+		}
+		c.tables[db+"."+t.Name.L] = true
+		return n, true
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (c *resultTransformTableCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// recordResultTransforms 在生成执行计划前找出对查询生效的转换规则, 执行后再作用于结果集
+func recordResultTransforms(reqCtx *util.RequestContext, ns *Namespace, stmt ast.StmtNode, db, user string) {
+	if len(ns.resultTransforms) == 0 {
+		return
+	}
+	if _, ok := stmt.(*ast.SelectStmt); !ok {
+		return
+	}
+
+	collector := &resultTransformTableCollector{db: db, tables: make(map[string]bool)}
+	parser.Visit(stmt, collector)
+
+	var transforms []*resultTransform
+	for _, t := range ns.resultTransforms {
+		if t.users != nil && !t.users[user] {
+			continue
+		}
+		if collector.tables[t.db+"."+t.table] {
+			transforms = append(transforms, t)
+		}
+	}
+	if len(transforms) != 0 {
+		reqCtx.Set(util.ResultTransforms, transforms)
+	}
+}
+
+// applyResultTransforms transform fields and values of result set, and regenerate row data
+func applyResultTransforms(reqCtx *util.RequestContext, r *mysql.Result) error {
+	transforms, ok := reqCtx.Get(util.ResultTransforms).([]*resultTransform)
+	if !ok || r == nil || r.Resultset == nil {
+		return nil
+	}
+	for _, t := range transforms {
+		t.apply(r.Resultset)
+	}
+	return plan.GenerateSelectResultRowData(r)
+}
+
+func (t *resultTransform) apply(rs *mysql.Resultset) {
+	index := make(map[string]int, len(rs.Fields))
+	for i, f := range rs.Fields {
+		name := strings.ToLower(string(f.Name))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+
+	// 计算列基于原始列, 结果追加到最后
+	fields := make([]*mysql.Field, 0, len(rs.Fields)+len(t.compute))
+	var keep []int
+	for i, f := range rs.Fields {
+		name := strings.ToLower(string(f.Name))
+		if t.drop[name] {
+			continue
+		}
+		if to, ok := t.rename[name]; ok {
+			nf := *f
+			nf.Name = []byte(to)
+			f = &nf
+		}
+		fields = append(fields, f)
+		keep = append(keep, i)
+	}
+	for _, c := range t.compute {
+		fields = append(fields, &mysql.Field{Name: []byte(c.name), Charset: 33, Type: mysql.TypeVarString})
+	}
+
+	for i, row := range rs.Values {
+		newRow := make([]interface{}, 0, len(fields))
+		for _, j := range keep {
+			newRow = append(newRow, row[j])
+		}
+		for _, c := range t.compute {
+			newRow = append(newRow, c.eval(row, index))
+		}
+		rs.Values[i] = newRow
+	}
+
+	rs.Fields = fields
+	rs.FieldNames = make(map[string]int, len(fields))
+	for i, f := range fields {
+		rs.FieldNames[string(f.Name)] = i
+	}
+}
+
+// eval 引用的列不存在或为NULL时结果为NULL, 与CONCAT一致
+func (c *computedColumn) eval(row []interface{}, index map[string]int) interface{} {
+	var b strings.Builder
+	for i, part := range c.parts {
+		if c.columns[i] == "" {
+			b.WriteString(part)
+			continue
+		}
+		j, ok := index[c.columns[i]]
+		if !ok || row[j] == nil {
+			return nil
+		}
+		b.WriteString(formatExportValue(row[j]))
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pingcap/parser"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestRecordResultTransforms(t *testing.T) {
+	transforms, err := parseResultTransforms([]*models.ResultTransform{
+		{DB: "db_ks", Table: "tbl_user", Drop: []string{"password"}},
+		{DB: "db_ks", Table: "tbl_order", Users: []string{"old_app"}, Rename: map[string]string{"amount": "price"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &Namespace{resultTransforms: transforms}
+
+	tests := []struct {
+		db     string
+		user   string
+		sql    string
+		expect int
+	}{
+		{"db_ks", "app", "select * from tbl_user", 1},
+		{"db_other", "app", "select * from db_ks.TBL_USER", 1},
+		{"db_other", "app", "select * from tbl_user", 0},
+		{"db_ks", "app", "select * from tbl_order", 0},
+		{"db_ks", "old_app", "select * from tbl_order o join tbl_user u on o.uid = u.id", 2},
+		{"db_ks", "app", "update tbl_user set name = 'a'", 0},
+	}
+	p := parser.New()
+	for _, test := range tests {
+		stmt, err := p.ParseOneStmt(test.sql, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqCtx := util.NewRequestContext()
+		recordResultTransforms(reqCtx, ns, stmt, test.db, test.user)
+		matched, _ := reqCtx.Get(util.ResultTransforms).([]*resultTransform)
+		if len(matched) != test.expect {
+			t.Errorf("matched transforms not match, sql: %s, user: %s, expect: %d, actual: %d", test.sql, test.user, test.expect, len(matched))
+		}
+	}
+}
+
+func TestApplyResultTransforms(t *testing.T) {
+	transforms, err := parseResultTransforms([]*models.ResultTransform{
+		{
+			DB:      "db_ks",
+			Table:   "tbl_user",
+			Compute: []*models.ComputedColumn{{Name: "full_name", Expr: "{First_Name} {last_name}"}, {Name: "src", Expr: "v1"}},
+			Drop:    []string{"password", "first_name"},
+			Rename:  map[string]string{"LAST_NAME": "surname"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := mysql.BuildResultset(nil, []string{"id", "first_name", "last_name", "password"}, [][]interface{}{
+		{int64(1), "a", "b", "x"},
+		{int64(2), "c", nil, "y"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &mysql.Result{Resultset: rs}
+	reqCtx := util.NewRequestContext()
+	reqCtx.Set(util.ResultTransforms, transforms)
+	if err := applyResultTransforms(reqCtx, r); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range r.Fields {
+		names = append(names, string(f.Name))
+	}
+	expectNames := []string{"id", "surname", "full_name", "src"}
+	if !reflect.DeepEqual(names, expectNames) {
+		t.Errorf("fields not match, expect: %v, actual: %v", expectNames, names)
+	}
+	if r.FieldNames["full_name"] != 2 {
+		t.Errorf("field names not match, actual: %v", r.FieldNames)
+	}
+	expectValues := [][]interface{}{
+		{int64(1), "b", "a b", "v1"},
+		{int64(2), nil, nil, "v1"},
+	}
+	if !reflect.DeepEqual(r.Values, expectValues) {
+		t.Errorf("values not match, expect: %v, actual: %v", expectValues, r.Values)
+	}
+	if len(r.RowDatas) != 2 {
+		t.Fatalf("row datas not regenerated, actual: %d", len(r.RowDatas))
+	}
+	values, err := r.RowDatas[1].Parse(r.Fields, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[1] != nil || values[2] != nil {
+		t.Errorf("null values not match, actual: %v", values)
+	}
+}
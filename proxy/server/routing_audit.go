@@ -0,0 +1,215 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+	"github.com/XiaoMi/Gaea/util/sync2"
+)
+
+// 迁移或灰度期间, 按candidate_shard_rules再生成一次执行计划, 与shard_rules的路由结果对比, 只记录不执行
+const (
+	defaultRoutingMismatchSamples = 100
+
+	routingAuditMatch    = "match"
+	routingAuditMismatch = "mismatch"
+)
+
+// RoutingMismatch sample of statement routed differently by shard_rules and candidate_shard_rules
+type RoutingMismatch struct {
+	Time      string                         `json:"time"`
+	User      string                         `json:"user"`
+	DB        string                         `json:"db"`
+	SQL       string                         `json:"sql"`
+	Current   map[string]map[string][]string `json:"current"`             // slice -> db -> sqls
+	Candidate map[string]map[string][]string `json:"candidate,omitempty"` // slice -> db -> sqls
+	Error     string                         `json:"error,omitempty"`     // 按新规则生成执行计划的错误
+}
+
+// RoutingAuditStatus routing audit result of namespace, returned by admin api
+type RoutingAuditStatus struct {
+	Compared   int64              `json:"compared"`
+	Mismatched int64              `json:"mismatched"`
+	Samples    []*RoutingMismatch `json:"samples"` // 最近的不一致记录, 按时间从旧到新
+}
+
+type routingAudit struct {
+	router      *router.Router
+	sequences   *sequence.SequenceManager // 空的序列号管理器, 对比时不消耗序列号
+	sampleRate  int64
+	sampleCount sync2.AtomicInt64
+
+	compared   sync2.AtomicInt64
+	mismatched sync2.AtomicInt64
+
+	lock    sync.Mutex
+	samples []*RoutingMismatch // 环形缓冲区
+	next    int
+}
+
+func newRoutingAudit(cfg *models.Namespace) (*routingAudit, error) {
+	candidate := *cfg
+	candidate.ShardRules = cfg.CandidateShardRules
+	rt, err := router.NewRouter(&candidate)
+	if err != nil {
+		return nil, err
+	}
+	return &routingAudit{
+		router:     rt,
+		sequences:  sequence.NewSequenceManager(),
+		sampleRate: int64(cfg.RoutingAuditSampleRate),
+		samples:    make([]*RoutingMismatch, 0, defaultRoutingMismatchSamples),
+	}, nil
+}
+
+// sample return true for one in every sampleRate statements
+func (a *routingAudit) sample() bool {
+	return a.sampleRate <= 1 || a.sampleCount.Add(1)%a.sampleRate == 0
+}
+
+func (a *routingAudit) record(m *RoutingMismatch) {
+	a.mismatched.Add(1)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.samples) < defaultRoutingMismatchSamples {
+		a.samples = append(a.samples, m)
+		return
+	}
+	a.samples[a.next] = m
+	a.next = (a.next + 1) % defaultRoutingMismatchSamples
+}
+
+func (a *routingAudit) status() *RoutingAuditStatus {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	samples := make([]*RoutingMismatch, 0, len(a.samples))
+	samples = append(samples, a.samples[a.next:]...)
+	samples = append(samples, a.samples[:a.next]...)
+	return &RoutingAuditStatus{
+		Compared:   a.compared.Get(),
+		Mismatched: a.mismatched.Get(),
+		Samples:    samples,
+	}
+}
+
+// compare 按新规则重新解析并生成执行计划, 与当前执行计划的路由结果对比, 返回不一致的记录, 无法对比时返回nil
+func (a *routingAudit) compare(ns *Namespace, sqlMode mysql.SQLMode, db, sql string, p plan.Plan) *RoutingMismatch {
+	// 使用了全局序列号的INSERT按新规则无法得到相同的分片键
+	if ip, ok := p.(*plan.InsertPlan); ok && ip.UsesGlobalSequence() {
+		return nil
+	}
+	_, current, err := plan.GetPlanSQLs(p, ns.GetPhysicalDBs())
+	if err != nil {
+		return nil
+	}
+	a.compared.Add(1)
+
+	candidate, err := a.buildCandidateSQLs(ns, sqlMode, db, sql)
+	if err == nil && reflect.DeepEqual(current, candidate) {
+		return nil
+	}
+	m := &RoutingMismatch{
+		Time:      time.Now().Format("2006-01-02 15:04:05.000"),
+		DB:        db,
+		SQL:       ns.redactSQL(sql),
+		Current:   redactRoutingSQLs(ns, current),
+		Candidate: redactRoutingSQLs(ns, candidate),
+	}
+	if err != nil {
+		m.Error = ns.redactError(sql, err)
+	}
+	return m
+}
+
+func (a *routingAudit) buildCandidateSQLs(ns *Namespace, sqlMode mysql.SQLMode, db, sql string) (map[string]map[string][]string, error) {
+	// 当前执行计划的语法树已被改写, 需要重新解析
+	sqlParser := parser.NewSQLParser()
+	sqlParser.SetSQLMode(sqlMode)
+	stmt, err := sqlParser.ParseOneStmt(sql)
+	if err != nil {
+		return nil, err
+	}
+	if err := rewriteViews(ns, db, stmt); err != nil {
+		return nil, err
+	}
+	rewriteMaterializedViews(ns, db, stmt)
+	p, err := plan.BuildPlanWithSQLMode(stmt, ns.GetPhysicalDBs(), db, sql, a.router, a.sequences, sqlMode)
+	if err != nil {
+		return nil, err
+	}
+	_, sqls, err := plan.GetPlanSQLs(p, ns.GetPhysicalDBs())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported candidate plan, %w", err)
+	}
+	return sqls, nil
+}
+
+func redactRoutingSQLs(ns *Namespace, sqls map[string]map[string][]string) map[string]map[string][]string {
+	if sqls == nil {
+		return nil
+	}
+	ret := make(map[string]map[string][]string, len(sqls))
+	for slice, dbSQLs := range sqls {
+		ret[slice] = make(map[string][]string, len(dbSQLs))
+		for db, tableSQLs := range dbSQLs {
+			for _, s := range tableSQLs {
+				ret[slice][db] = append(ret[slice][db], ns.redactSQL(s))
+			}
+		}
+	}
+	return ret
+}
+
+// auditRouting 对比语句在新旧分片规则下的路由结果, 不一致时记录样本并告警
+func (se *SessionExecutor) auditRouting(ns *Namespace, db, sql string, p plan.Plan) {
+	a := ns.routingAudit
+	if a == nil || !a.sample() {
+		return
+	}
+	m := a.compare(ns, se.sqlMode, db, sql, p)
+	result := routingAuditMatch
+	if m != nil {
+		result = routingAuditMismatch
+		m.User = se.user
+		a.record(m)
+		exeLogger.Warnf("routing mismatch between shard rules and candidate shard rules, ns: %s, user: %s, sql: %s, current: %v, candidate: %v, err: %s",
+			ns.GetName(), se.user, m.SQL, m.Current, m.Candidate, m.Error)
+	}
+	if se.manager != nil {
+		se.manager.GetStatisticManager().RecordRoutingAudit(ns.GetName(), result)
+	}
+}
+
+// GetRoutingAuditStatus return routing audit result of namespace
+func (m *Manager) GetRoutingAuditStatus(namespace string) (*RoutingAuditStatus, error) {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+	if ns.routingAudit == nil {
+		return nil, fmt.Errorf("candidate shard rules not configured in namespace: %s", namespace)
+	}
+	return ns.routingAudit.status(), nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+)
+
+func newRoutingAuditNamespace(t *testing.T) *Namespace {
+	cfg := &models.Namespace{
+		Name:          "ns",
+		Slices:        []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice:  "slice-0",
+		DefaultPhyDBS: map[string]string{"db_ks": "db_ks"},
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: "mod", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		},
+		CandidateShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: "mod", Key: "id", Locations: []int{1, 3}, Slices: []string{"slice-0", "slice-1"}},
+		},
+	}
+	rt, err := router.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := newRoutingAudit(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Namespace{name: cfg.Name, router: rt, defaultPhyDBs: cfg.DefaultPhyDBS, routingAudit: a}
+}
+
+func TestRoutingAuditCompare(t *testing.T) {
+	ns := newRoutingAuditNamespace(t)
+	tests := []struct {
+		sql      string
+		mismatch bool
+	}{
+		{"select * from tbl_ks where id = 2", false},
+		{"select * from tbl_ks where id = 1", true},
+		{"update tbl_ks set a = 1 where id = 5", true},
+		{"delete from tbl_ks where id = 6", false},
+		{"select * from tbl_ks", true}, // 全表扫描时分表所在的slice不同
+		{"select * from tbl_unshard where id = 1", false},
+	}
+	for _, test := range tests {
+		stmt, err := parser.NewSQLParser().ParseOneStmt(test.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := plan.BuildPlanWithSQLMode(stmt, ns.GetPhysicalDBs(), "db_ks", test.sql, ns.router, sequence.NewSequenceManager(), mysql.ModeNone)
+		if err != nil {
+			t.Fatalf("build plan error, sql: %s, err: %v", test.sql, err)
+		}
+		m := ns.routingAudit.compare(ns, mysql.ModeNone, "db_ks", test.sql, p)
+		if (m != nil) != test.mismatch {
+			t.Errorf("routing audit result not match, sql: %s, expect mismatch: %v, actual: %+v", test.sql, test.mismatch, m)
+		}
+		if m != nil && (m.Current["slice-0"] == nil || m.Candidate["slice-1"] == nil || m.Error != "") {
+			t.Errorf("unexpected mismatch sample, sql: %s, sample: %+v", test.sql, m)
+		}
+	}
+	if compared := ns.routingAudit.compared.Get(); compared != int64(len(tests)) {
+		t.Errorf("compared count not match, expect: %d, actual: %d", len(tests), compared)
+	}
+}
+
+func TestRoutingAuditSamples(t *testing.T) {
+	a := &routingAudit{}
+	for i := 0; i < defaultRoutingMismatchSamples+10; i++ {
+		a.record(&RoutingMismatch{DB: string(rune('a' + i%26))})
+	}
+	status := a.status()
+	if status.Mismatched != defaultRoutingMismatchSamples+10 || len(status.Samples) != defaultRoutingMismatchSamples {
+		t.Fatalf("unexpected status, mismatched: %d, samples: %d", status.Mismatched, len(status.Samples))
+	}
+	// 最旧的样本是第11条
+	if status.Samples[0].DB != string(rune('a'+10)) {
+		t.Errorf("samples should be ordered from oldest, first: %s", status.Samples[0].DB)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// RowChangeEvent is the event of rows changed by a successful single table DML statement
+type RowChangeEvent struct {
+	Namespace      string
+	DB             string        // 逻辑库名
+	Table          string        // 逻辑表名
+	Operation      string        // insert, replace, update, delete
+	ShardingColumn string        // 非分片表和全局表为空
+	ShardingValues []interface{} // 分片列的插入值或等值条件, 无法确定时为空
+	AffectedRows   uint64
+	InTransaction  bool // 语句在事务中执行, 事务之后可能回滚
+}
+
+// RowChangeHook is called after DML statement executed successfully, it's called synchronously in session goroutine, so it should not block.
+// It can be used to publish cache invalidation messages or domain events.
+type RowChangeHook func(event *RowChangeEvent)
+
+var rowChangeHooks = struct {
+	sync.RWMutex
+	hooks map[string]RowChangeHook
+}{hooks: make(map[string]RowChangeHook)}
+
+// RegisterRowChangeHook register hook with name, the hook registered with the same name is replaced
+func RegisterRowChangeHook(name string, hook RowChangeHook) {
+	rowChangeHooks.Lock()
+	defer rowChangeHooks.Unlock()
+	rowChangeHooks.hooks[name] = hook
+}
+
+// UnregisterRowChangeHook remove hook with name
+func UnregisterRowChangeHook(name string) {
+	rowChangeHooks.Lock()
+	defer rowChangeHooks.Unlock()
+	delete(rowChangeHooks.hooks, name)
+}
+
+func hasRowChangeHooks() bool {
+	rowChangeHooks.RLock()
+	defer rowChangeHooks.RUnlock()
+	return len(rowChangeHooks.hooks) != 0
+}
+
+// recordRowChange 在生成执行计划前分析语句, 没有注册hook时不做分析
+func recordRowChange(reqCtx *util.RequestContext, stmt ast.StmtNode, db string, rt *router.Router) {
+	if !hasRowChangeHooks() {
+		return
+	}
+	rc, err := plan.GetRowChange(stmt, db, rt)
+	if err != nil {
+		exeLogger.Warnf("get row change error, db: %s, err: %v", db, err)
+		return
+	}
+	if rc != nil {
+		reqCtx.Set(util.RowChange, rc)
+	}
+}
+
+func (se *SessionExecutor) fireRowChangeHooks(reqCtx *util.RequestContext, r *mysql.Result) {
+	rc, ok := reqCtx.Get(util.RowChange).(*plan.RowChange)
+	if !ok || r == nil || r.AffectedRows == 0 {
+		return
+	}
+	event := &RowChangeEvent{
+		Namespace:      se.namespace,
+		DB:             rc.DB,
+		Table:          rc.Table,
+		Operation:      rc.Operation,
+		ShardingColumn: rc.ShardingColumn,
+		ShardingValues: rc.ShardingValues,
+		AffectedRows:   r.AffectedRows,
+		InTransaction:  se.isInTransaction(),
+	}
+
+	rowChangeHooks.RLock()
+	defer rowChangeHooks.RUnlock()
+	for name, hook := range rowChangeHooks.hooks {
+		callRowChangeHook(name, hook, event)
+	}
+}
+
+// hook panic不影响语句的执行结果
+func callRowChangeHook(name string, hook RowChangeHook, event *RowChangeEvent) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			exeLogger.Warnf("row change hook %s panic, error: %v, stack: %s", name, e, string(buf))
+		}
+	}()
+	hook(event)
+}
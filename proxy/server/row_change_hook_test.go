@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestFireRowChangeHooks(t *testing.T) {
+	var events []*RowChangeEvent
+	RegisterRowChangeHook("test", func(event *RowChangeEvent) {
+		events = append(events, event)
+	})
+	RegisterRowChangeHook("test_panic", func(event *RowChangeEvent) {
+		panic("hook panic")
+	})
+	defer UnregisterRowChangeHook("test")
+	defer UnregisterRowChangeHook("test_panic")
+
+	se := &SessionExecutor{namespace: "test_namespace", status: initClientConnStatus}
+	reqCtx := util.NewRequestContext()
+	rc := &plan.RowChange{DB: "db_ks", Table: "tbl_ks", Operation: plan.RowChangeUpdate, ShardingColumn: "id", ShardingValues: []interface{}{int64(1)}}
+	reqCtx.Set(util.RowChange, rc)
+
+	// 没有修改行时不触发
+	se.fireRowChangeHooks(reqCtx, &mysql.Result{})
+	if len(events) != 0 {
+		t.Fatalf("hook should not be called when no rows affected")
+	}
+
+	se.fireRowChangeHooks(reqCtx, &mysql.Result{AffectedRows: 2})
+	expect := &RowChangeEvent{
+		Namespace:      "test_namespace",
+		DB:             "db_ks",
+		Table:          "tbl_ks",
+		Operation:      plan.RowChangeUpdate,
+		ShardingColumn: "id",
+		ShardingValues: []interface{}{int64(1)},
+		AffectedRows:   2,
+	}
+	if len(events) != 1 || !reflect.DeepEqual(events[0], expect) {
+		t.Errorf("event not equal, expect: %+v, actual: %+v", expect, events)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// 采样日志记录被采样请求的完整上下文: SQL, 执行计划, 每个分片的耗时和行数
+var sampleLogger = logging.GetLogger("sample")
+
+// sampleTrace collect execution details of a sampled request
+type sampleTrace struct {
+	lock     sync.Mutex
+	plan     plan.Plan
+	backends []*backendSample
+}
+
+type backendSample struct {
+	Slice        string `json:"slice"`
+	Addr         string `json:"addr"`
+	SQL          string `json:"sql"`
+	CostUs       int64  `json:"cost_us"`
+	Rows         int    `json:"rows"`
+	AffectedRows uint64 `json:"affected_rows"`
+	Err          string `json:"err,omitempty"`
+}
+
+func getSampleTrace(reqCtx *util.RequestContext) *sampleTrace {
+	t, _ := reqCtx.Get(util.SampleTrace).(*sampleTrace)
+	return t
+}
+
+func recordPlanSample(reqCtx *util.RequestContext, p plan.Plan) {
+	t := getSampleTrace(reqCtx)
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	t.plan = p
+	t.lock.Unlock()
+}
+
+// recordBackendSample 可能在多个分片的goroutine中并发调用
+func recordBackendSample(reqCtx *util.RequestContext, slice, addr, sql string, startTime time.Time, r *mysql.Result, err error) {
+	t := getSampleTrace(reqCtx)
+	p := getQueryProfile(reqCtx)
+	if t == nil && p == nil {
+		return
+	}
+	s := &backendSample{
+		Slice:  slice,
+		Addr:   addr,
+		SQL:    sql,
+		CostUs: time.Since(startTime).Microseconds(),
+	}
+	if r != nil {
+		s.AffectedRows = r.AffectedRows
+		if r.Resultset != nil {
+			s.Rows = r.RowNumber()
+		}
+	}
+	if err != nil {
+		s.Err = err.Error()
+	}
+	if p != nil {
+		p.add(s)
+	}
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	t.backends = append(t.backends, s)
+	t.lock.Unlock()
+}
+
+// shouldSample check if request should be sampled, by session or by statement
+func (se *SessionExecutor) shouldSample(ns *Namespace) bool {
+	return se.sampled || ns.sampleSQL()
+}
+
+func (se *SessionExecutor) logSample(reqCtx *util.RequestContext, sql string, startTime time.Time, r *mysql.Result, err error) {
+	t := getSampleTrace(reqCtx)
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var rows int
+	var affectedRows uint64
+	if r != nil {
+		affectedRows = r.AffectedRows
+		if r.Resultset != nil {
+			rows = r.RowNumber()
+		}
+	}
+	ns := se.GetNamespace()
+	var planDesc []byte
+	if t.plan != nil {
+		if desc, e := plan.Describe(t.plan); e == nil {
+			for _, target := range desc.Targets {
+				for i, s := range target.SQLs {
+					target.SQLs[i] = ns.redactSQL(s)
+				}
+			}
+			planDesc, _ = json.Marshal(desc)
+		}
+	}
+	redactedBackends := make([]backendSample, 0, len(t.backends))
+	for _, b := range t.backends {
+		redacted := *b
+		redacted.SQL = ns.redactSQL(b.SQL)
+		redactedBackends = append(redactedBackends, redacted)
+	}
+	backends, _ := json.Marshal(redactedBackends)
+	sampleLogger.Infof("namespace: %s, conn: %d, client: %s, user: %s, db: %s, sql: %s, cost: %d us, rows: %d, affected: %d, err: %s, plan: %s, backends: %s",
+		se.namespace, se.connID, se.clientAddr, se.user, se.db, ns.redactSQL(sql), time.Since(startTime).Microseconds(),
+		rows, affectedRows, ns.redactError(sql, err), planDesc, backends)
+}
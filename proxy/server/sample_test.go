@@ -0,0 +1,65 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+func TestNamespaceSampleRate(t *testing.T) {
+	ns := &Namespace{sampleSessionRate: 3}
+	var sampled int
+	for i := 0; i < 9; i++ {
+		if ns.sampleSession() {
+			sampled++
+		}
+		if ns.sampleSQL() {
+			t.Fatal("sql sample should be disabled")
+		}
+	}
+	if sampled != 3 {
+		t.Errorf("sampled sessions not match, expect: 3, actual: %d", sampled)
+	}
+}
+
+func TestRecordBackendSample(t *testing.T) {
+	reqCtx := util.NewRequestContext()
+	// 未采样时不记录
+	recordBackendSample(reqCtx, "slice-0", "127.0.0.1:3306", "select 1", time.Now(), nil, nil)
+	if getSampleTrace(reqCtx) != nil {
+		t.Fatal("trace should be nil for request not sampled")
+	}
+
+	reqCtx.Set(util.SampleTrace, &sampleTrace{})
+	r := &mysql.Result{Resultset: &mysql.Resultset{Values: [][]interface{}{{1}, {2}}}}
+	recordBackendSample(reqCtx, "slice-0", "127.0.0.1:3306", "select 1", time.Now(), r, nil)
+	recordBackendSample(reqCtx, "slice-1", "127.0.0.1:3307", "select 1", time.Now(), nil, errors.New("timeout"))
+
+	backends := getSampleTrace(reqCtx).backends
+	if len(backends) != 2 {
+		t.Fatalf("backend samples not match, expect: 2, actual: %d", len(backends))
+	}
+	if backends[0].Rows != 2 || backends[0].Err != "" {
+		t.Errorf("first backend sample not match: %+v", backends[0])
+	}
+	if backends[1].Slice != "slice-1" || backends[1].Err != "timeout" {
+		t.Errorf("second backend sample not match: %+v", backends[1])
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// errQueryInterrupted 会话关闭时中断后端查询返回的错误
+var errQueryInterrupted = mysql.NewError(mysql.ErrQueryInterrupted, "query execution was interrupted, client connection closed")
+
+// runScatter run task i in its own goroutine for i in [0, n), and always waits all goroutines exit before return.
+// When the first task returns error, interrupt is called with abort false for unfinished tasks to stop their executing
+// statements, and the error is returned. When ctx is done before all tasks finish, interrupt is called with abort true
+// for unfinished tasks to interrupt blocked backend reads, and ctx.Err() is returned.
+// A panic in task is recovered and returned as error instead of crashing the proxy.
+func runScatter(ctx context.Context, n int, task func(i int) error, interrupt func(i int, abort bool)) error {
+	var wg sync.WaitGroup
+	finished := make([]int32, n)
+	var panicErr atomic.Value
+	taskErrs := make(chan error, n)
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			defer atomic.StoreInt32(&finished[i], 1)
+			defer func() {
+				if e := recover(); e != nil {
+					buf := make([]byte, 4096)
+					buf = buf[:runtime.Stack(buf, false)]
+					exeLogger.Warnf("scatter task panic, error: %v, stack: %s", e, string(buf))
+					panicErr.Store(fmt.Errorf("scatter task panic: %v", e))
+				}
+			}()
+			if err := task(i); err != nil {
+				taskErrs <- err
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// 并发中断各任务, 避免逐个发送KILL QUERY时等待时间累加
+	interruptUnfinished := func(abort bool) {
+		var iwg sync.WaitGroup
+		for i := range finished {
+			if atomic.LoadInt32(&finished[i]) == 0 {
+				iwg.Add(1)
+				go func(i int) {
+					defer iwg.Done()
+					interrupt(i, abort)
+				}(i)
+			}
+		}
+		iwg.Wait()
+	}
+
+	// 中断后仍然等待所有goroutine退出, 保证连接不再被使用后才回收
+	var firstErr, ctxErr error
+	ctxDone := ctx.Done()
+	for waiting := true; waiting; {
+		select {
+		case <-done:
+			waiting = false
+		case err := <-taskErrs:
+			if firstErr == nil {
+				firstErr = err
+				interruptUnfinished(false)
+			}
+		case <-ctxDone:
+			ctxDone = nil
+			ctxErr = ctx.Err()
+			interruptUnfinished(true)
+		}
+	}
+	if firstErr == nil {
+		select {
+		case firstErr = <-taskErrs:
+		default:
+		}
+	}
+
+	if e, ok := panicErr.Load().(error); ok {
+		return e
+	}
+	if ctxErr != nil {
+		return ctxErr
+	}
+	return firstErr
+}
+
+// killBackendQuery terminate the executing statement of pc by KILL QUERY, and close pc if abort is true.
+// KILL QUERY is sent before closing, otherwise the statement keeps running in backend after the connection is closed.
+func killBackendQuery(pc backend.PooledConnect, abort bool) {
+	if err := pc.KillQuery(); err != nil {
+		exeLogger.Warnf("kill query of backend connection error, addr: %s, err: %v", pc.GetAddr(), err)
+	}
+	if abort {
+		pc.Abort()
+	}
+}
+
+// interruptOnCancel terminate the executing statement of pc and close pc when ctx is done.
+// The returned stop must be called after execution, it waits the interruption finishes, so pc is no longer used
+// by the watcher and can be safely recycled after stop returns.
+func interruptOnCancel(ctx context.Context, pc backend.PooledConnect) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stopped := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			killBackendQuery(pc, true)
+		case <-stopped:
+		}
+	}()
+	return func() {
+		close(stopped)
+		<-exited
+	}
+}
+
+// context return context of session, which is canceled when session is closed
+func (se *SessionExecutor) context() context.Context {
+	if se.ctx == nil {
+		return context.Background()
+	}
+	return se.ctx
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/stats"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/cache"
+)
+
+// checkGoroutineLeak 检查测试结束后goroutine数量恢复到测试开始前
+func checkGoroutineLeak(t *testing.T) func() {
+	before := runtime.NumGoroutine()
+	return func() {
+		deadline := time.Now().Add(time.Second)
+		for {
+			after := runtime.NumGoroutine()
+			if after <= before {
+				return
+			}
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<16)
+				buf = buf[:runtime.Stack(buf, true)]
+				t.Fatalf("goroutine leak, before: %d, after: %d\n%s", before, after, buf)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestRunScatter(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	var count int32
+	err := runScatter(context.Background(), 4, func(i int) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	}, func(i int, abort bool) {
+		t.Errorf("task %d should not be interrupted", i)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expect 4 tasks run, got: %d", count)
+	}
+}
+
+func TestRunScatterCancel(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// 任务1一直阻塞直到被中断, 模拟读取后端结果时阻塞
+	blocked := make(chan struct{})
+	finished := make(chan struct{})
+	var aborted int32
+	go func() {
+		<-finished
+		// 等待任务0的goroutine退出后再取消
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err := runScatter(ctx, 2, func(i int) error {
+		if i == 0 {
+			close(finished)
+			return nil
+		}
+		<-blocked
+		return nil
+	}, func(i int, abort bool) {
+		if i != 1 || !abort {
+			t.Errorf("finished task %d should not be interrupted, abort: %v", i, abort)
+			return
+		}
+		atomic.AddInt32(&aborted, 1)
+		close(blocked)
+	})
+	if err != context.Canceled {
+		t.Errorf("expect context canceled, got: %v", err)
+	}
+	if aborted != 1 {
+		t.Errorf("expect blocked task aborted once, got: %d", aborted)
+	}
+}
+
+func TestRunScatterPanic(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	var count int32
+	err := runScatter(context.Background(), 3, func(i int) error {
+		if i == 1 {
+			panic("slice panic")
+		}
+		atomic.AddInt32(&count, 1)
+		return nil
+	}, func(i int, abort bool) {})
+	if err == nil {
+		t.Fatal("expect panic error")
+	}
+	if count != 2 {
+		t.Errorf("other tasks should finish, got: %d", count)
+	}
+}
+
+func TestRunScatterFirstError(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	// 任务0出错, 任务1阻塞直到被终止, 模拟后端执行慢查询
+	taskErr := errors.New("slice error")
+	killed := make(chan struct{})
+	var interrupted int32
+	err := runScatter(context.Background(), 2, func(i int) error {
+		if i == 0 {
+			return taskErr
+		}
+		<-killed
+		return errors.New("query execution was interrupted")
+	}, func(i int, abort bool) {
+		if i != 1 || abort {
+			t.Errorf("only running task should be killed without abort, task: %d, abort: %v", i, abort)
+			return
+		}
+		atomic.AddInt32(&interrupted, 1)
+		close(killed)
+	})
+	if err != taskErr {
+		t.Errorf("expect first error returned, got: %v", err)
+	}
+	if interrupted != 1 {
+		t.Errorf("expect running task killed once, got: %d", interrupted)
+	}
+}
+
+func TestKillBackendQuery(t *testing.T) {
+	tests := []struct {
+		abort   bool
+		killErr error
+	}{
+		{abort: false},
+		{abort: true},
+		{abort: true, killErr: errors.New("get conn timeout")},
+	}
+	for _, test := range tests {
+		pc := new(mocks.PooledConnect)
+		pc.On("KillQuery").Return(test.killErr).Once()
+		pc.On("GetAddr").Return("127.0.0.1:3306").Maybe()
+		if test.abort {
+			pc.On("Abort").Return().Once()
+		}
+		killBackendQuery(pc, test.abort)
+		pc.AssertExpectations(t)
+	}
+}
+
+func newExecuteInSliceExecutor() *SessionExecutor {
+	ns := &Namespace{
+		name:                 "test_namespace",
+		backendSlowSQLCache:  cache.NewLRUCache(defaultSQLCacheCapacity),
+		backendErrorSQLCache: cache.NewLRUCache(defaultSQLCacheCapacity),
+	}
+	m := newTestManager(ns)
+	m.statistics = &StatisticManager{
+		clusterName:                      "gaea_cluster",
+		slowSQLTime:                      1000,
+		backendSQLTimings:                stats.NewMultiTimings("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation}),
+		backendSQLTypeTimings:            stats.NewMultiTimings("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelSlice, statsLabelStmtType}),
+		backendSQLErrorCounts:            stats.NewCountersWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelOperation}),
+		backendSQLFingerprintErrorCounts: stats.NewCountersWithMultiLabels("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelFingerprint}),
+	}
+	se := newSessionExecutor(m)
+	se.namespace = ns.name
+	return se
+}
+
+func TestExecuteInSliceCancel(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	const sql = "select sleep(10)"
+	se := newExecuteInSliceExecutor()
+
+	// 后端语句一直执行直到被KILL QUERY终止
+	killed := make(chan struct{})
+	pc := new(mocks.PooledConnect)
+	pc.On("Execute", sql).Run(func(mock.Arguments) { <-killed }).Return(nil, mysql.NewDefaultError(mysql.ErrQueryInterrupted))
+	pc.On("KillQuery").Run(func(mock.Arguments) { close(killed) }).Return(nil).Once()
+	pc.On("Abort").Return().Once()
+	pc.On("GetAddr").Return("127.0.0.1:3306")
+
+	// 模拟执行期间客户端断开
+	time.AfterFunc(50*time.Millisecond, se.cancel)
+	_, err := se.executeInSlice(se.context(), util.NewRequestContext(), pc, backend.DefaultSlice, sql)
+	if err != errQueryInterrupted {
+		t.Errorf("expect query interrupted, got: %v", err)
+	}
+	pc.AssertExpectations(t)
+}
+
+func TestExecuteInSliceNotCanceled(t *testing.T) {
+	defer checkGoroutineLeak(t)()
+
+	const sql = "select 1"
+	se := newExecuteInSliceExecutor()
+	pc := new(mocks.PooledConnect)
+	pc.On("Execute", sql).Return(&mysql.Result{}, nil).Once()
+	pc.On("GetAddr").Return("127.0.0.1:3306")
+
+	rs, err := se.executeInSlice(se.context(), util.NewRequestContext(), pc, backend.DefaultSlice, sql)
+	if err != nil || len(rs) != 1 {
+		t.Fatalf("execute failed, result: %v, err: %v", rs, err)
+	}
+	pc.AssertExpectations(t)
+	pc.AssertNotCalled(t, "KillQuery")
+	pc.AssertNotCalled(t, "Abort")
+}
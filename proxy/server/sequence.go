@@ -0,0 +1,112 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/provider"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+)
+
+// SequenceStatus status of global sequence, returned by admin api
+type SequenceStatus struct {
+	DB      string                  `json:"db"`
+	Table   string                  `json:"table"`
+	Name    string                  `json:"name"`
+	PKName  string                  `json:"pk_name"`
+	Curr    int64                   `json:"curr"` // 本地号段中最后发出的序列号
+	Max     int64                   `json:"max"`  // 本地号段的最大值
+	Segment *models.SequenceSegment `json:"segment"`
+}
+
+// initSequenceSegmentStore 使用etcd时将号段分配记录持久化到配置中心
+func (m *Manager) initSequenceSegmentStore(cfg *models.Proxy) {
+	if cfg.ConfigType != provider.ConfigEtcd {
+		return
+	}
+	client := provider.NewClient(provider.ConfigEtcd, cfg.CoordinatorAddr, cfg.UserName, cfg.Password, cfg.CoordinatorRoot)
+	if client == nil {
+		return
+	}
+	m.sequenceStore = provider.NewStore(client)
+	hostname, _ := os.Hostname()
+	sequence.SetSegmentStore(m.sequenceStore, hostname+"-"+cfg.ProxyAddr)
+}
+
+func (m *Manager) closeSequenceSegmentStore() {
+	if m.sequenceStore == nil {
+		return
+	}
+	sequence.SetSegmentStore(nil, "")
+	m.sequenceStore.Close()
+}
+
+// GetSequenceStatus return status of all global sequences in namespace
+func (m *Manager) GetSequenceStatus(namespace string) ([]*SequenceStatus, error) {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+
+	var ret []*SequenceStatus
+	for key, seq := range ns.GetSequences().GetAllSequences() {
+		mysqlSeq, ok := seq.(*sequence.MySQLSequence)
+		if !ok {
+			continue
+		}
+		dbTable := strings.SplitN(key, ".", 2)
+		status := &SequenceStatus{
+			DB:     dbTable[0],
+			Table:  dbTable[1],
+			Name:   mysqlSeq.GetName(),
+			PKName: mysqlSeq.GetPKName(),
+		}
+		status.Curr, status.Max = mysqlSeq.Status()
+		if m.sequenceStore != nil {
+			segment, err := m.sequenceStore.LoadSequenceSegment(namespace, status.Name)
+			if err != nil {
+				return nil, err
+			}
+			status.Segment = segment
+		}
+		ret = append(ret, status)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// AdvanceSequence advance global sequence of db.table to value, ids issued later are greater than value
+func (m *Manager) AdvanceSequence(namespace, db, table string, value int64) error {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return fmt.Errorf("namespace not found: %s", namespace)
+	}
+	seq, ok := ns.GetSequences().GetSequence(db, table)
+	if !ok {
+		return fmt.Errorf("sequence not found: %s.%s", db, table)
+	}
+	mysqlSeq, ok := seq.(*sequence.MySQLSequence)
+	if !ok {
+		return fmt.Errorf("sequence %s.%s does not support advance", db, table)
+	}
+	return mysqlSeq.Advance(value)
+}
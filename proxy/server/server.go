@@ -21,6 +21,7 @@ import (
 	"net"
 	"runtime"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"fmt"
@@ -33,6 +34,8 @@ import (
 var (
 	timeWheelUnit       = time.Second * 1
 	timeWheelBucketsNum = 3600
+
+	rejectConnWriteTimeout = time.Second * 1
 )
 
 // Server means proxy that serve client request
@@ -44,6 +47,31 @@ type Server struct {
 	adminServer    *AdminServer
 	manager        *Manager
 	EncryptKey     string
+	environ        string
+	mariadbCompat  bool
+	outfileDir     string
+	diagnosticDir  string
+	captureDir     string // 流量录制文件只能写入该目录, 为空时禁止录制
+	healthCheck    bool   // 连接池校验语句由gaea直接返回
+	connWorkers    *connWorkerPool
+	connLimiter    *connLimiter
+	userProvider   UserProvider         // 前端用户来源, 默认为namespace配置中的users
+	proxyProtocol  *proxyProtocolConfig // 为nil时不解析PROXY protocol头
+
+	compressCapability uint32 // 握手时声明支持的压缩协议, 为0时不支持压缩
+
+	stateSnapshotPath string // 退出时保存状态快照的文件, 为空时不保存
+
+	connReadTimeout          time.Duration
+	connWriteTimeout         time.Duration
+	idleInTransactionTimeout time.Duration
+	clientCheckInterval      time.Duration // 执行命令期间检测客户端断开的间隔, 0表示不检测
+
+	sessions     *sessionSet
+	draining     sync2.AtomicBool
+	drainTimeout time.Duration // 退出时等待进行中的事务结束的时间, 0表示不等待
+
+	writeBuffering atomic.Value // WriteBuffering, 可在运行时修改
 }
 
 // NewServer create new server
@@ -53,9 +81,23 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 
 	// init key
 	s.EncryptKey = cfg.EncryptKey
+	s.environ = cfg.Environ
+	s.mariadbCompat = cfg.MariaDBCompat
+	s.outfileDir = cfg.OutfileDir
+	s.diagnosticDir = cfg.DiagnosticDir
+	s.captureDir = cfg.CaptureDir
+	s.healthCheck = cfg.HealthCheckFastPath
 
 	s.manager = manager
 
+	// 恢复上次退出时保存的状态, 失败时不影响启动
+	s.stateSnapshotPath = cfg.StateSnapshotPath
+	if s.stateSnapshotPath != "" {
+		if err := manager.LoadStateSnapshot(s.stateSnapshotPath); err != nil {
+			logging.DefaultLogger.Warnf("load state snapshot failed, path: %s, err: %v", s.stateSnapshotPath, err)
+		}
+	}
+
 	// if error occurs, recycle the resources during creation.
 	defer func() {
 		if e := recover(); e != nil {
@@ -68,8 +110,43 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 	}()
 
 	s.closed = sync2.NewAtomicBool(false)
+	s.sessions = newSessionSet()
+
+	tcpOptions, err := parseProxyTCPOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := newMultiListener(cfg.ProtoType, cfg.ProxyAddr, tcpOptions)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+
+	if cfg.MaxConnWorkers < 0 || cfg.ConnQueueSize < 0 || cfg.ConnQueueTimeout < 0 {
+		err = fmt.Errorf("invalid conn worker options, max_conn_workers: %d, conn_queue_size: %d, conn_queue_timeout: %d",
+			cfg.MaxConnWorkers, cfg.ConnQueueSize, cfg.ConnQueueTimeout)
+		return nil, err
+	}
+	s.proxyProtocol, err = parseProxyProtocolConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.connWorkers = newConnWorkerPool(cfg.MaxConnWorkers, cfg.ConnQueueSize, time.Duration(cfg.ConnQueueTimeout)*time.Millisecond)
+
+	if cfg.MaxConnections < 0 || cfg.MaxConnectionsPerUser < 0 {
+		err = fmt.Errorf("invalid max connections, max_connections: %d, max_connections_per_user: %d",
+			cfg.MaxConnections, cfg.MaxConnectionsPerUser)
+		return nil, err
+	}
+	s.connLimiter = newConnLimiter(cfg.MaxConnections, cfg.MaxConnectionsPerUser)
 
-	s.listener, err = net.Listen(cfg.ProtoType, cfg.ProxyAddr)
+	s.compressCapability, err = parseCompressCapability(cfg.ProtocolCompressionAlgorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	s.userProvider, err = NewUserProvider(cfg, manager)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +158,35 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 		return nil, err
 	}
 
+	if cfg.ConnReadTimeout < 0 || cfg.ConnWriteTimeout < 0 || cfg.IdleInTransactionTimeout < 0 {
+		err = fmt.Errorf("invalid conn timeouts, conn_read_timeout: %d, conn_write_timeout: %d, idle_in_transaction_timeout: %d",
+			cfg.ConnReadTimeout, cfg.ConnWriteTimeout, cfg.IdleInTransactionTimeout)
+		return nil, err
+	}
+	s.connReadTimeout = time.Duration(cfg.ConnReadTimeout) * time.Second
+	s.connWriteTimeout = time.Duration(cfg.ConnWriteTimeout) * time.Second
+	s.idleInTransactionTimeout = time.Duration(cfg.IdleInTransactionTimeout) * time.Second
+
+	switch {
+	case cfg.ClientCheckInterval == 0:
+		s.clientCheckInterval = defaultClientCheckInterval
+	case cfg.ClientCheckInterval > 0:
+		s.clientCheckInterval = time.Duration(cfg.ClientCheckInterval) * time.Millisecond
+	case cfg.ClientCheckInterval < -1:
+		err = fmt.Errorf("invalid client_check_interval: %d", cfg.ClientCheckInterval)
+		return nil, err
+	}
+
+	if cfg.ShutdownDrainTimeout < 0 {
+		err = fmt.Errorf("invalid shutdown_drain_timeout: %d", cfg.ShutdownDrainTimeout)
+		return nil, err
+	}
+	s.drainTimeout = time.Duration(cfg.ShutdownDrainTimeout) * time.Second
+
+	if err = s.SetWriteBuffering(WriteBuffering{BufferSize: cfg.WriteBufferSize, FlushDelay: cfg.FlushDelay}); err != nil {
+		return nil, err
+	}
+
 	s.tw, err = util.NewTimeWheel(timeWheelUnit, timeWheelBucketsNum)
 	if err != nil {
 		return nil, err
@@ -95,17 +201,112 @@ func NewServer(cfg *models.Proxy, manager *Manager) (*Server, error) {
 	}
 	s.adminServer = adminServer
 
-	logging.DefaultLogger.Infof("server start succ, netProtoType: %s, addr: %s", cfg.ProtoType, cfg.ProxyAddr)
+	logging.DefaultLogger.Infof("server start succ, netProtoType: %s, addr: %s", cfg.ProtoType, s.listener.Addr().String())
 	return s, nil
 }
 
+func parseProxyTCPOptions(cfg *models.Proxy) (util.TCPOptions, error) {
+	opts := util.DefaultTCPOptions()
+	if cfg.TCPKeepAlivePeriod < -1 || cfg.TCPReadBufferSize < 0 || cfg.TCPWriteBufferSize < 0 {
+		return opts, fmt.Errorf("invalid tcp options, keepalive period: %d, read buffer size: %d, write buffer size: %d",
+			cfg.TCPKeepAlivePeriod, cfg.TCPReadBufferSize, cfg.TCPWriteBufferSize)
+	}
+	if cfg.TCPKeepAlivePeriod < 0 {
+		opts.KeepAlivePeriod = -1
+	} else {
+		opts.KeepAlivePeriod = time.Duration(cfg.TCPKeepAlivePeriod) * time.Second
+	}
+	if cfg.TCPNoDelay != "" {
+		noDelay, err := strconv.ParseBool(cfg.TCPNoDelay)
+		if err != nil {
+			return opts, fmt.Errorf("invalid tcp_nodelay: %s", cfg.TCPNoDelay)
+		}
+		opts.NoDelay = noDelay
+	}
+	opts.ReadBufferSize = cfg.TCPReadBufferSize
+	opts.WriteBufferSize = cfg.TCPWriteBufferSize
+	return opts, nil
+}
+
 // Listener return proxy's listener
 func (s *Server) Listener() net.Listener {
 	return s.listener
 }
 
+// acceptConn 在accept循环中占用worker后再启动goroutine处理前端连接, 排队的goroutine数不超过conn_queue_size,
+// 避免连接洪峰时goroutine无限增长, 超出限制时返回Too many connections
+func (s *Server) acceptConn(c net.Conn) {
+	if s.connWorkers.tryAcquire() {
+		s.recordConnWorkers()
+		go s.serveConn(c)
+		return
+	}
+	if !s.connWorkers.enqueue() {
+		s.reject(c, connRejectReasonQueueFull)
+		return
+	}
+	s.recordConnWorkers()
+	go func() {
+		ok, reason := s.connWorkers.waitQueued()
+		if !ok {
+			s.recordConnWorkers()
+			s.reject(c, reason)
+			return
+		}
+		s.recordConnWorkers()
+		s.serveConn(c)
+	}()
+}
+
+// serveConn 处理已占用worker的前端连接, 返回时归还worker
+func (s *Server) serveConn(c net.Conn) {
+	defer func() {
+		s.connWorkers.release()
+		s.recordConnWorkers()
+	}()
+
+	if s.proxyProtocol != nil {
+		pc, err := s.proxyProtocol.accept(c)
+		if err != nil {
+			logging.DefaultLogger.Warnf("[server] read proxy protocol header error, remoteAddr: %s, err: %v", c.RemoteAddr().String(), err)
+			c.Close()
+			return
+		}
+		c = pc
+	}
+
+	s.onConn(c)
+}
+
+// reject 记录拒绝原因并关闭连接, 在读取PROXY protocol头之前拒绝, remoteAddr为直接连接的地址
+func (s *Server) reject(c net.Conn, reason string) {
+	logging.DefaultLogger.Warnf("[server] reject connection, remoteAddr: %s, reason: %s", c.RemoteAddr().String(), reason)
+	if s.manager != nil {
+		s.manager.GetStatisticManager().RecordConnReject(reason)
+	}
+	rejectConn(c)
+}
+
+func (s *Server) recordConnWorkers() {
+	if s.connWorkers == nil || s.manager == nil {
+		return
+	}
+	s.manager.GetStatisticManager().RecordConnWorkers(s.connWorkers.active(), s.connWorkers.queuedCount())
+}
+
+// rejectConn 在握手前返回ER_CON_COUNT_ERROR并关闭连接
+func rejectConn(c net.Conn) {
+	defer c.Close()
+	c.SetWriteDeadline(time.Now().Add(rejectConnWriteTimeout))
+	mc := mysql.NewConn(c)
+	if err := mc.WriteErrorPacketFromError(mysql.NewDefaultError(mysql.ErrConCount)); err != nil {
+		logging.DefaultLogger.Warnf("[server] write reject packet error, remoteAddr: %s, err: %v", c.RemoteAddr().String(), err)
+	}
+}
+
 func (s *Server) onConn(c net.Conn) {
 	cc := newSession(s, c) //新建一个conn
+	s.sessions.add(cc)
 	defer func() {
 		err := recover()
 		if err != nil {
@@ -117,6 +318,7 @@ func (s *Server) onConn(c net.Conn) {
 
 		// close session finally
 		cc.Close()
+		s.sessions.remove(cc)
 	}()
 
 	//_, err := myserver.NewCustomizedConn(c, server, cc.CreateCredentialProvider(), myserver.EmptyHandler{})
@@ -125,6 +327,14 @@ func (s *Server) onConn(c net.Conn) {
 	//	return
 	//}
 
+	if hasConnInterceptors() {
+		if err := cc.interceptAccept(); err != nil {
+			logging.DefaultLogger.Warnf("[server] onConn rejected by conn interceptor, remoteAddr: %s, err: %v", c.RemoteAddr().String(), err)
+			cc.c.writeErrorPacket(err)
+			return
+		}
+	}
+
 	if err := cc.Handshake(); err != nil {
 		logging.DefaultLogger.Warnf("[server] onConn error: %s", err.Error())
 		if err != mysql.ErrBadConn {
@@ -133,6 +343,12 @@ func (s *Server) onConn(c net.Conn) {
 		return
 	}
 
+	// 排空期间握手完成的连接直接关闭
+	if s.isDraining() {
+		cc.writeShutdownError()
+		return
+	}
+
 	// must invoke after handshake
 	if allowConnect := cc.IsAllowConnect(); allowConnect == false {
 		err := mysql.NewError(mysql.ErrAccessDenied, "ip address access denied by gaea")
@@ -164,12 +380,20 @@ func (s *Server) Run() error {
 			continue
 		}
 
-		go s.onConn(conn)
+		s.acceptConn(conn)
 	}
 
 	return nil
 }
 
+// ReloadTLS reload tls cert of admin server, such as on SIGHUP
+func (s *Server) ReloadTLS() error {
+	if s.adminServer == nil {
+		return nil
+	}
+	return s.adminServer.ReloadTLS()
+}
+
 // Close close proxy server
 func (s *Server) Close() error {
 	if s.adminServer != nil {
@@ -177,13 +401,19 @@ func (s *Server) Close() error {
 	}
 
 	s.closed.Set(true)
-	if s.listener != nil {
+	// 排空时已关闭listener
+	if s.listener != nil && !s.isDraining() {
 		err := s.listener.Close()
 		if err != nil {
 			return err
 		}
 	}
 
+	if s.stateSnapshotPath != "" {
+		if err := s.manager.SaveStateSnapshot(s.stateSnapshotPath); err != nil {
+			logging.DefaultLogger.Warnf("save state snapshot failed, path: %s, err: %v", s.stateSnapshotPath, err)
+		}
+	}
 	s.manager.Close()
 	return nil
 }
@@ -193,7 +423,8 @@ func (s *Server) ReloadNamespacePrepare(name string, client config.SourceProvide
 	// get namespace conf from etcd
 	logging.DefaultLogger.Infof("prepare source of namespace: %s begin", name)
 	store := provider.NewStore(client)
-	namespaceConfig, err := store.LoadNamespace(s.EncryptKey, name)
+	store.SetEnvironment(s.environ)
+	namespaceConfig, err := store.LoadResolvedNamespace(s.EncryptKey, name)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,45 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// 由会话状态决定的标记位, 不使用后端返回的值
+const sessionStatusMask = mysql.ServerStatusInTrans | mysql.ServerStatusAutocommit
+
+// 后端结果中可以透传给客户端的标记位
+// MORE_RESULTS_EXISTS, CURSOR_EXISTS等标记描述的是后端连接上的协议状态, 透传会导致客户端等待不存在的结果
+const passthroughStatusMask = mysql.ServerStatusNoGoodIndexUsed | mysql.ServerStatusNoIndexUsed | mysql.ServerStatusWasSlow
+
+// sessionStatus 返回会话当前的状态标记
+// autocommit=0时, 持有事务连接即认为处于事务中, 与MySQL隐式开启事务的行为一致
+func (se *SessionExecutor) sessionStatus() uint16 {
+	status := se.status & sessionStatusMask
+	if status&mysql.ServerStatusInTrans == 0 && !se.isAutoCommit() && se.hasTxConns() {
+		status |= mysql.ServerStatusInTrans
+	}
+	return status
+}
+
+// resultStatus 返回结果包中的状态标记, 合并会话状态和后端结果中可透传的标记
+func (se *SessionExecutor) resultStatus(r *mysql.Result) uint16 {
+	status := se.sessionStatus()
+	if r != nil {
+		status |= r.Status & passthroughStatusMask
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestSessionStatus(t *testing.T) {
+	se := newSessionExecutor(nil)
+
+	if status := se.sessionStatus(); status != mysql.ServerStatusAutocommit {
+		t.Errorf("autocommit session status error: %d", status)
+	}
+
+	se.status |= mysql.ServerStatusInTrans
+	if status := se.sessionStatus(); status != mysql.ServerStatusAutocommit|mysql.ServerStatusInTrans {
+		t.Errorf("begin session status error: %d", status)
+	}
+
+	// autocommit=0时, 未持有事务连接不处于事务中, 执行语句后隐式开启事务
+	se.status = 0
+	if status := se.sessionStatus(); status != 0 {
+		t.Errorf("autocommit off session status error: %d", status)
+	}
+	se.txConns["slice-0"] = new(mocks.PooledConnect)
+	if status := se.sessionStatus(); status != mysql.ServerStatusInTrans {
+		t.Errorf("implicit transaction session status error: %d", status)
+	}
+}
+
+func TestResultStatus(t *testing.T) {
+	se := newSessionExecutor(nil)
+
+	r := &mysql.Result{
+		Status: mysql.ServerStatusInTrans | mysql.ServerMoreResultsExists | mysql.ServerStatusCursorExists | mysql.ServerStatusLastRowSend | mysql.ServerStatusNoIndexUsed,
+	}
+	expect := mysql.ServerStatusAutocommit | mysql.ServerStatusNoIndexUsed
+	if status := se.resultStatus(r); status != expect {
+		t.Errorf("result status not equal, expect: %d, actual: %d", expect, status)
+	}
+	if status := se.resultStatus(nil); status != mysql.ServerStatusAutocommit {
+		t.Errorf("empty result status error: %d", status)
+	}
+
+	modifyResultStatus(r, se)
+	if r.Status != expect {
+		t.Errorf("modify result status not equal, expect: %d, actual: %d", expect, r.Status)
+	}
+}
@@ -22,9 +22,11 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/XiaoMi/Gaea/mysql"
 	"github.com/XiaoMi/Gaea/util"
+	"github.com/XiaoMi/Gaea/util/sync2"
 )
 
 /*
@@ -35,7 +37,12 @@ CLIENT_LONG_PASSWORD | CLIENT_LONG_FLAG | CLIENT_CONNECT_WITH_DB | CLIENT_PROTOC
 // DefaultCapability means default capability
 var DefaultCapability = mysql.ClientLongPassword | mysql.ClientLongFlag |
 	mysql.ClientConnectWithDB | mysql.ClientProtocol41 |
-	mysql.ClientTransactions | mysql.ClientSecureConnection | mysql.ClientPluginAuth | mysql.ClientPluginAuthLenencClientData
+	mysql.ClientTransactions | mysql.ClientSecureConnection | mysql.ClientPluginAuth | mysql.ClientPluginAuthLenencClientData |
+	mysql.ClientConnectAtts | mysql.ClientDeprecateEOF | mysql.ClientQueryAttributes
+
+// MariaDBCapability means capability in mariadb compatibility mode,
+// mariadb server does not set CLIENT_MYSQL(CLIENT_LONG_PASSWORD), connectors use it to detect mariadb
+var MariaDBCapability = DefaultCapability &^ mysql.ClientLongPassword
 
 var baseConnID uint32 = 10000
 
@@ -57,31 +64,54 @@ type Session struct {
 	closed atomic.Value
 
 	cachingSha2FullAuth bool
+
+	// 握手或COM_CHANGE_USER时客户端指定的字符集, COM_RESET_CONNECTION时恢复
+	clientCollation mysql.CollationID
+	clientCharset   string
+
+	connInfo *ConnInfo // 连接拦截器使用的连接信息, 接受连接时没有注册拦截器则为nil
+
+	disconnectWatcher *disconnectWatcher // 执行命令期间检测客户端断开, 不支持时为nil
+
+	connLimitUser     string // 占用连接数的用户
+	connLimitAcquired bool
+
+	executing sync2.AtomicBool // 正在执行命令, 排空时不中断
+	shutdown  sync2.AtomicBool // 排空超时被强制关闭, 返回ER_SERVER_SHUTDOWN
 }
 
 // create session between client<->proxy
 func newSession(s *Server, co net.Conn) *Session {
 	cc := new(Session)
-	tcpConn := co.(*net.TCPConn)
-
-	//SetNoDelay controls whether the operating system should delay packet transmission
-	// in hopes of sending fewer packets (Nagle's algorithm).
-	// The default is true (no delay),
-	// meaning that data is sent as soon as possible after a Write.
-	//I set this option false.
-	_ = tcpConn.SetNoDelay(true)
-	cc.c = NewClientConn(mysql.NewConn(tcpConn), s.manager)
+
+	// TCP_NODELAY等参数已经在listener中按配置设置, 这里不再覆盖, unix socket连接不是*net.TCPConn
+	cc.c = NewClientConn(mysql.NewConn(co), s.manager)
+	cc.c.mariadbCompat = s.mariadbCompat
+	cc.c.compressCapability = s.compressCapability
+	cc.c.SetReadTimeout(s.connReadTimeout)
+	cc.c.SetWriteTimeout(s.connWriteTimeout)
 	cc.proxy = s
 	cc.manager = s.manager
 
 	cc.c.SetConnectionID(atomic.AddUint32(&baseConnID, 1))
 
-	cc.executor = newSessionExecutor(s.manager)
-	cc.executor.clientAddr = co.RemoteAddr().String()
+	cc.executor = cc.newExecutor()
+	cc.disconnectWatcher = newDisconnectWatcher(co, s.clientCheckInterval, cc.onClientDisconnect)
 	cc.closed.Store(false)
 	return cc
 }
 
+// newExecutor create executor without user and namespace, which are set after authentication
+func (cc *Session) newExecutor() *SessionExecutor {
+	se := newSessionExecutor(cc.manager)
+	se.clientAddr = cc.c.RemoteAddr().String()
+	se.connID = cc.c.GetConnectionID()
+	se.outfileDir = cc.proxy.outfileDir
+	se.diagnosticDir = cc.proxy.diagnosticDir
+	se.healthCheck = cc.proxy.healthCheck
+	return se
+}
+
 func (cc *Session) getNamespace() *Namespace {
 	return cc.manager.GetNamespace(cc.namespace)
 }
@@ -89,6 +119,10 @@ func (cc *Session) getNamespace() *Namespace {
 // IsAllowConnect check if allow to connect
 func (cc *Session) IsAllowConnect() bool {
 	ns := cc.getNamespace() // maybe nil, and panic!
+	// unix socket连接来自本机
+	if _, ok := cc.c.RemoteAddr().(*net.UnixAddr); ok {
+		return ns.IsClientIPAllowed(net.IPv4(127, 0, 0, 1))
+	}
 	clientHost, _, err := net.SplitHostPort(cc.c.RemoteAddr().String())
 	if err != nil {
 		logging.DefaultLogger.Warnf("[server] Session parse host error: %v", err)
@@ -156,60 +190,113 @@ func (cc *Session) Handshake() error {
 		return err
 	}
 
-	if err := cc.c.writeOK(cc.executor.GetStatus()); err != nil {
+	cc.c.attributes = info.Attributes
+
+	if err := cc.acquireConnLimit(info.User); err != nil {
+		logging.DefaultLogger.Warnf("[server] Session rejected by connection limit, connId: %d, user: %s, err: %v", cc.c.GetConnectionID(), info.User, err)
+		return err
+	}
+
+	if cc.connInfo != nil {
+		if err := cc.interceptAuthenticated(); err != nil {
+			logging.DefaultLogger.Warnf("[server] Session rejected by conn interceptor after authentication, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+			return err
+		}
+	}
+
+	if err := cc.c.writeOK(cc.executor.sessionStatus()); err != nil {
 		logging.DefaultLogger.Warnf("[server] Session readHandshakeResponse error, connId %d, msg: %s, error: %s",
 			cc.c.GetConnectionID(), "write ok fail", err.Error())
 		return err
 	}
 
+	// 客户端请求压缩时, 握手完成后开启压缩协议
+	if info.Compression != mysql.CompressionNone {
+		if err := cc.c.EnableCompression(info.Compression, info.ZstdLevel); err != nil {
+			logging.DefaultLogger.Warnf("[server] Session enable compression error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (cc *Session) handleHandshakeResponse(info HandshakeResponseInfo) error {
-	// check and set user
+	account, err := cc.authenticate(info)
+	if err != nil {
+		return err
+	}
+	charset, err := collationCharset(info.CollationID)
+	if err != nil {
+		return err
+	}
+	cc.setupSession(info, account, charset)
+	return nil
+}
 
+// authenticate 查询用户并校验密码, 握手和COM_CHANGE_USER共用
+func (cc *Session) authenticate(info HandshakeResponseInfo) (*UserAccount, error) {
+	cc.cachingSha2FullAuth = false
+
+	// check and set user
 	user := info.User
-	if !cc.manager.CheckUser(user) {
-		return mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
+	host := cc.clientHost()
+	provider := cc.getUserProvider()
+	account, err := provider.LookupUser(user, host)
+	if err != nil {
+		logging.DefaultLogger.Warnf("[server] lookup user error, connId: %d, user: %s, host: %s, err: %v", cc.c.GetConnectionID(), user, host, err)
+		return nil, mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
 	}
-	cc.executor.user = user
-
-	password, found, _ := cc.GetCredential(user)
-	if !found {
-		return mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
+	if account == nil {
+		return nil, mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
 	}
-	// check password
-	//_, password := cc.manager.CheckPassword(user, info.Salt, info.AuthResponse)
-	//if !succ {
-	//	return mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
-	//}
-
-	if err := cc.auth(info, password); err != nil {
-		return mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
+	if account.Locked {
+		return nil, mysql.NewDefaultError(mysql.ErrAccountHasBeenLocked, user, host)
 	}
 
-	// handle collation
-	collationID := info.CollationID
-	collationName, ok := mysql.Collations[mysql.CollationID(collationID)]
+	if err := cc.authAccount(info, account, provider, host); err != nil {
+		if err != ErrAccessDenied {
+			logging.DefaultLogger.Warnf("[server] auth error, connId: %d, user: %s, host: %s, err: %v", cc.c.GetConnectionID(), user, host, err)
+		}
+		return nil, mysql.NewDefaultError(mysql.ErrAccessDenied, user, cc.c.RemoteAddr().String(), "Yes")
+	}
+	return account, nil
+}
+
+// collationCharset return charset of collation sent by client
+func collationCharset(collationID mysql.CollationID) (string, error) {
+	collationName, ok := mysql.Collations[collationID]
 	if !ok {
-		return mysql.NewError(mysql.ErrInternal, "invalid collation")
+		return "", mysql.NewError(mysql.ErrInternal, "invalid collation")
 	}
 	charset, ok := mysql.CollationNameToCharset[collationName]
 	if !ok {
-		return mysql.NewError(mysql.ErrInternal, "invalid collation")
+		return "", mysql.NewError(mysql.ErrInternal, "invalid collation")
 	}
-	cc.executor.SetCollationID(mysql.CollationID(collationID))
+	return charset, nil
+}
+
+// setupSession 认证通过后设置会话的用户, 字符集, 数据库和namespace
+func (cc *Session) setupSession(info HandshakeResponseInfo, account *UserAccount, charset string) {
+	cc.executor.user = info.User
+
+	// handle collation
+	cc.clientCollation, cc.clientCharset = info.CollationID, charset
+	cc.executor.SetCollationID(info.CollationID)
 	cc.executor.SetCharset(charset)
 
 	// set database
 	cc.executor.SetDatabase(info.Database)
 
 	// set namespace
-	namespace := cc.manager.GetNamespaceByUser(user, password)
+	namespace := account.Namespace
 	cc.namespace = namespace
 	cc.executor.namespace = namespace
 	cc.c.namespace = namespace // TODO: remove it when refactor is done
-	return nil
+	if ns := cc.manager.GetNamespace(namespace); ns != nil {
+		cc.executor.sampled = ns.sampleSession()
+	}
+	cc.executor.clientQueryAttributes = cc.c.capability&mysql.ClientQueryAttributes != 0
 }
 
 // Close close session with it's resources
@@ -218,10 +305,17 @@ func (cc *Session) Close() {
 		return
 	}
 	cc.closed.Store(true)
+	// 中断正在执行的跨分片查询
+	if cc.executor.cancel != nil {
+		cc.executor.cancel()
+	}
+	cc.fireSessionClose()
 	if err := cc.executor.rollback(); err != nil {
 		logging.DefaultLogger.Warnf("executor rollback error when Session close: %v", err)
 	}
+	cc.executor.closeTempTables()
 	cc.c.Close()
+	cc.releaseConnLimit()
 	logging.DefaultLogger.Debugf("client closed, %d", cc.c.GetConnectionID())
 
 	return
@@ -249,38 +343,117 @@ func (cc *Session) Run() {
 	}()
 
 	cc.manager.GetStatisticManager().IncrSessionCount(cc.namespace)
+	cc.fireSessionConnect()
 
 	for !cc.IsClosed() {
 		cc.c.SetSequence(0)
+		idleDeadline := cc.setIdleInTransactionDeadline()
 		data, err := cc.c.ReadEphemeralPacket()
 		if err != nil {
+			if cc.shutdown.Get() {
+				cc.writeShutdownError()
+			}
+			if !idleDeadline.IsZero() && !time.Now().Before(idleDeadline) {
+				logging.DefaultLogger.Warnf("Session idle in transaction timeout, rollback and close, connId: %d, timeout: %v",
+					cc.c.GetConnectionID(), cc.proxy.idleInTransactionTimeout)
+			}
 			return
 		}
+		if !idleDeadline.IsZero() {
+			cc.c.SetReadDeadline(time.Time{})
+		}
 
 		cc.proxy.tw.Add(cc.proxy.sessionTimeout, cc, cc.Close)
 		cc.manager.GetStatisticManager().AddReadFlowCount(cc.namespace, len(data))
 
 		cmd := data[0]
 		data = data[1:]
-		rs := cc.executor.ExecuteCommand(cmd, data)
-		cc.c.RecycleReadPacket()
+		// 排空期间不在事务中的会话不再执行新的命令
+		if cc.proxy.isDraining() && cmd != mysql.ComQuit && !cc.executor.hasTxConns() {
+			cc.c.RecycleReadPacket()
+			cc.writeShutdownError()
+			return
+		}
+		// 协商CLIENT_QUERY_ATTRIBUTES时COM_QUERY的语句前是query attributes
+		attrs, data, attrErr := cc.readQueryAttributes(cmd, data)
+		cc.executor.queryAttributes = attrs
+		if cmd == mysql.ComChangeUser {
+			// 重新认证时还要读写客户端连接, 先复制请求并释放读缓冲
+			data = append([]byte(nil), data...)
+			cc.c.RecycleReadPacket()
+		}
+		cc.executing.Set(true)
+		tracker := cc.trackCommand(cmd, data)
+		var rs Response
+		closeAfterWrite := false
+		if attrErr != nil {
+			rs = CreateErrorResponse(cc.executor.sessionStatus(), attrErr)
+		} else if err := cc.interceptCommandIfNeeded(cmd, data); err != nil {
+			rs = CreateErrorResponse(cc.executor.sessionStatus(), err)
+		} else if cmd == mysql.ComChangeUser {
+			rs, closeAfterWrite = cc.handleChangeUser(data)
+		} else if cmd == mysql.ComResetConnection {
+			rs = cc.handleResetConnection()
+		} else {
+			cc.disconnectWatcher.start()
+			rs = cc.executor.ExecuteCommand(cmd, data)
+			if cc.disconnectWatcher.stop() {
+				// 客户端已断开, 不再返回结果, 关闭会话时回滚事务
+				tracker.finish(rs)
+				cc.c.RecycleReadPacket()
+				return
+			}
+		}
+		if cc.shutdown.Get() {
+			rs = CreateErrorResponse(cc.executor.sessionStatus(), mysql.NewDefaultError(mysql.ErrServerShutdown))
+		}
+		tracker.finish(rs)
+		if cmd != mysql.ComChangeUser {
+			cc.c.RecycleReadPacket()
+		}
 
+		cc.applyWriteBuffering()
 		if err = cc.writeResponse(rs); err != nil {
 			logging.DefaultLogger.Warnf("Session write response error, connId: %d, err: %v", cc.c.GetConnectionID(), err)
 			cc.Close()
 			return
 		}
 
-		if cmd == mysql.ComQuit {
+		if cmd == mysql.ComQuit || closeAfterWrite {
 			cc.Close()
 		}
+		// 排空期间事务结束后关闭会话
+		if cc.shutdown.Get() || (cc.proxy.isDraining() && !cc.executor.hasTxConns()) {
+			return
+		}
+		cc.executing.Set(false)
+	}
+}
+
+// onClientDisconnect 执行命令期间客户端断开, 中断正在执行的后端查询
+func (cc *Session) onClientDisconnect() {
+	logging.DefaultLogger.Warnf("Session client disconnected during command execution, abort backend queries, connId: %d, remoteAddr: %s",
+		cc.c.GetConnectionID(), cc.c.RemoteAddr().String())
+	if cc.executor.cancel != nil {
+		cc.executor.cancel()
+	}
+}
+
+// setIdleInTransactionDeadline 事务中持有后端连接时, 限制等待下一个请求的时间, 超时后会话关闭并回滚事务
+func (cc *Session) setIdleInTransactionDeadline() time.Time {
+	timeout := cc.proxy.idleInTransactionTimeout
+	if timeout <= 0 || !cc.executor.hasTxConns() {
+		return time.Time{}
 	}
+	deadline := time.Now().Add(timeout)
+	cc.c.SetReadDeadline(deadline)
+	return deadline
 }
 
 func (cc *Session) writeResponse(r Response) error {
 	switch r.RespType {
 	case RespEOF:
-		return cc.c.writeEOFPacket(r.Status)
+		return cc.c.writeEndPacket(r.Status)
 	case RespResult:
 		rs := r.Data.(*mysql.Result)
 		if rs == nil {
@@ -314,6 +487,10 @@ func (cc *Session) writeResponse(r Response) error {
 		return nil
 	case RespOK:
 		return cc.c.writeOK(r.Status)
+	case RespCursor:
+		return cc.c.writeCursorResultset(r.Status, r.Data.(*mysql.Result).Resultset)
+	case RespFetch:
+		return cc.c.writeFetchRows(r.Status, r.Data.(*StmtFetchResult).Rows)
 	case RespNoop:
 		return nil
 	default:
@@ -0,0 +1,218 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// SessionEventType is the type of session lifecycle event
+type SessionEventType int
+
+const (
+	// SessionConnect client connection is authenticated and starts to serve requests
+	SessionConnect SessionEventType = iota
+	// SessionClose client connection is closed, the open transaction is rolled back
+	SessionClose
+	// SessionTxBegin transaction begins, by BEGIN or the first statement after SET autocommit = 0
+	SessionTxBegin
+	// SessionTxEnd transaction ends, by COMMIT, ROLLBACK, SET autocommit = 1 or closing connection
+	SessionTxEnd
+	// SessionStateChange session state changes, see SessionStateIdle etc.
+	SessionStateChange
+	// SessionStatementComplete a command from client is executed, before the response is written
+	SessionStatementComplete
+	// SessionChangeUser user of session is changed by COM_CHANGE_USER and session state is reset,
+	// User and Namespace are the new ones, the open transaction is rolled back before
+	SessionChangeUser
+	// SessionResetConnection session state is reset by COM_RESET_CONNECTION, user and namespace are kept,
+	// the open transaction is rolled back before
+	SessionResetConnection
+)
+
+// 会话状态
+const (
+	SessionStateIdle          = "idle"           // 没有进行中的事务
+	SessionStateInTransaction = "in_transaction" // 事务进行中, 与返回给客户端的SERVER_STATUS_IN_TRANS一致
+	SessionStateClosed        = "closed"
+)
+
+// SessionEvent is the event of session lifecycle
+type SessionEvent struct {
+	Type       SessionEventType
+	Namespace  string
+	User       string
+	ConnID     uint32
+	ClientAddr string
+	State      string            // 事件发生后的会话状态
+	PrevState  string            // 事件发生前的会话状态
+	Tags       map[string]string // 连接拦截器打的标签, 没有拦截器时为nil, 不能修改
+	Attributes map[string]string // 客户端发送的连接属性, 如program_name, 不能修改
+
+	// 以下字段仅用于SessionStatementComplete
+	Command  byte   // mysql.ComQuery等
+	SQL      string // COM_QUERY的语句, 其他命令为空
+	Duration time.Duration
+	Err      error // 返回给客户端的错误, 成功时为nil
+
+	QueryAttributes map[string]string // COM_QUERY和COM_STMT_EXECUTE携带的query attributes, 如trace id, 没有时为nil, 不能修改
+}
+
+// SessionHook is called on session lifecycle events. It's called synchronously in session goroutine,
+// except SessionClose which may be called by session timeout, so it should not block.
+// It can be used by embedders to build connection tracking or quota systems without patching the session loop.
+type SessionHook func(event *SessionEvent)
+
+var sessionHooks = struct {
+	sync.RWMutex
+	hooks map[string]SessionHook
+}{hooks: make(map[string]SessionHook)}
+
+// RegisterSessionHook register hook with name, the hook registered with the same name is replaced
+func RegisterSessionHook(name string, hook SessionHook) {
+	sessionHooks.Lock()
+	defer sessionHooks.Unlock()
+	sessionHooks.hooks[name] = hook
+}
+
+// UnregisterSessionHook remove hook with name
+func UnregisterSessionHook(name string) {
+	sessionHooks.Lock()
+	defer sessionHooks.Unlock()
+	delete(sessionHooks.hooks, name)
+}
+
+func hasSessionHooks() bool {
+	sessionHooks.RLock()
+	defer sessionHooks.RUnlock()
+	return len(sessionHooks.hooks) != 0
+}
+
+// sessionState 按返回给客户端的状态判断是否在事务中
+func (cc *Session) sessionState() string {
+	if cc.executor.sessionStatus()&mysql.ServerStatusInTrans != 0 {
+		return SessionStateInTransaction
+	}
+	return SessionStateIdle
+}
+
+func (cc *Session) newSessionEvent(tp SessionEventType, prevState, state string) *SessionEvent {
+	var tags map[string]string
+	if cc.connInfo != nil {
+		tags = cc.connInfo.Tags
+	}
+	return &SessionEvent{
+		Type:       tp,
+		Namespace:  cc.namespace,
+		User:       cc.executor.user,
+		ConnID:     cc.c.GetConnectionID(),
+		ClientAddr: cc.executor.clientAddr,
+		State:      state,
+		PrevState:  prevState,
+		Tags:       tags,
+		Attributes: cc.c.Attributes(),
+	}
+}
+
+// commandTracker 记录命令执行前的状态, 执行后触发语句完成、事务开始结束和状态变化事件, 没有注册hook时为nil
+type commandTracker struct {
+	cc        *Session
+	cmd       byte
+	sql       string
+	prevState string
+	startTime time.Time
+}
+
+func (cc *Session) trackCommand(cmd byte, data []byte) *commandTracker {
+	if !hasSessionHooks() {
+		return nil
+	}
+	t := &commandTracker{cc: cc, cmd: cmd, prevState: cc.sessionState(), startTime: time.Now()}
+	if cmd == mysql.ComQuery {
+		t.sql = string(data)
+	}
+	return t
+}
+
+func (t *commandTracker) finish(rs Response) {
+	if t == nil {
+		return
+	}
+	state := t.cc.sessionState()
+	event := t.cc.newSessionEvent(SessionStatementComplete, t.prevState, state)
+	event.Command = t.cmd
+	event.SQL = t.sql
+	event.QueryAttributes = t.cc.executor.queryAttributes
+	event.Duration = time.Since(t.startTime)
+	if rs.RespType == RespError {
+		event.Err, _ = rs.Data.(error)
+	}
+	fireSessionHooks(event)
+	t.cc.fireStateChange(t.prevState, state)
+}
+
+// fireStateChange 状态变化时触发事务开始或结束事件, 然后触发状态变化事件
+func (cc *Session) fireStateChange(prevState, state string) {
+	if prevState == state {
+		return
+	}
+	if state == SessionStateInTransaction {
+		fireSessionHooks(cc.newSessionEvent(SessionTxBegin, prevState, state))
+	} else if prevState == SessionStateInTransaction {
+		fireSessionHooks(cc.newSessionEvent(SessionTxEnd, prevState, state))
+	}
+	fireSessionHooks(cc.newSessionEvent(SessionStateChange, prevState, state))
+}
+
+func (cc *Session) fireSessionConnect() {
+	if !hasSessionHooks() {
+		return
+	}
+	fireSessionHooks(cc.newSessionEvent(SessionConnect, "", cc.sessionState()))
+}
+
+// fireSessionClose 在回滚事务前调用, 事务中关闭时先触发事务结束事件
+func (cc *Session) fireSessionClose() {
+	if !hasSessionHooks() {
+		return
+	}
+	prevState := cc.sessionState()
+	cc.fireStateChange(prevState, SessionStateClosed)
+	fireSessionHooks(cc.newSessionEvent(SessionClose, prevState, SessionStateClosed))
+}
+
+func fireSessionHooks(event *SessionEvent) {
+	sessionHooks.RLock()
+	defer sessionHooks.RUnlock()
+	for name, hook := range sessionHooks.hooks {
+		callSessionHook(name, hook, event)
+	}
+}
+
+// hook panic不影响会话
+func callSessionHook(name string, hook SessionHook, event *SessionEvent) {
+	defer func() {
+		if e := recover(); e != nil {
+			buf := make([]byte, 4096)
+			buf = buf[:runtime.Stack(buf, false)]
+			exeLogger.Warnf("session hook %s panic, error: %v, stack: %s", name, e, string(buf))
+		}
+	}()
+	hook(event)
+}
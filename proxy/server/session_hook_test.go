@@ -0,0 +1,93 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestSessionHook(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	cc := newSession(&Server{}, server)
+	cc.namespace = "test_ns"
+	cc.executor.user = "test_user"
+
+	var events []*SessionEvent
+	RegisterSessionHook("test", func(event *SessionEvent) {
+		events = append(events, event)
+	})
+	RegisterSessionHook("panic", func(event *SessionEvent) {
+		panic("hook panic")
+	})
+	defer UnregisterSessionHook("test")
+	defer UnregisterSessionHook("panic")
+
+	cc.fireSessionConnect()
+
+	// BEGIN进入事务
+	tracker := cc.trackCommand(mysql.ComQuery, []byte("begin"))
+	if err := cc.executor.handleBegin(); err != nil {
+		t.Fatal(err)
+	}
+	tracker.finish(CreateOKResponse(cc.executor.sessionStatus()))
+
+	// 事务中关闭连接
+	cc.Close()
+
+	expects := []struct {
+		tp        SessionEventType
+		prevState string
+		state     string
+	}{
+		{SessionConnect, "", SessionStateIdle},
+		{SessionStatementComplete, SessionStateIdle, SessionStateInTransaction},
+		{SessionTxBegin, SessionStateIdle, SessionStateInTransaction},
+		{SessionStateChange, SessionStateIdle, SessionStateInTransaction},
+		{SessionTxEnd, SessionStateInTransaction, SessionStateClosed},
+		{SessionStateChange, SessionStateInTransaction, SessionStateClosed},
+		{SessionClose, SessionStateInTransaction, SessionStateClosed},
+	}
+	if len(events) != len(expects) {
+		t.Fatalf("event count not match, expect: %d, actual: %d", len(expects), len(events))
+	}
+	for i, e := range expects {
+		actual := events[i]
+		if actual.Type != e.tp || actual.PrevState != e.prevState || actual.State != e.state {
+			t.Errorf("event %d not match, expect: %+v, actual: %+v", i, e, actual)
+		}
+		if actual.Namespace != "test_ns" || actual.User != "test_user" {
+			t.Errorf("event %d session info not match: %+v", i, actual)
+		}
+	}
+	if events[1].SQL != "begin" || events[1].Command != mysql.ComQuery || events[1].Err != nil {
+		t.Errorf("statement complete event not match: %+v", events[1])
+	}
+}
+
+func TestSessionHookNotRegistered(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	cc := newSession(&Server{}, server)
+	if tracker := cc.trackCommand(mysql.ComQuery, []byte("select 1")); tracker != nil {
+		t.Errorf("expect no tracker without hooks")
+	}
+}
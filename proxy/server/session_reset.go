@@ -0,0 +1,51 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/XiaoMi/Gaea/logging"
+)
+
+// handleResetConnection COM_RESET_CONNECTION, 不重新认证, 保留用户、namespace和当前数据库,
+// 其他会话状态恢复为刚建立连接时的状态
+func (cc *Session) handleResetConnection() Response {
+	prevState := cc.sessionState()
+	old := cc.executor
+	cc.resetExecutor()
+	se := cc.executor
+	se.user = old.user
+	se.namespace = old.namespace
+	se.sampled = old.sampled
+	se.SetDatabase(old.GetDatabase())
+	se.SetCollationID(cc.clientCollation)
+	se.SetCharset(cc.clientCharset)
+	if hasSessionHooks() {
+		fireSessionHooks(cc.newSessionEvent(SessionResetConnection, prevState, cc.sessionState()))
+	}
+	return CreateOKResponse(se.sessionStatus())
+}
+
+// resetExecutor 回滚事务并关闭临时表, 使用新的执行器清除会话变量、用户变量和预处理语句
+func (cc *Session) resetExecutor() {
+	old := cc.executor
+	if err := old.rollback(); err != nil {
+		logging.DefaultLogger.Warnf("executor rollback error when reset session, connId: %d, err: %v", cc.c.GetConnectionID(), err)
+	}
+	old.closeTempTables()
+	if old.cancel != nil {
+		old.cancel()
+	}
+	cc.executor = cc.newExecutor()
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestHandleResetConnection(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+	cc := newSession(&Server{manager: NewManager()}, serverSide)
+	cc.setupSession(HandshakeResponseInfo{User: "a", Database: "db", CollationID: 33}, &UserAccount{Namespace: "ns"}, "utf8")
+
+	old := cc.executor
+	old.userVariables["v"] = int64(1)
+	old.stmts[1] = &Stmt{}
+	old.SetDatabase("db2")
+	old.SetCollationID(mysql.CollationID(45))
+	old.SetCharset("utf8mb4")
+	old.pinnedSlice = "slice-1"
+
+	var events []*SessionEvent
+	RegisterSessionHook("test_reset_connection", func(event *SessionEvent) {
+		events = append(events, event)
+	})
+	defer UnregisterSessionHook("test_reset_connection")
+
+	rs := cc.handleResetConnection()
+	if rs.RespType != RespOK {
+		t.Fatalf("reset connection failed, response: %+v", rs)
+	}
+	se := cc.executor
+	if se == old || se.user != "a" || se.namespace != "ns" || se.GetDatabase() != "db2" || se.connID != old.connID {
+		t.Errorf("user, namespace and database should be kept, user: %s, namespace: %s, db: %s", se.user, se.namespace, se.GetDatabase())
+	}
+	if len(se.userVariables) != 0 || len(se.stmts) != 0 || se.pinnedSlice != "" {
+		t.Errorf("session state not cleared, user variables: %v, stmts: %d, pinned slice: %s", se.userVariables, len(se.stmts), se.pinnedSlice)
+	}
+	if se.GetCollationID() != 33 || se.GetCharset() != "utf8" {
+		t.Errorf("charset should be restored to client charset, collation: %d, charset: %s", se.GetCollationID(), se.GetCharset())
+	}
+	if len(events) != 1 || events[0].Type != SessionResetConnection || events[0].User != "a" {
+		t.Errorf("expect one reset connection event, got: %v", events)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend/mocks"
+)
+
+func TestSessionIdleInTransactionDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	s := &Server{idleInTransactionTimeout: 50 * time.Millisecond}
+	cc := newSession(s, server)
+
+	if deadline := cc.setIdleInTransactionDeadline(); !deadline.IsZero() {
+		t.Fatalf("expect no deadline without backend transaction connections, actual: %v", deadline)
+	}
+
+	pc := new(mocks.PooledConnect)
+	pc.On("Rollback").Return(nil)
+	pc.On("Recycle").Return(nil)
+	cc.executor.txConns["slice-0"] = pc
+
+	deadline := cc.setIdleInTransactionDeadline()
+	if deadline.IsZero() {
+		t.Fatalf("expect deadline when holding backend transaction connections")
+	}
+	if _, err := cc.c.ReadEphemeralPacket(); err == nil {
+		t.Fatalf("expect read error after idle in transaction timeout")
+	}
+	if time.Now().Before(deadline) {
+		t.Errorf("read returned before deadline")
+	}
+
+	if err := cc.executor.rollback(); err != nil {
+		t.Fatalf("rollback error: %v", err)
+	}
+	pc.AssertCalled(t, "Rollback")
+	pc.AssertCalled(t, "Recycle")
+	if cc.executor.hasTxConns() {
+		t.Errorf("expect backend transaction connections released")
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// 复制建表语句时去掉自增计数
+var createTableAutoIncrementRegexp = regexp.MustCompile(`\s+AUTO_INCREMENT=\d+`)
+
+// ShardTableLocation physical table of shard rule
+type ShardTableLocation struct {
+	Slice string `json:"slice"`
+	DB    string `json:"db"`
+	Table string `json:"table"`
+}
+
+func (l ShardTableLocation) String() string {
+	return fmt.Sprintf("%s:%s.%s", l.Slice, l.DB, l.Table)
+}
+
+// ShardTableCheckResult physical tables of shard rule missing on or not expected by backends
+type ShardTableCheckResult struct {
+	DB      string               `json:"db"`
+	Table   string               `json:"table"`
+	Missing []ShardTableLocation `json:"missing"`
+	Extra   []ShardTableLocation `json:"extra"`
+	Created []ShardTableLocation `json:"created"`
+	Error   string               `json:"error"`
+}
+
+// CheckShardTables compare physical tables of shard rules in namespace with tables on backends,
+// missing tables are created with the DDL of an existing physical table of the same rule if create is true
+func (m *Manager) CheckShardTables(namespace string, create bool) ([]*ShardTableCheckResult, error) {
+	ns := m.GetNamespace(namespace)
+	if ns == nil {
+		return nil, fmt.Errorf("namespace not found: %s", namespace)
+	}
+	return ns.checkShardTables(create), nil
+}
+
+func (n *Namespace) checkShardTables(create bool) []*ShardTableCheckResult {
+	existing := make(map[string]map[string]bool) // key: slice:db
+	getTables := func(slice, db string) (map[string]bool, error) {
+		key := slice + ":" + db
+		if tables, ok := existing[key]; ok {
+			return tables, nil
+		}
+		tables, err := n.showBackendTables(slice, db)
+		if err != nil {
+			return nil, err
+		}
+		existing[key] = tables
+		return tables, nil
+	}
+
+	var results []*ShardTableCheckResult
+	for _, rule := range n.router.GetRules() {
+		// 通配符规则匹配的表在访问时才确定, 不检查
+		if models.IsTablePattern(rule.GetTable()) {
+			continue
+		}
+		r := &ShardTableCheckResult{DB: rule.GetDB(), Table: rule.GetTable()}
+		results = append(results, r)
+		expected, err := expectedShardTables(rule, n.defaultPhyDBs)
+		if err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		found := make(map[string]map[string]bool)
+		for _, l := range expected {
+			tables, err := getTables(l.Slice, l.DB)
+			if err != nil {
+				r.Error = err.Error()
+				break
+			}
+			found[l.Slice+":"+l.DB] = tables
+		}
+		if r.Error != "" {
+			continue
+		}
+		r.Missing, r.Extra = diffShardTables(rule, expected, found)
+		if create && len(r.Missing) != 0 {
+			r.Created, err = n.createMissingShardTables(expected, r.Missing, found)
+			if err != nil {
+				r.Error = err.Error()
+			}
+		}
+	}
+	return results
+}
+
+func (n *Namespace) logShardTableCheck() {
+	for _, r := range n.checkShardTables(false) {
+		if r.Error != "" {
+			log.Warnf("check shard tables failed, namespace: %s, table: %s.%s, err: %s", n.name, r.DB, r.Table, r.Error)
+			continue
+		}
+		if len(r.Missing) != 0 || len(r.Extra) != 0 {
+			log.Warnf("shard tables not match, namespace: %s, table: %s.%s, missing: %v, extra: %v", n.name, r.DB, r.Table, r.Missing, r.Extra)
+		}
+	}
+}
+
+// expectedShardTables return physical tables of rule, kingshard rules use table_%04d, mycat and global rules use the logic table name
+func expectedShardTables(rule router.Rule, phyDBs map[string]string) ([]ShardTableLocation, error) {
+	ruleType := rule.GetType()
+	useLogicTable := router.IsMycatShardingRule(ruleType) || ruleType == router.GlobalTableRuleType
+	var tables []ShardTableLocation
+	for _, idx := range rule.GetSubTableIndexes() {
+		sliceIndex := rule.GetSliceIndexFromTableIndex(idx)
+		if sliceIndex < 0 {
+			return nil, fmt.Errorf("slice of table index %d not found", idx)
+		}
+		db, err := rule.GetDatabaseNameByTableIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+		table := rule.GetTable()
+		if !useLogicTable {
+			if phyDB, ok := phyDBs[db]; ok {
+				db = phyDB
+			}
+			table = fmt.Sprintf("%s_%04d", table, idx)
+		}
+		tables = append(tables, ShardTableLocation{Slice: rule.GetSlice(sliceIndex), DB: db, Table: table})
+	}
+	return tables, nil
+}
+
+// diffShardTables 对于kingshard规则, 同一个库中符合table_NNNN格式但不属于该分片位置的表作为多余的表
+func diffShardTables(rule router.Rule, expected []ShardTableLocation, found map[string]map[string]bool) (missing, extra []ShardTableLocation) {
+	expectedSet := make(map[ShardTableLocation]bool, len(expected))
+	for _, l := range expected {
+		expectedSet[l] = true
+		if !found[l.Slice+":"+l.DB][l.Table] {
+			missing = append(missing, l)
+		}
+	}
+
+	ruleType := rule.GetType()
+	if router.IsMycatShardingRule(ruleType) || ruleType == router.GlobalTableRuleType {
+		return missing, nil
+	}
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(rule.GetTable()) + `_\d{4,}$`)
+	for key, tables := range found {
+		sliceDB := strings.SplitN(key, ":", 2)
+		for table := range tables {
+			l := ShardTableLocation{Slice: sliceDB[0], DB: sliceDB[1], Table: table}
+			if pattern.MatchString(table) && !expectedSet[l] {
+				extra = append(extra, l)
+			}
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		return extra[i].String() < extra[j].String()
+	})
+	return missing, extra
+}
+
+func (n *Namespace) showBackendTables(slice, db string) (map[string]bool, error) {
+	s := n.GetSlice(slice)
+	if s == nil {
+		return nil, fmt.Errorf("slice not found: %s", slice)
+	}
+	pc, err := s.GetMasterConn()
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Recycle()
+	sql := fmt.Sprintf("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = '%s'", mysql.Escape(db))
+	r, err := pc.Execute(sql)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]bool)
+	if r.Resultset == nil {
+		return tables, nil
+	}
+	for i := range r.Values {
+		table, err := r.GetString(i, 0)
+		if err != nil {
+			return nil, err
+		}
+		tables[strings.ToLower(table)] = true
+	}
+	return tables, nil
+}
+
+func (n *Namespace) createMissingShardTables(expected, missing []ShardTableLocation, found map[string]map[string]bool) ([]ShardTableLocation, error) {
+	var template *ShardTableLocation
+	for i, l := range expected {
+		if found[l.Slice+":"+l.DB][l.Table] {
+			template = &expected[i]
+			break
+		}
+	}
+	if template == nil {
+		return nil, fmt.Errorf("no existing physical table as template")
+	}
+	ddl, err := n.showCreateTable(*template)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []ShardTableLocation
+	for _, l := range missing {
+		sql, err := rewriteCreateTable(ddl, l.DB, l.Table)
+		if err != nil {
+			return created, err
+		}
+		if err := n.executeOnSliceMaster(l.Slice, sql); err != nil {
+			return created, fmt.Errorf("create %s failed: %v", l, err)
+		}
+		log.Infof("create missing shard table, namespace: %s, table: %s", n.name, l)
+		created = append(created, l)
+	}
+	return created, nil
+}
+
+func (n *Namespace) showCreateTable(l ShardTableLocation) (string, error) {
+	s := n.GetSlice(l.Slice)
+	if s == nil {
+		return "", fmt.Errorf("slice not found: %s", l.Slice)
+	}
+	pc, err := s.GetMasterConn()
+	if err != nil {
+		return "", err
+	}
+	defer pc.Recycle()
+	r, err := pc.Execute(fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", l.DB, l.Table))
+	if err != nil {
+		return "", err
+	}
+	if r.Resultset == nil || len(r.Values) == 0 {
+		return "", fmt.Errorf("show create table %s returns empty", l)
+	}
+	return r.GetString(0, 1)
+}
+
+func (n *Namespace) executeOnSliceMaster(slice, sql string) error {
+	s := n.GetSlice(slice)
+	if s == nil {
+		return fmt.Errorf("slice not found: %s", slice)
+	}
+	pc, err := s.GetMasterConn()
+	if err != nil {
+		return err
+	}
+	defer pc.Recycle()
+	_, err = pc.Execute(sql)
+	return err
+}
+
+// rewriteCreateTable replace table name in output of SHOW CREATE TABLE with db.table
+func rewriteCreateTable(ddl, db, table string) (string, error) {
+	const prefix = "CREATE TABLE "
+	if !strings.HasPrefix(ddl, prefix) {
+		return "", fmt.Errorf("unsupported create table statement: %s", ddl)
+	}
+	body := strings.TrimPrefix(ddl, prefix)
+	idx := strings.Index(body, " (")
+	if idx < 0 {
+		return "", fmt.Errorf("unsupported create table statement: %s", ddl)
+	}
+	body = createTableAutoIncrementRegexp.ReplaceAllString(body[idx:], "")
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s`%s", db, table, body), nil
+}
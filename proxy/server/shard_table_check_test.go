@@ -0,0 +1,103 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+func prepareShardTableCheckRouter(t *testing.T) *router.Router {
+	ns := &models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: "mod", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+			{DB: "db_mycat", Table: "tbl_mycat", Type: "mycat_mod", Key: "id", Locations: []int{1, 1}, Slices: []string{"slice-0", "slice-1"}, Databases: []string{"db_mycat_[0-1]"}},
+		},
+	}
+	rt, err := router.NewRouter(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+func TestExpectedShardTables(t *testing.T) {
+	rt := prepareShardTableCheckRouter(t)
+	rules := rt.GetRules()
+	if len(rules) != 2 || rules[0].GetTable() != "tbl_ks" || rules[1].GetTable() != "tbl_mycat" {
+		t.Fatalf("rules not sorted: %v", rules)
+	}
+
+	actual, err := expectedShardTables(rules[0], map[string]string{"db_ks": "db_ks_phy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []ShardTableLocation{
+		{"slice-0", "db_ks_phy", "tbl_ks_0000"}, {"slice-0", "db_ks_phy", "tbl_ks_0001"},
+		{"slice-1", "db_ks_phy", "tbl_ks_0002"}, {"slice-1", "db_ks_phy", "tbl_ks_0003"},
+	}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("kingshard tables not match, expect: %v, actual: %v", expect, actual)
+	}
+
+	actual, err = expectedShardTables(rules[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = []ShardTableLocation{{"slice-0", "db_mycat_0", "tbl_mycat"}, {"slice-1", "db_mycat_1", "tbl_mycat"}}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("mycat tables not match, expect: %v, actual: %v", expect, actual)
+	}
+}
+
+func TestDiffShardTables(t *testing.T) {
+	rt := prepareShardTableCheckRouter(t)
+	rule := rt.GetRules()[0]
+	expected, err := expectedShardTables(rule, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]map[string]bool{
+		"slice-0:db_ks": {"tbl_ks_0000": true, "tbl_ks_0001": true, "tbl_ks_0002": true, "tbl_other": true},
+		"slice-1:db_ks": {"tbl_ks_0003": true, "tbl_ks_bak": true},
+	}
+	missing, extra := diffShardTables(rule, expected, found)
+	if !reflect.DeepEqual(missing, []ShardTableLocation{{"slice-1", "db_ks", "tbl_ks_0002"}}) {
+		t.Errorf("missing tables not match: %v", missing)
+	}
+	if !reflect.DeepEqual(extra, []ShardTableLocation{{"slice-0", "db_ks", "tbl_ks_0002"}}) {
+		t.Errorf("extra tables not match: %v", extra)
+	}
+}
+
+func TestRewriteCreateTable(t *testing.T) {
+	ddl := "CREATE TABLE `tbl_ks_0000` (\n  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB AUTO_INCREMENT=1024 DEFAULT CHARSET=utf8mb4"
+	expect := "CREATE TABLE IF NOT EXISTS `db_ks`.`tbl_ks_0003` (\n  `id` bigint(20) NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`id`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	actual, err := rewriteCreateTable(ddl, "db_ks", "tbl_ks_0003")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expect {
+		t.Errorf("create table not match, expect: %s, actual: %s", expect, actual)
+	}
+	if _, err := rewriteCreateTable("CREATE VIEW `v` AS SELECT 1", "db", "t"); err == nil {
+		t.Error("expect error for non create table statement")
+	}
+}
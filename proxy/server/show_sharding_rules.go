@@ -0,0 +1,74 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util/hack"
+)
+
+// 查看当前namespace的分片规则, 继承基础规则的规则显示展开后的配置
+const showShardingRulesSQL = "show sharding rules"
+
+var shardingRulesColumns = []string{"Db", "Table", "Type", "Key", "Extends", "Locations", "Slices", "Date_range", "Parent_table"}
+
+func isShowShardingRules(sql string) bool {
+	return strings.Join(strings.Fields(strings.ToLower(sql)), " ") == showShardingRulesSQL
+}
+
+// getShowShardingRules return shard rules and default shard rule of each table pattern.
+// 默认分片模板匹配所有逻辑库, 库名显示为*
+func getShowShardingRules(cfg *models.Namespace) []*models.Shard {
+	rules := append([]*models.Shard(nil), cfg.ShardRules...)
+	if t := cfg.DefaultShardRule; t != nil {
+		for _, pattern := range t.Tables {
+			shard := *t.Rule
+			shard.DB, shard.Table = "*", pattern
+			rules = append(rules, &shard)
+		}
+	}
+	return rules
+}
+
+func (se *SessionExecutor) handleShowShardingRules() (*mysql.Result, error) {
+	r := new(mysql.Resultset)
+	for _, column := range shardingRulesColumns {
+		field := &mysql.Field{}
+		field.Name = hack.Slice(column)
+		r.Fields = append(r.Fields, field)
+	}
+
+	for _, s := range se.GetNamespace().shardRules {
+		locations := make([]string, 0, len(s.Locations))
+		for _, l := range s.Locations {
+			locations = append(locations, strconv.Itoa(l))
+		}
+		r.Values = append(r.Values, []interface{}{s.DB, s.Table, s.Type, s.Key, s.Extends,
+			strings.Join(locations, ","), strings.Join(s.Slices, ","), strings.Join(s.DateRange, ","), s.ParentTable})
+	}
+
+	result := &mysql.Result{
+		Resultset: r,
+	}
+	if err := plan.GenerateSelectResultRowData(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func TestShowShardingRules(t *testing.T) {
+	for sql, expect := range map[string]bool{
+		"show sharding rules":     true,
+		"SHOW  SHARDING\nRULES":   true,
+		"show sharding rule":      false,
+		"show sharding rules foo": false,
+	} {
+		if isShowShardingRules(sql) != expect {
+			t.Errorf("isShowShardingRules(%q), expect: %v", sql, expect)
+		}
+	}
+
+	cfg := &models.Namespace{
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "t_order", Type: "mod", Key: "user_id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}, Extends: "by_user"},
+			{DB: "db_ks", Table: "t_item", Type: "linked", Key: "user_id", ParentTable: "t_order"},
+		},
+		DefaultShardRule: &models.DefaultShardRule{
+			Tables: []string{"t_log_*"},
+			Rule:   &models.Shard{Type: "hash", Key: "id", Locations: []int{4}, Slices: []string{"slice-1"}},
+		},
+	}
+	ns := &Namespace{
+		name:       "test_namespace",
+		shardRules: getShowShardingRules(cfg),
+	}
+	m := newTestManager(ns)
+	se := newSessionExecutor(m)
+	se.namespace = ns.name
+
+	r, err := se.handleShowShardingRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]interface{}{
+		{"db_ks", "t_order", "mod", "user_id", "by_user", "2,2", "slice-0,slice-1", "", ""},
+		{"db_ks", "t_item", "linked", "user_id", "", "", "", "", "t_order"},
+		{"*", "t_log_*", "hash", "id", "", "4", "slice-1", "", ""},
+	}
+	if len(r.Fields) != len(shardingRulesColumns) || !reflect.DeepEqual(r.Values, expect) {
+		t.Errorf("show sharding rules, expect: %v, actual: %v", expect, r.Values)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// checkSQLLimits check length and IN list size of sql before parsing, return ER_NET_PACKET_TOO_LARGE if exceeds
+func (n *Namespace) checkSQLLimits(sql string) error {
+	if n.maxSQLLength > 0 && len(sql) > n.maxSQLLength {
+		return mysql.NewError(mysql.ErrNetPacketTooLarge,
+			fmt.Sprintf("statement length %d exceeds max_sql_length %d of namespace", len(sql), n.maxSQLLength))
+	}
+	if n.maxInListSize > 0 {
+		if size := parser.MaxInListSize(sql); size > n.maxInListSize {
+			return mysql.NewError(mysql.ErrNetPacketTooLarge,
+				fmt.Sprintf("IN list size %d exceeds max_in_list_size %d of namespace", size, n.maxInListSize))
+		}
+	}
+	return nil
+}
+
+func newParseLimits(cfg *models.Namespace) parser.ParseLimits {
+	return parser.ParseLimits{
+		Timeout:  time.Duration(cfg.ParseTimeout) * time.Millisecond,
+		MaxDepth: cfg.MaxASTDepth,
+		MaxNodes: cfg.MaxASTNodes,
+	}
+}
+
+// parseLimitSQLError convert error of exceeding parse limits to mysql error, return nil for other errors
+func parseLimitSQLError(err error) error {
+	var e *parser.ParseLimitError
+	if !errors.As(err, &e) {
+		return nil
+	}
+	switch e.Limit {
+	case parser.LimitParseTimeout:
+		return mysql.NewError(mysql.ErrQueryInterrupted, e.Error())
+	case parser.LimitMaxASTDepth:
+		return mysql.NewError(mysql.ErrTooHighLevelOfNestingForSelect, e.Error())
+	default:
+		return mysql.NewError(mysql.ErrTooBigSelect, e.Error())
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestMaxInListSize(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect int
+	}{
+		{"select * from t where id = 1", 0},
+		{"select * from t where id in (1, 2, 3)", 3},
+		{"select * from t where id IN(1,2) and name not in ('a', 'b', 'c', 'd')", 4},
+		{"select * from t where (a, b) in ((1, 2), (3, 4))", 2},
+		{"select * from t where id in (select id from t2 where x in (1, 2, 3, 4, 5))", 5},
+		{"select * from t where name in ('a,b,c', 'd')", 2},
+		{"select * from t where `in` = (1) and f(1, 2, 3)", 0},
+		{"select * from t where id in /* (1,2,3) */ (1, 2)", 2},
+		{"select * from t where login in (1, 2, 3)", 3},
+		{"select * from t where id in (1, 2, 3", 3},
+		{"select * from t where id in (1, 2, 'abc", 3},
+	}
+	for _, test := range tests {
+		if actual := parser.MaxInListSize(test.sql); actual != test.expect {
+			t.Errorf("sql: %s, expect: %d, actual: %d", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestCheckSQLLimits(t *testing.T) {
+	values := strings.Repeat("1,", 100) + "1"
+	sql := "select * from t where id in (" + values + ")"
+
+	ns := &Namespace{}
+	if err := ns.checkSQLLimits(sql); err != nil {
+		t.Fatalf("no limit, err: %v", err)
+	}
+
+	ns = &Namespace{maxSQLLength: 64}
+	err := ns.checkSQLLimits(sql)
+	if se, ok := err.(*mysql.SQLError); !ok || se.Code != mysql.ErrNetPacketTooLarge || !strings.Contains(se.Message, "max_sql_length") {
+		t.Errorf("length limit error not match: %v", err)
+	}
+
+	ns = &Namespace{maxSQLLength: 1024, maxInListSize: 100}
+	err = ns.checkSQLLimits(sql)
+	if se, ok := err.(*mysql.SQLError); !ok || se.Code != mysql.ErrNetPacketTooLarge || !strings.Contains(se.Message, "IN list size 101") {
+		t.Errorf("in list limit error not match: %v", err)
+	}
+
+	ns.maxInListSize = 101
+	if err := ns.checkSQLLimits(sql); err != nil {
+		t.Errorf("sql within limits, err: %v", err)
+	}
+}
+
+func TestMaxParenDepth(t *testing.T) {
+	tests := []struct {
+		sql    string
+		expect int
+	}{
+		{"select 1", 0},
+		{"select (1 + (2 * 3)) from t where id in (1, 2)", 2},
+		{"select * from t where a = '((((' and b = (1)", 1},
+		{"select /* (((( */ f(g(h(1))) from t", 3},
+		{"select ((((1", 4},
+	}
+	for _, test := range tests {
+		if actual := parser.MaxParenDepth(test.sql); actual != test.expect {
+			t.Errorf("sql: %s, expect: %d, actual: %d", test.sql, test.expect, actual)
+		}
+	}
+}
+
+func TestParseWithLimits(t *testing.T) {
+	nested := "select " + strings.Repeat("(", 50) + "1" + strings.Repeat(")", 50) + " from t"
+	tests := []struct {
+		sql    string
+		limits parser.ParseLimits
+		code   uint16
+		limit  string
+	}{
+		{nested, parser.ParseLimits{}, 0, ""},
+		{nested, parser.ParseLimits{MaxDepth: 10}, mysql.ErrTooHighLevelOfNestingForSelect, parser.LimitMaxASTDepth},
+		{"select a + b + c + d + e from t", parser.ParseLimits{MaxDepth: 5}, mysql.ErrTooHighLevelOfNestingForSelect, parser.LimitMaxASTDepth},
+		{"select a, b, c, d, e from t where id in (1, 2, 3)", parser.ParseLimits{MaxNodes: 10}, mysql.ErrTooBigSelect, parser.LimitMaxASTNodes},
+		{"select a, b from t where id = 1", parser.ParseLimits{MaxDepth: 100, MaxNodes: 100, Timeout: time.Second}, 0, ""},
+	}
+	for _, test := range tests {
+		_, err := parser.ParseWithLimits(parser.NewSQLParser(), test.sql, test.limits)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("sql: %s, limits: %+v, unexpected error: %v", test.sql, test.limits, err)
+			}
+			continue
+		}
+		se, ok := parseLimitSQLError(err).(*mysql.SQLError)
+		if !ok || se.Code != test.code || !strings.Contains(se.Message, test.limit) {
+			t.Errorf("sql: %s, limits: %+v, error not match: %v", test.sql, test.limits, err)
+		}
+	}
+
+	// 解析超时后parser不能再使用
+	big := "select * from t where id in (" + strings.Repeat("1,", 200000) + "1)"
+	_, err := parser.ParseWithLimits(parser.NewSQLParser(), big, parser.ParseLimits{Timeout: time.Millisecond})
+	if !parser.IsParseTimeout(err) {
+		t.Fatalf("expect parse timeout, got: %v", err)
+	}
+	if se, ok := parseLimitSQLError(err).(*mysql.SQLError); !ok || se.Code != mysql.ErrQueryInterrupted {
+		t.Errorf("timeout error not match: %v", err)
+	}
+
+	if parseLimitSQLError(fmt.Errorf("syntax error")) != nil {
+		t.Errorf("syntax error should not be converted")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// stateSnapshotVersion 快照格式版本, 版本不一致时忽略快照
+const stateSnapshotVersion = 1
+
+// StateSnapshot state persisted on shutdown and restored on start, so a restarted proxy does not rebuild them from scratch.
+// Only non-critical state is included, losing it affects performance and statistics only
+type StateSnapshot struct {
+	Version    int                                `json:"version"`
+	Time       time.Time                          `json:"time"`
+	Namespaces map[string]*NamespaceStateSnapshot `json:"namespaces"`
+}
+
+// NamespaceStateSnapshot state of one namespace
+type NamespaceStateSnapshot struct {
+	ConfigMD5         string            `json:"config_md5"`
+	SlowSQL           map[string]string `json:"slow_sql"`
+	ErrorSQL          map[string]string `json:"error_sql"`
+	BackendSlowSQL    map[string]string `json:"backend_slow_sql"`
+	BackendErrorSQL   map[string]string `json:"backend_error_sql"`
+	IdempotencyTables []string          `json:"idempotency_tables"` // 已创建幂等键表的slice.db
+}
+
+// SaveStateSnapshot write state of current namespaces to file atomically
+func (m *Manager) SaveStateSnapshot(path string) error {
+	current, _, _ := m.switchIndex.Get()
+	snapshot := &StateSnapshot{
+		Version:    stateSnapshotVersion,
+		Time:       time.Now(),
+		Namespaces: make(map[string]*NamespaceStateSnapshot),
+	}
+	for name, ns := range m.namespaces[current].GetNamespaces() {
+		snapshot.Namespaces[name] = ns.stateSnapshot()
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名, 避免退出过程中被中断留下不完整的快照
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadStateSnapshot restore state of current namespaces from file, do nothing if file not exists
+func (m *Manager) LoadStateSnapshot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	snapshot := &StateSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return fmt.Errorf("invalid state snapshot: %v", err)
+	}
+	if snapshot.Version != stateSnapshotVersion {
+		return fmt.Errorf("unsupported state snapshot version: %d", snapshot.Version)
+	}
+
+	current, _, _ := m.switchIndex.Get()
+	var restored int
+	for name, ns := range m.namespaces[current].GetNamespaces() {
+		if s, ok := snapshot.Namespaces[name]; ok {
+			ns.restoreStateSnapshot(s)
+			restored++
+		}
+	}
+	log.Infof("restore state snapshot, path: %s, saved at: %s, namespaces: %d", path, snapshot.Time.Format(time.RFC3339), restored)
+	return nil
+}
+
+func (n *Namespace) stateSnapshot() *NamespaceStateSnapshot {
+	s := &NamespaceStateSnapshot{
+		ConfigMD5:       n.configMD5,
+		SlowSQL:         n.GetSlowSQLFingerprints(),
+		ErrorSQL:        n.GetErrorSQLFingerprints(),
+		BackendSlowSQL:  n.GetBackendSlowSQLFingerprints(),
+		BackendErrorSQL: n.GetBackendErrorSQLFingerprints(),
+	}
+	n.idempotencyTables.Range(func(k, v interface{}) bool {
+		s.IdempotencyTables = append(s.IdempotencyTables, k.(string))
+		return true
+	})
+	sort.Strings(s.IdempotencyTables)
+	return s
+}
+
+// restoreStateSnapshot SQL指纹总是恢复, 依赖后端结构的状态只在配置未变化时恢复
+func (n *Namespace) restoreStateSnapshot(s *NamespaceStateSnapshot) {
+	for md5, fingerprint := range s.SlowSQL {
+		n.SetSlowSQLFingerprint(md5, fingerprint)
+	}
+	for md5, fingerprint := range s.ErrorSQL {
+		n.SetErrorSQLFingerprint(md5, fingerprint)
+	}
+	for md5, fingerprint := range s.BackendSlowSQL {
+		n.SetBackendSlowSQLFingerprint(md5, fingerprint)
+	}
+	for md5, fingerprint := range s.BackendErrorSQL {
+		n.SetBackendErrorSQLFingerprint(md5, fingerprint)
+	}
+	if s.ConfigMD5 != n.configMD5 {
+		return
+	}
+	for _, key := range s.IdempotencyTables {
+		n.idempotencyTables.Store(key, true)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/util/cache"
+)
+
+func newStateSnapshotManager(configMD5 string) *Manager {
+	ns := &Namespace{
+		name:                 "test_namespace",
+		configMD5:            configMD5,
+		slowSQLCache:         cache.NewLRUCache(defaultSQLCacheCapacity),
+		errorSQLCache:        cache.NewLRUCache(defaultSQLCacheCapacity),
+		backendSlowSQLCache:  cache.NewLRUCache(defaultSQLCacheCapacity),
+		backendErrorSQLCache: cache.NewLRUCache(defaultSQLCacheCapacity),
+	}
+	return newTestManager(ns)
+}
+
+func TestStateSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_state_snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	m := newStateSnapshotManager("md5")
+	// 快照文件不存在时忽略
+	if err := m.LoadStateSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	ns := m.GetNamespace("test_namespace")
+	ns.SetSlowSQLFingerprint("md5-slow", "SELECT * FROM t WHERE id = ?")
+	ns.SetBackendErrorSQLFingerprint("md5-error", "UPDATE t SET a = ?")
+	ns.idempotencyTables.Store("slice-0.db_ks", true)
+	if err := m.SaveStateSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newStateSnapshotManager("md5")
+	if err := restored.LoadStateSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	rns := restored.GetNamespace("test_namespace")
+	if fp, ok := rns.GetSlowSQLFingerprint("md5-slow"); !ok || fp != "SELECT * FROM t WHERE id = ?" {
+		t.Errorf("slow sql fingerprint not restored, got: %s", fp)
+	}
+	if fp, ok := rns.GetBackendErrorSQLFingerprint("md5-error"); !ok || fp != "UPDATE t SET a = ?" {
+		t.Errorf("backend error sql fingerprint not restored, got: %s", fp)
+	}
+	if _, ok := rns.idempotencyTables.Load("slice-0.db_ks"); !ok {
+		t.Errorf("idempotency table not restored")
+	}
+
+	// 配置变化后不恢复依赖后端结构的状态
+	changed := newStateSnapshotManager("changed")
+	cns := changed.GetNamespace("test_namespace")
+	if err := changed.LoadStateSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cns.GetSlowSQLFingerprint("md5-slow"); !ok {
+		t.Errorf("slow sql fingerprint should be restored")
+	}
+	if _, ok := cns.idempotencyTables.Load("slice-0.db_ks"); ok {
+		t.Errorf("idempotency table should not be restored after config changed")
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"version":100}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := changed.LoadStateSnapshot(path); err == nil {
+		t.Errorf("expect error of unsupported version")
+	}
+}
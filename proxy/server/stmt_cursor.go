@@ -0,0 +1,74 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+// stmtCursor 预处理语句的只读游标, 执行结果缓存在proxy中, 由COM_STMT_FETCH分批返回
+type stmtCursor struct {
+	rows []mysql.RowData // 二进制协议的行数据
+	pos  int
+}
+
+// StmtFetchResult COM_STMT_FETCH返回的行数据
+type StmtFetchResult struct {
+	Rows []mysql.RowData
+	Last bool // 游标中的行已经全部返回, 游标已关闭
+}
+
+func newStmtCursor(rows []mysql.RowData) *stmtCursor {
+	return &stmtCursor{rows: rows}
+}
+
+// fetch 返回最多n行数据, 以及游标中的行是否已经全部返回
+func (c *stmtCursor) fetch(n int) ([]mysql.RowData, bool) {
+	end := c.pos + n
+	if n <= 0 || end > len(c.rows) {
+		end = len(c.rows)
+	}
+	rows := c.rows[c.pos:end]
+	c.pos = end
+	return rows, c.pos >= len(c.rows)
+}
+
+// https://dev.mysql.com/doc/internals/en/com-stmt-fetch.html
+func (se *SessionExecutor) handleStmtFetch(data []byte) (*StmtFetchResult, error) {
+	if len(data) < 8 {
+		return nil, mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+	numRows := binary.LittleEndian.Uint32(data[4:8])
+
+	s, ok := se.stmts[id]
+	if !ok {
+		return nil, mysql.NewDefaultError(mysql.ErrUnknownStmtHandler,
+			strconv.FormatUint(uint64(id), 10), "stmt_fetch")
+	}
+	if s.cursor == nil {
+		return nil, mysql.NewDefaultError(mysql.ErrStmtHasNoOpenCursor, id)
+	}
+
+	rows, last := s.cursor.fetch(int(numRows))
+	if last {
+		s.cursor = nil
+	}
+	return &StmtFetchResult{Rows: rows, Last: last}, nil
+}
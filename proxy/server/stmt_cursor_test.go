@@ -0,0 +1,68 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func TestStmtCursorFetch(t *testing.T) {
+	se := newSessionExecutor(nil)
+	s := &Stmt{id: 1}
+	se.stmts[s.id] = s
+
+	newFetchData := func(numRows uint32) []byte {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint32(data[0:4], s.id)
+		binary.LittleEndian.PutUint32(data[4:8], numRows)
+		return data
+	}
+
+	if _, err := se.handleStmtFetch(newFetchData(2)); err == nil {
+		t.Fatalf("expect error when fetch without open cursor")
+	} else if sqlErr, ok := err.(*mysql.SQLError); !ok || sqlErr.SQLCode() != mysql.ErrStmtHasNoOpenCursor {
+		t.Fatalf("expect no open cursor error, actual: %v", err)
+	}
+
+	s.cursor = newStmtCursor([]mysql.RowData{[]byte("a"), []byte("b"), []byte("c")})
+	tests := []struct {
+		numRows uint32
+		expect  []string
+		last    bool
+	}{
+		{2, []string{"a", "b"}, false},
+		{2, []string{"c"}, true},
+	}
+	for _, test := range tests {
+		r, err := se.handleStmtFetch(newFetchData(test.numRows))
+		if err != nil {
+			t.Fatalf("fetch error: %v", err)
+		}
+		if len(r.Rows) != len(test.expect) || r.Last != test.last {
+			t.Fatalf("fetch result not equal, expect: %v %v, actual: %v %v", test.expect, test.last, len(r.Rows), r.Last)
+		}
+		for i, row := range r.Rows {
+			if string(row) != test.expect[i] {
+				t.Errorf("fetch row not equal, expect: %s, actual: %s", test.expect[i], string(row))
+			}
+		}
+	}
+	if s.cursor != nil {
+		t.Errorf("expect cursor closed after last row sent")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+// gaeaAllowDangerousSQLVariable 会话中允许执行strict_mode拒绝的危险语句
+const gaeaAllowDangerousSQLVariable = "gaea_allow_dangerous_sql"
+
+func (se *SessionExecutor) setAllowDangerousSQLVariable(value string) error {
+	onOffValue, err := getOnOffVariable(value)
+	if err != nil {
+		return err
+	}
+	se.allowDangerousSQL = onOffValue == "1"
+	return nil
+}
+
+// checkDangerousSQL namespace开启strict_mode时拒绝没有WHERE的UPDATE/DELETE, TRUNCATE分片表以及DROP语句,
+// 会话设置gaea_allow_dangerous_sql = on或用户的admin_role为admin时允许执行
+func (se *SessionExecutor) checkDangerousSQL(stmtType parser.StatementType, sql string) error {
+	switch stmtType {
+	case parser.StmtUpdate, parser.StmtDelete, parser.StmtDDL:
+	default:
+		return nil
+	}
+	ns := se.GetNamespace()
+	if !ns.strictMode || se.allowDangerousSQL || ns.HasAdminRole(se.user, models.AdminRoleAdmin) {
+		return nil
+	}
+	// 无法解析的语句由后续流程处理
+	n, err := se.Parse(sql)
+	if err != nil {
+		return nil
+	}
+	reason := getDangerousStmtReason(n, se.db, ns.GetRouter())
+	if reason == "" {
+		return nil
+	}
+	exeLogger.Warnf("dangerous statement rejected by strict mode, ns: %s, user: %s, reason: %s, sql: %s", ns.GetName(), se.user, reason, ns.redactSQL(sql))
+	var code uint16 = mysql.ErrSpecificAccessDenied
+	if stmtType != parser.StmtDDL {
+		code = mysql.ErrUpdateWithoutKeyInSafeMode
+	}
+	return mysql.NewError(code, fmt.Sprintf("gaea strict mode does not allow %s, set %s = on to override", reason, gaeaAllowDangerousSQLVariable))
+}
+
+// getDangerousStmtReason 返回语句被strict_mode拒绝的原因, 不是危险语句时返回空字符串
+func getDangerousStmtReason(n ast.StmtNode, db string, rt *router.Router) string {
+	switch stmt := n.(type) {
+	case *ast.UpdateStmt:
+		if stmt.Where == nil {
+			return "UPDATE without WHERE"
+		}
+	case *ast.DeleteStmt:
+		if stmt.Where == nil {
+			return "DELETE without WHERE"
+		}
+	case *ast.TruncateTableStmt:
+		tableDB := stmt.Table.Schema.O
+		if tableDB == "" {
+			tableDB = db
+		}
+		if _, ok := rt.GetShardRule(tableDB, stmt.Table.Name.O); ok {
+			return "TRUNCATE of sharding table " + tableDB + "." + stmt.Table.Name.O
+		}
+	case *ast.DropTableStmt:
+		if stmt.IsView {
+			return "DROP VIEW"
+		}
+		return "DROP TABLE"
+	case *ast.DropDatabaseStmt:
+		return "DROP DATABASE"
+	case *ast.DropIndexStmt:
+		return "DROP INDEX"
+	}
+	return ""
+}
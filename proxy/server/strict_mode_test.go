@@ -0,0 +1,121 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/router"
+)
+
+func newStrictModeExecutor(t *testing.T) *SessionExecutor {
+	cfg := &models.Namespace{
+		Name:         "test_namespace",
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: "mod", Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		},
+	}
+	rt, err := router.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &Namespace{
+		name:           cfg.Name,
+		router:         rt,
+		strictMode:     true,
+		userProperties: map[string]*UserProperty{"test_user": {RWFlag: models.ReadWrite}},
+	}
+	m := newTestManager(ns)
+
+	se := newSessionExecutor(m)
+	se.namespace = ns.name
+	se.user = "test_user"
+	se.db = "db_ks"
+	return se
+}
+
+func TestCheckDangerousSQL(t *testing.T) {
+	se := newStrictModeExecutor(t)
+	ns := se.GetNamespace()
+
+	tests := []struct {
+		sql  string
+		code uint16 // 0表示允许执行
+	}{
+		{"update tbl_ks set a = 1", mysql.ErrUpdateWithoutKeyInSafeMode},
+		{"delete from tbl_ks", mysql.ErrUpdateWithoutKeyInSafeMode},
+		{"delete from tbl_ks limit 10", mysql.ErrUpdateWithoutKeyInSafeMode},
+		{"update tbl_ks set a = 1 where id = 1", 0},
+		{"delete from tbl_ks where id = 1", 0},
+		{"insert into tbl_ks (id) values (1)", 0},
+		{"truncate table tbl_ks", mysql.ErrSpecificAccessDenied},
+		{"truncate table db_ks.tbl_ks", mysql.ErrSpecificAccessDenied},
+		{"truncate table tbl_unshard", 0},
+		{"drop table tbl_unshard", mysql.ErrSpecificAccessDenied},
+		{"drop view v1", mysql.ErrSpecificAccessDenied},
+		{"drop database db_ks", mysql.ErrSpecificAccessDenied},
+		{"drop index idx_a on tbl_ks", mysql.ErrSpecificAccessDenied},
+		{"alter table tbl_ks add column b int", 0},
+		{"select * from tbl_ks", 0},
+	}
+	for _, test := range tests {
+		err := se.checkDangerousSQL(parser.PreviewSql(test.sql), test.sql)
+		if test.code == 0 {
+			if err != nil {
+				t.Errorf("statement should be allowed, sql: %s, err: %v", test.sql, err)
+			}
+			continue
+		}
+		if e, ok := err.(*mysql.SQLError); !ok || e.SQLCode() != test.code {
+			t.Errorf("statement should be rejected, sql: %s, expect code: %d, err: %v", test.sql, test.code, err)
+		}
+	}
+
+	// 会话覆盖
+	if err := se.setAllowDangerousSQLVariable("on"); err != nil {
+		t.Fatal(err)
+	}
+	if err := se.checkDangerousSQL(parser.StmtDelete, "delete from tbl_ks"); err != nil {
+		t.Errorf("statement should be allowed with %s = on, err: %v", gaeaAllowDangerousSQLVariable, err)
+	}
+	if err := se.setAllowDangerousSQLVariable("off"); err != nil {
+		t.Fatal(err)
+	}
+	if err := se.setAllowDangerousSQLVariable("yes"); err == nil {
+		t.Errorf("invalid value of %s should be rejected", gaeaAllowDangerousSQLVariable)
+	}
+
+	// admin角色的用户
+	ns.userProperties[se.user].AdminRole = models.AdminRoleOperator
+	if err := se.checkDangerousSQL(parser.StmtDDL, "drop table tbl_ks"); err == nil {
+		t.Errorf("statement should be rejected for operator role")
+	}
+	ns.userProperties[se.user].AdminRole = models.AdminRoleAdmin
+	if err := se.checkDangerousSQL(parser.StmtDDL, "drop table tbl_ks"); err != nil {
+		t.Errorf("statement should be allowed for admin role, err: %v", err)
+	}
+
+	// 未开启strict_mode
+	ns.userProperties[se.user].AdminRole = ""
+	ns.strictMode = false
+	if err := se.checkDangerousSQL(parser.StmtDDL, "drop table tbl_ks"); err != nil {
+		t.Errorf("statement should be allowed without strict mode, err: %v", err)
+	}
+}
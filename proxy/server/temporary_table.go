@@ -0,0 +1,201 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// 临时表固定创建在default slice上, 会话存在临时表期间独占一个default slice的主库连接,
+// 非分片语句都通过该连接执行, 因此后续引用临时表的语句都能访问到临时表, 会话断开时关闭该连接, 由后端删除临时表
+
+// temporaryTablePlan wrap plan of CREATE/DROP TABLE, maintain temporary tables of session after executed
+type temporaryTablePlan struct {
+	plan.Plan
+
+	se     *SessionExecutor
+	tables []string // key: db.table, 小写
+	create bool
+}
+
+// ExecuteIn implement Plan
+func (p *temporaryTablePlan) ExecuteIn(reqCtx *util.RequestContext, e plan.Executor) (*mysql.Result, error) {
+	if p.create {
+		if err := p.se.pinTempConn(); err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := p.Plan.ExecuteIn(reqCtx, e)
+	if err == nil {
+		for _, t := range p.tables {
+			if p.create {
+				p.se.tempTables[t] = true
+			} else {
+				delete(p.se.tempTables, t)
+			}
+		}
+	}
+
+	p.se.unpinTempConnIfUnused()
+	return r, err
+}
+
+func tempTableKey(db string, t *ast.TableName) string {
+	if t.Schema.O != "" {
+		db = t.Schema.O
+	}
+	return strings.ToLower(db + "." + t.Name.O)
+}
+
+func (se *SessionExecutor) isTempTable(db string, t *ast.TableName) bool {
+	return len(se.tempTables) != 0 && se.tempTables[tempTableKey(db, t)]
+}
+
+// wrapTemporaryTablePlan 处理CREATE TEMPORARY TABLE和删除临时表的语句, 并检查临时表不能与分片表一起使用
+func (se *SessionExecutor) wrapTemporaryTablePlan(ns *Namespace, db string, stmt ast.StmtNode, p plan.Plan) (plan.Plan, error) {
+	rt := ns.GetRouter()
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		if !s.IsTemporary {
+			return p, nil
+		}
+		return &temporaryTablePlan{Plan: p, se: se, tables: []string{tempTableKey(db, s.Table)}, create: true}, nil
+	case *ast.DropTableStmt:
+		// DROP TABLE也会删除同名的临时表
+		var tables []string
+		for _, t := range s.Tables {
+			if se.isTempTable(db, t) {
+				tables = append(tables, tempTableKey(db, t))
+			}
+		}
+		if len(tables) == 0 {
+			return p, nil
+		}
+		return &temporaryTablePlan{Plan: p, se: se, tables: tables}, nil
+	}
+
+	if len(se.tempTables) == 0 {
+		return p, nil
+	}
+	tables := &tableNameCollector{}
+	parser.Visit(stmt, tables)
+	hasTempTable, hasShardTable := false, false
+	for _, t := range tables.names {
+		if se.isTempTable(db, t) {
+			hasTempTable = true
+			continue
+		}
+		tdb := t.Schema.O
+		if tdb == "" {
+			tdb = db
+		}
+		if _, ok := rt.GetShardRule(tdb, t.Name.O); ok {
+			hasShardTable = true
+		}
+	}
+	if hasTempTable && hasShardTable {
+		return nil, fmt.Errorf("temporary table can not be used with shard table")
+	}
+	return p, nil
+}
+
+// pinTempConn 创建临时表前独占default slice的主库连接, 事务中复用事务连接
+func (se *SessionExecutor) pinTempConn() error {
+	if se.tempTables == nil {
+		se.tempTables = make(map[string]bool)
+	}
+	if se.tempConn != nil {
+		return nil
+	}
+
+	se.txLock.Lock()
+	pc, ok := se.txConns[backend.DefaultSlice]
+	se.txLock.Unlock()
+	if ok {
+		se.tempConn = pc
+		return nil
+	}
+
+	pc, err := se.GetNamespace().GetSlice(backend.DefaultSlice).GetMasterConn()
+	if err != nil {
+		return err
+	}
+	se.tempConn = pc
+	return nil
+}
+
+// unpinTempConnIfUnused 会话不再有临时表时归还独占的连接, 事务中的连接由事务结束时归还
+func (se *SessionExecutor) unpinTempConnIfUnused() {
+	if se.tempConn == nil || len(se.tempTables) != 0 {
+		return
+	}
+	pc := se.tempConn
+	se.tempConn = nil
+	if se.isTxConn(pc) {
+		return
+	}
+	pc.Recycle()
+}
+
+// closeBackendConn close connection and drop it from pool, temporary tables are dropped if pc is the temporary connection
+func (se *SessionExecutor) closeBackendConn(pc backend.PooledConnect) {
+	if se.isTempConn(pc) {
+		se.tempConn = nil
+		se.tempTables = nil
+	}
+	pc.Close()
+	pc.Recycle()
+}
+
+// isTempConn check if pc is the connection holding temporary tables
+func (se *SessionExecutor) isTempConn(pc backend.PooledConnect) bool {
+	return se.tempConn != nil && pc == se.tempConn
+}
+
+func (se *SessionExecutor) isTxConn(pc backend.PooledConnect) bool {
+	se.txLock.Lock()
+	defer se.txLock.Unlock()
+	for _, c := range se.txConns {
+		if c == pc {
+			return true
+		}
+	}
+	return false
+}
+
+// closeTempTables 会话断开时关闭独占的连接, 后端随连接删除临时表, 关闭的连接不会回到连接池
+func (se *SessionExecutor) closeTempTables() {
+	if se.tempConn == nil {
+		return
+	}
+	if len(se.tempTables) != 0 {
+		logging.DefaultLogger.Debugf("close backend connection of temporary tables, ns: %s, tables: %v", se.namespace, se.tempTables)
+	}
+	se.tempConn.Close()
+	se.tempConn.Recycle()
+	se.tempConn = nil
+	se.tempTables = nil
+}
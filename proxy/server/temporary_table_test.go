@@ -0,0 +1,108 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/XiaoMi/Gaea/backend"
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+type fakeTempTablePlan struct {
+	executed int
+}
+
+func (p *fakeTempTablePlan) ExecuteIn(*util.RequestContext, plan.Executor) (*mysql.Result, error) {
+	p.executed++
+	return &mysql.Result{}, nil
+}
+
+func (p *fakeTempTablePlan) Size() int {
+	return 1
+}
+
+func TestTemporaryTable(t *testing.T) {
+	rt, err := router.NewRouter(&models.Namespace{
+		Slices:       []*models.Slice{{Name: "slice-0"}, {Name: "slice-1"}},
+		DefaultSlice: "slice-0",
+		ShardRules: []*models.Shard{
+			{DB: "db_ks", Table: "tbl_ks", Type: models.ShardMod, Key: "id", Locations: []int{2, 2}, Slices: []string{"slice-0", "slice-1"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &Namespace{router: rt}
+	se := &SessionExecutor{db: "db_ks", status: initClientConnStatus, txConns: make(map[string]backend.PooledConnect)}
+	pc := new(mocks.PooledConnect)
+	pc.On("Recycle").Return(nil)
+	pc.On("Close").Return(nil)
+	se.tempConn = pc
+
+	wrap := func(sql string) (plan.Plan, error) {
+		stmt, err := parser.ParseSQL(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return se.wrapTemporaryTablePlan(ns, se.db, stmt, &fakeTempTablePlan{})
+	}
+	execute := func(sql string) {
+		p, err := wrap(sql)
+		if err != nil {
+			t.Fatalf("wrap plan error, sql: %s, err: %v", sql, err)
+		}
+		if _, err := p.ExecuteIn(util.NewRequestContext(), se); err != nil {
+			t.Fatalf("execute plan error, sql: %s, err: %v", sql, err)
+		}
+	}
+
+	execute("create temporary table tmp_a (id int)")
+	if !se.tempTables["db_ks.tmp_a"] {
+		t.Fatalf("temporary table not recorded, tables: %v", se.tempTables)
+	}
+	if conn, _ := se.getBackendConn("slice-0", true); conn != pc {
+		t.Errorf("statements of default slice should use connection of temporary tables")
+	}
+
+	if p, err := wrap("select * from tmp_a"); err != nil {
+		t.Errorf("select temporary table error: %v", err)
+	} else if _, ok := p.(*fakeTempTablePlan); !ok {
+		t.Errorf("select temporary table should not be wrapped")
+	}
+	if _, err := wrap("select * from tmp_a a join tbl_ks b on a.id = b.id"); err == nil {
+		t.Errorf("temporary table can not be used with shard table")
+	}
+
+	execute("drop table tmp_a")
+	if len(se.tempTables) != 0 || se.tempConn != nil {
+		t.Errorf("temporary connection should be recycled after tables dropped, tables: %v", se.tempTables)
+	}
+	pc.AssertCalled(t, "Recycle")
+
+	se.tempConn = pc
+	se.tempTables = map[string]bool{"db_ks.tmp_b": true}
+	se.closeTempTables()
+	pc.AssertCalled(t, "Close")
+	if se.tempConn != nil || se.tempTables != nil {
+		t.Errorf("temporary tables should be cleared after session closed")
+	}
+}
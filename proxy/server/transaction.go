@@ -0,0 +1,264 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/XiaoMi/Gaea/logging"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+const defaultLongTransactionTime = 10 * time.Second
+
+// 事务结束的结果
+const (
+	txResultCommit       = "commit"
+	txResultCommitFailed = "commit_failed"
+	txResultRollback     = "rollback"
+)
+
+// lastTransactionID 事务ID, 进程内递增
+var lastTransactionID uint64
+
+// TransactionInfo open transaction, returned by admin api
+type TransactionInfo struct {
+	ID          uint64   `json:"id"`
+	ConnID      uint32   `json:"conn_id"`
+	Namespace   string   `json:"namespace"`
+	User        string   `json:"user"`
+	ClientAddr  string   `json:"client_addr"`
+	Statements  int      `json:"statements"`  // 已执行的语句数, 不包括BEGIN, COMMIT, ROLLBACK
+	Slices      []string `json:"slices"`      // 持有事务连接的slice
+	Fingerprint string   `json:"fingerprint"` // 第一条语句的指纹
+	Elapsed     int64    `json:"elapsed"`     // 单位: 毫秒, 事务开始至今的时间
+	Long        bool     `json:"long"`        // 超过long_transaction_time
+}
+
+// transaction 会话中进行中的事务, 会话和管理接口并发访问
+type transaction struct {
+	id         uint64
+	connID     uint32
+	namespace  string
+	user       string
+	clientAddr string
+	start      time.Time
+
+	lock        sync.Mutex
+	statements  int
+	fingerprint string
+	slices      []string
+	reported    bool // 长事务已输出过日志
+}
+
+func (t *transaction) addStatement(sql string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.statements++
+	if t.fingerprint == "" {
+		t.fingerprint = mysql.GetFingerprint(sql)
+	}
+}
+
+func (t *transaction) addSlice(slice string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.slices = append(t.slices, slice)
+}
+
+func (t *transaction) info(now time.Time, longTime time.Duration) TransactionInfo {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	slices := append([]string{}, t.slices...)
+	sort.Strings(slices)
+	return TransactionInfo{
+		ID:          t.id,
+		ConnID:      t.connID,
+		Namespace:   t.namespace,
+		User:        t.user,
+		ClientAddr:  t.clientAddr,
+		Statements:  t.statements,
+		Slices:      slices,
+		Fingerprint: t.fingerprint,
+		Elapsed:     int64(now.Sub(t.start) / time.Millisecond),
+		Long:        longTime > 0 && now.Sub(t.start) >= longTime,
+	}
+}
+
+// transactionTracker 记录各会话进行中的事务, 输出长事务日志
+type transactionTracker struct {
+	longTime time.Duration // 小于等于0时不检查长事务
+
+	lock sync.Mutex
+	txns map[uint32]*transaction // key: 前端连接ID
+}
+
+func newTransactionTracker(longTime time.Duration) *transactionTracker {
+	return &transactionTracker{
+		longTime: longTime,
+		txns:     make(map[uint32]*transaction),
+	}
+}
+
+// parseLongTransactionTime 0使用默认值, -1关闭
+func parseLongTransactionTime(cfg *models.Proxy) (time.Duration, error) {
+	switch {
+	case cfg.LongTransactionTime == 0:
+		return defaultLongTransactionTime, nil
+	case cfg.LongTransactionTime == -1:
+		return 0, nil
+	case cfg.LongTransactionTime < -1:
+		return 0, fmt.Errorf("invalid long_transaction_time: %d", cfg.LongTransactionTime)
+	}
+	return time.Duration(cfg.LongTransactionTime) * time.Millisecond, nil
+}
+
+// begin 开始事务并分配ID, tracker为nil时事务不登记
+func (tr *transactionTracker) begin(se *SessionExecutor) *transaction {
+	t := &transaction{
+		id:         atomic.AddUint64(&lastTransactionID, 1),
+		connID:     se.connID,
+		namespace:  se.namespace,
+		user:       se.user,
+		clientAddr: se.clientAddr,
+		start:      time.Now(),
+	}
+	if tr != nil {
+		tr.lock.Lock()
+		tr.txns[t.connID] = t
+		tr.lock.Unlock()
+	}
+	return t
+}
+
+// end 事务结束, 长事务输出日志
+func (tr *transactionTracker) end(t *transaction, result string) {
+	var longTime time.Duration
+	if tr != nil {
+		tr.lock.Lock()
+		if tr.txns[t.connID] == t {
+			delete(tr.txns, t.connID)
+		}
+		tr.lock.Unlock()
+		longTime = tr.longTime
+	}
+
+	info := t.info(time.Now(), longTime)
+	if info.Long {
+		logging.DefaultLogger.Warnf("[transaction] long transaction finished, id: %d, conn: %d, namespace: %s, user: %s, result: %s, duration: %dms, statements: %d, slices: %v, first statement: %s",
+			info.ID, info.ConnID, info.Namespace, info.User, result, info.Elapsed, info.Statements, info.Slices, info.Fingerprint)
+	}
+}
+
+// list 返回进行中的事务, namespace为空时返回所有namespace的事务
+func (tr *transactionTracker) list(namespace string) []TransactionInfo {
+	if tr == nil {
+		return nil
+	}
+	tr.lock.Lock()
+	txns := make([]*transaction, 0, len(tr.txns))
+	for _, t := range tr.txns {
+		if namespace == "" || t.namespace == namespace {
+			txns = append(txns, t)
+		}
+	}
+	tr.lock.Unlock()
+
+	now := time.Now()
+	infos := make([]TransactionInfo, 0, len(txns))
+	for _, t := range txns {
+		infos = append(infos, t.info(now, tr.longTime))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// reportLongTransactions 进行中的长事务输出一次日志, 由监控任务定时调用
+func (tr *transactionTracker) reportLongTransactions() {
+	if tr == nil || tr.longTime <= 0 {
+		return
+	}
+	tr.lock.Lock()
+	txns := make([]*transaction, 0, len(tr.txns))
+	for _, t := range tr.txns {
+		txns = append(txns, t)
+	}
+	tr.lock.Unlock()
+
+	now := time.Now()
+	for _, t := range txns {
+		info := t.info(now, tr.longTime)
+		if !info.Long {
+			continue
+		}
+		t.lock.Lock()
+		reported := t.reported
+		t.reported = true
+		t.lock.Unlock()
+		if !reported {
+			logging.DefaultLogger.Warnf("[transaction] long transaction, id: %d, conn: %d, namespace: %s, user: %s, client: %s, elapsed: %dms, statements: %d, slices: %v, first statement: %s",
+				info.ID, info.ConnID, info.Namespace, info.User, info.ClientAddr, info.Elapsed, info.Statements, info.Slices, info.Fingerprint)
+		}
+	}
+}
+
+// beginTransaction 进入事务时分配事务ID, 调用方持有txLock
+func (se *SessionExecutor) beginTransaction() {
+	if se.txn == nil {
+		se.txn = se.manager.getTransactionTracker().begin(se)
+	}
+}
+
+// endTransaction 事务提交或回滚后记录统计, 调用方持有txLock
+func (se *SessionExecutor) endTransaction(result string) {
+	if se.txn == nil {
+		return
+	}
+	elapsed := time.Since(se.txn.start)
+	se.manager.getTransactionTracker().end(se.txn, result)
+	if se.manager != nil && se.manager.statistics != nil {
+		se.manager.statistics.RecordTransaction(se.txn.namespace, result, elapsed)
+	}
+	se.txn = nil
+}
+
+// recordTransactionStatement 事务中执行的语句计数, 记录第一条语句的指纹
+func (se *SessionExecutor) recordTransactionStatement(stmtType parser.StatementType, sql string) {
+	switch stmtType {
+	case parser.StmtBegin, parser.StmtCommit, parser.StmtRollback:
+		return
+	}
+	se.txLock.Lock()
+	defer se.txLock.Unlock()
+	if se.txn != nil {
+		se.txn.addStatement(sql)
+	}
+}
+
+// commitResult 提交结果
+func commitResult(err error) string {
+	if err != nil {
+		return txResultCommitFailed
+	}
+	return txResultCommit
+}
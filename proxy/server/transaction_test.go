@@ -0,0 +1,156 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/backend/mocks"
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/stats"
+)
+
+func newTransactionTestExecutor(m *Manager, connID uint32, namespace string) *SessionExecutor {
+	se := newSessionExecutor(m)
+	se.namespace = namespace
+	se.user = "test_user"
+	se.connID = connID
+	return se
+}
+
+func newTransactionTestManager(longTime time.Duration) *Manager {
+	m := NewManager()
+	m.transactions = newTransactionTracker(longTime)
+	m.statistics = &StatisticManager{
+		clusterName:        "test",
+		transactionTimings: stats.NewMultiTimings("", "", []string{statsLabelCluster, statsLabelNamespace, statsLabelResult}),
+	}
+	return m
+}
+
+func TestTransactionStatistics(t *testing.T) {
+	m := newTransactionTestManager(time.Minute)
+	se := newTransactionTestExecutor(m, 100, "test_ns")
+
+	if err := se.handleBegin(); err != nil {
+		t.Fatalf("begin error: %v", err)
+	}
+	se.recordTransactionStatement(parser.StmtUpdate, "update t set a = 1 where id = 10")
+	se.recordTransactionStatement(parser.StmtSelect, "select * from t where id = 11")
+	se.recordTransactionStatement(parser.StmtCommit, "commit")
+	for _, slice := range []string{"slice-1", "slice-0"} {
+		pc := new(mocks.PooledConnect)
+		pc.On("Commit").Return(nil)
+		pc.On("Recycle").Return()
+		se.txConns[slice] = pc
+		se.txn.addSlice(slice)
+	}
+
+	infos := m.transactions.list("")
+	if len(infos) != 1 {
+		t.Fatalf("expect 1 open transaction, actual: %v", infos)
+	}
+	info := infos[0]
+	if info.ID != se.txn.id || info.ConnID != 100 || info.Namespace != "test_ns" || info.Statements != 2 {
+		t.Errorf("unexpected transaction info: %+v", info)
+	}
+	if len(info.Slices) != 2 || info.Slices[0] != "slice-0" || info.Slices[1] != "slice-1" {
+		t.Errorf("slices should be sorted, actual: %v", info.Slices)
+	}
+	if info.Fingerprint != "update t set a = ? where id = ?" {
+		t.Errorf("fingerprint of first statement, actual: %s", info.Fingerprint)
+	}
+
+	if err := se.commit(); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if se.txn != nil || len(m.transactions.list("")) != 0 {
+		t.Errorf("finished transaction should be removed")
+	}
+	if count := m.statistics.transactionTimings.Counts()["test.test_ns.commit"]; count != 1 {
+		t.Errorf("expect 1 committed transaction, actual: %d", count)
+	}
+
+	// 新事务分配新的ID, 回滚结束
+	id := info.ID
+	se.handleBegin()
+	if se.txn == nil || se.txn.id <= id {
+		t.Fatalf("new transaction should get a larger id, last: %d, actual: %v", id, se.txn)
+	}
+	se.rollback()
+	if count := m.statistics.transactionTimings.Counts()["test.test_ns.rollback"]; count != 1 {
+		t.Errorf("expect 1 rollback transaction, actual: %d", count)
+	}
+}
+
+func TestTransactionCommitFailed(t *testing.T) {
+	m := newTransactionTestManager(time.Minute)
+	se := newTransactionTestExecutor(m, 101, "test_ns")
+	se.handleBegin()
+	pc := new(mocks.PooledConnect)
+	pc.On("Commit").Return(errors.New("commit error"))
+	pc.On("Recycle").Return()
+	se.txConns["slice-0"] = pc
+
+	if err := se.commit(); err == nil {
+		t.Fatalf("expect commit error")
+	}
+	if count := m.statistics.transactionTimings.Counts()["test.test_ns.commit_failed"]; count != 1 {
+		t.Errorf("expect 1 failed transaction, actual: %d", count)
+	}
+}
+
+func TestListTransactions(t *testing.T) {
+	m := newTransactionTestManager(time.Millisecond)
+	se1 := newTransactionTestExecutor(m, 1, "ns1")
+	se2 := newTransactionTestExecutor(m, 2, "ns2")
+	se1.handleBegin()
+	se2.handleBegin()
+	se2.txn.start = time.Now().Add(-time.Second)
+
+	if infos := m.transactions.list(""); len(infos) != 2 || infos[0].ConnID != 1 || infos[1].ConnID != 2 {
+		t.Errorf("expect transactions of all namespaces ordered by id, actual: %v", infos)
+	}
+	infos := m.transactions.list("ns2")
+	if len(infos) != 1 || infos[0].ConnID != 2 || !infos[0].Long {
+		t.Errorf("expect long transaction of ns2, actual: %v", infos)
+	}
+	m.transactions.reportLongTransactions()
+	if !se2.txn.reported {
+		t.Errorf("long transaction should be reported")
+	}
+}
+
+func TestParseLongTransactionTime(t *testing.T) {
+	tests := []struct {
+		value  int
+		expect time.Duration
+		hasErr bool
+	}{
+		{value: 0, expect: defaultLongTransactionTime},
+		{value: -1, expect: 0},
+		{value: 3000, expect: 3 * time.Second},
+		{value: -2, hasErr: true},
+	}
+	for _, test := range tests {
+		d, err := parseLongTransactionTime(&models.Proxy{LongTransactionTime: test.value})
+		if (err != nil) != test.hasErr || (!test.hasErr && d != test.expect) {
+			t.Errorf("parse long_transaction_time %d, expect: %v %v, actual: %v %v", test.value, test.expect, test.hasErr, d, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// values of user_provider
+const (
+	UserProviderStatic = "static" // namespace配置中的users, 默认值
+	UserProviderHTTP   = "http"   // 通过http回调查询用户
+	UserProviderLDAP   = "ldap"   // 通过LDAP simple bind校验密码
+)
+
+const defaultUserProviderTimeout = 3 * time.Second
+
+// errPasswordVerifyUnsupported 用户来源不能校验明文密码
+var errPasswordVerifyUnsupported = errors.New("user provider does not support clear text password")
+
+// UserAccount account of client user returned by UserProvider
+type UserAccount struct {
+	Namespace string // 用户所属的namespace
+
+	// 以下三种校验方式按顺序选择一种
+	Password      string // 明文密码
+	PasswordHash  []byte // mysql_native_password格式的密码hash, 即SHA1(SHA1(password)), 长度为0表示空密码
+	ClearPassword bool   // 要求客户端通过mysql_clear_password发送明文密码, 由UserProvider.VerifyPassword校验
+
+	Locked bool // 账号被锁定, 拒绝连接
+}
+
+// UserProvider source of client users, such as namespace config, LDAP or an external auth service
+type UserProvider interface {
+	// LookupUser return account of user connecting from host, or nil if user not found
+	LookupUser(user, host string) (*UserAccount, error)
+	// VerifyPassword verify clear text password of account with ClearPassword set
+	VerifyPassword(user, host, password string) (bool, error)
+}
+
+// NewUserProvider create UserProvider by user_provider of proxy config
+func NewUserProvider(cfg *models.Proxy, manager *Manager) (UserProvider, error) {
+	timeout := defaultUserProviderTimeout
+	if cfg.UserProviderTimeout < 0 {
+		return nil, fmt.Errorf("invalid user_provider_timeout: %d", cfg.UserProviderTimeout)
+	} else if cfg.UserProviderTimeout > 0 {
+		timeout = time.Duration(cfg.UserProviderTimeout) * time.Millisecond
+	}
+
+	switch cfg.UserProvider {
+	case "", UserProviderStatic:
+		return NewStaticUserProvider(manager), nil
+	case UserProviderHTTP:
+		return NewHTTPUserProvider(cfg.UserProviderURL, timeout)
+	case UserProviderLDAP:
+		return NewLDAPUserProvider(cfg.UserProviderURL, cfg.LDAPBindDN, cfg.LDAPNamespace, timeout)
+	default:
+		return nil, fmt.Errorf("invalid user_provider: %s", cfg.UserProvider)
+	}
+}
+
+// StaticUserProvider users configured in namespaces
+type StaticUserProvider struct {
+	manager *Manager
+}
+
+// NewStaticUserProvider constructor of StaticUserProvider
+func NewStaticUserProvider(manager *Manager) *StaticUserProvider {
+	return &StaticUserProvider{manager: manager}
+}
+
+// LookupUser implement UserProvider, 同名用户配置在多个namespace时使用第一个密码
+func (p *StaticUserProvider) LookupUser(user, host string) (*UserAccount, error) {
+	current, _, _ := p.manager.switchIndex.Get()
+	mgr := p.manager.users[current]
+	passwords, ok := mgr.users[user]
+	if !ok || len(passwords) == 0 {
+		return nil, nil
+	}
+	return &UserAccount{
+		Namespace: mgr.GetNamespaceByUser(user, passwords[0]),
+		Password:  passwords[0],
+	}, nil
+}
+
+// VerifyPassword implement UserProvider
+func (p *StaticUserProvider) VerifyPassword(user, host, password string) (bool, error) {
+	return false, errPasswordVerifyUnsupported
+}
+
+// HTTPUserProvider query users from an external auth service
+// 请求: POST {"user": "...", "host": "..."}
+// 响应: 200 {"namespace": "...", "password_hash": "*...", "locked": false}, 404表示用户不存在
+type HTTPUserProvider struct {
+	url    string
+	client *http.Client
+}
+
+type httpUserRequest struct {
+	User string `json:"user"`
+	Host string `json:"host"`
+}
+
+type httpUserResponse struct {
+	Namespace    string `json:"namespace"`
+	PasswordHash string `json:"password_hash"` // 与MySQL的authentication_string相同, *加40位十六进制
+	Locked       bool   `json:"locked"`
+}
+
+// NewHTTPUserProvider constructor of HTTPUserProvider
+func NewHTTPUserProvider(url string, timeout time.Duration) (*HTTPUserProvider, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid user_provider_url of http user provider: %s", url)
+	}
+	return &HTTPUserProvider{url: url, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// LookupUser implement UserProvider
+func (p *HTTPUserProvider) LookupUser(user, host string) (*UserAccount, error) {
+	body, err := json.Marshal(&httpUserRequest{User: user, Host: host})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("request user provider error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read user provider response error: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("user provider returns status: %d, body: %s", resp.StatusCode, data)
+	}
+
+	var ret httpUserResponse
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("decode user provider response error: %v", err)
+	}
+	hash, err := parseNativePasswordHash(ret.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	return &UserAccount{Namespace: ret.Namespace, PasswordHash: hash, Locked: ret.Locked}, nil
+}
+
+// VerifyPassword implement UserProvider
+func (p *HTTPUserProvider) VerifyPassword(user, host, password string) (bool, error) {
+	return false, errPasswordVerifyUnsupported
+}
+
+// parseNativePasswordHash 解析mysql_native_password的authentication_string, 空字符串表示空密码
+func parseNativePasswordHash(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if len(s) != 1+2*sha1.Size || s[0] != '*' {
+		return nil, fmt.Errorf("invalid password hash, expect * followed by 40 hex digits")
+	}
+	hash, err := hex.DecodeString(s[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid password hash: %v", err)
+	}
+	return hash, nil
+}
+
+// getUserProvider return user provider of proxy, or users in namespaces if not configured
+func (cc *Session) getUserProvider() UserProvider {
+	if cc.proxy != nil && cc.proxy.userProvider != nil {
+		return cc.proxy.userProvider
+	}
+	return NewStaticUserProvider(cc.manager)
+}
+
+// clientHost 用户来源按用户名和客户端地址查询账号, unix socket连接为localhost
+func (cc *Session) clientHost() string {
+	addr := cc.c.RemoteAddr()
+	if _, ok := addr.(*net.UnixAddr); ok {
+		return "localhost"
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
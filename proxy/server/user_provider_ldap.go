@@ -0,0 +1,262 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LDAP协议中用到的BER标签, 只实现了simple bind
+const (
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagEnumerated  = 0x0a
+	berTagSequence    = 0x30
+
+	ldapTagBindRequest    = 0x60 // [APPLICATION 0]
+	ldapTagBindResponse   = 0x61 // [APPLICATION 1]
+	ldapTagSimpleAuth     = 0x80 // [0]
+	ldapVersion           = 3
+	ldapResultSuccess     = 0
+	ldapResultInvalidCred = 49
+
+	ldapBindMessageID = 1
+	ldapMaxPacketSize = 1 << 20
+)
+
+// LDAPUserProvider verify password of users by LDAP simple bind, all users belong to one namespace
+type LDAPUserProvider struct {
+	addr      string
+	useTLS    bool
+	host      string // TLS校验证书使用的主机名
+	bindDN    string // 绑定DN模板, %s替换为用户名
+	namespace string
+	timeout   time.Duration
+}
+
+// NewLDAPUserProvider constructor of LDAPUserProvider, addr: ldap://host:389 or ldaps://host:636
+func NewLDAPUserProvider(addr, bindDN, namespace string, timeout time.Duration) (*LDAPUserProvider, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid user_provider_url of ldap user provider: %s", addr)
+	}
+	p := &LDAPUserProvider{host: u.Hostname(), bindDN: bindDN, namespace: namespace, timeout: timeout}
+	switch u.Scheme {
+	case "ldap":
+		p.addr = withDefaultPort(u.Host, "389")
+	case "ldaps":
+		p.addr = withDefaultPort(u.Host, "636")
+		p.useTLS = true
+	default:
+		return nil, fmt.Errorf("invalid user_provider_url of ldap user provider: %s", addr)
+	}
+	if strings.Count(bindDN, "%s") != 1 {
+		return nil, fmt.Errorf("invalid ldap_bind_dn, expect exactly one %%s for user name: %s", bindDN)
+	}
+	if namespace == "" {
+		return nil, errors.New("ldap_namespace is required by ldap user provider")
+	}
+	return p, nil
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// LookupUser implement UserProvider, 是否存在和锁定状态由绑定结果决定
+func (p *LDAPUserProvider) LookupUser(user, host string) (*UserAccount, error) {
+	return &UserAccount{Namespace: p.namespace, ClearPassword: true}, nil
+}
+
+// VerifyPassword implement UserProvider
+func (p *LDAPUserProvider) VerifyPassword(user, host, password string) (bool, error) {
+	// 空密码的simple bind是匿名绑定, 总是成功
+	if password == "" {
+		return false, nil
+	}
+	dn := fmt.Sprintf(p.bindDN, escapeLDAPDN(user))
+	return p.bind(dn, password)
+}
+
+func (p *LDAPUserProvider) bind(dn, password string) (bool, error) {
+	dialer := &net.Dialer{Timeout: p.timeout}
+	var conn net.Conn
+	var err error
+	if p.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.addr, &tls.Config{ServerName: p.host})
+	} else {
+		conn, err = dialer.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return false, fmt.Errorf("connect ldap server error: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	if _, err := conn.Write(encodeLDAPBindRequest(ldapBindMessageID, dn, password)); err != nil {
+		return false, fmt.Errorf("write ldap bind request error: %v", err)
+	}
+	code, msg, err := readLDAPBindResponse(bufio.NewReader(conn))
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case ldapResultSuccess:
+		return true, nil
+	case ldapResultInvalidCred:
+		return false, nil
+	default:
+		return false, fmt.Errorf("ldap bind failed, result code: %d, message: %s", code, msg)
+	}
+}
+
+// escapeLDAPDN 按RFC 4514转义DN中的属性值
+func escapeLDAPDN(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case strings.IndexByte(`,+"\<>;=`, c) >= 0,
+			(c == ' ' || c == '#') && i == 0,
+			c == ' ' && i == len(s)-1:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func appendBERLength(buf []byte, n int) []byte {
+	switch {
+	case n < 0x80:
+		return append(buf, byte(n))
+	case n <= 0xff:
+		return append(buf, 0x81, byte(n))
+	default:
+		return append(buf, 0x82, byte(n>>8), byte(n))
+	}
+}
+
+func appendBER(buf []byte, tag byte, value []byte) []byte {
+	buf = append(buf, tag)
+	buf = appendBERLength(buf, len(value))
+	return append(buf, value...)
+}
+
+// encodeLDAPBindRequest LDAPMessage{messageID, BindRequest{version, name, simple password}}
+func encodeLDAPBindRequest(messageID byte, dn, password string) []byte {
+	var bind []byte
+	bind = appendBER(bind, berTagInteger, []byte{ldapVersion})
+	bind = appendBER(bind, berTagOctetString, []byte(dn))
+	bind = appendBER(bind, ldapTagSimpleAuth, []byte(password))
+
+	var msg []byte
+	msg = appendBER(msg, berTagInteger, []byte{messageID})
+	msg = appendBER(msg, ldapTagBindRequest, bind)
+	return appendBER(nil, berTagSequence, msg)
+}
+
+// readBER read one TLV element, return tag and value
+func readBER(r io.ByteReader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(b)
+	if b&0x80 != 0 {
+		n := int(b & 0x7f)
+		if n == 0 || n > 3 {
+			return 0, nil, fmt.Errorf("unsupported ber length of %d bytes", n)
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			if b, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > ldapMaxPacketSize {
+		return 0, nil, fmt.Errorf("ber element too large: %d", length)
+	}
+	value := make([]byte, length)
+	for i := range value {
+		if value[i], err = r.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+	return tag, value, nil
+}
+
+func expectBER(r io.ByteReader, expectTag byte) ([]byte, error) {
+	tag, value, err := readBER(r)
+	if err != nil {
+		return nil, err
+	}
+	if tag != expectTag {
+		return nil, fmt.Errorf("unexpected ber tag: 0x%02x, expect: 0x%02x", tag, expectTag)
+	}
+	return value, nil
+}
+
+// readLDAPBindResponse return result code and diagnostic message of BindResponse
+func readLDAPBindResponse(r io.ByteReader) (int, string, error) {
+	msg, err := expectBER(r, berTagSequence)
+	if err != nil {
+		return 0, "", fmt.Errorf("read ldap bind response error: %v", err)
+	}
+	mr := strings.NewReader(string(msg))
+	if _, err := expectBER(mr, berTagInteger); err != nil {
+		return 0, "", fmt.Errorf("invalid ldap message id: %v", err)
+	}
+	resp, err := expectBER(mr, ldapTagBindResponse)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid ldap bind response: %v", err)
+	}
+	rr := strings.NewReader(string(resp))
+	code, err := expectBER(rr, berTagEnumerated)
+	if err != nil || len(code) == 0 {
+		return 0, "", fmt.Errorf("invalid ldap result code: %v", err)
+	}
+	result := 0
+	for _, b := range code {
+		result = result<<8 | int(b)
+	}
+	// matchedDN, diagnosticMessage
+	var diagnostic []byte
+	if _, err := expectBER(rr, berTagOctetString); err == nil {
+		diagnostic, _ = expectBER(rr, berTagOctetString)
+	}
+	return result, string(diagnostic), nil
+}
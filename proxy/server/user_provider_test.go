@@ -0,0 +1,252 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/XiaoMi/Gaea/mysql"
+)
+
+func nativePasswordHash(password string) []byte {
+	stage1 := sha1.Sum([]byte(password))
+	stage2 := sha1.Sum(stage1[:])
+	return stage2[:]
+}
+
+func TestAuthNativePasswordHash(t *testing.T) {
+	hash := nativePasswordHash("root")
+	tests := []struct {
+		plugin string
+		input  string
+		hasErr bool
+	}{
+		{mysql.AUTH_NATIVE_PASSWORD, "root", false},
+		{mysql.AUTH_NATIVE_PASSWORD, "wrong", true},
+		{mysql.AUTH_CACHING_SHA2_PASSWORD, "root", false},
+	}
+	for _, test := range tests {
+		s, client := newCachingSha2TestSession(t)
+		info := HandshakeResponseInfo{AuthPlugin: test.plugin, ClientPluginAuth: true}
+		if test.plugin == mysql.AUTH_NATIVE_PASSWORD {
+			info.AuthResponse = mysql.CalcPassword(s.c.salt, []byte(test.input))
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- s.authAccount(info, &UserAccount{PasswordHash: hash}, nil, "127.0.0.1")
+		}()
+
+		if test.plugin != mysql.AUTH_NATIVE_PASSWORD {
+			data, err := client.ReadPacket()
+			if err != nil {
+				t.Fatal(err)
+			}
+			prefix := append([]byte{mysql.AuthSwitchHeader}, append([]byte(mysql.AUTH_NATIVE_PASSWORD), 0)...)
+			if !bytes.HasPrefix(data, prefix) {
+				t.Fatalf("expect auth switch request to %s, got: %v", mysql.AUTH_NATIVE_PASSWORD, data)
+			}
+			if err := client.WritePacket(mysql.CalcPassword(s.c.salt, []byte(test.input))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := <-errCh; (err != nil) != test.hasErr {
+			t.Errorf("auth error not match, plugin: %s, input: %s, err: %v", test.plugin, test.input, err)
+		}
+	}
+}
+
+type clearPasswordProvider struct {
+	password string
+}
+
+func (p *clearPasswordProvider) LookupUser(user, host string) (*UserAccount, error) {
+	return &UserAccount{ClearPassword: true}, nil
+}
+
+func (p *clearPasswordProvider) VerifyPassword(user, host, password string) (bool, error) {
+	return password == p.password, nil
+}
+
+func TestAuthClearPassword(t *testing.T) {
+	for _, input := range []string{"secret", "wrong"} {
+		s, client := newCachingSha2TestSession(t)
+		info := HandshakeResponseInfo{User: "ldap_user", AuthPlugin: mysql.AUTH_CACHING_SHA2_PASSWORD, ClientPluginAuth: true}
+		provider := &clearPasswordProvider{password: "secret"}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- s.authAccount(info, &UserAccount{ClearPassword: true}, provider, "127.0.0.1")
+		}()
+
+		data, err := client.ReadPacket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix := append([]byte{mysql.AuthSwitchHeader}, append([]byte(mysql.AUTH_CLEAR_PASSWORD), 0)...)
+		if !bytes.HasPrefix(data, prefix) {
+			t.Fatalf("expect auth switch request to %s, got: %v", mysql.AUTH_CLEAR_PASSWORD, data)
+		}
+		if err := client.WritePacket(append([]byte(input), 0)); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-errCh; (err != nil) != (input != "secret") {
+			t.Errorf("auth error not match, input: %s, err: %v", input, err)
+		}
+	}
+}
+
+func TestHTTPUserProvider(t *testing.T) {
+	hash := nativePasswordHash("root")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req httpUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Host != "10.0.0.1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch req.User {
+		case "app":
+			json.NewEncoder(w).Encode(&httpUserResponse{Namespace: "ns", PasswordHash: "*" + strings.ToUpper(hex.EncodeToString(hash))})
+		case "locked":
+			json.NewEncoder(w).Encode(&httpUserResponse{Namespace: "ns", Locked: true})
+		case "error":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	p, err := NewHTTPUserProvider(ts.URL, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := p.LookupUser("app", "10.0.0.1")
+	if err != nil || account == nil || account.Namespace != "ns" || !bytes.Equal(account.PasswordHash, hash) {
+		t.Errorf("lookup user failed, account: %+v, err: %v", account, err)
+	}
+	if account, err := p.LookupUser("locked", "10.0.0.1"); err != nil || account == nil || !account.Locked {
+		t.Errorf("expect locked account, account: %+v, err: %v", account, err)
+	}
+	if account, err := p.LookupUser("unknown", "10.0.0.1"); err != nil || account != nil {
+		t.Errorf("expect user not found, account: %+v, err: %v", account, err)
+	}
+	if _, err := p.LookupUser("error", "10.0.0.1"); err == nil {
+		t.Errorf("expect error when user provider fails")
+	}
+}
+
+// startFakeLDAPServer 接受一次simple bind, dn和密码匹配时返回成功
+func startFakeLDAPServer(t *testing.T, dn, password string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			expect := encodeLDAPBindRequest(ldapBindMessageID, dn, password)
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			code := byte(ldapResultInvalidCred)
+			if bytes.Equal(buf[:n], expect) {
+				code = ldapResultSuccess
+			}
+			var resp []byte
+			resp = appendBER(resp, berTagEnumerated, []byte{code})
+			resp = appendBER(resp, berTagOctetString, nil)
+			resp = appendBER(resp, berTagOctetString, nil)
+			var msg []byte
+			msg = appendBER(msg, berTagInteger, []byte{ldapBindMessageID})
+			msg = appendBER(msg, ldapTagBindResponse, resp)
+			conn.Write(appendBER(nil, berTagSequence, msg))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestLDAPUserProvider(t *testing.T) {
+	addr := startFakeLDAPServer(t, `uid=a\,b,ou=people,dc=example,dc=com`, "secret")
+	p, err := NewLDAPUserProvider("ldap://"+addr, "uid=%s,ou=people,dc=example,dc=com", "ns", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account, _ := p.LookupUser("a,b", "127.0.0.1"); account == nil || !account.ClearPassword || account.Namespace != "ns" {
+		t.Errorf("unexpected ldap account: %+v", account)
+	}
+	tests := []struct {
+		password string
+		expect   bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		ok, err := p.VerifyPassword("a,b", "127.0.0.1", test.password)
+		if err != nil || ok != test.expect {
+			t.Errorf("verify password not match, password: %s, expect: %v, actual: %v, err: %v", test.password, test.expect, ok, err)
+		}
+	}
+
+	if _, err := NewLDAPUserProvider("ldap://"+addr, "ou=people,dc=example,dc=com", "ns", time.Second); err == nil {
+		t.Errorf("expect error when bind dn has no user name placeholder")
+	}
+}
+
+func TestReadLDAPBindResponse(t *testing.T) {
+	var resp []byte
+	resp = appendBER(resp, berTagEnumerated, []byte{ldapResultInvalidCred})
+	resp = appendBER(resp, berTagOctetString, nil)
+	resp = appendBER(resp, berTagOctetString, []byte(strings.Repeat("x", 200)))
+	var msg []byte
+	msg = appendBER(msg, berTagInteger, []byte{ldapBindMessageID})
+	msg = appendBER(msg, ldapTagBindResponse, resp)
+
+	code, diagnostic, err := readLDAPBindResponse(bufio.NewReader(bytes.NewReader(appendBER(nil, berTagSequence, msg))))
+	if err != nil || code != ldapResultInvalidCred || len(diagnostic) != 200 {
+		t.Errorf("unexpected bind response, code: %d, diagnostic length: %d, err: %v", code, len(diagnostic), err)
+	}
+}
+
+func TestEscapeLDAPDN(t *testing.T) {
+	tests := map[string]string{
+		"alice":   "alice",
+		"a,b+c":   `a\,b\+c`,
+		" #x":     `\ #x`,
+		"#x ":     `\#x\ `,
+		"a=b;c":   `a\=b\;c`,
+		"a\x00b":  `a\00b`,
+		`a"b\<c>`: `a\"b\\\<c\>`,
+	}
+	for input, expect := range tests {
+		if actual := escapeLDAPDN(input); actual != expect {
+			t.Errorf("escape dn not match, input: %q, expect: %s, actual: %s", input, expect, actual)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+	"github.com/pingcap/parser/opcode"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// parseVersionColumns return version columns, key: db.table, 表名和列名小写
+func parseVersionColumns(cfgColumns []*models.VersionColumn) map[string]string {
+	columns := make(map[string]string, len(cfgColumns))
+	for _, c := range cfgColumns {
+		columns[c.DB+"."+strings.ToLower(c.Table)] = strings.ToLower(c.Column)
+	}
+	return columns
+}
+
+// rewriteVersionColumn 改写配置了版本列的单表UPDATE:
+// SET中将版本列设置为常量v时, 改写为版本列加1, 并在WHERE中追加版本列等于v的条件;
+// SET中没有版本列时, 追加版本列加1; 版本列设置为其他表达式时不改写
+func rewriteVersionColumn(reqCtx *util.RequestContext, ns *Namespace, db string, stmt ast.StmtNode) {
+	if len(ns.versionColumns) == 0 {
+		return
+	}
+	update, ok := stmt.(*ast.UpdateStmt)
+	if !ok || update.TableRefs == nil || update.TableRefs.TableRefs == nil || update.TableRefs.TableRefs.Right != nil {
+		return
+	}
+	source, ok := update.TableRefs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return
+	}
+	table, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return
+	}
+	tableDB := table.Schema.O
+	if tableDB == "" {
+		tableDB = db
+	}
+	key := tableDB + "." + table.Name.L
+	column, ok := ns.versionColumns[key]
+	if !ok {
+		return
+	}
+
+	for _, assignment := range update.List {
+		if assignment.Column.Name.L != column {
+			continue
+		}
+		expected, ok := assignment.Expr.(ast.ValueExpr)
+		if !ok {
+			return
+		}
+		assignment.Expr = newVersionIncrExpr(column)
+		cond := &ast.BinaryOperationExpr{
+			Op: opcode.EQ,
+			L:  &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: model.NewCIStr(column)}},
+			R:  expected,
+		}
+		if update.Where == nil {
+			update.Where = cond
+		} else {
+			update.Where = &ast.BinaryOperationExpr{Op: opcode.LogicAnd, L: &ast.ParenthesesExpr{Expr: update.Where}, R: cond}
+		}
+		reqCtx.Set(util.VersionCheck, key)
+		return
+	}
+
+	update.List = append(update.List, &ast.Assignment{
+		Column: &ast.ColumnName{Name: model.NewCIStr(column)},
+		Expr:   newVersionIncrExpr(column),
+	})
+}
+
+func newVersionIncrExpr(column string) ast.ExprNode {
+	return &ast.BinaryOperationExpr{
+		Op: opcode.Plus,
+		L:  &ast.ColumnNameExpr{Name: &ast.ColumnName{Name: model.NewCIStr(column)}},
+		R:  ast.NewValueExpr(1, "", ""),
+	}
+}
+
+// checkVersionConflict 追加了版本列条件的UPDATE没有匹配的行时, 说明记录已被其他请求修改
+func checkVersionConflict(reqCtx *util.RequestContext, r *mysql.Result) error {
+	key, ok := reqCtx.Get(util.VersionCheck).(string)
+	if !ok || r == nil || r.AffectedRows != 0 {
+		return nil
+	}
+	return mysql.NewDefaultError(mysql.ErrCheckread, key)
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/util"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/format"
+)
+
+func TestRewriteVersionColumn(t *testing.T) {
+	ns := &Namespace{
+		versionColumns: parseVersionColumns([]*models.VersionColumn{
+			{DB: "db_ks", Table: "tbl_ks", Column: "Version"},
+		}),
+	}
+	tests := []struct {
+		db     string
+		sql    string
+		expect string
+		check  bool
+	}{
+		{"db_ks", "update tbl_ks set name = 'a', version = 3 where id = 1", "UPDATE `tbl_ks` SET `name`='a', `version`=`version`+1 WHERE (`id`=1) AND `version`=3", true},
+		{"other", "update db_ks.tbl_ks t set t.version = 3", "UPDATE `db_ks`.`tbl_ks` AS `t` SET `t`.`version`=`version`+1 WHERE `version`=3", true},
+		{"db_ks", "update tbl_ks set name = 'a' where id = 1", "UPDATE `tbl_ks` SET `name`='a', `version`=`version`+1 WHERE `id`=1", false},
+		{"db_ks", "update tbl_ks set version = version + 2 where id = 1", "UPDATE `tbl_ks` SET `version`=`version`+2 WHERE `id`=1", false},
+		{"other", "update tbl_ks set version = 3 where id = 1", "UPDATE `tbl_ks` SET `version`=3 WHERE `id`=1", false},
+		{"db_ks", "delete from tbl_ks where version = 3", "DELETE FROM `tbl_ks` WHERE `version`=3", false},
+	}
+	p := parser.New()
+	for _, test := range tests {
+		stmt, err := p.ParseOneStmt(test.sql, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqCtx := util.NewRequestContext()
+		rewriteVersionColumn(reqCtx, ns, test.db, stmt)
+		s := &strings.Builder{}
+		if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, s)); err != nil {
+			t.Fatal(err)
+		}
+		if s.String() != test.expect {
+			t.Errorf("rewrite not match, sql: %s, expect: %s, actual: %s", test.sql, test.expect, s.String())
+		}
+		_, check := reqCtx.Get(util.VersionCheck).(string)
+		if check != test.check {
+			t.Errorf("version check not match, sql: %s, expect: %v, actual: %v", test.sql, test.check, check)
+		}
+	}
+}
+
+func TestCheckVersionConflict(t *testing.T) {
+	reqCtx := util.NewRequestContext()
+	if err := checkVersionConflict(reqCtx, &mysql.Result{}); err != nil {
+		t.Errorf("expect no error without version check, actual: %v", err)
+	}
+
+	reqCtx.Set(util.VersionCheck, "db_ks.tbl_ks")
+	if err := checkVersionConflict(reqCtx, &mysql.Result{AffectedRows: 1}); err != nil {
+		t.Errorf("expect no error when rows matched, actual: %v", err)
+	}
+	err := checkVersionConflict(reqCtx, &mysql.Result{})
+	sqlErr, ok := err.(*mysql.SQLError)
+	if !ok || sqlErr.SQLCode() != mysql.ErrCheckread {
+		t.Errorf("expect ErrCheckread, actual: %v", err)
+	}
+}
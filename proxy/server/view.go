@@ -0,0 +1,156 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/model"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+// 视图嵌套引用的最大层数, 超过时认为视图之间存在循环引用
+const maxViewDepth = 8
+
+// parseViews parse views of namespace, key: db.name, value: view config
+func parseViews(cfgViews []*models.View) (map[string]*models.View, error) {
+	views := make(map[string]*models.View, len(cfgViews))
+	p := parser.NewSQLParser()
+	for _, v := range cfgViews {
+		stmt, err := p.ParseOneStmt(v.SQL)
+		if err != nil {
+			return nil, fmt.Errorf("parse sql of view %s.%s error: %v", v.DB, v.Name, err)
+		}
+		if _, ok := stmt.(ast.ResultSetNode); !ok {
+			return nil, fmt.Errorf("sql of view %s.%s must be a select statement", v.DB, v.Name)
+		}
+		views[v.DB+"."+v.Name] = v
+	}
+	return views, nil
+}
+
+// getView return view of db.name, nil if not exists
+func (n *Namespace) getView(db, name string) *models.View {
+	if len(n.views) == 0 {
+		return nil
+	}
+	return n.views[db+"."+name]
+}
+
+// viewExpander replace references of views with derived tables of view definitions
+type viewExpander struct {
+	ns    *Namespace
+	db    string
+	p     parser.SQLParser
+	depth int
+	err   error
+}
+
+// Enter implement ast.Visitor
+func (e *viewExpander) Enter(n ast.Node) (ast.Node, bool) {
+	if e.err != nil {
+		return n, true
+	}
+	ts, ok := n.(*ast.TableSource)
+	if !ok {
+		return n, false
+	}
+	t, ok := ts.Source.(*ast.TableName)
+	if !ok {
+		return n, false
+	}
+	db := t.Schema.O
+	if db == "" {
+		db = e.db
+	}
+	v := e.ns.getView(db, t.Name.O)
+	if v == nil {
+		return n, false
+	}
+
+	subquery, err := e.expand(v)
+	if err != nil {
+		e.err = err
+		return n, true
+	}
+	ts.Source = subquery
+	if ts.AsName.L == "" {
+		ts.AsName = t.Name
+	}
+	return n, true
+}
+
+// Leave implement ast.Visitor
+func (e *viewExpander) Leave(n ast.Node) (ast.Node, bool) {
+	return n, e.err == nil
+}
+
+// expand parse the view definition, views referenced by the view are expanded recursively
+func (e *viewExpander) expand(v *models.View) (ast.ResultSetNode, error) {
+	if e.depth >= maxViewDepth {
+		return nil, fmt.Errorf("too many nested views, view: %s.%s", v.DB, v.Name)
+	}
+	stmt, err := e.p.ParseOneStmt(v.SQL)
+	if err != nil {
+		return nil, fmt.Errorf("parse sql of view %s.%s error: %v", v.DB, v.Name, err)
+	}
+	// 视图定义中未指定库名的表属于视图所在的库
+	if v.DB != e.db {
+		parser.Visit(stmt, &tableSchemaFiller{db: v.DB})
+	}
+
+	inner := &viewExpander{ns: e.ns, db: v.DB, p: e.p, depth: e.depth + 1}
+	parser.Visit(stmt, inner)
+	if inner.err != nil {
+		return nil, inner.err
+	}
+	return stmt.(ast.ResultSetNode), nil
+}
+
+// tableSchemaFiller set db of table names without db
+type tableSchemaFiller struct {
+	db string
+}
+
+// Enter implement ast.Visitor
+func (f *tableSchemaFiller) Enter(n ast.Node) (ast.Node, bool) {
+	if t, ok := n.(*ast.TableName); ok && t.Schema.O == "" {
+		t.Schema = model.NewCIStr(f.db)
+	}
+	return n, false
+}
+
+// Leave implement ast.Visitor
+func (f *tableSchemaFiller) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// rewriteViews 查询引用视图时, 将视图展开为派生表, 展开后按普通查询计算路由
+func rewriteViews(ns *Namespace, db string, stmt ast.StmtNode) error {
+	if len(ns.views) == 0 {
+		return nil
+	}
+	switch stmt.(type) {
+	case *ast.SelectStmt, *ast.UnionStmt:
+	default:
+		return nil
+	}
+	e := &viewExpander{ns: ns, db: db, p: parser.NewSQLParser()}
+	parser.Visit(stmt, e)
+	return e.err
+}
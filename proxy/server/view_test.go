@@ -0,0 +1,70 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/pingcap/parser/format"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+)
+
+func TestRewriteViews(t *testing.T) {
+	views, err := parseViews([]*models.View{
+		{DB: "db_ks", Name: "v_active", SQL: "select id, name from tbl_ks where status = 1"},
+		{DB: "db_ks", Name: "v_named", SQL: "select id from v_active where name <> ''"},
+		{DB: "db_ks", Name: "v_loop1", SQL: "select id from v_loop2"},
+		{DB: "db_ks", Name: "v_loop2", SQL: "select id from v_loop1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &Namespace{views: views}
+
+	tests := []struct {
+		db     string
+		sql    string
+		expect string
+		hasErr bool
+	}{
+		{"db_ks", "select name from v_active where id = 1", "SELECT `name` FROM (SELECT `id`,`name` FROM (`tbl_ks`) WHERE `status`=1) AS `v_active` WHERE `id`=1", false},
+		{"db_ks", "select v.id from v_named v join tbl_ks t on v.id = t.id", "SELECT `v`.`id` FROM (SELECT `id` FROM ((SELECT `id`,`name` FROM (`tbl_ks`) WHERE `status`=1) AS `v_active`) WHERE `name`!='') AS `v` JOIN `tbl_ks` AS `t` ON `v`.`id`=`t`.`id`", false},
+		{"other", "select id from db_ks.v_active", "SELECT `id` FROM (SELECT `id`,`name` FROM (`db_ks`.`tbl_ks`) WHERE `status`=1) AS `v_active`", false},
+		{"other", "select id from v_active", "SELECT `id` FROM `v_active`", false},
+		{"db_ks", "select id from v_loop1", "", true},
+	}
+	for _, test := range tests {
+		stmt, err := parser.ParseSQL(test.sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rewriteViews(ns, test.db, stmt)
+		if (err != nil) != test.hasErr {
+			t.Fatalf("rewrite views error not match, sql: %s, expect error: %v, err: %v", test.sql, test.hasErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		actual, err := parser.Restore(stmt, format.DefaultRestoreFlags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != test.expect {
+			t.Errorf("rewrite views not match, sql: %s, expect: %s, actual: %s", test.sql, test.expect, actual)
+		}
+	}
+}
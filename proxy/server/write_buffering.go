@@ -0,0 +1,73 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// WriteBuffering write coalescing options of client connections
+type WriteBuffering struct {
+	BufferSize int `json:"buffer_size"` // 合并写的缓冲区大小, 单位字节, 0使用默认值, -1不合并
+	FlushDelay int `json:"flush_delay"` // 单位毫秒, 缓冲数据超过该时间未写出时写出, 0只在缓冲区满或结果写完时写出
+}
+
+func (wb WriteBuffering) verify() error {
+	if wb.BufferSize < -1 || wb.FlushDelay < 0 {
+		return fmt.Errorf("invalid write buffering, buffer_size: %d, flush_delay: %d", wb.BufferSize, wb.FlushDelay)
+	}
+	return nil
+}
+
+// override 使用namespace的配置覆盖proxy的配置, 0表示不覆盖
+func (wb WriteBuffering) override(bufferSize, flushDelay int) WriteBuffering {
+	if bufferSize != 0 {
+		wb.BufferSize = bufferSize
+	}
+	switch {
+	case flushDelay > 0:
+		wb.FlushDelay = flushDelay
+	case flushDelay < 0:
+		wb.FlushDelay = 0
+	}
+	return wb
+}
+
+// GetWriteBuffering return write buffering of proxy, namespace may override it
+func (s *Server) GetWriteBuffering() WriteBuffering {
+	if wb, ok := s.writeBuffering.Load().(WriteBuffering); ok {
+		return wb
+	}
+	return WriteBuffering{}
+}
+
+// SetWriteBuffering change write buffering of proxy at runtime, it takes effect from next response of sessions
+func (s *Server) SetWriteBuffering(wb WriteBuffering) error {
+	if err := wb.verify(); err != nil {
+		return err
+	}
+	s.writeBuffering.Store(wb)
+	return nil
+}
+
+// applyWriteBuffering 每次返回结果前应用proxy和namespace当前的写合并配置
+func (cc *Session) applyWriteBuffering() {
+	wb := cc.proxy.GetWriteBuffering()
+	if ns := cc.getNamespace(); ns != nil {
+		wb = wb.override(ns.writeBufferSize, ns.flushDelay)
+	}
+	cc.c.SetWriteBuffering(wb.BufferSize, time.Duration(wb.FlushDelay)*time.Millisecond)
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import "testing"
+
+func TestWriteBuffering(t *testing.T) {
+	s := &Server{}
+	if wb := s.GetWriteBuffering(); wb != (WriteBuffering{}) {
+		t.Errorf("expect default write buffering, actual: %+v", wb)
+	}
+	if err := s.SetWriteBuffering(WriteBuffering{BufferSize: -2}); err == nil {
+		t.Errorf("expect error of invalid buffer size")
+	}
+	if err := s.SetWriteBuffering(WriteBuffering{BufferSize: 65536, FlushDelay: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		bufferSize int
+		flushDelay int
+		expect     WriteBuffering
+	}{
+		{expect: WriteBuffering{BufferSize: 65536, FlushDelay: 5}},
+		{bufferSize: -1, flushDelay: -1, expect: WriteBuffering{BufferSize: -1}},
+		{bufferSize: 4096, flushDelay: 20, expect: WriteBuffering{BufferSize: 4096, FlushDelay: 20}},
+	}
+	for _, test := range tests {
+		if actual := s.GetWriteBuffering().override(test.bufferSize, test.flushDelay); actual != test.expect {
+			t.Errorf("override(%d, %d) not match, expect: %+v, actual: %+v", test.bufferSize, test.flushDelay, test.expect, actual)
+		}
+	}
+}
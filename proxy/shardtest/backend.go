@@ -0,0 +1,151 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardtest
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/XiaoMi/Gaea/mysql"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// type check
+var _ plan.Executor = &Backend{}
+
+// Call means one SQL routed to backend
+type Call struct {
+	Slice string
+	DB    string
+	SQL   string
+}
+
+// Backend is an in-memory multi-slice backend implementing plan.Executor,
+// it records every routed SQL and returns canned results instead of talking to MySQL.
+type Backend struct {
+	sync.Mutex
+	phyDBs       map[string]string // logic db -> phy db, used by unshard plans
+	calls        []Call
+	results      map[string]*mysql.Result // key: slice name
+	lastInsertID uint64
+}
+
+// NewBackend create fake backend, phyDBs maps logic db to physical db and could be nil
+func NewBackend(phyDBs map[string]string) *Backend {
+	return &Backend{
+		phyDBs:  phyDBs,
+		results: make(map[string]*mysql.Result),
+	}
+}
+
+// SetResult set canned result returned by the slice, an empty result is returned by default
+func (b *Backend) SetResult(slice string, r *mysql.Result) {
+	b.Lock()
+	defer b.Unlock()
+	b.results[slice] = r
+}
+
+// Calls return all routed SQLs in execution order
+func (b *Backend) Calls() []Call {
+	b.Lock()
+	defer b.Unlock()
+	ret := make([]Call, len(b.calls))
+	copy(ret, b.calls)
+	return ret
+}
+
+// SQLs return routed SQLs grouped by slice and db, same layout as plan sqls
+func (b *Backend) SQLs() map[string]map[string][]string {
+	b.Lock()
+	defer b.Unlock()
+	ret := make(map[string]map[string][]string)
+	for _, c := range b.calls {
+		if _, ok := ret[c.Slice]; !ok {
+			ret[c.Slice] = make(map[string][]string)
+		}
+		ret[c.Slice][c.DB] = append(ret[c.Slice][c.DB], c.SQL)
+	}
+	return ret
+}
+
+// Reset clear recorded SQLs
+func (b *Backend) Reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.calls = nil
+}
+
+// ExecuteSQL implement plan.Executor
+func (b *Backend) ExecuteSQL(ctx *util.RequestContext, slice, db, sql string) (*mysql.Result, error) {
+	b.Lock()
+	defer b.Unlock()
+	if phyDB, ok := b.phyDBs[db]; ok {
+		db = phyDB
+	}
+	b.calls = append(b.calls, Call{Slice: slice, DB: db, SQL: sql})
+	return b.getResult(slice), nil
+}
+
+// ExecuteSQLs implement plan.Executor, slices are executed in name order so the result is deterministic
+func (b *Backend) ExecuteSQLs(ctx *util.RequestContext, sqls map[string]map[string][]string) ([]*mysql.Result, error) {
+	b.Lock()
+	defer b.Unlock()
+	var rs []*mysql.Result
+	for _, slice := range sortedSlices(sqls) {
+		for _, db := range sortedDBs(sqls[slice]) {
+			for _, sql := range sqls[slice][db] {
+				b.calls = append(b.calls, Call{Slice: slice, DB: db, SQL: sql})
+				rs = append(rs, b.getResult(slice))
+			}
+		}
+	}
+	return rs, nil
+}
+
+// SetLastInsertID implement plan.Executor
+func (b *Backend) SetLastInsertID(id uint64) {
+	b.lastInsertID = id
+}
+
+// GetLastInsertID implement plan.Executor
+func (b *Backend) GetLastInsertID() uint64 {
+	return b.lastInsertID
+}
+
+func (b *Backend) getResult(slice string) *mysql.Result {
+	if r, ok := b.results[slice]; ok {
+		return r
+	}
+	return &mysql.Result{Resultset: &mysql.Resultset{}}
+}
+
+func sortedSlices(sqls map[string]map[string][]string) []string {
+	var ret []string
+	for k := range sqls {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func sortedDBs(sqls map[string][]string) []string {
+	var ret []string
+	for k := range sqls {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
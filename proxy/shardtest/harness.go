@@ -0,0 +1,178 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shardtest provides utilities for testing sharding configs of namespace without real MySQL instances.
+//
+// A Harness builds the router from namespace config, plans SQLs exactly as the proxy does,
+// and executes the plans in an in-memory Backend which records every routed SQL:
+//
+//	h, err := shardtest.NewHarnessFromJSON(nsConfig)
+//	...
+//	h.AssertSlices(t, "db_ks", "select * from tbl_ks where id = 1", "slice-1")
+//	h.AssertSQLs(t, "db_ks", "select * from tbl_ks where id = 1", map[string]map[string][]string{
+//		"slice-1": {"db_ks": {"SELECT * FROM `tbl_ks_0001` WHERE `id`=1"}},
+//	})
+package shardtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/XiaoMi/Gaea/models"
+	"github.com/XiaoMi/Gaea/parser"
+	"github.com/XiaoMi/Gaea/proxy/plan"
+	"github.com/XiaoMi/Gaea/proxy/router"
+	"github.com/XiaoMi/Gaea/proxy/sequence"
+	"github.com/XiaoMi/Gaea/util"
+)
+
+// Harness plans and executes SQLs of a namespace in a fake backend
+type Harness struct {
+	phyDBs map[string]string
+	router *router.Router
+	seqs   *sequence.SequenceManager
+}
+
+// NewHarnessFromJSON create harness from json config of namespace
+func NewHarnessFromJSON(cfg []byte) (*Harness, error) {
+	ns := &models.Namespace{}
+	if err := json.Unmarshal(cfg, ns); err != nil {
+		return nil, err
+	}
+	return NewHarness(ns)
+}
+
+// NewHarness create harness from namespace config, base shard rules are resolved in place, global sequences are replaced by in-memory sequences starting from 1
+func NewHarness(ns *models.Namespace) (*Harness, error) {
+	if err := ns.ResolveShardRules(); err != nil {
+		return nil, fmt.Errorf("resolve shard rules error: %v", err)
+	}
+	if err := ns.Verify(); err != nil {
+		return nil, fmt.Errorf("verify namespace error: %v", err)
+	}
+
+	rt, err := router.NewRouter(ns)
+	if err != nil {
+		return nil, fmt.Errorf("create router error: %v", err)
+	}
+
+	seqs := sequence.NewSequenceManager()
+	for _, v := range ns.GlobalSequences {
+		seqs.SetSequence(v.DB, v.Table, &memorySequence{pkName: v.PKName})
+	}
+
+	phyDBs := make(map[string]string, len(ns.AllowedDBS))
+	for db := range ns.AllowedDBS {
+		phyDBs[db] = db
+	}
+	for db, phyDB := range ns.DefaultPhyDBS {
+		phyDBs[db] = phyDB
+	}
+
+	return &Harness{phyDBs: phyDBs, router: rt, seqs: seqs}, nil
+}
+
+// GetRouter return router of namespace
+func (h *Harness) GetRouter() *router.Router {
+	return h.router
+}
+
+func (h *Harness) buildPlan(db, sql string) (plan.Plan, error) {
+	stmt, err := parser.ParseSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("parse sql error: %v", err)
+	}
+
+	p, err := plan.BuildPlan(stmt, h.phyDBs, db, sql, h.router, h.seqs)
+	if err != nil {
+		return nil, fmt.Errorf("build plan error: %v", err)
+	}
+	return p, nil
+}
+
+// Describe plan the sql in session db and return the plan description without executing it
+func (h *Harness) Describe(db, sql string) (*plan.Description, error) {
+	p, err := h.buildPlan(db, sql)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Describe(p)
+}
+
+// Route plan the sql in session db and execute it in a new fake backend, return the backend
+func (h *Harness) Route(db, sql string) (*Backend, error) {
+	p, err := h.buildPlan(db, sql)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBackend(h.phyDBs)
+	if _, err := p.ExecuteIn(util.NewRequestContext(), b); err != nil {
+		return nil, fmt.Errorf("execute plan error: %v", err)
+	}
+	return b, nil
+}
+
+// AssertSQLs assert the routed SQLs, grouped by slice and physical db
+func (h *Harness) AssertSQLs(t testing.TB, db, sql string, expect map[string]map[string][]string) {
+	t.Helper()
+	b, err := h.Route(db, sql)
+	if err != nil {
+		t.Fatalf("route sql failed, db: %s, sql: %s, err: %v", db, sql, err)
+	}
+	if actual := b.SQLs(); !reflect.DeepEqual(expect, actual) {
+		t.Errorf("routed sqls not equal, sql: %s, expect: %v, actual: %v", sql, expect, actual)
+	}
+}
+
+// AssertSlices assert the slices which the sql is routed to
+func (h *Harness) AssertSlices(t testing.TB, db, sql string, slices ...string) {
+	t.Helper()
+	b, err := h.Route(db, sql)
+	if err != nil {
+		t.Fatalf("route sql failed, db: %s, sql: %s, err: %v", db, sql, err)
+	}
+	actual := sortedSlices(b.SQLs())
+	expect := append([]string(nil), slices...)
+	sort.Strings(expect)
+	if strings.Join(expect, ",") != strings.Join(actual, ",") {
+		t.Errorf("routed slices not equal, sql: %s, expect: %v, actual: %v", sql, expect, actual)
+	}
+}
+
+// AssertError assert planning or executing the sql fails
+func (h *Harness) AssertError(t testing.TB, db, sql string) {
+	t.Helper()
+	if _, err := h.Route(db, sql); err == nil {
+		t.Errorf("route sql should fail but pass, db: %s, sql: %s", db, sql)
+	}
+}
+
+type memorySequence struct {
+	v      int64
+	pkName string
+}
+
+func (s *memorySequence) GetPKName() string {
+	return s.pkName
+}
+
+func (s *memorySequence) NextSeq() (int64, error) {
+	return atomic.AddInt64(&s.v, 1), nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shardtest
+
+import (
+	"testing"
+)
+
+const testNamespace = `
+{
+    "name": "test_shardtest",
+    "online": true,
+    "allowed_dbs": {
+        "db_ks": true
+    },
+    "slices": [
+        {
+            "name": "slice-0",
+            "user_name": "root",
+            "password": "root",
+            "master": "127.0.0.1:3306",
+            "capacity": 64,
+            "max_capacity": 128,
+            "idle_timeout": 3600
+        },
+        {
+            "name": "slice-1",
+            "user_name": "root",
+            "password": "root",
+            "master": "127.0.0.1:3307",
+            "capacity": 64,
+            "max_capacity": 128,
+            "idle_timeout": 3600
+        }
+    ],
+    "shard_rules": [
+        {
+            "db": "db_ks",
+            "table": "tbl_ks",
+            "type": "mod",
+            "key": "id",
+            "locations": [2, 2],
+            "slices": ["slice-0", "slice-1"]
+        }
+    ],
+    "users": [
+        {
+            "user_name": "test",
+            "password": "test",
+            "namespace": "test_shardtest",
+            "rw_flag": 2,
+            "rw_split": 1
+        }
+    ],
+    "default_slice": "slice-0"
+}`
+
+func TestHarness(t *testing.T) {
+	h, err := NewHarnessFromJSON([]byte(testNamespace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.AssertSlices(t, "db_ks", "select * from tbl_ks where id = 3", "slice-1")
+	h.AssertSlices(t, "db_ks", "select * from tbl_ks", "slice-0", "slice-1")
+	h.AssertSlices(t, "db_ks", "select * from tbl_unshard", "slice-0")
+	h.AssertSQLs(t, "db_ks", "select * from tbl_ks where id = 1", map[string]map[string][]string{
+		"slice-0": {"db_ks": {"SELECT * FROM `tbl_ks_0001` WHERE `id`=1"}},
+	})
+	h.AssertSQLs(t, "db_ks", "insert into tbl_ks(id, name) values (2, 'a')", map[string]map[string][]string{
+		"slice-1": {"db_ks": {"INSERT INTO `tbl_ks_0002` (`id`,`name`) VALUES (2,'a')"}},
+	})
+	h.AssertError(t, "", "select * from tbl_ks")
+
+	d, err := h.Describe("db_ks", "select * from tbl_ks where id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Targets) != 1 || d.Targets[0].Slice != "slice-0" || d.Targets[0].SQLs[0] != "SELECT * FROM `tbl_ks_0001` WHERE `id`=1" {
+		t.Errorf("plan description not equal, actual: %+v", d.Targets)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adminauth 管理接口的认证和基于角色的权限控制
+package adminauth
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+// RoleKey key of role in gin context
+const RoleKey = "admin_role"
+
+// identity前缀, 区分不同的认证方式
+const (
+	tokenIdentityPrefix = "token:"
+	certIdentityPrefix  = "cert:"
+)
+
+// Authenticator 管理接口认证, 支持basic auth, bearer token和mTLS客户端证书
+type Authenticator struct {
+	user      string // basic auth用户, 始终为admin角色
+	password  string
+	tokens    []*models.AdminToken
+	certRoles map[string]string // key: 客户端证书CN
+}
+
+// NewAuthenticator create Authenticator, tokens and certRoles are in format of models.ParseAdminTokens and models.ParseAdminCertRoles
+func NewAuthenticator(user, password, tokens, certRoles string) (*Authenticator, error) {
+	a := &Authenticator{user: user, password: password}
+	var err error
+	if a.tokens, err = models.ParseAdminTokens(tokens); err != nil {
+		return nil, err
+	}
+	if a.certRoles, err = models.ParseAdminCertRoles(certRoles); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authenticate 认证请求, 认证通过后在context中设置identity(gin.AuthUserKey)和角色(RoleKey), 否则返回401
+func (a *Authenticator) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, role, ok := a.identify(c.Request)
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="Authorization Required"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Set(gin.AuthUserKey, identity)
+		c.Set(RoleKey, role)
+	}
+}
+
+// identify 依次按客户端证书, bearer token, basic auth认证
+func (a *Authenticator) identify(r *http.Request) (string, string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.certRoles[cn]; ok {
+			return certIdentityPrefix + cn, role, true
+		}
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		for _, t := range a.tokens {
+			if secureEqual(t.Token, token) {
+				return tokenIdentityPrefix + t.Name, t.Role, true
+			}
+		}
+		return "", "", false
+	}
+
+	user, password, ok := r.BasicAuth()
+	if ok && a.user != "" && secureEqual(user, a.user) && secureEqual(password, a.password) {
+		return user, models.AdminRoleAdmin, true
+	}
+	return "", "", false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// RequireRole 要求认证的角色至少为role, 否则返回403, 必须在Authenticate之后使用
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.AdminRoleAllowed(c.GetString(RoleKey), role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, fmt.Sprintf("%s role is required", role))
+			return
+		}
+	}
+}
+
+// NewServerTLSConfig create tls config of admin server, return nil if cert is empty. ca is used to verify client certificates if given
+func NewServerTLSConfig(cert, key, ca string) (*tls.Config, error) {
+	if cert == "" {
+		return nil, nil
+	}
+	c, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("load admin tls cert error: %v", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{c}}
+	if ca != "" {
+		if cfg.ClientCAs, err = loadCertPool(ca); err != nil {
+			return nil, err
+		}
+		// 未提供客户端证书时仍可使用token或basic auth认证
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
+
+// NewClientTLSConfig create tls config to call admin server, return nil if all arguments are empty
+func NewClientTLSConfig(ca, cert, key string) (*tls.Config, error) {
+	if ca == "" && cert == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	var err error
+	if ca != "" {
+		if cfg.RootCAs, err = loadCertPool(ca); err != nil {
+			return nil, err
+		}
+	}
+	if cert != "" {
+		c, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("load client tls cert error: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{c}
+	}
+	return cfg, nil
+}
+
+func loadCertPool(ca string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, fmt.Errorf("read ca error: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificate found in ca: %s", ca)
+	}
+	return pool, nil
+}
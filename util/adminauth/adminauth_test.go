@@ -0,0 +1,78 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adminauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/XiaoMi/Gaea/models"
+)
+
+func newTestEngine(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	a, err := NewAuthenticator("admin", "secret", "ops:operator:op-token,monitor:viewer:view-token", "")
+	if err != nil {
+		t.Fatalf("new authenticator error: %v", err)
+	}
+	engine := gin.New()
+	g := engine.Group("/api", a.Authenticate())
+	g.GET("/status", RequireRole(models.AdminRoleViewer), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(gin.AuthUserKey))
+	})
+	g.PUT("/readonly", RequireRole(models.AdminRoleOperator), func(c *gin.Context) {
+		c.JSON(http.StatusOK, "OK")
+	})
+	g.DELETE("/config", RequireRole(models.AdminRoleAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, "OK")
+	})
+	return engine
+}
+
+func TestAuthenticate(t *testing.T) {
+	engine := newTestEngine(t)
+
+	tests := []struct {
+		method, path string
+		setAuth      func(r *http.Request)
+		code         int
+		body         string
+	}{
+		{"GET", "/api/status", func(r *http.Request) {}, http.StatusUnauthorized, ""},
+		{"GET", "/api/status", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }, http.StatusUnauthorized, ""},
+		{"GET", "/api/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, http.StatusUnauthorized, ""},
+		{"GET", "/api/status", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK, "admin"},
+		{"DELETE", "/api/config", func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, http.StatusOK, ""},
+		{"GET", "/api/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer view-token") }, http.StatusOK, "token:monitor"},
+		{"PUT", "/api/readonly", func(r *http.Request) { r.Header.Set("Authorization", "Bearer view-token") }, http.StatusForbidden, ""},
+		{"PUT", "/api/readonly", func(r *http.Request) { r.Header.Set("Authorization", "Bearer op-token") }, http.StatusOK, ""},
+		{"DELETE", "/api/config", func(r *http.Request) { r.Header.Set("Authorization", "Bearer op-token") }, http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		test.setAuth(r)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s, expect code: %d, actual: %d", test.method, test.path, test.code, w.Code)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s, expect body: %s, actual: %s", test.method, test.path, test.body, w.Body.String())
+		}
+	}
+}
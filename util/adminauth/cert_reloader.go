@@ -0,0 +1,154 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adminauth
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCertCheckInterval interval of checking modification of cert, key and ca files
+const DefaultCertCheckInterval = 10 * time.Second
+
+// CertReloader 管理接口证书热加载. 证书、私钥或CA文件修改后(或调用Reload)重新加载,
+// 新的握手使用新证书, 已建立的连接不受影响; 加载失败时继续使用原证书
+type CertReloader struct {
+	cert string
+	key  string
+	ca   string
+
+	// onReload 每次重新加载后调用, err不为nil时表示加载失败
+	onReload func(err error)
+
+	config atomic.Value // *tls.Config
+
+	lock     sync.Mutex
+	modTimes []time.Time // 上次加载时文件的修改时间, 与files()顺序一致
+	closeC   chan struct{}
+	closed   bool
+}
+
+// NewCertReloader load cert, key and ca, return nil if cert is empty.
+// onReload is called after every reload triggered by Watch or Reload, may be nil
+func NewCertReloader(cert, key, ca string, onReload func(err error)) (*CertReloader, error) {
+	if cert == "" {
+		return nil, nil
+	}
+	r := &CertReloader{
+		cert:     cert,
+		key:      key,
+		ca:       ca,
+		onReload: onReload,
+		closeC:   make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig return config used by tls listener, each handshake uses the latest loaded config
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config.Load().(*tls.Config), nil
+		},
+	}
+}
+
+// Reload reload cert, key and ca immediately, such as on SIGHUP
+func (r *CertReloader) Reload() error {
+	err := r.load()
+	if r.onReload != nil {
+		r.onReload(err)
+	}
+	return err
+}
+
+// Watch check modification of files every interval in background until Close
+func (r *CertReloader) Watch(interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.closeC:
+				return
+			case <-t.C:
+				if r.changed() {
+					r.Reload()
+				}
+			}
+		}
+	}()
+}
+
+// Close stop watching files
+func (r *CertReloader) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.closed {
+		r.closed = true
+		close(r.closeC)
+	}
+}
+
+func (r *CertReloader) files() []string {
+	files := []string{r.cert, r.key}
+	if r.ca != "" {
+		files = append(files, r.ca)
+	}
+	return files
+}
+
+// load 先记录修改时间再读取文件, 读取期间文件再次修改时下次检查仍会重新加载.
+// 加载失败时同样记录修改时间, 证书和私钥先后更新时, 私钥更新后再次加载
+func (r *CertReloader) load() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.modTimes = statModTimes(r.files())
+	cfg, err := NewServerTLSConfig(r.cert, r.key, r.ca)
+	if err != nil {
+		return err
+	}
+	r.config.Store(cfg)
+	return nil
+}
+
+func (r *CertReloader) changed() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	modTimes := statModTimes(r.files())
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// statModTimes 文件不存在时修改时间为零值
+func statModTimes(files []string) []time.Time {
+	modTimes := make([]time.Time, len(files))
+	for i, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[i] = fi.ModTime()
+		}
+	}
+	return modTimes
+}
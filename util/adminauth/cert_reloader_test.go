@@ -0,0 +1,167 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package adminauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert write self signed cert and key with serial, mod time of files is set to modTime
+func writeTestCert(t *testing.T, certFile, keyFile string, serial int64, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dialSerial connect to addr and return serial number of server cert
+func dialSerial(t *testing.T, addr string) (*tls.Conn, int64) {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gaea_cert_reloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	now := time.Now()
+	writeTestCert(t, certFile, keyFile, 1, now.Add(-time.Minute))
+
+	if r, err := NewCertReloader("", "", "", nil); r != nil || err != nil {
+		t.Fatalf("expect nil reloader without cert, actual: %v %v", r, err)
+	}
+	reloaded := make(chan error, 10)
+	r, err := NewCertReloader(certFile, keyFile, "", func(err error) { reloaded <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// echo
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 1)
+				for {
+					if _, err := c.Read(buf); err != nil {
+						return
+					}
+					if _, err := c.Write(buf); err != nil {
+						return
+					}
+				}
+			}(c)
+		}
+	}()
+
+	oldConn, serial := dialSerial(t, l.Addr().String())
+	defer oldConn.Close()
+	if serial != 1 {
+		t.Fatalf("expect serial 1, actual: %d", serial)
+	}
+
+	// 文件修改后由Watch重新加载
+	writeTestCert(t, certFile, keyFile, 2, now)
+	r.Watch(10 * time.Millisecond)
+	select {
+	case err := <-reloaded:
+		if err != nil {
+			t.Fatalf("reload error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cert not reloaded after modification")
+	}
+	conn, serial := dialSerial(t, l.Addr().String())
+	conn.Close()
+	if serial != 2 {
+		t.Errorf("expect serial 2 after reload, actual: %d", serial)
+	}
+
+	// 已建立的连接不受影响
+	if _, err := oldConn.Write([]byte{'a'}); err != nil {
+		t.Fatalf("write to existing connection error: %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := oldConn.Read(buf); err != nil || buf[0] != 'a' {
+		t.Errorf("existing connection should still work, read: %v, err: %v", buf, err)
+	}
+
+	// 加载失败时继续使用原证书
+	if err := ioutil.WriteFile(keyFile, []byte("invalid"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Errorf("expect reload error with invalid key")
+	}
+	conn, serial = dialSerial(t, l.Addr().String())
+	conn.Close()
+	if serial != 2 {
+		t.Errorf("expect previous cert after failed reload, actual serial: %d", serial)
+	}
+}
@@ -23,6 +23,24 @@ const (
 	StmtType = "stmtType" // SQL类型, 值类型为int (对应parser.Preview()得到的值)
 	// FromSlave if read from slave
 	FromSlave = "fromSlave" // 读写分离标识, 值类型为int, false = 0, true = 1
+	// SampleTrace sample trace
+	SampleTrace = "sampleTrace" // 采样请求的执行信息, 未采样时不设置
+	// RowChange row change of DML
+	RowChange = "rowChange" // DML语句修改的表和分片键, 未注册row change hook时不设置
+	// OutfileDir directory of SELECT ... INTO OUTFILE
+	OutfileDir = "outfileDir" // 允许写入导出文件的本地目录, 值类型为string, 未配置时不设置
+	// ResultTransforms result transforms of select
+	ResultTransforms = "resultTransforms" // 对查询生效的结果集转换规则, 没有规则时不设置
+	// QueryProfile per slice profile of query
+	QueryProfile = "queryProfile" // 各分片的执行耗时, 供SHOW LAST QUERY PROFILE查看
+	// ResourceUsage resource usage of sampled query
+	ResourceUsage = "resourceUsage" // 采样语句的CPU时间和内存分配, 未采样时不设置
+	// VersionCheck optimistic lock check of update
+	VersionCheck = "versionCheck" // UPDATE追加了版本列条件的表, 值类型为string(db.table), 没有匹配的行时返回冲突错误
+	// MergeSpill memory limit and spill config of merge
+	MergeSpill = "mergeSpill" // 跨分片合并结果的内存限制和溢写目录, 值类型为*plan.MergeSpillConfig, 未配置时不设置
+	// TimeZone time_zone of session
+	TimeZone = "timeZone" // 会话设置的time_zone, 值类型为string, 如+08:00, 未设置时不设置
 )
 
 // RequestContext means request scope context with values
@@ -16,6 +16,7 @@ package requests
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/XiaoMi/Gaea/logging"
@@ -40,6 +41,9 @@ const (
 // default global client，safe for concurrent use by multiple goroutines
 var defaultClient *http.Client
 
+// scheme of url created by EncodeURL, https after SetTLSConfig
+var defaultScheme = "http"
+
 func init() {
 	var dials uint64
 	tr := &http.Transport{}
@@ -62,6 +66,12 @@ func init() {
 	}()
 }
 
+// SetTLSConfig use https with cfg for all requests, should be called before sending any request
+func SetTLSConfig(cfg *tls.Config) {
+	defaultClient.Transport.(*http.Transport).TLSClientConfig = cfg
+	defaultScheme = "https"
+}
+
 // Request request info
 type Request struct {
 	User     string
@@ -200,7 +210,7 @@ func SendGet(url, user, password string) (*Response, error) {
 // EncodeURL encode url
 func EncodeURL(host string, format string, args ...interface{}) string {
 	var u url.URL
-	u.Scheme = "http"
+	u.Scheme = defaultScheme
 	u.Host = host
 	u.Path = fmt.Sprintf(format, args...)
 	return u.String()
@@ -0,0 +1,69 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net"
+	"time"
+)
+
+// TCPOptions socket tuning options of tcp connection, ignored by unix socket
+type TCPOptions struct {
+	KeepAlivePeriod time.Duration // 0使用系统默认值, 小于0关闭keepalive
+	NoDelay         bool          // 关闭Nagle算法, 数据立即发送
+	ReadBufferSize  int           // 内核接收缓冲区大小, 0使用系统默认值
+	WriteBufferSize int           // 内核发送缓冲区大小, 0使用系统默认值
+}
+
+// DefaultTCPOptions return options same as go's default: keepalive and nodelay enabled
+func DefaultTCPOptions() TCPOptions {
+	return TCPOptions{NoDelay: true}
+}
+
+// Apply set options on conn, do nothing if conn is not tcp connection
+func (o TCPOptions) Apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if err := tcpConn.SetNoDelay(o.NoDelay); err != nil {
+		return err
+	}
+	if o.KeepAlivePeriod < 0 {
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	} else {
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if o.KeepAlivePeriod > 0 {
+			if err := tcpConn.SetKeepAlivePeriod(o.KeepAlivePeriod); err != nil {
+				return err
+			}
+		}
+	}
+	if o.ReadBufferSize > 0 {
+		if err := tcpConn.SetReadBuffer(o.ReadBufferSize); err != nil {
+			return err
+		}
+	}
+	if o.WriteBufferSize > 0 {
+		if err := tcpConn.SetWriteBuffer(o.WriteBufferSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 The Gaea Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPOptionsApply(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	opts := []TCPOptions{
+		DefaultTCPOptions(),
+		{KeepAlivePeriod: 30 * time.Second, NoDelay: false, ReadBufferSize: 64 * 1024, WriteBufferSize: 64 * 1024},
+		{KeepAlivePeriod: -1, NoDelay: true},
+	}
+	for _, o := range opts {
+		if err := o.Apply(c); err != nil {
+			t.Errorf("apply tcp options %+v error: %v", o, err)
+		}
+	}
+}
+
+func TestTCPOptionsApplyNonTCP(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if err := DefaultTCPOptions().Apply(c1); err != nil {
+		t.Errorf("apply tcp options on pipe should be ignored, err: %v", err)
+	}
+}